@@ -0,0 +1,44 @@
+package main
+
+import (
+	"Groupchat-Service/internal/config"
+	"Groupchat-Service/internal/services"
+	"Groupchat-Service/internal/util"
+	"log"
+	"time"
+)
+
+// runArchive moves the messages older than ARCHIVE_AFTER_DAYS to the archive once, for every tenant
+func runArchive(cfg *config.Config) {
+	if !cfg.ArchiveEnabled {
+		log.Fatalf("The archive is not enabled, set ARCHIVE_ENABLED=true")
+	}
+
+	scopes, err := storageScopes(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load tenants: %v", err)
+	}
+	for _, scope := range scopes {
+		archiveScope(cfg, scope)
+	}
+}
+
+func archiveScope(cfg *config.Config, scope storageScope) {
+	repos, err := newRepositories(cfg, scope)
+	if err != nil {
+		log.Fatalf("%sFailed to create repositories: %v", scope.logPrefix(), err)
+	}
+
+	service := services.NewArchiveService(repos.Messages, repos.Archive,
+		services.ArchiveConfig{After: time.Duration(cfg.ArchiveAfterDays) * 24 * time.Hour, BatchSize: cfg.ArchiveBatchSize},
+		util.NewLoggerFactory())
+	reports, err := service.ArchiveOldMessages(scope.context())
+
+	for _, report := range reports {
+		log.Printf("%sArchived %d messages of group %s sent before %s", scope.logPrefix(),
+			report.MessageCount, report.GroupID, report.Cutoff.Format("2006-01-02 15:04:05"))
+	}
+	if err != nil {
+		log.Fatalf("%sArchive failed: %v", scope.logPrefix(), err)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"Groupchat-Service/internal/backup"
+	"Groupchat-Service/internal/config"
+	"Groupchat-Service/internal/services"
+	"Groupchat-Service/internal/util"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// runBackup exports every table of one tenant to a backup file. The file holds message content in plaintext,
+// also when the content is encrypted at rest, so it must be kept as safe as the storage itself.
+func runBackup(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := flags.String("out", "", "backup file to write")
+	tenantID := flags.String("tenant", "", "tenant to back up; required when multi-tenancy is enabled")
+	batchSize := flags.Int("batch-size", 500, "number of messages read per batch")
+	flags.Parse(args)
+
+	if *out == "" {
+		log.Fatalf("Set the backup file with -out")
+	}
+	scope, err := backupScope(cfg, *tenantID)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	repos, err := newStorageRepositories(cfg, scope)
+	if err != nil {
+		log.Fatalf("%sFailed to create repositories: %v", scope.logPrefix(), err)
+	}
+	if err := attachArchive(cfg, scope, repos); err != nil {
+		log.Fatalf("%sFailed to open the message archive: %v", scope.logPrefix(), err)
+	}
+	revocationRepo, err := newRevocationRepository(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create token revocation repository: %v", err)
+	}
+
+	// Write next to the target and rename on success, so an interrupted backup never looks complete
+	partial := *out + ".partial"
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		log.Fatalf("Failed to create backup file: %v", err)
+	}
+	defer os.Remove(partial)
+
+	writer := backup.NewWriter(file, scope.tenantID, time.Now())
+	service := services.NewBackupService(repos, revocationRepo, services.BackupConfig{BatchSize: *batchSize}, util.NewLoggerFactory())
+	if err := service.Backup(scope.context(), writer); err != nil {
+		log.Fatalf("%sBackup failed: %v", scope.logPrefix(), err)
+	}
+	if err := writer.Close(); err != nil {
+		log.Fatalf("%sBackup failed: %v", scope.logPrefix(), err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("%sBackup failed: %v", scope.logPrefix(), err)
+	}
+	if err := os.Rename(partial, *out); err != nil {
+		log.Fatalf("Failed to move backup into place: %v", err)
+	}
+
+	for _, table := range writer.Manifest().Tables {
+		log.Printf("%sBacked up %d records of %s", scope.logPrefix(), table.Records, table.Name)
+	}
+	log.Printf("%sBackup written to %s", scope.logPrefix(), *out)
+}
+
+// runRestore writes the records of a backup that are missing from storage. With -group it restores one
+// group, for instance after an accidental purge; with -until only the messages sent before that time.
+func runRestore(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := flags.String("in", "", "backup file to restore")
+	tenantID := flags.String("tenant", "", "tenant to restore into; defaults to the tenant of the backup")
+	group := flags.String("group", "", "restore only this group")
+	until := flags.String("until", "", "restore only messages sent before this time (RFC 3339)")
+	tables := flags.String("tables", "", "comma-separated tables to restore; defaults to all: "+strings.Join(backup.Tables, ","))
+	flags.Parse(args)
+
+	if *in == "" {
+		log.Fatalf("Set the backup file with -in")
+	}
+	reader, err := backup.Open(*in)
+	if err != nil {
+		log.Fatalf("Failed to read backup: %v", err)
+	}
+	manifest := reader.Manifest()
+	log.Printf("Restoring backup taken at %s", manifest.CreatedAt.Format(time.RFC3339))
+
+	options, err := restoreOptions(*group, *until, *tables)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *tenantID == "" && cfg.MultiTenantEnabled {
+		*tenantID = manifest.Tenant
+	}
+	scope, err := backupScope(cfg, *tenantID)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	repos, err := newStorageRepositories(cfg, scope)
+	if err != nil {
+		log.Fatalf("%sFailed to create repositories: %v", scope.logPrefix(), err)
+	}
+	if err := attachArchive(cfg, scope, repos); err != nil {
+		log.Fatalf("%sFailed to open the message archive: %v", scope.logPrefix(), err)
+	}
+	revocationRepo, err := newRevocationRepository(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create token revocation repository: %v", err)
+	}
+
+	service := services.NewBackupService(repos, revocationRepo, services.BackupConfig{}, util.NewLoggerFactory())
+	reports, err := service.Restore(scope.context(), reader, options)
+	for _, report := range reports {
+		log.Printf("%sRestored %d records of %s, skipped %d", scope.logPrefix(), report.Restored, report.Table, report.Skipped)
+	}
+	if err != nil {
+		log.Fatalf("%sRestore failed, it is safe to run again: %v", scope.logPrefix(), err)
+	}
+	if cfg.MessageCacheEnabled {
+		log.Printf("Cached message pages may not show restored messages until the cache TTL of %s", cfg.MessageCacheTTL)
+	}
+}
+
+// backupScope selects the storage of the tenant to back up or restore
+func backupScope(cfg *config.Config, tenantID string) (storageScope, error) {
+	scopes, err := storageScopes(cfg)
+	if err != nil {
+		return storageScope{}, fmt.Errorf("failed to load tenants: %w", err)
+	}
+	if !cfg.MultiTenantEnabled {
+		if tenantID != "" {
+			return storageScope{}, fmt.Errorf("tenant %s given, but multi-tenancy is not enabled", tenantID)
+		}
+		return scopes[0], nil
+	}
+	if tenantID == "" {
+		return storageScope{}, fmt.Errorf("multi-tenancy is enabled, select the tenant with -tenant")
+	}
+	for _, scope := range scopes {
+		if scope.tenantID == tenantID {
+			return scope, nil
+		}
+	}
+	return storageScope{}, fmt.Errorf("unknown tenant %s", tenantID)
+}
+
+func restoreOptions(group string, until string, tables string) (services.RestoreOptions, error) {
+	var options services.RestoreOptions
+	var err error
+	if group != "" {
+		if options.GroupID, err = uuid.Parse(group); err != nil {
+			return options, fmt.Errorf("invalid group ID %q", group)
+		}
+	}
+	if until != "" {
+		if options.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return options, fmt.Errorf("invalid time %q, use RFC 3339 such as 2024-05-01T12:00:00Z", until)
+		}
+	}
+	if tables != "" {
+		for _, table := range strings.Split(tables, ",") {
+			table = strings.TrimSpace(table)
+			if !slices.Contains(backup.Tables, table) {
+				return options, fmt.Errorf("unknown table %q, choose from %s", table, strings.Join(backup.Tables, ","))
+			}
+			options.Tables = append(options.Tables, table)
+		}
+	}
+	return options, nil
+}
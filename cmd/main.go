@@ -1,21 +1,24 @@
 package main
 
 import (
+	"Groupchat-Service/internal/blobstore"
+	"Groupchat-Service/internal/cache"
 	"Groupchat-Service/internal/config"
 	"Groupchat-Service/internal/controllers"
 	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/encryption"
 	"Groupchat-Service/internal/middleware"
+	"Groupchat-Service/internal/policy"
+	"Groupchat-Service/internal/ratelimit"
 	"Groupchat-Service/internal/services"
 	"Groupchat-Service/internal/util"
 	"context"
-	firebase "firebase.google.com/go/v4"
 	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	_ "github.com/lib/pq"
-	"google.golang.org/api/option"
 	"log"
 	"net/http"
+	"os"
 	"time"
 )
 
@@ -26,86 +29,205 @@ func main() {
 		log.Fatalf("Error loading config: %v", err)
 	}
 
-	// Initialize Azure Table client
-	tableClient, err := repositories.NewTableClient(cfg.AzureConnectionString)
-	if err != nil {
-		log.Fatalf("Failed to create table client: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "archive" {
+		runArchive(cfg)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reencrypt" {
+		runReencrypt(cfg, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "purge" {
+		runPurge(cfg, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		runBackup(cfg, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		runRestore(cfg, os.Args[2:])
+		return
 	}
 
 	// Initialize repositories
-	messageRepo, err := repositories.NewMessageRepository(tableClient)
+	scopes, err := storageScopes(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create message repository: %v", err)
+		log.Fatalf("Failed to load tenants: %v", err)
 	}
-
-	fcmTokenRepo, err := repositories.NewFCMTokenRepository(tableClient)
-	if err != nil {
-		log.Fatalf("Failed to create FCM token repository: %v", err)
+	scopedRepos := make(map[string]*repositories.Repositories, len(scopes))
+	for _, scope := range scopes {
+		if scopedRepos[scope.tenantID], err = newRepositories(cfg, scope); err != nil {
+			log.Fatalf("%sFailed to create repositories: %v", scope.logPrefix(), err)
+		}
+	}
+	repos := scopedRepos[""]
+	if cfg.MultiTenantEnabled {
+		log.Printf("Serving %d tenants", len(scopes))
+		repos = repositories.NewTenantRepositories(scopedRepos)
 	}
+	messageRepo := repos.Messages
+	fcmTokenRepo := repos.FCMTokens
+	userPreferencesRepo := repos.UserPreferences
+	groupSettingsRepo := repos.GroupSettings
 
 	// Initialize health repository
 	healthRepo := repositories.NewHealthRepository(cfg.UserServiceURL, util.NewLoggerFactory())
 
 	// Initialize services
-	notificationService, err := services.NewNotificationService(cfg.FirebaseCredentialFile, messageRepo)
+	templates, err := services.NewTemplateCatalogue(cfg.NotificationTemplatesDir, cfg.DefaultLocale)
 	if err != nil {
-		log.Fatalf("Failed to create notification service: %v", err)
+		log.Fatalf("Failed to load notification templates: %v", err)
+	}
+
+	sender, recorder, err := newNotificationSender(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create notification sender: %v", err)
+	}
+	notificationService := services.NewNotificationService(sender, messageRepo, templates)
+
+	if cfg.CursorSecret == "" {
+		log.Println("Warning: CURSOR_SECRET is not set, pagination cursors are invalidated on restart and not shared between instances")
+	}
+	cursorCodec, err := services.NewCursorCodec(cfg.CursorSecret, cfg.CursorTTL)
+	if err != nil {
+		log.Fatalf("Failed to create cursor codec: %v", err)
 	}
 
 	validationService := services.NewValidationService(cfg.UserServiceURL)
-	messageService := services.NewMessageService(messageRepo, fcmTokenRepo, notificationService, validationService)
+	messageService := services.NewMessageService(messageRepo, fcmTokenRepo, userPreferencesRepo, groupSettingsRepo, notificationService, validationService, cursorCodec)
 	fcmTokenService := services.NewFCMTokenService(fcmTokenRepo)
+	userPreferencesService := services.NewUserPreferencesService(userPreferencesRepo)
+	groupSettingsService := services.NewGroupSettingsService(groupSettingsRepo)
+	keyDistributionService := services.NewKeyDistributionService(repos.KeyBundles)
+	accessAuditService := services.NewAccessAuditService(repos.AccessAudits)
 	healthService := services.NewHealthService(healthRepo, util.NewLoggerFactory())
+	groupMembershipService := services.NewGroupMembershipService(
+		repositories.NewGroupMembershipRepository(cfg.UserServiceURL, util.NewLoggerFactory()),
+		services.GroupMembershipConfig{CacheSize: cfg.GroupMembershipCacheSize, CacheTTL: cfg.GroupMembershipCacheTTL})
+	digestService := services.NewDigestService(
+		messageRepo,
+		userPreferencesRepo,
+		groupSettingsRepo,
+		services.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom),
+		templates,
+		services.DigestConfig{PublicBaseURL: cfg.PublicBaseURL, UnsubscribeSecret: cfg.DigestUnsubscribeSecret},
+		util.NewLoggerFactory(),
+	)
+
+	// Revoked tokens are shared by every tenant and kept in the default storage
+	revocationRepo, err := newRevocationRepository(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create token revocation repository: %v", err)
+	}
+	revocationService := services.NewTokenRevocationService(revocationRepo,
+		services.TokenRevocationConfig{TTL: cfg.TokenRevocationTTL}, util.NewLoggerFactory())
+	if err := revocationService.Refresh(context.Background()); err != nil {
+		log.Fatalf("Failed to load token revocations: %v", err)
+	}
+	services.StartTokenRevocationRefresher(context.Background(), revocationService, cfg.TokenRevocationRefreshInterval)
+
+	// Background jobs run once per tenant, on that tenant's own repositories
+	for _, scope := range scopes {
+		tenantRepos := scopedRepos[scope.tenantID]
+		if cfg.EmailDigestEnabled {
+			services.StartDigestScheduler(scope.context(), digestService, cfg.EmailDigestInterval, util.NewLoggerFactory())
+		}
+
+		if cfg.ArchiveJobEnabled {
+			archiveService := services.NewArchiveService(tenantRepos.Messages, tenantRepos.Archive,
+				services.ArchiveConfig{After: time.Duration(cfg.ArchiveAfterDays) * 24 * time.Hour, BatchSize: cfg.ArchiveBatchSize},
+				util.NewLoggerFactory())
+			services.StartArchiveScheduler(scope.context(), archiveService, cfg.ArchiveInterval)
+		}
+
+		if cfg.RetentionPurgeEnabled {
+			retentionService := services.NewRetentionService(tenantRepos.Messages, tenantRepos.Archive, tenantRepos.GroupSettings, tenantRepos.PurgeAudits,
+				services.RetentionConfig{BatchSize: cfg.RetentionPurgeBatchSize}, util.NewLoggerFactory())
+			services.StartRetentionScheduler(scope.context(), retentionService, cfg.RetentionPurgeInterval, cfg.RetentionPurgeDryRun)
+		}
+	}
+
+	// Which roles may do what is decided by the access policy, by action name
+	accessPolicy, err := policy.Load(cfg.PolicyFile, services.NewPolicyResources(messageRepo, groupSettingsRepo))
+	if err != nil {
+		log.Fatalf("Failed to load access policy: %v", err)
+	}
 
 	// Initialize controllers
-	messageController := controllers.NewMessageController(messageService, validationService)
-	fcmTokenController := controllers.NewFCMTokenController(fcmTokenService, validationService)
+	messageController := controllers.NewMessageController(messageService, validationService, accessPolicy)
+	fcmTokenController := controllers.NewFCMTokenController(fcmTokenService, validationService, accessPolicy)
+	userPreferencesController := controllers.NewUserPreferencesController(userPreferencesService, validationService, accessPolicy)
+	groupSettingsController := controllers.NewGroupSettingsController(groupSettingsService, accessPolicy)
+	keyDistributionController := controllers.NewKeyDistributionController(keyDistributionService, accessPolicy)
+	digestController := controllers.NewDigestController(digestService)
 	healthController := controllers.NewHealthController(healthService)
+	tokenRevocationController := controllers.NewTokenRevocationController(revocationService, accessPolicy)
+	accessAuditController := controllers.NewAccessAuditController(accessAuditService, accessPolicy)
 
 	// Set up router
 	router := gin.Default()
 
-	// Add CORS middleware
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	// Add CORS middleware. Credentials are allowed, so origins must be listed: browsers refuse "*" with them.
+	if allowedOrigins := config.SplitList(cfg.CORSAllowedOrigins); len(allowedOrigins) > 0 {
+		router.Use(cors.New(cors.Config{
+			AllowOrigins:     allowedOrigins,
+			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
+			AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "If-Match"},
+			ExposeHeaders:    []string{"Content-Length", "ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+			AllowCredentials: true,
+			MaxAge:           12 * time.Hour,
+		}))
+	} else {
+		log.Println("CORS_ALLOWED_ORIGINS is not set, browsers on other origins cannot call this service")
+	}
 
 	// Add Prometheus middleware BEFORE other middleware
 	router.Use(middleware.PrometheusMiddleware())
 
 	// Add JWT middleware
-	jwtMiddleware, err := middleware.NewJWTMiddleware(cfg)
+	jwtMiddleware, err := middleware.NewJWTMiddleware(cfg, revocationService)
 	if err != nil {
 		log.Fatalf("Failed to initialize JWT middleware: %v", err)
 	}
 	router.Use(jwtMiddleware)
+	if cfg.MultiTenantEnabled {
+		router.Use(middleware.NewTenantMiddleware(cfg.TenantClaim, tenantsOf(scopes)))
+	}
+	// Professionals reach the groups they are assigned to, and every request they make there is audited
+	router.Use(middleware.NewAccessAuditMiddleware(accessAuditService, middleware.OversightRoles...))
+	router.Use(middleware.NewGroupScopeMiddleware(cfg.GroupsClaim, groupMembershipService))
+	if cfg.RateLimitEnabled {
+		rateLimiter, err := newRateLimiter(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize rate limiter: %v", err)
+		}
+		router.Use(middleware.NewRateLimitMiddleware(rateLimiter))
+	}
 
 	// Register routes
 	messageController.RegisterRoutes(router)
 	fcmTokenController.RegisterRoutes(router)
+	userPreferencesController.RegisterRoutes(router)
+	groupSettingsController.RegisterRoutes(router)
+	keyDistributionController.RegisterRoutes(router)
+	digestController.RegisterRoutes(router)
 	healthController.RegisterRoutes(router)
+	tokenRevocationController.RegisterRoutes(router)
+	accessAuditController.RegisterRoutes(router)
 
-	middleware.RegisterMetricsEndpoint(router)
-
-	// Get the path to the serviceAccountKey.json file
-	serviceAccountPath := cfg.FirebaseCredentialFile
-	if serviceAccountPath == "" {
-		log.Fatalf("FIREBASE_CREDENTIAL_FILE is not set correctly")
+	if cfg.Debug {
+		if recorder != nil {
+			controllers.NewDebugController(recorder, accessPolicy).RegisterRoutes(router)
+		}
+		controllers.NewPolicyController(accessPolicy).RegisterRoutes(router)
 	}
 
-	// Initialize Firebase with service account
-	opt := option.WithCredentialsFile(serviceAccountPath)
-	_, err = firebase.NewApp(context.Background(), nil, opt)
-	if err != nil {
-		log.Fatalf("Failed to initialize Firebase: %v", err)
-	}
-
-	fmt.Println("Firebase initialized successfully")
+	middleware.RegisterMetricsEndpoint(router)
 
 	// Start server
 	port := fmt.Sprintf(":%d", cfg.Port)
@@ -116,3 +238,207 @@ func main() {
 
 	log.Println("Server exited properly")
 }
+
+// newRepositories selects the storage backend of a scope and puts the message cache in front of it when enabled
+func newRepositories(cfg *config.Config, scope storageScope) (*repositories.Repositories, error) {
+	repos, err := newStorageRepositories(cfg, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attachArchive(cfg, scope, repos); err != nil {
+		return nil, err
+	}
+	if repos.Archive != nil {
+		repos.Messages = repositories.NewArchivedMessageRepository(repos.Messages, repos.Archive)
+	}
+
+	if !cfg.MessageCacheEnabled {
+		return repos, nil
+	}
+
+	messageCache := repositories.NewMemoryMessageCache(cfg.MessageCacheGroups, cfg.MessageCacheTTL)
+	if cfg.RedisURL != "" {
+		client, err := cache.NewRedisClient(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Caching recent messages in Redis")
+		messageCache = repositories.NewRedisMessageCache(client, scope.tenantID, cfg.MessageCacheTTL, repos.Cipher)
+	} else {
+		log.Println("Caching recent messages in memory, replicas may serve stale messages until the cache TTL")
+	}
+	repos.Messages = repositories.NewCachedMessageRepository(repos.Messages, messageCache, cfg.MessageCacheSize, util.NewLoggerFactory())
+	return repos, nil
+}
+
+// newRateLimiter keeps the token buckets in Redis when RATE_LIMIT_BACKEND is redis, so that all replicas share
+// them, and in memory otherwise
+func newRateLimiter(cfg *config.Config) (*ratelimit.Limiter, error) {
+	store := ratelimit.NewMemoryStore(cfg.RateLimitMemoryBuckets)
+	if cfg.RateLimitBackend == config.RateLimitBackendRedis {
+		client, err := cache.NewRedisClient(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Rate limiting through Redis")
+		store = ratelimit.NewRedisStore(client)
+	} else {
+		log.Println("Rate limiting in memory, every replica applies the limits on its own")
+	}
+	return ratelimit.Load(cfg.RateLimitFile, store)
+}
+
+// attachArchive sets the message archive of the repositories when ARCHIVE_ENABLED is set. It leaves the
+// message repository alone, so callers decide whether reads continue into the archive.
+func attachArchive(cfg *config.Config, scope storageScope, repos *repositories.Repositories) error {
+	if !cfg.ArchiveEnabled {
+		return nil
+	}
+	archiveStore, err := newArchiveStore(cfg, scope)
+	if err != nil {
+		return err
+	}
+	if repos.Cipher != nil {
+		repos.Archive = repositories.NewEncryptedMessageArchive(archiveStore, repos.Cipher)
+	} else {
+		repos.Archive = repositories.NewMessageArchive(archiveStore)
+	}
+	return nil
+}
+
+// newArchiveStore keeps the message archive in a local directory when ARCHIVE_DIR is set and in blob storage
+// otherwise. Tenants with their own Azure storage account keep their archive there; every tenant archives
+// under its own prefix.
+func newArchiveStore(cfg *config.Config, scope storageScope) (repositories.ArchiveStore, error) {
+	var store repositories.ArchiveStore
+	if cfg.ArchiveDir != "" {
+		log.Printf("%sArchiving messages to %s", scope.logPrefix(), cfg.ArchiveDir)
+		store = repositories.NewFileArchiveStore(cfg.ArchiveDir)
+	} else {
+		connectionString := cfg.ArchiveConnectionString
+		if cfg.StorageBackend == config.StorageBackendAzure && scope.storage.ConnectionString != "" {
+			connectionString = scope.storage.ConnectionString
+		}
+		if connectionString == "" {
+			connectionString = cfg.AzureConnectionString
+		}
+		client, err := blobstore.NewClientFromConnectionString(connectionString, cfg.ArchiveContainer)
+		if err != nil {
+			return nil, err
+		}
+		if store, err = repositories.NewBlobArchiveStore(client); err != nil {
+			return nil, err
+		}
+	}
+
+	if scope.tenantID != "" {
+		store = repositories.NewPrefixedArchiveStore(store, scope.tenantID)
+	}
+	return store, nil
+}
+
+func newStorageRepositories(cfg *config.Config, scope storageScope) (*repositories.Repositories, error) {
+	switch cfg.StorageBackend {
+	case config.StorageBackendPostgres:
+		db, err := repositories.NewPostgresDB(postgresDSN(cfg, scope))
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Using PostgreSQL storage backend")
+		return repositories.NewPostgresRepositories(db), nil
+	case config.StorageBackendMemory:
+		log.Println("Using in-memory storage backend, data is lost on restart")
+		return repositories.NewMemoryRepositories(), nil
+	default:
+		tableClient, err := newTableService(cfg, scope)
+		if err != nil {
+			return nil, err
+		}
+		repos, err := repositories.NewAzureRepositories(tableClient)
+		if err != nil || !cfg.EncryptionEnabled {
+			return repos, err
+		}
+
+		repos.Cipher, err = newContentCipher(cfg, tableClient)
+		if err != nil {
+			return nil, err
+		}
+		repos.Messages, err = repositories.NewEncryptedMessageRepository(tableClient, repos.Cipher)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Encrypting message content")
+		return repos, nil
+	}
+}
+
+// newRevocationRepository opens the token revocation denylist in the default storage, outside any tenant
+func newRevocationRepository(cfg *config.Config) (repositories.TokenRevocationRepository, error) {
+	switch cfg.StorageBackend {
+	case config.StorageBackendPostgres:
+		db, err := repositories.NewPostgresDB(cfg.PostgresDSN)
+		if err != nil {
+			return nil, err
+		}
+		return repositories.NewPostgresTokenRevocationRepository(db), nil
+	case config.StorageBackendMemory:
+		return repositories.NewMemoryTokenRevocationRepository(), nil
+	default:
+		tableClient, err := repositories.NewTableClient(cfg.AzureConnectionString)
+		if err != nil {
+			return nil, err
+		}
+		return repositories.NewTokenRevocationRepository(tableClient)
+	}
+}
+
+// newContentCipher loads the master keys from ENCRYPTION_KEY_FILE or ENCRYPTION_MASTER_KEYS
+func newContentCipher(cfg *config.Config, tableClient *repositories.TableService) (*repositories.ContentCipher, error) {
+	var masterKeys *encryption.MasterKeys
+	var err error
+	if cfg.EncryptionKeyFile != "" {
+		masterKeys, err = encryption.LoadMasterKeyFile(cfg.EncryptionKeyFile)
+	} else {
+		masterKeys, err = encryption.ParseMasterKeys(cfg.EncryptionMasterKeys, cfg.EncryptionCurrentKeyID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	groupKeys, err := repositories.NewGroupKeyRepository(tableClient)
+	if err != nil {
+		return nil, err
+	}
+	return repositories.NewContentCipher(masterKeys, groupKeys), nil
+}
+
+// newNotificationSender selects the push backend. The emulator backends also return a recorder
+// so the captured notifications can be inspected through the debug endpoint.
+func newNotificationSender(cfg *config.Config) (services.MulticastSender, services.NotificationRecorder, error) {
+	rules, err := services.ParseEmulatorFailureRules(cfg.NotificationEmulatorFailures)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch cfg.NotificationBackend {
+	case config.NotificationBackendMemory:
+		log.Println("Using in-memory FCM emulator for notifications")
+		emulator := services.NewMemoryEmulatorSender(rules)
+		return emulator, emulator, nil
+	case config.NotificationBackendFile:
+		log.Printf("Using file FCM emulator for notifications, recording to %s", cfg.NotificationEmulatorFile)
+		emulator, err := services.NewFileEmulatorSender(cfg.NotificationEmulatorFile, rules)
+		if err != nil {
+			return nil, nil, err
+		}
+		return emulator, emulator, nil
+	default:
+		sender, err := services.NewFCMSender(cfg.FirebaseCredentialFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Println("Firebase initialized successfully")
+		return sender, nil, nil
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"Groupchat-Service/internal/config"
+	"Groupchat-Service/internal/database/repositories"
+	"context"
+	"flag"
+	"log"
+)
+
+// runMigrate upgrades stored data to the current storage layout and builds the search index of messages
+// stored before it existed. It is safe to run more than once.
+func runMigrate(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	batchSize := flags.Int("batch-size", 100, "number of entities upgraded per batch")
+	restart := flags.Bool("restart", false, "upgrade entity schemas from the start instead of resuming")
+	flags.Parse(args)
+
+	scopes, err := storageScopes(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load tenants: %v", err)
+	}
+	for _, scope := range scopes {
+		if scope.tenantID != "" {
+			log.Printf("Migrating tenant %s", scope.tenantID)
+		}
+		switch cfg.StorageBackend {
+		case config.StorageBackendAzure:
+			migrateAzure(cfg, scope, *batchSize, *restart)
+		case config.StorageBackendPostgres:
+			migratePostgres(cfg, scope)
+		default:
+			log.Printf("Nothing to migrate for the %s storage backend", cfg.StorageBackend)
+			return
+		}
+	}
+}
+
+func migrateAzure(cfg *config.Config, scope storageScope, batchSize int, restart bool) {
+	tableClient, err := newTableService(cfg, scope)
+	if err != nil {
+		log.Fatalf("Failed to create table client: %v", err)
+	}
+
+	log.Println("Migrating messages to reverse-chronological RowKeys")
+	migrated, err := repositories.MigrateMessageRowKeys(context.Background(), tableClient, func(migrated int) {
+		if migrated%100 == 0 {
+			log.Printf("Migrated %d messages", migrated)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Migration failed after %d messages: %v", migrated, err)
+	}
+	log.Printf("Migration complete, migrated %d messages", migrated)
+
+	log.Println("Adding the message sequence")
+	added, err := repositories.BuildMessageSequence(context.Background(), tableClient, func(added int) {
+		log.Printf("Added %d messages to the sequence", added)
+	})
+	if err != nil {
+		log.Fatalf("Adding the message sequence failed after %d messages: %v", added, err)
+	}
+	log.Printf("Message sequence complete, added %d messages", added)
+
+	log.Println("Upgrading entity schemas")
+	err = repositories.UpgradeEntitySchemas(context.Background(), tableClient, batchSize, restart, func(progress repositories.SchemaUpgradeProgress) {
+		if progress.Completed {
+			log.Printf("%s is at schema version %d, scanned %d and upgraded %d entities",
+				progress.Table, progress.Version, progress.Scanned, progress.Upgraded)
+			return
+		}
+		log.Printf("%s: scanned %d, upgraded %d entities", progress.Table, progress.Scanned, progress.Upgraded)
+	})
+	if err != nil {
+		log.Fatalf("Schema upgrade failed, run migrate again to resume: %v", err)
+	}
+
+	var cipher *repositories.ContentCipher
+	if cfg.EncryptionEnabled {
+		if cipher, err = newContentCipher(cfg, tableClient); err != nil {
+			log.Fatalf("Failed to load encryption keys: %v", err)
+		}
+	}
+
+	log.Println("Building the message search index")
+	indexed, err := repositories.BuildMessageSearchIndex(context.Background(), tableClient, cipher, func(indexed int) {
+		if indexed%100 == 0 {
+			log.Printf("Indexed %d messages", indexed)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Indexing failed after %d messages: %v", indexed, err)
+	}
+	log.Printf("Search index complete, indexed %d messages", indexed)
+}
+
+func migratePostgres(cfg *config.Config, scope storageScope) {
+	// Opening the database applies the schema migrations
+	db, err := repositories.NewPostgresDB(postgresDSN(cfg, scope))
+	if err != nil {
+		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+	}
+	defer db.Close()
+
+	log.Println("Building the message search index")
+	indexed, err := repositories.BuildPostgresMessageSearchIndex(context.Background(), db, func(indexed int) {
+		log.Printf("Indexed %d messages", indexed)
+	})
+	if err != nil {
+		log.Fatalf("Indexing failed after %d messages: %v", indexed, err)
+	}
+	log.Printf("Search index complete, indexed %d messages", indexed)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"Groupchat-Service/internal/config"
+	"Groupchat-Service/internal/services"
+	"Groupchat-Service/internal/util"
+	"flag"
+	"log"
+)
+
+// runPurge applies the group retention policies of every tenant once. With --dry-run it only reports what
+// would be deleted.
+func runPurge(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("purge", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", cfg.RetentionPurgeDryRun, "report what would be deleted without deleting")
+	flags.Parse(args)
+
+	scopes, err := storageScopes(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load tenants: %v", err)
+	}
+	for _, scope := range scopes {
+		purgeScope(cfg, scope, *dryRun)
+	}
+}
+
+func purgeScope(cfg *config.Config, scope storageScope, dryRun bool) {
+	repos, err := newRepositories(cfg, scope)
+	if err != nil {
+		log.Fatalf("%sFailed to create repositories: %v", scope.logPrefix(), err)
+	}
+
+	service := services.NewRetentionService(repos.Messages, repos.Archive, repos.GroupSettings, repos.PurgeAudits,
+		services.RetentionConfig{BatchSize: cfg.RetentionPurgeBatchSize}, util.NewLoggerFactory())
+	reports, err := service.PurgeExpiredMessages(scope.context(), dryRun)
+
+	verb := "Purged"
+	if dryRun {
+		verb = "Would purge"
+	}
+	for _, report := range reports {
+		log.Printf("%s%s %d messages of group %s sent before %s (keep pinned: %t)", scope.logPrefix(),
+			verb, report.MessageCount, report.GroupID, report.Cutoff.Format("2006-01-02 15:04:05"), report.KeepPinned)
+	}
+	if err != nil {
+		log.Fatalf("%sPurge failed: %v", scope.logPrefix(), err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"Groupchat-Service/internal/config"
+	"Groupchat-Service/internal/database/repositories"
+	"context"
+	"flag"
+	"log"
+)
+
+// runReencrypt wraps every group data key with the current master key and rewrites the messages that are
+// stored in plaintext or with an older data key. It is safe to run more than once.
+func runReencrypt(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("reencrypt", flag.ExitOnError)
+	batchSize := flags.Int("batch-size", 100, "number of messages read per batch")
+	rotate := flags.Bool("rotate", false, "give every group a new data key before re-encrypting; omit to resume an interrupted rotation")
+	flags.Parse(args)
+
+	if !cfg.EncryptionEnabled {
+		log.Fatalf("Encryption is not enabled, set ENCRYPTION_ENABLED=true")
+	}
+
+	scopes, err := storageScopes(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load tenants: %v", err)
+	}
+	for _, scope := range scopes {
+		if scope.tenantID != "" {
+			log.Printf("Re-encrypting tenant %s", scope.tenantID)
+		}
+		reencryptScope(cfg, scope, *batchSize, *rotate)
+	}
+}
+
+func reencryptScope(cfg *config.Config, scope storageScope, batchSize int, rotate bool) {
+	tableClient, err := newTableService(cfg, scope)
+	if err != nil {
+		log.Fatalf("Failed to create table client: %v", err)
+	}
+	cipher, err := newContentCipher(cfg, tableClient)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	log.Println("Wrapping data keys with the current master key")
+	rewrapped, err := cipher.RewrapGroupKeys(context.Background())
+	if err != nil {
+		log.Fatalf("Rewrapping failed after %d data keys: %v", rewrapped, err)
+	}
+	log.Printf("Rewrapped %d data keys", rewrapped)
+
+	log.Println("Re-encrypting messages")
+	err = repositories.ReencryptMessages(context.Background(), tableClient, cipher, batchSize, rotate, func(progress repositories.ReencryptionProgress) {
+		log.Printf("Group %s: scanned %d, re-encrypted %d with key %s, skipped %d changed messages",
+			progress.GroupID, progress.Scanned, progress.Reencrypted, progress.KeyID, progress.Skipped)
+	})
+	if err != nil {
+		log.Fatalf("Re-encryption failed, run reencrypt again without -rotate to resume: %v", err)
+	}
+	log.Println("Re-encryption complete")
+}
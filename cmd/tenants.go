@@ -0,0 +1,87 @@
+package main
+
+import (
+	"Groupchat-Service/internal/config"
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/tenant"
+	"context"
+	"fmt"
+)
+
+// storageScope is the storage of one tenant. Without multi-tenancy there is a single scope with an empty
+// tenant ID that uses the configured storage as it is.
+type storageScope struct {
+	tenantID string
+	storage  tenant.Storage
+}
+
+// context returns a background context scoped to the tenant, for jobs that run outside a request
+func (s storageScope) context() context.Context {
+	if s.tenantID == "" {
+		return context.Background()
+	}
+	return tenant.WithTenant(context.Background(), s.tenantID)
+}
+
+// logPrefix names the tenant in the log lines of jobs that run once per tenant
+func (s storageScope) logPrefix() string {
+	if s.tenantID == "" {
+		return ""
+	}
+	return fmt.Sprintf("Tenant %s: ", s.tenantID)
+}
+
+// storageScopes reads the tenants from TENANTS_FILE when multi-tenancy is enabled
+func storageScopes(cfg *config.Config) ([]storageScope, error) {
+	if !cfg.MultiTenantEnabled {
+		return []storageScope{{}}, nil
+	}
+
+	tenants, err := tenant.LoadTenantsFile(cfg.TenantsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := make([]storageScope, 0, len(tenants))
+	for _, id := range tenants.IDs() {
+		storage := tenants[id]
+		if cfg.StorageBackend == config.StorageBackendPostgres {
+			if storage.TablePrefix != "" || storage.ConnectionString == "" {
+				return nil, fmt.Errorf("tenant %s needs a connectionString with its own database; the postgres storage backend does not support table prefixes", id)
+			}
+		}
+		scopes = append(scopes, storageScope{tenantID: id, storage: storage})
+	}
+	return scopes, nil
+}
+
+// tenantsOf returns the tenants of the scopes for the tenant middleware
+func tenantsOf(scopes []storageScope) tenant.Tenants {
+	tenants := make(tenant.Tenants, len(scopes))
+	for _, scope := range scopes {
+		tenants[scope.tenantID] = scope.storage
+	}
+	return tenants
+}
+
+// newTableService opens the Azure tables of a scope: on the tenant's own storage account when it has a
+// connection string, and behind the tenant's table prefix
+func newTableService(cfg *config.Config, scope storageScope) (*repositories.TableService, error) {
+	connectionString := cfg.AzureConnectionString
+	if scope.storage.ConnectionString != "" {
+		connectionString = scope.storage.ConnectionString
+	}
+	client, err := repositories.NewTableClient(connectionString)
+	if err != nil {
+		return nil, err
+	}
+	return client.WithPrefix(scope.storage.TablePrefix), nil
+}
+
+// postgresDSN returns the database of a scope
+func postgresDSN(cfg *config.Config, scope storageScope) string {
+	if scope.storage.ConnectionString != "" {
+		return scope.storage.ConnectionString
+	}
+	return cfg.PostgresDSN
+}
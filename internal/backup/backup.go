@@ -0,0 +1,337 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+// Format identifies a groupchat backup in its manifest
+const Format = "groupchat-backup"
+
+// Version is the version of the backup layout written by this build. Readers refuse newer versions.
+const Version = 1
+
+// manifestFile is the name of the manifest inside the archive. It is written last, after every table.
+const manifestFile = "manifest.json"
+
+// ErrInvalidBackup is returned when a file is not a backup this build can read, or when its content does not
+// match the checksums in its manifest
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// Manifest describes a backup: when it was taken, for which tenant, and the record count and SHA-256 checksum
+// of every table file
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Tables    []Table   `json:"tables"`
+}
+
+// Table is one table of a backup, stored as a file with one JSON record per line
+type Table struct {
+	Name    string `json:"name"`
+	File    string `json:"file"`
+	Records int    `json:"records"`
+	SHA256  string `json:"sha256"`
+}
+
+// Table looks up a table of the backup by name
+func (m Manifest) Table(name string) (Table, bool) {
+	for _, table := range m.Tables {
+		if table.Name == name {
+			return table, true
+		}
+	}
+	return Table{}, false
+}
+
+// Writer writes a backup as a gzip-compressed tar archive. Tables are written one after the other; the
+// records of the current table are buffered in a temporary file because a tar entry needs its size up front.
+type Writer struct {
+	gzip     *gzip.Writer
+	tar      *tar.Writer
+	manifest Manifest
+	current  *tableBuffer
+}
+
+type tableBuffer struct {
+	table   Table
+	file    *os.File
+	buffer  *bufio.Writer
+	hash    hash.Hash
+	encoder *json.Encoder
+}
+
+// NewWriter starts a backup taken at createdAt. The tenant is empty without multi-tenancy.
+func NewWriter(w io.Writer, tenantID string, createdAt time.Time) *Writer {
+	gz := gzip.NewWriter(w)
+	return &Writer{
+		gzip: gz,
+		tar:  tar.NewWriter(gz),
+		manifest: Manifest{
+			Format:    Format,
+			Version:   Version,
+			CreatedAt: createdAt.UTC(),
+			Tenant:    tenantID,
+			Tables:    []Table{},
+		},
+	}
+}
+
+// BeginTable finishes the current table and starts the next one
+func (w *Writer) BeginTable(name string) error {
+	if err := w.finishTable(); err != nil {
+		return err
+	}
+	if _, ok := w.manifest.Table(name); ok {
+		return fmt.Errorf("table %s is already in the backup", name)
+	}
+
+	file, err := os.CreateTemp("", "backup-"+name+"-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to buffer table %s: %w", name, err)
+	}
+	sum := sha256.New()
+	buffer := bufio.NewWriter(io.MultiWriter(file, sum))
+	w.current = &tableBuffer{
+		table:   Table{Name: name, File: name + ".jsonl"},
+		file:    file,
+		buffer:  buffer,
+		hash:    sum,
+		encoder: json.NewEncoder(buffer),
+	}
+	return nil
+}
+
+// Add appends a record to the current table
+func (w *Writer) Add(record any) error {
+	if w.current == nil {
+		return fmt.Errorf("no table started")
+	}
+	if err := w.current.encoder.Encode(record); err != nil {
+		return fmt.Errorf("failed to write record of table %s: %w", w.current.table.Name, err)
+	}
+	w.current.table.Records++
+	return nil
+}
+
+// Close finishes the last table and writes the manifest. The backup is incomplete until Close succeeds.
+func (w *Writer) Close() error {
+	if err := w.finishTable(); err != nil {
+		return err
+	}
+
+	manifest, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := w.writeEntry(manifestFile, int64(len(manifest)), bytes.NewReader(manifest)); err != nil {
+		return err
+	}
+	if err := w.tar.Close(); err != nil {
+		return fmt.Errorf("failed to close backup: %w", err)
+	}
+	return w.gzip.Close()
+}
+
+// Manifest returns the manifest of the tables finished so far; after Close it describes the whole backup
+func (w *Writer) Manifest() Manifest {
+	return w.manifest
+}
+
+func (w *Writer) finishTable() error {
+	current := w.current
+	if current == nil {
+		return nil
+	}
+	w.current = nil
+	defer os.Remove(current.file.Name())
+	defer current.file.Close()
+
+	if err := current.buffer.Flush(); err != nil {
+		return fmt.Errorf("failed to buffer table %s: %w", current.table.Name, err)
+	}
+	size, err := current.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := current.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := w.writeEntry(current.table.File, size, current.file); err != nil {
+		return err
+	}
+
+	current.table.SHA256 = hex.EncodeToString(current.hash.Sum(nil))
+	w.manifest.Tables = append(w.manifest.Tables, current.table)
+	return nil
+}
+
+func (w *Writer) writeEntry(name string, size int64, content io.Reader) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    size,
+		ModTime: w.manifest.CreatedAt,
+	}
+	if err := w.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.Copy(w.tar, content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Reader reads a backup file whose checksums have been verified
+type Reader struct {
+	path     string
+	manifest Manifest
+}
+
+// Open reads the manifest of a backup and verifies the checksum and record count of every table before any
+// record is handed out, so a damaged or tampered backup is refused before a restore writes anything
+func Open(path string) (*Reader, error) {
+	var manifest *Manifest
+	sums := make(map[string]string)
+	counts := make(map[string]int)
+
+	err := walk(path, func(name string, content io.Reader) error {
+		if name == manifestFile {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(content).Decode(manifest); err != nil {
+				return fmt.Errorf("%w: unreadable manifest: %v", ErrInvalidBackup, err)
+			}
+			return nil
+		}
+
+		sum := sha256.New()
+		lines, err := countLines(io.TeeReader(content, sum))
+		if err != nil {
+			return err
+		}
+		sums[name] = hex.EncodeToString(sum.Sum(nil))
+		counts[name] = lines
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: no manifest, the backup is incomplete", ErrInvalidBackup)
+	}
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidBackup, manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return nil, fmt.Errorf("%w: version %d is not supported, this build reads up to version %d", ErrInvalidBackup, manifest.Version, Version)
+	}
+	for _, table := range manifest.Tables {
+		sum, ok := sums[table.File]
+		if !ok {
+			return nil, fmt.Errorf("%w: table %s is missing", ErrInvalidBackup, table.Name)
+		}
+		if sum != table.SHA256 {
+			return nil, fmt.Errorf("%w: checksum mismatch in table %s", ErrInvalidBackup, table.Name)
+		}
+		if counts[table.File] != table.Records {
+			return nil, fmt.Errorf("%w: table %s has %d records, the manifest lists %d", ErrInvalidBackup, table.Name, counts[table.File], table.Records)
+		}
+	}
+	return &Reader{path: path, manifest: *manifest}, nil
+}
+
+// Manifest returns the verified manifest of the backup
+func (r *Reader) Manifest() Manifest {
+	return r.manifest
+}
+
+// ReadTable hands every record of a table to decode in the order it was written. A table that is not in the
+// backup has no records.
+func (r *Reader) ReadTable(name string, decode func(record json.RawMessage) error) error {
+	table, ok := r.manifest.Table(name)
+	if !ok {
+		return nil
+	}
+
+	return walk(r.path, func(file string, content io.Reader) error {
+		if file != table.File {
+			return nil
+		}
+		scanner := bufio.NewScanner(content)
+		scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+		for scanner.Scan() {
+			if err := decode(scanner.Bytes()); err != nil {
+				return fmt.Errorf("table %s: %w", name, err)
+			}
+		}
+		return scanner.Err()
+	})
+}
+
+// maxRecordSize bounds one JSON line. Messages are limited to a few kilobytes, key envelopes included.
+const maxRecordSize = 16 * 1024 * 1024
+
+// walk hands the content of every file in the archive to visit
+func walk(path string, visit func(name string, content io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := visit(header.Name, archive); err != nil {
+			return err
+		}
+	}
+}
+
+func countLines(content io.Reader) (int, error) {
+	lines := 0
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := content.Read(buffer)
+		for _, b := range buffer[:n] {
+			if b == '\n' {
+				lines++
+			}
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+	}
+}
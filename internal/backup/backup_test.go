@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRecord struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func writeTestBackup(t *testing.T) (string, time.Time) {
+	path := filepath.Join(t.TempDir(), "backup.tar.gz")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	writer := NewWriter(file, "acme", createdAt)
+	require.NoError(t, writer.BeginTable(TableMessages))
+	require.NoError(t, writer.Add(testRecord{ID: 1, Name: "eerste"}))
+	require.NoError(t, writer.Add(testRecord{ID: 2, Name: "tweede"}))
+	require.NoError(t, writer.BeginTable(TableGroupSettings))
+	require.NoError(t, writer.Close())
+	return path, createdAt
+}
+
+func TestRoundTrip(t *testing.T) {
+	path, createdAt := writeTestBackup(t)
+
+	reader, err := Open(path)
+	require.NoError(t, err)
+
+	manifest := reader.Manifest()
+	assert.Equal(t, Format, manifest.Format)
+	assert.Equal(t, Version, manifest.Version)
+	assert.Equal(t, "acme", manifest.Tenant)
+	assert.True(t, createdAt.Equal(manifest.CreatedAt))
+	require.Len(t, manifest.Tables, 2)
+	assert.Equal(t, 2, manifest.Tables[0].Records)
+	assert.Equal(t, 0, manifest.Tables[1].Records)
+
+	var records []testRecord
+	require.NoError(t, reader.ReadTable(TableMessages, func(raw json.RawMessage) error {
+		var record testRecord
+		require.NoError(t, json.Unmarshal(raw, &record))
+		records = append(records, record)
+		return nil
+	}))
+	assert.Equal(t, []testRecord{{1, "eerste"}, {2, "tweede"}}, records)
+
+	called := false
+	require.NoError(t, reader.ReadTable(TableKeyBundles, func(json.RawMessage) error {
+		called = true
+		return nil
+	}))
+	assert.False(t, called, "a table that is not in the backup has no records")
+}
+
+func TestWriterRefusesRecordsOutsideATable(t *testing.T) {
+	writer := NewWriter(io.Discard, "", time.Now())
+	assert.Error(t, writer.Add(testRecord{ID: 1}))
+
+	require.NoError(t, writer.BeginTable(TableMessages))
+	assert.Error(t, writer.BeginTable(TableMessages), "a table is written once")
+}
+
+// rewrite copies a backup, letting edit change the content of each file
+func rewrite(t *testing.T, path string, edit func(name string, content []byte) []byte) string {
+	source, err := os.Open(path)
+	require.NoError(t, err)
+	defer source.Close()
+	gzReader, err := gzip.NewReader(source)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	gzWriter := gzip.NewWriter(&out)
+	tarWriter := tar.NewWriter(gzWriter)
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+		content = edit(header.Name, content)
+		if content == nil {
+			continue
+		}
+		header.Size = int64(len(content))
+		require.NoError(t, tarWriter.WriteHeader(header))
+		_, err = tarWriter.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzWriter.Close())
+
+	edited := filepath.Join(t.TempDir(), "edited.tar.gz")
+	require.NoError(t, os.WriteFile(edited, out.Bytes(), 0o600))
+	return edited
+}
+
+func TestOpenRefusesDamagedBackups(t *testing.T) {
+	path, _ := writeTestBackup(t)
+
+	tests := []struct {
+		name string
+		edit func(name string, content []byte) []byte
+	}{
+		{"tampered record", func(name string, content []byte) []byte {
+			if name == "messages.jsonl" {
+				return bytes.Replace(content, []byte("eerste"), []byte("andere"), 1)
+			}
+			return content
+		}},
+		{"missing table", func(name string, content []byte) []byte {
+			if name == "messages.jsonl" {
+				return nil
+			}
+			return content
+		}},
+		{"missing manifest", func(name string, content []byte) []byte {
+			if name == manifestFile {
+				return nil
+			}
+			return content
+		}},
+		{"newer version", func(name string, content []byte) []byte {
+			if name == manifestFile {
+				return bytes.Replace(content, []byte(`"version": 1`), []byte(`"version": 2`), 1)
+			}
+			return content
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(rewrite(t, path, tt.edit))
+			assert.ErrorIs(t, err, ErrInvalidBackup)
+		})
+	}
+
+	t.Run("not a backup", func(t *testing.T) {
+		other := filepath.Join(t.TempDir(), "other.txt")
+		require.NoError(t, os.WriteFile(other, []byte("hello"), 0o600))
+		_, err := Open(other)
+		assert.ErrorIs(t, err, ErrInvalidBackup)
+	})
+}
@@ -0,0 +1,56 @@
+package backup
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Names of the tables in a backup. Messages, group settings, purge and access audits, key bundles and token
+// revocations are stored as their model JSON; tokens and preferences have records of their own because their
+// models leave fields out.
+const (
+	TableMessages         = "messages"
+	TableFCMTokens        = "fcmTokens"
+	TableUserPreferences  = "userPreferences"
+	TableGroupSettings    = "groupSettings"
+	TablePurgeAudits      = "purgeAudits"
+	TableKeyBundles       = "keyBundles"
+	TableAccessAudits     = "accessAudits"
+	TableTokenRevocations = "tokenRevocations"
+)
+
+// Tables lists every table in the order it is backed up and restored
+var Tables = []string{
+	TableMessages,
+	TableFCMTokens,
+	TableUserPreferences,
+	TableGroupSettings,
+	TablePurgeAudits,
+	TableKeyBundles,
+	TableAccessAudits,
+	TableTokenRevocations,
+}
+
+// FCMTokenRecord is the push token a user registered for a group
+type FCMTokenRecord struct {
+	GroupID   uuid.UUID `json:"groupId"`
+	UserID    uuid.UUID `json:"userId"`
+	Token     string    `json:"token"`
+	Locale    string    `json:"locale,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+}
+
+// UserPreferencesRecord holds the preferences of a user, including the email digest state
+type UserPreferencesRecord struct {
+	UserID               uuid.UUID `json:"userId"`
+	Locale               string    `json:"locale,omitempty"`
+	PrivateNotifications bool      `json:"privateNotifications"`
+	EmailDigest          bool      `json:"emailDigest"`
+	Email                string    `json:"email,omitempty"`
+	// DigestGroups maps the groups the email digest summarises to the time of their last digest
+	DigestGroups map[uuid.UUID]time.Time `json:"digestGroups,omitempty"`
+	// DigestGroupID and LastDigestAt are the single digest group of backups made before digests covered
+	// several groups. They are read on restore and no longer written.
+	DigestGroupID *uuid.UUID `json:"digestGroupId,omitempty"`
+	LastDigestAt  *time.Time `json:"lastDigestAt,omitempty"`
+}
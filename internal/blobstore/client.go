@@ -0,0 +1,279 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBlobNotFound is returned when a blob does not exist
+var ErrBlobNotFound = errors.New("blob not found")
+
+// apiVersion is the Blob service REST API version the requests are signed for
+const apiVersion = "2021-12-02"
+
+// Client is a small Azure Blob Storage client for one container, authorised with the account's shared key.
+// It supports the few operations the service needs.
+type Client struct {
+	endpoint   *url.URL // blob service endpoint, without the container
+	account    string
+	key        []byte
+	container  string
+	httpClient *http.Client
+}
+
+// NewClientFromConnectionString creates a client for a container of the storage account in an Azure
+// Storage connection string. Azurite connection strings with an explicit BlobEndpoint are supported.
+func NewClientFromConnectionString(connectionString string, container string) (*Client, error) {
+	settings := make(map[string]string)
+	for _, part := range strings.Split(connectionString, ";") {
+		if name, value, ok := strings.Cut(part, "="); ok {
+			settings[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	}
+
+	account, encodedKey := settings["accountname"], settings["accountkey"]
+	if account == "" || encodedKey == "" {
+		return nil, fmt.Errorf("connection string must contain AccountName and AccountKey")
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AccountKey: %w", err)
+	}
+
+	endpoint := settings["blobendpoint"]
+	if endpoint == "" {
+		protocol := settings["defaultendpointsprotocol"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		suffix := settings["endpointsuffix"]
+		if suffix == "" {
+			suffix = "core.windows.net"
+		}
+		endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, account, suffix)
+	}
+	parsed, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BlobEndpoint: %w", err)
+	}
+
+	return &Client{
+		endpoint:   parsed,
+		account:    account,
+		key:        key,
+		container:  container,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// CreateContainer creates the container unless it already exists
+func (c *Client) CreateContainer(ctx context.Context) error {
+	response, err := c.do(ctx, http.MethodPut, "", url.Values{"restype": {"container"}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusConflict || response.StatusCode/100 == 2 {
+		return nil
+	}
+	return responseError("create container", response)
+}
+
+// PutBlob stores data as a block blob, replacing an existing blob with the same name
+func (c *Client) PutBlob(ctx context.Context, name string, data []byte, contentType string) error {
+	headers := http.Header{}
+	headers.Set("x-ms-blob-type", "BlockBlob")
+	headers.Set("Content-Type", contentType)
+
+	response, err := c.do(ctx, http.MethodPut, name, nil, headers, data)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		return responseError("put blob "+name, response)
+	}
+	return nil
+}
+
+// GetBlob returns the content of a blob, or ErrBlobNotFound
+func (c *Client) GetBlob(ctx context.Context, name string) ([]byte, error) {
+	response, err := c.do(ctx, http.MethodGet, name, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", name, ErrBlobNotFound)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, responseError("get blob "+name, response)
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// DeleteBlob removes a blob. Deleting a blob that does not exist is not an error.
+func (c *Client) DeleteBlob(ctx context.Context, name string) error {
+	response, err := c.do(ctx, http.MethodDelete, name, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted && response.StatusCode != http.StatusNotFound {
+		return responseError("delete blob "+name, response)
+	}
+	return nil
+}
+
+// listBlobsResult is the part of a List Blobs response the client reads
+type listBlobsResult struct {
+	Blobs []struct {
+		Name string `xml:"Name"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// ListBlobs returns the names of the blobs that start with prefix, following the pages of the listing
+func (c *Client) ListBlobs(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		response, err := c.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != http.StatusOK {
+			err := responseError("list blobs", response)
+			response.Body.Close()
+			return nil, err
+		}
+
+		var result listBlobsResult
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse blob listing: %w", err)
+		}
+		for _, blob := range result.Blobs {
+			names = append(names, blob.Name)
+		}
+		if result.NextMarker == "" {
+			return names, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+func (c *Client) do(ctx context.Context, method string, blob string, query url.Values, headers http.Header, body []byte) (*http.Response, error) {
+	target := *c.endpoint
+	target.Path = target.Path + "/" + c.container
+	if blob != "" {
+		target.Path += "/" + blob
+	}
+	target.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range headers {
+		request.Header[name] = values
+	}
+	request.ContentLength = int64(len(body))
+	request.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	request.Header.Set("x-ms-version", apiVersion)
+	request.Header.Set("Authorization", "SharedKey "+c.account+":"+c.sign(request))
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("blob request failed: %w", err)
+	}
+	return response, nil
+}
+
+// sign computes the Shared Key signature of a request
+// (https://learn.microsoft.com/rest/api/storageservices/authorize-with-shared-key)
+func (c *Client) sign(request *http.Request) string {
+	contentLength := ""
+	if request.ContentLength > 0 {
+		contentLength = strconv.FormatInt(request.ContentLength, 10)
+	}
+
+	lines := []string{
+		request.Method,
+		request.Header.Get("Content-Encoding"),
+		request.Header.Get("Content-Language"),
+		contentLength,
+		request.Header.Get("Content-MD5"),
+		request.Header.Get("Content-Type"),
+		"", // Date, superseded by x-ms-date
+		request.Header.Get("If-Modified-Since"),
+		request.Header.Get("If-Match"),
+		request.Header.Get("If-None-Match"),
+		request.Header.Get("If-Unmodified-Since"),
+		request.Header.Get("Range"),
+	}
+
+	var msHeaders []string
+	for name := range request.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower+":"+strings.TrimSpace(request.Header.Get(name)))
+		}
+	}
+	sort.Strings(msHeaders)
+	lines = append(lines, msHeaders...)
+
+	resource := "/" + c.account + request.URL.EscapedPath()
+	query := make(map[string][]string)
+	for name, values := range request.URL.Query() {
+		query[strings.ToLower(name)] = append(query[strings.ToLower(name)], values...)
+	}
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		resource += "\n" + name + ":" + strings.Join(values, ",")
+	}
+	lines = append(lines, resource)
+
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func responseError(operation string, response *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("failed to %s: %s: %s", operation, response.Status, strings.TrimSpace(string(body)))
+}
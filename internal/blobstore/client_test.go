@@ -0,0 +1,144 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBlobService keeps blobs in memory and records the requests
+type fakeBlobService struct {
+	mu       sync.Mutex
+	blobs    map[string][]byte
+	requests []*http.Request
+}
+
+func (s *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey devstoreaccount1:") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPut && r.URL.Query().Get("restype") == "container":
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet && r.URL.Query().Get("comp") == "list":
+		s.list(w, r)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		s.blobs[r.URL.Path] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet:
+		data, ok := s.blobs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		if _, ok := s.blobs[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.blobs, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list answers a List Blobs request one blob per page, to exercise the continuation markers
+func (s *fakeBlobService) list(w http.ResponseWriter, r *http.Request) {
+	container := strings.TrimSuffix(r.URL.Path, "/") + "/"
+	var names []string
+	for path := range s.blobs {
+		name := strings.TrimPrefix(path, container)
+		if strings.HasPrefix(name, r.URL.Query().Get("prefix")) && name > r.URL.Query().Get("marker") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	body := "<EnumerationResults><Blobs>"
+	if len(names) > 0 {
+		body += fmt.Sprintf("<Blob><Name>%s</Name></Blob>", names[0])
+	}
+	body += "</Blobs><NextMarker>"
+	if len(names) > 1 {
+		body += names[0]
+	}
+	body += "</NextMarker></EnumerationResults>"
+	w.Write([]byte(body))
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	service := &fakeBlobService{blobs: make(map[string][]byte)}
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	client, err := NewClientFromConnectionString(
+		"DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==;BlobEndpoint="+server.URL+"/devstoreaccount1;",
+		"archive")
+	require.NoError(t, err)
+
+	require.NoError(t, client.CreateContainer(ctx))
+	require.NoError(t, client.PutBlob(ctx, "group/2024-01.jsonl.gz", []byte("data"), "application/gzip"))
+
+	data, err := client.GetBlob(ctx, "group/2024-01.jsonl.gz")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+
+	_, err = client.GetBlob(ctx, "group/2023-12.jsonl.gz")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+
+	require.NoError(t, client.PutBlob(ctx, "group/2024-02.jsonl.gz", []byte("data"), "application/gzip"))
+	require.NoError(t, client.PutBlob(ctx, "other/2024-01.jsonl.gz", []byte("data"), "application/gzip"))
+	names, err := client.ListBlobs(ctx, "group/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"group/2024-01.jsonl.gz", "group/2024-02.jsonl.gz"}, names)
+
+	require.NoError(t, client.DeleteBlob(ctx, "group/2024-01.jsonl.gz"))
+	_, err = client.GetBlob(ctx, "group/2024-01.jsonl.gz")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+	assert.NoError(t, client.DeleteBlob(ctx, "group/2024-01.jsonl.gz"), "deleting a missing blob is not an error")
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	put := service.requests[1]
+	assert.Equal(t, "/devstoreaccount1/archive/group/2024-01.jsonl.gz", put.URL.Path)
+	assert.Equal(t, "BlockBlob", put.Header.Get("x-ms-blob-type"))
+	assert.Equal(t, apiVersion, put.Header.Get("x-ms-version"))
+}
+
+func TestSign(t *testing.T) {
+	client, err := NewClientFromConnectionString("AccountName=account;AccountKey=a2V5", "archive")
+	require.NoError(t, err)
+	assert.Equal(t, "https://account.blob.core.windows.net", client.endpoint.String())
+
+	request := httptest.NewRequest(http.MethodGet, "https://account.blob.core.windows.net/archive/blob?b=2&A=1", nil)
+	request.Header.Set("x-ms-date", "Mon, 01 Jan 2024 00:00:00 GMT")
+	request.Header.Set("x-ms-version", apiVersion)
+
+	// HMAC-SHA256 with key "key" of the string to sign below, computed independently
+	// GET\n\n\n\n\n\n\n\n\n\n\n\nx-ms-date:Mon, 01 Jan 2024 00:00:00 GMT\nx-ms-version:2021-12-02\n/account/archive/blob\na:1\nb:2
+	assert.Equal(t, "VfzdZKkf2rnD7MHbKBPAXL6m5Hq02ext0ga7BfIvXtU=", client.sign(request))
+}
+
+func TestNewClientFromConnectionStringRequiresCredentials(t *testing.T) {
+	_, err := NewClientFromConnectionString("AccountName=account", "archive")
+	assert.Error(t, err)
+}
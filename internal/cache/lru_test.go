@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	t.Run("Evicts the least recently used entry", func(t *testing.T) {
+		lru := NewLRU[string, int](2, 0)
+		lru.Set("a", 1)
+		lru.Set("b", 2)
+		_, _ = lru.Get("a")
+		lru.Set("c", 3)
+
+		_, ok := lru.Get("b")
+		assert.False(t, ok)
+		value, ok := lru.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, 1, value)
+		assert.Equal(t, 2, lru.Len())
+	})
+
+	t.Run("Entries expire after the TTL", func(t *testing.T) {
+		now := time.Now()
+		lru := NewLRU[string, int](2, time.Minute)
+		lru.now = func() time.Time { return now }
+		lru.Set("a", 1)
+
+		_, ok := lru.Get("a")
+		assert.True(t, ok)
+
+		now = now.Add(time.Minute)
+		_, ok = lru.Get("a")
+		assert.False(t, ok)
+		assert.Equal(t, 0, lru.Len())
+	})
+
+	t.Run("Delete removes an entry", func(t *testing.T) {
+		lru := NewLRU[string, int](2, 0)
+		lru.Set("a", 1)
+		lru.Delete("a")
+
+		_, ok := lru.Get("a")
+		assert.False(t, ok)
+	})
+}
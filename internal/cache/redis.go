@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRedisNil is returned for commands that found no value
+var ErrRedisNil = errors.New("redis: nil")
+
+const (
+	redisDialTimeout  = 5 * time.Second
+	redisIOTimeout    = 2 * time.Second
+	redisMaxIdleConns = 8
+)
+
+// RedisClient is a small Redis client speaking RESP2 over a pool of connections. It supports the few
+// commands the service needs and is safe for concurrent use.
+type RedisClient struct {
+	address  string
+	username string
+	password string
+	database int
+	useTLS   bool
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisClient creates a client for a redis:// or rediss:// URL, e.g. redis://:password@localhost:6379/0.
+// Connections are opened on first use.
+func NewRedisClient(rawURL string) (*RedisClient, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	if parsed.Scheme != "redis" && parsed.Scheme != "rediss" {
+		return nil, fmt.Errorf("invalid redis URL: unsupported scheme %q", parsed.Scheme)
+	}
+
+	client := &RedisClient{
+		address: parsed.Host,
+		useTLS:  parsed.Scheme == "rediss",
+		idle:    make(chan *redisConn, redisMaxIdleConns),
+	}
+	if parsed.Port() == "" {
+		client.address = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	if parsed.User != nil {
+		client.username = parsed.User.Username()
+		client.password, _ = parsed.User.Password()
+	}
+	if db := strings.TrimPrefix(parsed.Path, "/"); db != "" {
+		if client.database, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis URL: database %q is not a number", db)
+		}
+	}
+
+	return client, nil
+}
+
+// Get returns the value of a key, or ErrRedisNil when it does not exist
+func (c *RedisClient) Get(ctx context.Context, key string) (string, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return "", err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("redis: unexpected reply %T to GET", reply)
+	}
+	return value, nil
+}
+
+// Set stores a value that expires after ttl, or never when ttl is 0
+func (c *RedisClient) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del removes keys
+func (c *RedisClient) Del(ctx context.Context, keys ...string) error {
+	_, err := c.Do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// Ping checks that the server is reachable
+func (c *RedisClient) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Do runs one command. Replies are returned as string (simple and bulk strings), int64, []interface{}
+// or ErrRedisNil for nil replies; error replies are returned as errors.
+func (c *RedisClient) Do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.roundTrip(ctx, args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) && !errors.Is(err, ErrRedisNil) {
+		// The connection state is unknown after I/O errors
+		conn.conn.Close()
+		return nil, err
+	}
+	c.release(conn)
+	return reply, err
+}
+
+// Close closes the idle connections
+func (c *RedisClient) Close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *RedisClient) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+	var netConn net.Conn
+	var err error
+	if c.useTLS {
+		host, _, _ := net.SplitHostPort(c.address)
+		netConn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", c.address)
+	} else {
+		netConn, err = dialer.DialContext(ctx, "tcp", c.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: failed to connect: %w", err)
+	}
+
+	conn := &redisConn{conn: netConn, reader: bufio.NewReader(netConn)}
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := conn.roundTrip(ctx, args); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("redis: failed to authenticate: %w", err)
+		}
+	}
+	if c.database != 0 {
+		if _, err := conn.roundTrip(ctx, []string{"SELECT", strconv.Itoa(c.database)}); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("redis: failed to select database: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (c *RedisClient) release(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (rc *redisConn) roundTrip(ctx context.Context, args []string) (interface{}, error) {
+	deadline := time.Now().Add(redisIOTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := rc.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(rc.conn, command.String()); err != nil {
+		return nil, fmt.Errorf("redis: failed to send command: %w", err)
+	}
+
+	return readRedisReply(rc.reader)
+}
+
+func readRedisReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: failed to read reply: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line[1:])
+		}
+		if length < 0 {
+			return nil, ErrRedisNil
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, fmt.Errorf("redis: failed to read reply: %w", err)
+		}
+		return string(data[:length]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line[1:])
+		}
+		if count < 0 {
+			return nil, ErrRedisNil
+		}
+		elements := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			element, err := readRedisReply(reader)
+			if err != nil && !errors.Is(err, ErrRedisNil) {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+		return elements, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis serves GET, SET, DEL, PING, AUTH and SELECT from a map
+type fakeRedis struct {
+	mu       sync.Mutex
+	values   map[string]string
+	password string
+	commands [][]string
+}
+
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeRedis{values: make(map[string]string), password: password}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server, listener.Addr().String()
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := s.password == ""
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		var reply string
+		switch {
+		case strings.EqualFold(args[0], "AUTH"):
+			if args[len(args)-1] == s.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case strings.EqualFold(args[0], "PING"):
+			reply = "+PONG\r\n"
+		case strings.EqualFold(args[0], "SELECT"):
+			reply = "+OK\r\n"
+		case strings.EqualFold(args[0], "GET"):
+			if value, ok := s.values[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case strings.EqualFold(args[0], "SET"):
+			s.values[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case strings.EqualFold(args[0], "DEL"):
+			deleted := 0
+			for _, key := range args[1:] {
+				if _, ok := s.values[key]; ok {
+					delete(s.values, key)
+					deleted++
+				}
+			}
+			reply = fmt.Sprintf(":%d\r\n", deleted)
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	reply, err := readRedisReply(reader)
+	if err != nil {
+		return nil, err
+	}
+	elements, ok := reply.([]interface{})
+	if !ok || len(elements) == 0 {
+		return nil, fmt.Errorf("unexpected command %v", reply)
+	}
+	args := make([]string, 0, len(elements))
+	for _, element := range elements {
+		args = append(args, element.(string))
+	}
+	return args, nil
+}
+
+func TestRedisClient(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Get, set and delete", func(t *testing.T) {
+		server, address := startFakeRedis(t, "geheim")
+		client, err := NewRedisClient("redis://:geheim@" + address + "/2")
+		require.NoError(t, err)
+		defer client.Close()
+
+		require.NoError(t, client.Ping(ctx))
+		_, err = client.Get(ctx, "key")
+		assert.ErrorIs(t, err, ErrRedisNil)
+
+		require.NoError(t, client.Set(ctx, "key", "waarde\r\nmet regels", time.Minute))
+		value, err := client.Get(ctx, "key")
+		require.NoError(t, err)
+		assert.Equal(t, "waarde\r\nmet regels", value)
+
+		require.NoError(t, client.Del(ctx, "key"))
+		_, err = client.Get(ctx, "key")
+		assert.ErrorIs(t, err, ErrRedisNil)
+
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		assert.Equal(t, []string{"AUTH", "geheim"}, server.commands[0])
+		assert.Equal(t, []string{"SELECT", "2"}, server.commands[1])
+		assert.Contains(t, server.commands, []string{"SET", "key", "waarde\r\nmet regels", "PX", strconv.Itoa(60000)})
+	})
+
+	t.Run("Error replies are returned", func(t *testing.T) {
+		_, address := startFakeRedis(t, "")
+		client, err := NewRedisClient("redis://" + address)
+		require.NoError(t, err)
+		defer client.Close()
+
+		_, err = client.Do(ctx, "FLUSHALL")
+		assert.ErrorContains(t, err, "unknown command")
+		assert.NoError(t, client.Ping(ctx), "the connection is reused after an error reply")
+	})
+
+	t.Run("Wrong password fails to connect", func(t *testing.T) {
+		_, address := startFakeRedis(t, "geheim")
+		client, err := NewRedisClient("redis://:fout@" + address)
+		require.NoError(t, err)
+
+		assert.ErrorContains(t, client.Ping(ctx), "failed to authenticate")
+	})
+
+	t.Run("Invalid URLs are rejected", func(t *testing.T) {
+		_, err := NewRedisClient("http://localhost:6379")
+		assert.Error(t, err)
+		_, err = NewRedisClient("redis://localhost:6379/cache")
+		assert.Error(t, err)
+	})
+}
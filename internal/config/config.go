@@ -4,26 +4,148 @@ import (
 	"errors"
 	"fmt"
 	"github.com/spf13/viper"
+	"net/url"
 	"os"
+	"slices"
 	"strings"
+	"time"
+)
+
+// Supported notification backends
+const (
+	NotificationBackendFCM    = "fcm"
+	NotificationBackendMemory = "memory"
+	NotificationBackendFile   = "file"
+)
+
+// Supported storage backends
+const (
+	StorageBackendAzure    = "azure"
+	StorageBackendPostgres = "postgres"
+	StorageBackendMemory   = "memory"
+)
+
+// Supported rate limit backends
+const (
+	RateLimitBackendMemory = "memory"
+	RateLimitBackendRedis  = "redis"
+)
+
+// Places an access token is read from, in the order of TOKEN_SOURCES
+const (
+	TokenSourceHeader = "header"
+	TokenSourceCookie = "cookie"
 )
 
 type Config struct {
 	// Firebase Configuration
 	FirebaseCredentialFile string `mapstructure:"firebase_credential_file"`
 
+	// Notification Configuration
+	NotificationBackend          string `mapstructure:"notification_backend"`
+	NotificationEmulatorFile     string `mapstructure:"notification_emulator_file"`
+	NotificationEmulatorFailures string `mapstructure:"notification_emulator_failures"`
+	NotificationTemplatesDir     string `mapstructure:"notification_templates_dir"`
+	DefaultLocale                string `mapstructure:"default_locale"`
+
+	// Email Digest Configuration
+	EmailDigestEnabled      bool          `mapstructure:"email_digest_enabled"`
+	EmailDigestInterval     time.Duration `mapstructure:"email_digest_interval"`
+	DigestUnsubscribeSecret string        `mapstructure:"digest_unsubscribe_secret"`
+	PublicBaseURL           string        `mapstructure:"public_base_url"`
+	SMTPHost                string        `mapstructure:"smtp_host"`
+	SMTPPort                int           `mapstructure:"smtp_port"`
+	SMTPUsername            string        `mapstructure:"smtp_username"`
+	SMTPPassword            string        `mapstructure:"smtp_password"`
+	SMTPFrom                string        `mapstructure:"smtp_from"`
+
+	// Retention Configuration
+	RetentionPurgeEnabled   bool          `mapstructure:"retention_purge_enabled"`
+	RetentionPurgeInterval  time.Duration `mapstructure:"retention_purge_interval"`
+	RetentionPurgeBatchSize int           `mapstructure:"retention_purge_batch_size"`
+	RetentionPurgeDryRun    bool          `mapstructure:"retention_purge_dry_run"`
+
+	// Archive Configuration
+	ArchiveEnabled          bool          `mapstructure:"archive_enabled"`
+	ArchiveJobEnabled       bool          `mapstructure:"archive_job_enabled"`
+	ArchiveInterval         time.Duration `mapstructure:"archive_interval"`
+	ArchiveAfterDays        int           `mapstructure:"archive_after_days"`
+	ArchiveBatchSize        int           `mapstructure:"archive_batch_size"`
+	ArchiveConnectionString string        `mapstructure:"archive_connection_string"`
+	ArchiveContainer        string        `mapstructure:"archive_container"`
+	ArchiveDir              string        `mapstructure:"archive_dir"`
+
+	// Encryption Configuration
+	EncryptionEnabled      bool   `mapstructure:"encryption_enabled"`
+	EncryptionMasterKeys   string `mapstructure:"encryption_master_keys"`
+	EncryptionCurrentKeyID string `mapstructure:"encryption_current_key_id"`
+	EncryptionKeyFile      string `mapstructure:"encryption_key_file"`
+
+	// Storage Configuration
+	StorageBackend string `mapstructure:"storage_backend"`
+	PostgresDSN    string `mapstructure:"postgres_dsn"`
+
+	// Tenant Configuration
+	MultiTenantEnabled bool   `mapstructure:"multi_tenant_enabled"`
+	TenantClaim        string `mapstructure:"tenant_claim"`
+	TenantsFile        string `mapstructure:"tenants_file"`
+
+	// Message Cache Configuration
+	MessageCacheEnabled bool          `mapstructure:"message_cache_enabled"`
+	MessageCacheSize    int           `mapstructure:"message_cache_size"`
+	MessageCacheGroups  int           `mapstructure:"message_cache_groups"`
+	MessageCacheTTL     time.Duration `mapstructure:"message_cache_ttl"`
+	RedisURL            string        `mapstructure:"redis_url"`
+
+	// Pagination Configuration
+	CursorSecret string        `mapstructure:"cursor_secret"`
+	CursorTTL    time.Duration `mapstructure:"cursor_ttl"`
+
 	// Azure Storage Configuration
 	AzureConnectionString string `mapstructure:"azure_groupchat_connection_string"`
 
 	// Application Configuration
 	Environment string `mapstructure:"environment"`
 	Port        int    `mapstructure:"port"`
-	Debug       bool   `mapstructure:"debug"`
+	Debug       bool   `mapstructure:"debug"` // Registers the /debug endpoints
 
 	// User Service Configuration
 	UserServiceURL        string `mapstructure:"user_service_url"`
 	PublicKey             string `mapstructure:"keycloak_public_key"`
 	AccessTokenCookieName string `mapstructure:"access_token_cookie_name"`
+	TokenSources          string `mapstructure:"token_sources"` // Comma-separated, first found wins
+
+	// Group Membership Configuration
+	GroupsClaim              string        `mapstructure:"groups_claim"`
+	GroupMembershipCacheSize int           `mapstructure:"group_membership_cache_size"`
+	GroupMembershipCacheTTL  time.Duration `mapstructure:"group_membership_cache_ttl"`
+
+	// Access Policy Configuration
+	PolicyFile string `mapstructure:"policy_file"` // Overrides the rules of the built-in policy per action
+
+	// Rate Limit Configuration
+	RateLimitEnabled       bool   `mapstructure:"rate_limit_enabled"`
+	RateLimitFile          string `mapstructure:"rate_limit_file"` // Overrides the built-in limits per route
+	RateLimitBackend       string `mapstructure:"rate_limit_backend"`
+	RateLimitMemoryBuckets int    `mapstructure:"rate_limit_memory_buckets"`
+
+	// CORS Configuration
+	CORSAllowedOrigins string `mapstructure:"cors_allowed_origins"` // Comma-separated
+
+	// JWKS Configuration
+	JWKSURL              string        `mapstructure:"keycloak_jwks_url"`
+	JWKSRefreshInterval  time.Duration `mapstructure:"keycloak_jwks_refresh_interval"`
+	JWKSRefreshRateLimit time.Duration `mapstructure:"keycloak_jwks_refresh_rate_limit"`
+
+	// Token Validation Configuration
+	JWTIssuers      string        `mapstructure:"jwt_issuers"` // Comma-separated
+	JWTAudience     string        `mapstructure:"jwt_audience"`
+	JWTClockSkew    time.Duration `mapstructure:"jwt_clock_skew"`
+	JWTRequiredType string        `mapstructure:"jwt_required_type"`
+
+	// Token Revocation Configuration
+	TokenRevocationRefreshInterval time.Duration `mapstructure:"token_revocation_refresh_interval"`
+	TokenRevocationTTL             time.Duration `mapstructure:"token_revocation_ttl"`
 }
 
 func LoadConfig(configPath string) (*Config, error) {
@@ -38,6 +160,48 @@ func LoadConfig(configPath string) (*Config, error) {
 
 	// Bind environment variables to keys
 	viper.BindEnv("firebase_credential_file", "FIREBASE_CREDENTIAL_FILE")
+	viper.BindEnv("notification_backend", "NOTIFICATION_BACKEND")
+	viper.BindEnv("notification_emulator_file", "NOTIFICATION_EMULATOR_FILE")
+	viper.BindEnv("notification_emulator_failures", "NOTIFICATION_EMULATOR_FAILURES")
+	viper.BindEnv("notification_templates_dir", "NOTIFICATION_TEMPLATES_DIR")
+	viper.BindEnv("default_locale", "DEFAULT_LOCALE")
+	viper.BindEnv("email_digest_enabled", "EMAIL_DIGEST_ENABLED")
+	viper.BindEnv("email_digest_interval", "EMAIL_DIGEST_INTERVAL")
+	viper.BindEnv("digest_unsubscribe_secret", "DIGEST_UNSUBSCRIBE_SECRET")
+	viper.BindEnv("public_base_url", "PUBLIC_BASE_URL")
+	viper.BindEnv("smtp_host", "SMTP_HOST")
+	viper.BindEnv("smtp_port", "SMTP_PORT")
+	viper.BindEnv("smtp_username", "SMTP_USERNAME")
+	viper.BindEnv("smtp_password", "SMTP_PASSWORD")
+	viper.BindEnv("smtp_from", "SMTP_FROM")
+	viper.BindEnv("retention_purge_enabled", "RETENTION_PURGE_ENABLED")
+	viper.BindEnv("retention_purge_interval", "RETENTION_PURGE_INTERVAL")
+	viper.BindEnv("retention_purge_batch_size", "RETENTION_PURGE_BATCH_SIZE")
+	viper.BindEnv("retention_purge_dry_run", "RETENTION_PURGE_DRY_RUN")
+	viper.BindEnv("archive_enabled", "ARCHIVE_ENABLED")
+	viper.BindEnv("archive_job_enabled", "ARCHIVE_JOB_ENABLED")
+	viper.BindEnv("archive_interval", "ARCHIVE_INTERVAL")
+	viper.BindEnv("archive_after_days", "ARCHIVE_AFTER_DAYS")
+	viper.BindEnv("archive_batch_size", "ARCHIVE_BATCH_SIZE")
+	viper.BindEnv("archive_connection_string", "ARCHIVE_CONNECTION_STRING")
+	viper.BindEnv("archive_container", "ARCHIVE_CONTAINER")
+	viper.BindEnv("archive_dir", "ARCHIVE_DIR")
+	viper.BindEnv("encryption_enabled", "ENCRYPTION_ENABLED")
+	viper.BindEnv("encryption_master_keys", "ENCRYPTION_MASTER_KEYS")
+	viper.BindEnv("encryption_current_key_id", "ENCRYPTION_CURRENT_KEY_ID")
+	viper.BindEnv("encryption_key_file", "ENCRYPTION_KEY_FILE")
+	viper.BindEnv("storage_backend", "STORAGE_BACKEND")
+	viper.BindEnv("postgres_dsn", "POSTGRES_DSN")
+	viper.BindEnv("multi_tenant_enabled", "MULTI_TENANT_ENABLED")
+	viper.BindEnv("tenant_claim", "TENANT_CLAIM")
+	viper.BindEnv("tenants_file", "TENANTS_FILE")
+	viper.BindEnv("message_cache_enabled", "MESSAGE_CACHE_ENABLED")
+	viper.BindEnv("message_cache_size", "MESSAGE_CACHE_SIZE")
+	viper.BindEnv("message_cache_groups", "MESSAGE_CACHE_GROUPS")
+	viper.BindEnv("message_cache_ttl", "MESSAGE_CACHE_TTL")
+	viper.BindEnv("redis_url", "REDIS_URL")
+	viper.BindEnv("cursor_secret", "CURSOR_SECRET")
+	viper.BindEnv("cursor_ttl", "CURSOR_TTL")
 	viper.BindEnv("azure_groupchat_connection_string", "AZURE_GROUPCHAT_CONNECTION_STRING")
 	viper.BindEnv("environment", "APP_ENV")
 	viper.BindEnv("port", "APP_PORT")
@@ -45,11 +209,66 @@ func LoadConfig(configPath string) (*Config, error) {
 	viper.BindEnv("user_service_url", "USER_SERVICE_URL")
 	viper.BindEnv("keycloak_public_key", "KEYCLOAK_PUBLIC_KEY")
 	viper.BindEnv("access_token_cookie_name", "ACCESS_TOKEN_COOKIE_NAME")
+	viper.BindEnv("token_sources", "TOKEN_SOURCES")
+	viper.BindEnv("cors_allowed_origins", "CORS_ALLOWED_ORIGINS")
+	viper.BindEnv("groups_claim", "GROUPS_CLAIM")
+	viper.BindEnv("policy_file", "POLICY_FILE")
+	viper.BindEnv("rate_limit_enabled", "RATE_LIMIT_ENABLED")
+	viper.BindEnv("rate_limit_file", "RATE_LIMIT_FILE")
+	viper.BindEnv("rate_limit_backend", "RATE_LIMIT_BACKEND")
+	viper.BindEnv("rate_limit_memory_buckets", "RATE_LIMIT_MEMORY_BUCKETS")
+	viper.BindEnv("group_membership_cache_size", "GROUP_MEMBERSHIP_CACHE_SIZE")
+	viper.BindEnv("group_membership_cache_ttl", "GROUP_MEMBERSHIP_CACHE_TTL")
+	viper.BindEnv("keycloak_jwks_url", "KEYCLOAK_JWKS_URL")
+	viper.BindEnv("keycloak_jwks_refresh_interval", "KEYCLOAK_JWKS_REFRESH_INTERVAL")
+	viper.BindEnv("keycloak_jwks_refresh_rate_limit", "KEYCLOAK_JWKS_REFRESH_RATE_LIMIT")
+	viper.BindEnv("jwt_issuers", "JWT_ISSUERS")
+	viper.BindEnv("jwt_audience", "JWT_AUDIENCE")
+	viper.BindEnv("jwt_clock_skew", "JWT_CLOCK_SKEW")
+	viper.BindEnv("jwt_required_type", "JWT_REQUIRED_TYPE")
+	viper.BindEnv("token_revocation_refresh_interval", "TOKEN_REVOCATION_REFRESH_INTERVAL")
+	viper.BindEnv("token_revocation_ttl", "TOKEN_REVOCATION_TTL")
 
 	// Set defaults
 	viper.SetDefault("environment", "development")
 	viper.SetDefault("port", 8080)
 	viper.SetDefault("debug", false)
+	viper.SetDefault("storage_backend", StorageBackendAzure)
+	viper.SetDefault("cursor_ttl", "24h")
+	viper.SetDefault("message_cache_enabled", false)
+	viper.SetDefault("message_cache_size", 50)
+	viper.SetDefault("message_cache_groups", 1000)
+	viper.SetDefault("message_cache_ttl", "5m")
+	viper.SetDefault("notification_backend", NotificationBackendFCM)
+	viper.SetDefault("default_locale", "nl")
+	viper.SetDefault("email_digest_enabled", false)
+	viper.SetDefault("email_digest_interval", "24h")
+	viper.SetDefault("smtp_port", 1025)
+	viper.SetDefault("retention_purge_enabled", false)
+	viper.SetDefault("retention_purge_interval", "1h")
+	viper.SetDefault("retention_purge_batch_size", 100)
+	viper.SetDefault("retention_purge_dry_run", false)
+	viper.SetDefault("archive_enabled", false)
+	viper.SetDefault("archive_job_enabled", false)
+	viper.SetDefault("archive_interval", "24h")
+	viper.SetDefault("archive_after_days", 365)
+	viper.SetDefault("archive_batch_size", 100)
+	viper.SetDefault("archive_container", "message-archive")
+	viper.SetDefault("encryption_enabled", false)
+	viper.SetDefault("multi_tenant_enabled", false)
+	viper.SetDefault("tenant_claim", "tenant_id")
+	viper.SetDefault("keycloak_jwks_refresh_interval", "1h")
+	viper.SetDefault("keycloak_jwks_refresh_rate_limit", "1m")
+	viper.SetDefault("token_sources", TokenSourceHeader+","+TokenSourceCookie)
+	viper.SetDefault("groups_claim", "groups")
+	viper.SetDefault("group_membership_cache_size", 10000)
+	viper.SetDefault("group_membership_cache_ttl", "5m")
+	viper.SetDefault("rate_limit_enabled", true)
+	viper.SetDefault("rate_limit_backend", RateLimitBackendMemory)
+	viper.SetDefault("rate_limit_memory_buckets", 100000)
+	viper.SetDefault("jwt_clock_skew", "30s")
+	viper.SetDefault("token_revocation_refresh_interval", "30s")
+	viper.SetDefault("token_revocation_ttl", "24h")
 
 	if err := viper.ReadInConfig(); err != nil {
 		var configFileNotFoundError viper.ConfigFileNotFoundError
@@ -80,20 +299,147 @@ func LoadConfig(configPath string) (*Config, error) {
 }
 
 func validateConfig(config *Config) error {
-	if config.AzureConnectionString == "" {
-		return fmt.Errorf("azure_connection_string is required")
+	switch config.StorageBackend {
+	case StorageBackendAzure:
+		if config.AzureConnectionString == "" {
+			return fmt.Errorf("azure_connection_string is required")
+		}
+	case StorageBackendPostgres:
+		if config.PostgresDSN == "" {
+			return fmt.Errorf("postgres_dsn is required for the postgres storage backend")
+		}
+	case StorageBackendMemory:
+	default:
+		return fmt.Errorf("unknown storage_backend: %s", config.StorageBackend)
+	}
+	switch config.NotificationBackend {
+	case NotificationBackendFCM:
+		if config.FirebaseCredentialFile == "" {
+			return fmt.Errorf("firebase_credential_file is required")
+		}
+	case NotificationBackendMemory:
+	case NotificationBackendFile:
+		if config.NotificationEmulatorFile == "" {
+			return fmt.Errorf("notification_emulator_file is required for the file notification backend")
+		}
+	default:
+		return fmt.Errorf("unknown notification_backend: %s", config.NotificationBackend)
+	}
+	if config.EmailDigestEnabled {
+		if config.SMTPHost == "" || config.SMTPFrom == "" {
+			return fmt.Errorf("smtp_host and smtp_from are required when the email digest is enabled")
+		}
+		if config.PublicBaseURL == "" || config.DigestUnsubscribeSecret == "" {
+			return fmt.Errorf("public_base_url and digest_unsubscribe_secret are required when the email digest is enabled")
+		}
+		if config.EmailDigestInterval <= 0 {
+			return fmt.Errorf("email_digest_interval must be positive")
+		}
+	}
+	if config.RetentionPurgeBatchSize <= 0 {
+		return fmt.Errorf("retention_purge_batch_size must be positive")
+	}
+	if config.RetentionPurgeEnabled && config.RetentionPurgeInterval <= 0 {
+		return fmt.Errorf("retention_purge_interval must be positive")
+	}
+	if config.ArchiveEnabled {
+		if config.ArchiveDir == "" && config.ArchiveConnectionString == "" && config.AzureConnectionString == "" {
+			return fmt.Errorf("archive_dir or archive_connection_string is required when the archive is enabled")
+		}
+		if config.ArchiveAfterDays <= 0 || config.ArchiveBatchSize <= 0 {
+			return fmt.Errorf("archive_after_days and archive_batch_size must be positive")
+		}
+		if config.ArchiveJobEnabled && config.ArchiveInterval <= 0 {
+			return fmt.Errorf("archive_interval must be positive")
+		}
+	} else if config.ArchiveJobEnabled {
+		return fmt.Errorf("archive_job_enabled requires archive_enabled")
 	}
-	if config.FirebaseCredentialFile == "" {
-		return fmt.Errorf("firebase_credential_file is required")
+	if config.EncryptionEnabled {
+		if config.StorageBackend != StorageBackendAzure {
+			return fmt.Errorf("encryption is only supported by the azure storage backend")
+		}
+		if (config.EncryptionMasterKeys == "") == (config.EncryptionKeyFile == "") {
+			return fmt.Errorf("either encryption_master_keys or encryption_key_file is required when encryption is enabled")
+		}
+	}
+	if config.MultiTenantEnabled {
+		if config.TenantsFile == "" {
+			return fmt.Errorf("tenants_file is required when multi-tenancy is enabled")
+		}
+		if config.TenantClaim == "" {
+			return fmt.Errorf("tenant_claim must not be empty when multi-tenancy is enabled")
+		}
+	}
+	if config.MessageCacheEnabled {
+		if config.MessageCacheSize <= 0 || config.MessageCacheGroups <= 0 {
+			return fmt.Errorf("message_cache_size and message_cache_groups must be positive")
+		}
+		if config.MessageCacheTTL <= 0 {
+			return fmt.Errorf("message_cache_ttl must be positive")
+		}
 	}
 	if config.UserServiceURL == "" {
 		return fmt.Errorf("user_service_url is required")
 	}
-	if config.PublicKey == "" {
-		return fmt.Errorf("keycloak_public_key is required")
+	if config.PublicKey == "" && config.JWKSURL == "" {
+		return fmt.Errorf("keycloak_jwks_url or keycloak_public_key is required")
+	}
+	if config.JWKSURL != "" && (config.JWKSRefreshInterval <= 0 || config.JWKSRefreshRateLimit <= 0) {
+		return fmt.Errorf("keycloak_jwks_refresh_interval and keycloak_jwks_refresh_rate_limit must be positive")
+	}
+	if config.JWTClockSkew < 0 {
+		return fmt.Errorf("jwt_clock_skew must not be negative")
+	}
+	if config.TokenRevocationRefreshInterval <= 0 || config.TokenRevocationTTL <= 0 {
+		return fmt.Errorf("token_revocation_refresh_interval and token_revocation_ttl must be positive")
 	}
 	if config.AccessTokenCookieName == "" {
 		return fmt.Errorf("access_token_cookie_name is required")
 	}
+	if config.GroupMembershipCacheSize <= 0 || config.GroupMembershipCacheTTL <= 0 {
+		return fmt.Errorf("group_membership_cache_size and group_membership_cache_ttl must be positive")
+	}
+	if config.RateLimitEnabled {
+		switch config.RateLimitBackend {
+		case RateLimitBackendMemory:
+			if config.RateLimitMemoryBuckets <= 0 {
+				return fmt.Errorf("rate_limit_memory_buckets must be positive")
+			}
+		case RateLimitBackendRedis:
+			if config.RedisURL == "" {
+				return fmt.Errorf("redis_url is required when rate_limit_backend is %s", RateLimitBackendRedis)
+			}
+		default:
+			return fmt.Errorf("unknown rate_limit_backend: %s", config.RateLimitBackend)
+		}
+	}
+	sources := SplitList(config.TokenSources)
+	if len(sources) == 0 {
+		return fmt.Errorf("token_sources must name %s, %s or both", TokenSourceHeader, TokenSourceCookie)
+	}
+	for i, source := range sources {
+		if (source != TokenSourceHeader && source != TokenSourceCookie) || slices.Contains(sources[:i], source) {
+			return fmt.Errorf("token_sources must name %s, %s or both, once each", TokenSourceHeader, TokenSourceCookie)
+		}
+	}
+	for _, origin := range SplitList(config.CORSAllowedOrigins) {
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+			parsed.Path != "" || parsed.RawQuery != "" || strings.Contains(origin, "*") {
+			return fmt.Errorf("cors_allowed_origins entry %q must be an origin such as https://app.example.com", origin)
+		}
+	}
 	return nil
 }
+
+// SplitList splits a comma-separated configuration value, dropping empty entries
+func SplitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
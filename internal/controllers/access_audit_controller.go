@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/middleware"
+	"Groupchat-Service/internal/policy"
+	"Groupchat-Service/internal/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type accessAuditController struct {
+	auditService services.AccessAuditService
+	authorizer   middleware.Authorizer
+}
+
+func NewAccessAuditController(service services.AccessAuditService, authorizer middleware.Authorizer) AccessAuditController {
+	return &accessAuditController{auditService: service, authorizer: authorizer}
+}
+
+func (c *accessAuditController) RegisterRoutes(router *gin.Engine) {
+	for _, groups := range groupRouters(router) {
+		groups.GET("/access-audit", middleware.RequireAction(c.authorizer, policy.ActionAuditRead), c.ListAccesses)
+	}
+}
+
+// ListAccesses shows the patient and primary caregiver which professionals read or moderated their group
+func (c *accessAuditController) ListAccesses(ctx *gin.Context) {
+	groupID, err := getGroupIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	audits, err := c.auditService.ListAccesses(ctx.Request.Context(), groupID)
+	if err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to list group accesses")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": audits})
+}
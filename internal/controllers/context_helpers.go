@@ -1,8 +1,10 @@
 package controllers
 
 import (
+	"Groupchat-Service/internal/models"
 	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -36,6 +38,18 @@ func getUserIDFromContext(ctx *gin.Context) (uuid.UUID, error) {
 	return parsedUserID, nil
 }
 
+// getRoleFromContext returns the role claim of the token, or an empty role when it has none
+func getRoleFromContext(ctx *gin.Context) models.Role {
+	claims, _ := ctx.Get("claims")
+	mapClaims, _ := claims.(jwt.MapClaims)
+	roleStr, _ := mapClaims["role"].(string)
+	role, err := models.ParseRole(roleStr)
+	if err != nil {
+		return ""
+	}
+	return role
+}
+
 func respondWithError(ctx *gin.Context, code int, message string) {
 	ctx.JSON(code, gin.H{"error": message})
 }
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/middleware"
+	"Groupchat-Service/internal/policy"
+	"Groupchat-Service/internal/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type debugController struct {
+	recorder   services.NotificationRecorder
+	authorizer middleware.Authorizer
+}
+
+// NewDebugController exposes the notifications captured by the FCM emulator to admins. They hold the
+// messages of every group and tenant, so it is only registered when DEBUG is set and an emulator
+// notification backend is configured.
+func NewDebugController(recorder services.NotificationRecorder, authorizer middleware.Authorizer) DebugController {
+	return &debugController{recorder: recorder, authorizer: authorizer}
+}
+
+func (c *debugController) RegisterRoutes(router *gin.Engine) {
+	requireDebug := middleware.RequireAction(c.authorizer, policy.ActionDebugNotifications)
+	router.GET("/debug/notifications", requireDebug, c.GetNotifications)
+	router.DELETE("/debug/notifications", requireDebug, c.ResetNotifications)
+}
+
+func (c *debugController) GetNotifications(ctx *gin.Context) {
+	notifications, err := c.recorder.Recorded()
+	if err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to read recorded notifications")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": notifications})
+}
+
+func (c *debugController) ResetNotifications(ctx *gin.Context) {
+	if err := c.recorder.Reset(); err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to reset recorded notifications")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Recorded notifications cleared"})
+}
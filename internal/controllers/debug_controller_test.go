@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
+	"Groupchat-Service/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type stubNotificationRecorder struct {
+	notifications []services.RecordedNotification
+}
+
+func (r *stubNotificationRecorder) Recorded() ([]services.RecordedNotification, error) {
+	return r.notifications, nil
+}
+
+func (r *stubNotificationRecorder) Reset() error {
+	r.notifications = nil
+	return nil
+}
+
+func TestDebugNotificationsRequireAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p, err := policy.Load("", stubPolicyResources{})
+	require.NoError(t, err)
+
+	serve := func(role models.Role, method string, recorder *stubNotificationRecorder) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("claims", jwt.MapClaims{"role": string(role)})
+			c.Set("userID", uuid.NewString())
+			c.Set("groupID", uuid.NewString())
+		})
+		NewDebugController(recorder, p).RegisterRoutes(router)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/debug/notifications", nil))
+		return w
+	}
+
+	for _, role := range []models.Role{models.RolePatient, models.RoleHealthcareProfessional} {
+		recorder := &stubNotificationRecorder{notifications: []services.RecordedNotification{{}}}
+		assert.Equal(t, http.StatusForbidden, serve(role, http.MethodGet, recorder).Code, role)
+		assert.Equal(t, http.StatusForbidden, serve(role, http.MethodDelete, recorder).Code, role)
+		assert.Len(t, recorder.notifications, 1, "%s cannot clear the notifications", role)
+	}
+
+	recorder := &stubNotificationRecorder{notifications: []services.RecordedNotification{{}}}
+	assert.Equal(t, http.StatusOK, serve(models.RoleAdmin, http.MethodGet, recorder).Code)
+	assert.Equal(t, http.StatusOK, serve(models.RoleAdmin, http.MethodDelete, recorder).Code)
+	assert.Empty(t, recorder.notifications)
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"html/template"
+	"net/http"
+)
+
+// unsubscribePage asks to confirm unsubscribing, or tells that it is done. The form posts back to the URL of the
+// page, which carries the token.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Email digest</title></head>
+<body>
+{{if .Done}}<p>You have been unsubscribed from the email digest.</p>
+{{else}}<p>Do you want to stop receiving the email digest?</p>
+<form method="post"><button type="submit">Unsubscribe</button></form>
+{{end}}</body>
+</html>
+`))
+
+type digestController struct {
+	digestService services.DigestService
+}
+
+func NewDigestController(digestService services.DigestService) DigestController {
+	return &digestController{digestService: digestService}
+}
+
+// RegisterRoutes registers the unsubscribe link target. GET only asks to confirm, as mail scanners and link
+// previews follow links in mails; the confirmation and one-click unsubscribe from mail clients (RFC 8058) POST.
+// These routes are reachable without an access token.
+func (c *digestController) RegisterRoutes(router *gin.Engine) {
+	router.GET("/digest/unsubscribe", c.ConfirmUnsubscribe)
+	router.POST("/digest/unsubscribe", c.Unsubscribe)
+}
+
+// ConfirmUnsubscribe shows the page with the button that unsubscribes
+func (c *digestController) ConfirmUnsubscribe(ctx *gin.Context) {
+	if ctx.Query("token") == "" {
+		respondWithError(ctx, http.StatusBadRequest, "Unsubscribe token is required")
+		return
+	}
+	renderUnsubscribePage(ctx, false)
+}
+
+func (c *digestController) Unsubscribe(ctx *gin.Context) {
+	token := ctx.Query("token")
+	if token == "" {
+		respondWithError(ctx, http.StatusBadRequest, "Unsubscribe token is required")
+		return
+	}
+
+	if err := c.digestService.Unsubscribe(ctx.Request.Context(), token); err != nil {
+		if errors.Is(err, services.ErrInvalidUnsubscribeToken) {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to unsubscribe")
+		return
+	}
+
+	// Mail clients posting one-click unsubscribes get JSON, browsers submitting the form a page
+	if ctx.NegotiateFormat(binding.MIMEJSON, binding.MIMEHTML) == binding.MIMEHTML {
+		renderUnsubscribePage(ctx, true)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "You have been unsubscribed from the email digest"})
+}
+
+func renderUnsubscribePage(ctx *gin.Context, done bool) {
+	ctx.Header("Content-Type", "text/html; charset=utf-8")
+	ctx.Status(http.StatusOK)
+	if err := unsubscribePage.Execute(ctx.Writer, struct{ Done bool }{done}); err != nil {
+		ctx.Error(err)
+	}
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/services"
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type stubDigestService struct {
+	unsubscribed []string
+}
+
+func (s *stubDigestService) SendDigests(context.Context) error {
+	return nil
+}
+
+func (s *stubDigestService) Unsubscribe(_ context.Context, token string) error {
+	if token != "valid" {
+		return services.ErrInvalidUnsubscribeToken
+	}
+	s.unsubscribed = append(s.unsubscribed, token)
+	return nil
+}
+
+func TestDigestUnsubscribe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(service *stubDigestService, request *http.Request) *httptest.ResponseRecorder {
+		router := gin.New()
+		NewDigestController(service).RegisterRoutes(router)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	t.Run("Following the link only asks to confirm", func(t *testing.T) {
+		service := &stubDigestService{}
+		w := serve(service, httptest.NewRequest(http.MethodGet, "/digest/unsubscribe?token=valid", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, w.Body.String(), `<form method="post">`)
+		assert.Empty(t, service.unsubscribed)
+
+		w = serve(service, httptest.NewRequest(http.MethodGet, "/digest/unsubscribe", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Confirming from the page unsubscribes", func(t *testing.T) {
+		service := &stubDigestService{}
+		request := httptest.NewRequest(http.MethodPost, "/digest/unsubscribe?token=valid", nil)
+		request.Header.Set("Accept", "text/html,application/xhtml+xml")
+		w := serve(service, request)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "You have been unsubscribed")
+		assert.Equal(t, []string{"valid"}, service.unsubscribed)
+	})
+
+	t.Run("One-click unsubscribe from mail clients", func(t *testing.T) {
+		service := &stubDigestService{}
+		w := serve(service, httptest.NewRequest(http.MethodPost, "/digest/unsubscribe?token=valid",
+			strings.NewReader("List-Unsubscribe=One-Click")))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+		assert.Equal(t, []string{"valid"}, service.unsubscribed)
+
+		w = serve(service, httptest.NewRequest(http.MethodPost, "/digest/unsubscribe?token=forged", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
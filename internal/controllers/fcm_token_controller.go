@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"Groupchat-Service/internal/middleware"
+	"Groupchat-Service/internal/policy"
 	"Groupchat-Service/internal/services"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -9,15 +11,18 @@ import (
 type fcmTokenController struct {
 	fcmTokenService   services.FCMTokenService
 	validationService services.ValidationService
+	authorizer        middleware.Authorizer
 }
 
-func NewFCMTokenController(service services.FCMTokenService, validationService services.ValidationService) FCMTokenController {
-	return &fcmTokenController{fcmTokenService: service, validationService: validationService}
+func NewFCMTokenController(service services.FCMTokenService, validationService services.ValidationService, authorizer middleware.Authorizer) FCMTokenController {
+	return &fcmTokenController{fcmTokenService: service, validationService: validationService, authorizer: authorizer}
 }
 
 func (c *fcmTokenController) RegisterRoutes(router *gin.Engine) {
-	router.POST("/groups/users/tokens", c.SaveToken)
-	router.DELETE("/groups/users/tokens", c.DeleteToken)
+	for _, groups := range groupRouters(router) {
+		groups.POST("/users/tokens", middleware.RequireAction(c.authorizer, policy.ActionTokenRegister), c.SaveToken)
+		groups.DELETE("/users/tokens", middleware.RequireAction(c.authorizer, policy.ActionTokenDelete), c.DeleteToken)
+	}
 }
 
 func (c *fcmTokenController) SaveToken(ctx *gin.Context) {
@@ -47,7 +52,7 @@ func (c *fcmTokenController) SaveToken(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.fcmTokenService.SaveToken(ctx.Request.Context(), groupID, userID, request.Token); err != nil {
+	if err := c.fcmTokenService.SaveToken(ctx.Request.Context(), groupID, userID, request.Token, ctx.GetHeader("Accept-Language")); err != nil {
 		respondWithError(ctx, http.StatusInternalServerError, "Failed to save token")
 		return
 	}
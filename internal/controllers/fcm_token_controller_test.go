@@ -20,8 +20,8 @@ type mockFCMTokenService struct {
 	mock.Mock
 }
 
-func (m *mockFCMTokenService) SaveToken(ctx context.Context, groupID, userID uuid.UUID, token string) error {
-	args := m.Called(ctx, groupID, userID, token)
+func (m *mockFCMTokenService) SaveToken(ctx context.Context, groupID, userID uuid.UUID, token string, acceptLanguage string) error {
+	args := m.Called(ctx, groupID, userID, token, acceptLanguage)
 	return args.Error(0)
 }
 
@@ -39,6 +39,11 @@ func (m *mockValidationService) ValidatePaginationQuery(queryParams map[string]s
 	return args.Get(0).(models.PaginationQuery), args.Error(1)
 }
 
+func (m *mockValidationService) ValidateSearchQuery(queryParams map[string]string) (models.SearchQuery, error) {
+	args := m.Called(queryParams)
+	return args.Get(0).(models.SearchQuery), args.Error(1)
+}
+
 func (m *mockValidationService) ValidateUserContext(ctx context.Context) (uuid.UUID, string, error) {
 	args := m.Called(ctx)
 	return args.Get(0).(uuid.UUID), args.String(1), args.Error(2)
@@ -59,10 +64,20 @@ func (m *mockValidationService) ValidateToken(token string) error {
 	return args.Error(0)
 }
 
+func (m *mockValidationService) ValidateLocale(locale string) error {
+	args := m.Called(locale)
+	return args.Error(0)
+}
+
+func (m *mockValidationService) ValidateEmail(email string) error {
+	args := m.Called(email)
+	return args.Error(0)
+}
+
 func setupTestController() (*fcmTokenController, *mockFCMTokenService, *mockValidationService) {
 	mockFCMService := new(mockFCMTokenService)
 	mockValidation := new(mockValidationService)
-	controller := NewFCMTokenController(mockFCMService, mockValidation).(*fcmTokenController)
+	controller := NewFCMTokenController(mockFCMService, mockValidation, nil).(*fcmTokenController)
 	return controller, mockFCMService, mockValidation
 }
 
@@ -92,10 +107,11 @@ func TestSaveToken(t *testing.T) {
 		jsonBody, _ := json.Marshal(body)
 		ctx.Request = httptest.NewRequest("POST", "/", bytes.NewBuffer(jsonBody))
 		ctx.Request.Header.Set("Content-Type", "application/json")
+		ctx.Request.Header.Set("Accept-Language", "nl-NL,nl;q=0.9")
 
 		// Set up mock expectations
 		mockValidation.On("ValidateToken", token).Return(nil)
-		mockFCMService.On("SaveToken", mock.Anything, mock.Anything, mock.Anything, token).Return(nil)
+		mockFCMService.On("SaveToken", mock.Anything, mock.Anything, mock.Anything, token, "nl-NL,nl;q=0.9").Return(nil)
 
 		// Execute the handler
 		controller.SaveToken(ctx)
@@ -161,7 +177,7 @@ func TestSaveToken(t *testing.T) {
 		ctx.Request.Header.Set("Content-Type", "application/json")
 
 		mockValidation.On("ValidateToken", token).Return(nil)
-		mockFCMService.On("SaveToken", mock.Anything, mock.Anything, mock.Anything, token).
+		mockFCMService.On("SaveToken", mock.Anything, mock.Anything, mock.Anything, token, mock.Anything).
 			Return(errors.New("database error"))
 
 		controller.SaveToken(ctx)
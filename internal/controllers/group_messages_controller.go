@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"Groupchat-Service/internal/middleware"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -9,33 +10,37 @@ import (
 	"github.com/google/uuid"
 
 	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
 	"Groupchat-Service/internal/services"
 )
 
 type FCMMessageController struct {
 	messageService    services.MessageService
 	validationService services.ValidationService
+	authorizer        middleware.Authorizer
 }
 
-func NewMessageController(messageService services.MessageService, validationService services.ValidationService) *FCMMessageController {
+func NewMessageController(messageService services.MessageService, validationService services.ValidationService, authorizer middleware.Authorizer) *FCMMessageController {
 	return &FCMMessageController{
 		messageService:    messageService,
 		validationService: validationService,
+		authorizer:        authorizer,
 	}
 }
 
 func (c *FCMMessageController) RegisterRoutes(router *gin.Engine) {
-	router.GET("/groups/messages",
-		middleware.RequireRoles(models.RolePatient, models.RolePrimaryCaregiver, models.RoleFamilyMember),
-		c.GetMessages)
+	for _, groups := range groupRouters(router) {
+		groups.GET("/messages", middleware.RequireAction(c.authorizer, policy.ActionMessageRead), c.GetMessages)
+		groups.GET("/messages/search", middleware.RequireAction(c.authorizer, policy.ActionMessageRead), c.SearchMessages)
+		groups.GET("/messages/:messageId", middleware.RequireAction(c.authorizer, policy.ActionMessageRead), c.GetMessage)
+		groups.POST("/messages", middleware.RequireAction(c.authorizer, policy.ActionMessageCreate), c.CreateMessage)
+		groups.PUT("/messages/:messageId/pin", middleware.RequireAction(c.authorizer, policy.ActionMessagePin), c.ToggleMessagePin)
 
-	router.POST("/groups/messages",
-		middleware.RequireRoles(models.RolePatient, models.RolePrimaryCaregiver, models.RoleFamilyMember),
-		c.CreateMessage)
-
-	router.PUT("/groups/messages/:messageId/pin",
-		middleware.RequireRoles(models.RolePatient, models.RolePrimaryCaregiver, models.RoleFamilyMember),
-		c.ToggleMessagePin)
+		// Moderators delete any message; members only their own, where the group allows it
+		groups.DELETE("/messages/:messageId",
+			middleware.RequireAction(c.authorizer, policy.ActionMessageDeleteAny, policy.ActionMessageDeleteOwn),
+			c.DeleteMessage)
+	}
 }
 
 func (c *FCMMessageController) GetMessages(ctx *gin.Context) {
@@ -60,6 +65,10 @@ func (c *FCMMessageController) GetMessages(ctx *gin.Context) {
 
 	messages, pagination, err := c.messageService.GetMessages(ctx.Request.Context(), groupID, query)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) || errors.Is(err, services.ErrCursorExpired) || errors.Is(err, services.ErrSearchDisabled) {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
 		respondWithError(ctx, http.StatusInternalServerError, "Error getting messages")
 		return
 	}
@@ -70,6 +79,68 @@ func (c *FCMMessageController) GetMessages(ctx *gin.Context) {
 	})
 }
 
+func (c *FCMMessageController) SearchMessages(ctx *gin.Context) {
+	groupID, err := getGroupIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	queryParams := map[string]string{
+		"q":        ctx.Query("q"),
+		"pageSize": ctx.Query("pageSize"),
+		"cursor":   ctx.Query("cursor"),
+	}
+
+	query, err := c.validationService.ValidateSearchQuery(queryParams)
+	if err != nil {
+		respondWithError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, pagination, err := c.messageService.SearchMessages(ctx.Request.Context(), groupID, query)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) || errors.Is(err, services.ErrCursorExpired) || errors.Is(err, services.ErrSearchDisabled) {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondWithError(ctx, http.StatusInternalServerError, "Error searching messages")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"data":       results,
+		"pagination": pagination,
+	})
+}
+
+func (c *FCMMessageController) GetMessage(ctx *gin.Context) {
+	groupID, err := getGroupIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	messageID, err := uuid.Parse(ctx.Param("messageId"))
+	if err != nil {
+		respondWithError(ctx, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	message, err := c.messageService.GetMessage(ctx.Request.Context(), groupID, messageID)
+	if err != nil {
+		if errors.Is(err, services.ErrMessageNotFound) {
+			respondWithError(ctx, http.StatusNotFound, "Message not found")
+			return
+		}
+		respondWithError(ctx, http.StatusInternalServerError, "Error getting message")
+		return
+	}
+
+	setETag(ctx, message.ETag)
+	ctx.JSON(http.StatusOK, message)
+}
+
 func (c *FCMMessageController) CreateMessage(ctx *gin.Context) {
 	userID, err := getUserIDFromContext(ctx)
 	if err != nil {
@@ -98,8 +169,18 @@ func (c *FCMMessageController) CreateMessage(ctx *gin.Context) {
 		return
 	}
 
-	message, err := c.messageService.CreateMessage(ctx.Request.Context(), groupID, userID, userName, createReq)
+	// Professionals post with a badge, so the group can tell their advice from that of other members
+	badge := models.BadgeNone
+	if getRoleFromContext(ctx) == models.RoleHealthcareProfessional {
+		badge = models.BadgeProfessional
+	}
+
+	message, err := c.messageService.CreateMessage(ctx.Request.Context(), groupID, userID, userName, badge, createReq)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidEncryptedMessage) {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
 		respondWithError(ctx, http.StatusInternalServerError, "Error creating message")
 		return
 	}
@@ -120,11 +201,76 @@ func (c *FCMMessageController) ToggleMessagePin(ctx *gin.Context) {
 		return
 	}
 
-	message, err := c.messageService.ToggleMessagePin(ctx.Request.Context(), groupID, messageID)
+	// Clients that send the ETag they read only toggle that version of the message
+	ifMatch := ctx.GetHeader("If-Match")
+	if ifMatch == "*" {
+		ifMatch = ""
+	}
+
+	message, err := c.messageService.ToggleMessagePin(ctx.Request.Context(), groupID, messageID, ifMatch)
 	if err != nil {
-		respondWithError(ctx, http.StatusInternalServerError, "Error toggling message pin")
+		switch {
+		case errors.Is(err, services.ErrMessageNotFound):
+			respondWithError(ctx, http.StatusNotFound, "Message not found")
+		case errors.Is(err, services.ErrMessageConflict):
+			c.respondWithConflict(ctx, groupID, messageID, err)
+		default:
+			respondWithError(ctx, http.StatusInternalServerError, "Error toggling message pin")
+		}
 		return
 	}
 
+	setETag(ctx, message.ETag)
 	ctx.JSON(http.StatusOK, message)
 }
+
+func (c *FCMMessageController) DeleteMessage(ctx *gin.Context) {
+	groupID, err := getGroupIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	messageID, err := uuid.Parse(ctx.Param("messageId"))
+	if err != nil {
+		respondWithError(ctx, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	if err := c.messageService.DeleteMessage(ctx.Request.Context(), groupID, messageID); err != nil {
+		if errors.Is(err, services.ErrMessageNotFound) {
+			respondWithError(ctx, http.StatusNotFound, "Message not found")
+			return
+		}
+		respondWithError(ctx, http.StatusInternalServerError, "Error deleting message")
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// respondWithConflict answers a stale If-Match with the current state of the message, so the client can
+// show it and decide again
+func (c *FCMMessageController) respondWithConflict(ctx *gin.Context, groupID uuid.UUID, messageID uuid.UUID, conflict error) {
+	current, err := c.messageService.GetMessage(ctx.Request.Context(), groupID, messageID)
+	if err != nil {
+		if errors.Is(err, services.ErrMessageNotFound) {
+			respondWithError(ctx, http.StatusNotFound, "Message not found")
+			return
+		}
+		respondWithError(ctx, http.StatusInternalServerError, "Error getting message")
+		return
+	}
+
+	setETag(ctx, current.ETag)
+	ctx.JSON(http.StatusConflict, gin.H{
+		"error":   conflict.Error(),
+		"current": current,
+	})
+}
+
+func setETag(ctx *gin.Context, etag string) {
+	if etag != "" {
+		ctx.Header("ETag", etag)
+	}
+}
@@ -2,11 +2,14 @@ package controllers
 
 import (
 	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/services"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -24,20 +27,41 @@ func (m *mockMessageService) GetMessages(ctx context.Context, groupID uuid.UUID,
 	return args.Get(0).([]models.MessageResponse), args.Get(1).(*models.PaginationResponse), args.Error(2)
 }
 
-func (m *mockMessageService) CreateMessage(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, userName string, create models.MessageCreate) (*models.Message, error) {
-	args := m.Called(ctx, groupID, userID, userName, create)
+func (m *mockMessageService) GetMessage(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.MessageResponse, error) {
+	args := m.Called(ctx, groupID, messageID)
+	if message := args.Get(0); message != nil {
+		return message.(*models.MessageResponse), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockMessageService) CreateMessage(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, userName string, badge models.SenderBadge, create models.MessageCreate) (*models.Message, error) {
+	args := m.Called(ctx, groupID, userID, userName, badge, create)
 	return args.Get(0).(*models.Message), args.Error(1)
 }
 
-func (m *mockMessageService) ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error) {
+func (m *mockMessageService) DeleteMessage(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) error {
 	args := m.Called(ctx, groupID, messageID)
-	return args.Get(0).(*models.Message), args.Error(1)
+	return args.Error(0)
+}
+
+func (m *mockMessageService) ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID, ifMatch string) (*models.Message, error) {
+	args := m.Called(ctx, groupID, messageID, ifMatch)
+	if message := args.Get(0); message != nil {
+		return message.(*models.Message), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockMessageService) SearchMessages(ctx context.Context, groupID uuid.UUID, query models.SearchQuery) ([]models.SearchResult, *models.PaginationResponse, error) {
+	args := m.Called(ctx, groupID, query)
+	return args.Get(0).([]models.SearchResult), args.Get(1).(*models.PaginationResponse), args.Error(2)
 }
 
 func setupMessageController() (*FCMMessageController, *mockMessageService, *mockValidationService) {
 	mockMsgService := new(mockMessageService)
 	mockValidation := new(mockValidationService)
-	controller := NewMessageController(mockMsgService, mockValidation)
+	controller := NewMessageController(mockMsgService, mockValidation, nil)
 	return controller, mockMsgService, mockValidation
 }
 
@@ -94,6 +118,157 @@ func TestGetMessages(t *testing.T) {
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
+
+	t.Run("Invalid or expired cursor", func(t *testing.T) {
+		for _, cursorErr := range []error{services.ErrInvalidCursor, services.ErrCursorExpired} {
+			controller, mockMsgService, mockValidation := setupMessageController()
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+
+			groupID := uuid.New()
+			ctx.Set("groupID", groupID.String())
+			ctx.Request = httptest.NewRequest("GET", "/?cursor=tampered", nil)
+
+			mockValidation.On("ValidatePaginationQuery", mock.Anything, mock.Anything).
+				Return(models.PaginationQuery{PageSize: 10, Direction: models.Next}, nil)
+			mockMsgService.On("GetMessages", mock.Anything, groupID, mock.Anything).
+				Return([]models.MessageResponse(nil), (*models.PaginationResponse)(nil), cursorErr)
+
+			controller.GetMessages(ctx)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), cursorErr.Error())
+		}
+	})
+}
+
+func TestSearchMessages(t *testing.T) {
+	t.Run("Returns results with snippets", func(t *testing.T) {
+		controller, mockMsgService, mockValidation := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.Request = httptest.NewRequest("GET", "/?q=wandelen", nil)
+
+		expectedQuery := models.SearchQuery{Text: "wandelen", PageSize: 10}
+		mockValidation.On("ValidateSearchQuery", mock.Anything).Return(expectedQuery, nil)
+
+		results := []models.SearchResult{{
+			MessageResponse: models.MessageResponse{ID: uuid.New(), Content: "We gaan wandelen"},
+			Snippet:         "We gaan <mark>wandelen</mark>",
+		}}
+		mockMsgService.On("SearchMessages", mock.Anything, groupID, expectedQuery).
+			Return(results, &models.PaginationResponse{}, nil)
+
+		controller.SearchMessages(ctx)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Data []models.SearchResult `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, results, response.Data)
+	})
+
+	t.Run("Missing search text", func(t *testing.T) {
+		controller, _, mockValidation := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		ctx.Set("groupID", uuid.New().String())
+		ctx.Request = httptest.NewRequest("GET", "/", nil)
+
+		mockValidation.On("ValidateSearchQuery", mock.Anything).
+			Return(models.SearchQuery{}, errors.New("search text is required"))
+
+		controller.SearchMessages(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Cursor of another search", func(t *testing.T) {
+		controller, mockMsgService, mockValidation := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.Request = httptest.NewRequest("GET", "/?q=fietsen&cursor=abc", nil)
+
+		mockValidation.On("ValidateSearchQuery", mock.Anything).
+			Return(models.SearchQuery{Text: "fietsen", PageSize: 10}, nil)
+		mockMsgService.On("SearchMessages", mock.Anything, groupID, mock.Anything).
+			Return([]models.SearchResult(nil), (*models.PaginationResponse)(nil), services.ErrInvalidCursor)
+
+		controller.SearchMessages(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("End-to-end encrypted group", func(t *testing.T) {
+		controller, mockMsgService, mockValidation := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.Request = httptest.NewRequest("GET", "/?q=fietsen", nil)
+
+		mockValidation.On("ValidateSearchQuery", mock.Anything).
+			Return(models.SearchQuery{Text: "fietsen", PageSize: 10}, nil)
+		mockMsgService.On("SearchMessages", mock.Anything, groupID, mock.Anything).
+			Return([]models.SearchResult(nil), (*models.PaginationResponse)(nil), services.ErrSearchDisabled)
+
+		controller.SearchMessages(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), services.ErrSearchDisabled.Error())
+	})
+}
+
+func TestGetMessage(t *testing.T) {
+	t.Run("Successfully get message", func(t *testing.T) {
+		controller, mockMsgService, _ := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		messageID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.AddParam("messageId", messageID.String())
+		ctx.Request = httptest.NewRequest("GET", "/", nil)
+
+		expectedMsg := &models.MessageResponse{ID: messageID, Content: "test message"}
+		mockMsgService.On("GetMessage", mock.Anything, groupID, messageID).Return(expectedMsg, nil)
+
+		controller.GetMessage(ctx)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.MessageResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedMsg.Content, response.Content)
+	})
+
+	t.Run("Message not found", func(t *testing.T) {
+		controller, mockMsgService, _ := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		messageID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.AddParam("messageId", messageID.String())
+		ctx.Request = httptest.NewRequest("GET", "/", nil)
+
+		mockMsgService.On("GetMessage", mock.Anything, groupID, messageID).Return(nil, services.ErrMessageNotFound)
+
+		controller.GetMessage(ctx)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
 }
 
 func TestCreateMessage(t *testing.T) {
@@ -126,8 +301,9 @@ func TestCreateMessage(t *testing.T) {
 			mock.Anything, // context
 			groupID,
 			userID,
-			"Test User", // userName (first + last name)
-			createReq,   // message create request
+			"Test User",      // userName (first + last name)
+			models.BadgeNone, // no badge for group members
+			createReq,        // message create request
 		).Return(expectedMsg, nil)
 
 		controller.CreateMessage(ctx)
@@ -166,12 +342,106 @@ func TestCreateMessage(t *testing.T) {
 			mock.Anything,
 			mock.Anything,
 			mock.Anything,
+			mock.Anything,
 		).Return(nil, nil).Maybe()
 
 		controller.CreateMessage(ctx)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
+
+	t.Run("Message does not match the encryption mode of the group", func(t *testing.T) {
+		controller, mockMsgService, _ := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		userID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.Set("userID", userID.String())
+		ctx.Set("firstName", "Test")
+		ctx.Set("lastName", "User")
+
+		createReq := models.MessageCreate{Content: "Y2lwaGVydGV4dA=="}
+		jsonBody, _ := json.Marshal(createReq)
+		ctx.Request = httptest.NewRequest("POST", "/", bytes.NewBuffer(jsonBody))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+
+		mockMsgService.On("CreateMessage", mock.Anything, groupID, userID, "Test User", models.BadgeNone, createReq).
+			Return((*models.Message)(nil), fmt.Errorf("%w: key envelopes are required", services.ErrInvalidEncryptedMessage))
+
+		controller.CreateMessage(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "key envelopes are required")
+	})
+
+	t.Run("Professionals post with a badge", func(t *testing.T) {
+		controller, mockMsgService, _ := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		userID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.Set("userID", userID.String())
+		ctx.Set("firstName", "Test")
+		ctx.Set("lastName", "User")
+		ctx.Set("claims", jwt.MapClaims{"role": string(models.RoleHealthcareProfessional)})
+
+		createReq := models.MessageCreate{Content: "test message"}
+		jsonBody, _ := json.Marshal(createReq)
+		ctx.Request = httptest.NewRequest("POST", "/", bytes.NewBuffer(jsonBody))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+
+		mockMsgService.On("CreateMessage", mock.Anything, groupID, userID, "Test User", models.BadgeProfessional, createReq).
+			Return(&models.Message{ID: uuid.New(), SenderBadge: models.BadgeProfessional}, nil)
+
+		controller.CreateMessage(ctx)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"senderBadge":"professional"`)
+		mockMsgService.AssertExpectations(t)
+	})
+}
+
+func TestDeleteMessage(t *testing.T) {
+	t.Run("Successfully delete message", func(t *testing.T) {
+		controller, mockMsgService, _ := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		messageID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.AddParam("messageId", messageID.String())
+		ctx.Request = httptest.NewRequest("DELETE", "/", nil)
+
+		mockMsgService.On("DeleteMessage", mock.Anything, groupID, messageID).Return(nil)
+
+		controller.DeleteMessage(ctx)
+
+		assert.Equal(t, http.StatusNoContent, ctx.Writer.Status())
+		mockMsgService.AssertExpectations(t)
+	})
+
+	t.Run("Message not found", func(t *testing.T) {
+		controller, mockMsgService, _ := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		messageID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.AddParam("messageId", messageID.String())
+		ctx.Request = httptest.NewRequest("DELETE", "/", nil)
+
+		mockMsgService.On("DeleteMessage", mock.Anything, groupID, messageID).Return(services.ErrMessageNotFound)
+
+		controller.DeleteMessage(ctx)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
 }
 
 func TestToggleMessagePin(t *testing.T) {
@@ -187,8 +457,8 @@ func TestToggleMessagePin(t *testing.T) {
 
 		ctx.Request = httptest.NewRequest("PUT", "/", nil)
 
-		expectedMsg := &models.Message{ID: messageID, IsPinned: true}
-		mockMsgService.On("ToggleMessagePin", mock.Anything, groupID, messageID).
+		expectedMsg := &models.Message{ID: messageID, IsPinned: true, ETag: `"2"`}
+		mockMsgService.On("ToggleMessagePin", mock.Anything, groupID, messageID, "").
 			Return(expectedMsg, nil)
 
 		controller.ToggleMessagePin(ctx)
@@ -201,6 +471,56 @@ func TestToggleMessagePin(t *testing.T) {
 		}
 		assert.Equal(t, expectedMsg.ID, response.ID)
 		assert.Equal(t, expectedMsg.IsPinned, response.IsPinned)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	})
+
+	t.Run("Stale If-Match returns the current state", func(t *testing.T) {
+		controller, mockMsgService, _ := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		messageID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.AddParam("messageId", messageID.String())
+		ctx.Request = httptest.NewRequest("PUT", "/", nil)
+		ctx.Request.Header.Set("If-Match", `"1"`)
+
+		current := &models.MessageResponse{ID: messageID, IsPinned: true, ETag: `"2"`}
+		mockMsgService.On("ToggleMessagePin", mock.Anything, groupID, messageID, `"1"`).
+			Return(nil, services.ErrMessageConflict)
+		mockMsgService.On("GetMessage", mock.Anything, groupID, messageID).Return(current, nil)
+
+		controller.ToggleMessagePin(ctx)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+		var response struct {
+			Error   string                 `json:"error"`
+			Current models.MessageResponse `json:"current"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, *current, response.Current)
+	})
+
+	t.Run("Unknown message", func(t *testing.T) {
+		controller, mockMsgService, _ := setupMessageController()
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		messageID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.AddParam("messageId", messageID.String())
+		ctx.Request = httptest.NewRequest("PUT", "/", nil)
+		ctx.Request.Header.Set("If-Match", "*")
+
+		mockMsgService.On("ToggleMessagePin", mock.Anything, groupID, messageID, "").
+			Return(nil, services.ErrMessageNotFound)
+
+		controller.ToggleMessagePin(ctx)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
 
 	t.Run("Invalid message ID", func(t *testing.T) {
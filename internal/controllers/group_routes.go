@@ -0,0 +1,11 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// groupRouters returns where group routes are registered: under /groups for the group_id of the token, and under
+// /groups/:groupId for any group of the user, whose membership the group scope middleware checks
+func groupRouters(router *gin.Engine) []*gin.RouterGroup {
+	return []*gin.RouterGroup{router.Group("/groups"), router.Group("/groups/:groupId")}
+}
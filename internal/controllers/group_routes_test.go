@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupRoutesHaveGroupScopedAliases(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewMessageController(nil, nil, nil).RegisterRoutes(router)
+	NewFCMTokenController(nil, nil, nil).RegisterRoutes(router)
+	NewUserPreferencesController(nil, nil, nil).RegisterRoutes(router)
+	NewGroupSettingsController(nil, nil).RegisterRoutes(router)
+	NewKeyDistributionController(nil, nil).RegisterRoutes(router)
+
+	routes := make(map[string]bool)
+	for _, route := range router.Routes() {
+		routes[route.Method+" "+route.Path] = true
+	}
+	for _, route := range []string{
+		"GET /groups/messages",
+		"POST /groups/messages",
+		"PUT /groups/messages/:messageId/pin",
+		"POST /groups/users/tokens",
+		"DELETE /groups/users/tokens",
+		"PUT /groups/settings",
+		"GET /groups/keys/bundles",
+		"PUT /groups/users/preferences",
+	} {
+		assert.True(t, routes[route], route)
+		method, path, _ := strings.Cut(route, " ")
+		scoped := method + " /groups/:groupId" + path[len("/groups"):]
+		assert.True(t, routes[scoped], scoped)
+	}
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/middleware"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
+	"Groupchat-Service/internal/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type groupSettingsController struct {
+	settingsService services.GroupSettingsService
+	authorizer      middleware.Authorizer
+}
+
+func NewGroupSettingsController(service services.GroupSettingsService, authorizer middleware.Authorizer) GroupSettingsController {
+	return &groupSettingsController{settingsService: service, authorizer: authorizer}
+}
+
+func (c *groupSettingsController) RegisterRoutes(router *gin.Engine) {
+	for _, groups := range groupRouters(router) {
+		groups.GET("/settings", middleware.RequireAction(c.authorizer, policy.ActionSettingsRead), c.GetSettings)
+		groups.PUT("/settings", middleware.RequireAction(c.authorizer, policy.ActionSettingsUpdate), c.UpdateSettings)
+	}
+}
+
+func (c *groupSettingsController) GetSettings(ctx *gin.Context) {
+	groupID, err := getGroupIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	settings, err := c.settingsService.GetSettings(ctx.Request.Context(), groupID)
+	if err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to get group settings")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, settings)
+}
+
+func (c *groupSettingsController) UpdateSettings(ctx *gin.Context) {
+	var request models.GroupSettingsUpdate
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	groupID, err := getGroupIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	settings, err := c.settingsService.UpdateSettings(ctx.Request.Context(), groupID, request)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRetentionDays) || errors.Is(err, services.ErrEndToEndEncryptionPermanent) {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to update group settings")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, settings)
+}
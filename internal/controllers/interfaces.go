@@ -18,6 +18,52 @@ type FCMTokenController interface {
 	DeleteToken(ctx *gin.Context)
 }
 
+type UserPreferencesController interface {
+	RegisterRoutes(router *gin.Engine)
+	GetPreferences(ctx *gin.Context)
+	UpdatePreferences(ctx *gin.Context)
+}
+
+type GroupSettingsController interface {
+	RegisterRoutes(router *gin.Engine)
+	GetSettings(ctx *gin.Context)
+	UpdateSettings(ctx *gin.Context)
+}
+
+type KeyDistributionController interface {
+	RegisterRoutes(router *gin.Engine)
+	PublishBundle(ctx *gin.Context)
+	GetPreKeyBundles(ctx *gin.Context)
+}
+
+type TokenRevocationController interface {
+	RegisterRoutes(router *gin.Engine)
+	Revoke(ctx *gin.Context)
+	ListRevocations(ctx *gin.Context)
+}
+
+type AccessAuditController interface {
+	RegisterRoutes(router *gin.Engine)
+	ListAccesses(ctx *gin.Context)
+}
+
+type PolicyController interface {
+	RegisterRoutes(router *gin.Engine)
+	Explain(ctx *gin.Context)
+}
+
+type DebugController interface {
+	RegisterRoutes(router *gin.Engine)
+	GetNotifications(ctx *gin.Context)
+	ResetNotifications(ctx *gin.Context)
+}
+
+type DigestController interface {
+	RegisterRoutes(router *gin.Engine)
+	ConfirmUnsubscribe(ctx *gin.Context)
+	Unsubscribe(ctx *gin.Context)
+}
+
 type HealthController interface {
 	RegisterRoutes(router *gin.Engine)
 	getHealth(ctx *gin.Context)
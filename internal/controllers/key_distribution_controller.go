@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/middleware"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
+	"Groupchat-Service/internal/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type keyDistributionController struct {
+	keyService services.KeyDistributionService
+	authorizer middleware.Authorizer
+}
+
+func NewKeyDistributionController(service services.KeyDistributionService, authorizer middleware.Authorizer) KeyDistributionController {
+	return &keyDistributionController{keyService: service, authorizer: authorizer}
+}
+
+func (c *keyDistributionController) RegisterRoutes(router *gin.Engine) {
+	for _, groups := range groupRouters(router) {
+		groups.PUT("/keys/bundle", middleware.RequireAction(c.authorizer, policy.ActionKeysPublish), c.PublishBundle)
+		groups.GET("/keys/bundles", middleware.RequireAction(c.authorizer, policy.ActionKeysRead), c.GetPreKeyBundles)
+	}
+}
+
+// PublishBundle stores the identity and pre-keys of the calling device
+func (c *keyDistributionController) PublishBundle(ctx *gin.Context) {
+	var request models.KeyBundleUpload
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	groupID, err := getGroupIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	bundle, err := c.keyService.PublishBundle(ctx.Request.Context(), groupID, userID, request)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidKeyBundle) {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to publish key bundle")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, bundle)
+}
+
+// GetPreKeyBundles returns the pre-key bundles of the other devices in the group. The optional deviceId
+// query parameter names the calling device, which is left out.
+func (c *keyDistributionController) GetPreKeyBundles(ctx *gin.Context) {
+	groupID, err := getGroupIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	bundles, err := c.keyService.GetPreKeyBundles(ctx.Request.Context(), groupID, userID, ctx.Query("deviceId"))
+	if err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to get key bundles")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": bundles})
+}
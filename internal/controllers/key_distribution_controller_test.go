@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/services"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockKeyDistributionService struct {
+	mock.Mock
+}
+
+func (m *mockKeyDistributionService) PublishBundle(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, upload models.KeyBundleUpload) (*models.KeyBundle, error) {
+	args := m.Called(ctx, groupID, userID, upload)
+	return args.Get(0).(*models.KeyBundle), args.Error(1)
+}
+
+func (m *mockKeyDistributionService) GetPreKeyBundles(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, deviceID string) ([]models.PreKeyBundle, error) {
+	args := m.Called(ctx, groupID, userID, deviceID)
+	return args.Get(0).([]models.PreKeyBundle), args.Error(1)
+}
+
+func TestPublishBundle(t *testing.T) {
+	upload := models.KeyBundleUpload{
+		DeviceID:     "phone",
+		IdentityKey:  "identity",
+		SignedPreKey: models.SignedPreKey{KeyID: 1, PublicKey: "signed", Signature: "signature"},
+	}
+
+	t.Run("Publishes the bundle of the calling device", func(t *testing.T) {
+		mockService := new(mockKeyDistributionService)
+		controller := NewKeyDistributionController(mockService, nil)
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		groupID := uuid.New()
+		userID := uuid.New()
+		ctx.Set("groupID", groupID.String())
+		ctx.Set("userID", userID.String())
+		body, _ := json.Marshal(upload)
+		ctx.Request = httptest.NewRequest("PUT", "/", bytes.NewBuffer(body))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+
+		mockService.On("PublishBundle", mock.Anything, groupID, userID, upload).
+			Return(&models.KeyBundle{GroupID: groupID, UserID: userID, DeviceID: "phone"}, nil)
+
+		controller.PublishBundle(ctx)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Invalid bundle", func(t *testing.T) {
+		mockService := new(mockKeyDistributionService)
+		controller := NewKeyDistributionController(mockService, nil)
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		ctx.Set("groupID", uuid.New().String())
+		ctx.Set("userID", uuid.New().String())
+		body, _ := json.Marshal(upload)
+		ctx.Request = httptest.NewRequest("PUT", "/", bytes.NewBuffer(body))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+
+		mockService.On("PublishBundle", mock.Anything, mock.Anything, mock.Anything, upload).
+			Return((*models.KeyBundle)(nil), fmt.Errorf("%w: identityKey is too long", services.ErrInvalidKeyBundle))
+
+		controller.PublishBundle(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Missing device ID", func(t *testing.T) {
+		controller := NewKeyDistributionController(new(mockKeyDistributionService), nil)
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		ctx.Request = httptest.NewRequest("PUT", "/", bytes.NewBufferString(`{"identityKey": "identity"}`))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+
+		controller.PublishBundle(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestGetPreKeyBundles(t *testing.T) {
+	mockService := new(mockKeyDistributionService)
+	controller := NewKeyDistributionController(mockService, nil)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	groupID := uuid.New()
+	userID := uuid.New()
+	ctx.Set("groupID", groupID.String())
+	ctx.Set("userID", userID.String())
+	ctx.Request = httptest.NewRequest("GET", "/?deviceId=phone", nil)
+
+	bundles := []models.PreKeyBundle{{UserID: uuid.New(), DeviceID: "laptop", OneTimePreKey: &models.PreKey{KeyID: 7, PublicKey: "one-time"}}}
+	mockService.On("GetPreKeyBundles", mock.Anything, groupID, userID, "phone").Return(bundles, nil)
+
+	controller.GetPreKeyBundles(ctx)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Data []models.PreKeyBundle `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, bundles, response.Data)
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/middleware"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"slices"
+)
+
+type policyController struct {
+	policy *policy.Policy
+}
+
+// NewPolicyController explains the decisions of the access policy. It is only registered with DEBUG enabled, as
+// the explanations reveal who sent a message and how a group is set up.
+func NewPolicyController(p *policy.Policy) PolicyController {
+	return &policyController{policy: p}
+}
+
+func (c *policyController) RegisterRoutes(router *gin.Engine) {
+	router.GET("/debug/policy/explain", c.Explain)
+}
+
+// Explain shows, rule by rule, whether the caller may perform an action, or every action when none is given.
+// The role and message to decide for can be overridden with the role and messageId query parameters.
+func (c *policyController) Explain(ctx *gin.Context) {
+	request, err := middleware.PolicyRequest(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if role := ctx.Query("role"); role != "" {
+		parsed, err := models.ParseRole(role)
+		if err != nil {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+		request.Role = parsed
+	}
+	if messageID := ctx.Query("messageId"); messageID != "" {
+		parsed, err := uuid.Parse(messageID)
+		if err != nil {
+			respondWithError(ctx, http.StatusBadRequest, "Invalid message ID")
+			return
+		}
+		request.MessageID = parsed
+	}
+
+	actions := policy.Actions
+	if action := policy.Action(ctx.Query("action")); action != "" {
+		if !slices.Contains(policy.Actions, action) {
+			respondWithError(ctx, http.StatusBadRequest, "Unknown action")
+			return
+		}
+		actions = []policy.Action{action}
+	}
+
+	explanations := make([]*policy.Explanation, 0, len(actions))
+	for _, action := range actions {
+		explanation, err := c.policy.Explain(ctx.Request.Context(), action, request)
+		if err != nil {
+			respondWithError(ctx, http.StatusInternalServerError, "Failed to explain policy")
+			return
+		}
+		explanations = append(explanations, explanation)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": explanations})
+}
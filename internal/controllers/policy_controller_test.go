@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type stubPolicyResources struct{}
+
+func (stubPolicyResources) MessageSender(context.Context, uuid.UUID, uuid.UUID) (uuid.UUID, error) {
+	return uuid.Nil, nil
+}
+
+func (stubPolicyResources) GroupSettings(_ context.Context, groupID uuid.UUID) (*models.GroupSettings, error) {
+	return &models.GroupSettings{GroupID: groupID}, nil
+}
+
+func TestExplainPolicy(t *testing.T) {
+	p, err := policy.Load("", stubPolicyResources{})
+	require.NoError(t, err)
+	controller := NewPolicyController(p)
+
+	explain := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Set("claims", jwt.MapClaims{"role": string(models.RoleFamilyMember)})
+		ctx.Set("userID", uuid.NewString())
+		ctx.Set("groupID", uuid.NewString())
+		ctx.Request = httptest.NewRequest("GET", "/debug/policy/explain?"+query, nil)
+		controller.Explain(ctx)
+		return w
+	}
+
+	t.Run("Explains one action for the caller", func(t *testing.T) {
+		w := explain("action=settings.update")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data []policy.Explanation `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Data, 1)
+		assert.Equal(t, models.RoleFamilyMember, response.Data[0].Role)
+		assert.False(t, response.Data[0].Allowed)
+	})
+
+	t.Run("Explains every action for another role", func(t *testing.T) {
+		w := explain("role=primary_caregiver")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data []policy.Explanation `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Len(t, response.Data, len(policy.Actions))
+		assert.Equal(t, models.RolePrimaryCaregiver, response.Data[0].Role)
+	})
+
+	t.Run("Refuses unknown actions", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, explain("action=message.edit").Code)
+	})
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/middleware"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
+	"Groupchat-Service/internal/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type tokenRevocationController struct {
+	revocationService services.TokenRevocationService
+	authorizer        middleware.Authorizer
+}
+
+func NewTokenRevocationController(service services.TokenRevocationService, authorizer middleware.Authorizer) TokenRevocationController {
+	return &tokenRevocationController{revocationService: service, authorizer: authorizer}
+}
+
+func (c *tokenRevocationController) RegisterRoutes(router *gin.Engine) {
+	router.GET("/admin/revocations", middleware.RequireAction(c.authorizer, policy.ActionRevocationRead), c.ListRevocations)
+	router.POST("/admin/revocations", middleware.RequireAction(c.authorizer, policy.ActionRevocationCreate), c.Revoke)
+}
+
+// Revoke denies an access token by its jti, or every token of a login session by its sid
+func (c *tokenRevocationController) Revoke(ctx *gin.Context) {
+	var request models.TokenRevocationCreate
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	revocation, err := c.revocationService.Revoke(ctx.Request.Context(), userID.String(), request)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRevocation) {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to revoke token")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, revocation)
+}
+
+func (c *tokenRevocationController) ListRevocations(ctx *gin.Context) {
+	revocations, err := c.revocationService.ListRevocations(ctx.Request.Context())
+	if err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to list revocations")
+		return
+	}
+	if revocations == nil {
+		revocations = []models.TokenRevocation{}
+	}
+
+	ctx.JSON(http.StatusOK, revocations)
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/services"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockTokenRevocationService struct {
+	mock.Mock
+}
+
+func (m *mockTokenRevocationService) Revoke(ctx context.Context, revokedBy string, create models.TokenRevocationCreate) (*models.TokenRevocation, error) {
+	args := m.Called(ctx, revokedBy, create)
+	return args.Get(0).(*models.TokenRevocation), args.Error(1)
+}
+
+func (m *mockTokenRevocationService) ListRevocations(ctx context.Context) ([]models.TokenRevocation, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]models.TokenRevocation), args.Error(1)
+}
+
+func (m *mockTokenRevocationService) IsRevoked(tokenID string, sessionID string) bool {
+	return m.Called(tokenID, sessionID).Bool(0)
+}
+
+func (m *mockTokenRevocationService) Refresh(ctx context.Context) error {
+	return m.Called(ctx).Error(0)
+}
+
+func TestRevoke(t *testing.T) {
+	t.Run("Revokes a session on behalf of the admin", func(t *testing.T) {
+		mockService := new(mockTokenRevocationService)
+		controller := NewTokenRevocationController(mockService, nil)
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		adminID := uuid.New()
+		ctx.Set("userID", adminID.String())
+		ctx.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"sid":"session-1","reason":"lost phone"}`))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+
+		create := models.TokenRevocationCreate{SessionID: "session-1", Reason: "lost phone"}
+		mockService.On("Revoke", mock.Anything, adminID.String(), create).
+			Return(&models.TokenRevocation{Kind: models.RevokeSession, ID: "session-1"}, nil)
+
+		controller.Revoke(ctx)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Invalid revocation", func(t *testing.T) {
+		mockService := new(mockTokenRevocationService)
+		controller := NewTokenRevocationController(mockService, nil)
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+
+		ctx.Set("userID", uuid.New().String())
+		ctx.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(`{}`))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+
+		mockService.On("Revoke", mock.Anything, mock.Anything, models.TokenRevocationCreate{}).
+			Return((*models.TokenRevocation)(nil), fmt.Errorf("%w: set either jti or sid", services.ErrInvalidRevocation))
+
+		controller.Revoke(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
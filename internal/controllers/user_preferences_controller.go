@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/middleware"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
+	"Groupchat-Service/internal/services"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type userPreferencesController struct {
+	preferencesService services.UserPreferencesService
+	validationService  services.ValidationService
+	authorizer         middleware.Authorizer
+}
+
+func NewUserPreferencesController(service services.UserPreferencesService, validationService services.ValidationService, authorizer middleware.Authorizer) UserPreferencesController {
+	return &userPreferencesController{preferencesService: service, validationService: validationService, authorizer: authorizer}
+}
+
+func (c *userPreferencesController) RegisterRoutes(router *gin.Engine) {
+	for _, groups := range groupRouters(router) {
+		groups.GET("/users/preferences", middleware.RequireAction(c.authorizer, policy.ActionPreferencesRead), c.GetPreferences)
+		groups.PUT("/users/preferences", middleware.RequireAction(c.authorizer, policy.ActionPreferencesUpdate), c.UpdatePreferences)
+	}
+}
+
+func (c *userPreferencesController) GetPreferences(ctx *gin.Context) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	preferences, err := c.preferencesService.GetPreferences(ctx.Request.Context(), userID)
+	if err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to get preferences")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, preferences)
+}
+
+func (c *userPreferencesController) UpdatePreferences(ctx *gin.Context) {
+	var request models.UserPreferencesUpdate
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	groupID, err := getGroupIDFromContext(ctx)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if request.Locale != nil {
+		if err := c.validationService.ValidateLocale(*request.Locale); err != nil {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	email := ctx.GetString("email")
+	if request.EmailDigest != nil && *request.EmailDigest && email != "" {
+		if err := c.validationService.ValidateEmail(email); err != nil {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	preferences, err := c.preferencesService.UpdatePreferences(ctx.Request.Context(), userID, groupID, email, request)
+	if err != nil {
+		if errors.Is(err, services.ErrEmailRequired) {
+			respondWithError(ctx, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondWithError(ctx, http.StatusInternalServerError, "Failed to update preferences")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, preferences)
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type stubUserPreferencesService struct {
+	updated bool
+}
+
+func (s *stubUserPreferencesService) GetPreferences(_ context.Context, userID uuid.UUID) (*models.UserPreferences, error) {
+	return &models.UserPreferences{UserID: userID}, nil
+}
+
+func (s *stubUserPreferencesService) UpdatePreferences(_ context.Context, userID uuid.UUID, _ uuid.UUID, _ string, _ models.UserPreferencesUpdate) (*models.UserPreferences, error) {
+	s.updated = true
+	return &models.UserPreferences{UserID: userID}, nil
+}
+
+func TestPreferencesRequireGroupRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p, err := policy.Load("", stubPolicyResources{})
+	require.NoError(t, err)
+
+	serve := func(role models.Role, method string, service *stubUserPreferencesService) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("claims", jwt.MapClaims{"role": string(role)})
+			c.Set("userID", uuid.NewString())
+			c.Set("groupID", uuid.NewString())
+		})
+		NewUserPreferencesController(service, nil, p).RegisterRoutes(router)
+
+		w := httptest.NewRecorder()
+		request := httptest.NewRequest(method, "/groups/users/preferences", strings.NewReader(`{"privateNotifications": true}`))
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	service := &stubUserPreferencesService{}
+	assert.Equal(t, http.StatusForbidden, serve(models.RoleAdmin, http.MethodGet, service).Code)
+	assert.Equal(t, http.StatusForbidden, serve(models.RoleAdmin, http.MethodPut, service).Code)
+	assert.False(t, service.updated, "admins have no preferences in a group")
+
+	assert.Equal(t, http.StatusOK, serve(models.RoleFamilyMember, http.MethodGet, service).Code)
+	assert.Equal(t, http.StatusOK, serve(models.RoleFamilyMember, http.MethodPut, service).Code)
+	assert.True(t, service.updated)
+}
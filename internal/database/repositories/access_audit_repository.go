@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/google/uuid"
+	"math"
+	"strings"
+	"time"
+)
+
+type accessAuditRepository struct {
+	table *aztables.Client
+}
+
+// AccessAuditEntity is one audited request. RowKeys hold an inverted timestamp, so a group lists newest first.
+type AccessAuditEntity struct {
+	PartitionKey  string `json:"PartitionKey"` // GroupID
+	RowKey        string `json:"RowKey"`       // inverted AccessedAt + "_" + ID
+	ID            string `json:"ID"`
+	UserID        string `json:"UserID"`
+	Role          string `json:"Role"`
+	Method        string `json:"Method"`
+	Route         string `json:"Route"`
+	MessageID     string `json:"MessageID,omitempty"`
+	Status        int    `json:"Status"`
+	AccessedAt    string `json:"AccessedAt"`
+	SchemaVersion int    `json:"SchemaVersion"`
+}
+
+func NewAccessAuditRepository(client *TableService) (AccessAuditRepository, error) {
+	table := client.NewClient(AccessAuditsTable)
+
+	_, err := table.CreateTable(context.Background(), nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "TableAlreadyExists") {
+			return &accessAuditRepository{table: table}, nil
+		}
+		return nil, fmt.Errorf("failed to create/verify table: %w", err)
+	}
+
+	return &accessAuditRepository{table: table}, nil
+}
+
+func (r *accessAuditRepository) RecordAccess(ctx context.Context, audit *models.AccessAudit) error {
+	entity := AccessAuditEntity{
+		PartitionKey:  audit.GroupID.String(),
+		RowKey:        fmt.Sprintf("%019d_%s", math.MaxInt64-audit.AccessedAt.UnixNano(), audit.ID.String()),
+		ID:            audit.ID.String(),
+		UserID:        audit.UserID.String(),
+		Role:          string(audit.Role),
+		Method:        audit.Method,
+		Route:         audit.Route,
+		Status:        audit.Status,
+		AccessedAt:    audit.AccessedAt.UTC().Format(time.RFC3339Nano),
+		SchemaVersion: accessAuditSchemaVersion,
+	}
+	if audit.MessageID != nil {
+		entity.MessageID = audit.MessageID.String()
+	}
+
+	marshaled, err := json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entity: %w", err)
+	}
+
+	if _, err := r.table.AddEntity(ctx, marshaled, nil); err != nil {
+		return fmt.Errorf("failed to record access: %w", err)
+	}
+	return nil
+}
+
+// ListAccesses returns the access records of a group, newest first
+func (r *accessAuditRepository) ListAccesses(ctx context.Context, groupID uuid.UUID) ([]models.AccessAudit, error) {
+	filter := fmt.Sprintf("PartitionKey eq '%s'", groupID.String())
+	return r.listAccesses(ctx, &filter)
+}
+
+// ListAllAccesses returns the access records of every group
+func (r *accessAuditRepository) ListAllAccesses(ctx context.Context) ([]models.AccessAudit, error) {
+	return r.listAccesses(ctx, nil)
+}
+
+func (r *accessAuditRepository) listAccesses(ctx context.Context, filter *string) ([]models.AccessAudit, error) {
+	pager := r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: filter,
+	})
+
+	var audits []models.AccessAudit
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list accesses: %w", err)
+		}
+
+		for _, raw := range page.Entities {
+			var entity AccessAuditEntity
+			if err := json.Unmarshal(raw, &entity); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal access audit: %w", err)
+			}
+			audit, err := entity.toAudit()
+			if err != nil {
+				return nil, err
+			}
+			audits = append(audits, *audit)
+		}
+	}
+
+	return audits, nil
+}
+
+func (e *AccessAuditEntity) toAudit() (*models.AccessAudit, error) {
+	groupID, err := uuid.Parse(e.PartitionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse group ID: %w", err)
+	}
+	id, err := uuid.Parse(e.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse access audit ID: %w", err)
+	}
+	userID, err := uuid.Parse(e.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse audited user ID: %w", err)
+	}
+	accessedAt, err := time.Parse(time.RFC3339Nano, e.AccessedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse access time: %w", err)
+	}
+
+	audit := &models.AccessAudit{
+		ID:         id,
+		GroupID:    groupID,
+		UserID:     userID,
+		Role:       models.Role(e.Role),
+		Method:     e.Method,
+		Route:      e.Route,
+		Status:     e.Status,
+		AccessedAt: accessedAt,
+	}
+	if e.MessageID != "" {
+		messageID, err := uuid.Parse(e.MessageID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse audited message ID: %w", err)
+		}
+		audit.MessageID = &messageID
+	}
+	return audit, nil
+}
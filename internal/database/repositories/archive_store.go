@@ -0,0 +1,164 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/blobstore"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveStore keeps the archive objects of the message archive by name
+type ArchiveStore interface {
+	// ReadArchive returns the content of an object, or an error wrapping ErrNotFound
+	ReadArchive(ctx context.Context, name string) ([]byte, error)
+	WriteArchive(ctx context.Context, name string, data []byte, contentType string) error
+	// DeleteArchive removes an object; removing an object that does not exist is not an error
+	DeleteArchive(ctx context.Context, name string) error
+	// ListArchives returns the names of the objects that start with prefix
+	ListArchives(ctx context.Context, prefix string) ([]string, error)
+}
+
+type blobArchiveStore struct {
+	client *blobstore.Client
+}
+
+// NewBlobArchiveStore keeps the archive in an Azure Blob Storage container, creating it when missing
+func NewBlobArchiveStore(client *blobstore.Client) (ArchiveStore, error) {
+	if err := client.CreateContainer(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to create/verify container: %w", err)
+	}
+	return &blobArchiveStore{client: client}, nil
+}
+
+func (s *blobArchiveStore) ReadArchive(ctx context.Context, name string) ([]byte, error) {
+	data, err := s.client.GetBlob(ctx, name)
+	if errors.Is(err, blobstore.ErrBlobNotFound) {
+		return nil, fmt.Errorf("archive %s: %w", name, ErrNotFound)
+	}
+	return data, err
+}
+
+func (s *blobArchiveStore) WriteArchive(ctx context.Context, name string, data []byte, contentType string) error {
+	return s.client.PutBlob(ctx, name, data, contentType)
+}
+
+func (s *blobArchiveStore) DeleteArchive(ctx context.Context, name string) error {
+	return s.client.DeleteBlob(ctx, name)
+}
+
+func (s *blobArchiveStore) ListArchives(ctx context.Context, prefix string) ([]string, error) {
+	return s.client.ListBlobs(ctx, prefix)
+}
+
+type fileArchiveStore struct {
+	dir string
+}
+
+// NewFileArchiveStore keeps the archive in a local directory, for development without blob storage
+func NewFileArchiveStore(dir string) ArchiveStore {
+	return &fileArchiveStore{dir: dir}
+}
+
+func (s *fileArchiveStore) ReadArchive(_ context.Context, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("archive %s: %w", name, ErrNotFound)
+	}
+	return data, err
+}
+
+// WriteArchive replaces the file atomically, so readers never see a partially written archive
+func (s *fileArchiveStore) WriteArchive(_ context.Context, name string, data []byte, _ string) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write archive %s: %w", name, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write archive %s: %w", name, err)
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+func (s *fileArchiveStore) DeleteArchive(_ context.Context, name string) error {
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ListArchives walks the directory; the temporary files of writes in progress are not listed
+func (s *fileArchiveStore) ListArchives(_ context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(s.dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".archive-") {
+			return nil
+		}
+		relative, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(relative); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archive directory: %w", err)
+	}
+	return names, nil
+}
+
+type prefixedArchiveStore struct {
+	store  ArchiveStore
+	prefix string
+}
+
+// NewPrefixedArchiveStore keeps the objects of store under "<prefix>/", so tenants can share a container or
+// directory without sharing archives
+func NewPrefixedArchiveStore(store ArchiveStore, prefix string) ArchiveStore {
+	return &prefixedArchiveStore{store: store, prefix: prefix + "/"}
+}
+
+func (s *prefixedArchiveStore) ReadArchive(ctx context.Context, name string) ([]byte, error) {
+	return s.store.ReadArchive(ctx, s.prefix+name)
+}
+
+func (s *prefixedArchiveStore) WriteArchive(ctx context.Context, name string, data []byte, contentType string) error {
+	return s.store.WriteArchive(ctx, s.prefix+name, data, contentType)
+}
+
+func (s *prefixedArchiveStore) DeleteArchive(ctx context.Context, name string) error {
+	return s.store.DeleteArchive(ctx, s.prefix+name)
+}
+
+func (s *prefixedArchiveStore) ListArchives(ctx context.Context, prefix string) ([]string, error) {
+	names, err := s.store.ListArchives(ctx, s.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		names[i] = strings.TrimPrefix(name, s.prefix)
+	}
+	return names, nil
+}
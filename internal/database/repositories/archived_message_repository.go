@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"slices"
+)
+
+// archivedMessageRepository continues a group's timeline in the message archive where the hot messages end,
+// so clients page through one history. Searches, single-message reads and mutations only see hot messages.
+type archivedMessageRepository struct {
+	MessageRepository
+	archive *MessageArchive
+}
+
+func NewArchivedMessageRepository(inner MessageRepository, archive *MessageArchive) MessageRepository {
+	return &archivedMessageRepository{MessageRepository: inner, archive: archive}
+}
+
+func (r *archivedMessageRepository) GetMessages(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error) {
+	manifest, err := r.archive.Manifest(ctx, groupID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read message archive: %w", err)
+	}
+	if manifest == nil || manifest.NewestMessageID == uuid.Nil {
+		return r.MessageRepository.GetMessages(ctx, groupID, query)
+	}
+
+	hasCursor := query.Position != nil
+	previous := hasCursor && query.Direction == models.Previous
+	if hasCursor && manifest.Covers(*query.Position) {
+		if previous {
+			return r.previousFromArchive(ctx, groupID, manifest, query)
+		}
+		older, err := r.archive.Older(ctx, groupID, manifest, query.Position, query.PageSize+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		hasMore := len(older) > query.PageSize
+		if hasMore {
+			older = older[:query.PageSize]
+		}
+		return older, keysetPagination(older, true, false, hasMore), nil
+	}
+
+	messages, pagination, err := r.MessageRepository.GetMessages(ctx, groupID, query)
+	if err != nil || previous {
+		return messages, pagination, err
+	}
+
+	// Hot messages the archive covers are left over from an interrupted archive run
+	kept := messages
+	if index := slices.IndexFunc(messages, func(message models.Message) bool {
+		return manifest.Covers(models.MessageCursor{SentAt: message.SentAt, MessageID: message.ID})
+	}); index >= 0 {
+		kept = messages[:index]
+	} else if pagination.HasNext {
+		return messages, pagination, nil
+	}
+
+	// The hot messages end within this page, which continues with the archive
+	from := query.Position
+	if len(kept) > 0 {
+		last := kept[len(kept)-1]
+		from = &models.MessageCursor{SentAt: last.SentAt, MessageID: last.ID}
+	}
+	remaining := query.PageSize - len(kept)
+	older, err := r.archive.Older(ctx, groupID, manifest, from, remaining+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	hasMore := len(older) > remaining
+	if hasMore {
+		older = older[:remaining]
+	}
+
+	page := slices.Concat(kept, older)
+	return page, keysetPagination(page, hasCursor, false, hasMore), nil
+}
+
+// previousFromArchive pages towards newer messages from a cursor in the archive, continuing with the oldest
+// hot messages once the archived ones run out
+func (r *archivedMessageRepository) previousFromArchive(ctx context.Context, groupID uuid.UUID, manifest *ArchiveManifest, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error) {
+	newer, err := r.archive.Newer(ctx, groupID, manifest, *query.Position, query.PageSize+1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var hot []models.Message
+	hasMore := len(newer) > query.PageSize
+	if hasMore {
+		newer = newer[:query.PageSize]
+	} else {
+		// Ask for at least one hot message to find out whether there are newer messages at all
+		remaining := query.PageSize - len(newer)
+		hotMessages, hotPagination, err := r.MessageRepository.GetMessages(ctx, groupID, models.PaginationQuery{
+			PageSize:  max(remaining, 1),
+			Direction: models.Previous,
+			Position:  &models.MessageCursor{SentAt: manifest.NewestSentAt, MessageID: manifest.NewestMessageID},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if remaining == 0 {
+			hasMore = len(hotMessages) > 0
+		} else {
+			hot = hotMessages
+			hasMore = hotPagination.HasPrevious
+		}
+	}
+
+	// newer is ordered closest to the cursor first; pages are newest first
+	slices.Reverse(newer)
+	page := slices.Concat(hot, newer)
+	return page, keysetPagination(page, true, true, hasMore), nil
+}
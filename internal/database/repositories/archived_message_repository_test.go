@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchivedMessageRepository(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 20, 12, 0, 0, 0, time.UTC)
+
+	// setup stores 12 messages 10 days apart, spanning four months, in a reference repository and in a hot
+	// repository with an archive. archive moves the 7 oldest to the archive the way an archive run does.
+	type stage int
+	const (
+		copied    stage = iota // archived but not yet published
+		published              // published but not yet deleted from the hot store
+		moved                  // deleted from the hot store
+	)
+	setup := func(t *testing.T, until stage) (reference MessageRepository, archived MessageRepository, groupID uuid.UUID, messages []models.Message) {
+		reference = NewMemoryMessageRepository()
+		hot := NewMemoryMessageRepository()
+		archive := NewMessageArchive(NewFileArchiveStore(t.TempDir()))
+		groupID = uuid.New()
+		for i := 0; i < 12; i++ {
+			message := newTestMessage(t, reference, groupID, start.Add(time.Duration(i)*10*24*time.Hour), "bericht")
+			require.NoError(t, hot.CreateMessage(ctx, groupID, &message))
+			messages = append(messages, message)
+		}
+
+		old := messages[:7]
+		require.NoError(t, archive.AddMessages(ctx, groupID, old[4:]))
+		require.NoError(t, archive.AddMessages(ctx, groupID, old[:4]))
+		if until >= published {
+			require.NoError(t, archive.AdvanceWatermark(ctx, groupID, old[6]))
+		}
+		if until >= moved {
+			require.NoError(t, hot.DeleteMessages(ctx, groupID, old))
+		}
+		return reference, NewArchivedMessageRepository(hot, archive), groupID, messages
+	}
+
+	for _, until := range []stage{copied, published, moved} {
+		t.Run([]string{"copied", "published", "moved"}[until], func(t *testing.T) {
+			reference, archived, groupID, messages := setup(t, until)
+
+			var queries []models.PaginationQuery
+			for size := 1; size <= 13; size++ {
+				queries = append(queries, models.PaginationQuery{PageSize: size, Direction: models.Next})
+				for _, message := range messages {
+					for _, direction := range []models.Direction{models.Next, models.Previous} {
+						queries = append(queries, models.PaginationQuery{PageSize: size, Direction: direction, Position: positionOf(message)})
+					}
+				}
+			}
+
+			for _, query := range queries {
+				expected, expectedPagination, err := reference.GetMessages(ctx, groupID, query)
+				require.NoError(t, err)
+				actual, actualPagination, err := archived.GetMessages(ctx, groupID, query)
+				require.NoError(t, err)
+				assert.Equal(t, messageIDs(expected), messageIDs(actual), "query %+v", query)
+				assert.Equal(t, expectedPagination, actualPagination, "query %+v", query)
+			}
+		})
+	}
+
+	t.Run("Archived messages keep their content", func(t *testing.T) {
+		_, archived, groupID, messages := setup(t, moved)
+
+		page, _, err := archived.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 1, Direction: models.Next, Position: positionOf(messages[1])})
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, messages[0].ID, page[0].ID)
+		assert.Equal(t, messages[0].Content, page[0].Content)
+		assert.Equal(t, messages[0].SenderName, page[0].SenderName)
+		assert.True(t, messages[0].SentAt.Equal(page[0].SentAt))
+		assert.Empty(t, page[0].ETag, "archived messages cannot be updated")
+	})
+
+	t.Run("Groups without an archive read the hot store", func(t *testing.T) {
+		hot := NewMemoryMessageRepository()
+		archived := NewArchivedMessageRepository(hot, NewMessageArchive(NewFileArchiveStore(t.TempDir())))
+		groupID := uuid.New()
+		message := newTestMessage(t, hot, groupID, start, "bericht")
+
+		page, pagination, err := archived.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 5, Direction: models.Next})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{message.ID}, messageIDs(page))
+		assert.False(t, pagination.HasNext)
+	})
+}
+
+func TestMessageArchiveGroupIDs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	archive := NewMessageArchive(NewPrefixedArchiveStore(NewFileArchiveStore(dir), "clinic-a"))
+	other := NewMessageArchive(NewPrefixedArchiveStore(NewFileArchiveStore(dir), "clinic-b"))
+
+	groupIDs, err := archive.GroupIDs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, groupIDs, "a missing archive lists no groups")
+
+	groupID := uuid.New()
+	message := models.Message{ID: uuid.New(), GroupID: groupID, Content: "bericht", SentAt: time.Now().UTC()}
+	require.NoError(t, archive.AddMessages(ctx, groupID, []models.Message{message}))
+	require.NoError(t, other.AddMessages(ctx, uuid.New(), []models.Message{message}))
+
+	groupIDs, err = archive.GroupIDs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{groupID}, groupIDs, "tenants only list their own groups")
+}
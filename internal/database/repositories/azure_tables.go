@@ -1,22 +1,72 @@
 package repositories
 
 import (
+	"errors"
 	"fmt"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"strings"
 )
 
 // TableNames defines constant names for our Azure tables
 const (
-	FCMTokensTable = "FCMTokens"
-	MessagesTable  = "Messages"
+	FCMTokensTable       = "FCMTokens"
+	MessagesTable        = "Messages"
+	UserPreferencesTable = "UserPreferences"
+	GroupSettingsTable   = "GroupSettings"
+	PurgeAuditsTable     = "PurgeAudits"
+	GroupKeysTable       = "GroupKeys"
+	KeyBundlesTable      = "KeyBundles"
+	RevocationsTable     = "TokenRevocations"
+	AccessAuditsTable    = "AccessAudits"
 	// Using uppercase because Azure Table names must start with a letter and can only contain alphanumeric characters
 )
 
+// TableService opens the tables of one storage account. With a prefix every table name is prefixed, so
+// several tenants can share an account without sharing tables.
+type TableService struct {
+	client *aztables.ServiceClient
+	prefix string
+}
+
 // NewTableClient creates a new Azure Table client with the given connection string
-func NewTableClient(connectionString string) (*aztables.ServiceClient, error) {
+func NewTableClient(connectionString string) (*TableService, error) {
 	client, err := aztables.NewServiceClientFromConnectionString(connectionString, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create table client: %w", err)
 	}
-	return client, nil
+	return &TableService{client: client}, nil
+}
+
+// WithPrefix returns a service on the same account whose table names start with prefix
+func (s *TableService) WithPrefix(prefix string) *TableService {
+	return &TableService{client: s.client, prefix: prefix}
+}
+
+// NewClient returns the client of the named table
+func (s *TableService) NewClient(tableName string) *aztables.Client {
+	return s.client.NewClient(s.prefix + tableName)
+}
+
+// ErrNotFound is returned when a requested entity does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when a conditional update finds that the entity changed since it was read
+var ErrConflict = errors.New("conflict")
+
+// maxUpdateAttempts bounds how often an update that lost a race with another writer is retried
+const maxUpdateAttempts = 5
+
+// isNotFound reports whether an Azure Table error means the entity does not exist
+func isNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "ResourceNotFound")
+}
+
+// isAlreadyExists reports whether an Azure Table error means an entity with the same keys exists
+func isAlreadyExists(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "EntityAlreadyExists")
+}
+
+// isConditionNotSatisfied reports whether an Azure Table error means the If-Match ETag no longer matched
+func isConditionNotSatisfied(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UpdateConditionNotSatisfied")
 }
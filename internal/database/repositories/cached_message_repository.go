@@ -0,0 +1,189 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/util"
+	"context"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"slices"
+	"time"
+)
+
+var (
+	messageCacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "message_cache_requests_total",
+			Help: "Total number of message reads by cache result (hit or miss)",
+		},
+		[]string{"result"},
+	)
+
+	messageCacheInvalidationsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "message_cache_invalidations_total",
+			Help: "Total number of group message cache invalidations",
+		},
+	)
+)
+
+// cachedMessageRepository serves the newest messages of a group from a MessageCache and reads everything
+// else from the wrapped repository. Every mutation invalidates the group.
+type cachedMessageRepository struct {
+	MessageRepository
+	cache      MessageCache
+	recentSize int
+	logger     util.Logger
+}
+
+// NewCachedMessageRepository caches the recentSize newest messages of each group read through inner. The first
+// page of a group and pages whose cursor lies within the cached messages are served from the cache.
+func NewCachedMessageRepository(inner MessageRepository, cache MessageCache, recentSize int, loggerFactory util.LoggerFactory) MessageRepository {
+	return &cachedMessageRepository{
+		MessageRepository: inner,
+		cache:             cache,
+		recentSize:        recentSize,
+		logger:            loggerFactory.NewLogger("CachedMessageRepository"),
+	}
+}
+
+func (r *cachedMessageRepository) GetMessages(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error) {
+	recent := r.getRecent(ctx, groupID)
+	result := "hit"
+	if recent == nil && query.Position == nil && query.PageSize <= r.recentSize {
+		// Only first pages fill the cache; older pages rarely become first pages again
+		result = "miss"
+		var err error
+		if recent, err = r.fill(ctx, groupID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if recent != nil {
+		if messages, pagination, ok := pageFromRecent(recent, query); ok {
+			messageCacheRequestsTotal.WithLabelValues(result).Inc()
+			return messages, pagination, nil
+		}
+	}
+
+	messageCacheRequestsTotal.WithLabelValues("miss").Inc()
+	return r.MessageRepository.GetMessages(ctx, groupID, query)
+}
+
+func (r *cachedMessageRepository) GetMessageByID(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error) {
+	if recent := r.getRecent(ctx, groupID); recent != nil {
+		if index := slices.IndexFunc(recent.Messages, func(message models.Message) bool { return message.ID == messageID }); index >= 0 {
+			messageCacheRequestsTotal.WithLabelValues("hit").Inc()
+			message := recent.Messages[index]
+			return &message, nil
+		}
+	}
+
+	messageCacheRequestsTotal.WithLabelValues("miss").Inc()
+	return r.MessageRepository.GetMessageByID(ctx, groupID, messageID)
+}
+
+func (r *cachedMessageRepository) CreateMessage(ctx context.Context, groupID uuid.UUID, message *models.Message) error {
+	defer r.invalidate(ctx, groupID)
+	return r.MessageRepository.CreateMessage(ctx, groupID, message)
+}
+
+func (r *cachedMessageRepository) ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID, ifMatch string) (*models.Message, error) {
+	defer r.invalidate(ctx, groupID)
+	return r.MessageRepository.ToggleMessagePin(ctx, groupID, messageID, ifMatch)
+}
+
+func (r *cachedMessageRepository) DeleteMessages(ctx context.Context, groupID uuid.UUID, messages []models.Message) error {
+	defer r.invalidate(ctx, groupID)
+	return r.MessageRepository.DeleteMessages(ctx, groupID, messages)
+}
+
+// getRecent returns the cached messages of a group, treating cache errors as misses
+func (r *cachedMessageRepository) getRecent(ctx context.Context, groupID uuid.UUID) *RecentMessages {
+	recent, err := r.cache.GetRecent(ctx, groupID)
+	if err != nil {
+		r.logger.WithContext(ctx).Error("Failed to read message cache", "groupId", groupID, "error", err)
+		return nil
+	}
+	return recent
+}
+
+// fill reads the newest messages of a group and caches them unless the group was invalidated meanwhile
+func (r *cachedMessageRepository) fill(ctx context.Context, groupID uuid.UUID) (*RecentMessages, error) {
+	generation, err := r.cache.Generation(ctx, groupID)
+	cacheable := err == nil
+	if err != nil {
+		r.logger.WithContext(ctx).Error("Failed to read message cache generation", "groupId", groupID, "error", err)
+	}
+
+	messages, pagination, err := r.MessageRepository.GetMessages(ctx, groupID, models.PaginationQuery{
+		PageSize:  r.recentSize,
+		Direction: models.Next,
+	})
+	if err != nil {
+		return nil, err
+	}
+	recent := &RecentMessages{Messages: messages, HasOlder: pagination.HasNext}
+
+	if cacheable {
+		if err := r.cache.SetRecent(ctx, groupID, generation, recent); err != nil {
+			r.logger.WithContext(ctx).Error("Failed to write message cache", "groupId", groupID, "error", err)
+		}
+	}
+	return recent, nil
+}
+
+// invalidate drops the cached messages of a group. It runs after mutations, including failed ones, which
+// may still have changed the stored messages.
+func (r *cachedMessageRepository) invalidate(ctx context.Context, groupID uuid.UUID) {
+	messageCacheInvalidationsTotal.Inc()
+
+	// Invalidate even when the request was cancelled: a stale entry would outlive the request
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := r.cache.Invalidate(ctx, groupID); err != nil {
+		r.logger.WithContext(ctx).Error("Failed to invalidate message cache", "groupId", groupID, "error", err)
+	}
+}
+
+// pageFromRecent builds a page from the cached messages with the keyset semantics of the backends. It reports
+// false when the page reaches past the cached messages or its cursor is not among them.
+func pageFromRecent(recent *RecentMessages, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, bool) {
+	messages := recent.Messages
+
+	if query.Position == nil {
+		if query.PageSize <= len(messages) {
+			page := messages[:query.PageSize]
+			return page, keysetPagination(page, false, false, len(messages) > query.PageSize || recent.HasOlder), true
+		}
+		if !recent.HasOlder {
+			return messages, keysetPagination(messages, false, false, false), true
+		}
+		return nil, nil, false
+	}
+
+	index := slices.IndexFunc(messages, func(message models.Message) bool {
+		return message.ID == query.Position.MessageID
+	})
+	if index < 0 {
+		return nil, nil, false
+	}
+
+	if query.Direction == models.Previous {
+		// Everything newer than a cached message is cached as well
+		start := max(0, index-query.PageSize)
+		page := messages[start:index]
+		return page, keysetPagination(page, true, true, start > 0), true
+	}
+
+	older := messages[index+1:]
+	if len(older) > query.PageSize {
+		page := older[:query.PageSize]
+		return page, keysetPagination(page, true, false, true), true
+	}
+	if !recent.HasOlder {
+		return older, keysetPagination(older, true, false, false), true
+	}
+	return nil, nil, false
+}
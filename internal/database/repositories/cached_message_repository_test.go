@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingMessageRepository counts the pages read from the wrapped repository
+type countingMessageRepository struct {
+	MessageRepository
+	pages int
+}
+
+func (r *countingMessageRepository) GetMessages(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error) {
+	r.pages++
+	return r.MessageRepository.GetMessages(ctx, groupID, query)
+}
+
+// racingMessageRepository runs afterRead once, right after the next read, to interleave a mutation with a fill
+type racingMessageRepository struct {
+	MessageRepository
+	afterRead func()
+}
+
+func (r *racingMessageRepository) GetMessages(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error) {
+	messages, pagination, err := r.MessageRepository.GetMessages(ctx, groupID, query)
+	if r.afterRead != nil {
+		mutate := r.afterRead
+		r.afterRead = nil
+		mutate()
+	}
+	return messages, pagination, err
+}
+
+func TestCachedMessageRepository(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now().UTC().Add(-time.Hour)
+
+	newCached := func() (MessageRepository, *countingMessageRepository) {
+		inner := &countingMessageRepository{MessageRepository: NewMemoryMessageRepository()}
+		return NewCachedMessageRepository(inner, NewMemoryMessageCache(10, time.Minute), 5, util.NewLoggerFactory()), inner
+	}
+
+	t.Run("Pages match the uncached repository", func(t *testing.T) {
+		cached, inner := newCached()
+		for _, count := range []int{0, 3, 5, 8} {
+			groupID := uuid.New()
+			var messages []models.Message
+			for i := 0; i < count; i++ {
+				messages = append(messages, newTestMessage(t, inner, groupID, start.Add(time.Duration(i)*time.Minute), "bericht"))
+			}
+
+			queries := []models.PaginationQuery{}
+			for size := 1; size <= 9; size++ {
+				queries = append(queries, models.PaginationQuery{PageSize: size, Direction: models.Next})
+				for _, message := range messages {
+					for _, direction := range []models.Direction{models.Next, models.Previous} {
+						queries = append(queries, models.PaginationQuery{PageSize: size, Direction: direction, Position: positionOf(message)})
+					}
+				}
+			}
+
+			for _, query := range queries {
+				expected, expectedPagination, err := inner.MessageRepository.GetMessages(ctx, groupID, query)
+				require.NoError(t, err)
+				actual, actualPagination, err := cached.GetMessages(ctx, groupID, query)
+				require.NoError(t, err)
+				assert.Equal(t, messageIDs(expected), messageIDs(actual), "%d messages, query %+v", count, query)
+				assert.Equal(t, expectedPagination, actualPagination, "%d messages, query %+v", count, query)
+			}
+		}
+	})
+
+	t.Run("Recent pages are served from the cache", func(t *testing.T) {
+		cached, inner := newCached()
+		groupID := uuid.New()
+		var messages []models.Message
+		for i := 0; i < 8; i++ {
+			messages = append(messages, newTestMessage(t, inner, groupID, start.Add(time.Duration(i)*time.Minute), "bericht"))
+		}
+
+		first, _, err := cached.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 2, Direction: models.Next})
+		require.NoError(t, err)
+		assert.Equal(t, 1, inner.pages, "the first page fills the cache")
+
+		_, _, err = cached.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 2, Direction: models.Next, Position: positionOf(first[1])})
+		require.NoError(t, err)
+		message, err := cached.GetMessageByID(ctx, groupID, messages[7].ID)
+		require.NoError(t, err)
+		assert.Equal(t, messages[7].Content, message.Content)
+		assert.Equal(t, 1, inner.pages, "pages within the cached messages are not read again")
+
+		_, _, err = cached.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 4, Direction: models.Next, Position: positionOf(messages[4])})
+		require.NoError(t, err)
+		assert.Equal(t, 2, inner.pages, "pages past the cached messages are read from the repository")
+	})
+
+	t.Run("Mutations invalidate the group", func(t *testing.T) {
+		cached, inner := newCached()
+		groupID := uuid.New()
+		older := newTestMessage(t, cached, groupID, start, "eerste")
+
+		page, _, err := cached.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 5, Direction: models.Next})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{older.ID}, messageIDs(page))
+
+		newer := newTestMessage(t, cached, groupID, start.Add(time.Minute), "tweede")
+		page, _, err = cached.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 5, Direction: models.Next})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{newer.ID, older.ID}, messageIDs(page))
+
+		_, err = cached.ToggleMessagePin(ctx, groupID, older.ID, "")
+		require.NoError(t, err)
+		message, err := cached.GetMessageByID(ctx, groupID, older.ID)
+		require.NoError(t, err)
+		assert.True(t, message.IsPinned)
+
+		require.NoError(t, cached.DeleteMessages(ctx, groupID, []models.Message{newer}))
+		page, _, err = cached.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 5, Direction: models.Next})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{older.ID}, messageIDs(page))
+		assert.Equal(t, 3, inner.pages, "every page read after a mutation refills the cache")
+	})
+
+	t.Run("Fills do not store messages another replica changed meanwhile", func(t *testing.T) {
+		// Two replicas share the cache and the storage, as they do with Redis
+		storage := NewMemoryMessageRepository()
+		shared := NewMemoryMessageCache(10, time.Minute)
+		racing := &racingMessageRepository{MessageRepository: storage}
+		replicaA := NewCachedMessageRepository(racing, shared, 5, util.NewLoggerFactory())
+		replicaB := NewCachedMessageRepository(storage, shared, 5, util.NewLoggerFactory())
+		groupID := uuid.New()
+		older := newTestMessage(t, replicaB, groupID, start, "eerste")
+
+		var newer models.Message
+		racing.afterRead = func() {
+			newer = newTestMessage(t, replicaB, groupID, start.Add(time.Minute), "tweede")
+		}
+		page, _, err := replicaA.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 5, Direction: models.Next})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{older.ID}, messageIDs(page), "the read predates the new message")
+
+		page, _, err = replicaA.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 5, Direction: models.Next})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{newer.ID, older.ID}, messageIDs(page), "the stale read was not cached")
+	})
+}
+
+func TestRedisMessageCacheEncryptsContent(t *testing.T) {
+	ctx := context.Background()
+	groupID := uuid.New()
+	recent := &RecentMessages{Messages: []models.Message{{ID: uuid.New(), GroupID: groupID, SenderName: "Anna",
+		Content: "Ik voel me beter", SentAt: time.Now().UTC()}}, HasOlder: true}
+
+	cipher := NewContentCipher(newTestMasterKeys(t, "m1"), NewMemoryGroupKeyRepository())
+	encrypted := NewRedisMessageCache(nil, "", time.Minute, cipher).(*redisMessageCache)
+	value, err := encrypted.encode(ctx, groupID, recent)
+	require.NoError(t, err)
+	assert.NotContains(t, value, "Ik voel me beter", "Redis holds no plaintext content")
+
+	decoded, err := encrypted.decode(ctx, groupID, value)
+	require.NoError(t, err)
+	assert.Equal(t, recent, decoded)
+
+	_, err = encrypted.decode(ctx, uuid.New(), value)
+	assert.Error(t, err, "the content is bound to its group")
+	_, err = NewRedisMessageCache(nil, "", time.Minute, nil).(*redisMessageCache).decode(ctx, groupID, value)
+	assert.ErrorContains(t, err, "no encryption keys are configured")
+}
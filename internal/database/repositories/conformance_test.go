@@ -0,0 +1,740 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// forEachBackend runs the conformance test once per backend of BackendsUnderTest
+func forEachBackend(t *testing.T, test func(t *testing.T, repos *Repositories)) {
+	backends, err := BackendsUnderTest()
+	require.NoError(t, err)
+	for _, backend := range backends {
+		t.Run(backend.Name, func(t *testing.T) {
+			repos, close, err := backend.Open()
+			require.NoError(t, err)
+			t.Cleanup(close)
+			test(t, repos)
+		})
+	}
+}
+
+// newTestMessage creates a message with a seconds-precision sent time, the precision every backend stores
+func newTestMessage(t *testing.T, repo MessageRepository, groupID uuid.UUID, sentAt time.Time, content string) models.Message {
+	message := models.Message{
+		ID:         uuid.New(),
+		GroupID:    groupID,
+		SenderID:   uuid.New(),
+		SenderName: "Anna",
+		Content:    content,
+		SentAt:     sentAt.UTC().Truncate(time.Second),
+	}
+	require.NoError(t, repo.CreateMessage(context.Background(), groupID, &message))
+	return message
+}
+
+func positionOf(message models.Message) *models.MessageCursor {
+	return &models.MessageCursor{SentAt: message.SentAt, MessageID: message.ID}
+}
+
+func messageIDs(messages []models.Message) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+func TestMessageRepositoryConformance(t *testing.T) {
+	ctx := context.Background()
+
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		repo := repos.Messages
+
+		t.Run("Create and get by ID", func(t *testing.T) {
+			groupID := uuid.New()
+			created := newTestMessage(t, repo, groupID, time.Now(), "Hallo")
+
+			message, err := repo.GetMessageByID(ctx, groupID, created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, created.ID, message.ID)
+			assert.Equal(t, groupID, message.GroupID)
+			assert.Equal(t, created.SenderID, message.SenderID)
+			assert.Equal(t, "Anna", message.SenderName)
+			assert.Equal(t, "Hallo", message.Content)
+			assert.True(t, created.SentAt.Equal(message.SentAt))
+			assert.False(t, message.IsPinned)
+		})
+
+		t.Run("Sender badge is kept", func(t *testing.T) {
+			groupID := uuid.New()
+			created := models.Message{
+				ID:          uuid.New(),
+				GroupID:     groupID,
+				SenderID:    uuid.New(),
+				SenderName:  "Dr. Berg",
+				SenderBadge: models.BadgeProfessional,
+				Content:     "Hallo",
+				SentAt:      time.Now().UTC().Truncate(time.Second),
+			}
+			require.NoError(t, repo.CreateMessage(ctx, groupID, &created))
+
+			message, err := repo.GetMessageByID(ctx, groupID, created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, models.BadgeProfessional, message.SenderBadge)
+		})
+
+		t.Run("Unknown message is not found", func(t *testing.T) {
+			groupID := uuid.New()
+			created := newTestMessage(t, repo, groupID, time.Now(), "Hallo")
+
+			_, err := repo.GetMessageByID(ctx, groupID, uuid.New())
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			// Messages are scoped to their group
+			_, err = repo.GetMessageByID(ctx, uuid.New(), created.ID)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			_, err = repo.ToggleMessagePin(ctx, groupID, uuid.New(), "")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+
+		t.Run("Toggle pin", func(t *testing.T) {
+			groupID := uuid.New()
+			created := newTestMessage(t, repo, groupID, time.Now(), "Hallo")
+
+			pinned, err := repo.ToggleMessagePin(ctx, groupID, created.ID, "")
+			require.NoError(t, err)
+			assert.True(t, pinned.IsPinned)
+
+			stored, err := repo.GetMessageByID(ctx, groupID, created.ID)
+			require.NoError(t, err)
+			assert.True(t, stored.IsPinned)
+
+			unpinned, err := repo.ToggleMessagePin(ctx, groupID, created.ID, "")
+			require.NoError(t, err)
+			assert.False(t, unpinned.IsPinned)
+		})
+
+		t.Run("Conditional pin updates", func(t *testing.T) {
+			groupID := uuid.New()
+			created := newTestMessage(t, repo, groupID, time.Now(), "Hallo")
+
+			stored, err := repo.GetMessageByID(ctx, groupID, created.ID)
+			require.NoError(t, err)
+			require.NotEmpty(t, stored.ETag)
+
+			pinned, err := repo.ToggleMessagePin(ctx, groupID, created.ID, stored.ETag)
+			require.NoError(t, err)
+			assert.True(t, pinned.IsPinned)
+			assert.NotEqual(t, stored.ETag, pinned.ETag)
+
+			current, err := repo.GetMessageByID(ctx, groupID, created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, pinned.ETag, current.ETag)
+
+			_, err = repo.ToggleMessagePin(ctx, groupID, created.ID, stored.ETag)
+			assert.ErrorIs(t, err, ErrConflict, "a stale ETag is rejected")
+			_, err = repo.ToggleMessagePin(ctx, groupID, uuid.New(), stored.ETag)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			current, err = repo.GetMessageByID(ctx, groupID, created.ID)
+			require.NoError(t, err)
+			assert.True(t, current.IsPinned, "the rejected update changed nothing")
+		})
+
+		t.Run("Concurrent toggles are not lost", func(t *testing.T) {
+			groupID := uuid.New()
+			created := newTestMessage(t, repo, groupID, time.Now(), "Hallo")
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 3)
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := repo.ToggleMessagePin(ctx, groupID, created.ID, "")
+					errs <- err
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				require.NoError(t, err)
+			}
+
+			stored, err := repo.GetMessageByID(ctx, groupID, created.ID)
+			require.NoError(t, err)
+			assert.True(t, stored.IsPinned, "three toggles leave the message pinned")
+		})
+
+		t.Run("Pages newest first from a position", func(t *testing.T) {
+			groupID := uuid.New()
+			start := time.Now().Add(-time.Hour)
+			var newestFirst []models.Message
+			for i := 0; i < 5; i++ {
+				message := newTestMessage(t, repo, groupID, start.Add(time.Duration(i)*time.Minute), "bericht")
+				newestFirst = append([]models.Message{message}, newestFirst...)
+			}
+
+			first, pagination, err := repo.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 2, Direction: models.Next})
+			require.NoError(t, err)
+			assert.Equal(t, messageIDs(newestFirst[:2]), messageIDs(first))
+			assert.True(t, pagination.HasNext)
+			assert.False(t, pagination.HasPrevious)
+
+			second, pagination, err := repo.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 2, Direction: models.Next, Position: positionOf(first[1])})
+			require.NoError(t, err)
+			assert.Equal(t, messageIDs(newestFirst[2:4]), messageIDs(second))
+			assert.True(t, pagination.HasNext)
+			assert.True(t, pagination.HasPrevious)
+
+			last, pagination, err := repo.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 2, Direction: models.Next, Position: positionOf(second[1])})
+			require.NoError(t, err)
+			assert.Equal(t, messageIDs(newestFirst[4:]), messageIDs(last))
+			assert.False(t, pagination.HasNext)
+			assert.True(t, pagination.HasPrevious)
+
+			back, pagination, err := repo.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 2, Direction: models.Previous, Position: positionOf(last[0])})
+			require.NoError(t, err)
+			assert.Equal(t, messageIDs(newestFirst[2:4]), messageIDs(back))
+			assert.True(t, pagination.HasNext)
+			assert.True(t, pagination.HasPrevious)
+
+			top, pagination, err := repo.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 2, Direction: models.Previous, Position: positionOf(back[0])})
+			require.NoError(t, err)
+			assert.Equal(t, messageIDs(newestFirst[:2]), messageIDs(top))
+			assert.True(t, pagination.HasNext)
+			assert.False(t, pagination.HasPrevious)
+		})
+
+		t.Run("Messages sent within the same second are not skipped", func(t *testing.T) {
+			groupID := uuid.New()
+			start := time.Now().Add(-time.Hour).Truncate(time.Second)
+			for i := 0; i < 3; i++ {
+				message := models.Message{
+					ID:         uuid.New(),
+					GroupID:    groupID,
+					SenderID:   uuid.New(),
+					SenderName: "Anna",
+					Content:    "bericht",
+					SentAt:     start.Add(time.Duration(i) * 100 * time.Millisecond),
+				}
+				require.NoError(t, repo.CreateMessage(ctx, groupID, &message))
+			}
+
+			var seen []uuid.UUID
+			query := models.PaginationQuery{PageSize: 1, Direction: models.Next}
+			for {
+				page, pagination, err := repo.GetMessages(ctx, groupID, query)
+				require.NoError(t, err)
+				require.Len(t, page, 1)
+				seen = append(seen, page[0].ID)
+				if !pagination.HasNext {
+					break
+				}
+				query.Position = positionOf(page[0])
+			}
+			assert.Len(t, seen, 3)
+		})
+
+		t.Run("Search index matches stems of every word and pages newest first", func(t *testing.T) {
+			groupID := uuid.New()
+			start := time.Now().Add(-time.Hour)
+			oldest := newTestMessage(t, repo, groupID, start, "Wandeling door het park")
+			newTestMessage(t, repo, groupID, start.Add(time.Minute), "Wandelen is gezond")
+			middle := newTestMessage(t, repo, groupID, start.Add(2*time.Minute), "We gaan <b>wandelen</b> in het Park")
+			newest := newTestMessage(t, repo, groupID, start.Add(3*time.Minute), "Parken en wandelingen")
+			newTestMessage(t, repo, uuid.New(), start, "Wandelen in het park, andere groep")
+
+			query := models.SearchQuery{Text: "wandelen parken", PageSize: 2}
+			first, pagination, err := repo.SearchMessages(ctx, groupID, query)
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{newest.ID, middle.ID}, messageIDs(first))
+			assert.True(t, pagination.HasNext)
+
+			query.Position = positionOf(first[len(first)-1])
+			second, pagination, err := repo.SearchMessages(ctx, groupID, query)
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{oldest.ID}, messageIDs(second))
+			assert.False(t, pagination.HasNext)
+
+			none, _, err := repo.SearchMessages(ctx, groupID, models.SearchQuery{Text: "het en de", PageSize: 2})
+			require.NoError(t, err)
+			assert.Empty(t, none, "stop words alone match nothing")
+		})
+
+		t.Run("End-to-end encrypted messages keep their envelopes and are not indexed", func(t *testing.T) {
+			groupID := uuid.New()
+			message := models.Message{
+				ID:         uuid.New(),
+				GroupID:    groupID,
+				SenderID:   uuid.New(),
+				SenderName: "Anna",
+				Content:    "c2VjcmV0Y2lwaGVydGV4dA",
+				SentAt:     time.Now().UTC().Truncate(time.Second),
+				Envelopes: []models.KeyEnvelope{
+					{RecipientID: uuid.New(), DeviceID: "phone", Ciphertext: "a2V5LTE"},
+					{RecipientID: uuid.New(), DeviceID: "tablet", Ciphertext: "a2V5LTI"},
+				},
+			}
+			require.NoError(t, repo.CreateMessage(ctx, groupID, &message))
+
+			stored, err := repo.GetMessageByID(ctx, groupID, message.ID)
+			require.NoError(t, err)
+			assert.Equal(t, message.Content, stored.Content)
+			assert.Equal(t, message.Envelopes, stored.Envelopes)
+
+			pinned, err := repo.ToggleMessagePin(ctx, groupID, message.ID, "")
+			require.NoError(t, err)
+			assert.Equal(t, message.Envelopes, pinned.Envelopes, "updates keep the envelopes")
+
+			found, _, err := repo.SearchMessages(ctx, groupID, models.SearchQuery{Text: message.Content, PageSize: 10})
+			require.NoError(t, err)
+			assert.Empty(t, found)
+		})
+
+		t.Run("Expired messages are listed in batches and deleted", func(t *testing.T) {
+			groupID := uuid.New()
+			start := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+			oldest := newTestMessage(t, repo, groupID, start, "Oude wandeling")
+			pinned := newTestMessage(t, repo, groupID, start.Add(time.Minute), "Vastgepind")
+			older := newTestMessage(t, repo, groupID, start.Add(2*time.Minute), "Nog een wandeling")
+			recent := newTestMessage(t, repo, groupID, time.Now(), "Nieuwe wandeling")
+			_, err := repo.ToggleMessagePin(ctx, groupID, pinned.ID, "")
+			require.NoError(t, err)
+
+			query := models.RetentionQuery{Before: start.Add(24 * time.Hour), KeepPinned: true, Limit: 1}
+			first, err := repo.ListExpiredMessages(ctx, groupID, query)
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{older.ID}, messageIDs(first))
+
+			query.Position = positionOf(first[0])
+			second, err := repo.ListExpiredMessages(ctx, groupID, query)
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{oldest.ID}, messageIDs(second), "pinned messages are skipped")
+
+			all, err := repo.ListExpiredMessages(ctx, groupID, models.RetentionQuery{Before: start.Add(time.Minute), Limit: 10})
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{oldest.ID}, messageIDs(all), "messages sent at the cutoff are kept")
+
+			require.NoError(t, repo.DeleteMessages(ctx, groupID, append(first, second...)))
+
+			_, err = repo.GetMessageByID(ctx, groupID, oldest.ID)
+			assert.ErrorIs(t, err, ErrNotFound)
+			found, _, err := repo.SearchMessages(ctx, groupID, models.SearchQuery{Text: "wandeling", PageSize: 10})
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{recent.ID}, messageIDs(found), "deleted messages leave no search terms behind")
+
+			remaining, err := repo.ListExpiredMessages(ctx, groupID, models.RetentionQuery{Before: time.Now().Add(-time.Hour), Limit: 10})
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{pinned.ID}, messageIDs(remaining))
+
+			assert.NoError(t, repo.DeleteMessages(ctx, groupID, first), "deleting again is not an error")
+		})
+
+		t.Run("Unread messages", func(t *testing.T) {
+			groupID := uuid.New()
+			start := time.Now().Add(-time.Hour).Truncate(time.Second)
+			var ids []uuid.UUID
+			for i := 0; i < 4; i++ {
+				ids = append(ids, newTestMessage(t, repo, groupID, start.Add(time.Duration(i)*time.Minute), "bericht").ID)
+			}
+
+			count, err := repo.CountUnreadMessages(ctx, groupID, start.Add(90*time.Second))
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+
+			since, err := repo.GetMessagesSince(ctx, groupID, start.Add(30*time.Second), 2)
+			require.NoError(t, err)
+			assert.Equal(t, ids[2:], messageIDs(since), "the newest messages, oldest first")
+		})
+
+		t.Run("Groups with messages are listed", func(t *testing.T) {
+			groupID := uuid.New()
+			newTestMessage(t, repo, groupID, time.Now(), "bericht")
+			newTestMessage(t, repo, groupID, time.Now(), "bericht")
+
+			groupIDs, err := repo.ListGroupIDs(ctx)
+			require.NoError(t, err)
+			count := 0
+			for _, listed := range groupIDs {
+				if listed == groupID {
+					count++
+				}
+			}
+			assert.Equal(t, 1, count, "every group is listed once")
+		})
+
+		t.Run("Users that never read the chat have read everything", func(t *testing.T) {
+			lastRead, err := repo.GetLastReadTime(ctx, uuid.New(), uuid.New())
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now(), lastRead, time.Minute)
+		})
+	})
+}
+
+func TestFCMTokenRepositoryConformance(t *testing.T) {
+	ctx := context.Background()
+
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		repo := repos.FCMTokens
+		groupID := uuid.New()
+		userID := uuid.New()
+
+		require.NoError(t, repo.SaveToken(ctx, groupID, userID, "token-1", "en"))
+		require.NoError(t, repo.SaveToken(ctx, groupID, userID, "token-2", "nl"))
+		require.NoError(t, repo.SaveToken(ctx, uuid.New(), userID, "other-group", "nl"))
+
+		tokens, err := repo.GetGroupMemberTokens(ctx, groupID)
+		require.NoError(t, err)
+		require.Len(t, tokens, 1, "saving again replaces the user's token")
+		assert.Equal(t, "token-2", tokens[0].Token)
+		assert.Equal(t, "nl", tokens[0].Locale)
+		assert.Equal(t, userID.String(), tokens[0].RowKey)
+		assert.True(t, tokens[0].IsActive)
+		assert.NotNil(t, tokens[0].Timestamp)
+
+		all, err := repo.ListTokens(ctx)
+		require.NoError(t, err)
+		var listed []string
+		for _, token := range all {
+			listed = append(listed, token.PartitionKey+"/"+token.Token)
+		}
+		assert.Contains(t, listed, groupID.String()+"/token-2")
+		assert.NotContains(t, listed, groupID.String()+"/token-1")
+
+		require.NoError(t, repo.DeleteToken(ctx, groupID, userID))
+		tokens, err = repo.GetGroupMemberTokens(ctx, groupID)
+		require.NoError(t, err)
+		assert.Empty(t, tokens)
+
+		assert.ErrorIs(t, repo.DeleteToken(ctx, groupID, userID), ErrNotFound)
+	})
+}
+
+func TestUserPreferencesRepositoryConformance(t *testing.T) {
+	ctx := context.Background()
+
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		repo := repos.UserPreferences
+		userID := uuid.New()
+
+		preferences, err := repo.GetPreferences(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, &models.UserPreferences{UserID: userID}, preferences)
+
+		saved := &models.UserPreferences{
+			UserID:      userID,
+			Locale:      "en",
+			EmailDigest: true,
+			Email:       "anna@example.com",
+			DigestGroups: map[uuid.UUID]time.Time{
+				uuid.New(): time.Now().UTC().Truncate(time.Second),
+				uuid.New(): time.Now().Add(-time.Hour).UTC().Truncate(time.Second),
+			},
+		}
+		require.NoError(t, repo.SavePreferences(ctx, saved))
+		require.NoError(t, repo.SavePreferences(ctx, &models.UserPreferences{UserID: uuid.New(), Locale: "nl"}))
+
+		preferences, err = repo.GetPreferences(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, saved.Locale, preferences.Locale)
+		assert.Equal(t, saved.Email, preferences.Email)
+		assertDigestGroups(t, saved.DigestGroups, preferences.DigestGroups)
+
+		subscribers, err := repo.ListDigestSubscribers(ctx)
+		require.NoError(t, err)
+		var subscribed []uuid.UUID
+		for _, subscriber := range subscribers {
+			assert.True(t, subscriber.EmailDigest)
+			subscribed = append(subscribed, subscriber.UserID)
+		}
+		assert.Contains(t, subscribed, userID)
+
+		all, err := repo.ListPreferences(ctx)
+		require.NoError(t, err)
+		var listed *models.UserPreferences
+		for i := range all {
+			if all[i].UserID == userID {
+				listed = &all[i]
+			}
+		}
+		require.NotNil(t, listed)
+		assertDigestGroups(t, saved.DigestGroups, listed.DigestGroups)
+	})
+}
+
+func assertDigestGroups(t *testing.T, want map[uuid.UUID]time.Time, got map[uuid.UUID]time.Time) {
+	t.Helper()
+	require.Len(t, got, len(want))
+	for groupID, lastDigestAt := range want {
+		assert.True(t, lastDigestAt.Equal(got[groupID]), "last digest of group %s", groupID)
+	}
+}
+
+func TestGroupSettingsRepositoryConformance(t *testing.T) {
+	ctx := context.Background()
+
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		repo := repos.GroupSettings
+		groupID := uuid.New()
+
+		settings, err := repo.GetSettings(ctx, groupID)
+		require.NoError(t, err)
+		assert.Equal(t, &models.GroupSettings{GroupID: groupID}, settings)
+
+		saved := &models.GroupSettings{
+			GroupID:              groupID,
+			PrivateNotifications: true,
+			DigestExcludeContent: true,
+			RetentionDays:        365,
+			RetentionKeepPinned:  true,
+			EndToEndEncrypted:    true,
+			AllowMessageDeletion: true,
+		}
+		require.NoError(t, repo.SaveSettings(ctx, saved))
+		require.NoError(t, repo.SaveSettings(ctx, &models.GroupSettings{GroupID: uuid.New(), PrivateNotifications: true}))
+
+		settings, err = repo.GetSettings(ctx, groupID)
+		require.NoError(t, err)
+		assert.Equal(t, saved, settings)
+
+		policies, err := repo.ListRetentionPolicies(ctx)
+		require.NoError(t, err)
+		var withRetention []uuid.UUID
+		for _, policy := range policies {
+			assert.Positive(t, policy.RetentionDays)
+			withRetention = append(withRetention, policy.GroupID)
+		}
+		assert.Contains(t, withRetention, groupID)
+
+		all, err := repo.ListSettings(ctx)
+		require.NoError(t, err)
+		assert.Contains(t, all, *saved)
+	})
+}
+
+func TestKeyBundleRepositoryConformance(t *testing.T) {
+	ctx := context.Background()
+
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		repo := repos.KeyBundles
+		groupID := uuid.New()
+		userID := uuid.New()
+
+		bundle := &models.KeyBundle{
+			GroupID:        groupID,
+			UserID:         userID,
+			DeviceID:       "phone",
+			IdentityKey:    "identity-1",
+			SignedPreKey:   models.SignedPreKey{KeyID: 1, PublicKey: "signed-1", Signature: "signature-1"},
+			OneTimePreKeys: []models.PreKey{{KeyID: 1, PublicKey: "one-time-1"}, {KeyID: 2, PublicKey: "one-time-2"}},
+			UpdatedAt:      time.Now().UTC().Truncate(time.Second),
+		}
+		require.NoError(t, repo.SaveBundle(ctx, bundle))
+		require.NoError(t, repo.SaveBundle(ctx, &models.KeyBundle{GroupID: uuid.New(), UserID: userID, DeviceID: "phone", UpdatedAt: time.Now()}))
+
+		bundles, err := repo.ListBundles(ctx, groupID)
+		require.NoError(t, err)
+		require.Len(t, bundles, 1)
+		assert.Equal(t, "identity-1", bundles[0].IdentityKey)
+		assert.Equal(t, bundle.SignedPreKey, bundles[0].SignedPreKey)
+		assert.Empty(t, bundles[0].OneTimePreKeys, "one-time pre-keys are only handed out by claiming them")
+		assert.True(t, bundle.UpdatedAt.Equal(bundles[0].UpdatedAt))
+
+		first, err := repo.ClaimPreKey(ctx, groupID, userID, "phone")
+		require.NoError(t, err)
+		second, err := repo.ClaimPreKey(ctx, groupID, userID, "phone")
+		require.NoError(t, err)
+		require.NotNil(t, first)
+		require.NotNil(t, second)
+		assert.ElementsMatch(t, bundle.OneTimePreKeys, []models.PreKey{*first, *second})
+
+		exhausted, err := repo.ClaimPreKey(ctx, groupID, userID, "phone")
+		require.NoError(t, err)
+		assert.Nil(t, exhausted)
+
+		bundle.IdentityKey = "identity-2"
+		bundle.OneTimePreKeys = []models.PreKey{{KeyID: 3, PublicKey: "one-time-3"}}
+		require.NoError(t, repo.SaveBundle(ctx, bundle))
+		replenished, err := repo.ClaimPreKey(ctx, groupID, userID, "phone")
+		require.NoError(t, err)
+		assert.Equal(t, &bundle.OneTimePreKeys[0], replenished, "saving again replaces the pre-keys")
+
+		_, err = repo.ClaimPreKey(ctx, groupID, uuid.New(), "phone")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		all, err := repo.ListAllBundles(ctx)
+		require.NoError(t, err)
+		var listed []models.KeyBundle
+		for _, stored := range all {
+			if stored.UserID == userID {
+				assert.Empty(t, stored.OneTimePreKeys)
+				listed = append(listed, stored)
+			}
+		}
+		assert.Len(t, listed, 2, "bundles of every group are listed")
+	})
+}
+
+func TestPurgeAuditRepositoryConformance(t *testing.T) {
+	ctx := context.Background()
+
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		repo := repos.PurgeAudits
+		groupID := uuid.New()
+		runID := uuid.New()
+		purgedAt := time.Now().UTC().Truncate(time.Second)
+
+		first := &models.PurgeAudit{
+			ID:         uuid.New(),
+			RunID:      runID,
+			GroupID:    groupID,
+			PurgedAt:   purgedAt,
+			Cutoff:     purgedAt.Add(-24 * time.Hour),
+			KeepPinned: true,
+			MessageIDs: []uuid.UUID{uuid.New(), uuid.New()},
+		}
+		second := &models.PurgeAudit{
+			ID:         uuid.New(),
+			RunID:      runID,
+			GroupID:    groupID,
+			PurgedAt:   purgedAt.Add(time.Second),
+			Cutoff:     first.Cutoff,
+			MessageIDs: []uuid.UUID{uuid.New()},
+		}
+		require.NoError(t, repo.RecordPurge(ctx, first))
+		require.NoError(t, repo.RecordPurge(ctx, second))
+
+		audits, err := repo.ListPurges(ctx, groupID)
+		require.NoError(t, err)
+		require.Len(t, audits, 2)
+		assert.Equal(t, second.ID, audits[0].ID, "newest first")
+		assert.Equal(t, first.MessageIDs, audits[1].MessageIDs)
+		assert.Equal(t, runID, audits[1].RunID)
+		assert.True(t, first.Cutoff.Equal(audits[1].Cutoff))
+		assert.True(t, audits[1].KeepPinned)
+
+		none, err := repo.ListPurges(ctx, uuid.New())
+		require.NoError(t, err)
+		assert.Empty(t, none)
+
+		all, err := repo.ListAllPurges(ctx)
+		require.NoError(t, err)
+		var listed []uuid.UUID
+		for _, audit := range all {
+			if audit.GroupID == groupID {
+				listed = append(listed, audit.ID)
+			}
+		}
+		assert.ElementsMatch(t, []uuid.UUID{first.ID, second.ID}, listed)
+	})
+}
+
+func TestAccessAuditRepositoryConformance(t *testing.T) {
+	ctx := context.Background()
+
+	forEachBackend(t, func(t *testing.T, repos *Repositories) {
+		repo := repos.AccessAudits
+		groupID := uuid.New()
+		userID := uuid.New()
+		messageID := uuid.New()
+		accessedAt := time.Now().UTC().Truncate(time.Second)
+
+		read := &models.AccessAudit{
+			ID:         uuid.New(),
+			GroupID:    groupID,
+			UserID:     userID,
+			Role:       models.RoleHealthcareProfessional,
+			Method:     "GET",
+			Route:      "/groups/:groupId/messages",
+			Status:     200,
+			AccessedAt: accessedAt,
+		}
+		pin := &models.AccessAudit{
+			ID:         uuid.New(),
+			GroupID:    groupID,
+			UserID:     userID,
+			Role:       models.RoleHealthcareProfessional,
+			Method:     "PUT",
+			Route:      "/groups/:groupId/messages/:messageId/pin",
+			MessageID:  &messageID,
+			Status:     403,
+			AccessedAt: accessedAt.Add(time.Second),
+		}
+		require.NoError(t, repo.RecordAccess(ctx, read))
+		require.NoError(t, repo.RecordAccess(ctx, pin))
+
+		audits, err := repo.ListAccesses(ctx, groupID)
+		require.NoError(t, err)
+		require.Len(t, audits, 2)
+		assert.Equal(t, pin.ID, audits[0].ID, "newest first")
+		assert.Equal(t, &messageID, audits[0].MessageID)
+		assert.Equal(t, 403, audits[0].Status)
+		assert.Nil(t, audits[1].MessageID)
+		assert.Equal(t, models.RoleHealthcareProfessional, audits[1].Role)
+		assert.Equal(t, "/groups/:groupId/messages", audits[1].Route)
+		assert.True(t, accessedAt.Equal(audits[1].AccessedAt))
+
+		none, err := repo.ListAccesses(ctx, uuid.New())
+		require.NoError(t, err)
+		assert.Empty(t, none)
+
+		all, err := repo.ListAllAccesses(ctx)
+		require.NoError(t, err)
+		var listed []uuid.UUID
+		for _, audit := range all {
+			if audit.GroupID == groupID {
+				listed = append(listed, audit.ID)
+			}
+		}
+		assert.ElementsMatch(t, []uuid.UUID{read.ID, pin.ID}, listed)
+	})
+}
+
+func TestTokenRevocationRepositoryConformance(t *testing.T) {
+	ctx := context.Background()
+
+	backends, err := BackendsUnderTest()
+	require.NoError(t, err)
+	for _, backend := range backends {
+		t.Run(backend.Name, func(t *testing.T) {
+			repo, close, err := backend.OpenRevocations()
+			require.NoError(t, err)
+			t.Cleanup(close)
+
+			now := time.Now().UTC().Truncate(time.Second)
+			token := models.TokenRevocation{Kind: models.RevokeToken, ID: "jti-" + uuid.NewString(), Reason: "stolen device",
+				RevokedBy: uuid.NewString(), RevokedAt: now, ExpiresAt: now.Add(time.Hour)}
+			session := models.TokenRevocation{Kind: models.RevokeSession, ID: uuid.NewString(),
+				RevokedBy: uuid.NewString(), RevokedAt: now, ExpiresAt: now.Add(time.Minute)}
+			expired := models.TokenRevocation{Kind: models.RevokeToken, ID: "jti-" + uuid.NewString(),
+				RevokedBy: uuid.NewString(), RevokedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+			for _, revocation := range []models.TokenRevocation{token, session, expired} {
+				require.NoError(t, repo.Revoke(ctx, &revocation))
+			}
+
+			revocations, err := repo.ListRevocations(ctx, now)
+			require.NoError(t, err)
+			assert.Contains(t, revocations, token)
+			assert.Contains(t, revocations, session)
+			assert.NotContains(t, revocations, expired, "expired revocations are no longer listed")
+
+			// Revoking again replaces the earlier revocation
+			session.ExpiresAt = now.Add(2 * time.Hour)
+			require.NoError(t, repo.Revoke(ctx, &session))
+			revocations, err = repo.ListRevocations(ctx, now.Add(time.Hour))
+			require.NoError(t, err)
+			assert.Contains(t, revocations, session)
+			assert.NotContains(t, revocations, token)
+		})
+	}
+}
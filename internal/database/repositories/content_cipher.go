@@ -0,0 +1,269 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/cache"
+	"Groupchat-Service/internal/encryption"
+	"Groupchat-Service/internal/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// contentKeyCacheTTL bounds how long a replica keeps encrypting with a data key version another process
+	// has rotated away from. Content encrypted with an older version stays readable.
+	contentKeyCacheTTL    = time.Minute
+	contentKeyCacheGroups = 4096
+	contentKeyIDPrefix    = "v"
+	// blindTermLength is the number of hex digits of a blinded search term
+	blindTermLength = 32
+)
+
+// groupDataKeys are the unwrapped data key versions of a group
+type groupDataKeys struct {
+	versions map[int][]byte
+	latest   int
+	// indexKey blinds search terms. It is derived from the first version, so terms stay comparable across
+	// rotations of the data key.
+	indexKey []byte
+}
+
+// ContentCipher encrypts message content with envelope encryption: every group has its own data keys, which
+// are stored wrapped with a master key. Content records the ID of the data key version that encrypted it,
+// so rotating the data key of a group only affects content written afterwards.
+type ContentCipher struct {
+	masterKeys *encryption.MasterKeys
+	keys       GroupKeyRepository
+	unwrapped  *cache.LRU[uuid.UUID, *groupDataKeys]
+}
+
+func NewContentCipher(masterKeys *encryption.MasterKeys, keys GroupKeyRepository) *ContentCipher {
+	return &ContentCipher{
+		masterKeys: masterKeys,
+		keys:       keys,
+		unwrapped:  cache.NewLRU[uuid.UUID, *groupDataKeys](contentKeyCacheGroups, contentKeyCacheTTL),
+	}
+}
+
+// Encrypt encrypts the content of a message with the latest data key of its group, creating the first data
+// key of the group when it has none. It returns the encrypted content and the ID of the data key.
+func (c *ContentCipher) Encrypt(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID, content string) (string, string, error) {
+	keys, err := c.groupKeys(ctx, groupID, true)
+	if err != nil {
+		return "", "", err
+	}
+
+	sealed, err := encryption.Seal(keys.versions[keys.latest], []byte(content), contentAAD(groupID, messageID))
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), contentKeyID(keys.latest), nil
+}
+
+// Decrypt decrypts content encrypted by Encrypt for the same message
+func (c *ContentCipher) Decrypt(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID, keyID string, content string) (string, error) {
+	version, err := parseContentKeyID(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	keys, err := c.groupKeys(ctx, groupID, false)
+	if err != nil {
+		return "", err
+	}
+	if keys == nil || keys.versions[version] == nil {
+		// The version may have been created by another process after the keys were cached
+		if keys, err = c.loadGroupKeys(ctx, groupID, false); err != nil {
+			return "", err
+		}
+	}
+	if keys == nil || keys.versions[version] == nil {
+		return "", fmt.Errorf("content key %s of group %s: %w", keyID, groupID, encryption.ErrUnknownKey)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return "", fmt.Errorf("encrypted content is not valid base64: %w", err)
+	}
+	plaintext, err := encryption.Open(keys.versions[version], sealed, contentAAD(groupID, messageID))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// BlindTerms replaces search terms by keyed hashes, so the search index does not reveal the words of the
+// messages while equal terms still match. Without create, a group without data keys has no blinded terms
+// and nil is returned.
+func (c *ContentCipher) BlindTerms(ctx context.Context, groupID uuid.UUID, terms []string, create bool) ([]string, error) {
+	keys, err := c.groupKeys(ctx, groupID, create)
+	if err != nil || keys == nil {
+		return nil, err
+	}
+
+	blinded := make([]string, 0, len(terms))
+	for _, term := range terms {
+		mac := hmac.New(sha256.New, keys.indexKey)
+		mac.Write([]byte(term))
+		blinded = append(blinded, hex.EncodeToString(mac.Sum(nil))[:blindTermLength])
+	}
+	return blinded, nil
+}
+
+// LatestKeyID returns the ID of the data key new content of the group is encrypted with, creating the first
+// data key when the group has none
+func (c *ContentCipher) LatestKeyID(ctx context.Context, groupID uuid.UUID) (string, error) {
+	keys, err := c.loadGroupKeys(ctx, groupID, true)
+	if err != nil {
+		return "", err
+	}
+	return contentKeyID(keys.latest), nil
+}
+
+// RotateGroupKey adds a new data key version to a group. Content written afterwards is encrypted with it;
+// existing content keeps its version until it is re-encrypted.
+func (c *ContentCipher) RotateGroupKey(ctx context.Context, groupID uuid.UUID) (*models.GroupKey, error) {
+	keys, err := c.loadGroupKeys(ctx, groupID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	version := 1
+	if keys != nil {
+		version = keys.latest + 1
+	}
+	key, err := c.createKey(ctx, groupID, version)
+	if err != nil {
+		return nil, err
+	}
+	c.unwrapped.Delete(groupID)
+	return key, nil
+}
+
+// RewrapGroupKeys wraps every data key that is not wrapped with the current master key again with it, after
+// which the other master keys are no longer needed. It returns the number of rewrapped keys.
+func (c *ContentCipher) RewrapGroupKeys(ctx context.Context) (int, error) {
+	keys, err := c.keys.ListGroupKeys(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	rewrapped := 0
+	for _, key := range keys {
+		if key.MasterKeyID == c.masterKeys.CurrentID() {
+			continue
+		}
+		aad := groupKeyAAD(key.GroupID, key.Version)
+		dataKey, err := c.masterKeys.Unwrap(key.MasterKeyID, key.WrappedKey, aad)
+		if err != nil {
+			return rewrapped, fmt.Errorf("key version %d of group %s: %w", key.Version, key.GroupID, err)
+		}
+		key.MasterKeyID, key.WrappedKey, err = c.masterKeys.Wrap(dataKey, aad)
+		if err != nil {
+			return rewrapped, err
+		}
+		if err := c.keys.UpdateGroupKey(ctx, &key); err != nil {
+			return rewrapped, err
+		}
+		rewrapped++
+	}
+	return rewrapped, nil
+}
+
+// groupKeys returns the cached data keys of a group. Without create, nil is returned for a group without keys.
+func (c *ContentCipher) groupKeys(ctx context.Context, groupID uuid.UUID, create bool) (*groupDataKeys, error) {
+	if keys, ok := c.unwrapped.Get(groupID); ok {
+		return keys, nil
+	}
+	return c.loadGroupKeys(ctx, groupID, create)
+}
+
+func (c *ContentCipher) loadGroupKeys(ctx context.Context, groupID uuid.UUID, create bool) (*groupDataKeys, error) {
+	stored, err := c.keys.GetGroupKeys(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data keys of group %s: %w", groupID, err)
+	}
+	if len(stored) == 0 {
+		if !create {
+			return nil, nil
+		}
+		// Another replica may create the first key at the same time; both then use the stored one
+		if _, err := c.createKey(ctx, groupID, 1); err != nil && !errors.Is(err, ErrConflict) {
+			return nil, err
+		}
+		if stored, err = c.keys.GetGroupKeys(ctx, groupID); err != nil {
+			return nil, fmt.Errorf("failed to get data keys of group %s: %w", groupID, err)
+		}
+	}
+
+	keys := &groupDataKeys{versions: make(map[int][]byte, len(stored))}
+	for _, key := range stored {
+		dataKey, err := c.masterKeys.Unwrap(key.MasterKeyID, key.WrappedKey, groupKeyAAD(groupID, key.Version))
+		if err != nil {
+			return nil, fmt.Errorf("key version %d of group %s: %w", key.Version, groupID, err)
+		}
+		keys.versions[key.Version] = dataKey
+		if keys.indexKey == nil {
+			mac := hmac.New(sha256.New, dataKey)
+			mac.Write([]byte("search-index"))
+			keys.indexKey = mac.Sum(nil)
+		}
+		keys.latest = max(keys.latest, key.Version)
+	}
+
+	c.unwrapped.Set(groupID, keys)
+	return keys, nil
+}
+
+func (c *ContentCipher) createKey(ctx context.Context, groupID uuid.UUID, version int) (*models.GroupKey, error) {
+	dataKey, err := encryption.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	masterKeyID, wrapped, err := c.masterKeys.Wrap(dataKey, groupKeyAAD(groupID, version))
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.GroupKey{
+		GroupID:     groupID,
+		Version:     version,
+		MasterKeyID: masterKeyID,
+		WrappedKey:  wrapped,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := c.keys.CreateGroupKey(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// groupKeyAAD binds a wrapped data key to its group and version
+func groupKeyAAD(groupID uuid.UUID, version int) []byte {
+	return []byte(groupID.String() + "/" + contentKeyID(version))
+}
+
+// contentAAD binds encrypted content to its message, so it cannot be copied into another message
+func contentAAD(groupID uuid.UUID, messageID uuid.UUID) []byte {
+	return []byte(groupID.String() + "/" + messageID.String())
+}
+
+func contentKeyID(version int) string {
+	return contentKeyIDPrefix + strconv.Itoa(version)
+}
+
+func parseContentKeyID(keyID string) (int, error) {
+	version, err := strconv.Atoi(strings.TrimPrefix(keyID, contentKeyIDPrefix))
+	if err != nil || !strings.HasPrefix(keyID, contentKeyIDPrefix) || version <= 0 {
+		return 0, fmt.Errorf("invalid content key ID %q", keyID)
+	}
+	return version, nil
+}
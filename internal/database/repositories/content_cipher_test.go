@@ -0,0 +1,167 @@
+package repositories
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"Groupchat-Service/internal/encryption"
+	"Groupchat-Service/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMasterKeys returns master keys with the given IDs, the last one current
+func newTestMasterKeys(t *testing.T, ids ...string) *encryption.MasterKeys {
+	var pairs []string
+	for _, id := range ids {
+		key := []byte(strings.Repeat(id, encryption.KeySize)[:encryption.KeySize])
+		pairs = append(pairs, id+":"+base64.StdEncoding.EncodeToString(key))
+	}
+	keys, err := encryption.ParseMasterKeys(strings.Join(pairs, ","), ids[len(ids)-1])
+	require.NoError(t, err)
+	return keys
+}
+
+func TestContentCipher(t *testing.T) {
+	ctx := context.Background()
+	groupID := uuid.New()
+	messageID := uuid.New()
+
+	t.Run("Content is encrypted with a data key of its group", func(t *testing.T) {
+		keys := NewMemoryGroupKeyRepository()
+		cipher := NewContentCipher(newTestMasterKeys(t, "m1"), keys)
+
+		ciphertext, keyID, err := cipher.Encrypt(ctx, groupID, messageID, "Ik voel me beter")
+		require.NoError(t, err)
+		assert.Equal(t, "v1", keyID)
+		assert.NotContains(t, ciphertext, "beter")
+
+		stored, err := keys.GetGroupKeys(ctx, groupID)
+		require.NoError(t, err)
+		require.Len(t, stored, 1)
+		assert.Equal(t, "m1", stored[0].MasterKeyID)
+
+		// A fresh cipher reads the wrapped key from the repository
+		plaintext, err := NewContentCipher(newTestMasterKeys(t, "m1"), keys).Decrypt(ctx, groupID, messageID, keyID, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, "Ik voel me beter", plaintext)
+	})
+
+	t.Run("Content cannot be moved to another message or group", func(t *testing.T) {
+		cipher := NewContentCipher(newTestMasterKeys(t, "m1"), NewMemoryGroupKeyRepository())
+		ciphertext, keyID, err := cipher.Encrypt(ctx, groupID, messageID, "geheim")
+		require.NoError(t, err)
+
+		_, err = cipher.Decrypt(ctx, groupID, uuid.New(), keyID, ciphertext)
+		assert.Error(t, err)
+		_, err = cipher.Decrypt(ctx, uuid.New(), messageID, keyID, ciphertext)
+		assert.ErrorIs(t, err, encryption.ErrUnknownKey)
+		_, err = cipher.Decrypt(ctx, groupID, messageID, "v9", ciphertext)
+		assert.ErrorIs(t, err, encryption.ErrUnknownKey)
+		_, err = cipher.Decrypt(ctx, groupID, messageID, "bogus", ciphertext)
+		assert.Error(t, err)
+	})
+
+	t.Run("Rotating the data key keeps older content readable", func(t *testing.T) {
+		cipher := NewContentCipher(newTestMasterKeys(t, "m1"), NewMemoryGroupKeyRepository())
+		old, oldKeyID, err := cipher.Encrypt(ctx, groupID, messageID, "oud")
+		require.NoError(t, err)
+		blindedBefore, err := cipher.BlindTerms(ctx, groupID, []string{"slaap"}, false)
+		require.NoError(t, err)
+
+		key, err := cipher.RotateGroupKey(ctx, groupID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, key.Version)
+
+		_, newKeyID, err := cipher.Encrypt(ctx, groupID, messageID, "nieuw")
+		require.NoError(t, err)
+		assert.Equal(t, "v2", newKeyID)
+		latest, err := cipher.LatestKeyID(ctx, groupID)
+		require.NoError(t, err)
+		assert.Equal(t, "v2", latest)
+
+		plaintext, err := cipher.Decrypt(ctx, groupID, messageID, oldKeyID, old)
+		require.NoError(t, err)
+		assert.Equal(t, "oud", plaintext)
+
+		blindedAfter, err := cipher.BlindTerms(ctx, groupID, []string{"slaap"}, false)
+		require.NoError(t, err)
+		assert.Equal(t, blindedBefore, blindedAfter, "search terms stay comparable across rotations")
+	})
+
+	t.Run("Rewrapping moves data keys to the current master key", func(t *testing.T) {
+		keys := NewMemoryGroupKeyRepository()
+		ciphertext, keyID, err := NewContentCipher(newTestMasterKeys(t, "m1"), keys).Encrypt(ctx, groupID, messageID, "inhoud")
+		require.NoError(t, err)
+
+		rotated := NewContentCipher(newTestMasterKeys(t, "m1", "m2"), keys)
+		rewrapped, err := rotated.RewrapGroupKeys(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, rewrapped)
+		rewrapped, err = rotated.RewrapGroupKeys(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, rewrapped)
+
+		// The old master key is no longer needed
+		plaintext, err := NewContentCipher(newTestMasterKeys(t, "m2"), keys).Decrypt(ctx, groupID, messageID, keyID, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, "inhoud", plaintext)
+	})
+
+	t.Run("Blinded terms do not reveal the term and differ between groups", func(t *testing.T) {
+		cipher := NewContentCipher(newTestMasterKeys(t, "m1"), NewMemoryGroupKeyRepository())
+
+		none, err := cipher.BlindTerms(ctx, groupID, []string{"angst"}, false)
+		require.NoError(t, err)
+		assert.Nil(t, none, "groups without keys have no blinded terms")
+
+		first, err := cipher.BlindTerms(ctx, groupID, []string{"angst", "angst", "rust"}, true)
+		require.NoError(t, err)
+		require.Len(t, first, 3)
+		assert.Equal(t, first[0], first[1])
+		assert.NotEqual(t, first[0], first[2])
+		assert.NotContains(t, first[0], "angst")
+
+		other, err := cipher.BlindTerms(ctx, uuid.New(), []string{"angst"}, true)
+		require.NoError(t, err)
+		assert.NotEqual(t, first[0], other[0])
+	})
+}
+
+func TestEncryptedMessageArchive(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileArchiveStore(t.TempDir())
+	cipher := NewContentCipher(newTestMasterKeys(t, "m1"), NewMemoryGroupKeyRepository())
+	groupID := uuid.New()
+	message := models.Message{ID: uuid.New(), GroupID: groupID, Content: "vertrouwelijk", SenderName: "Anna"}
+
+	archive := NewEncryptedMessageArchive(store, cipher)
+	require.NoError(t, archive.AddMessages(ctx, groupID, []models.Message{message}))
+	require.NoError(t, archive.AdvanceWatermark(ctx, groupID, message))
+
+	name := archiveMonthName(groupID, archiveMonth(message.SentAt))
+	data, err := store.ReadArchive(ctx, name)
+	require.NoError(t, err)
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	stored, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(stored), `"contentKeyId":"v1"`)
+	assert.NotContains(t, string(stored), "vertrouwelijk")
+
+	manifest, err := archive.Manifest(ctx, groupID)
+	require.NoError(t, err)
+	archived, err := archive.Older(ctx, groupID, manifest, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, archived, 1)
+	assert.Equal(t, "vertrouwelijk", archived[0].Content)
+
+	_, err = NewMessageArchive(store).readMonth(ctx, groupID, archiveMonth(message.SentAt), false)
+	assert.Error(t, err, "encrypted archives need the keys")
+}
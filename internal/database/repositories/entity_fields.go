@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schemaVersionField is the property holding the schema version of a stored entity. Entities stored before
+// versioning do not have it and decode as version 0.
+const schemaVersionField = "SchemaVersion"
+
+// Current schema versions of the stored entities. Bump a version together with its upgrade in
+// entitySchemas when the stored layout changes, and run the migrate command after deploying.
+const (
+	messageSchemaVersion         = 1
+	fcmTokenSchemaVersion        = 1
+	userPreferencesSchemaVersion = 2
+	groupSettingsSchemaVersion   = 1
+	purgeAuditSchemaVersion      = 1
+	groupKeySchemaVersion        = 1
+	keyBundleSchemaVersion       = 1
+	revocationSchemaVersion      = 1
+	accessAuditSchemaVersion     = 1
+)
+
+// entityFields reads the properties of a stored entity. Missing properties read as zero values and values
+// stored with another type are converted where possible, so older or hand-edited entities never panic.
+type entityFields map[string]interface{}
+
+func decodeEntityFields(raw []byte) (entityFields, error) {
+	var fields entityFields
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal entity: %w", err)
+	}
+	return fields, nil
+}
+
+func (f entityFields) stringField(name string) string {
+	switch value := f[name].(type) {
+	case string:
+		return value
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func (f entityFields) boolField(name string) bool {
+	switch value := f[name].(type) {
+	case bool:
+		return value
+	case string:
+		parsed, _ := strconv.ParseBool(value)
+		return parsed
+	case float64:
+		return value != 0
+	default:
+		return false
+	}
+}
+
+func (f entityFields) intField(name string) int {
+	switch value := f[name].(type) {
+	case float64:
+		return int(value)
+	case string:
+		// Edm.Int64 values are sent as strings
+		parsed, _ := strconv.Atoi(value)
+		return parsed
+	default:
+		return 0
+	}
+}
+
+// timeField parses an RFC 3339 time. ok is false when the property is missing.
+func (f entityFields) timeField(name string) (t time.Time, ok bool, err error) {
+	value := f.stringField(name)
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	t, err = time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	return t, true, nil
+}
+
+func (f entityFields) schemaVersion() int {
+	return f.intField(schemaVersionField)
+}
+
+// sentAtFromRowKey recovers the sent time from a message RowKey
+func sentAtFromRowKey(rowKey string) (time.Time, error) {
+	inverted, _, _ := strings.Cut(strings.TrimPrefix(rowKey, messageRowKeyPrefix), "_")
+	if !strings.HasPrefix(rowKey, messageRowKeyPrefix) || inverted == "" {
+		return time.Time{}, fmt.Errorf("RowKey %q has no timestamp", rowKey)
+	}
+	value, err := strconv.ParseInt(inverted, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("RowKey %q has no timestamp: %w", rowKey, err)
+	}
+	return time.Unix(0, math.MaxInt64-value).UTC(), nil
+}
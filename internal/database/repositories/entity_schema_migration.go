@@ -0,0 +1,258 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"strings"
+)
+
+// SchemaMigrationsTable keeps the progress of entity schema upgrades, one entity per table and version
+const SchemaMigrationsTable = "SchemaMigrations"
+
+// entitySchema describes the versioned entities of one table and how to bring them to the current version
+type entitySchema struct {
+	table string
+	// filter selects the versioned entities of the table; empty selects every entity
+	filter  string
+	version int
+	// upgrade returns the entity in the current layout
+	upgrade func(fields entityFields) (interface{}, error)
+}
+
+func entitySchemas() []entitySchema {
+	mapper := &entityMapper{}
+
+	return []entitySchema{
+		{
+			table:   MessagesTable,
+			filter:  fmt.Sprintf("RowKey ge '%s' and RowKey lt '%s'", messageRowKeyPrefix, messageRowKeyRangeEnd),
+			version: messageSchemaVersion,
+			upgrade: func(fields entityFields) (interface{}, error) {
+				message, err := mapper.toMessage(fields)
+				if err != nil {
+					return nil, err
+				}
+				// Content is not decrypted, so encrypted content keeps its key
+				entity := mapper.toEntity(message.GroupID, message)
+				entity.ContentKeyID = fields.stringField(contentKeyIDField)
+				return entity, nil
+			},
+		},
+		{
+			table:   FCMTokensTable,
+			version: fcmTokenSchemaVersion,
+			upgrade: func(fields entityFields) (interface{}, error) {
+				entity := decodeFCMTokenEntity(fields)
+				entity.SchemaVersion = fcmTokenSchemaVersion
+				return entity, nil
+			},
+		},
+		{
+			table:   UserPreferencesTable,
+			version: userPreferencesSchemaVersion,
+			upgrade: func(fields entityFields) (interface{}, error) {
+				entity := decodeUserPreferencesEntity(fields)
+				entity.SchemaVersion = userPreferencesSchemaVersion
+				return entity, nil
+			},
+		},
+		{
+			table:   GroupSettingsTable,
+			version: groupSettingsSchemaVersion,
+			upgrade: func(fields entityFields) (interface{}, error) {
+				entity := decodeGroupSettingsEntity(fields)
+				entity.SchemaVersion = groupSettingsSchemaVersion
+				return entity, nil
+			},
+		},
+	}
+}
+
+// SchemaMigrationEntity is the saved progress of upgrading one table to one schema version
+type SchemaMigrationEntity struct {
+	PartitionKey     string `json:"PartitionKey"` // table name
+	RowKey           string `json:"RowKey"`       // "v" + target version
+	NextPartitionKey string `json:"NextPartitionKey"`
+	NextRowKey       string `json:"NextRowKey"`
+	Scanned          int    `json:"Scanned"`
+	Upgraded         int    `json:"Upgraded"`
+	Completed        bool   `json:"Completed"`
+}
+
+// SchemaUpgradeProgress reports how far the upgrade of one table is
+type SchemaUpgradeProgress struct {
+	Table     string
+	Version   int
+	Scanned   int
+	Upgraded  int
+	Completed bool
+}
+
+// UpgradeEntitySchemas rewrites the entities that were stored with an older schema version in the current
+// layout. Every table is read in batches of batchSize entities; after each batch the continuation is saved,
+// so an interrupted run resumes after the last finished batch. Tables already upgraded to the current
+// version are skipped unless restart is set. progress is called after every batch.
+func UpgradeEntitySchemas(ctx context.Context, client *TableService, batchSize int, restart bool, progress func(SchemaUpgradeProgress)) error {
+	checkpoints := client.NewClient(SchemaMigrationsTable)
+	if _, err := checkpoints.CreateTable(ctx, nil); err != nil && !strings.Contains(err.Error(), "TableAlreadyExists") {
+		return fmt.Errorf("failed to create/verify table: %w", err)
+	}
+
+	for _, schema := range entitySchemas() {
+		if err := upgradeTable(ctx, client.NewClient(schema.table), checkpoints, schema, batchSize, restart, progress); err != nil {
+			return fmt.Errorf("failed to upgrade %s: %w", schema.table, err)
+		}
+	}
+	return nil
+}
+
+func upgradeTable(ctx context.Context, table *aztables.Client, checkpoints *aztables.Client, schema entitySchema, batchSize int, restart bool, progress func(SchemaUpgradeProgress)) error {
+	checkpoint := SchemaMigrationEntity{PartitionKey: schema.table, RowKey: fmt.Sprintf("v%d", schema.version)}
+	if !restart {
+		response, err := checkpoints.GetEntity(ctx, checkpoint.PartitionKey, checkpoint.RowKey, nil)
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed to get checkpoint: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(response.Value, &checkpoint); err != nil {
+				return fmt.Errorf("failed to unmarshal checkpoint: %w", err)
+			}
+		}
+	}
+	report := func() {
+		if progress != nil {
+			progress(SchemaUpgradeProgress{
+				Table:     schema.table,
+				Version:   schema.version,
+				Scanned:   checkpoint.Scanned,
+				Upgraded:  checkpoint.Upgraded,
+				Completed: checkpoint.Completed,
+			})
+		}
+	}
+	if checkpoint.Completed {
+		report()
+		return nil
+	}
+
+	top := int32(batchSize)
+	options := &aztables.ListEntitiesOptions{Top: &top}
+	if schema.filter != "" {
+		options.Filter = &schema.filter
+	}
+	if checkpoint.NextPartitionKey != "" {
+		options.NextPartitionKey = &checkpoint.NextPartitionKey
+		options.NextRowKey = &checkpoint.NextRowKey
+	}
+
+	pager := table.NewListEntitiesPager(options)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			if strings.Contains(err.Error(), "TableNotFound") {
+				break
+			}
+			return fmt.Errorf("failed to list entities: %w", err)
+		}
+
+		upgraded, err := upgradeEntities(ctx, table, schema, page.Entities)
+		if err != nil {
+			return err
+		}
+
+		checkpoint.Scanned += len(page.Entities)
+		checkpoint.Upgraded += upgraded
+		checkpoint.NextPartitionKey, checkpoint.NextRowKey = "", ""
+		if page.NextPartitionKey != nil {
+			checkpoint.NextPartitionKey = *page.NextPartitionKey
+		}
+		if page.NextRowKey != nil {
+			checkpoint.NextRowKey = *page.NextRowKey
+		}
+		if err := saveCheckpoint(ctx, checkpoints, checkpoint); err != nil {
+			return err
+		}
+		report()
+	}
+
+	checkpoint.Completed = true
+	if err := saveCheckpoint(ctx, checkpoints, checkpoint); err != nil {
+		return err
+	}
+	report()
+	return nil
+}
+
+// upgradeEntities rewrites the outdated entities of one batch. Entities of a partition are replaced together
+// and only if they did not change since they were read; a conflicting write fails the batch, which is then
+// retried by running the upgrade again.
+func upgradeEntities(ctx context.Context, table *aztables.Client, schema entitySchema, entities [][]byte) (int, error) {
+	var actions []aztables.TransactionAction
+	partitionKey := ""
+	upgraded := 0
+
+	flush := func() error {
+		if len(actions) == 0 {
+			return nil
+		}
+		if _, err := table.SubmitTransaction(ctx, actions, nil); err != nil {
+			return fmt.Errorf("failed to upgrade entities of partition %s: %w", partitionKey, err)
+		}
+		upgraded += len(actions)
+		actions = actions[:0]
+		return nil
+	}
+
+	for _, raw := range entities {
+		fields, err := decodeEntityFields(raw)
+		if err != nil {
+			return upgraded, err
+		}
+		if fields.schemaVersion() >= schema.version {
+			continue
+		}
+
+		entity, err := schema.upgrade(fields)
+		if err != nil {
+			return upgraded, fmt.Errorf("failed to upgrade entity %s/%s: %w",
+				fields.stringField("PartitionKey"), fields.stringField("RowKey"), err)
+		}
+		marshaled, err := json.Marshal(entity)
+		if err != nil {
+			return upgraded, fmt.Errorf("failed to marshal entity: %w", err)
+		}
+
+		if key := fields.stringField("PartitionKey"); key != partitionKey || len(actions) == maxTransactionActions {
+			if err := flush(); err != nil {
+				return upgraded, err
+			}
+			partitionKey = key
+		}
+		etag := azcore.ETag(fields.stringField("odata.etag"))
+		actions = append(actions, aztables.TransactionAction{
+			ActionType: aztables.TransactionTypeUpdateReplace,
+			Entity:     marshaled,
+			IfMatch:    &etag,
+		})
+	}
+
+	return upgraded, flush()
+}
+
+func saveCheckpoint(ctx context.Context, checkpoints *aztables.Client, checkpoint SchemaMigrationEntity) error {
+	marshaled, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+
+	_, err = checkpoints.UpsertEntity(ctx, marshaled, &aztables.UpsertEntityOptions{
+		UpdateMode: aztables.UpdateModeReplace,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
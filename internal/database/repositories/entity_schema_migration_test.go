@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUpgradeEntitySchemas needs Azure Table Storage; set AZURE_TEST_CONNECTION_STRING (e.g. Azurite) to run it
+func TestUpgradeEntitySchemas(t *testing.T) {
+	connectionString := os.Getenv("AZURE_TEST_CONNECTION_STRING")
+	if connectionString == "" {
+		t.Skip("AZURE_TEST_CONNECTION_STRING is not set")
+	}
+	ctx := context.Background()
+
+	client, err := NewTableClient(connectionString)
+	require.NoError(t, err)
+	_, err = NewAzureRepositories(client)
+	require.NoError(t, err)
+
+	// A message as written before entities were versioned, without a sender name
+	groupID := uuid.New()
+	messageID := uuid.New()
+	sentAt := time.Now().UTC().Truncate(time.Second)
+	unversioned, err := json.Marshal(map[string]interface{}{
+		"PartitionKey": groupID.String(),
+		"RowKey":       messageRowKey(sentAt, messageID),
+		"MessageID":    messageID.String(),
+		"SenderID":     uuid.NewString(),
+		"Content":      "Hallo",
+		"SentAt":       sentAt.Format(time.RFC3339Nano),
+		"IsPinned":     false,
+	})
+	require.NoError(t, err)
+	table := client.NewClient(MessagesTable)
+	_, err = table.AddEntity(ctx, unversioned, nil)
+	require.NoError(t, err)
+
+	var last SchemaUpgradeProgress
+	require.NoError(t, UpgradeEntitySchemas(ctx, client, 50, true, func(progress SchemaUpgradeProgress) {
+		if progress.Table == MessagesTable {
+			last = progress
+		}
+	}))
+	assert.True(t, last.Completed)
+	assert.Positive(t, last.Upgraded)
+
+	response, err := table.GetEntity(ctx, groupID.String(), messageRowKey(sentAt, messageID), nil)
+	require.NoError(t, err)
+	fields, err := decodeEntityFields(response.Value)
+	require.NoError(t, err)
+	assert.Equal(t, messageSchemaVersion, fields.schemaVersion())
+	assert.Equal(t, "Hallo", fields.stringField("Content"))
+
+	// A finished upgrade is not repeated
+	calls := 0
+	require.NoError(t, UpgradeEntitySchemas(ctx, client, 50, false, func(progress SchemaUpgradeProgress) {
+		calls++
+		assert.True(t, progress.Completed)
+	}))
+	assert.Equal(t, len(entitySchemas()), calls)
+}
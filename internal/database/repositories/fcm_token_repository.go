@@ -16,7 +16,7 @@ type FcmTokenRepository struct {
 	table *aztables.Client
 }
 
-func NewFCMTokenRepository(client *aztables.ServiceClient) (*FcmTokenRepository, error) {
+func NewFCMTokenRepository(client *TableService) (*FcmTokenRepository, error) {
 	table := client.NewClient(FCMTokensTable)
 
 	_, err := table.CreateTable(context.Background(), nil)
@@ -30,31 +30,34 @@ func NewFCMTokenRepository(client *aztables.ServiceClient) (*FcmTokenRepository,
 	return &FcmTokenRepository{table: table}, nil
 }
 
-func (r *FcmTokenRepository) GetGroupMemberTokens(ctx context.Context, groupID uuid.UUID) ([]string, error) {
-	filter := fmt.Sprintf("PartitionKey eq '%s' and IsActive eq true", groupID.String())
+func (r *FcmTokenRepository) GetGroupMemberTokens(ctx context.Context, groupID uuid.UUID) ([]models.FCMToken, error) {
+	return r.listTokens(ctx, fmt.Sprintf("PartitionKey eq '%s' and IsActive eq true", groupID.String()))
+}
+
+// ListTokens returns the active tokens of every group
+func (r *FcmTokenRepository) ListTokens(ctx context.Context) ([]models.FCMToken, error) {
+	return r.listTokens(ctx, "IsActive eq true")
+}
+
+func (r *FcmTokenRepository) listTokens(ctx context.Context, filter string) ([]models.FCMToken, error) {
 	pager := r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{
 		Filter: &filter,
 	})
 
-	var tokens []string
+	var tokens []models.FCMToken
 
 	for pager.More() {
 		page, err := pager.NextPage(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to list group member tokens: %w", err)
+			return nil, fmt.Errorf("failed to list tokens: %w", err)
 		}
 
 		for _, entity := range page.Entities {
-			var temp struct {
-				PartitionKey string `json:"PartitionKey"`
-				RowKey       string `json:"RowKey"`
-				Token        string `json:"Token"`
-				IsActive     bool   `json:"IsActive"`
-				Timestamp    string `json:"Timestamp"`
-			}
-			if err := json.Unmarshal(entity, &temp); err != nil {
+			fields, err := decodeEntityFields(entity)
+			if err != nil {
 				return nil, err
 			}
+			temp := decodeFCMTokenEntity(fields)
 
 			// Convert string timestamp to timestamppb.Timestamp
 			timestamp, err := time.Parse(time.RFC3339, temp.Timestamp)
@@ -67,10 +70,11 @@ func (r *FcmTokenRepository) GetGroupMemberTokens(ctx context.Context, groupID u
 				RowKey:       temp.RowKey,
 				Token:        temp.Token,
 				IsActive:     temp.IsActive,
+				Locale:       temp.Locale,
 				Timestamp:    timestamppb.New(timestamp),
 			}
 
-			tokens = append(tokens, tokenEntity.Token)
+			tokens = append(tokens, tokenEntity)
 		}
 	}
 
@@ -78,20 +82,37 @@ func (r *FcmTokenRepository) GetGroupMemberTokens(ctx context.Context, groupID u
 }
 
 type AzureTableEntity struct {
-	PartitionKey string `json:"PartitionKey"`
-	RowKey       string `json:"RowKey"`
-	Token        string `json:"Token"`
-	IsActive     bool   `json:"IsActive"`
-	Timestamp    string `json:"Timestamp"`
+	PartitionKey  string `json:"PartitionKey"`
+	RowKey        string `json:"RowKey"`
+	Token         string `json:"Token"`
+	IsActive      bool   `json:"IsActive"`
+	Locale        string `json:"Locale"`
+	Timestamp     string `json:"Timestamp"`
+	SchemaVersion int    `json:"SchemaVersion"`
 }
 
-func (r *FcmTokenRepository) SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string) error {
+// decodeFCMTokenEntity reads a stored token entity of any schema version
+func decodeFCMTokenEntity(fields entityFields) AzureTableEntity {
+	return AzureTableEntity{
+		PartitionKey:  fields.stringField("PartitionKey"),
+		RowKey:        fields.stringField("RowKey"),
+		Token:         fields.stringField("Token"),
+		IsActive:      fields.boolField("IsActive"),
+		Locale:        fields.stringField("Locale"),
+		Timestamp:     fields.stringField("Timestamp"),
+		SchemaVersion: fields.schemaVersion(),
+	}
+}
+
+func (r *FcmTokenRepository) SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string, locale string) error {
 	entity := AzureTableEntity{
-		PartitionKey: groupID.String(),
-		RowKey:       userID.String(),
-		Token:        token,
-		IsActive:     true,
-		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		PartitionKey:  groupID.String(),
+		RowKey:        userID.String(),
+		Token:         token,
+		IsActive:      true,
+		Locale:        locale,
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		SchemaVersion: fcmTokenSchemaVersion,
 	}
 
 	marshaled, err := json.Marshal(entity)
@@ -115,6 +136,9 @@ func (r *FcmTokenRepository) DeleteToken(ctx context.Context, groupID uuid.UUID,
 
 	_, err := r.table.DeleteEntity(ctx, partitionKey, rowKey, nil)
 	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("token of user %s: %w", userID, ErrNotFound)
+		}
 		return fmt.Errorf("failed to delete token: %w", err)
 	}
 
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+type groupKeyRepository struct {
+	table *aztables.Client
+}
+
+// GroupKeyEntity is one wrapped data key version of a group
+type GroupKeyEntity struct {
+	PartitionKey  string `json:"PartitionKey"` // GroupID
+	RowKey        string `json:"RowKey"`       // "v" + zero padded version
+	Version       int    `json:"Version"`
+	MasterKeyID   string `json:"MasterKeyID"`
+	WrappedKey    string `json:"WrappedKey"` // base64
+	CreatedAt     string `json:"CreatedAt"`
+	SchemaVersion int    `json:"SchemaVersion"`
+}
+
+func groupKeyRowKey(version int) string {
+	return fmt.Sprintf("v%06d", version)
+}
+
+func toGroupKeyEntity(key *models.GroupKey) GroupKeyEntity {
+	return GroupKeyEntity{
+		PartitionKey:  key.GroupID.String(),
+		RowKey:        groupKeyRowKey(key.Version),
+		Version:       key.Version,
+		MasterKeyID:   key.MasterKeyID,
+		WrappedKey:    base64.StdEncoding.EncodeToString(key.WrappedKey),
+		CreatedAt:     key.CreatedAt.UTC().Format(time.RFC3339Nano),
+		SchemaVersion: groupKeySchemaVersion,
+	}
+}
+
+func decodeGroupKey(raw []byte) (*models.GroupKey, error) {
+	fields, err := decodeEntityFields(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	groupID, err := uuid.Parse(fields.stringField("PartitionKey"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse group ID: %w", err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(fields.stringField("WrappedKey"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode wrapped key of group %s: %w", groupID, err)
+	}
+	createdAt, _, err := fields.timeField("CreatedAt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key creation time: %w", err)
+	}
+
+	return &models.GroupKey{
+		GroupID:     groupID,
+		Version:     fields.intField("Version"),
+		MasterKeyID: fields.stringField("MasterKeyID"),
+		WrappedKey:  wrapped,
+		CreatedAt:   createdAt,
+	}, nil
+}
+
+func NewGroupKeyRepository(client *TableService) (GroupKeyRepository, error) {
+	table := client.NewClient(GroupKeysTable)
+
+	_, err := table.CreateTable(context.Background(), nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "TableAlreadyExists") {
+			return &groupKeyRepository{table: table}, nil
+		}
+		return nil, fmt.Errorf("failed to create/verify table: %w", err)
+	}
+
+	return &groupKeyRepository{table: table}, nil
+}
+
+// GetGroupKeys returns the key versions of a group, oldest first
+func (r *groupKeyRepository) GetGroupKeys(ctx context.Context, groupID uuid.UUID) ([]models.GroupKey, error) {
+	filter := fmt.Sprintf("PartitionKey eq '%s'", groupID.String())
+	return r.listKeys(ctx, &filter)
+}
+
+func (r *groupKeyRepository) CreateGroupKey(ctx context.Context, key *models.GroupKey) error {
+	marshaled, err := json.Marshal(toGroupKeyEntity(key))
+	if err != nil {
+		return fmt.Errorf("failed to marshal entity: %w", err)
+	}
+
+	if _, err := r.table.AddEntity(ctx, marshaled, nil); err != nil {
+		if isAlreadyExists(err) {
+			return fmt.Errorf("key version %d of group %s: %w", key.Version, key.GroupID, ErrConflict)
+		}
+		return fmt.Errorf("failed to create group key: %w", err)
+	}
+	return nil
+}
+
+func (r *groupKeyRepository) UpdateGroupKey(ctx context.Context, key *models.GroupKey) error {
+	marshaled, err := json.Marshal(toGroupKeyEntity(key))
+	if err != nil {
+		return fmt.Errorf("failed to marshal entity: %w", err)
+	}
+
+	_, err = r.table.UpdateEntity(ctx, marshaled, &aztables.UpdateEntityOptions{UpdateMode: aztables.UpdateModeReplace})
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("key version %d of group %s: %w", key.Version, key.GroupID, ErrNotFound)
+		}
+		return fmt.Errorf("failed to update group key: %w", err)
+	}
+	return nil
+}
+
+// ListGroupKeys returns the key versions of every group, by group and oldest first
+func (r *groupKeyRepository) ListGroupKeys(ctx context.Context) ([]models.GroupKey, error) {
+	return r.listKeys(ctx, nil)
+}
+
+func (r *groupKeyRepository) listKeys(ctx context.Context, filter *string) ([]models.GroupKey, error) {
+	pager := r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: filter})
+
+	var keys []models.GroupKey
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list group keys: %w", err)
+		}
+		for _, raw := range page.Entities {
+			key, err := decodeGroupKey(raw)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, *key)
+		}
+	}
+	return keys, nil
+}
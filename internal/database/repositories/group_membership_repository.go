@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/util"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+type groupMembershipRepository struct {
+	baseURL    string
+	httpClient *http.Client
+	logger     util.Logger
+}
+
+func NewGroupMembershipRepository(baseURL string, loggerFactory util.LoggerFactory) GroupMembershipRepository {
+	return &groupMembershipRepository{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		logger:     loggerFactory.NewLogger("GroupMembershipRepository"),
+	}
+}
+
+// ListUserGroups calls GET /users/{userId}/groups on the user service, which returns the groups of the user as
+// [{"id": "<group ID>"}, ...]
+func (r *groupMembershipRepository) ListUserGroups(ctx context.Context, userID uuid.UUID, accessToken string) ([]uuid.UUID, error) {
+	groupsURL := fmt.Sprintf("%s/users/%s/groups", r.baseURL, userID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, groupsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		r.logger.WithContext(ctx).Error("HTTP request failed", "error", err)
+		return nil, fmt.Errorf("failed to list groups of user %s: %w", userID, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to list groups of user %s: user service returned %s", userID, resp.Status)
+	}
+
+	var groups []struct {
+		ID uuid.UUID `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
+		return nil, fmt.Errorf("failed to parse groups of user %s: %w", userID, err)
+	}
+	groupIDs := make([]uuid.UUID, 0, len(groups))
+	for _, group := range groups {
+		groupIDs = append(groupIDs, group.ID)
+	}
+	return groupIDs, nil
+}
@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/google/uuid"
+	"strings"
+)
+
+// settingsRowKey is the fixed RowKey of the single settings entity stored per group partition
+const settingsRowKey = "settings"
+
+type groupSettingsRepository struct {
+	table *aztables.Client
+}
+
+type GroupSettingsEntity struct {
+	PartitionKey         string `json:"PartitionKey"` // GroupID
+	RowKey               string `json:"RowKey"`
+	PrivateNotifications bool   `json:"PrivateNotifications"`
+	DigestExcludeContent bool   `json:"DigestExcludeContent"`
+	RetentionDays        int    `json:"RetentionDays"`
+	RetentionKeepPinned  bool   `json:"RetentionKeepPinned"`
+	EndToEndEncrypted    bool   `json:"EndToEndEncrypted"`
+	AllowMessageDeletion bool   `json:"AllowMessageDeletion"`
+	SchemaVersion        int    `json:"SchemaVersion"`
+}
+
+// decodeGroupSettingsEntity reads a stored settings entity of any schema version
+func decodeGroupSettingsEntity(fields entityFields) GroupSettingsEntity {
+	return GroupSettingsEntity{
+		PartitionKey:         fields.stringField("PartitionKey"),
+		RowKey:               fields.stringField("RowKey"),
+		PrivateNotifications: fields.boolField("PrivateNotifications"),
+		DigestExcludeContent: fields.boolField("DigestExcludeContent"),
+		RetentionDays:        fields.intField("RetentionDays"),
+		RetentionKeepPinned:  fields.boolField("RetentionKeepPinned"),
+		EndToEndEncrypted:    fields.boolField("EndToEndEncrypted"),
+		AllowMessageDeletion: fields.boolField("AllowMessageDeletion"),
+		SchemaVersion:        fields.schemaVersion(),
+	}
+}
+
+func (e *GroupSettingsEntity) toSettings(groupID uuid.UUID) *models.GroupSettings {
+	return &models.GroupSettings{
+		GroupID:              groupID,
+		PrivateNotifications: e.PrivateNotifications,
+		DigestExcludeContent: e.DigestExcludeContent,
+		RetentionDays:        e.RetentionDays,
+		RetentionKeepPinned:  e.RetentionKeepPinned,
+		EndToEndEncrypted:    e.EndToEndEncrypted,
+		AllowMessageDeletion: e.AllowMessageDeletion,
+	}
+}
+
+func NewGroupSettingsRepository(client *TableService) (GroupSettingsRepository, error) {
+	table := client.NewClient(GroupSettingsTable)
+
+	_, err := table.CreateTable(context.Background(), nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "TableAlreadyExists") {
+			return &groupSettingsRepository{table: table}, nil
+		}
+		return nil, fmt.Errorf("failed to create/verify table: %w", err)
+	}
+
+	return &groupSettingsRepository{table: table}, nil
+}
+
+// GetSettings returns the stored settings of a group, or default settings when none were saved yet
+func (r *groupSettingsRepository) GetSettings(ctx context.Context, groupID uuid.UUID) (*models.GroupSettings, error) {
+	response, err := r.table.GetEntity(ctx, groupID.String(), settingsRowKey, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return &models.GroupSettings{GroupID: groupID}, nil
+		}
+		return nil, fmt.Errorf("failed to get group settings: %w", err)
+	}
+
+	fields, err := decodeEntityFields(response.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal group settings: %w", err)
+	}
+
+	entity := decodeGroupSettingsEntity(fields)
+	return entity.toSettings(groupID), nil
+}
+
+func (r *groupSettingsRepository) SaveSettings(ctx context.Context, settings *models.GroupSettings) error {
+	entity := GroupSettingsEntity{
+		PartitionKey:         settings.GroupID.String(),
+		RowKey:               settingsRowKey,
+		PrivateNotifications: settings.PrivateNotifications,
+		DigestExcludeContent: settings.DigestExcludeContent,
+		RetentionDays:        settings.RetentionDays,
+		RetentionKeepPinned:  settings.RetentionKeepPinned,
+		EndToEndEncrypted:    settings.EndToEndEncrypted,
+		AllowMessageDeletion: settings.AllowMessageDeletion,
+		SchemaVersion:        groupSettingsSchemaVersion,
+	}
+
+	marshaled, err := json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entity: %w", err)
+	}
+
+	_, err = r.table.UpsertEntity(ctx, marshaled, &aztables.UpsertEntityOptions{
+		UpdateMode: aztables.UpdateModeReplace,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save group settings (upsert): %w", err)
+	}
+
+	return nil
+}
+
+// ListRetentionPolicies returns the settings of every group that has a retention period
+func (r *groupSettingsRepository) ListRetentionPolicies(ctx context.Context) ([]models.GroupSettings, error) {
+	return r.listSettings(ctx, fmt.Sprintf("RowKey eq '%s' and RetentionDays gt 0", settingsRowKey))
+}
+
+// ListSettings returns the stored settings of every group
+func (r *groupSettingsRepository) ListSettings(ctx context.Context) ([]models.GroupSettings, error) {
+	return r.listSettings(ctx, fmt.Sprintf("RowKey eq '%s'", settingsRowKey))
+}
+
+func (r *groupSettingsRepository) listSettings(ctx context.Context, filter string) ([]models.GroupSettings, error) {
+	pager := r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: &filter,
+	})
+
+	var list []models.GroupSettings
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list group settings: %w", err)
+		}
+
+		for _, raw := range page.Entities {
+			fields, err := decodeEntityFields(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal group settings: %w", err)
+			}
+			entity := decodeGroupSettingsEntity(fields)
+
+			groupID, err := uuid.Parse(entity.PartitionKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse group ID: %w", err)
+			}
+			list = append(list, *entity.toSettings(groupID))
+		}
+	}
+
+	return list, nil
+}
@@ -10,18 +10,98 @@ import (
 type MessageRepository interface {
 	GetMessages(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error)
 	CreateMessage(ctx context.Context, groupID uuid.UUID, message *models.Message) error
-	ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error)
+	// ToggleMessagePin flips the pin of a message. A non-empty ifMatch only updates the message while it still
+	// has that ETag and returns ErrConflict otherwise.
+	ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID, ifMatch string) (*models.Message, error)
 	GetMessageByID(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error)
 	GetLastReadTime(ctx context.Context, groupID uuid.UUID, userID uuid.UUID) (time.Time, error)
 	CountUnreadMessages(ctx context.Context, groupID uuid.UUID, lastReadTime time.Time) (int, error)
+	GetMessagesSince(ctx context.Context, groupID uuid.UUID, since time.Time, limit int) ([]models.Message, error)
+	SearchMessages(ctx context.Context, groupID uuid.UUID, query models.SearchQuery) ([]models.Message, *models.PaginationResponse, error)
+	ListExpiredMessages(ctx context.Context, groupID uuid.UUID, query models.RetentionQuery) ([]models.Message, error)
+	DeleteMessages(ctx context.Context, groupID uuid.UUID, messages []models.Message) error
+	// ListGroupIDs returns the IDs of the groups that have stored messages
+	ListGroupIDs(ctx context.Context) ([]uuid.UUID, error)
 }
 
 type FCMTokenRepository interface {
-	GetGroupMemberTokens(ctx context.Context, groupID uuid.UUID) ([]string, error)
-	SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string) error
+	GetGroupMemberTokens(ctx context.Context, groupID uuid.UUID) ([]models.FCMToken, error)
+	SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string, locale string) error
 	DeleteToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID) error
+	// ListTokens returns the active tokens of every group
+	ListTokens(ctx context.Context) ([]models.FCMToken, error)
+}
+
+type UserPreferencesRepository interface {
+	GetPreferences(ctx context.Context, userID uuid.UUID) (*models.UserPreferences, error)
+	SavePreferences(ctx context.Context, preferences *models.UserPreferences) error
+	ListDigestSubscribers(ctx context.Context) ([]models.UserPreferences, error)
+	// ListPreferences returns the stored preferences of every user
+	ListPreferences(ctx context.Context) ([]models.UserPreferences, error)
+}
+
+type GroupSettingsRepository interface {
+	GetSettings(ctx context.Context, groupID uuid.UUID) (*models.GroupSettings, error)
+	SaveSettings(ctx context.Context, settings *models.GroupSettings) error
+	ListRetentionPolicies(ctx context.Context) ([]models.GroupSettings, error)
+	// ListSettings returns the stored settings of every group
+	ListSettings(ctx context.Context) ([]models.GroupSettings, error)
+}
+
+type PurgeAuditRepository interface {
+	RecordPurge(ctx context.Context, audit *models.PurgeAudit) error
+	ListPurges(ctx context.Context, groupID uuid.UUID) ([]models.PurgeAudit, error)
+	// ListAllPurges returns the purge records of every group
+	ListAllPurges(ctx context.Context) ([]models.PurgeAudit, error)
+}
+
+// AccessAuditRepository stores the audit trail of users overseeing groups
+type AccessAuditRepository interface {
+	RecordAccess(ctx context.Context, audit *models.AccessAudit) error
+	ListAccesses(ctx context.Context, groupID uuid.UUID) ([]models.AccessAudit, error)
+	// ListAllAccesses returns the access records of every group
+	ListAllAccesses(ctx context.Context) ([]models.AccessAudit, error)
+}
+
+// GroupKeyRepository stores the wrapped data keys that encrypt message content
+type GroupKeyRepository interface {
+	// GetGroupKeys returns the key versions of a group, oldest first
+	GetGroupKeys(ctx context.Context, groupID uuid.UUID) ([]models.GroupKey, error)
+	// CreateGroupKey adds a key version and returns ErrConflict when the version already exists
+	CreateGroupKey(ctx context.Context, key *models.GroupKey) error
+	// UpdateGroupKey replaces the wrapped key of an existing version
+	UpdateGroupKey(ctx context.Context, key *models.GroupKey) error
+	// ListGroupKeys returns the key versions of every group
+	ListGroupKeys(ctx context.Context) ([]models.GroupKey, error)
+}
+
+// KeyBundleRepository stores the public key bundles devices publish for end-to-end encrypted groups
+type KeyBundleRepository interface {
+	// SaveBundle stores the bundle of a device, replacing the bundle and one-time pre-keys it had
+	SaveBundle(ctx context.Context, bundle *models.KeyBundle) error
+	// ListBundles returns the bundles of every device in a group, without their one-time pre-keys
+	ListBundles(ctx context.Context, groupID uuid.UUID) ([]models.KeyBundle, error)
+	// ListAllBundles returns the bundles of every device in every group, without their one-time pre-keys
+	ListAllBundles(ctx context.Context) ([]models.KeyBundle, error)
+	// ClaimPreKey removes and returns one one-time pre-key of a device, or nil when it has none left
+	ClaimPreKey(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, deviceID string) (*models.PreKey, error)
+}
+
+// TokenRevocationRepository stores the denylist of revoked access tokens and sessions. The list is shared by
+// every tenant.
+type TokenRevocationRepository interface {
+	// Revoke stores a revocation, replacing an earlier one of the same kind and ID
+	Revoke(ctx context.Context, revocation *models.TokenRevocation) error
+	// ListRevocations returns the revocations that are still in force at the given time
+	ListRevocations(ctx context.Context, at time.Time) ([]models.TokenRevocation, error)
 }
 
 type HealthRepository interface {
 	CheckHealth(ctx context.Context) (*models.HealthResponse, error)
 }
+
+// GroupMembershipRepository asks the user service which groups a user belongs to
+type GroupMembershipRepository interface {
+	// ListUserGroups returns the IDs of the groups of a user. The access token of the user authenticates the call.
+	ListUserGroups(ctx context.Context, userID uuid.UUID, accessToken string) ([]uuid.UUID, error)
+}
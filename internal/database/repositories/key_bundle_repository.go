@@ -0,0 +1,197 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+type keyBundleRepository struct {
+	table *aztables.Client
+}
+
+// KeyBundleEntity is the published key bundle of one device
+type KeyBundleEntity struct {
+	PartitionKey   string `json:"PartitionKey"` // GroupID
+	RowKey         string `json:"RowKey"`       // UserID + "_" + DeviceID
+	UserID         string `json:"UserID"`
+	DeviceID       string `json:"DeviceID"`
+	IdentityKey    string `json:"IdentityKey"`
+	SignedPreKey   string `json:"SignedPreKey"`   // JSON
+	OneTimePreKeys string `json:"OneTimePreKeys"` // JSON
+	UpdatedAt      string `json:"UpdatedAt"`
+	SchemaVersion  int    `json:"SchemaVersion"`
+}
+
+func keyBundleRowKey(userID uuid.UUID, deviceID string) string {
+	return userID.String() + "_" + deviceID
+}
+
+func toKeyBundleEntity(bundle *models.KeyBundle) (KeyBundleEntity, error) {
+	signedPreKey, err := json.Marshal(bundle.SignedPreKey)
+	if err != nil {
+		return KeyBundleEntity{}, fmt.Errorf("failed to marshal signed pre-key: %w", err)
+	}
+	oneTimePreKeys, err := json.Marshal(bundle.OneTimePreKeys)
+	if err != nil {
+		return KeyBundleEntity{}, fmt.Errorf("failed to marshal one-time pre-keys: %w", err)
+	}
+
+	return KeyBundleEntity{
+		PartitionKey:   bundle.GroupID.String(),
+		RowKey:         keyBundleRowKey(bundle.UserID, bundle.DeviceID),
+		UserID:         bundle.UserID.String(),
+		DeviceID:       bundle.DeviceID,
+		IdentityKey:    bundle.IdentityKey,
+		SignedPreKey:   string(signedPreKey),
+		OneTimePreKeys: string(oneTimePreKeys),
+		UpdatedAt:      bundle.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		SchemaVersion:  keyBundleSchemaVersion,
+	}, nil
+}
+
+func decodeKeyBundle(fields entityFields) (*models.KeyBundle, error) {
+	groupID, err := uuid.Parse(fields.stringField("PartitionKey"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse group ID: %w", err)
+	}
+	userID, err := uuid.Parse(fields.stringField("UserID"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse user ID: %w", err)
+	}
+	updatedAt, _, err := fields.timeField("UpdatedAt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bundle update time: %w", err)
+	}
+
+	bundle := &models.KeyBundle{
+		GroupID:     groupID,
+		UserID:      userID,
+		DeviceID:    fields.stringField("DeviceID"),
+		IdentityKey: fields.stringField("IdentityKey"),
+		UpdatedAt:   updatedAt,
+	}
+	if value := fields.stringField("SignedPreKey"); value != "" {
+		if err := json.Unmarshal([]byte(value), &bundle.SignedPreKey); err != nil {
+			return nil, fmt.Errorf("failed to parse signed pre-key of %s: %w", fields.stringField("RowKey"), err)
+		}
+	}
+	if value := fields.stringField("OneTimePreKeys"); value != "" {
+		if err := json.Unmarshal([]byte(value), &bundle.OneTimePreKeys); err != nil {
+			return nil, fmt.Errorf("failed to parse one-time pre-keys of %s: %w", fields.stringField("RowKey"), err)
+		}
+	}
+	return bundle, nil
+}
+
+func NewKeyBundleRepository(client *TableService) (KeyBundleRepository, error) {
+	table := client.NewClient(KeyBundlesTable)
+
+	_, err := table.CreateTable(context.Background(), nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "TableAlreadyExists") {
+			return &keyBundleRepository{table: table}, nil
+		}
+		return nil, fmt.Errorf("failed to create/verify table: %w", err)
+	}
+
+	return &keyBundleRepository{table: table}, nil
+}
+
+func (r *keyBundleRepository) SaveBundle(ctx context.Context, bundle *models.KeyBundle) error {
+	entity, err := toKeyBundleEntity(bundle)
+	if err != nil {
+		return err
+	}
+	marshaled, err := json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entity: %w", err)
+	}
+
+	_, err = r.table.UpsertEntity(ctx, marshaled, &aztables.UpsertEntityOptions{
+		UpdateMode: aztables.UpdateModeReplace,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save key bundle (upsert): %w", err)
+	}
+	return nil
+}
+
+// ListBundles returns the bundles of every device in a group, by user and device
+func (r *keyBundleRepository) ListBundles(ctx context.Context, groupID uuid.UUID) ([]models.KeyBundle, error) {
+	filter := fmt.Sprintf("PartitionKey eq '%s'", groupID.String())
+	return r.listBundles(ctx, &filter)
+}
+
+// ListAllBundles returns the bundles of every device in every group
+func (r *keyBundleRepository) ListAllBundles(ctx context.Context) ([]models.KeyBundle, error) {
+	return r.listBundles(ctx, nil)
+}
+
+func (r *keyBundleRepository) listBundles(ctx context.Context, filter *string) ([]models.KeyBundle, error) {
+	pager := r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: filter})
+
+	var bundles []models.KeyBundle
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list key bundles: %w", err)
+		}
+		for _, raw := range page.Entities {
+			fields, err := decodeEntityFields(raw)
+			if err != nil {
+				return nil, err
+			}
+			bundle, err := decodeKeyBundle(fields)
+			if err != nil {
+				return nil, err
+			}
+			bundle.OneTimePreKeys = nil
+			bundles = append(bundles, *bundle)
+		}
+	}
+	return bundles, nil
+}
+
+// ClaimPreKey removes the first one-time pre-key of a device. Concurrent claims are serialised by the ETag
+// of the bundle, so every pre-key is handed out once.
+func (r *keyBundleRepository) ClaimPreKey(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, deviceID string) (*models.PreKey, error) {
+	ops := &tableOperations{table: r.table}
+
+	for attempt := 1; ; attempt++ {
+		raw, err := ops.getAndUnmarshalEntity(ctx, groupID.String(), keyBundleRowKey(userID, deviceID))
+		if err != nil {
+			if isNotFound(err) {
+				return nil, fmt.Errorf("key bundle of device %s: %w", deviceID, ErrNotFound)
+			}
+			return nil, err
+		}
+		fields := entityFields(raw)
+		bundle, err := decodeKeyBundle(fields)
+		if err != nil {
+			return nil, err
+		}
+		if len(bundle.OneTimePreKeys) == 0 {
+			return nil, nil
+		}
+
+		claimed := bundle.OneTimePreKeys[0]
+		bundle.OneTimePreKeys = bundle.OneTimePreKeys[1:]
+		entity, err := toKeyBundleEntity(bundle)
+		if err != nil {
+			return nil, err
+		}
+		_, err = ops.updateEntity(ctx, entity, fields.stringField("odata.etag"))
+		if err == nil {
+			return &claimed, nil
+		}
+		if !isConditionNotSatisfied(err) || attempt == maxUpdateAttempts {
+			return nil, fmt.Errorf("failed to claim pre-key of device %s: %w", deviceID, err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"slices"
+	"sync"
+)
+
+type memoryAccessAuditRepository struct {
+	mu     sync.RWMutex
+	audits map[uuid.UUID][]models.AccessAudit
+}
+
+func NewMemoryAccessAuditRepository() AccessAuditRepository {
+	return &memoryAccessAuditRepository{audits: make(map[uuid.UUID][]models.AccessAudit)}
+}
+
+func (r *memoryAccessAuditRepository) RecordAccess(_ context.Context, audit *models.AccessAudit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.audits[audit.GroupID] = append(r.audits[audit.GroupID], *audit)
+	return nil
+}
+
+// ListAccesses returns the access records of a group, newest first
+func (r *memoryAccessAuditRepository) ListAccesses(_ context.Context, groupID uuid.UUID) ([]models.AccessAudit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	audits := slices.Clone(r.audits[groupID])
+	slices.SortStableFunc(audits, func(a, b models.AccessAudit) int {
+		return b.AccessedAt.Compare(a.AccessedAt)
+	})
+	return audits, nil
+}
+
+// ListAllAccesses returns the access records of every group
+func (r *memoryAccessAuditRepository) ListAllAccesses(_ context.Context) ([]models.AccessAudit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var audits []models.AccessAudit
+	for _, group := range r.audits {
+		audits = append(audits, group...)
+	}
+	return audits, nil
+}
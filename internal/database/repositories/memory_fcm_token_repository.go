@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sync"
+	"time"
+)
+
+type memoryFCMTokenRepository struct {
+	mu     sync.RWMutex
+	tokens map[uuid.UUID]map[uuid.UUID]models.FCMToken // GroupID -> UserID -> token
+}
+
+func NewMemoryFCMTokenRepository() FCMTokenRepository {
+	return &memoryFCMTokenRepository{tokens: make(map[uuid.UUID]map[uuid.UUID]models.FCMToken)}
+}
+
+func (r *memoryFCMTokenRepository) GetGroupMemberTokens(_ context.Context, groupID uuid.UUID) ([]models.FCMToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tokens []models.FCMToken
+	for _, token := range r.tokens[groupID] {
+		if token.IsActive {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *memoryFCMTokenRepository) SaveToken(_ context.Context, groupID uuid.UUID, userID uuid.UUID, token string, locale string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.tokens[groupID]
+	if !ok {
+		group = make(map[uuid.UUID]models.FCMToken)
+		r.tokens[groupID] = group
+	}
+
+	group[userID] = models.FCMToken{
+		PartitionKey: groupID.String(),
+		RowKey:       userID.String(),
+		Token:        token,
+		IsActive:     true,
+		Locale:       locale,
+		Timestamp:    timestamppb.New(time.Now().UTC()),
+	}
+	return nil
+}
+
+func (r *memoryFCMTokenRepository) DeleteToken(_ context.Context, groupID uuid.UUID, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tokens[groupID][userID]; !ok {
+		return fmt.Errorf("token of user %s: %w", userID, ErrNotFound)
+	}
+	delete(r.tokens[groupID], userID)
+	return nil
+}
+
+// ListTokens returns the active tokens of every group
+func (r *memoryFCMTokenRepository) ListTokens(_ context.Context) ([]models.FCMToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tokens []models.FCMToken
+	for _, group := range r.tokens {
+		for _, token := range group {
+			if token.IsActive {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type memoryGroupKeyRepository struct {
+	mu   sync.RWMutex
+	keys map[uuid.UUID][]models.GroupKey
+}
+
+func NewMemoryGroupKeyRepository() GroupKeyRepository {
+	return &memoryGroupKeyRepository{keys: make(map[uuid.UUID][]models.GroupKey)}
+}
+
+// GetGroupKeys returns the key versions of a group, oldest first
+func (r *memoryGroupKeyRepository) GetGroupKeys(_ context.Context, groupID uuid.UUID) ([]models.GroupKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return cloneGroupKeys(r.keys[groupID]), nil
+}
+
+func (r *memoryGroupKeyRepository) CreateGroupKey(_ context.Context, key *models.GroupKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := r.keys[key.GroupID]
+	if slices.ContainsFunc(keys, func(existing models.GroupKey) bool { return existing.Version == key.Version }) {
+		return fmt.Errorf("key version %d of group %s: %w", key.Version, key.GroupID, ErrConflict)
+	}
+	keys = append(keys, cloneGroupKeys([]models.GroupKey{*key})...)
+	slices.SortFunc(keys, func(a, b models.GroupKey) int { return a.Version - b.Version })
+	r.keys[key.GroupID] = keys
+	return nil
+}
+
+func (r *memoryGroupKeyRepository) UpdateGroupKey(_ context.Context, key *models.GroupKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := r.keys[key.GroupID]
+	index := slices.IndexFunc(keys, func(existing models.GroupKey) bool { return existing.Version == key.Version })
+	if index < 0 {
+		return fmt.Errorf("key version %d of group %s: %w", key.Version, key.GroupID, ErrNotFound)
+	}
+	keys[index] = cloneGroupKeys([]models.GroupKey{*key})[0]
+	return nil
+}
+
+// ListGroupKeys returns the key versions of every group, by group and oldest first
+func (r *memoryGroupKeyRepository) ListGroupKeys(_ context.Context) ([]models.GroupKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var keys []models.GroupKey
+	for _, groupKeys := range r.keys {
+		keys = append(keys, cloneGroupKeys(groupKeys)...)
+	}
+	slices.SortFunc(keys, func(a, b models.GroupKey) int {
+		if a.GroupID != b.GroupID {
+			return strings.Compare(a.GroupID.String(), b.GroupID.String())
+		}
+		return a.Version - b.Version
+	})
+	return keys, nil
+}
+
+func cloneGroupKeys(keys []models.GroupKey) []models.GroupKey {
+	cloned := slices.Clone(keys)
+	for i := range cloned {
+		cloned[i].WrappedKey = slices.Clone(cloned[i].WrappedKey)
+	}
+	return cloned
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"sort"
+	"sync"
+)
+
+type memoryGroupSettingsRepository struct {
+	mu       sync.RWMutex
+	settings map[uuid.UUID]models.GroupSettings
+}
+
+func NewMemoryGroupSettingsRepository() GroupSettingsRepository {
+	return &memoryGroupSettingsRepository{settings: make(map[uuid.UUID]models.GroupSettings)}
+}
+
+// GetSettings returns the stored settings of a group, or default settings when none were saved yet
+func (r *memoryGroupSettingsRepository) GetSettings(_ context.Context, groupID uuid.UUID) (*models.GroupSettings, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	settings, ok := r.settings[groupID]
+	if !ok {
+		return &models.GroupSettings{GroupID: groupID}, nil
+	}
+	return &settings, nil
+}
+
+func (r *memoryGroupSettingsRepository) SaveSettings(_ context.Context, settings *models.GroupSettings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.settings[settings.GroupID] = *settings
+	return nil
+}
+
+// ListRetentionPolicies returns the settings of every group that has a retention period
+func (r *memoryGroupSettingsRepository) ListRetentionPolicies(_ context.Context) ([]models.GroupSettings, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var policies []models.GroupSettings
+	for _, settings := range r.settings {
+		if settings.RetentionDays > 0 {
+			policies = append(policies, settings)
+		}
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].GroupID.String() < policies[j].GroupID.String()
+	})
+	return policies, nil
+}
+
+// ListSettings returns the stored settings of every group
+func (r *memoryGroupSettingsRepository) ListSettings(_ context.Context) ([]models.GroupSettings, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	settings := make([]models.GroupSettings, 0, len(r.settings))
+	for _, stored := range r.settings {
+		settings = append(settings, stored)
+	}
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].GroupID.String() < settings[j].GroupID.String()
+	})
+	return settings, nil
+}
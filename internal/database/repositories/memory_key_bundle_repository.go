@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type memoryKeyBundleRepository struct {
+	mu      sync.Mutex
+	bundles map[uuid.UUID]map[string]models.KeyBundle
+}
+
+func NewMemoryKeyBundleRepository() KeyBundleRepository {
+	return &memoryKeyBundleRepository{bundles: make(map[uuid.UUID]map[string]models.KeyBundle)}
+}
+
+func (r *memoryKeyBundleRepository) SaveBundle(_ context.Context, bundle *models.KeyBundle) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.bundles[bundle.GroupID]
+	if !ok {
+		group = make(map[string]models.KeyBundle)
+		r.bundles[bundle.GroupID] = group
+	}
+	stored := *bundle
+	stored.OneTimePreKeys = slices.Clone(bundle.OneTimePreKeys)
+	group[keyBundleRowKey(bundle.UserID, bundle.DeviceID)] = stored
+	return nil
+}
+
+// ListBundles returns the bundles of every device in a group, by user and device
+func (r *memoryKeyBundleRepository) ListBundles(_ context.Context, groupID uuid.UUID) ([]models.KeyBundle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bundles := make([]models.KeyBundle, 0, len(r.bundles[groupID]))
+	for _, bundle := range r.bundles[groupID] {
+		bundle.OneTimePreKeys = nil
+		bundles = append(bundles, bundle)
+	}
+	slices.SortFunc(bundles, func(a, b models.KeyBundle) int {
+		return strings.Compare(keyBundleRowKey(a.UserID, a.DeviceID), keyBundleRowKey(b.UserID, b.DeviceID))
+	})
+	return bundles, nil
+}
+
+// ListAllBundles returns the bundles of every device in every group
+func (r *memoryKeyBundleRepository) ListAllBundles(_ context.Context) ([]models.KeyBundle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var bundles []models.KeyBundle
+	for _, group := range r.bundles {
+		for _, bundle := range group {
+			bundle.OneTimePreKeys = nil
+			bundles = append(bundles, bundle)
+		}
+	}
+	return bundles, nil
+}
+
+func (r *memoryKeyBundleRepository) ClaimPreKey(_ context.Context, groupID uuid.UUID, userID uuid.UUID, deviceID string) (*models.PreKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rowKey := keyBundleRowKey(userID, deviceID)
+	bundle, ok := r.bundles[groupID][rowKey]
+	if !ok {
+		return nil, fmt.Errorf("key bundle of device %s: %w", deviceID, ErrNotFound)
+	}
+	if len(bundle.OneTimePreKeys) == 0 {
+		return nil, nil
+	}
+
+	claimed := bundle.OneTimePreKeys[0]
+	bundle.OneTimePreKeys = slices.Clone(bundle.OneTimePreKeys[1:])
+	r.bundles[groupID][rowKey] = bundle
+	return &claimed, nil
+}
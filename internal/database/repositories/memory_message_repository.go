@@ -0,0 +1,301 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/search"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryMessageRepository struct {
+	mu       sync.RWMutex
+	messages map[uuid.UUID]map[uuid.UUID]models.Message // GroupID -> MessageID -> Message
+	lastRead map[uuid.UUID]map[uuid.UUID]time.Time      // GroupID -> UserID -> last read time
+	terms    map[uuid.UUID]map[string][]uuid.UUID       // GroupID -> search term -> IDs of the messages containing it
+	version  int64                                      // last version handed out as ETag
+}
+
+func NewMemoryMessageRepository() MessageRepository {
+	return &memoryMessageRepository{
+		messages: make(map[uuid.UUID]map[uuid.UUID]models.Message),
+		lastRead: make(map[uuid.UUID]map[uuid.UUID]time.Time),
+		terms:    make(map[uuid.UUID]map[string][]uuid.UUID),
+	}
+}
+
+func (r *memoryMessageRepository) CreateMessage(_ context.Context, groupID uuid.UUID, message *models.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.messages[groupID]
+	if !ok {
+		group = make(map[uuid.UUID]models.Message)
+		r.messages[groupID] = group
+	}
+	if _, exists := group[message.ID]; exists {
+		return fmt.Errorf("failed to add entity: message %s already exists", message.ID)
+	}
+
+	stored := *message
+	stored.GroupID = groupID
+	stored.SentAt = message.SentAt.UTC()
+	stored.Envelopes = slices.Clone(message.Envelopes)
+	stored.ETag = r.nextETag()
+	group[message.ID] = stored
+
+	groupTerms, ok := r.terms[groupID]
+	if !ok {
+		groupTerms = make(map[string][]uuid.UUID)
+		r.terms[groupID] = groupTerms
+	}
+	for _, term := range messageSearchTerms(message) {
+		groupTerms[term] = append(groupTerms[term], message.ID)
+	}
+	return nil
+}
+
+func (r *memoryMessageRepository) ToggleMessagePin(_ context.Context, groupID uuid.UUID, messageID uuid.UUID, ifMatch string) (*models.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[groupID][messageID]
+	if !ok {
+		return nil, fmt.Errorf("message %s: %w", messageID, ErrNotFound)
+	}
+	if ifMatch != "" && message.ETag != ifMatch {
+		return nil, fmt.Errorf("message %s: %w", messageID, ErrConflict)
+	}
+
+	message.IsPinned = !message.IsPinned
+	message.ETag = r.nextETag()
+	r.messages[groupID][messageID] = message
+	return &message, nil
+}
+
+// nextETag returns an ETag no stored message had before; callers hold the write lock
+func (r *memoryMessageRepository) nextETag() string {
+	r.version++
+	return fmt.Sprintf(`"%d"`, r.version)
+}
+
+func (r *memoryMessageRepository) GetMessageByID(_ context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	message, ok := r.messages[groupID][messageID]
+	if !ok {
+		return nil, fmt.Errorf("message %s: %w", messageID, ErrNotFound)
+	}
+	return &message, nil
+}
+
+// GetMessages pages through a group's messages with the same keyset semantics as the PostgreSQL backend
+func (r *memoryMessageRepository) GetMessages(_ context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	hasCursor := query.Position != nil
+	previous := hasCursor && query.Direction == models.Previous
+
+	var cursor *models.Message
+	if hasCursor {
+		cursor = &models.Message{ID: query.Position.MessageID, SentAt: query.Position.SentAt}
+	}
+
+	// Collect the candidates ordered away from the cursor: older first for next, newer first for previous
+	var candidates []models.Message
+	for _, message := range r.messages[groupID] {
+		if cursor != nil {
+			if previous && !newerThan(message, *cursor) {
+				continue
+			}
+			if !previous && !newerThan(*cursor, message) {
+				continue
+			}
+		}
+		candidates = append(candidates, message)
+	}
+	sortNewestFirst(candidates)
+	if previous {
+		for i, j := 0, len(candidates)-1; i < j; i, j = i+1, j-1 {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		}
+	}
+
+	hasMore := len(candidates) > query.PageSize
+	if hasMore {
+		candidates = candidates[:query.PageSize]
+	}
+	if previous {
+		sortNewestFirst(candidates)
+	}
+
+	return candidates, keysetPagination(candidates, hasCursor, previous, hasMore), nil
+}
+
+// SearchMessages looks up the candidates of the first query word in the term index and checks the
+// other words against the content, like the Azure backend
+func (r *memoryMessageRepository) SearchMessages(_ context.Context, groupID uuid.UUID, query models.SearchQuery) ([]models.Message, *models.PaginationResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	words := search.ParseQuery(query.Text)
+	if len(words) == 0 {
+		return nil, &models.PaginationResponse{}, nil
+	}
+
+	var cursor *models.Message
+	if query.Position != nil {
+		cursor = &models.Message{ID: query.Position.MessageID, SentAt: query.Position.SentAt}
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	var matches []models.Message
+	for _, term := range words[0] {
+		for _, messageID := range r.terms[groupID][term] {
+			message, ok := r.messages[groupID][messageID]
+			if !ok || seen[messageID] {
+				continue
+			}
+			seen[messageID] = true
+			if cursor != nil && !newerThan(*cursor, message) {
+				continue
+			}
+			if words.Matches(messageSearchTerms(&message)) {
+				matches = append(matches, message)
+			}
+		}
+	}
+	sortNewestFirst(matches)
+
+	hasMore := len(matches) > query.PageSize
+	if hasMore {
+		matches = matches[:query.PageSize]
+	}
+	return matches, &models.PaginationResponse{HasNext: hasMore}, nil
+}
+
+// ListExpiredMessages returns up to query.Limit messages sent before query.Before, newest first
+func (r *memoryMessageRepository) ListExpiredMessages(_ context.Context, groupID uuid.UUID, query models.RetentionQuery) ([]models.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var expired []models.Message
+	for _, message := range r.messages[groupID] {
+		if !message.SentAt.Before(query.Before) || (query.KeepPinned && message.IsPinned) {
+			continue
+		}
+		if query.Position != nil && !newerThan(models.Message{ID: query.Position.MessageID, SentAt: query.Position.SentAt}, message) {
+			continue
+		}
+		expired = append(expired, message)
+	}
+	sortNewestFirst(expired)
+
+	if len(expired) > query.Limit {
+		expired = expired[:query.Limit]
+	}
+	return expired, nil
+}
+
+// DeleteMessages removes messages and their search terms
+func (r *memoryMessageRepository) DeleteMessages(_ context.Context, groupID uuid.UUID, messages []models.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, message := range messages {
+		stored, ok := r.messages[groupID][message.ID]
+		if !ok {
+			continue
+		}
+		delete(r.messages[groupID], message.ID)
+
+		for _, term := range messageSearchTerms(&stored) {
+			r.terms[groupID][term] = slices.DeleteFunc(r.terms[groupID][term], func(id uuid.UUID) bool {
+				return id == message.ID
+			})
+		}
+	}
+	return nil
+}
+
+func (r *memoryMessageRepository) ListGroupIDs(_ context.Context) ([]uuid.UUID, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var groupIDs []uuid.UUID
+	for groupID, messages := range r.messages {
+		if len(messages) > 0 {
+			groupIDs = append(groupIDs, groupID)
+		}
+	}
+	sort.Slice(groupIDs, func(i, j int) bool {
+		return groupIDs[i].String() < groupIDs[j].String()
+	})
+	return groupIDs, nil
+}
+
+func (r *memoryMessageRepository) CountUnreadMessages(_ context.Context, groupID uuid.UUID, lastReadTime time.Time) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	count := 0
+	for _, message := range r.messages[groupID] {
+		if message.SentAt.After(lastReadTime) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetMessagesSince returns up to limit of the newest messages sent after since, oldest first
+func (r *memoryMessageRepository) GetMessagesSince(_ context.Context, groupID uuid.UUID, since time.Time, limit int) ([]models.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var messages []models.Message
+	for _, message := range r.messages[groupID] {
+		if message.SentAt.After(since) {
+			messages = append(messages, message)
+		}
+	}
+	sortNewestFirst(messages)
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func (r *memoryMessageRepository) GetLastReadTime(_ context.Context, groupID uuid.UUID, userID uuid.UUID) (time.Time, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	lastRead, ok := r.lastRead[groupID][userID]
+	if !ok {
+		return time.Now().UTC(), nil
+	}
+	return lastRead, nil
+}
+
+// newerThan orders messages by sent time, breaking ties on the message ID like the SQL backend
+func newerThan(a, b models.Message) bool {
+	if !a.SentAt.Equal(b.SentAt) {
+		return a.SentAt.After(b.SentAt)
+	}
+	return strings.Compare(a.ID.String(), b.ID.String()) > 0
+}
+
+func sortNewestFirst(messages []models.Message) {
+	sort.Slice(messages, func(i, j int) bool {
+		return newerThan(messages[i], messages[j])
+	})
+}
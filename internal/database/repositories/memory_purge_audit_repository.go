@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"slices"
+	"sync"
+)
+
+type memoryPurgeAuditRepository struct {
+	mu     sync.RWMutex
+	audits map[uuid.UUID][]models.PurgeAudit
+}
+
+func NewMemoryPurgeAuditRepository() PurgeAuditRepository {
+	return &memoryPurgeAuditRepository{audits: make(map[uuid.UUID][]models.PurgeAudit)}
+}
+
+func (r *memoryPurgeAuditRepository) RecordPurge(_ context.Context, audit *models.PurgeAudit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *audit
+	stored.MessageIDs = slices.Clone(audit.MessageIDs)
+	r.audits[audit.GroupID] = append(r.audits[audit.GroupID], stored)
+	return nil
+}
+
+// ListPurges returns the purge records of a group, newest first
+func (r *memoryPurgeAuditRepository) ListPurges(_ context.Context, groupID uuid.UUID) ([]models.PurgeAudit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	audits := slices.Clone(r.audits[groupID])
+	slices.SortStableFunc(audits, func(a, b models.PurgeAudit) int {
+		return b.PurgedAt.Compare(a.PurgedAt)
+	})
+	return audits, nil
+}
+
+// ListAllPurges returns the purge records of every group
+func (r *memoryPurgeAuditRepository) ListAllPurges(_ context.Context) ([]models.PurgeAudit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var audits []models.PurgeAudit
+	for _, group := range r.audits {
+		audits = append(audits, group...)
+	}
+	return audits, nil
+}
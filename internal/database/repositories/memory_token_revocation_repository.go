@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryTokenRevocationRepository struct {
+	mu          sync.RWMutex
+	revocations map[models.RevocationKind]map[string]models.TokenRevocation
+}
+
+func NewMemoryTokenRevocationRepository() TokenRevocationRepository {
+	return &memoryTokenRevocationRepository{revocations: make(map[models.RevocationKind]map[string]models.TokenRevocation)}
+}
+
+func (r *memoryTokenRevocationRepository) Revoke(_ context.Context, revocation *models.TokenRevocation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byID, ok := r.revocations[revocation.Kind]
+	if !ok {
+		byID = make(map[string]models.TokenRevocation)
+		r.revocations[revocation.Kind] = byID
+	}
+	byID[revocation.ID] = *revocation
+	return nil
+}
+
+// ListRevocations returns the revocations that are still in force at the given time
+func (r *memoryTokenRevocationRepository) ListRevocations(_ context.Context, at time.Time) ([]models.TokenRevocation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var revocations []models.TokenRevocation
+	for _, byID := range r.revocations {
+		for _, revocation := range byID {
+			if revocation.ExpiresAt.After(at) {
+				revocations = append(revocations, revocation)
+			}
+		}
+	}
+	sort.Slice(revocations, func(i, j int) bool {
+		if revocations[i].Kind != revocations[j].Kind {
+			return revocations[i].Kind < revocations[j].Kind
+		}
+		return revocations[i].ID < revocations[j].ID
+	})
+	return revocations, nil
+}
@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"github.com/google/uuid"
+	"maps"
+	"sync"
+	"time"
+)
+
+type memoryUserPreferencesRepository struct {
+	mu          sync.RWMutex
+	preferences map[uuid.UUID]models.UserPreferences
+}
+
+func NewMemoryUserPreferencesRepository() UserPreferencesRepository {
+	return &memoryUserPreferencesRepository{preferences: make(map[uuid.UUID]models.UserPreferences)}
+}
+
+// GetPreferences returns the stored preferences of a user, or empty preferences when none were saved yet
+func (r *memoryUserPreferencesRepository) GetPreferences(_ context.Context, userID uuid.UUID) (*models.UserPreferences, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	preferences, ok := r.preferences[userID]
+	if !ok {
+		return &models.UserPreferences{UserID: userID}, nil
+	}
+	preferences.DigestGroups = maps.Clone(preferences.DigestGroups)
+	return &preferences, nil
+}
+
+func (r *memoryUserPreferencesRepository) SavePreferences(_ context.Context, preferences *models.UserPreferences) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *preferences
+	stored.DigestGroups = nil
+	for groupID, lastDigestAt := range preferences.DigestGroups {
+		if stored.DigestGroups == nil {
+			stored.DigestGroups = make(map[uuid.UUID]time.Time, len(preferences.DigestGroups))
+		}
+		stored.DigestGroups[groupID] = lastDigestAt.UTC()
+	}
+	r.preferences[preferences.UserID] = stored
+	return nil
+}
+
+// ListDigestSubscribers returns the preferences of every user that opted in to the email digest
+func (r *memoryUserPreferencesRepository) ListDigestSubscribers(_ context.Context) ([]models.UserPreferences, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var subscribers []models.UserPreferences
+	for _, preferences := range r.preferences {
+		if preferences.EmailDigest {
+			preferences.DigestGroups = maps.Clone(preferences.DigestGroups)
+			subscribers = append(subscribers, preferences)
+		}
+	}
+	return subscribers, nil
+}
+
+// ListPreferences returns the stored preferences of every user
+func (r *memoryUserPreferencesRepository) ListPreferences(_ context.Context) ([]models.UserPreferences, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	preferences := make([]models.UserPreferences, 0, len(r.preferences))
+	for _, stored := range r.preferences {
+		stored.DigestGroups = maps.Clone(stored.DigestGroups)
+		preferences = append(preferences, stored)
+	}
+	return preferences, nil
+}
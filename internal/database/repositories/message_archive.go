@@ -0,0 +1,450 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/cache"
+	"Groupchat-Service/internal/models"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	archiveManifestSchemaVersion = 1
+	// archiveCacheTTL bounds how long a replica keeps serving archive objects another process has rewritten
+	archiveCacheTTL       = time.Minute
+	archiveCachedMonths   = 256
+	archiveCachedGroups   = 4096
+	archiveMonthLayout    = "2006-01"
+	archiveMonthType      = "application/gzip"
+	archiveManifestType   = "application/json"
+	archiveManifestSuffix = "/manifest.json"
+)
+
+// ArchiveManifest describes the archive of one group
+type ArchiveManifest struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// Months lists the months that have an archive, oldest first
+	Months []string `json:"months"`
+	// NewestSentAt and NewestMessageID identify the newest archived message. Every message up to and including
+	// it has been archived; copies of these messages that are still in the hot store are ignored.
+	NewestSentAt    time.Time `json:"newestSentAt"`
+	NewestMessageID uuid.UUID `json:"newestMessageId"`
+}
+
+// Covers reports whether a position lies within the archived part of the timeline
+func (m *ArchiveManifest) Covers(position models.MessageCursor) bool {
+	if m.NewestMessageID == uuid.Nil {
+		return false
+	}
+	return !newerThan(positionMessage(position), m.newest())
+}
+
+func (m *ArchiveManifest) newest() models.Message {
+	return models.Message{ID: m.NewestMessageID, SentAt: m.NewestSentAt}
+}
+
+// MessageArchive keeps old messages outside the hot store: one gzip-compressed JSON-lines object per group
+// and month with the messages newest first, and a manifest per group. Reads are cached for a short time.
+type MessageArchive struct {
+	store     ArchiveStore
+	manifests *cache.LRU[uuid.UUID, *ArchiveManifest]
+	months    *cache.LRU[string, []models.Message]
+	// cipher encrypts archived content; nil archives it in plaintext
+	cipher *ContentCipher
+}
+
+// archivedMessage is the stored form of an archived message. Encrypted content names its data key.
+type archivedMessage struct {
+	models.Message
+	ContentKeyID string `json:"contentKeyId,omitempty"`
+}
+
+func NewMessageArchive(store ArchiveStore) *MessageArchive {
+	return &MessageArchive{
+		store:     store,
+		manifests: cache.NewLRU[uuid.UUID, *ArchiveManifest](archiveCachedGroups, archiveCacheTTL),
+		months:    cache.NewLRU[string, []models.Message](archiveCachedMonths, archiveCacheTTL),
+	}
+}
+
+// NewEncryptedMessageArchive encrypts the content of archived messages with cipher. Months archived in
+// plaintext before are still read and are encrypted when messages are added to them.
+func NewEncryptedMessageArchive(store ArchiveStore, cipher *ContentCipher) *MessageArchive {
+	archive := NewMessageArchive(store)
+	archive.cipher = cipher
+	return archive
+}
+
+// Manifest returns the manifest of a group, or nil when nothing of the group has been archived
+func (a *MessageArchive) Manifest(ctx context.Context, groupID uuid.UUID) (*ArchiveManifest, error) {
+	if manifest, ok := a.manifests.Get(groupID); ok {
+		return manifest, nil
+	}
+
+	manifest, err := a.readManifest(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	a.manifests.Set(groupID, manifest)
+	return manifest, nil
+}
+
+// GroupIDs returns the groups that have a manifest, including groups whose messages have all left the hot store
+func (a *MessageArchive) GroupIDs(ctx context.Context) ([]uuid.UUID, error) {
+	names, err := a.store.ListArchives(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message archive: %w", err)
+	}
+
+	var groupIDs []uuid.UUID
+	for _, name := range names {
+		group, ok := strings.CutSuffix(name, archiveManifestSuffix)
+		if !ok {
+			continue
+		}
+		if groupID, err := uuid.Parse(group); err == nil {
+			groupIDs = append(groupIDs, groupID)
+		}
+	}
+	return groupIDs, nil
+}
+
+// Older returns up to limit archived messages older than before, newest first. Without before it starts at
+// the newest archived message.
+func (a *MessageArchive) Older(ctx context.Context, groupID uuid.UUID, manifest *ArchiveManifest, before *models.MessageCursor, limit int) ([]models.Message, error) {
+	newest := manifest.newest()
+	lastMonth := archiveMonth(newest.SentAt)
+	if before != nil && archiveMonth(before.SentAt) < lastMonth {
+		lastMonth = archiveMonth(before.SentAt)
+	}
+
+	var result []models.Message
+	for i := len(manifest.Months) - 1; i >= 0 && len(result) < limit; i-- {
+		if manifest.Months[i] > lastMonth {
+			continue
+		}
+		messages, err := a.readMonth(ctx, groupID, manifest.Months[i], true)
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			if newerThan(message, newest) || (before != nil && !newerThan(positionMessage(*before), message)) {
+				continue
+			}
+			result = append(result, message)
+			if len(result) == limit {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// Contains reports whether the archive of a group holds a message
+func (a *MessageArchive) Contains(ctx context.Context, groupID uuid.UUID, manifest *ArchiveManifest, message models.Message) (bool, error) {
+	month := archiveMonth(message.SentAt)
+	if !slices.Contains(manifest.Months, month) {
+		return false, nil
+	}
+	messages, err := a.readMonth(ctx, groupID, month, true)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(messages, func(archived models.Message) bool { return archived.ID == message.ID }), nil
+}
+
+// Newer returns up to limit archived messages newer than after, closest to after first
+func (a *MessageArchive) Newer(ctx context.Context, groupID uuid.UUID, manifest *ArchiveManifest, after models.MessageCursor, limit int) ([]models.Message, error) {
+	newest := manifest.newest()
+	firstMonth := archiveMonth(after.SentAt)
+
+	var result []models.Message
+	for i := 0; i < len(manifest.Months) && len(result) < limit; i++ {
+		if manifest.Months[i] < firstMonth {
+			continue
+		}
+		messages, err := a.readMonth(ctx, groupID, manifest.Months[i], true)
+		if err != nil {
+			return nil, err
+		}
+		for j := len(messages) - 1; j >= 0; j-- {
+			message := messages[j]
+			if newerThan(message, newest) || !newerThan(message, positionMessage(after)) {
+				continue
+			}
+			result = append(result, message)
+			if len(result) == limit {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// AddMessages merges messages into the archives of their months and lists those months in the manifest.
+// Adding a message again replaces the archived copy, so an interrupted run can simply be repeated.
+// The archived messages only become visible to readers once AdvanceWatermark includes them.
+func (a *MessageArchive) AddMessages(ctx context.Context, groupID uuid.UUID, messages []models.Message) error {
+	byMonth := make(map[string][]models.Message)
+	for _, message := range messages {
+		month := archiveMonth(message.SentAt)
+		byMonth[month] = append(byMonth[month], message)
+	}
+
+	manifest, err := a.readManifest(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		manifest = &ArchiveManifest{}
+	}
+
+	for month, added := range byMonth {
+		existing, err := a.readMonth(ctx, groupID, month, false)
+		if err != nil {
+			return err
+		}
+		if err := a.writeMonth(ctx, groupID, month, mergeArchivedMessages(existing, added)); err != nil {
+			return err
+		}
+		if !slices.Contains(manifest.Months, month) {
+			manifest.Months = append(manifest.Months, month)
+		}
+	}
+	slices.Sort(manifest.Months)
+	return a.writeManifest(ctx, groupID, manifest)
+}
+
+// AdvanceWatermark records newest as the newest archived message unless a newer one is recorded already
+func (a *MessageArchive) AdvanceWatermark(ctx context.Context, groupID uuid.UUID, newest models.Message) error {
+	manifest, err := a.readManifest(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		return fmt.Errorf("group %s has no archive", groupID)
+	}
+	if manifest.NewestMessageID != uuid.Nil && !newerThan(newest, manifest.newest()) {
+		return nil
+	}
+
+	manifest.NewestSentAt = newest.SentAt.UTC()
+	manifest.NewestMessageID = newest.ID
+	return a.writeManifest(ctx, groupID, manifest)
+}
+
+// ExpiredMonths returns the archived months of a group that can hold messages sent before before, oldest first
+func (a *MessageArchive) ExpiredMonths(ctx context.Context, groupID uuid.UUID, before time.Time) ([]string, error) {
+	manifest, err := a.readManifest(ctx, groupID)
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+
+	last := archiveMonth(before)
+	var months []string
+	for _, month := range manifest.Months {
+		if month <= last {
+			months = append(months, month)
+		}
+	}
+	return months, nil
+}
+
+// ExpiredMessages returns the archived messages of a month sent before before, newest first. With keepPinned
+// pinned messages are not returned.
+func (a *MessageArchive) ExpiredMessages(ctx context.Context, groupID uuid.UUID, month string, before time.Time, keepPinned bool) ([]models.Message, error) {
+	messages, err := a.readMonth(ctx, groupID, month, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []models.Message
+	for _, message := range messages {
+		if message.SentAt.Before(before) && !(keepPinned && message.IsPinned) {
+			expired = append(expired, message)
+		}
+	}
+	return expired, nil
+}
+
+// RemoveMessages rewrites the archive of a month without the given messages. A month left without messages is
+// dropped from the manifest and deleted.
+func (a *MessageArchive) RemoveMessages(ctx context.Context, groupID uuid.UUID, month string, messages []models.Message) error {
+	existing, err := a.readMonth(ctx, groupID, month, false)
+	if err != nil {
+		return err
+	}
+
+	removed := make(map[uuid.UUID]bool, len(messages))
+	for _, message := range messages {
+		removed[message.ID] = true
+	}
+	kept := slices.DeleteFunc(slices.Clone(existing), func(message models.Message) bool { return removed[message.ID] })
+	if len(kept) > 0 {
+		return a.writeMonth(ctx, groupID, month, kept)
+	}
+
+	manifest, err := a.readManifest(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	if manifest != nil {
+		manifest.Months = slices.DeleteFunc(manifest.Months, func(m string) bool { return m == month })
+		if err := a.writeManifest(ctx, groupID, manifest); err != nil {
+			return err
+		}
+	}
+
+	name := archiveMonthName(groupID, month)
+	if err := a.store.DeleteArchive(ctx, name); err != nil {
+		return fmt.Errorf("failed to delete archive %s: %w", name, err)
+	}
+	a.months.Delete(name)
+	return nil
+}
+
+func (a *MessageArchive) readManifest(ctx context.Context, groupID uuid.UUID) (*ArchiveManifest, error) {
+	data, err := a.store.ReadArchive(ctx, groupID.String()+archiveManifestSuffix)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive manifest: %w", err)
+	}
+
+	var manifest ArchiveManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal archive manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+func (a *MessageArchive) writeManifest(ctx context.Context, groupID uuid.UUID, manifest *ArchiveManifest) error {
+	manifest.SchemaVersion = archiveManifestSchemaVersion
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal archive manifest: %w", err)
+	}
+	if err := a.store.WriteArchive(ctx, groupID.String()+archiveManifestSuffix, data, archiveManifestType); err != nil {
+		return fmt.Errorf("failed to write archive manifest: %w", err)
+	}
+	a.manifests.Delete(groupID)
+	return nil
+}
+
+// readMonth returns the archived messages of a month, newest first. Cached slices are shared and must not
+// be modified.
+func (a *MessageArchive) readMonth(ctx context.Context, groupID uuid.UUID, month string, useCache bool) ([]models.Message, error) {
+	name := archiveMonthName(groupID, month)
+	if useCache {
+		if messages, ok := a.months.Get(name); ok {
+			return messages, nil
+		}
+	}
+
+	data, err := a.store.ReadArchive(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", name, err)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress archive %s: %w", name, err)
+	}
+	decoder := json.NewDecoder(reader)
+	var messages []models.Message
+	for {
+		var archived archivedMessage
+		if err := decoder.Decode(&archived); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to decode archive %s: %w", name, err)
+		}
+
+		message := archived.Message
+		if archived.ContentKeyID != "" {
+			if a.cipher == nil {
+				return nil, fmt.Errorf("archive %s is encrypted but no encryption keys are configured", name)
+			}
+			message.Content, err = a.cipher.Decrypt(ctx, groupID, message.ID, archived.ContentKeyID, message.Content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt archived message %s: %w", message.ID, err)
+			}
+		}
+		messages = append(messages, message)
+	}
+
+	a.months.Set(name, messages)
+	return messages, nil
+}
+
+func (a *MessageArchive) writeMonth(ctx context.Context, groupID uuid.UUID, month string, messages []models.Message) error {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	encoder := json.NewEncoder(writer)
+	for _, message := range messages {
+		archived := archivedMessage{Message: message}
+		if a.cipher != nil {
+			content, keyID, err := a.cipher.Encrypt(ctx, groupID, message.ID, message.Content)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt archived message %s: %w", message.ID, err)
+			}
+			archived.Content, archived.ContentKeyID = content, keyID
+		}
+		if err := encoder.Encode(archived); err != nil {
+			return fmt.Errorf("failed to encode archived message: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to compress archive: %w", err)
+	}
+
+	name := archiveMonthName(groupID, month)
+	if err := a.store.WriteArchive(ctx, name, buffer.Bytes(), archiveMonthType); err != nil {
+		return fmt.Errorf("failed to write archive %s: %w", name, err)
+	}
+	a.months.Delete(name)
+	return nil
+}
+
+// mergeArchivedMessages combines archived and newly archived messages newest first. Archived messages are
+// read-only, so they carry no ETag.
+func mergeArchivedMessages(existing []models.Message, added []models.Message) []models.Message {
+	byID := make(map[uuid.UUID]models.Message, len(existing)+len(added))
+	for _, message := range slices.Concat(existing, added) {
+		message.ETag = ""
+		message.SentAt = message.SentAt.UTC()
+		byID[message.ID] = message
+	}
+
+	merged := make([]models.Message, 0, len(byID))
+	for _, message := range byID {
+		merged = append(merged, message)
+	}
+	sortNewestFirst(merged)
+	return merged
+}
+
+func archiveMonth(t time.Time) string {
+	return t.UTC().Format(archiveMonthLayout)
+}
+
+func archiveMonthName(groupID uuid.UUID, month string) string {
+	return fmt.Sprintf("%s/%s.jsonl.gz", groupID, month)
+}
+
+// positionMessage turns a position into a message that can be ordered with newerThan
+func positionMessage(position models.MessageCursor) models.Message {
+	return models.Message{ID: position.MessageID, SentAt: position.SentAt}
+}
@@ -0,0 +1,246 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/cache"
+	"Groupchat-Service/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RecentMessages is the cached head of a group's timeline
+type RecentMessages struct {
+	// Messages are the newest messages of the group, newest first
+	Messages []models.Message `json:"messages"`
+	// HasOlder is set when the group has messages older than the cached ones
+	HasOlder bool `json:"hasOlder"`
+}
+
+// MessageCache stores the recent messages per group. Implementations may evict entries at any time.
+type MessageCache interface {
+	// GetRecent returns a copy of the cached messages of a group, or nil when the group is not cached
+	GetRecent(ctx context.Context, groupID uuid.UUID) (*RecentMessages, error)
+	// Generation returns the generation of a group's entry, which every invalidation changes
+	Generation(ctx context.Context, groupID uuid.UUID) (uint64, error)
+	// SetRecent caches messages that were read at generation. It stores nothing when the group was invalidated
+	// since, as the messages may then be stale.
+	SetRecent(ctx context.Context, groupID uuid.UUID, generation uint64, recent *RecentMessages) error
+	Invalidate(ctx context.Context, groupID uuid.UUID) error
+}
+
+// memoryMessageCacheStripes is the number of locks that order cache fills against invalidations
+const memoryMessageCacheStripes = 64
+
+type memoryMessageCacheStripe struct {
+	mu sync.Mutex
+	// generation is bumped by every invalidation of a group of the stripe
+	generation uint64
+}
+
+type memoryMessageCache struct {
+	groups  *cache.LRU[uuid.UUID, RecentMessages]
+	stripes [memoryMessageCacheStripes]memoryMessageCacheStripe
+}
+
+// NewMemoryMessageCache keeps the recent messages of up to maxGroups groups in process memory
+func NewMemoryMessageCache(maxGroups int, ttl time.Duration) MessageCache {
+	return &memoryMessageCache{groups: cache.NewLRU[uuid.UUID, RecentMessages](maxGroups, ttl)}
+}
+
+func (c *memoryMessageCache) GetRecent(_ context.Context, groupID uuid.UUID) (*RecentMessages, error) {
+	recent, ok := c.groups.Get(groupID)
+	if !ok {
+		return nil, nil
+	}
+	recent.Messages = slices.Clone(recent.Messages)
+	return &recent, nil
+}
+
+func (c *memoryMessageCache) Generation(_ context.Context, groupID uuid.UUID) (uint64, error) {
+	stripe := c.stripe(groupID)
+	stripe.mu.Lock()
+	defer stripe.mu.Unlock()
+	return stripe.generation, nil
+}
+
+func (c *memoryMessageCache) SetRecent(_ context.Context, groupID uuid.UUID, generation uint64, recent *RecentMessages) error {
+	stripe := c.stripe(groupID)
+	stripe.mu.Lock()
+	defer stripe.mu.Unlock()
+	if stripe.generation == generation {
+		c.groups.Set(groupID, RecentMessages{Messages: slices.Clone(recent.Messages), HasOlder: recent.HasOlder})
+	}
+	return nil
+}
+
+func (c *memoryMessageCache) Invalidate(_ context.Context, groupID uuid.UUID) error {
+	stripe := c.stripe(groupID)
+	stripe.mu.Lock()
+	defer stripe.mu.Unlock()
+	stripe.generation++
+	c.groups.Delete(groupID)
+	return nil
+}
+
+func (c *memoryMessageCache) stripe(groupID uuid.UUID) *memoryMessageCacheStripe {
+	return &c.stripes[int(groupID[len(groupID)-1])%memoryMessageCacheStripes]
+}
+
+// redisMessageCacheKeyPrefix namespaces the cache keys; bump the version when RecentMessages or the key
+// layout changes
+const redisMessageCacheKeyPrefix = "groupchat:recent-messages:v2:"
+
+// redisGenerationTTL keeps the generation of a group long after its last invalidation, far longer than any fill
+// takes. An expired generation reads as 0 again, which only stale fills that started before it could match.
+const redisGenerationTTL = 24 * time.Hour
+
+// redisSetRecentScript stores the entry in KEYS[2] for ARGV[3] milliseconds when the generation in KEYS[1] is
+// still ARGV[1]
+const redisSetRecentScript = `
+if (redis.call("GET", KEYS[1]) or "0") ~= ARGV[1] then
+  return 0
+end
+redis.call("SET", KEYS[2], ARGV[2], "PX", ARGV[3])
+return 1
+`
+
+// redisInvalidateScript bumps the generation in KEYS[1], keeping it for ARGV[1] milliseconds, and drops the
+// entry in KEYS[2]
+const redisInvalidateScript = `
+redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[1])
+redis.call("DEL", KEYS[2])
+return 1
+`
+
+// redisRecentMessages is the stored form of RecentMessages. Encrypted content names its data key, as in the
+// archive.
+type redisRecentMessages struct {
+	Messages []archivedMessage `json:"messages"`
+	HasOlder bool              `json:"hasOlder"`
+}
+
+type redisMessageCache struct {
+	client    *cache.RedisClient
+	keyPrefix string
+	ttl       time.Duration
+	// cipher encrypts the cached content; nil caches it in plaintext
+	cipher *ContentCipher
+}
+
+// NewRedisMessageCache shares the recent messages between replicas through Redis. Entries expire after ttl;
+// Redis' own eviction policy bounds the number of cached groups. A non-empty namespace, such as a tenant ID,
+// keeps the entries apart from those of other namespaces on the same Redis. The generations live in Redis too,
+// so no replica stores messages it read before another replica invalidated the group. With a cipher the content
+// is encrypted with the data key of its group, so Redis holds no more plaintext than the storage does.
+func NewRedisMessageCache(client *cache.RedisClient, namespace string, ttl time.Duration, cipher *ContentCipher) MessageCache {
+	keyPrefix := redisMessageCacheKeyPrefix
+	if namespace != "" {
+		keyPrefix += namespace + ":"
+	}
+	return &redisMessageCache{client: client, keyPrefix: keyPrefix, ttl: ttl, cipher: cipher}
+}
+
+func (c *redisMessageCache) GetRecent(ctx context.Context, groupID uuid.UUID) (*RecentMessages, error) {
+	value, err := c.client.Get(ctx, c.entryKey(groupID))
+	if errors.Is(err, cache.ErrRedisNil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c.decode(ctx, groupID, value)
+}
+
+func (c *redisMessageCache) Generation(ctx context.Context, groupID uuid.UUID) (uint64, error) {
+	value, err := c.client.Get(ctx, c.generationKey(groupID))
+	if errors.Is(err, cache.ErrRedisNil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	generation, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cache generation %q: %w", value, err)
+	}
+	return generation, nil
+}
+
+func (c *redisMessageCache) SetRecent(ctx context.Context, groupID uuid.UUID, generation uint64, recent *RecentMessages) error {
+	value, err := c.encode(ctx, groupID, recent)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Do(ctx, "EVAL", redisSetRecentScript, "2", c.generationKey(groupID), c.entryKey(groupID),
+		strconv.FormatUint(generation, 10), value, strconv.FormatInt(c.ttl.Milliseconds(), 10))
+	return err
+}
+
+func (c *redisMessageCache) Invalidate(ctx context.Context, groupID uuid.UUID) error {
+	_, err := c.client.Do(ctx, "EVAL", redisInvalidateScript, "2", c.generationKey(groupID), c.entryKey(groupID),
+		strconv.FormatInt(redisGenerationTTL.Milliseconds(), 10))
+	return err
+}
+
+// encode marshals the messages of a group, encrypting their content when the cache has a cipher
+func (c *redisMessageCache) encode(ctx context.Context, groupID uuid.UUID, recent *RecentMessages) (string, error) {
+	stored := redisRecentMessages{Messages: make([]archivedMessage, 0, len(recent.Messages)), HasOlder: recent.HasOlder}
+	for _, message := range recent.Messages {
+		cached := archivedMessage{Message: message}
+		if c.cipher != nil {
+			content, keyID, err := c.cipher.Encrypt(ctx, groupID, message.ID, message.Content)
+			if err != nil {
+				return "", fmt.Errorf("failed to encrypt cached message %s: %w", message.ID, err)
+			}
+			cached.Content, cached.ContentKeyID = content, keyID
+		}
+		stored.Messages = append(stored.Messages, cached)
+	}
+
+	value, err := json.Marshal(stored)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cached messages: %w", err)
+	}
+	return string(value), nil
+}
+
+// decode unmarshals the cached messages of a group, decrypting encrypted content
+func (c *redisMessageCache) decode(ctx context.Context, groupID uuid.UUID, value string) (*RecentMessages, error) {
+	var stored redisRecentMessages
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cached messages: %w", err)
+	}
+
+	recent := &RecentMessages{Messages: make([]models.Message, 0, len(stored.Messages)), HasOlder: stored.HasOlder}
+	for _, cached := range stored.Messages {
+		message := cached.Message
+		if cached.ContentKeyID != "" {
+			if c.cipher == nil {
+				return nil, fmt.Errorf("cached message %s is encrypted but no encryption keys are configured", message.ID)
+			}
+			content, err := c.cipher.Decrypt(ctx, groupID, message.ID, cached.ContentKeyID, message.Content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt cached message %s: %w", message.ID, err)
+			}
+			message.Content = content
+		}
+		recent.Messages = append(recent.Messages, message)
+	}
+	return recent, nil
+}
+
+func (c *redisMessageCache) entryKey(groupID uuid.UUID) string {
+	return c.keyPrefix + groupID.String()
+}
+
+func (c *redisMessageCache) generationKey(groupID uuid.UUID) string {
+	return c.keyPrefix + groupID.String() + ":generation"
+}
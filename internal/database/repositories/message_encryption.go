@@ -0,0 +1,199 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/google/uuid"
+	"slices"
+)
+
+// contentKeyIDField is the property naming the data key of encrypted content
+const contentKeyIDField = "ContentKeyID"
+
+// toStoredEntity builds the stored entity of a message, encrypting its content when a cipher is configured
+func (r *messageRepository) toStoredEntity(ctx context.Context, groupID uuid.UUID, message *models.Message) (MessageEntity, error) {
+	mapper := &entityMapper{}
+	entity := mapper.toEntity(groupID, message)
+	if r.cipher == nil {
+		return entity, nil
+	}
+
+	content, keyID, err := r.cipher.Encrypt(ctx, groupID, message.ID, message.Content)
+	if err != nil {
+		return MessageEntity{}, fmt.Errorf("failed to encrypt message %s: %w", message.ID, err)
+	}
+	entity.Content, entity.ContentKeyID = content, keyID
+	return entity, nil
+}
+
+// decodeMessage decodes a stored message and decrypts its content. Messages stored before encryption was
+// enabled have no content key and are read as they are.
+func (r *messageRepository) decodeMessage(ctx context.Context, rawEntity map[string]interface{}) (*models.Message, error) {
+	mapper := &entityMapper{}
+	message, err := mapper.toMessage(rawEntity)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID := entityFields(rawEntity).stringField(contentKeyIDField)
+	if keyID == "" {
+		return message, nil
+	}
+	if r.cipher == nil {
+		return nil, fmt.Errorf("message %s is encrypted but no encryption keys are configured", message.ID)
+	}
+
+	message.Content, err = r.cipher.Decrypt(ctx, message.GroupID, message.ID, keyID, message.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt message %s: %w", message.ID, err)
+	}
+	return message, nil
+}
+
+// indexTerms returns the search terms stored for a new message. With encryption the terms are blinded.
+func (r *messageRepository) indexTerms(ctx context.Context, groupID uuid.UUID, message *models.Message) ([]string, error) {
+	terms := messageSearchTerms(message)
+	if r.cipher == nil {
+		return terms, nil
+	}
+	return r.cipher.BlindTerms(ctx, groupID, terms, true)
+}
+
+// storedTermSets returns the sets of stored terms that may exist for the given terms: with encryption the
+// blinded terms, followed by the plaintext terms of messages stored before encryption was enabled
+func (r *messageRepository) storedTermSets(ctx context.Context, groupID uuid.UUID, terms []string) ([][]string, error) {
+	if r.cipher == nil {
+		return [][]string{terms}, nil
+	}
+	blinded, err := r.cipher.BlindTerms(ctx, groupID, terms, false)
+	if err != nil {
+		return nil, err
+	}
+	return [][]string{blinded, terms}, nil
+}
+
+// ReencryptionProgress reports how far the messages of one group have been re-encrypted
+type ReencryptionProgress struct {
+	GroupID     uuid.UUID
+	KeyID       string
+	Scanned     int
+	Reencrypted int
+	// Skipped counts the messages another writer changed while they were re-encrypted
+	Skipped int
+}
+
+// ReencryptMessages rewrites every message that is stored in plaintext or with an older data key with the
+// latest data key of its group. With rotate, every group first gets a new data key version. The messages of
+// a group are read in batches of batchSize and progress is called after every batch. Messages already on the
+// latest key are left alone, so running it again without rotate completes an interrupted or skipped run.
+func ReencryptMessages(ctx context.Context, client *TableService, cipher *ContentCipher, batchSize int, rotate bool, progress func(ReencryptionProgress)) error {
+	r, err := newMessageRepository(client, cipher)
+	if err != nil {
+		return err
+	}
+
+	groupIDs, err := r.ListGroupIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, groupID := range groupIDs {
+		if rotate {
+			if _, err := cipher.RotateGroupKey(ctx, groupID); err != nil {
+				return fmt.Errorf("failed to rotate the data key of group %s: %w", groupID, err)
+			}
+		}
+		if err := r.reencryptGroup(ctx, groupID, batchSize, progress); err != nil {
+			return fmt.Errorf("failed to re-encrypt group %s: %w", groupID, err)
+		}
+	}
+	return nil
+}
+
+func (r *messageRepository) reencryptGroup(ctx context.Context, groupID uuid.UUID, batchSize int, progress func(ReencryptionProgress)) error {
+	keyID, err := r.cipher.LatestKeyID(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	report := ReencryptionProgress{GroupID: groupID, KeyID: keyID}
+
+	qb := &queryBuilder{}
+	filter := qb.buildMessageRangeFilter(groupID, messageRowKeyPrefix, messageRowKeyRangeEnd)
+	top := int32(batchSize)
+	pager := r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: &filter, Top: &top})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list messages: %w", err)
+		}
+
+		for _, raw := range page.Entities {
+			fields, err := decodeEntityFields(raw)
+			if err != nil {
+				return err
+			}
+			report.Scanned++
+			if fields.stringField(contentKeyIDField) == keyID {
+				continue
+			}
+
+			reencrypted, err := r.reencryptMessage(ctx, groupID, fields)
+			if err != nil {
+				return err
+			}
+			if reencrypted {
+				report.Reencrypted++
+			} else {
+				report.Skipped++
+			}
+		}
+
+		if progress != nil {
+			progress(report)
+		}
+	}
+	return nil
+}
+
+// reencryptMessage replaces a message with a copy encrypted with the latest data key. Plaintext messages get
+// their blinded search terms before the plaintext terms are removed, so they stay searchable throughout, and
+// the message itself is replaced last, so an interrupted run handles the message again. It reports false
+// when the message changed since it was read.
+func (r *messageRepository) reencryptMessage(ctx context.Context, groupID uuid.UUID, fields entityFields) (bool, error) {
+	mapper := &entityMapper{}
+	ops := &tableOperations{table: r.table}
+
+	message, err := r.decodeMessage(ctx, fields)
+	if err != nil {
+		return false, err
+	}
+	entity, err := r.toStoredEntity(ctx, groupID, message)
+	if err != nil {
+		return false, err
+	}
+
+	if fields.stringField(contentKeyIDField) == "" {
+		blinded, err := r.indexTerms(ctx, groupID, message)
+		if err != nil {
+			return false, err
+		}
+		for batch := range slices.Chunk(mapper.toTermEntities(groupID, message, blinded), maxTransactionActions) {
+			if err := ops.submitEntities(ctx, aztables.TransactionTypeInsertReplace, batch); err != nil {
+				return false, fmt.Errorf("failed to index message %s: %w", message.ID, err)
+			}
+		}
+		plaintext := mapper.toTermEntities(groupID, message, messageSearchTerms(message))
+		if err := r.deleteTermEntities(ctx, plaintext); err != nil {
+			return false, fmt.Errorf("failed to delete plaintext search terms of message %s: %w", message.ID, err)
+		}
+	}
+
+	if _, err := ops.updateEntity(ctx, entity, message.ETag); err != nil {
+		if isConditionNotSatisfied(err) || isNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to re-encrypt message %s: %w", message.ID, err)
+	}
+	return true, nil
+}
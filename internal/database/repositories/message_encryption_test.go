@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaUpgradeKeepsContentKey(t *testing.T) {
+	sentAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fields := entityFields{
+		"PartitionKey": uuid.NewString(),
+		"RowKey":       messageRowKey(sentAt, uuid.New()),
+		"Content":      "c2VhbGVk",
+		"ContentKeyID": "v2",
+	}
+
+	entity, err := entitySchemas()[0].upgrade(fields)
+	require.NoError(t, err)
+	assert.Equal(t, "c2VhbGVk", entity.(MessageEntity).Content)
+	assert.Equal(t, "v2", entity.(MessageEntity).ContentKeyID)
+}
+
+// TestReencryptMessages needs Azure Table Storage; set AZURE_TEST_CONNECTION_STRING (e.g. Azurite) to run it
+func TestReencryptMessages(t *testing.T) {
+	connectionString := os.Getenv("AZURE_TEST_CONNECTION_STRING")
+	if connectionString == "" {
+		t.Skip("AZURE_TEST_CONNECTION_STRING is not set")
+	}
+	ctx := context.Background()
+
+	client, err := NewTableClient(connectionString)
+	require.NoError(t, err)
+	plaintextRepo, err := NewMessageRepository(client)
+	require.NoError(t, err)
+	keys, err := NewGroupKeyRepository(client)
+	require.NoError(t, err)
+	cipher := NewContentCipher(newTestMasterKeys(t, "test"), keys)
+	encryptedRepo, err := NewEncryptedMessageRepository(client, cipher)
+	require.NoError(t, err)
+
+	groupID := uuid.New()
+	start := time.Now().Add(-time.Hour)
+	legacy := newTestMessage(t, plaintextRepo, groupID, start, "slecht geslapen")
+	encrypted := newTestMessage(t, encryptedRepo, groupID, start.Add(time.Minute), "goed geslapen")
+
+	storedKeyID := func(message models.Message) string {
+		ops := &tableOperations{table: client.NewClient(MessagesTable)}
+		rawEntity, err := ops.getAndUnmarshalEntity(ctx, groupID.String(), messageRowKey(message.SentAt, message.ID))
+		require.NoError(t, err)
+		return entityFields(rawEntity).stringField(contentKeyIDField)
+	}
+	searchIDs := func() []uuid.UUID {
+		found, _, err := encryptedRepo.SearchMessages(ctx, groupID, models.SearchQuery{Text: "geslapen", PageSize: 10})
+		require.NoError(t, err)
+		return messageIDs(found)
+	}
+
+	assert.Empty(t, storedKeyID(legacy))
+	assert.Equal(t, "v1", storedKeyID(encrypted))
+	assert.Equal(t, []uuid.UUID{encrypted.ID, legacy.ID}, searchIDs(), "plaintext and encrypted messages are both found")
+
+	_, err = plaintextRepo.GetMessageByID(ctx, groupID, encrypted.ID)
+	assert.Error(t, err, "encrypted messages cannot be read without keys")
+
+	require.NoError(t, ReencryptMessages(ctx, client, cipher, 1, false, nil))
+	assert.Equal(t, "v1", storedKeyID(legacy))
+	assert.Equal(t, []uuid.UUID{encrypted.ID, legacy.ID}, searchIDs())
+
+	require.NoError(t, ReencryptMessages(ctx, client, cipher, 10, true, nil))
+	assert.Equal(t, "v2", storedKeyID(legacy))
+	assert.Equal(t, "v2", storedKeyID(encrypted))
+
+	message, err := encryptedRepo.GetMessageByID(ctx, groupID, legacy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "slecht geslapen", message.Content)
+	assert.Equal(t, []uuid.UUID{encrypted.ID, legacy.ID}, searchIDs())
+
+	require.NoError(t, encryptedRepo.DeleteMessages(ctx, groupID, []models.Message{legacy, encrypted}))
+	assert.Empty(t, searchIDs())
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"math"
+	"slices"
 	"strings"
 	"time"
 
@@ -12,18 +15,66 @@ import (
 	"github.com/google/uuid"
 )
 
+// Message RowKeys are "msg_<inverted timestamp>_<message ID>", so the native PartitionKey/RowKey order
+// of Azure Tables lists a group's messages newest first. An index entity "id_<message ID>" per message
+// points at its RowKey for lookups by ID, search term entities "t_<term>_<message RowKey>" list the
+// messages containing a term newest first, and sequence entities "seq_<timestamp>_<message ID>" list the
+// messages oldest first, so pages towards newer messages are read in native order as well. Last read
+// entities use the user ID as RowKey and never fall inside these key ranges.
+const (
+	messageRowKeyPrefix         = "msg_"
+	messageRowKeyRangeEnd       = "msg`" // "`" is the character after "_", so this sorts after every message key
+	messageIndexRowKeyPrefix    = "id_"
+	messageTermRowKeyPrefix     = "t_"
+	messageSequenceRowKeyPrefix = "seq_"
+	messageSequenceRangeEnd     = "seq`"
+
+	// maxTransactionActions is the number of operations Azure Tables accepts in one transaction
+	maxTransactionActions = 100
+)
+
 type messageRepository struct {
 	table *aztables.Client
+	// cipher encrypts message content; nil stores it in plaintext
+	cipher *ContentCipher
 }
 
 type MessageEntity struct {
-	PartitionKey string `json:"PartitionKey"`
-	RowKey       string `json:"RowKey"`
-	SenderID     string `json:"SenderID"`
-	SenderName   string `json:"SenderName"`
-	Content      string `json:"Content"`
-	SentAt       string `json:"SentAt"`
-	IsPinned     bool   `json:"IsPinned"`
+	PartitionKey  string `json:"PartitionKey"`
+	RowKey        string `json:"RowKey"`
+	MessageID     string `json:"MessageID"`
+	SenderID      string `json:"SenderID"`
+	SenderName    string `json:"SenderName"`
+	SenderBadge   string `json:"SenderBadge,omitempty"`
+	Content       string `json:"Content"`
+	SentAt        string `json:"SentAt"`
+	IsPinned      bool   `json:"IsPinned"`
+	SchemaVersion int    `json:"SchemaVersion"`
+	// ContentKeyID names the data key that encrypted Content; empty when Content is plaintext
+	ContentKeyID string `json:"ContentKeyID,omitempty"`
+	// Envelopes holds the JSON encoded key envelopes of an end-to-end encrypted message
+	Envelopes string `json:"Envelopes,omitempty"`
+}
+
+// MessageIndexEntity maps a message ID to the RowKey of the message
+type MessageIndexEntity struct {
+	PartitionKey  string `json:"PartitionKey"` // GroupID
+	RowKey        string `json:"RowKey"`       // "id_" + MessageID
+	MessageRowKey string `json:"MessageRowKey"`
+}
+
+// MessageSequenceEntity lists a message in chronological order
+type MessageSequenceEntity struct {
+	PartitionKey  string `json:"PartitionKey"` // GroupID
+	RowKey        string `json:"RowKey"`       // "seq_" + timestamp + "_" + MessageID
+	MessageRowKey string `json:"MessageRowKey"`
+}
+
+// MessageTermEntity records that a message contains a search term
+type MessageTermEntity struct {
+	PartitionKey  string `json:"PartitionKey"` // GroupID
+	RowKey        string `json:"RowKey"`       // "t_" + term + "_" + message RowKey
+	MessageRowKey string `json:"MessageRowKey"`
 }
 
 // LastReadEntity represents the structure for storing last read times
@@ -33,50 +84,148 @@ type LastReadEntity struct {
 	LastReadTime string `json:"LastReadTime"`
 }
 
+// messageRowKey builds the RowKey of a message. Newer messages get smaller keys.
+func messageRowKey(sentAt time.Time, messageID uuid.UUID) string {
+	return sentAtRowKeyBound(sentAt) + "_" + messageID.String()
+}
+
+// sentAtRowKeyBound is the RowKey prefix of messages sent at t. Every message sent after t sorts before it
+// and every message sent at or before t sorts after it.
+func sentAtRowKeyBound(t time.Time) string {
+	return fmt.Sprintf("%s%019d", messageRowKeyPrefix, math.MaxInt64-t.UnixNano())
+}
+
+func messageIndexRowKey(messageID uuid.UUID) string {
+	return messageIndexRowKeyPrefix + messageID.String()
+}
+
+// messageSequenceRowKey builds the RowKey of a sequence entity. Newer messages get larger keys.
+func messageSequenceRowKey(sentAt time.Time, messageID uuid.UUID) string {
+	return fmt.Sprintf("%s%019d_%s", messageSequenceRowKeyPrefix, sentAt.UnixNano(), messageID.String())
+}
+
+// messageTermRowKey builds the RowKey of a search term entity. Terms only contain letters and digits,
+// which all sort before or after "_" and "`", so the entities of one term form a contiguous range.
+func messageTermRowKey(term string, messageRowKey string) string {
+	return messageTermRowKeyPrefix + term + "_" + messageRowKey
+}
+
 // entityMapper handles conversion between Message and MessageEntity
 type entityMapper struct{}
 
 func (m *entityMapper) toEntity(groupID uuid.UUID, message *models.Message) MessageEntity {
 	return MessageEntity{
-		PartitionKey: groupID.String(),
-		RowKey:       message.ID.String(),
-		SenderID:     message.SenderID.String(),
-		SenderName:   message.SenderName,
-		Content:      message.Content,
-		SentAt:       message.SentAt.UTC().Format(time.RFC3339),
-		IsPinned:     message.IsPinned,
+		PartitionKey:  groupID.String(),
+		RowKey:        messageRowKey(message.SentAt, message.ID),
+		MessageID:     message.ID.String(),
+		SenderID:      message.SenderID.String(),
+		SenderName:    message.SenderName,
+		SenderBadge:   string(message.SenderBadge),
+		Content:       message.Content,
+		SentAt:        message.SentAt.UTC().Format(time.RFC3339Nano),
+		IsPinned:      message.IsPinned,
+		SchemaVersion: messageSchemaVersion,
+		Envelopes:     envelopesProperty(message.Envelopes),
 	}
 }
 
-func (m *entityMapper) toMessage(rawEntity map[string]interface{}) (*models.Message, error) {
-	messageID, err := uuid.Parse(rawEntity["RowKey"].(string))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse message ID: %w", err)
+// envelopesProperty encodes key envelopes for the Envelopes property, empty for messages without them
+func envelopesProperty(envelopes []models.KeyEnvelope) string {
+	if len(envelopes) == 0 {
+		return ""
 	}
+	// Envelopes only consist of strings and UUIDs, which always encode
+	data, _ := json.Marshal(envelopes)
+	return string(data)
+}
+
+func (m *entityMapper) toIndexEntity(groupID uuid.UUID, message *models.Message) MessageIndexEntity {
+	return MessageIndexEntity{
+		PartitionKey:  groupID.String(),
+		RowKey:        messageIndexRowKey(message.ID),
+		MessageRowKey: messageRowKey(message.SentAt, message.ID),
+	}
+}
+
+func (m *entityMapper) toSequenceEntity(groupID uuid.UUID, message *models.Message) MessageSequenceEntity {
+	return MessageSequenceEntity{
+		PartitionKey:  groupID.String(),
+		RowKey:        messageSequenceRowKey(message.SentAt, message.ID),
+		MessageRowKey: messageRowKey(message.SentAt, message.ID),
+	}
+}
+
+func (m *entityMapper) toTermEntities(groupID uuid.UUID, message *models.Message, terms []string) []interface{} {
+	rowKey := messageRowKey(message.SentAt, message.ID)
+
+	entities := make([]interface{}, 0, len(terms))
+	for _, term := range terms {
+		entities = append(entities, MessageTermEntity{
+			PartitionKey:  groupID.String(),
+			RowKey:        messageTermRowKey(term, rowKey),
+			MessageRowKey: rowKey,
+		})
+	}
+	return entities
+}
+
+// toMessage decodes a stored message. Properties missing from older entities fall back to the values
+// encoded in the RowKey or to their zero value.
+func (m *entityMapper) toMessage(rawEntity map[string]interface{}) (*models.Message, error) {
+	fields := entityFields(rawEntity)
+	rowKey := fields.stringField("RowKey")
 
-	groupID, err := uuid.Parse(rawEntity["PartitionKey"].(string))
+	groupID, err := uuid.Parse(fields.stringField("PartitionKey"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse group ID: %w", err)
 	}
 
-	senderID, err := uuid.Parse(rawEntity["SenderID"].(string))
+	messageID, err := uuid.Parse(fields.stringField("MessageID"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse sender ID: %w", err)
+		// Both the current and the legacy RowKey end with the message ID
+		messageID, err = uuid.Parse(rowKey[strings.LastIndex(rowKey, "_")+1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse message ID of %s: %w", rowKey, err)
+		}
 	}
 
-	sentAt, err := time.Parse(time.RFC3339, rawEntity["SentAt"].(string))
+	var senderID uuid.UUID
+	if value := fields.stringField("SenderID"); value != "" {
+		senderID, err = uuid.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sender ID: %w", err)
+		}
+	}
+
+	sentAt, ok, err := fields.timeField("SentAt")
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse sent time: %w", err)
 	}
+	if !ok {
+		sentAt, err = sentAtFromRowKey(rowKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sent time: %w", err)
+		}
+	}
+
+	var envelopes []models.KeyEnvelope
+	if value := fields.stringField("Envelopes"); value != "" {
+		if err := json.Unmarshal([]byte(value), &envelopes); err != nil {
+			return nil, fmt.Errorf("failed to parse key envelopes of %s: %w", rowKey, err)
+		}
+	}
 
 	return &models.Message{
-		ID:         messageID,
-		GroupID:    groupID,
-		SenderID:   senderID,
-		SenderName: rawEntity["SenderName"].(string),
-		Content:    rawEntity["Content"].(string),
-		SentAt:     sentAt,
-		IsPinned:   rawEntity["IsPinned"].(bool),
+		ID:          messageID,
+		GroupID:     groupID,
+		SenderID:    senderID,
+		SenderName:  fields.stringField("SenderName"),
+		SenderBadge: models.SenderBadge(fields.stringField("SenderBadge")),
+		Content:     fields.stringField("Content"),
+		SentAt:      sentAt,
+		IsPinned:    fields.boolField("IsPinned"),
+		ETag:        fields.stringField("odata.etag"),
+		Envelopes:   envelopes,
 	}, nil
 }
 
@@ -85,32 +234,46 @@ type tableOperations struct {
 	table *aztables.Client
 }
 
-func (t *tableOperations) addEntity(ctx context.Context, entity interface{}) error {
-	marshaled, err := json.Marshal(entity)
-	if err != nil {
-		return fmt.Errorf("failed to marshal entity: %w", err)
+func (t *tableOperations) addEntities(ctx context.Context, entities ...interface{}) error {
+	return t.submitEntities(ctx, aztables.TransactionTypeAdd, entities)
+}
+
+// submitEntities applies the same action to entities of one partition in a single transaction
+func (t *tableOperations) submitEntities(ctx context.Context, actionType aztables.TransactionType, entities []interface{}) error {
+	actions := make([]aztables.TransactionAction, 0, len(entities))
+	for _, entity := range entities {
+		marshaled, err := json.Marshal(entity)
+		if err != nil {
+			return fmt.Errorf("failed to marshal entity: %w", err)
+		}
+		actions = append(actions, aztables.TransactionAction{ActionType: actionType, Entity: marshaled})
 	}
 
-	_, err = t.table.AddEntity(ctx, marshaled, nil)
+	_, err := t.table.SubmitTransaction(ctx, actions, nil)
 	if err != nil {
-		return fmt.Errorf("failed to add entity: %w", err)
+		return fmt.Errorf("failed to submit entities: %w", err)
 	}
 
 	return nil
 }
 
-func (t *tableOperations) updateEntity(ctx context.Context, entity interface{}) error {
+// updateEntity replaces an entity that still has the given ETag and returns its new ETag
+func (t *tableOperations) updateEntity(ctx context.Context, entity interface{}, etag string) (string, error) {
 	marshaled, err := json.Marshal(entity)
 	if err != nil {
-		return fmt.Errorf("failed to marshal entity: %w", err)
+		return "", fmt.Errorf("failed to marshal entity: %w", err)
 	}
 
-	_, err = t.table.UpdateEntity(ctx, marshaled, nil)
+	ifMatch := azcore.ETag(etag)
+	response, err := t.table.UpdateEntity(ctx, marshaled, &aztables.UpdateEntityOptions{
+		IfMatch:    &ifMatch,
+		UpdateMode: aztables.UpdateModeReplace,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to update entity: %w", err)
+		return "", fmt.Errorf("failed to update entity: %w", err)
 	}
 
-	return nil
+	return string(response.ETag), nil
 }
 
 func (t *tableOperations) getAndUnmarshalEntity(ctx context.Context, partitionKey, rowKey string) (map[string]interface{}, error) {
@@ -123,6 +286,9 @@ func (t *tableOperations) getAndUnmarshalEntity(ctx context.Context, partitionKe
 	if err := json.Unmarshal(entity.Value, &rawEntity); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal entity: %w", err)
 	}
+	if _, ok := rawEntity["odata.etag"]; !ok && entity.ETag != "" {
+		rawEntity["odata.etag"] = string(entity.ETag)
+	}
 
 	return rawEntity, nil
 }
@@ -130,126 +296,266 @@ func (t *tableOperations) getAndUnmarshalEntity(ctx context.Context, partitionKe
 // queryBuilder handles building Azure Table queries
 type queryBuilder struct{}
 
-func (q *queryBuilder) buildMessageFilter(groupID uuid.UUID, query *models.PaginationQuery, cursorTime *time.Time) string {
-	filter := fmt.Sprintf("PartitionKey eq '%s'", groupID.String())
+// buildMessageRangeFilter selects the messages of a group with a RowKey in [from, to)
+func (q *queryBuilder) buildMessageRangeFilter(groupID uuid.UUID, from string, to string) string {
+	return fmt.Sprintf("PartitionKey eq '%s' and RowKey ge '%s' and RowKey lt '%s'", groupID.String(), from, to)
+}
 
-	if cursorTime != nil {
-		if query.Direction == "previous" {
-			filter += fmt.Sprintf(" and SentAt gt '%s'", cursorTime.UTC().Format("2006-01-02T15:04:05Z"))
-		} else {
-			filter += fmt.Sprintf(" and SentAt lt '%s'", cursorTime.UTC().Format("2006-01-02T15:04:05Z"))
-		}
+// buildMessageFilter selects the messages older than the cursor, or every message without one
+func (q *queryBuilder) buildMessageFilter(groupID uuid.UUID, cursorRowKey string) string {
+	if cursorRowKey == "" {
+		return q.buildMessageRangeFilter(groupID, messageRowKeyPrefix, messageRowKeyRangeEnd)
 	}
-
-	return filter
+	return fmt.Sprintf("PartitionKey eq '%s' and RowKey gt '%s' and RowKey lt '%s'",
+		groupID.String(), cursorRowKey, messageRowKeyRangeEnd)
 }
 
 func (q *queryBuilder) buildUnreadMessagesFilter(groupID uuid.UUID, lastReadTime time.Time) string {
-	return fmt.Sprintf("PartitionKey eq '%s' and SentAt gt '%s'",
-		groupID.String(),
-		lastReadTime.UTC().Format(time.RFC3339))
+	return q.buildMessageRangeFilter(groupID, messageRowKeyPrefix, sentAtRowKeyBound(lastReadTime))
 }
 
 func (m *entityMapper) parseLastReadTime(rawEntity map[string]interface{}) (time.Time, error) {
-	lastReadTime, err := time.Parse(time.RFC3339, rawEntity["LastReadTime"].(string))
+	lastReadTime, ok, err := entityFields(rawEntity).timeField("LastReadTime")
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to parse last read time: %w", err)
 	}
+	if !ok {
+		// Treated like a user that never read the chat
+		return time.Now().UTC(), nil
+	}
 	return lastReadTime, nil
 }
 
-func NewMessageRepository(client *aztables.ServiceClient) (MessageRepository, error) {
+func NewMessageRepository(client *TableService) (MessageRepository, error) {
+	return newMessageRepository(client, nil)
+}
+
+// NewEncryptedMessageRepository stores message content encrypted with cipher. Messages stored in plaintext
+// before are still read.
+func NewEncryptedMessageRepository(client *TableService, cipher *ContentCipher) (MessageRepository, error) {
+	return newMessageRepository(client, cipher)
+}
+
+func newMessageRepository(client *TableService, cipher *ContentCipher) (*messageRepository, error) {
 	table := client.NewClient(MessagesTable)
 
 	_, err := table.CreateTable(context.Background(), nil)
 	if err != nil {
 		if strings.Contains(err.Error(), "TableAlreadyExists") {
-			return &messageRepository{table: table}, nil
+			return &messageRepository{table: table, cipher: cipher}, nil
 		}
 		return nil, fmt.Errorf("failed to create/verify table: %w", err)
 	}
 
-	return &messageRepository{table: table}, nil
+	return &messageRepository{table: table, cipher: cipher}, nil
 }
 
+// CreateMessage stores the message, its index and sequence entities and as many search terms as fit in a single
+// transaction. The terms of long messages that do not fit are added in follow-up transactions.
 func (r *messageRepository) CreateMessage(ctx context.Context, groupID uuid.UUID, message *models.Message) error {
 	mapper := &entityMapper{}
 	ops := &tableOperations{table: r.table}
 
-	entity := mapper.toEntity(groupID, message)
-	return ops.addEntity(ctx, entity)
-}
-
-func (r *messageRepository) ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error) {
-	message, err := r.GetMessageByID(ctx, groupID, messageID)
+	entity, err := r.toStoredEntity(ctx, groupID, message)
+	if err != nil {
+		return err
+	}
+	indexTerms, err := r.indexTerms(ctx, groupID, message)
 	if err != nil {
-		return nil, fmt.Errorf("error getting message by ID: %v", err)
+		return err
 	}
 
-	message.IsPinned = !message.IsPinned
+	entities := []interface{}{entity, mapper.toIndexEntity(groupID, message), mapper.toSequenceEntity(groupID, message)}
+	terms := mapper.toTermEntities(groupID, message, indexTerms)
+
+	inFirst := min(len(terms), maxTransactionActions-len(entities))
+	if err := ops.addEntities(ctx, append(entities, terms[:inFirst]...)...); err != nil {
+		return err
+	}
+
+	for batch := range slices.Chunk(terms[inFirst:], maxTransactionActions) {
+		if err := ops.submitEntities(ctx, aztables.TransactionTypeInsertReplace, batch); err != nil {
+			return fmt.Errorf("failed to index message %s: %w", message.ID, err)
+		}
+	}
+	return nil
+}
 
+// ToggleMessagePin replaces the message only if it still has the ETag it was read with. When another writer
+// changed it in between, the toggle is applied again to the new version, unless the caller asked for a
+// specific version with ifMatch.
+func (r *messageRepository) ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID, ifMatch string) (*models.Message, error) {
 	mapper := &entityMapper{}
 	ops := &tableOperations{table: r.table}
 
-	entity := mapper.toEntity(groupID, message)
-	if err := ops.updateEntity(ctx, entity); err != nil {
-		return nil, err
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		message, keyID, err := r.getMessage(ctx, groupID, messageID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting message by ID: %w", err)
+		}
+		if ifMatch != "" && message.ETag != ifMatch {
+			return nil, fmt.Errorf("message %s: %w", messageID, ErrConflict)
+		}
+
+		message.IsPinned = !message.IsPinned
+		// Plaintext messages stay plaintext; the reencrypt command encrypts them together with their search terms
+		entity := mapper.toEntity(groupID, message)
+		if keyID != "" {
+			if entity, err = r.toStoredEntity(ctx, groupID, message); err != nil {
+				return nil, err
+			}
+		}
+
+		etag, err := ops.updateEntity(ctx, entity, message.ETag)
+		if err == nil {
+			message.ETag = etag
+			return message, nil
+		}
+		if !isConditionNotSatisfied(err) {
+			return nil, err
+		}
+		if ifMatch != "" {
+			return nil, fmt.Errorf("message %s: %w", messageID, ErrConflict)
+		}
+		// Another writer changed the message since it was read, toggle the new version
 	}
 
-	return message, nil
+	return nil, fmt.Errorf("message %s changed %d times while updating: %w", messageID, maxUpdateAttempts, ErrConflict)
 }
 
 func (r *messageRepository) GetMessageByID(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error) {
+	message, _, err := r.getMessage(ctx, groupID, messageID)
+	return message, err
+}
+
+// getMessage reads a message together with the ID of the key its content is stored with, empty for plaintext
+func (r *messageRepository) getMessage(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, string, error) {
+	rowKey, err := r.lookupRowKey(ctx, groupID, messageID)
+	if err != nil {
+		return nil, "", err
+	}
+
 	ops := &tableOperations{table: r.table}
-	rawEntity, err := ops.getAndUnmarshalEntity(ctx, groupID.String(), messageID.String())
+	rawEntity, err := ops.getAndUnmarshalEntity(ctx, groupID.String(), rowKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get message: %w", err)
+		if isNotFound(err) {
+			return nil, "", fmt.Errorf("message %s: %w", messageID, ErrNotFound)
+		}
+		return nil, "", fmt.Errorf("failed to get message: %w", err)
 	}
 
-	mapper := &entityMapper{}
-	return mapper.toMessage(rawEntity)
+	message, err := r.decodeMessage(ctx, rawEntity)
+	if err != nil {
+		return nil, "", err
+	}
+	return message, entityFields(rawEntity).stringField(contentKeyIDField), nil
 }
 
-func (r *messageRepository) GetMessages(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error) {
-	var cursorTime *time.Time
-	if query.Cursor != nil && *query.Cursor != "" {
-		cursorUUID, err := uuid.Parse(*query.Cursor)
-		if err != nil {
-			return nil, nil, fmt.Errorf("invalid cursor format: %w", err)
+// lookupRowKey resolves the RowKey of a message through its index entity
+func (r *messageRepository) lookupRowKey(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (string, error) {
+	response, err := r.table.GetEntity(ctx, groupID.String(), messageIndexRowKey(messageID), nil)
+	if err != nil {
+		if isNotFound(err) {
+			return "", fmt.Errorf("message %s: %w", messageID, ErrNotFound)
 		}
+		return "", fmt.Errorf("failed to get message index: %w", err)
+	}
+
+	var index MessageIndexEntity
+	if err := json.Unmarshal(response.Value, &index); err != nil {
+		return "", fmt.Errorf("failed to unmarshal message index: %w", err)
+	}
+	return index.MessageRowKey, nil
+}
 
-		cursorMsg, err := r.GetMessageByID(ctx, groupID, cursorUUID)
+// GetMessages returns a page of messages, newest first. Pages towards older messages are read in
+// native key order and stop as soon as the page is full. Pages towards newer messages are found through
+// the sequence entities, which list the messages after the cursor oldest first.
+func (r *messageRepository) GetMessages(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error) {
+	hasCursor := query.Position != nil
+	previous := hasCursor && query.Direction == models.Previous
+
+	if previous {
+		messages, hasMore, err := r.newerMessages(ctx, groupID, *query.Position, query.PageSize)
 		if err != nil {
-			return nil, nil, fmt.Errorf("invalid cursor: %w", err)
+			return nil, nil, err
 		}
-		t := cursorMsg.SentAt
-		cursorTime = &t
+		return messages, keysetPagination(messages, true, true, hasMore), nil
+	}
+
+	var cursorRowKey string
+	if hasCursor {
+		cursorRowKey = messageRowKey(query.Position.SentAt, query.Position.MessageID)
 	}
 
 	qb := &queryBuilder{}
-	filter := qb.buildMessageFilter(groupID, &query, cursorTime)
+	filter := qb.buildMessageFilter(groupID, cursorRowKey)
 
-	messages, err := r.fetchMessages(ctx, filter, query.PageSize)
+	// Fetch one extra message to find out whether there is another page
+	messages, err := r.fetchMessages(ctx, filter, query.PageSize+1)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	if query.Search != nil && *query.Search != "" {
-		messages = r.filterMessagesByContent(messages, *query.Search)
+	hasMore := len(messages) > query.PageSize
+	if hasMore {
+		messages = messages[:query.PageSize]
 	}
 
-	return r.buildPaginatedResponse(messages, query)
+	return messages, keysetPagination(messages, hasCursor, false, hasMore), nil
 }
 
-func (r *messageRepository) fetchMessages(ctx context.Context, filter string, pageSize int) ([]models.Message, error) {
-	size := int32(pageSize)
-	options := &aztables.ListEntitiesOptions{
-		Filter: &filter,
-		Top:    &size,
+// newerMessages returns up to limit of the messages sent after the cursor that are closest to it, newest
+// first, and whether there are more. The sequence entities after the cursor name the page's messages, which
+// form a contiguous range of message keys that is then read in one query.
+func (r *messageRepository) newerMessages(ctx context.Context, groupID uuid.UUID, cursor models.MessageCursor, limit int) ([]models.Message, bool, error) {
+	filter := fmt.Sprintf("PartitionKey eq '%s' and RowKey gt '%s' and RowKey lt '%s'",
+		groupID.String(), messageSequenceRowKey(cursor.SentAt, cursor.MessageID), messageSequenceRangeEnd)
+	selectFields := "MessageRowKey"
+	top := int32(limit + 1)
+	pager := r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: &filter, Select: &selectFields, Top: &top})
+
+	var rowKeys []string
+	for pager.More() && len(rowKeys) <= limit {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to list message sequence: %w", err)
+		}
+		for _, entity := range page.Entities {
+			var sequence MessageSequenceEntity
+			if err := json.Unmarshal(entity, &sequence); err != nil {
+				return nil, false, fmt.Errorf("failed to unmarshal message sequence: %w", err)
+			}
+			rowKeys = append(rowKeys, sequence.MessageRowKey)
+		}
+	}
+
+	hasMore := len(rowKeys) > limit
+	rowKeys = rowKeys[:min(len(rowKeys), limit)]
+	if len(rowKeys) == 0 {
+		return nil, hasMore, nil
+	}
+
+	// rowKeys run oldest first, so the newest message has the smallest message key
+	filter = fmt.Sprintf("PartitionKey eq '%s' and RowKey ge '%s' and RowKey le '%s'",
+		groupID.String(), rowKeys[len(rowKeys)-1], rowKeys[0])
+	messages, err := r.fetchMessages(ctx, filter, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	return messages, hasMore, nil
+}
+
+// fetchMessages reads messages in native (newest first) order until limit messages were found.
+// A limit of 0 reads every message selected by the filter.
+func (r *messageRepository) fetchMessages(ctx context.Context, filter string, limit int) ([]models.Message, error) {
+	options := &aztables.ListEntitiesOptions{Filter: &filter}
+	if limit > 0 {
+		top := int32(limit)
+		options.Top = &top
 	}
 
 	pager := r.table.NewListEntitiesPager(options)
-	mapper := &entityMapper{}
 	var messages []models.Message
 
 	for pager.More() {
@@ -264,51 +570,38 @@ func (r *messageRepository) fetchMessages(ctx context.Context, filter string, pa
 				return nil, fmt.Errorf("failed to unmarshal entity: %w", err)
 			}
 
-			message, err := mapper.toMessage(rawEntity)
+			message, err := r.decodeMessage(ctx, rawEntity)
 			if err != nil {
 				return nil, err
 			}
 			messages = append(messages, *message)
+			if limit > 0 && len(messages) == limit {
+				return messages, nil
+			}
 		}
 	}
 
 	return messages, nil
 }
 
-func (r *messageRepository) filterMessagesByContent(messages []models.Message, search string) []models.Message {
-	var filtered []models.Message
-	searchLower := strings.ToLower(search)
-
-	for _, msg := range messages {
-		if strings.Contains(strings.ToLower(msg.Content), searchLower) {
-			filtered = append(filtered, msg)
-		}
-	}
-	return filtered
-}
-
-// ptr returns a pointer to the string
-func ptr(s string) *string {
-	return &s
-}
-
-func (r *messageRepository) buildPaginatedResponse(messages []models.Message, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error) {
+// keysetPagination reports whether there are older (next) and newer (previous) messages around a
+// newest-first page. Moving in one direction always leaves the cursor message behind, so that side
+// is known to have more messages. The cursors themselves are issued by the message service.
+func keysetPagination(messages []models.Message, hasCursor bool, previous bool, hasMore bool) *models.PaginationResponse {
 	pagination := &models.PaginationResponse{}
+	if len(messages) == 0 {
+		return pagination
+	}
 
-	if len(messages) > 0 {
-		if len(messages) > query.PageSize {
-			messages = messages[:query.PageSize]
-			pagination.HasNext = true
-			pagination.NextCursor = ptr(messages[len(messages)-1].ID.String())
-		}
-
-		if query.Cursor != nil {
-			pagination.HasPrevious = true
-			pagination.PreviousCursor = ptr(messages[0].ID.String())
-		}
+	if previous {
+		pagination.HasNext = true
+		pagination.HasPrevious = hasMore
+	} else {
+		pagination.HasNext = hasMore
+		pagination.HasPrevious = hasCursor
 	}
 
-	return messages, pagination, nil
+	return pagination
 }
 
 func (r *messageRepository) CountUnreadMessages(ctx context.Context, groupID uuid.UUID, lastReadTime time.Time) (int, error) {
@@ -340,11 +633,68 @@ func (r *messageRepository) countFilteredEntities(ctx context.Context, options *
 	return count, nil
 }
 
+// GetMessagesSince returns up to limit of the newest messages sent after since, oldest first
+func (r *messageRepository) GetMessagesSince(ctx context.Context, groupID uuid.UUID, since time.Time, limit int) ([]models.Message, error) {
+	qb := &queryBuilder{}
+	filter := qb.buildUnreadMessagesFilter(groupID, since)
+
+	messages, err := r.fetchMessages(ctx, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// ListGroupIDs skips from partition to partition: every query asks for the first message of a group
+// after the previous one, so the cost grows with the number of groups rather than messages.
+func (r *messageRepository) ListGroupIDs(ctx context.Context) ([]uuid.UUID, error) {
+	var groupIDs []uuid.UUID
+	selectFields := "PartitionKey"
+	top := int32(1)
+	after := ""
+
+	for {
+		filter := fmt.Sprintf("PartitionKey gt '%s' and RowKey ge '%s' and RowKey lt '%s'", after, messageRowKeyPrefix, messageRowKeyRangeEnd)
+		pager := r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: &filter, Select: &selectFields, Top: &top})
+
+		next := ""
+		for next == "" && pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list groups: %w", err)
+			}
+			// Pages can be empty while the service scans past other entities
+			if len(page.Entities) == 0 {
+				continue
+			}
+			fields, err := decodeEntityFields(page.Entities[0])
+			if err != nil {
+				return nil, err
+			}
+			next = fields.stringField("PartitionKey")
+		}
+		if next == "" {
+			return groupIDs, nil
+		}
+
+		groupID, err := uuid.Parse(next)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group partition %q: %w", next, err)
+		}
+		groupIDs = append(groupIDs, groupID)
+		after = next
+	}
+}
+
 func (r *messageRepository) GetLastReadTime(ctx context.Context, groupID uuid.UUID, userID uuid.UUID) (time.Time, error) {
 	ops := &tableOperations{table: r.table}
 	rawEntity, err := ops.getAndUnmarshalEntity(ctx, groupID.String(), userID.String())
 	if err != nil {
-		if strings.Contains(err.Error(), "ResourceNotFound") {
+		if isNotFound(err) {
 			return time.Now().UTC(), nil
 		}
 		return time.Time{}, fmt.Errorf("failed to get last read time: %w", err)
@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageRowKeyOrdering(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sentTimes := []time.Time{
+		start,
+		start.Add(500 * time.Millisecond),
+		start.Add(time.Second),
+		start.Add(24 * time.Hour),
+		start.AddDate(10, 0, 0),
+	}
+
+	var keys []string
+	for _, sentAt := range sentTimes {
+		keys = append(keys, messageRowKey(sentAt, uuid.New()))
+	}
+
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+	for i := range keys {
+		assert.Equal(t, keys[len(keys)-1-i], sorted[i], "native key order is newest first")
+	}
+
+	for _, key := range keys {
+		assert.True(t, key >= messageRowKeyPrefix && key < messageRowKeyRangeEnd, "message keys stay inside the message range")
+	}
+	assert.False(t, messageIndexRowKey(uuid.New()) >= messageRowKeyPrefix && messageIndexRowKey(uuid.New()) < messageRowKeyRangeEnd)
+	assert.False(t, uuid.NewString() >= messageRowKeyPrefix, "last read keys fall outside the message range")
+
+	var sequenceKeys []string
+	for _, sentAt := range sentTimes {
+		key := messageSequenceRowKey(sentAt, uuid.New())
+		assert.True(t, key >= messageSequenceRowKeyPrefix && key < messageSequenceRangeEnd, "sequence keys stay inside the sequence range")
+		assert.False(t, key >= messageRowKeyPrefix && key < messageRowKeyRangeEnd)
+		sequenceKeys = append(sequenceKeys, key)
+	}
+	assert.True(t, sort.StringsAreSorted(sequenceKeys), "sequence keys list messages oldest first")
+
+	// Messages sent after the bound sort before it, messages sent at or before it sort after it
+	bound := sentAtRowKeyBound(start.Add(time.Second))
+	assert.Less(t, keys[3], bound)
+	assert.Greater(t, keys[2], bound)
+	assert.Greater(t, keys[1], bound)
+}
+
+func TestToMessageToleratesOlderEntities(t *testing.T) {
+	mapper := &entityMapper{}
+	groupID := uuid.New()
+	messageID := uuid.New()
+	sentAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		entity map[string]interface{}
+		want   models.Message
+	}{
+		{
+			name: "Missing properties fall back to the RowKey and zero values",
+			entity: map[string]interface{}{
+				"PartitionKey": groupID.String(),
+				"RowKey":       messageRowKey(sentAt, messageID),
+			},
+			want: models.Message{ID: messageID, GroupID: groupID, SentAt: sentAt},
+		},
+		{
+			name: "Legacy RowKey and differently typed values",
+			entity: map[string]interface{}{
+				"PartitionKey": groupID.String(),
+				"RowKey":       messageID.String(),
+				"SentAt":       sentAt.Format(time.RFC3339),
+				"SenderName":   "Anna",
+				"Content":      42.0,
+				"IsPinned":     "true",
+			},
+			want: models.Message{ID: messageID, GroupID: groupID, SenderName: "Anna", Content: "42", SentAt: sentAt, IsPinned: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := mapper.toMessage(tt.entity)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, *message)
+		})
+	}
+
+	t.Run("Undecodable entities are errors, not panics", func(t *testing.T) {
+		_, err := mapper.toMessage(map[string]interface{}{"PartitionKey": groupID.String(), "RowKey": "msg_x"})
+		assert.Error(t, err)
+		_, err = mapper.toMessage(map[string]interface{}{})
+		assert.Error(t, err)
+	})
+}
+
+func TestEntitySchemaUpgrades(t *testing.T) {
+	groupID := uuid.New()
+	sentAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	messageID := uuid.New()
+
+	upgraded := make(map[string]interface{})
+	for _, schema := range entitySchemas() {
+		fields := entityFields{"PartitionKey": groupID.String(), "RowKey": messageRowKey(sentAt, messageID), "IsActive": true}
+		entity, err := schema.upgrade(fields)
+		require.NoError(t, err, schema.table)
+		upgraded[schema.table] = entity
+	}
+
+	message := upgraded[MessagesTable].(MessageEntity)
+	assert.Equal(t, messageSchemaVersion, message.SchemaVersion)
+	assert.Equal(t, messageID.String(), message.MessageID)
+	assert.Equal(t, sentAt.Format(time.RFC3339Nano), message.SentAt)
+
+	token := upgraded[FCMTokensTable].(AzureTableEntity)
+	assert.Equal(t, fcmTokenSchemaVersion, token.SchemaVersion)
+	assert.True(t, token.IsActive)
+	assert.Equal(t, userPreferencesSchemaVersion, upgraded[UserPreferencesTable].(UserPreferencesEntity).SchemaVersion)
+	assert.Equal(t, groupSettingsSchemaVersion, upgraded[GroupSettingsTable].(GroupSettingsEntity).SchemaVersion)
+}
+
+func TestUserPreferencesUpgradeKeepsDigestGroup(t *testing.T) {
+	userID, groupID := uuid.New(), uuid.New()
+	lastDigest := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Version 1 kept a single digest group
+	entity := decodeUserPreferencesEntity(entityFields{"PartitionKey": userID.String(), "RowKey": preferencesRowKey,
+		"EmailDigest": true, "DigestGroupID": groupID.String(), "LastDigestAt": lastDigest.Format(time.RFC3339),
+		"SchemaVersion": 1})
+	preferences, err := entity.toPreferences()
+	require.NoError(t, err)
+	assert.True(t, preferences.EmailDigest)
+	assert.Equal(t, map[uuid.UUID]time.Time{groupID: lastDigest}, preferences.DigestGroups)
+}
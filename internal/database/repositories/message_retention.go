@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/google/uuid"
+	"slices"
+	"time"
+)
+
+// ListExpiredMessages returns up to query.Limit messages sent before query.Before, newest first.
+// The expired messages of a group are the tail of its message key range.
+func (r *messageRepository) ListExpiredMessages(ctx context.Context, groupID uuid.UUID, query models.RetentionQuery) ([]models.Message, error) {
+	// Messages sent exactly at Before sort before this bound and are kept
+	from := fmt.Sprintf("RowKey ge '%s'", sentAtRowKeyBound(query.Before.Add(-time.Nanosecond)))
+	if query.Position != nil {
+		from = fmt.Sprintf("RowKey gt '%s'", messageRowKey(query.Position.SentAt, query.Position.MessageID))
+	}
+	filter := fmt.Sprintf("PartitionKey eq '%s' and %s and RowKey lt '%s'", groupID.String(), from, messageRowKeyRangeEnd)
+	if query.KeepPinned {
+		filter += " and IsPinned eq false"
+	}
+
+	return r.fetchMessages(ctx, filter, query.Limit)
+}
+
+// DeleteMessages removes messages together with their index and sequence entities and search terms. Terms
+// and the sequence entity are removed first, so an interrupted delete never leaves entities behind that
+// point at a missing message. With encryption both the blinded terms and the plaintext terms of messages
+// stored before encryption are removed.
+func (r *messageRepository) DeleteMessages(ctx context.Context, groupID uuid.UUID, messages []models.Message) error {
+	mapper := &entityMapper{}
+	ops := &tableOperations{table: r.table}
+
+	for i := range messages {
+		message := &messages[i]
+		termSets, err := r.storedTermSets(ctx, groupID, messageSearchTerms(message))
+		if err != nil {
+			return err
+		}
+		for _, terms := range termSets {
+			if err := r.deleteTermEntities(ctx, mapper.toTermEntities(groupID, message, terms)); err != nil {
+				return fmt.Errorf("failed to delete search terms of message %s: %w", message.ID, err)
+			}
+		}
+
+		// Messages stored before the sequence entities existed may not have one yet
+		sequence := mapper.toSequenceEntity(groupID, message)
+		if _, err := r.table.DeleteEntity(ctx, sequence.PartitionKey, sequence.RowKey, nil); err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed to delete sequence entity of message %s: %w", message.ID, err)
+		}
+
+		err = ops.submitEntities(ctx, aztables.TransactionTypeDelete,
+			[]interface{}{mapper.toEntity(groupID, message), mapper.toIndexEntity(groupID, message)})
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed to delete message %s: %w", message.ID, err)
+		}
+	}
+	return nil
+}
+
+// deleteTermEntities deletes terms in transactions. Messages stored before the search index existed
+// may miss some terms, which fails the whole transaction, so those batches are retried one by one.
+func (r *messageRepository) deleteTermEntities(ctx context.Context, terms []interface{}) error {
+	ops := &tableOperations{table: r.table}
+
+	for batch := range slices.Chunk(terms, maxTransactionActions) {
+		err := ops.submitEntities(ctx, aztables.TransactionTypeDelete, batch)
+		if err == nil {
+			continue
+		}
+		if !isNotFound(err) {
+			return err
+		}
+
+		for _, entity := range batch {
+			term := entity.(MessageTermEntity)
+			if _, err := r.table.DeleteEntity(ctx, term.PartitionKey, term.RowKey, nil); err != nil && !isNotFound(err) {
+				return fmt.Errorf("failed to delete search term: %w", err)
+			}
+		}
+	}
+	return nil
+}
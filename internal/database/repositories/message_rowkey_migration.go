@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"slices"
+)
+
+// legacyMessageFilter selects messages stored with the message ID as RowKey. UUID keys start with a hex
+// digit and sort before "id_" and "msg_"; last read entities share that key space but have no SentAt.
+const legacyMessageFilter = "RowKey lt 'i' and SentAt gt ''"
+
+// MigrateMessageRowKeys rewrites messages stored with the message ID as RowKey to the reverse-chronological
+// RowKey and adds their index and sequence entities. Each message is moved in its own transaction, so an
+// interrupted run can simply be started again. progress is called after every migrated message with the
+// running total.
+func MigrateMessageRowKeys(ctx context.Context, client *TableService, progress func(migrated int)) (int, error) {
+	table := client.NewClient(MessagesTable)
+	filter := legacyMessageFilter
+	mapper := &entityMapper{}
+	migrated := 0
+
+	// Continuation tokens are key based, so rewriting rows behind the pager does not skip any
+	pager := table.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: &filter})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return migrated, fmt.Errorf("failed to list legacy messages: %w", err)
+		}
+
+		for _, raw := range page.Entities {
+			legacy, err := decodeEntityFields(raw)
+			if err != nil {
+				return migrated, fmt.Errorf("failed to unmarshal legacy message: %w", err)
+			}
+
+			if err := migrateLegacyMessage(ctx, table, mapper, legacy); err != nil {
+				return migrated, fmt.Errorf("failed to migrate message %s/%s: %w",
+					legacy.stringField("PartitionKey"), legacy.stringField("RowKey"), err)
+			}
+
+			migrated++
+			if progress != nil {
+				progress(migrated)
+			}
+		}
+	}
+
+	return migrated, nil
+}
+
+func migrateLegacyMessage(ctx context.Context, table *aztables.Client, mapper *entityMapper, legacy entityFields) error {
+	message, err := mapper.toMessage(legacy)
+	if err != nil {
+		return err
+	}
+	groupID := message.GroupID
+
+	stored := mapper.toEntity(groupID, message)
+	stored.ContentKeyID = legacy.stringField(contentKeyIDField)
+	entity, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	index, err := json.Marshal(mapper.toIndexEntity(groupID, message))
+	if err != nil {
+		return err
+	}
+	sequence, err := json.Marshal(mapper.toSequenceEntity(groupID, message))
+	if err != nil {
+		return err
+	}
+	old, err := json.Marshal(map[string]string{"PartitionKey": legacy.stringField("PartitionKey"), "RowKey": legacy.stringField("RowKey")})
+	if err != nil {
+		return err
+	}
+
+	_, err = table.SubmitTransaction(ctx, []aztables.TransactionAction{
+		{ActionType: aztables.TransactionTypeInsertReplace, Entity: entity},
+		{ActionType: aztables.TransactionTypeInsertReplace, Entity: index},
+		{ActionType: aztables.TransactionTypeInsertReplace, Entity: sequence},
+		{ActionType: aztables.TransactionTypeDelete, Entity: old},
+	}, nil)
+	return err
+}
+
+// BuildMessageSequence adds the sequence entity of every stored message, which pages towards newer messages
+// need to find them. Existing entities are replaced, so it can be run again after an interruption. progress
+// is called after every batch with the running total.
+func BuildMessageSequence(ctx context.Context, client *TableService, progress func(added int)) (int, error) {
+	table := client.NewClient(MessagesTable)
+	filter := fmt.Sprintf("RowKey ge '%s' and RowKey lt '%s'", messageRowKeyPrefix, messageRowKeyRangeEnd)
+	selectFields := "PartitionKey,RowKey,MessageID,SentAt"
+	ops := &tableOperations{table: table}
+	mapper := &entityMapper{}
+	added := 0
+
+	pager := table.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: &filter, Select: &selectFields})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return added, fmt.Errorf("failed to list messages: %w", err)
+		}
+
+		// Transactions are limited to one partition
+		byGroup := make(map[string][]interface{})
+		var groups []string
+		for _, raw := range page.Entities {
+			fields, err := decodeEntityFields(raw)
+			if err != nil {
+				return added, fmt.Errorf("failed to unmarshal message: %w", err)
+			}
+			message, err := mapper.toMessage(fields)
+			if err != nil {
+				return added, err
+			}
+			partition := message.GroupID.String()
+			if _, ok := byGroup[partition]; !ok {
+				groups = append(groups, partition)
+			}
+			byGroup[partition] = append(byGroup[partition], mapper.toSequenceEntity(message.GroupID, message))
+		}
+
+		for _, partition := range groups {
+			for batch := range slices.Chunk(byGroup[partition], maxTransactionActions) {
+				if err := ops.submitEntities(ctx, aztables.TransactionTypeInsertReplace, batch); err != nil {
+					return added, fmt.Errorf("failed to add the sequence of group %s: %w", partition, err)
+				}
+				added += len(batch)
+			}
+		}
+		if progress != nil {
+			progress(added)
+		}
+	}
+
+	return added, nil
+}
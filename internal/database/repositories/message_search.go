@@ -0,0 +1,289 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/search"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/google/uuid"
+	"slices"
+)
+
+// entityPager is the part of the aztables pager the term scanner uses
+type entityPager interface {
+	More() bool
+	NextPage(ctx context.Context) (aztables.ListEntitiesResponse, error)
+}
+
+// termScanner reads the RowKeys of the messages containing one term, newest first
+type termScanner struct {
+	// open lists the term entities from the given RowKey filter on
+	open     func(from string) entityPager
+	pager    entityPager
+	rowKeys  []string
+	finished bool
+}
+
+func (r *messageRepository) newTermScanner(groupID uuid.UUID, term string, cursorRowKey string) *termScanner {
+	open := func(from string) entityPager {
+		filter := fmt.Sprintf("PartitionKey eq '%s' and %s and RowKey lt '%s'",
+			groupID.String(), from, messageTermRowKeyPrefix+term+"`")
+		selectFields := "MessageRowKey"
+		return r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: &filter, Select: &selectFields})
+	}
+
+	from := fmt.Sprintf("RowKey ge '%s'", messageTermRowKey(term, ""))
+	if cursorRowKey != "" {
+		from = fmt.Sprintf("RowKey gt '%s'", messageTermRowKey(term, cursorRowKey))
+	}
+	return &termScanner{
+		open: func(messageRowKey string) entityPager {
+			if messageRowKey == "" {
+				return open(from)
+			}
+			return open(fmt.Sprintf("RowKey ge '%s'", messageTermRowKey(term, messageRowKey)))
+		},
+	}
+}
+
+// peek returns the next message RowKey without consuming it, or false when the term has no more messages
+func (s *termScanner) peek(ctx context.Context) (string, bool, error) {
+	if s.pager == nil {
+		s.pager = s.open("")
+	}
+	for len(s.rowKeys) == 0 && !s.finished {
+		if !s.pager.More() {
+			s.finished = true
+			break
+		}
+
+		page, err := s.pager.NextPage(ctx)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to list search terms: %w", err)
+		}
+		for _, raw := range page.Entities {
+			var term MessageTermEntity
+			if err := json.Unmarshal(raw, &term); err != nil {
+				return "", false, fmt.Errorf("failed to unmarshal search term: %w", err)
+			}
+			s.rowKeys = append(s.rowKeys, term.MessageRowKey)
+		}
+	}
+
+	if len(s.rowKeys) == 0 {
+		return "", false, nil
+	}
+	return s.rowKeys[0], true, nil
+}
+
+// seek skips the messages newer than rowKey. When the read pages end before rowKey, the listing restarts
+// at rowKey instead of paging through the messages in between.
+func (s *termScanner) seek(rowKey string) {
+	for len(s.rowKeys) > 0 && s.rowKeys[0] < rowKey {
+		s.rowKeys = s.rowKeys[1:]
+	}
+	if len(s.rowKeys) == 0 && !s.finished {
+		s.pager = s.open(rowKey)
+	}
+}
+
+// pop consumes the next message RowKey when it is rowKey
+func (s *termScanner) pop(rowKey string) {
+	if len(s.rowKeys) > 0 && s.rowKeys[0] == rowKey {
+		s.rowKeys = s.rowKeys[1:]
+	}
+}
+
+// wordScanner reads the messages containing one query word: the union of the scanners of its stored terms
+type wordScanner []*termScanner
+
+// peek returns the newest message RowKey across the term scanners without consuming it
+func (w wordScanner) peek(ctx context.Context) (string, bool, error) {
+	var newest string
+	found := false
+	for _, scanner := range w {
+		rowKey, ok, err := scanner.peek(ctx)
+		if err != nil {
+			return "", false, err
+		}
+		if ok && (!found || rowKey < newest) {
+			newest = rowKey
+			found = true
+		}
+	}
+	return newest, found, nil
+}
+
+// estimate returns the number of messages the word was found in so far, and whether that is all of them
+func (w wordScanner) estimate() (int, bool) {
+	count, complete := 0, true
+	for _, scanner := range w {
+		count += len(scanner.rowKeys)
+		complete = complete && scanner.finished
+	}
+	return count, complete
+}
+
+// SearchMessages returns the newest messages older than the query position that contain every query word.
+// The term ranges of every word are sorted newest first, so they are intersected by leapfrogging from the
+// most selective word and only messages containing every word are fetched.
+func (r *messageRepository) SearchMessages(ctx context.Context, groupID uuid.UUID, query models.SearchQuery) ([]models.Message, *models.PaginationResponse, error) {
+	words := search.ParseQuery(query.Text)
+	if len(words) == 0 {
+		return nil, &models.PaginationResponse{}, nil
+	}
+
+	var cursorRowKey string
+	if query.Position != nil {
+		cursorRowKey = messageRowKey(query.Position.SentAt, query.Position.MessageID)
+	}
+
+	var scanners []wordScanner
+	for _, word := range words {
+		termSets, err := r.storedTermSets(ctx, groupID, word)
+		if err != nil {
+			return nil, nil, err
+		}
+		var scanner wordScanner
+		for _, term := range slices.Concat(termSets...) {
+			scanner = append(scanner, r.newTermScanner(groupID, term, cursorRowKey))
+		}
+		scanners = append(scanners, scanner)
+	}
+
+	ops := &tableOperations{table: r.table}
+	var messages []models.Message
+
+	// Fetch one extra message to find out whether there is another page
+	for len(messages) <= query.PageSize {
+		rowKey, found, err := nextTermMatch(ctx, scanners)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !found {
+			break
+		}
+
+		rawEntity, err := ops.getAndUnmarshalEntity(ctx, groupID.String(), rowKey)
+		if err != nil {
+			if isNotFound(err) {
+				// The message was removed after the term was read
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to get message: %w", err)
+		}
+		message, err := r.decodeMessage(ctx, rawEntity)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// The message may have been edited after its terms were read
+		if words.Matches(messageSearchTerms(message)) {
+			messages = append(messages, *message)
+		}
+	}
+
+	hasMore := len(messages) > query.PageSize
+	if hasMore {
+		messages = messages[:query.PageSize]
+	}
+	return messages, &models.PaginationResponse{HasNext: hasMore}, nil
+}
+
+// nextTermMatch consumes the newest message RowKey that every word scanner contains. The words are ordered
+// by how few messages they were found in, and every scanner is moved forward to the newest candidate until
+// all of them agree, so long runs of messages missing a rarer word are skipped.
+func nextTermMatch(ctx context.Context, words []wordScanner) (string, bool, error) {
+	for _, word := range words {
+		if _, _, err := word.peek(ctx); err != nil {
+			return "", false, err
+		}
+	}
+	slices.SortStableFunc(words, func(a, b wordScanner) int {
+		aCount, aComplete := a.estimate()
+		bCount, bComplete := b.estimate()
+		if aComplete != bComplete {
+			if aComplete {
+				return -1
+			}
+			return 1
+		}
+		return aCount - bCount
+	})
+
+	candidate, found, err := words[0].peek(ctx)
+	if err != nil || !found {
+		return "", false, err
+	}
+	for i, agreed := 1, 1; agreed < len(words); i = (i + 1) % len(words) {
+		for _, scanner := range words[i] {
+			scanner.seek(candidate)
+		}
+		rowKey, found, err := words[i].peek(ctx)
+		if err != nil || !found {
+			return "", false, err
+		}
+		if rowKey == candidate {
+			agreed++
+		} else {
+			candidate, agreed = rowKey, 1
+		}
+	}
+
+	for _, word := range words {
+		for _, scanner := range word {
+			scanner.pop(candidate)
+		}
+	}
+	return candidate, true, nil
+}
+
+// BuildMessageSearchIndex adds the search term entities of every stored message. Existing terms are
+// replaced, so it can be run again after an interruption. progress is called after every message with
+// the running total. With a cipher the terms are blinded like those of new messages.
+func BuildMessageSearchIndex(ctx context.Context, client *TableService, cipher *ContentCipher, progress func(indexed int)) (int, error) {
+	table := client.NewClient(MessagesTable)
+	filter := fmt.Sprintf("RowKey ge '%s' and RowKey lt '%s'", messageRowKeyPrefix, messageRowKeyRangeEnd)
+	r := &messageRepository{table: table, cipher: cipher}
+	ops := &tableOperations{table: table}
+	mapper := &entityMapper{}
+	indexed := 0
+
+	pager := table.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: &filter})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return indexed, fmt.Errorf("failed to list messages: %w", err)
+		}
+
+		for _, raw := range page.Entities {
+			var rawEntity map[string]interface{}
+			if err := json.Unmarshal(raw, &rawEntity); err != nil {
+				return indexed, fmt.Errorf("failed to unmarshal entity: %w", err)
+			}
+			message, err := r.decodeMessage(ctx, rawEntity)
+			if err != nil {
+				return indexed, err
+			}
+			terms, err := r.indexTerms(ctx, message.GroupID, message)
+			if err != nil {
+				return indexed, err
+			}
+
+			for batch := range slices.Chunk(mapper.toTermEntities(message.GroupID, message, terms), maxTransactionActions) {
+				if err := ops.submitEntities(ctx, aztables.TransactionTypeInsertReplace, batch); err != nil {
+					return indexed, fmt.Errorf("failed to index message %s: %w", message.ID, err)
+				}
+			}
+
+			indexed++
+			if progress != nil {
+				progress(indexed)
+			}
+		}
+	}
+
+	return indexed, nil
+}
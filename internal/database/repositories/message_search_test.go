@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slicePager serves message RowKeys in pages of two and counts the pages it served
+type slicePager struct {
+	rowKeys []string
+	pages   *int
+}
+
+func (p *slicePager) More() bool {
+	return len(p.rowKeys) > 0
+}
+
+func (p *slicePager) NextPage(ctx context.Context) (aztables.ListEntitiesResponse, error) {
+	*p.pages++
+	var response aztables.ListEntitiesResponse
+	for len(p.rowKeys) > 0 && len(response.Entities) < 2 {
+		raw, err := json.Marshal(MessageTermEntity{MessageRowKey: p.rowKeys[0]})
+		if err != nil {
+			return response, err
+		}
+		response.Entities = append(response.Entities, raw)
+		p.rowKeys = p.rowKeys[1:]
+	}
+	return response, nil
+}
+
+// sliceTermScanner lists the given message RowKeys, which have to be sorted
+func sliceTermScanner(rowKeys []string, pages *int) *termScanner {
+	return &termScanner{
+		open: func(from string) entityPager {
+			remaining := rowKeys
+			for len(remaining) > 0 && remaining[0] < from {
+				remaining = remaining[1:]
+			}
+			return &slicePager{rowKeys: remaining, pages: pages}
+		},
+	}
+}
+
+func TestNextTermMatchIntersectsWords(t *testing.T) {
+	ctx := context.Background()
+
+	var common []string
+	for i := 0; i < 100; i++ {
+		common = append(common, fmt.Sprintf("m_%03d", i))
+	}
+	var commonPages, rarePages, stemPages int
+	words := []wordScanner{
+		{sliceTermScanner(common, &commonPages)},
+		{sliceTermScanner([]string{"m_010", "m_050", "m_098"}, &rarePages), sliceTermScanner([]string{"m_060", "m_099x"}, &stemPages)},
+	}
+
+	var matches []string
+	for {
+		rowKey, found, err := nextTermMatch(ctx, words)
+		require.NoError(t, err)
+		if !found {
+			break
+		}
+		matches = append(matches, rowKey)
+	}
+
+	assert.Equal(t, []string{"m_010", "m_050", "m_060", "m_098"}, matches, "only messages containing every word match")
+	assert.Less(t, commonPages, 15, "the common word skips the messages without the rare word instead of paging through all 50 pages")
+}
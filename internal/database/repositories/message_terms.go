@@ -0,0 +1,15 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/search"
+)
+
+// messageSearchTerms returns the terms every backend indexes a message by. The content of end-to-end
+// encrypted messages is ciphertext, so they are not indexed.
+func messageSearchTerms(message *models.Message) []string {
+	if message.IsEndToEndEncrypted() {
+		return nil
+	}
+	return search.IndexTerms(message.Content)
+}
@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS messages (
+    group_id    UUID        NOT NULL,
+    id          UUID        NOT NULL,
+    sender_id   UUID        NOT NULL,
+    sender_name TEXT        NOT NULL,
+    content     TEXT        NOT NULL,
+    sent_at     TIMESTAMPTZ NOT NULL,
+    is_pinned   BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (group_id, id)
+);
+
+-- Keyset pagination walks a group's messages by (sent_at, id), newest first
+CREATE INDEX IF NOT EXISTS messages_group_id_sent_at_idx ON messages (group_id, sent_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS last_read (
+    group_id     UUID        NOT NULL,
+    user_id      UUID        NOT NULL,
+    last_read_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS fcm_tokens (
+    group_id   UUID        NOT NULL,
+    user_id    UUID        NOT NULL,
+    token      TEXT        NOT NULL,
+    is_active  BOOLEAN     NOT NULL DEFAULT TRUE,
+    locale     TEXT        NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id               UUID        PRIMARY KEY,
+    locale                TEXT        NOT NULL DEFAULT '',
+    private_notifications BOOLEAN     NOT NULL DEFAULT FALSE,
+    email_digest          BOOLEAN     NOT NULL DEFAULT FALSE,
+    email                 TEXT        NOT NULL DEFAULT '',
+    digest_group_id       UUID,
+    last_digest_at        TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS user_preferences_email_digest_idx ON user_preferences (user_id) WHERE email_digest;
+
+CREATE TABLE IF NOT EXISTS group_settings (
+    group_id               UUID    PRIMARY KEY,
+    private_notifications  BOOLEAN NOT NULL DEFAULT FALSE,
+    digest_exclude_content BOOLEAN NOT NULL DEFAULT FALSE
+);
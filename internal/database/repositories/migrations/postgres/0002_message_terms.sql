@@ -0,0 +1,11 @@
+-- Inverted search index: one row per distinct term of a message. Terms are produced by the search
+-- package, so they are filled in by the application and not by a trigger.
+CREATE TABLE IF NOT EXISTS message_terms (
+    group_id   UUID NOT NULL,
+    term       TEXT NOT NULL,
+    message_id UUID NOT NULL,
+    PRIMARY KEY (group_id, term, message_id),
+    FOREIGN KEY (group_id, message_id) REFERENCES messages (group_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS message_terms_message_idx ON message_terms (group_id, message_id);
@@ -0,0 +1,18 @@
+ALTER TABLE group_settings
+    ADD COLUMN IF NOT EXISTS retention_days        INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS retention_keep_pinned BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS group_settings_retention_idx ON group_settings (group_id) WHERE retention_days > 0;
+
+-- One row per purged batch. Only message IDs are kept, never content.
+CREATE TABLE IF NOT EXISTS purge_audit (
+    id          UUID        PRIMARY KEY,
+    run_id      UUID        NOT NULL,
+    group_id    UUID        NOT NULL,
+    purged_at   TIMESTAMPTZ NOT NULL,
+    cutoff      TIMESTAMPTZ NOT NULL,
+    keep_pinned BOOLEAN     NOT NULL,
+    message_ids UUID[]      NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS purge_audit_group_id_purged_at_idx ON purge_audit (group_id, purged_at DESC);
@@ -0,0 +1,2 @@
+-- Incremented on every update; the ETag of a message is derived from it
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,27 @@
+ALTER TABLE group_settings
+    ADD COLUMN IF NOT EXISTS end_to_end_encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Key envelopes of end-to-end encrypted messages, stored as the clients sent them
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS envelopes JSONB;
+
+-- Published key bundles, one per device of a group member
+CREATE TABLE IF NOT EXISTS key_bundles (
+    group_id       UUID        NOT NULL,
+    user_id        UUID        NOT NULL,
+    device_id      TEXT        NOT NULL,
+    identity_key   TEXT        NOT NULL,
+    signed_pre_key JSONB       NOT NULL,
+    updated_at     TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (group_id, user_id, device_id)
+);
+
+-- One-time pre-keys are handed out once and deleted when claimed
+CREATE TABLE IF NOT EXISTS one_time_pre_keys (
+    group_id   UUID    NOT NULL,
+    user_id    UUID    NOT NULL,
+    device_id  TEXT    NOT NULL,
+    key_id     INTEGER NOT NULL,
+    public_key TEXT    NOT NULL,
+    PRIMARY KEY (group_id, user_id, device_id, key_id),
+    FOREIGN KEY (group_id, user_id, device_id) REFERENCES key_bundles (group_id, user_id, device_id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+-- Denylist of revoked access tokens (kind 'jti') and login sessions (kind 'sid'). Rows can be deleted once
+-- expires_at has passed, as the tokens they deny have expired by then.
+CREATE TABLE IF NOT EXISTS token_revocations (
+    kind       TEXT        NOT NULL,
+    id         TEXT        NOT NULL,
+    reason     TEXT        NOT NULL DEFAULT '',
+    revoked_by TEXT        NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (kind, id)
+);
+
+CREATE INDEX IF NOT EXISTS token_revocations_expires_at ON token_revocations (expires_at);
@@ -0,0 +1,17 @@
+-- Messages posted in a special capacity, such as by a healthcare professional, carry a badge
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS sender_badge TEXT NOT NULL DEFAULT '';
+
+-- Requests of users overseeing a group. Only routes and IDs are kept, never content.
+CREATE TABLE IF NOT EXISTS access_audit (
+    id          UUID        PRIMARY KEY,
+    group_id    UUID        NOT NULL,
+    user_id     UUID        NOT NULL,
+    role        TEXT        NOT NULL,
+    method      TEXT        NOT NULL,
+    route       TEXT        NOT NULL,
+    message_id  UUID,
+    status      INTEGER     NOT NULL,
+    accessed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS access_audit_group_id_accessed_at_idx ON access_audit (group_id, accessed_at DESC);
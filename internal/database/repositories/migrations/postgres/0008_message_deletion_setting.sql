@@ -0,0 +1,2 @@
+-- Whether members may delete their own messages, as far as the access policy allows it
+ALTER TABLE group_settings ADD COLUMN IF NOT EXISTS allow_message_deletion BOOLEAN NOT NULL DEFAULT FALSE;
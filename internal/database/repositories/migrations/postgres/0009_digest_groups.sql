@@ -0,0 +1,8 @@
+-- Users subscribe to the email digest of each of their groups, with the time of the last digest per group
+ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS digest_groups JSONB NOT NULL DEFAULT '{}';
+
+UPDATE user_preferences
+SET digest_groups = jsonb_build_object(digest_group_id::text, to_jsonb(COALESCE(last_digest_at, now())))
+WHERE digest_group_id IS NOT NULL;
+
+ALTER TABLE user_preferences DROP COLUMN IF EXISTS digest_group_id, DROP COLUMN IF EXISTS last_digest_at;
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	_ "github.com/lib/pq"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// NewPostgresDB connects to PostgreSQL and applies any migrations that have not run yet
+func NewPostgresDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres connection: %w", err)
+	}
+
+	if err := db.PingContext(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	if err := MigratePostgres(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// MigratePostgres applies the embedded migrations in order. Applied versions are recorded in
+// schema_migrations, so running it again only applies the new files.
+func MigratePostgres(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER     PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	files, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		version, err := migrationVersion(file)
+		if err != nil {
+			return err
+		}
+		if err := applyMigration(ctx, db, version, file); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+// migrationVersion extracts the numeric prefix of a migration file name, e.g. 1 for 0001_initial_schema.sql
+func migrationVersion(file string) (int, error) {
+	name := file[strings.LastIndex(file, "/")+1:]
+	prefix, _, found := strings.Cut(name, "_")
+	if !found {
+		return 0, fmt.Errorf("migration %s has no version prefix", name)
+	}
+	version, err := strconv.Atoi(prefix)
+	if err != nil {
+		return 0, fmt.Errorf("migration %s has an invalid version prefix: %w", name, err)
+	}
+	return version, nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, version int, file string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialise concurrent instances starting up against the same database
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE schema_migrations IN EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+
+	var applied int
+	err = tx.QueryRowContext(ctx, "SELECT version FROM schema_migrations WHERE version = $1", version).Scan(&applied)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	script, err := postgresMigrations.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+type postgresAccessAuditRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAccessAuditRepository(db *sql.DB) AccessAuditRepository {
+	return &postgresAccessAuditRepository{db: db}
+}
+
+func (r *postgresAccessAuditRepository) RecordAccess(ctx context.Context, audit *models.AccessAudit) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO access_audit (id, group_id, user_id, role, method, route, message_id, status, accessed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		audit.ID, audit.GroupID, audit.UserID, string(audit.Role), audit.Method, audit.Route, audit.MessageID,
+		audit.Status, audit.AccessedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record access: %w", err)
+	}
+	return nil
+}
+
+// ListAccesses returns the access records of a group, newest first
+func (r *postgresAccessAuditRepository) ListAccesses(ctx context.Context, groupID uuid.UUID) ([]models.AccessAudit, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, group_id, user_id, role, method, route, message_id, status, accessed_at
+		FROM access_audit WHERE group_id = $1 ORDER BY accessed_at DESC, id DESC`,
+		groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accesses: %w", err)
+	}
+	return scanAccessAudits(rows)
+}
+
+// ListAllAccesses returns the access records of every group
+func (r *postgresAccessAuditRepository) ListAllAccesses(ctx context.Context) ([]models.AccessAudit, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, group_id, user_id, role, method, route, message_id, status, accessed_at
+		FROM access_audit ORDER BY group_id, accessed_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accesses: %w", err)
+	}
+	return scanAccessAudits(rows)
+}
+
+func scanAccessAudits(rows *sql.Rows) ([]models.AccessAudit, error) {
+	defer rows.Close()
+
+	var audits []models.AccessAudit
+	for rows.Next() {
+		var audit models.AccessAudit
+		var role string
+		var messageID uuid.NullUUID
+		err := rows.Scan(&audit.ID, &audit.GroupID, &audit.UserID, &role, &audit.Method, &audit.Route, &messageID,
+			&audit.Status, &audit.AccessedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan access audit: %w", err)
+		}
+		audit.Role = models.Role(role)
+		if messageID.Valid {
+			audit.MessageID = &messageID.UUID
+		}
+		audit.AccessedAt = audit.AccessedAt.UTC()
+		audits = append(audits, audit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list accesses: %w", err)
+	}
+	return audits, nil
+}
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+type postgresFCMTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresFCMTokenRepository(db *sql.DB) FCMTokenRepository {
+	return &postgresFCMTokenRepository{db: db}
+}
+
+func (r *postgresFCMTokenRepository) GetGroupMemberTokens(ctx context.Context, groupID uuid.UUID) ([]models.FCMToken, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT group_id, user_id, token, is_active, locale, updated_at
+		FROM fcm_tokens WHERE group_id = $1 AND is_active`,
+		groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group member tokens: %w", err)
+	}
+	return scanTokens(rows)
+}
+
+// ListTokens returns the active tokens of every group
+func (r *postgresFCMTokenRepository) ListTokens(ctx context.Context) ([]models.FCMToken, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT group_id, user_id, token, is_active, locale, updated_at
+		FROM fcm_tokens WHERE is_active ORDER BY group_id, user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+	return scanTokens(rows)
+}
+
+func scanTokens(rows *sql.Rows) ([]models.FCMToken, error) {
+	defer rows.Close()
+
+	var tokens []models.FCMToken
+	for rows.Next() {
+		var (
+			tokenGroupID uuid.UUID
+			userID       uuid.UUID
+			updatedAt    time.Time
+			token        models.FCMToken
+		)
+		if err := rows.Scan(&tokenGroupID, &userID, &token.Token, &token.IsActive, &token.Locale, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+
+		token.PartitionKey = tokenGroupID.String()
+		token.RowKey = userID.String()
+		token.Timestamp = timestamppb.New(updatedAt)
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (r *postgresFCMTokenRepository) SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string, locale string) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO fcm_tokens (group_id, user_id, token, is_active, locale, updated_at)
+		VALUES ($1, $2, $3, TRUE, $4, $5)
+		ON CONFLICT (group_id, user_id) DO UPDATE
+		SET token = EXCLUDED.token, is_active = TRUE, locale = EXCLUDED.locale, updated_at = EXCLUDED.updated_at`,
+		groupID, userID, token, locale, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save token (upsert): %w", err)
+	}
+	return nil
+}
+
+func (r *postgresFCMTokenRepository) DeleteToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx,
+		"DELETE FROM fcm_tokens WHERE group_id = $1 AND user_id = $2",
+		groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("token of user %s: %w", userID, ErrNotFound)
+	}
+	return nil
+}
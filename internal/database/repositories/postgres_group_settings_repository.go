@@ -0,0 +1,95 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+type postgresGroupSettingsRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresGroupSettingsRepository(db *sql.DB) GroupSettingsRepository {
+	return &postgresGroupSettingsRepository{db: db}
+}
+
+const groupSettingsColumns = "group_id, private_notifications, digest_exclude_content, retention_days, retention_keep_pinned, end_to_end_encrypted, allow_message_deletion"
+
+// GetSettings returns the stored settings of a group, or default settings when none were saved yet
+func (r *postgresGroupSettingsRepository) GetSettings(ctx context.Context, groupID uuid.UUID) (*models.GroupSettings, error) {
+	settings := &models.GroupSettings{GroupID: groupID}
+	err := r.db.QueryRowContext(ctx,
+		"SELECT "+groupSettingsColumns+" FROM group_settings WHERE group_id = $1",
+		groupID).Scan(&settings.GroupID, &settings.PrivateNotifications, &settings.DigestExcludeContent,
+		&settings.RetentionDays, &settings.RetentionKeepPinned, &settings.EndToEndEncrypted, &settings.AllowMessageDeletion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return settings, nil
+		}
+		return nil, fmt.Errorf("failed to get group settings: %w", err)
+	}
+	return settings, nil
+}
+
+func (r *postgresGroupSettingsRepository) SaveSettings(ctx context.Context, settings *models.GroupSettings) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO group_settings (`+groupSettingsColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (group_id) DO UPDATE
+		SET private_notifications = EXCLUDED.private_notifications,
+			digest_exclude_content = EXCLUDED.digest_exclude_content,
+			retention_days = EXCLUDED.retention_days,
+			retention_keep_pinned = EXCLUDED.retention_keep_pinned,
+			end_to_end_encrypted = EXCLUDED.end_to_end_encrypted,
+			allow_message_deletion = EXCLUDED.allow_message_deletion`,
+		settings.GroupID, settings.PrivateNotifications, settings.DigestExcludeContent,
+		settings.RetentionDays, settings.RetentionKeepPinned, settings.EndToEndEncrypted, settings.AllowMessageDeletion)
+	if err != nil {
+		return fmt.Errorf("failed to save group settings (upsert): %w", err)
+	}
+	return nil
+}
+
+// ListRetentionPolicies returns the settings of every group that has a retention period
+func (r *postgresGroupSettingsRepository) ListRetentionPolicies(ctx context.Context) ([]models.GroupSettings, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+groupSettingsColumns+" FROM group_settings WHERE retention_days > 0 ORDER BY group_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list retention policies: %w", err)
+	}
+	return scanGroupSettingsRows(rows)
+}
+
+// ListSettings returns the stored settings of every group
+func (r *postgresGroupSettingsRepository) ListSettings(ctx context.Context) ([]models.GroupSettings, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+groupSettingsColumns+" FROM group_settings ORDER BY group_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group settings: %w", err)
+	}
+	return scanGroupSettingsRows(rows)
+}
+
+func scanGroupSettingsRows(rows *sql.Rows) ([]models.GroupSettings, error) {
+	defer rows.Close()
+
+	var list []models.GroupSettings
+	for rows.Next() {
+		var settings models.GroupSettings
+		err := rows.Scan(&settings.GroupID, &settings.PrivateNotifications, &settings.DigestExcludeContent,
+			&settings.RetentionDays, &settings.RetentionKeepPinned, &settings.EndToEndEncrypted, &settings.AllowMessageDeletion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group settings: %w", err)
+		}
+		list = append(list, settings)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list group settings: %w", err)
+	}
+
+	return list, nil
+}
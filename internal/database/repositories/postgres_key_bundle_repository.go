@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+type postgresKeyBundleRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresKeyBundleRepository(db *sql.DB) KeyBundleRepository {
+	return &postgresKeyBundleRepository{db: db}
+}
+
+// SaveBundle replaces the bundle of a device and its one-time pre-keys in one transaction
+func (r *postgresKeyBundleRepository) SaveBundle(ctx context.Context, bundle *models.KeyBundle) error {
+	signedPreKey, err := json.Marshal(bundle.SignedPreKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal signed pre-key: %w", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO key_bundles (group_id, user_id, device_id, identity_key, signed_pre_key, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (group_id, user_id, device_id) DO UPDATE
+		SET identity_key = EXCLUDED.identity_key, signed_pre_key = EXCLUDED.signed_pre_key, updated_at = EXCLUDED.updated_at`,
+		bundle.GroupID, bundle.UserID, bundle.DeviceID, bundle.IdentityKey, signedPreKey, bundle.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save key bundle (upsert): %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM one_time_pre_keys WHERE group_id = $1 AND user_id = $2 AND device_id = $3",
+		bundle.GroupID, bundle.UserID, bundle.DeviceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete one-time pre-keys: %w", err)
+	}
+	for _, preKey := range bundle.OneTimePreKeys {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO one_time_pre_keys (group_id, user_id, device_id, key_id, public_key)
+			VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING`,
+			bundle.GroupID, bundle.UserID, bundle.DeviceID, preKey.KeyID, preKey.PublicKey)
+		if err != nil {
+			return fmt.Errorf("failed to save one-time pre-key: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit key bundle: %w", err)
+	}
+	return nil
+}
+
+// ListBundles returns the bundles of every device in a group, by user and device
+func (r *postgresKeyBundleRepository) ListBundles(ctx context.Context, groupID uuid.UUID) ([]models.KeyBundle, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT group_id, user_id, device_id, identity_key, signed_pre_key, updated_at
+		FROM key_bundles WHERE group_id = $1 ORDER BY user_id::text, device_id`,
+		groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list key bundles: %w", err)
+	}
+	return scanKeyBundles(rows)
+}
+
+// ListAllBundles returns the bundles of every device in every group
+func (r *postgresKeyBundleRepository) ListAllBundles(ctx context.Context) ([]models.KeyBundle, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT group_id, user_id, device_id, identity_key, signed_pre_key, updated_at
+		FROM key_bundles ORDER BY group_id, user_id::text, device_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list key bundles: %w", err)
+	}
+	return scanKeyBundles(rows)
+}
+
+func scanKeyBundles(rows *sql.Rows) ([]models.KeyBundle, error) {
+	defer rows.Close()
+
+	var bundles []models.KeyBundle
+	for rows.Next() {
+		var (
+			bundle       models.KeyBundle
+			signedPreKey []byte
+		)
+		if err := rows.Scan(&bundle.GroupID, &bundle.UserID, &bundle.DeviceID, &bundle.IdentityKey, &signedPreKey, &bundle.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan key bundle: %w", err)
+		}
+		if err := json.Unmarshal(signedPreKey, &bundle.SignedPreKey); err != nil {
+			return nil, fmt.Errorf("failed to decode signed pre-key of device %s: %w", bundle.DeviceID, err)
+		}
+		bundles = append(bundles, bundle)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list key bundles: %w", err)
+	}
+	return bundles, nil
+}
+
+// ClaimPreKey deletes and returns the pre-key with the lowest ID. Rows locked by a concurrent claim are
+// skipped, so every pre-key is handed out once.
+func (r *postgresKeyBundleRepository) ClaimPreKey(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, deviceID string) (*models.PreKey, error) {
+	var preKey models.PreKey
+	err := r.db.QueryRowContext(ctx,
+		`DELETE FROM one_time_pre_keys
+		WHERE (group_id, user_id, device_id, key_id) = (
+			SELECT group_id, user_id, device_id, key_id FROM one_time_pre_keys
+			WHERE group_id = $1 AND user_id = $2 AND device_id = $3
+			ORDER BY key_id LIMIT 1 FOR UPDATE SKIP LOCKED)
+		RETURNING key_id, public_key`,
+		groupID, userID, deviceID).Scan(&preKey.KeyID, &preKey.PublicKey)
+	if err == nil {
+		return &preKey, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to claim pre-key of device %s: %w", deviceID, err)
+	}
+
+	var exists bool
+	err = r.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM key_bundles WHERE group_id = $1 AND user_id = $2 AND device_id = $3)",
+		groupID, userID, deviceID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key bundle of device %s: %w", deviceID, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("key bundle of device %s: %w", deviceID, ErrNotFound)
+	}
+	return nil, nil
+}
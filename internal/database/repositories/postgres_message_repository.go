@@ -0,0 +1,425 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/search"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type postgresMessageRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresMessageRepository(db *sql.DB) MessageRepository {
+	return &postgresMessageRepository{db: db}
+}
+
+const messageColumns = "id, group_id, sender_id, sender_name, sender_badge, content, sent_at, is_pinned, version, envelopes"
+
+// CreateMessage stores the message and its search terms in one transaction
+func (r *postgresMessageRepository) CreateMessage(ctx context.Context, groupID uuid.UUID, message *models.Message) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	envelopes, err := marshalEnvelopes(message.Envelopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO messages (group_id, id, sender_id, sender_name, sender_badge, content, sent_at, is_pinned, envelopes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		groupID, message.ID, message.SenderID, message.SenderName, string(message.SenderBadge), message.Content,
+		message.SentAt.UTC(), message.IsPinned, envelopes)
+	if err != nil {
+		return fmt.Errorf("failed to insert message: %w", err)
+	}
+
+	if err := indexPostgresMessage(ctx, tx, groupID, message); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// indexPostgresMessage stores the search terms of a message, skipping terms that are already stored
+func indexPostgresMessage(ctx context.Context, tx *sql.Tx, groupID uuid.UUID, message *models.Message) error {
+	terms := messageSearchTerms(message)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO message_terms (group_id, term, message_id)
+		SELECT $1, term, $2 FROM unnest($3::text[]) AS term
+		ON CONFLICT DO NOTHING`,
+		groupID, message.ID, pq.Array(terms))
+	if err != nil {
+		return fmt.Errorf("failed to index message: %w", err)
+	}
+	return nil
+}
+
+// ToggleMessagePin flips the pin in a single statement, so concurrent toggles cannot overwrite each other
+// and no retry is needed. Every update increments the row version the ETag is built from.
+func (r *postgresMessageRepository) ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID, ifMatch string) (*models.Message, error) {
+	var version int64
+	if ifMatch != "" {
+		var ok bool
+		if version, ok = parsePostgresETag(ifMatch); !ok {
+			version = -1
+		}
+	}
+
+	row := r.db.QueryRowContext(ctx,
+		`UPDATE messages SET is_pinned = NOT is_pinned, version = version + 1
+		WHERE group_id = $1 AND id = $2 AND ($3::bigint = 0 OR version = $3::bigint)
+		RETURNING `+messageColumns,
+		groupID, messageID, version)
+
+	message, err := scanMessage(row)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to toggle pin: %w", err)
+		}
+		if ifMatch == "" {
+			return nil, fmt.Errorf("message %s: %w", messageID, ErrNotFound)
+		}
+		// Tell a missing message apart from a stale version
+		if _, err := r.GetMessageByID(ctx, groupID, messageID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("message %s: %w", messageID, ErrConflict)
+	}
+	return message, nil
+}
+
+func (r *postgresMessageRepository) GetMessageByID(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error) {
+	row := r.db.QueryRowContext(ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE group_id = $1 AND id = $2",
+		groupID, messageID)
+
+	message, err := scanMessage(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("message %s: %w", messageID, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return message, nil
+}
+
+// GetMessages pages through a group's messages with keyset pagination on (sent_at, id).
+// The next direction walks towards older messages, previous towards newer ones; both return newest first.
+func (r *postgresMessageRepository) GetMessages(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error) {
+	conditions := []string{"group_id = $1"}
+	args := []interface{}{groupID}
+
+	hasCursor := query.Position != nil
+	previous := hasCursor && query.Direction == models.Previous
+	if hasCursor {
+		operator := "<"
+		if previous {
+			operator = ">"
+		}
+		args = append(args, query.Position.SentAt, query.Position.MessageID)
+		conditions = append(conditions, fmt.Sprintf("(sent_at, id) %s ($%d, $%d)", operator, len(args)-1, len(args)))
+	}
+
+	order := "DESC"
+	if previous {
+		order = "ASC"
+	}
+	// Fetch one extra row to find out whether there is another page
+	args = append(args, query.PageSize+1)
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM messages WHERE %s ORDER BY sent_at %s, id %s LIMIT $%d",
+		messageColumns, strings.Join(conditions, " AND "), order, order, len(args)), args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hasMore := len(messages) > query.PageSize
+	if hasMore {
+		messages = messages[:query.PageSize]
+	}
+	if previous {
+		// Rows were read towards newer messages; restore newest-first order
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	return messages, keysetPagination(messages, hasCursor, previous, hasMore), nil
+}
+
+// SearchMessages returns the newest messages older than the query position that contain, for every
+// query word, at least one of its terms
+func (r *postgresMessageRepository) SearchMessages(ctx context.Context, groupID uuid.UUID, query models.SearchQuery) ([]models.Message, *models.PaginationResponse, error) {
+	words := search.ParseQuery(query.Text)
+	if len(words) == 0 {
+		return nil, &models.PaginationResponse{}, nil
+	}
+
+	conditions := []string{"group_id = $1"}
+	args := []interface{}{groupID}
+
+	for _, terms := range words {
+		args = append(args, pq.Array(terms))
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM message_terms t WHERE t.group_id = m.group_id AND t.message_id = m.id AND t.term = ANY($%d))",
+			len(args)))
+	}
+
+	if query.Position != nil {
+		args = append(args, query.Position.SentAt, query.Position.MessageID)
+		conditions = append(conditions, fmt.Sprintf("(sent_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	// Fetch one extra row to find out whether there is another page
+	args = append(args, query.PageSize+1)
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM messages m WHERE %s ORDER BY sent_at DESC, id DESC LIMIT $%d",
+		messageColumns, strings.Join(conditions, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hasMore := len(messages) > query.PageSize
+	if hasMore {
+		messages = messages[:query.PageSize]
+	}
+	return messages, &models.PaginationResponse{HasNext: hasMore}, nil
+}
+
+// BuildPostgresMessageSearchIndex adds the search terms of every stored message in batches ordered by
+// message key. Terms that already exist are kept, so it can be run again after an interruption.
+// progress is called after every batch with the running total.
+func BuildPostgresMessageSearchIndex(ctx context.Context, db *sql.DB, progress func(indexed int)) (int, error) {
+	const batchSize = 500
+	indexed := 0
+	var lastGroupID, lastID uuid.UUID
+
+	for {
+		rows, err := db.QueryContext(ctx,
+			"SELECT "+messageColumns+" FROM messages WHERE (group_id, id) > ($1, $2) ORDER BY group_id, id LIMIT $3",
+			lastGroupID, lastID, batchSize)
+		if err != nil {
+			return indexed, fmt.Errorf("failed to list messages: %w", err)
+		}
+		messages, err := scanMessages(rows)
+		if err != nil {
+			return indexed, err
+		}
+		if len(messages) == 0 {
+			return indexed, nil
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return indexed, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		for i := range messages {
+			if err := indexPostgresMessage(ctx, tx, messages[i].GroupID, &messages[i]); err != nil {
+				tx.Rollback()
+				return indexed, fmt.Errorf("message %s: %w", messages[i].ID, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return indexed, fmt.Errorf("failed to commit search terms: %w", err)
+		}
+
+		indexed += len(messages)
+		if progress != nil {
+			progress(indexed)
+		}
+		last := messages[len(messages)-1]
+		lastGroupID, lastID = last.GroupID, last.ID
+	}
+}
+
+// ListExpiredMessages returns up to query.Limit messages sent before query.Before, newest first
+func (r *postgresMessageRepository) ListExpiredMessages(ctx context.Context, groupID uuid.UUID, query models.RetentionQuery) ([]models.Message, error) {
+	conditions := []string{"group_id = $1", "sent_at < $2"}
+	args := []interface{}{groupID, query.Before.UTC()}
+
+	if query.KeepPinned {
+		conditions = append(conditions, "NOT is_pinned")
+	}
+	if query.Position != nil {
+		args = append(args, query.Position.SentAt, query.Position.MessageID)
+		conditions = append(conditions, fmt.Sprintf("(sent_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	args = append(args, query.Limit)
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM messages WHERE %s ORDER BY sent_at DESC, id DESC LIMIT $%d",
+		messageColumns, strings.Join(conditions, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired messages: %w", err)
+	}
+	return scanMessages(rows)
+}
+
+// DeleteMessages removes messages; their search terms are removed by the foreign key cascade
+func (r *postgresMessageRepository) DeleteMessages(ctx context.Context, groupID uuid.UUID, messages []models.Message) error {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID.String())
+	}
+
+	_, err := r.db.ExecContext(ctx,
+		"DELETE FROM messages WHERE group_id = $1 AND id = ANY($2::uuid[])",
+		groupID, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to delete messages: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresMessageRepository) ListGroupIDs(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT DISTINCT group_id FROM messages ORDER BY group_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groupIDs []uuid.UUID
+	for rows.Next() {
+		var groupID uuid.UUID
+		if err := rows.Scan(&groupID); err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+	return groupIDs, rows.Err()
+}
+
+func (r *postgresMessageRepository) CountUnreadMessages(ctx context.Context, groupID uuid.UUID, lastReadTime time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT count(*) FROM messages WHERE group_id = $1 AND sent_at > $2",
+		groupID, lastReadTime.UTC()).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread messages: %w", err)
+	}
+	return count, nil
+}
+
+// GetMessagesSince returns up to limit of the newest messages sent after since, oldest first
+func (r *postgresMessageRepository) GetMessagesSince(ctx context.Context, groupID uuid.UUID, since time.Time, limit int) ([]models.Message, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT * FROM (
+			SELECT `+messageColumns+` FROM messages
+			WHERE group_id = $1 AND sent_at > $2
+			ORDER BY sent_at DESC, id DESC
+			LIMIT $3
+		) newest ORDER BY sent_at, id`,
+		groupID, since.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+	return scanMessages(rows)
+}
+
+func (r *postgresMessageRepository) GetLastReadTime(ctx context.Context, groupID uuid.UUID, userID uuid.UUID) (time.Time, error) {
+	var lastRead time.Time
+	err := r.db.QueryRowContext(ctx,
+		"SELECT last_read_at FROM last_read WHERE group_id = $1 AND user_id = $2",
+		groupID, userID).Scan(&lastRead)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Now().UTC(), nil
+		}
+		return time.Time{}, fmt.Errorf("failed to get last read time: %w", err)
+	}
+	return lastRead.UTC(), nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMessage(row rowScanner) (*models.Message, error) {
+	var message models.Message
+	var version int64
+	var badge string
+	var envelopes []byte
+	err := row.Scan(&message.ID, &message.GroupID, &message.SenderID, &message.SenderName, &badge,
+		&message.Content, &message.SentAt, &message.IsPinned, &version, &envelopes)
+	if err != nil {
+		return nil, err
+	}
+	if envelopes != nil {
+		if err := json.Unmarshal(envelopes, &message.Envelopes); err != nil {
+			return nil, fmt.Errorf("failed to decode key envelopes of message %s: %w", message.ID, err)
+		}
+	}
+	message.SenderBadge = models.SenderBadge(badge)
+	message.SentAt = message.SentAt.UTC()
+	message.ETag = postgresETag(version)
+	return &message, nil
+}
+
+// marshalEnvelopes encodes key envelopes for the envelopes column, NULL for messages without them
+func marshalEnvelopes(envelopes []models.KeyEnvelope) ([]byte, error) {
+	if len(envelopes) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(envelopes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key envelopes: %w", err)
+	}
+	return data, nil
+}
+
+// postgresETag builds the ETag of a row version
+func postgresETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+func parsePostgresETag(etag string) (int64, bool) {
+	version, err := strconv.ParseInt(strings.Trim(etag, `"`), 10, 64)
+	return version, err == nil && version > 0
+}
+
+func scanMessages(rows *sql.Rows) ([]models.Message, error) {
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, *message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+	return messages, nil
+}
@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type postgresPurgeAuditRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresPurgeAuditRepository(db *sql.DB) PurgeAuditRepository {
+	return &postgresPurgeAuditRepository{db: db}
+}
+
+func (r *postgresPurgeAuditRepository) RecordPurge(ctx context.Context, audit *models.PurgeAudit) error {
+	messageIDs := make([]string, 0, len(audit.MessageIDs))
+	for _, id := range audit.MessageIDs {
+		messageIDs = append(messageIDs, id.String())
+	}
+
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO purge_audit (id, run_id, group_id, purged_at, cutoff, keep_pinned, message_ids)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::uuid[])`,
+		audit.ID, audit.RunID, audit.GroupID, audit.PurgedAt.UTC(), audit.Cutoff.UTC(), audit.KeepPinned,
+		pq.Array(messageIDs))
+	if err != nil {
+		return fmt.Errorf("failed to record purge: %w", err)
+	}
+	return nil
+}
+
+// ListPurges returns the purge records of a group, newest first
+func (r *postgresPurgeAuditRepository) ListPurges(ctx context.Context, groupID uuid.UUID) ([]models.PurgeAudit, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, run_id, group_id, purged_at, cutoff, keep_pinned, message_ids
+		FROM purge_audit WHERE group_id = $1 ORDER BY purged_at DESC, id DESC`,
+		groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list purges: %w", err)
+	}
+	return scanPurgeAudits(rows)
+}
+
+// ListAllPurges returns the purge records of every group
+func (r *postgresPurgeAuditRepository) ListAllPurges(ctx context.Context) ([]models.PurgeAudit, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, run_id, group_id, purged_at, cutoff, keep_pinned, message_ids
+		FROM purge_audit ORDER BY group_id, purged_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list purges: %w", err)
+	}
+	return scanPurgeAudits(rows)
+}
+
+func scanPurgeAudits(rows *sql.Rows) ([]models.PurgeAudit, error) {
+	defer rows.Close()
+
+	var audits []models.PurgeAudit
+	for rows.Next() {
+		var audit models.PurgeAudit
+		var messageIDs []string
+		err := rows.Scan(&audit.ID, &audit.RunID, &audit.GroupID, &audit.PurgedAt, &audit.Cutoff, &audit.KeepPinned,
+			pq.Array(&messageIDs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan purge audit: %w", err)
+		}
+
+		audit.MessageIDs = make([]uuid.UUID, 0, len(messageIDs))
+		for _, raw := range messageIDs {
+			messageID, err := uuid.Parse(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse purged message ID: %w", err)
+			}
+			audit.MessageIDs = append(audit.MessageIDs, messageID)
+		}
+		audits = append(audits, audit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list purges: %w", err)
+	}
+	return audits, nil
+}
@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type postgresTokenRevocationRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresTokenRevocationRepository(db *sql.DB) TokenRevocationRepository {
+	return &postgresTokenRevocationRepository{db: db}
+}
+
+func (r *postgresTokenRevocationRepository) Revoke(ctx context.Context, revocation *models.TokenRevocation) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO token_revocations (kind, id, reason, revoked_by, revoked_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (kind, id) DO UPDATE
+		SET reason = EXCLUDED.reason,
+			revoked_by = EXCLUDED.revoked_by,
+			revoked_at = EXCLUDED.revoked_at,
+			expires_at = EXCLUDED.expires_at`,
+		string(revocation.Kind), revocation.ID, revocation.Reason, revocation.RevokedBy,
+		revocation.RevokedAt, revocation.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to save token revocation (upsert): %w", err)
+	}
+	return nil
+}
+
+// ListRevocations returns the revocations that are still in force at the given time
+func (r *postgresTokenRevocationRepository) ListRevocations(ctx context.Context, at time.Time) ([]models.TokenRevocation, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT kind, id, reason, revoked_by, revoked_at, expires_at FROM token_revocations
+		WHERE expires_at > $1 ORDER BY kind, id`, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list token revocations: %w", err)
+	}
+	defer rows.Close()
+
+	var revocations []models.TokenRevocation
+	for rows.Next() {
+		var revocation models.TokenRevocation
+		var kind string
+		err := rows.Scan(&kind, &revocation.ID, &revocation.Reason, &revocation.RevokedBy,
+			&revocation.RevokedAt, &revocation.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan token revocation: %w", err)
+		}
+		revocation.Kind = models.RevocationKind(kind)
+		revocations = append(revocations, revocation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list token revocations: %w", err)
+	}
+	return revocations, nil
+}
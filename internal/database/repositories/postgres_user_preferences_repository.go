@@ -0,0 +1,125 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+type postgresUserPreferencesRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresUserPreferencesRepository(db *sql.DB) UserPreferencesRepository {
+	return &postgresUserPreferencesRepository{db: db}
+}
+
+const preferencesColumns = "user_id, locale, private_notifications, email_digest, email, digest_groups"
+
+// GetPreferences returns the stored preferences of a user, or empty preferences when none were saved yet
+func (r *postgresUserPreferencesRepository) GetPreferences(ctx context.Context, userID uuid.UUID) (*models.UserPreferences, error) {
+	row := r.db.QueryRowContext(ctx,
+		"SELECT "+preferencesColumns+" FROM user_preferences WHERE user_id = $1",
+		userID)
+
+	preferences, err := scanPreferences(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &models.UserPreferences{UserID: userID}, nil
+		}
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+	return preferences, nil
+}
+
+func (r *postgresUserPreferencesRepository) SavePreferences(ctx context.Context, preferences *models.UserPreferences) error {
+	digestGroups := make(map[uuid.UUID]time.Time, len(preferences.DigestGroups))
+	for groupID, lastDigestAt := range preferences.DigestGroups {
+		digestGroups[groupID] = lastDigestAt.UTC()
+	}
+	encodedGroups, err := json.Marshal(digestGroups)
+	if err != nil {
+		return fmt.Errorf("failed to marshal digest groups: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO user_preferences (`+preferencesColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE
+		SET locale = EXCLUDED.locale,
+			private_notifications = EXCLUDED.private_notifications,
+			email_digest = EXCLUDED.email_digest,
+			email = EXCLUDED.email,
+			digest_groups = EXCLUDED.digest_groups`,
+		preferences.UserID, preferences.Locale, preferences.PrivateNotifications, preferences.EmailDigest,
+		preferences.Email, string(encodedGroups))
+	if err != nil {
+		return fmt.Errorf("failed to save preferences (upsert): %w", err)
+	}
+	return nil
+}
+
+// ListDigestSubscribers returns the preferences of every user that opted in to the email digest
+func (r *postgresUserPreferencesRepository) ListDigestSubscribers(ctx context.Context) ([]models.UserPreferences, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+preferencesColumns+" FROM user_preferences WHERE email_digest")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list digest subscribers: %w", err)
+	}
+	return scanPreferenceRows(rows)
+}
+
+// ListPreferences returns the stored preferences of every user
+func (r *postgresUserPreferencesRepository) ListPreferences(ctx context.Context) ([]models.UserPreferences, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+preferencesColumns+" FROM user_preferences ORDER BY user_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list preferences: %w", err)
+	}
+	return scanPreferenceRows(rows)
+}
+
+func scanPreferenceRows(rows *sql.Rows) ([]models.UserPreferences, error) {
+	defer rows.Close()
+
+	var list []models.UserPreferences
+	for rows.Next() {
+		preferences, err := scanPreferences(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan preferences: %w", err)
+		}
+		list = append(list, *preferences)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list preferences: %w", err)
+	}
+
+	return list, nil
+}
+func scanPreferences(row rowScanner) (*models.UserPreferences, error) {
+	var (
+		preferences  models.UserPreferences
+		digestGroups []byte
+	)
+	err := row.Scan(&preferences.UserID, &preferences.Locale, &preferences.PrivateNotifications,
+		&preferences.EmailDigest, &preferences.Email, &digestGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(digestGroups, &preferences.DigestGroups); err != nil {
+		return nil, fmt.Errorf("failed to parse digest groups: %w", err)
+	}
+	if len(preferences.DigestGroups) == 0 {
+		preferences.DigestGroups = nil
+	}
+	for groupID, lastDigestAt := range preferences.DigestGroups {
+		preferences.DigestGroups[groupID] = lastDigestAt.UTC()
+	}
+	return &preferences, nil
+}
@@ -0,0 +1,155 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/google/uuid"
+	"math"
+	"strings"
+	"time"
+)
+
+type purgeAuditRepository struct {
+	table *aztables.Client
+}
+
+// PurgeAuditEntity is one purged batch. RowKeys hold an inverted timestamp, so a group lists newest first.
+type PurgeAuditEntity struct {
+	PartitionKey  string `json:"PartitionKey"` // GroupID
+	RowKey        string `json:"RowKey"`       // inverted PurgedAt + "_" + ID
+	ID            string `json:"ID"`
+	RunID         string `json:"RunID"`
+	PurgedAt      string `json:"PurgedAt"`
+	Cutoff        string `json:"Cutoff"`
+	KeepPinned    bool   `json:"KeepPinned"`
+	MessageIDs    string `json:"MessageIDs"` // comma separated
+	SchemaVersion int    `json:"SchemaVersion"`
+}
+
+func NewPurgeAuditRepository(client *TableService) (PurgeAuditRepository, error) {
+	table := client.NewClient(PurgeAuditsTable)
+
+	_, err := table.CreateTable(context.Background(), nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "TableAlreadyExists") {
+			return &purgeAuditRepository{table: table}, nil
+		}
+		return nil, fmt.Errorf("failed to create/verify table: %w", err)
+	}
+
+	return &purgeAuditRepository{table: table}, nil
+}
+
+func (r *purgeAuditRepository) RecordPurge(ctx context.Context, audit *models.PurgeAudit) error {
+	messageIDs := make([]string, 0, len(audit.MessageIDs))
+	for _, id := range audit.MessageIDs {
+		messageIDs = append(messageIDs, id.String())
+	}
+
+	entity := PurgeAuditEntity{
+		PartitionKey:  audit.GroupID.String(),
+		RowKey:        fmt.Sprintf("%019d_%s", math.MaxInt64-audit.PurgedAt.UnixNano(), audit.ID.String()),
+		ID:            audit.ID.String(),
+		RunID:         audit.RunID.String(),
+		PurgedAt:      audit.PurgedAt.UTC().Format(time.RFC3339Nano),
+		Cutoff:        audit.Cutoff.UTC().Format(time.RFC3339Nano),
+		KeepPinned:    audit.KeepPinned,
+		MessageIDs:    strings.Join(messageIDs, ","),
+		SchemaVersion: purgeAuditSchemaVersion,
+	}
+
+	marshaled, err := json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entity: %w", err)
+	}
+
+	if _, err := r.table.AddEntity(ctx, marshaled, nil); err != nil {
+		return fmt.Errorf("failed to record purge: %w", err)
+	}
+	return nil
+}
+
+// ListPurges returns the purge records of a group, newest first
+func (r *purgeAuditRepository) ListPurges(ctx context.Context, groupID uuid.UUID) ([]models.PurgeAudit, error) {
+	filter := fmt.Sprintf("PartitionKey eq '%s'", groupID.String())
+	return r.listPurges(ctx, &filter)
+}
+
+// ListAllPurges returns the purge records of every group
+func (r *purgeAuditRepository) ListAllPurges(ctx context.Context) ([]models.PurgeAudit, error) {
+	return r.listPurges(ctx, nil)
+}
+
+func (r *purgeAuditRepository) listPurges(ctx context.Context, filter *string) ([]models.PurgeAudit, error) {
+	pager := r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: filter,
+	})
+
+	var audits []models.PurgeAudit
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list purges: %w", err)
+		}
+
+		for _, raw := range page.Entities {
+			var entity PurgeAuditEntity
+			if err := json.Unmarshal(raw, &entity); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal purge audit: %w", err)
+			}
+			groupID, err := uuid.Parse(entity.PartitionKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse group ID: %w", err)
+			}
+			audit, err := entity.toAudit(groupID)
+			if err != nil {
+				return nil, err
+			}
+			audits = append(audits, *audit)
+		}
+	}
+
+	return audits, nil
+}
+
+func (e *PurgeAuditEntity) toAudit(groupID uuid.UUID) (*models.PurgeAudit, error) {
+	id, err := uuid.Parse(e.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse purge audit ID: %w", err)
+	}
+	runID, err := uuid.Parse(e.RunID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse purge run ID: %w", err)
+	}
+	purgedAt, err := time.Parse(time.RFC3339Nano, e.PurgedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse purge time: %w", err)
+	}
+	cutoff, err := time.Parse(time.RFC3339Nano, e.Cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse purge cutoff: %w", err)
+	}
+
+	audit := &models.PurgeAudit{
+		ID:         id,
+		RunID:      runID,
+		GroupID:    groupID,
+		PurgedAt:   purgedAt,
+		Cutoff:     cutoff,
+		KeepPinned: e.KeepPinned,
+		MessageIDs: []uuid.UUID{},
+	}
+	if e.MessageIDs != "" {
+		for _, raw := range strings.Split(e.MessageIDs, ",") {
+			messageID, err := uuid.Parse(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse purged message ID: %w", err)
+			}
+			audit.MessageIDs = append(audit.MessageIDs, messageID)
+		}
+	}
+	return audit, nil
+}
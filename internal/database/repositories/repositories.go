@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"database/sql"
+)
+
+// Repositories bundles the storage implementations of one backend
+type Repositories struct {
+	Messages        MessageRepository
+	FCMTokens       FCMTokenRepository
+	UserPreferences UserPreferencesRepository
+	GroupSettings   GroupSettingsRepository
+	PurgeAudits     PurgeAuditRepository
+	AccessAudits    AccessAuditRepository
+	KeyBundles      KeyBundleRepository
+	// Archive holds the archived messages; nil when the archive is not configured
+	Archive *MessageArchive
+	// Cipher encrypts message content; nil when content is stored in plaintext
+	Cipher *ContentCipher
+}
+
+// NewAzureRepositories creates the Azure Table Storage repositories, creating missing tables
+func NewAzureRepositories(client *TableService) (*Repositories, error) {
+	messages, err := NewMessageRepository(client)
+	if err != nil {
+		return nil, err
+	}
+
+	fcmTokens, err := NewFCMTokenRepository(client)
+	if err != nil {
+		return nil, err
+	}
+
+	userPreferences, err := NewUserPreferencesRepository(client)
+	if err != nil {
+		return nil, err
+	}
+
+	groupSettings, err := NewGroupSettingsRepository(client)
+	if err != nil {
+		return nil, err
+	}
+
+	purgeAudits, err := NewPurgeAuditRepository(client)
+	if err != nil {
+		return nil, err
+	}
+
+	accessAudits, err := NewAccessAuditRepository(client)
+	if err != nil {
+		return nil, err
+	}
+
+	keyBundles, err := NewKeyBundleRepository(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repositories{
+		Messages:        messages,
+		FCMTokens:       fcmTokens,
+		UserPreferences: userPreferences,
+		GroupSettings:   groupSettings,
+		PurgeAudits:     purgeAudits,
+		AccessAudits:    accessAudits,
+		KeyBundles:      keyBundles,
+	}, nil
+}
+
+// NewPostgresRepositories creates the PostgreSQL repositories on a migrated database
+func NewPostgresRepositories(db *sql.DB) *Repositories {
+	return &Repositories{
+		Messages:        NewPostgresMessageRepository(db),
+		FCMTokens:       NewPostgresFCMTokenRepository(db),
+		UserPreferences: NewPostgresUserPreferencesRepository(db),
+		GroupSettings:   NewPostgresGroupSettingsRepository(db),
+		PurgeAudits:     NewPostgresPurgeAuditRepository(db),
+		AccessAudits:    NewPostgresAccessAuditRepository(db),
+		KeyBundles:      NewPostgresKeyBundleRepository(db),
+	}
+}
+
+// NewMemoryRepositories creates empty in-memory repositories for local runs and tests
+func NewMemoryRepositories() *Repositories {
+	return &Repositories{
+		Messages:        NewMemoryMessageRepository(),
+		FCMTokens:       NewMemoryFCMTokenRepository(),
+		UserPreferences: NewMemoryUserPreferencesRepository(),
+		GroupSettings:   NewMemoryGroupSettingsRepository(),
+		PurgeAudits:     NewMemoryPurgeAuditRepository(),
+		AccessAudits:    NewMemoryAccessAuditRepository(),
+		KeyBundles:      NewMemoryKeyBundleRepository(),
+	}
+}
@@ -0,0 +1,337 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/tenant"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// tenantRouter resolves the repositories of the tenant a call is scoped to. A call without a tenant scope or
+// for an unknown tenant fails instead of falling back to shared storage, so one tenant never reaches the
+// data of another.
+type tenantRouter struct {
+	tenants map[string]*Repositories
+}
+
+func (r *tenantRouter) resolve(ctx context.Context) (*Repositories, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissingTenant
+	}
+	repos, ok := r.tenants[id]
+	if !ok {
+		return nil, fmt.Errorf("tenant %s: %w", id, tenant.ErrUnknownTenant)
+	}
+	return repos, nil
+}
+
+// NewTenantRepositories routes every repository call to the repositories of the tenant in its context. The
+// archive and cipher belong to one tenant each and are left nil; jobs that need them use the tenant's own
+// repositories.
+func NewTenantRepositories(tenants map[string]*Repositories) *Repositories {
+	router := &tenantRouter{tenants: tenants}
+	return &Repositories{
+		Messages:        &tenantMessageRepository{router},
+		FCMTokens:       &tenantFCMTokenRepository{router},
+		UserPreferences: &tenantUserPreferencesRepository{router},
+		GroupSettings:   &tenantGroupSettingsRepository{router},
+		PurgeAudits:     &tenantPurgeAuditRepository{router},
+		AccessAudits:    &tenantAccessAuditRepository{router},
+		KeyBundles:      &tenantKeyBundleRepository{router},
+	}
+}
+
+type tenantMessageRepository struct {
+	router *tenantRouter
+}
+
+func (r *tenantMessageRepository) GetMessages(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.Message, *models.PaginationResponse, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repos.Messages.GetMessages(ctx, groupID, query)
+}
+
+func (r *tenantMessageRepository) CreateMessage(ctx context.Context, groupID uuid.UUID, message *models.Message) error {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repos.Messages.CreateMessage(ctx, groupID, message)
+}
+
+func (r *tenantMessageRepository) ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID, ifMatch string) (*models.Message, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.Messages.ToggleMessagePin(ctx, groupID, messageID, ifMatch)
+}
+
+func (r *tenantMessageRepository) GetMessageByID(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.Messages.GetMessageByID(ctx, groupID, messageID)
+}
+
+func (r *tenantMessageRepository) GetLastReadTime(ctx context.Context, groupID uuid.UUID, userID uuid.UUID) (time.Time, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return repos.Messages.GetLastReadTime(ctx, groupID, userID)
+}
+
+func (r *tenantMessageRepository) CountUnreadMessages(ctx context.Context, groupID uuid.UUID, lastReadTime time.Time) (int, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return repos.Messages.CountUnreadMessages(ctx, groupID, lastReadTime)
+}
+
+func (r *tenantMessageRepository) GetMessagesSince(ctx context.Context, groupID uuid.UUID, since time.Time, limit int) ([]models.Message, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.Messages.GetMessagesSince(ctx, groupID, since, limit)
+}
+
+func (r *tenantMessageRepository) SearchMessages(ctx context.Context, groupID uuid.UUID, query models.SearchQuery) ([]models.Message, *models.PaginationResponse, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repos.Messages.SearchMessages(ctx, groupID, query)
+}
+
+func (r *tenantMessageRepository) ListExpiredMessages(ctx context.Context, groupID uuid.UUID, query models.RetentionQuery) ([]models.Message, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.Messages.ListExpiredMessages(ctx, groupID, query)
+}
+
+func (r *tenantMessageRepository) DeleteMessages(ctx context.Context, groupID uuid.UUID, messages []models.Message) error {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repos.Messages.DeleteMessages(ctx, groupID, messages)
+}
+
+func (r *tenantMessageRepository) ListGroupIDs(ctx context.Context) ([]uuid.UUID, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.Messages.ListGroupIDs(ctx)
+}
+
+type tenantFCMTokenRepository struct {
+	router *tenantRouter
+}
+
+func (r *tenantFCMTokenRepository) GetGroupMemberTokens(ctx context.Context, groupID uuid.UUID) ([]models.FCMToken, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.FCMTokens.GetGroupMemberTokens(ctx, groupID)
+}
+
+func (r *tenantFCMTokenRepository) SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string, locale string) error {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repos.FCMTokens.SaveToken(ctx, groupID, userID, token, locale)
+}
+
+func (r *tenantFCMTokenRepository) DeleteToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID) error {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repos.FCMTokens.DeleteToken(ctx, groupID, userID)
+}
+
+func (r *tenantFCMTokenRepository) ListTokens(ctx context.Context) ([]models.FCMToken, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.FCMTokens.ListTokens(ctx)
+}
+
+type tenantUserPreferencesRepository struct {
+	router *tenantRouter
+}
+
+func (r *tenantUserPreferencesRepository) GetPreferences(ctx context.Context, userID uuid.UUID) (*models.UserPreferences, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.UserPreferences.GetPreferences(ctx, userID)
+}
+
+func (r *tenantUserPreferencesRepository) SavePreferences(ctx context.Context, preferences *models.UserPreferences) error {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repos.UserPreferences.SavePreferences(ctx, preferences)
+}
+
+func (r *tenantUserPreferencesRepository) ListDigestSubscribers(ctx context.Context) ([]models.UserPreferences, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.UserPreferences.ListDigestSubscribers(ctx)
+}
+
+func (r *tenantUserPreferencesRepository) ListPreferences(ctx context.Context) ([]models.UserPreferences, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.UserPreferences.ListPreferences(ctx)
+}
+
+type tenantGroupSettingsRepository struct {
+	router *tenantRouter
+}
+
+func (r *tenantGroupSettingsRepository) GetSettings(ctx context.Context, groupID uuid.UUID) (*models.GroupSettings, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.GroupSettings.GetSettings(ctx, groupID)
+}
+
+func (r *tenantGroupSettingsRepository) SaveSettings(ctx context.Context, settings *models.GroupSettings) error {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repos.GroupSettings.SaveSettings(ctx, settings)
+}
+
+func (r *tenantGroupSettingsRepository) ListRetentionPolicies(ctx context.Context) ([]models.GroupSettings, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.GroupSettings.ListRetentionPolicies(ctx)
+}
+
+func (r *tenantGroupSettingsRepository) ListSettings(ctx context.Context) ([]models.GroupSettings, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.GroupSettings.ListSettings(ctx)
+}
+
+type tenantPurgeAuditRepository struct {
+	router *tenantRouter
+}
+
+func (r *tenantPurgeAuditRepository) RecordPurge(ctx context.Context, audit *models.PurgeAudit) error {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repos.PurgeAudits.RecordPurge(ctx, audit)
+}
+
+func (r *tenantPurgeAuditRepository) ListPurges(ctx context.Context, groupID uuid.UUID) ([]models.PurgeAudit, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.PurgeAudits.ListPurges(ctx, groupID)
+}
+
+func (r *tenantPurgeAuditRepository) ListAllPurges(ctx context.Context) ([]models.PurgeAudit, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.PurgeAudits.ListAllPurges(ctx)
+}
+
+type tenantAccessAuditRepository struct {
+	router *tenantRouter
+}
+
+func (r *tenantAccessAuditRepository) RecordAccess(ctx context.Context, audit *models.AccessAudit) error {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repos.AccessAudits.RecordAccess(ctx, audit)
+}
+
+func (r *tenantAccessAuditRepository) ListAccesses(ctx context.Context, groupID uuid.UUID) ([]models.AccessAudit, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.AccessAudits.ListAccesses(ctx, groupID)
+}
+
+func (r *tenantAccessAuditRepository) ListAllAccesses(ctx context.Context) ([]models.AccessAudit, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.AccessAudits.ListAllAccesses(ctx)
+}
+
+type tenantKeyBundleRepository struct {
+	router *tenantRouter
+}
+
+func (r *tenantKeyBundleRepository) SaveBundle(ctx context.Context, bundle *models.KeyBundle) error {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return repos.KeyBundles.SaveBundle(ctx, bundle)
+}
+
+func (r *tenantKeyBundleRepository) ListBundles(ctx context.Context, groupID uuid.UUID) ([]models.KeyBundle, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.KeyBundles.ListBundles(ctx, groupID)
+}
+
+func (r *tenantKeyBundleRepository) ListAllBundles(ctx context.Context) ([]models.KeyBundle, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.KeyBundles.ListAllBundles(ctx)
+}
+
+func (r *tenantKeyBundleRepository) ClaimPreKey(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, deviceID string) (*models.PreKey, error) {
+	repos, err := r.router.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repos.KeyBundles.ClaimPreKey(ctx, groupID, userID, deviceID)
+}
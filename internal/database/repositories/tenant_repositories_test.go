@@ -0,0 +1,160 @@
+package repositories
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tenantStorage opens the repositories of two tenants: in memory, and when AZURE_TEST_CONNECTION_STRING is
+// set, on one storage account kept apart by table prefixes
+func tenantStorage() map[string]func(t *testing.T) map[string]*Repositories {
+	backends := map[string]func(t *testing.T) map[string]*Repositories{
+		"memory": func(t *testing.T) map[string]*Repositories {
+			return map[string]*Repositories{"acme": NewMemoryRepositories(), "beta": NewMemoryRepositories()}
+		},
+	}
+
+	if connectionString := os.Getenv("AZURE_TEST_CONNECTION_STRING"); connectionString != "" {
+		backends["azure-prefixed"] = func(t *testing.T) map[string]*Repositories {
+			client, err := NewTableClient(connectionString)
+			require.NoError(t, err)
+			acme, err := NewAzureRepositories(client.WithPrefix("TestAcme"))
+			require.NoError(t, err)
+			beta, err := NewAzureRepositories(client.WithPrefix("TestBeta"))
+			require.NoError(t, err)
+			return map[string]*Repositories{"acme": acme, "beta": beta}
+		}
+	}
+	return backends
+}
+
+func TestTenantRepositoriesIsolation(t *testing.T) {
+	for name, open := range tenantStorage() {
+		t.Run(name, func(t *testing.T) {
+			repos := NewTenantRepositories(open(t))
+			acme := tenant.WithTenant(context.Background(), "acme")
+			beta := tenant.WithTenant(context.Background(), "beta")
+
+			groupID := uuid.New()
+			userID := uuid.New()
+			message := &models.Message{
+				ID:         uuid.New(),
+				GroupID:    groupID,
+				SenderID:   userID,
+				SenderName: "Anna",
+				Content:    "Alleen voor acme",
+				SentAt:     time.Now().UTC().Truncate(time.Second),
+			}
+			require.NoError(t, repos.Messages.CreateMessage(acme, groupID, message))
+			require.NoError(t, repos.FCMTokens.SaveToken(acme, groupID, userID, "acme-device", "nl"))
+			require.NoError(t, repos.UserPreferences.SavePreferences(acme, &models.UserPreferences{UserID: userID, Locale: "nl"}))
+			require.NoError(t, repos.GroupSettings.SaveSettings(acme, &models.GroupSettings{GroupID: groupID, PrivateNotifications: true}))
+			require.NoError(t, repos.KeyBundles.SaveBundle(acme, &models.KeyBundle{
+				GroupID: groupID, UserID: userID, DeviceID: "phone", IdentityKey: "aWRlbnRpdHk=",
+				OneTimePreKeys: []models.PreKey{{KeyID: 1, PublicKey: "b25l"}},
+			}))
+
+			t.Run("The owning tenant reads its data", func(t *testing.T) {
+				stored, err := repos.Messages.GetMessageByID(acme, groupID, message.ID)
+				require.NoError(t, err)
+				assert.Equal(t, message.Content, stored.Content)
+
+				tokens, err := repos.FCMTokens.GetGroupMemberTokens(acme, groupID)
+				require.NoError(t, err)
+				assert.Len(t, tokens, 1)
+
+				bundles, err := repos.KeyBundles.ListBundles(acme, groupID)
+				require.NoError(t, err)
+				assert.Len(t, bundles, 1)
+			})
+
+			t.Run("Another tenant cannot reach it with the same IDs", func(t *testing.T) {
+				_, err := repos.Messages.GetMessageByID(beta, groupID, message.ID)
+				assert.ErrorIs(t, err, ErrNotFound)
+
+				_, err = repos.Messages.ToggleMessagePin(beta, groupID, message.ID, "")
+				assert.Error(t, err)
+
+				messages, _, err := repos.Messages.GetMessages(beta, groupID, models.PaginationQuery{PageSize: 10, Direction: models.Next})
+				require.NoError(t, err)
+				assert.Empty(t, messages)
+
+				groupIDs, err := repos.Messages.ListGroupIDs(beta)
+				require.NoError(t, err)
+				assert.NotContains(t, groupIDs, groupID)
+
+				tokens, err := repos.FCMTokens.GetGroupMemberTokens(beta, groupID)
+				require.NoError(t, err)
+				assert.Empty(t, tokens)
+
+				preferences, err := repos.UserPreferences.GetPreferences(beta, userID)
+				require.NoError(t, err)
+				assert.Empty(t, preferences.Locale)
+
+				settings, err := repos.GroupSettings.GetSettings(beta, groupID)
+				require.NoError(t, err)
+				assert.False(t, settings.PrivateNotifications)
+
+				bundles, err := repos.KeyBundles.ListBundles(beta, groupID)
+				require.NoError(t, err)
+				assert.Empty(t, bundles)
+
+				_, err = repos.KeyBundles.ClaimPreKey(beta, groupID, userID, "phone")
+				assert.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("Writes of another tenant leave the data alone", func(t *testing.T) {
+				assert.ErrorIs(t, repos.FCMTokens.DeleteToken(beta, groupID, userID), ErrNotFound)
+				require.NoError(t, repos.Messages.DeleteMessages(beta, groupID, []models.Message{*message}))
+
+				tokens, err := repos.FCMTokens.GetGroupMemberTokens(acme, groupID)
+				require.NoError(t, err)
+				assert.Len(t, tokens, 1)
+
+				_, err = repos.Messages.GetMessageByID(acme, groupID, message.ID)
+				assert.NoError(t, err)
+			})
+
+			t.Run("Calls without a known tenant are refused", func(t *testing.T) {
+				_, err := repos.Messages.GetMessageByID(context.Background(), groupID, message.ID)
+				assert.ErrorIs(t, err, tenant.ErrMissingTenant)
+
+				_, err = repos.FCMTokens.GetGroupMemberTokens(context.Background(), groupID)
+				assert.ErrorIs(t, err, tenant.ErrMissingTenant)
+
+				unknown := tenant.WithTenant(context.Background(), "gamma")
+				_, err = repos.Messages.GetMessageByID(unknown, groupID, message.ID)
+				assert.ErrorIs(t, err, tenant.ErrUnknownTenant)
+
+				_, err = repos.UserPreferences.ListDigestSubscribers(unknown)
+				assert.ErrorIs(t, err, tenant.ErrUnknownTenant)
+
+				assert.ErrorIs(t, repos.Messages.CreateMessage(unknown, groupID, message), tenant.ErrUnknownTenant)
+			})
+		})
+	}
+}
+
+func TestPrefixedArchiveStore(t *testing.T) {
+	ctx := context.Background()
+	shared := NewFileArchiveStore(t.TempDir())
+	acme := NewPrefixedArchiveStore(shared, "acme")
+	beta := NewPrefixedArchiveStore(shared, "beta")
+
+	require.NoError(t, acme.WriteArchive(ctx, "group/2024-01.jsonl.gz", []byte("acme"), "application/gzip"))
+
+	data, err := acme.ReadArchive(ctx, "group/2024-01.jsonl.gz")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", string(data))
+
+	_, err = beta.ReadArchive(ctx, "group/2024-01.jsonl.gz")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/encryption"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+)
+
+// BackendUnderTest is a storage backend the conformance suite and the service tests run against
+type BackendUnderTest struct {
+	Name string
+	// Open connects to the backend; close releases the connection
+	Open func() (repos *Repositories, close func(), err error)
+	// OpenRevocations opens the token revocation denylist of the backend, which is shared by every tenant and
+	// so not part of Repositories
+	OpenRevocations func() (repo TokenRevocationRepository, close func(), err error)
+}
+
+// BackendsUnderTest always includes the in-memory backend. PostgreSQL is included when POSTGRES_TEST_DSN is
+// set and Azure, with and without content encryption, when AZURE_TEST_CONNECTION_STRING is set (e.g. Azurite).
+// On CI (CI=true) a missing POSTGRES_TEST_DSN is an error, so PostgreSQL cannot silently drop out of the runs.
+func BackendsUnderTest() ([]BackendUnderTest, error) {
+	backends := []BackendUnderTest{{
+		Name: "memory",
+		Open: func() (*Repositories, func(), error) {
+			return NewMemoryRepositories(), func() {}, nil
+		},
+		OpenRevocations: func() (TokenRevocationRepository, func(), error) {
+			return NewMemoryTokenRevocationRepository(), func() {}, nil
+		},
+	}}
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" && os.Getenv("CI") == "true" {
+		return nil, errors.New("POSTGRES_TEST_DSN must be set on CI, so the PostgreSQL backend is tested")
+	}
+	if dsn != "" {
+		backends = append(backends, BackendUnderTest{
+			Name: "postgres",
+			Open: func() (*Repositories, func(), error) {
+				db, err := NewPostgresDB(dsn)
+				if err != nil {
+					return nil, nil, err
+				}
+				return NewPostgresRepositories(db), func() { db.Close() }, nil
+			},
+			OpenRevocations: func() (TokenRevocationRepository, func(), error) {
+				db, err := NewPostgresDB(dsn)
+				if err != nil {
+					return nil, nil, err
+				}
+				return NewPostgresTokenRevocationRepository(db), func() { db.Close() }, nil
+			},
+		})
+	}
+
+	if connectionString := os.Getenv("AZURE_TEST_CONNECTION_STRING"); connectionString != "" {
+		openRevocations := func() (TokenRevocationRepository, func(), error) {
+			client, err := NewTableClient(connectionString)
+			if err != nil {
+				return nil, nil, err
+			}
+			repo, err := NewTokenRevocationRepository(client)
+			return repo, func() {}, err
+		}
+		backends = append(backends, BackendUnderTest{
+			Name: "azure",
+			Open: func() (*Repositories, func(), error) {
+				client, err := NewTableClient(connectionString)
+				if err != nil {
+					return nil, nil, err
+				}
+				repos, err := NewAzureRepositories(client)
+				return repos, func() {}, err
+			},
+			OpenRevocations: openRevocations,
+		}, BackendUnderTest{
+			Name: "azure-encrypted",
+			Open: func() (*Repositories, func(), error) {
+				client, err := NewTableClient(connectionString)
+				if err != nil {
+					return nil, nil, err
+				}
+				repos, err := NewAzureRepositories(client)
+				if err != nil {
+					return nil, nil, err
+				}
+				keys, err := NewGroupKeyRepository(client)
+				if err != nil {
+					return nil, nil, err
+				}
+				masterKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", encryption.KeySize)))
+				masterKeys, err := encryption.ParseMasterKeys("test:"+masterKey, "test")
+				if err != nil {
+					return nil, nil, err
+				}
+				repos.Cipher = NewContentCipher(masterKeys, keys)
+				repos.Messages, err = NewEncryptedMessageRepository(client, repos.Cipher)
+				return repos, func() {}, err
+			},
+			OpenRevocations: openRevocations,
+		})
+	}
+
+	return backends, nil
+}
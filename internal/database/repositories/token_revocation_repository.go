@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"strings"
+	"time"
+)
+
+// revocationTimeLayout stores expiry times with a fixed width, so they can be compared as strings in a filter
+const revocationTimeLayout = "2006-01-02T15:04:05Z"
+
+type tokenRevocationRepository struct {
+	table *aztables.Client
+}
+
+// TokenRevocationEntity is one revoked token or session
+type TokenRevocationEntity struct {
+	PartitionKey  string `json:"PartitionKey"` // Kind: "jti" or "sid"
+	RowKey        string `json:"RowKey"`       // Token or session ID
+	Reason        string `json:"Reason"`
+	RevokedBy     string `json:"RevokedBy"`
+	RevokedAt     string `json:"RevokedAt"`
+	ExpiresAt     string `json:"ExpiresAt"`
+	SchemaVersion int    `json:"SchemaVersion"`
+}
+
+func decodeTokenRevocation(raw []byte) (*models.TokenRevocation, error) {
+	fields, err := decodeEntityFields(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	revokedAt, _, err := fields.timeField("RevokedAt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse revocation time: %w", err)
+	}
+	expiresAt, _, err := fields.timeField("ExpiresAt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse revocation expiry: %w", err)
+	}
+
+	return &models.TokenRevocation{
+		Kind:      models.RevocationKind(fields.stringField("PartitionKey")),
+		ID:        fields.stringField("RowKey"),
+		Reason:    fields.stringField("Reason"),
+		RevokedBy: fields.stringField("RevokedBy"),
+		RevokedAt: revokedAt,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func NewTokenRevocationRepository(client *TableService) (TokenRevocationRepository, error) {
+	table := client.NewClient(RevocationsTable)
+
+	_, err := table.CreateTable(context.Background(), nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "TableAlreadyExists") {
+			return &tokenRevocationRepository{table: table}, nil
+		}
+		return nil, fmt.Errorf("failed to create/verify table: %w", err)
+	}
+
+	return &tokenRevocationRepository{table: table}, nil
+}
+
+func (r *tokenRevocationRepository) Revoke(ctx context.Context, revocation *models.TokenRevocation) error {
+	entity := TokenRevocationEntity{
+		PartitionKey:  string(revocation.Kind),
+		RowKey:        revocation.ID,
+		Reason:        revocation.Reason,
+		RevokedBy:     revocation.RevokedBy,
+		RevokedAt:     revocation.RevokedAt.UTC().Format(time.RFC3339Nano),
+		ExpiresAt:     revocation.ExpiresAt.UTC().Format(revocationTimeLayout),
+		SchemaVersion: revocationSchemaVersion,
+	}
+
+	marshaled, err := json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entity: %w", err)
+	}
+
+	_, err = r.table.UpsertEntity(ctx, marshaled, &aztables.UpsertEntityOptions{
+		UpdateMode: aztables.UpdateModeReplace,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save token revocation (upsert): %w", err)
+	}
+	return nil
+}
+
+// ListRevocations returns the revocations that are still in force at the given time
+func (r *tokenRevocationRepository) ListRevocations(ctx context.Context, at time.Time) ([]models.TokenRevocation, error) {
+	filter := fmt.Sprintf("ExpiresAt gt '%s'", at.UTC().Format(revocationTimeLayout))
+	pager := r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{Filter: &filter})
+
+	var revocations []models.TokenRevocation
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list token revocations: %w", err)
+		}
+		for _, raw := range page.Entities {
+			revocation, err := decodeTokenRevocation(raw)
+			if err != nil {
+				return nil, err
+			}
+			revocations = append(revocations, *revocation)
+		}
+	}
+	return revocations, nil
+}
@@ -0,0 +1,204 @@
+package repositories
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// preferencesRowKey is the fixed RowKey of the single preferences entity stored per user partition
+const preferencesRowKey = "preferences"
+
+type userPreferencesRepository struct {
+	table *aztables.Client
+}
+
+type UserPreferencesEntity struct {
+	PartitionKey         string `json:"PartitionKey"` // UserID
+	RowKey               string `json:"RowKey"`
+	Locale               string `json:"Locale"`
+	PrivateNotifications bool   `json:"PrivateNotifications"`
+	EmailDigest          bool   `json:"EmailDigest"`
+	Email                string `json:"Email"`
+	DigestGroups         string `json:"DigestGroups"` // JSON object of group ID to RFC 3339 time of the last digest
+	SchemaVersion        int    `json:"SchemaVersion"`
+}
+
+// decodeUserPreferencesEntity reads a stored preferences entity of any schema version
+func decodeUserPreferencesEntity(fields entityFields) UserPreferencesEntity {
+	entity := UserPreferencesEntity{
+		PartitionKey:         fields.stringField("PartitionKey"),
+		RowKey:               fields.stringField("RowKey"),
+		Locale:               fields.stringField("Locale"),
+		PrivateNotifications: fields.boolField("PrivateNotifications"),
+		EmailDigest:          fields.boolField("EmailDigest"),
+		Email:                fields.stringField("Email"),
+		DigestGroups:         fields.stringField("DigestGroups"),
+		SchemaVersion:        fields.schemaVersion(),
+	}
+
+	// Version 1 kept a single digest group in DigestGroupID and LastDigestAt
+	if legacyGroupID := fields.stringField("DigestGroupID"); entity.DigestGroups == "" && legacyGroupID != "" {
+		encoded, _ := json.Marshal(map[string]string{legacyGroupID: fields.stringField("LastDigestAt")})
+		entity.DigestGroups = string(encoded)
+	}
+	return entity
+}
+
+func NewUserPreferencesRepository(client *TableService) (UserPreferencesRepository, error) {
+	table := client.NewClient(UserPreferencesTable)
+
+	_, err := table.CreateTable(context.Background(), nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "TableAlreadyExists") {
+			return &userPreferencesRepository{table: table}, nil
+		}
+		return nil, fmt.Errorf("failed to create/verify table: %w", err)
+	}
+
+	return &userPreferencesRepository{table: table}, nil
+}
+
+// GetPreferences returns the stored preferences of a user, or empty preferences when none were saved yet
+func (r *userPreferencesRepository) GetPreferences(ctx context.Context, userID uuid.UUID) (*models.UserPreferences, error) {
+	response, err := r.table.GetEntity(ctx, userID.String(), preferencesRowKey, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return &models.UserPreferences{UserID: userID}, nil
+		}
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+
+	fields, err := decodeEntityFields(response.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal preferences: %w", err)
+	}
+
+	entity := decodeUserPreferencesEntity(fields)
+	return entity.toPreferences()
+}
+
+func (r *userPreferencesRepository) SavePreferences(ctx context.Context, preferences *models.UserPreferences) error {
+	entity := UserPreferencesEntity{
+		PartitionKey:         preferences.UserID.String(),
+		RowKey:               preferencesRowKey,
+		Locale:               preferences.Locale,
+		PrivateNotifications: preferences.PrivateNotifications,
+		EmailDigest:          preferences.EmailDigest,
+		Email:                preferences.Email,
+		SchemaVersion:        userPreferencesSchemaVersion,
+	}
+	if len(preferences.DigestGroups) > 0 {
+		digestGroups := make(map[string]string, len(preferences.DigestGroups))
+		for groupID, lastDigestAt := range preferences.DigestGroups {
+			digestGroups[groupID.String()] = ""
+			if !lastDigestAt.IsZero() {
+				digestGroups[groupID.String()] = lastDigestAt.UTC().Format(time.RFC3339)
+			}
+		}
+		encoded, err := json.Marshal(digestGroups)
+		if err != nil {
+			return fmt.Errorf("failed to marshal digest groups: %w", err)
+		}
+		entity.DigestGroups = string(encoded)
+	}
+
+	marshaled, err := json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entity: %w", err)
+	}
+
+	_, err = r.table.UpsertEntity(ctx, marshaled, &aztables.UpsertEntityOptions{
+		UpdateMode: aztables.UpdateModeReplace,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save preferences (upsert): %w", err)
+	}
+
+	return nil
+}
+
+// ListDigestSubscribers returns the preferences of every user that opted in to the email digest
+func (r *userPreferencesRepository) ListDigestSubscribers(ctx context.Context) ([]models.UserPreferences, error) {
+	return r.listPreferences(ctx, "EmailDigest eq true")
+}
+
+// ListPreferences returns the stored preferences of every user
+func (r *userPreferencesRepository) ListPreferences(ctx context.Context) ([]models.UserPreferences, error) {
+	return r.listPreferences(ctx, fmt.Sprintf("RowKey eq '%s'", preferencesRowKey))
+}
+
+func (r *userPreferencesRepository) listPreferences(ctx context.Context, filter string) ([]models.UserPreferences, error) {
+	pager := r.table.NewListEntitiesPager(&aztables.ListEntitiesOptions{
+		Filter: &filter,
+	})
+
+	var list []models.UserPreferences
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list preferences: %w", err)
+		}
+
+		for _, raw := range page.Entities {
+			fields, err := decodeEntityFields(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal preferences: %w", err)
+			}
+
+			entity := decodeUserPreferencesEntity(fields)
+			preferences, err := entity.toPreferences()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, *preferences)
+		}
+	}
+
+	return list, nil
+}
+
+func (e *UserPreferencesEntity) toPreferences() (*models.UserPreferences, error) {
+	userID, err := uuid.Parse(e.PartitionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse user ID: %w", err)
+	}
+
+	preferences := &models.UserPreferences{
+		UserID:               userID,
+		Locale:               e.Locale,
+		PrivateNotifications: e.PrivateNotifications,
+		EmailDigest:          e.EmailDigest,
+		Email:                e.Email,
+	}
+
+	if e.DigestGroups != "" {
+		var digestGroups map[string]string
+		if err := json.Unmarshal([]byte(e.DigestGroups), &digestGroups); err != nil {
+			return nil, fmt.Errorf("failed to parse digest groups: %w", err)
+		}
+		for rawGroupID, rawLastDigestAt := range digestGroups {
+			groupID, err := uuid.Parse(rawGroupID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse digest group ID: %w", err)
+			}
+			var lastDigestAt time.Time
+			if rawLastDigestAt != "" {
+				if lastDigestAt, err = time.Parse(time.RFC3339, rawLastDigestAt); err != nil {
+					return nil, fmt.Errorf("failed to parse last digest time: %w", err)
+				}
+			}
+			if preferences.DigestGroups == nil {
+				preferences.DigestGroups = make(map[uuid.UUID]time.Time, len(digestGroups))
+			}
+			preferences.DigestGroups[groupID] = lastDigestAt
+		}
+	}
+
+	return preferences, nil
+}
@@ -0,0 +1,188 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// KeySize is the size of master and data keys; both are AES-256 keys
+const KeySize = 32
+
+// ErrUnknownKey is returned when data was encrypted with a key that is not configured
+var ErrUnknownKey = errors.New("unknown key")
+
+// MasterKeys holds the master keys by ID. New data keys are wrapped with the current key; the other keys
+// are kept to unwrap data keys that were wrapped before a rotation.
+type MasterKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+// ParseMasterKeys reads keys given as comma separated "<id>:<base64 key>" pairs. currentID selects the key
+// new data keys are wrapped with and may be empty when only one key is given.
+func ParseMasterKeys(spec string, currentID string) (*MasterKeys, error) {
+	keys := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, key, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("master key %q must have the form <id>:<base64 key>", pair)
+		}
+		keys[strings.TrimSpace(id)] = strings.TrimSpace(key)
+	}
+	return newMasterKeys(keys, currentID)
+}
+
+// masterKeyFile is the layout of a local key file
+type masterKeyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// LoadMasterKeyFile reads master keys from a JSON file of the form
+// {"current": "<id>", "keys": {"<id>": "<base64 key>"}}.
+func LoadMasterKeyFile(path string) (*MasterKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+
+	var file masterKeyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse master key file: %w", err)
+	}
+	return newMasterKeys(file.Keys, file.Current)
+}
+
+func newMasterKeys(encoded map[string]string, currentID string) (*MasterKeys, error) {
+	if len(encoded) == 0 {
+		return nil, fmt.Errorf("no master keys configured")
+	}
+
+	keys := make(map[string][]byte, len(encoded))
+	for id, value := range encoded {
+		if id == "" {
+			return nil, fmt.Errorf("master key IDs must not be empty")
+		}
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s is not valid base64: %w", id, err)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("master key %s must be %d bytes, got %d", id, KeySize, len(key))
+		}
+		keys[id] = key
+	}
+
+	if currentID == "" {
+		if len(keys) > 1 {
+			return nil, fmt.Errorf("the current master key ID is required when several master keys are configured")
+		}
+		for id := range keys {
+			currentID = id
+		}
+	}
+	if _, ok := keys[currentID]; !ok {
+		return nil, fmt.Errorf("current master key %s: %w", currentID, ErrUnknownKey)
+	}
+
+	return &MasterKeys{current: currentID, keys: keys}, nil
+}
+
+// CurrentID returns the ID of the key new data keys are wrapped with
+func (k *MasterKeys) CurrentID() string {
+	return k.current
+}
+
+// IDs returns the IDs of the configured keys, sorted
+func (k *MasterKeys) IDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Wrap encrypts a data key with the current master key. aad binds the wrapped key to its owner, so it
+// cannot be unwrapped in the place of another one.
+func (k *MasterKeys) Wrap(dataKey []byte, aad []byte) (string, []byte, error) {
+	wrapped, err := Seal(k.keys[k.current], dataKey, aad)
+	if err != nil {
+		return "", nil, err
+	}
+	return k.current, wrapped, nil
+}
+
+// Unwrap decrypts a data key wrapped with the master key masterKeyID
+func (k *MasterKeys) Unwrap(masterKeyID string, wrapped []byte, aad []byte) ([]byte, error) {
+	key, ok := k.keys[masterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %s: %w", masterKeyID, ErrUnknownKey)
+	}
+	dataKey, err := Open(key, wrapped, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// NewDataKey returns a random data key
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, nil
+}
+
+// Seal encrypts plaintext with AES-GCM and returns the random nonce followed by the ciphertext
+func Seal(key []byte, plaintext []byte, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// Open decrypts the output of Seal. It fails when the data was modified or aad differs.
+func Open(key []byte, sealed []byte, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,112 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(fill byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune(fill)), KeySize)))
+}
+
+func TestParseMasterKeys(t *testing.T) {
+	t.Run("A single key is current", func(t *testing.T) {
+		keys, err := ParseMasterKeys("2024:"+testKey('a'), "")
+		require.NoError(t, err)
+		assert.Equal(t, "2024", keys.CurrentID())
+	})
+
+	t.Run("Several keys need a current ID", func(t *testing.T) {
+		spec := "2024:" + testKey('a') + ", 2025:" + testKey('b')
+		_, err := ParseMasterKeys(spec, "")
+		assert.Error(t, err)
+
+		keys, err := ParseMasterKeys(spec, "2025")
+		require.NoError(t, err)
+		assert.Equal(t, "2025", keys.CurrentID())
+		assert.Equal(t, []string{"2024", "2025"}, keys.IDs())
+	})
+
+	t.Run("Invalid keys are rejected", func(t *testing.T) {
+		for _, spec := range []string{"", "nocolon", "a:not-base64!", "a:" + base64.StdEncoding.EncodeToString([]byte("short"))} {
+			_, err := ParseMasterKeys(spec, "")
+			assert.Error(t, err, spec)
+		}
+		_, err := ParseMasterKeys("a:"+testKey('a'), "b")
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+}
+
+func TestLoadMasterKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `{"current": "k2", "keys": {"k1": "` + testKey('a') + `", "k2": "` + testKey('b') + `"}}`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	keys, err := LoadMasterKeyFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "k2", keys.CurrentID())
+
+	_, err = LoadMasterKeyFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	old, err := ParseMasterKeys("k1:"+testKey('a'), "")
+	require.NoError(t, err)
+	rotated, err := ParseMasterKeys("k1:"+testKey('a')+",k2:"+testKey('b'), "k2")
+	require.NoError(t, err)
+
+	dataKey, err := NewDataKey()
+	require.NoError(t, err)
+	masterKeyID, wrapped, err := old.Wrap(dataKey, []byte("group-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "k1", masterKeyID)
+
+	t.Run("Keys wrapped before a rotation can still be unwrapped", func(t *testing.T) {
+		unwrapped, err := rotated.Unwrap(masterKeyID, wrapped, []byte("group-1"))
+		require.NoError(t, err)
+		assert.Equal(t, dataKey, unwrapped)
+	})
+
+	t.Run("Wrapped keys are bound to their owner", func(t *testing.T) {
+		_, err := rotated.Unwrap(masterKeyID, wrapped, []byte("group-2"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Retired master keys cannot unwrap", func(t *testing.T) {
+		retired, err := ParseMasterKeys("k2:"+testKey('b'), "")
+		require.NoError(t, err)
+		_, err = retired.Unwrap(masterKeyID, wrapped, []byte("group-1"))
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+}
+
+func TestSealOpen(t *testing.T) {
+	key, err := NewDataKey()
+	require.NoError(t, err)
+
+	first, err := Seal(key, []byte("hallo"), []byte("aad"))
+	require.NoError(t, err)
+	second, err := Seal(key, []byte("hallo"), []byte("aad"))
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second, "every seal uses a fresh nonce")
+
+	plaintext, err := Open(key, first, []byte("aad"))
+	require.NoError(t, err)
+	assert.Equal(t, "hallo", string(plaintext))
+
+	tampered := append([]byte(nil), first...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = Open(key, tampered, []byte("aad"))
+	assert.Error(t, err)
+	_, err = Open(key, first, []byte("other"))
+	assert.Error(t, err)
+	_, err = Open(key, first[:4], []byte("aad"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"log"
+	"slices"
+)
+
+// AccessRecorder stores the audit trail of group accesses
+type AccessRecorder interface {
+	RecordAccess(ctx context.Context, audit *models.AccessAudit) error
+}
+
+// NewAccessAuditMiddleware records every group request of users with one of the given roles, together with the
+// status it was answered with. It runs before the group scope middleware, so refused requests are recorded too.
+func NewAccessAuditMiddleware(recorder AccessRecorder, roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := roleFromContext(c)
+		if !slices.Contains(roles, role) || !isGroupRoute(c) {
+			c.Next()
+			return
+		}
+
+		// The group scope middleware replaces the group in the context, so the target is taken first
+		groupID, err := routeGroupID(c)
+		c.Next()
+		if err != nil {
+			return
+		}
+
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil {
+			return
+		}
+		audit := &models.AccessAudit{
+			GroupID: groupID,
+			UserID:  userID,
+			Role:    role,
+			Method:  c.Request.Method,
+			Route:   c.FullPath(),
+			Status:  c.Writer.Status(),
+		}
+		if messageID, err := uuid.Parse(c.Param("messageId")); err == nil {
+			audit.MessageID = &messageID
+		}
+
+		if err := recorder.RecordAccess(c.Request.Context(), audit); err != nil {
+			log.Printf("Failed to audit access of user %s to group %s: %v", userID, groupID, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Groupchat-Service/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubRecorder struct {
+	audits []models.AccessAudit
+}
+
+func (r *stubRecorder) RecordAccess(_ context.Context, audit *models.AccessAudit) error {
+	r.audits = append(r.audits, *audit)
+	return nil
+}
+
+func TestAccessAuditMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, defaultGroup, assignedGroup, otherGroup := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	newRouter := func(role models.Role, recorder AccessRecorder) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("claims", jwt.MapClaims{"role": string(role)})
+			c.Set("userID", userID.String())
+			c.Set("groupID", defaultGroup.String())
+			c.Set("accessToken", "user-token")
+		})
+		router.Use(NewAccessAuditMiddleware(recorder, OversightRoles...))
+		router.Use(NewGroupScopeMiddleware("groups", &stubMembership{groups: map[uuid.UUID]bool{assignedGroup: true}}))
+		handler := func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		}
+		router.GET("/groups/:groupId/messages", handler)
+		router.PUT("/groups/:groupId/messages/:messageId/pin", handler)
+		router.GET("/admin/revocations", handler)
+		return router
+	}
+
+	t.Run("Records accesses of professionals", func(t *testing.T) {
+		recorder := &stubRecorder{}
+		messageID := uuid.New()
+		w := httptest.NewRecorder()
+		newRouter(models.RoleHealthcareProfessional, recorder).ServeHTTP(w, httptest.NewRequest(http.MethodPut,
+			"/groups/"+assignedGroup.String()+"/messages/"+messageID.String()+"/pin", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, recorder.audits, 1)
+		audit := recorder.audits[0]
+		assert.Equal(t, assignedGroup, audit.GroupID)
+		assert.Equal(t, userID, audit.UserID)
+		assert.Equal(t, models.RoleHealthcareProfessional, audit.Role)
+		assert.Equal(t, http.MethodPut, audit.Method)
+		assert.Equal(t, "/groups/:groupId/messages/:messageId/pin", audit.Route)
+		assert.Equal(t, &messageID, audit.MessageID)
+		assert.Equal(t, http.StatusOK, audit.Status)
+	})
+
+	t.Run("Records refused accesses", func(t *testing.T) {
+		recorder := &stubRecorder{}
+		w := httptest.NewRecorder()
+		newRouter(models.RoleHealthcareProfessional, recorder).ServeHTTP(w,
+			httptest.NewRequest(http.MethodGet, "/groups/"+otherGroup.String()+"/messages", nil))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		require.Len(t, recorder.audits, 1)
+		assert.Equal(t, otherGroup, recorder.audits[0].GroupID)
+		assert.Equal(t, http.StatusForbidden, recorder.audits[0].Status)
+		assert.Nil(t, recorder.audits[0].MessageID)
+	})
+
+	t.Run("Records accesses of admins", func(t *testing.T) {
+		recorder := &stubRecorder{}
+		w := httptest.NewRecorder()
+		newRouter(models.RoleAdmin, recorder).ServeHTTP(w,
+			httptest.NewRequest(http.MethodGet, "/groups/"+assignedGroup.String()+"/messages", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, recorder.audits, 1)
+		assert.Equal(t, assignedGroup, recorder.audits[0].GroupID)
+		assert.Equal(t, models.RoleAdmin, recorder.audits[0].Role)
+	})
+
+	t.Run("Skips other roles and routes", func(t *testing.T) {
+		recorder := &stubRecorder{}
+		newRouter(models.RolePatient, recorder).ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, "/groups/"+defaultGroup.String()+"/messages", nil))
+		newRouter(models.RoleHealthcareProfessional, recorder).ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, "/admin/revocations", nil))
+		newRouter(models.RoleAdmin, recorder).ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, "/admin/revocations", nil))
+
+		assert.Empty(t, recorder.audits)
+	})
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+const (
+	CodeCSRFOriginMissing  = "csrf_origin_missing"
+	CodeCSRFOriginRejected = "csrf_origin_rejected"
+)
+
+// isSafeMethod reports whether a request method does not change state, so it needs no CSRF protection
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// checkOrigin protects state-changing requests authenticated with the cookie against CSRF: the browser sends the
+// cookie along with requests from any site, but always says which site in Origin, or else in Referer. The
+// service's own origin and the allowed origins pass. Requests sending the token in the Authorization header need
+// no check, as other sites cannot make a browser add it.
+func checkOrigin(req *http.Request, allowedOrigins []string) *tokenError {
+	origin := req.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		origin = req.Header.Get("Referer")
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return newTokenError(CodeCSRFOriginMissing, "origin required for requests authenticated with the cookie")
+	}
+	// The scheme is not compared for the own origin, as TLS usually ends at a proxy in front of the service
+	if parsed.Host != req.Host && !slices.Contains(allowedOrigins, parsed.Scheme+"://"+parsed.Host) {
+		return newTokenError(CodeCSRFOriginRejected, "origin not allowed")
+	}
+	return nil
+}
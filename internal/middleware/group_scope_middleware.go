@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// OversightRoles are the roles that reach groups through their assignments instead of their membership
+var OversightRoles = []models.Role{models.RoleHealthcareProfessional, models.RoleAdmin}
+
+// GroupMembership reports whether a user belongs to a group
+type GroupMembership interface {
+	IsMember(ctx context.Context, userID uuid.UUID, groupID uuid.UUID, accessToken string) (bool, error)
+}
+
+// NewGroupScopeMiddleware scopes routes with a :groupId to that group instead of the group_id of the token. The
+// token's own group is always allowed. Other groups must be listed in the given claim, or, for tokens without
+// it, be a group of the user according to membership. Group routes without a :groupId are refused for tokens
+// without a group_id. Healthcare professionals and admins only reach the groups they are assigned to according
+// to membership, on every group route. It runs after the JWT middleware.
+func NewGroupScopeMiddleware(claim string, membership GroupMembership) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if slices.Contains(OversightRoles, roleFromContext(c)) {
+			scopeAssignedGroup(c, membership)
+			return
+		}
+
+		param := c.Param("groupId")
+		if param == "" {
+			if isGroupRoute(c) && c.GetString("groupID") == "" {
+				abortWithoutGroup(c)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		groupID, err := uuid.Parse(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+			c.Abort()
+			return
+		}
+
+		if defaultGroup, err := uuid.Parse(c.GetString("groupID")); err != nil || groupID != defaultGroup {
+			member, err := isGroupMember(c, claim, membership, groupID)
+			if err != nil {
+				log.Printf("Failed to check membership of group %s: %v", groupID, err)
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to check group membership"})
+				c.Abort()
+				return
+			}
+			if !member {
+				c.JSON(http.StatusForbidden, gin.H{"error": "not a member of this group"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("groupID", groupID.String())
+		c.Next()
+	}
+}
+
+// scopeAssignedGroup lets a professional or admin into the group of the route only when the user service lists it
+// among their assignments. The group_id and groups claims of the token are not trusted for this.
+func scopeAssignedGroup(c *gin.Context, membership GroupMembership) {
+	if !isGroupRoute(c) {
+		c.Next()
+		return
+	}
+
+	if c.Param("groupId") == "" && c.GetString("groupID") == "" {
+		abortWithoutGroup(c)
+		return
+	}
+	groupID, err := routeGroupID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		c.Abort()
+		return
+	}
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not assigned to this group"})
+		c.Abort()
+		return
+	}
+
+	assigned, err := membership.IsMember(c.Request.Context(), userID, groupID, c.GetString("accessToken"))
+	if err != nil {
+		log.Printf("Failed to check assignment of group %s: %v", groupID, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to check group assignment"})
+		c.Abort()
+		return
+	}
+	if !assigned {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not assigned to this group"})
+		c.Abort()
+		return
+	}
+
+	c.Set("groupID", groupID.String())
+	c.Next()
+}
+
+// abortWithoutGroup refuses a group route that names no group, for a token without a group_id
+func abortWithoutGroup(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "group ID not found in token", "code": CodeTokenClaimMissing})
+	c.Abort()
+}
+
+// isGroupRoute reports whether the matched route is one of the /groups routes
+func isGroupRoute(c *gin.Context) bool {
+	route := c.FullPath()
+	return route == "/groups" || strings.HasPrefix(route, "/groups/")
+}
+
+// routeGroupID returns the group a request targets: the :groupId of the route, or else the group of the token
+func routeGroupID(c *gin.Context) (uuid.UUID, error) {
+	if param := c.Param("groupId"); param != "" {
+		return uuid.Parse(param)
+	}
+	return uuid.Parse(c.GetString("groupID"))
+}
+
+func isGroupMember(c *gin.Context, claim string, membership GroupMembership, groupID uuid.UUID) (bool, error) {
+	claims, _ := c.Get("claims")
+	mapClaims, _ := claims.(jwt.MapClaims)
+	if groups, ok := mapClaims[claim].([]interface{}); ok {
+		for _, group := range groups {
+			if id, ok := group.(string); ok {
+				if parsed, err := uuid.Parse(id); err == nil && parsed == groupID {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		return false, nil
+	}
+	return membership.IsMember(c.Request.Context(), userID, groupID, c.GetString("accessToken"))
+}
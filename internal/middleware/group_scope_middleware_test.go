@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Groupchat-Service/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubMembership struct {
+	groups map[uuid.UUID]bool
+	err    error
+	calls  int
+}
+
+func (m *stubMembership) IsMember(_ context.Context, _ uuid.UUID, groupID uuid.UUID, accessToken string) (bool, error) {
+	m.calls++
+	if accessToken != "user-token" {
+		return false, errors.New("unexpected access token")
+	}
+	return m.groups[groupID], m.err
+}
+
+func TestGroupScopeMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defaultGroup, serviceGroup, claimedGroup, otherGroup := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	newRouter := func(claims jwt.MapClaims, membership GroupMembership) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("claims", claims)
+			c.Set("userID", uuid.NewString())
+			c.Set("groupID", defaultGroup.String())
+			c.Set("accessToken", "user-token")
+		})
+		router.Use(NewGroupScopeMiddleware("groups", membership))
+		handler := func(c *gin.Context) {
+			c.String(http.StatusOK, c.GetString("groupID"))
+		}
+		router.GET("/groups/messages", handler)
+		router.GET("/groups/:groupId/messages", handler)
+		router.GET("/admin/revocations", handler)
+		return router
+	}
+	professional := func(claims jwt.MapClaims) jwt.MapClaims {
+		claims["role"] = string(models.RoleHealthcareProfessional)
+		return claims
+	}
+	admin := func(claims jwt.MapClaims) jwt.MapClaims {
+		claims["role"] = string(models.RoleAdmin)
+		return claims
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		claims     jwt.MapClaims
+		wantStatus int
+		wantGroup  uuid.UUID
+		wantCalls  int
+	}{
+		{"Routes without a group use the token's group", "/groups/messages", jwt.MapClaims{}, http.StatusOK, defaultGroup, 0},
+		{"The token's group needs no lookup", "/groups/" + defaultGroup.String() + "/messages", jwt.MapClaims{}, http.StatusOK, defaultGroup, 0},
+		{"Asks the user service without a groups claim", "/groups/" + serviceGroup.String() + "/messages", jwt.MapClaims{}, http.StatusOK, serviceGroup, 1},
+		{"Refuses groups the user is not in", "/groups/" + otherGroup.String() + "/messages", jwt.MapClaims{}, http.StatusForbidden, uuid.Nil, 1},
+		{"Trusts the groups claim", "/groups/" + claimedGroup.String() + "/messages",
+			jwt.MapClaims{"groups": []interface{}{claimedGroup.String()}}, http.StatusOK, claimedGroup, 0},
+		{"Refuses groups missing from the claim", "/groups/" + serviceGroup.String() + "/messages",
+			jwt.MapClaims{"groups": []interface{}{claimedGroup.String()}}, http.StatusForbidden, uuid.Nil, 0},
+		{"Refuses invalid group IDs", "/groups/not-a-group/messages", jwt.MapClaims{}, http.StatusBadRequest, uuid.Nil, 0},
+		{"Lets professionals into assigned groups", "/groups/" + serviceGroup.String() + "/messages",
+			professional(jwt.MapClaims{}), http.StatusOK, serviceGroup, 1},
+		{"Checks the token's group of professionals", "/groups/messages",
+			professional(jwt.MapClaims{}), http.StatusForbidden, uuid.Nil, 1},
+		{"Ignores the groups claim of professionals", "/groups/" + claimedGroup.String() + "/messages",
+			professional(jwt.MapClaims{"groups": []interface{}{claimedGroup.String()}}), http.StatusForbidden, uuid.Nil, 1},
+		{"Leaves other routes of professionals alone", "/admin/revocations",
+			professional(jwt.MapClaims{}), http.StatusOK, defaultGroup, 0},
+		{"Lets admins into assigned groups", "/groups/" + serviceGroup.String() + "/messages",
+			admin(jwt.MapClaims{}), http.StatusOK, serviceGroup, 1},
+		{"Refuses admins groups they are not assigned to", "/groups/" + claimedGroup.String() + "/messages",
+			admin(jwt.MapClaims{"groups": []interface{}{claimedGroup.String()}}), http.StatusForbidden, uuid.Nil, 1},
+		{"Leaves other routes of admins alone", "/admin/revocations",
+			admin(jwt.MapClaims{}), http.StatusOK, defaultGroup, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			membership := &stubMembership{groups: map[uuid.UUID]bool{serviceGroup: true}}
+			w := httptest.NewRecorder()
+			newRouter(tt.claims, membership).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantGroup.String(), w.Body.String())
+			}
+			assert.Equal(t, tt.wantCalls, membership.calls)
+		})
+	}
+
+	t.Run("Fails closed when the user service is down", func(t *testing.T) {
+		membership := &stubMembership{err: errors.New("connection refused")}
+		w := httptest.NewRecorder()
+		newRouter(jwt.MapClaims{}, membership).ServeHTTP(w,
+			httptest.NewRequest(http.MethodGet, "/groups/"+serviceGroup.String()+"/messages", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
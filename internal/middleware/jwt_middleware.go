@@ -2,35 +2,89 @@ package middleware
 
 import (
 	"Groupchat-Service/internal/config"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 )
 
+// Token sources, named as in TOKEN_SOURCES. The handlers cannot see the config package behind their receiver.
+const (
+	tokenSourceHeader = config.TokenSourceHeader
+	tokenSourceCookie = config.TokenSourceCookie
+)
+
+// TokenDenylist reports whether an access token was revoked, by its token ID (jti) or its session ID (sid)
+type TokenDenylist interface {
+	IsRevoked(tokenID string, sessionID string) bool
+}
+
 type JWTMiddlewareConfig struct {
-	rsaPublicKey *rsa.PublicKey
+	keys *signingKeys
+	// tokenSources are where the token is looked for, in order; the first one that has a token is used
+	tokenSources []string
 	cookieName   string
+	// allowedOrigins may send state-changing requests authenticated with the cookie
+	allowedOrigins []string
+	// issuers are the accepted iss claims; any issuer is accepted when empty
+	issuers []string
+	// audience must be in the aud claim when set
+	audience string
+	// leeway is the clock skew tolerated on exp and nbf
+	leeway time.Duration
+	// requiredType must equal the typ claim when set; Keycloak sets it to "Bearer" on access tokens
+	requiredType string
+	denylist     TokenDenylist
 }
 
-func NewJWTMiddleware(cfg *config.Config) (gin.HandlerFunc, error) {
-	publicKey, err := parseRawPublicKey(cfg.PublicKey)
+// NewJWTMiddleware verifies access tokens with the keys from the JWKS at KEYCLOAK_JWKS_URL, which are refreshed
+// in the background, and with the static KEYCLOAK_PUBLIC_KEY as fallback. Either one may be left out. Tokens
+// on the denylist are refused. Tokens are read from the Authorization header and the cookie in the order of
+// TOKEN_SOURCES; state-changing requests authenticated with the cookie must come from an allowed origin.
+func NewJWTMiddleware(cfg *config.Config, denylist TokenDenylist) (gin.HandlerFunc, error) {
+	var staticKey crypto.PublicKey
+	if cfg.PublicKey != "" {
+		var err error
+		if staticKey, err = parseRawPublicKey(cfg.PublicKey); err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %v", err)
+		}
+	}
+
+	keys, err := newSigningKeys(context.Background(), JWKSConfig{
+		URL:              cfg.JWKSURL,
+		RefreshInterval:  cfg.JWKSRefreshInterval,
+		RefreshRateLimit: cfg.JWKSRefreshRateLimit,
+	}, staticKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %v", err)
+		return nil, err
 	}
 
 	middlewareConfig := &JWTMiddlewareConfig{
-		rsaPublicKey: publicKey,
-		cookieName:   cfg.AccessTokenCookieName,
+		keys:           keys,
+		tokenSources:   config.SplitList(cfg.TokenSources),
+		cookieName:     cfg.AccessTokenCookieName,
+		allowedOrigins: config.SplitList(cfg.CORSAllowedOrigins),
+		issuers:        config.SplitList(cfg.JWTIssuers),
+		audience:       cfg.JWTAudience,
+		leeway:         cfg.JWTClockSkew,
+		requiredType:   cfg.JWTRequiredType,
+		denylist:       denylist,
 	}
 	return middlewareConfig.handleRequest, nil
 }
 
-func parseRawPublicKey(rawKey string) (*rsa.PublicKey, error) {
+// parseRawPublicKey parses a base64 DER-encoded RSA or ECDSA public key
+func parseRawPublicKey(rawKey string) (crypto.PublicKey, error) {
 	// Decode the base64-encoded key
 	derKey, err := base64.StdEncoding.DecodeString(rawKey)
 	if err != nil {
@@ -43,91 +97,156 @@ func parseRawPublicKey(rawKey string) (*rsa.PublicKey, error) {
 		return nil, fmt.Errorf("failed to parse public key: %v", err)
 	}
 
-	// Ensure it's an RSA public key
-	rsaPub, ok := pub.(*rsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("not an RSA public key")
+	// Ensure it's a key tokens can be signed with
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("not an RSA or ECDSA public key")
 	}
+}
 
-	return rsaPub, nil
+// isPublicPath reports whether a path is reachable without an access token
+func isPublicPath(path string) bool {
+	return strings.HasPrefix(path, "/q/health") || path == "/metrics" || path == "/digest/unsubscribe"
 }
 
 func (config *JWTMiddlewareConfig) handleRequest(c *gin.Context) {
-	if strings.HasPrefix(c.Request.URL.Path, "/q/health") || c.Request.URL.Path == "/metrics" {
+	if isPublicPath(c.Request.URL.Path) {
 		c.Next()
 		return
 	}
 
-	tokenString, err := getTokenFromCookie(c, config.cookieName)
+	tokenString, source, err := config.getToken(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		c.Abort()
+		abortWithTokenError(c, err)
 		return
 	}
+	if source == tokenSourceCookie && !isSafeMethod(c.Request.Method) {
+		if err := checkOrigin(c.Request, config.allowedOrigins); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": err.code})
+			c.Abort()
+			return
+		}
+	}
 
 	token, err := config.parseToken(tokenString)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		c.Abort()
+		abortWithTokenError(c, err)
 		return
 	}
 
 	userID, groupID, firstName, lastName, claims, err := validateTokenClaims(token)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		c.Abort()
+		abortWithTokenError(c, err)
 		return
 	}
 
 	setContextValues(c, userID, groupID, firstName, lastName, claims)
+	// Kept so calls to the user service can be made on behalf of the user
+	c.Set("accessToken", tokenString)
 	c.Next()
 }
 
+func abortWithTokenError(c *gin.Context, err error) {
+	code := CodeTokenInvalid
+	var tokenErr *tokenError
+	if errors.As(err, &tokenErr) {
+		code = tokenErr.code
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": code})
+	c.Abort()
+}
+
+// parseToken verifies the signature, the time claims with the configured leeway, the issuer, audience and type,
+// and that the token is not revoked
 func (config *JWTMiddlewareConfig) parseToken(tokenString string) (*jwt.Token, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return config.rsaPublicKey, nil
-	})
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(validSigningMethods),
+		jwt.WithLeeway(config.leeway),
+		jwt.WithExpirationRequired(),
+	}
+	if config.audience != "" {
+		options = append(options, jwt.WithAudience(config.audience))
+	}
 
+	token, err := jwt.Parse(tokenString, config.keys.keyfunc, options...)
 	if err != nil || !token.Valid {
-		return nil, fmt.Errorf("invalid token")
+		return nil, parseTokenError(err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, newTokenError(CodeTokenInvalid, "invalid token claims")
+	}
+
+	if len(config.issuers) > 0 {
+		issuer, _ := claims.GetIssuer()
+		if !slices.Contains(config.issuers, issuer) {
+			return nil, newTokenError(CodeTokenInvalidIssuer, "token has an invalid issuer")
+		}
+	}
+	if config.requiredType != "" {
+		if tokenType, _ := claims["typ"].(string); tokenType != config.requiredType {
+			return nil, newTokenError(CodeTokenInvalidType, "token has an invalid type")
+		}
+	}
+	if config.denylist != nil {
+		tokenID, _ := claims["jti"].(string)
+		sessionID, _ := claims["sid"].(string)
+		if config.denylist.IsRevoked(tokenID, sessionID) {
+			return nil, newTokenError(CodeTokenRevoked, "token has been revoked")
+		}
 	}
 	return token, nil
 }
 
-func getTokenFromCookie(c *gin.Context, cookieName string) (string, error) {
-	tokenString, err := c.Cookie(cookieName)
-	if err != nil {
-		return "", fmt.Errorf("authorization cookie required")
+// getToken returns the token of the first source that has one, and that source. A token in the header must use
+// the Bearer scheme.
+func (config *JWTMiddlewareConfig) getToken(c *gin.Context) (string, string, error) {
+	for _, source := range config.tokenSources {
+		switch source {
+		case tokenSourceHeader:
+			header := c.GetHeader("Authorization")
+			if header == "" {
+				continue
+			}
+			scheme, token, found := strings.Cut(header, " ")
+			if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+				return "", "", newTokenError(CodeTokenMalformed, "authorization header must be \"Bearer <token>\"")
+			}
+			return strings.TrimSpace(token), source, nil
+		case tokenSourceCookie:
+			if token, err := c.Cookie(config.cookieName); err == nil && token != "" {
+				return token, source, nil
+			}
+		}
 	}
-	return tokenString, nil
+	return "", "", newTokenError(CodeTokenMissing, "access token required")
 }
+
 func validateTokenClaims(token *jwt.Token) (string, string, string, string, jwt.MapClaims, error) {
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		return "", "", "", "", nil, fmt.Errorf("invalid token claims")
+		return "", "", "", "", nil, newTokenError(CodeTokenInvalid, "invalid token claims")
 	}
 
 	userID, ok := claims["user_id"].(string)
 	if !ok {
-		return "", "", "", "", nil, fmt.Errorf("user ID not found in token")
+		return "", "", "", "", nil, newTokenError(CodeTokenClaimMissing, "user ID not found in token")
 	}
 
-	groupID, ok := claims["group_id"].(string)
-	if !ok {
-		return "", "", "", "", nil, fmt.Errorf("group ID not found in token")
-	}
+	// Tokens outside a group, such as those of admins, have no group_id; the group scope middleware refuses
+	// them on group routes that do not name a group
+	groupID, _ := claims["group_id"].(string)
 
 	firstName, ok := claims["first_name"].(string)
 	if !ok {
-		return "", "", "", "", nil, fmt.Errorf("first name not found in token")
+		return "", "", "", "", nil, newTokenError(CodeTokenClaimMissing, "first name not found in token")
 	}
 
 	lastName, ok := claims["last_name"].(string)
 	if !ok {
-		return "", "", "", "", nil, fmt.Errorf("last name not found in token")
+		return "", "", "", "", nil, newTokenError(CodeTokenClaimMissing, "last name not found in token")
 	}
 
 	return userID, groupID, firstName, lastName, claims, nil
@@ -138,5 +257,8 @@ func setContextValues(c *gin.Context, userID, groupID, firstName, lastName strin
 	c.Set("groupID", groupID)
 	c.Set("firstName", firstName)
 	c.Set("lastName", lastName)
+	if email, ok := claims["email"].(string); ok {
+		c.Set("email", email)
+	}
 	c.Set("claims", claims)
 }
@@ -0,0 +1,462 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/config"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jwksServer serves a JWKS whose keys can be replaced while it runs, as Keycloak does on key rotation
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []map[string]string
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	server := &jwksServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.fetches.Add(1)
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"keys": server.keys})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *jwksServer) publish(kid string, key any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	encode := base64.RawURLEncoding.EncodeToString
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		s.keys = append(s.keys, map[string]string{"kty": "RSA", "kid": kid, "alg": "RS256", "use": "sig",
+			"n": encode(key.N.Bytes()), "e": encode(big.NewInt(int64(key.E)).Bytes())})
+	case *ecdsa.PublicKey:
+		s.keys = append(s.keys, map[string]string{"kty": "EC", "kid": kid, "alg": "ES256", "use": "sig", "crv": "P-256",
+			"x": encode(key.X.FillBytes(make([]byte, 32))), "y": encode(key.Y.FillBytes(make([]byte, 32)))})
+	}
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"user_id":    "b5b4f1c2-8d4e-4c5e-9a63-3f1f0e8a9c11",
+		"group_id":   "0f0e8a9c-1b5b-4f1c-28d4-e4c5e9a633f1",
+		"first_name": "Anna",
+		"last_name":  "de Vries",
+		"exp":        time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+	return signClaims(t, method, kid, key, testClaims())
+}
+
+func signClaims(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func newJWTRouter(keys *signingKeys) *gin.Engine {
+	return newJWTRouterWithConfig(&JWTMiddlewareConfig{keys: keys})
+}
+
+func newJWTRouterWithConfig(config *JWTMiddlewareConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	config.cookieName = "access_token"
+	if config.tokenSources == nil {
+		config.tokenSources = []string{tokenSourceHeader, tokenSourceCookie}
+	}
+	router := gin.New()
+	router.Use(config.handleRequest)
+	router.GET("/groups/messages", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("userID"))
+	})
+	router.POST("/groups/messages", func(c *gin.Context) {
+		c.String(http.StatusCreated, c.GetString("userID"))
+	})
+	return router
+}
+
+func statusOf(router *gin.Engine, token string) int {
+	return requestWithToken(router, token).Code
+}
+
+func requestWithToken(router *gin.Engine, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/groups/messages", nil)
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: "access_token", Value: token})
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestJWKSKeySelection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	server := newJWKSServer(t)
+	server.publish("rsa-1", &rsaKey.PublicKey)
+	server.publish("ec-1", &ecKey.PublicKey)
+
+	keys, err := newSigningKeys(ctx, JWKSConfig{URL: server.URL, RefreshInterval: time.Hour, RefreshRateLimit: time.Hour}, nil)
+	require.NoError(t, err)
+	router := newJWTRouter(keys)
+
+	t.Run("Selects the key by key ID", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, statusOf(router, signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey)))
+		assert.Equal(t, http.StatusOK, statusOf(router, signToken(t, jwt.SigningMethodES256, "ec-1", ecKey)))
+	})
+
+	t.Run("Refuses a key ID of another key", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, statusOf(router, signToken(t, jwt.SigningMethodES256, "rsa-1", ecKey)))
+	})
+
+	t.Run("Refuses tokens without a key ID when there is no static key", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, statusOf(router, signToken(t, jwt.SigningMethodRS256, "", rsaKey)))
+	})
+
+	t.Run("Refuses HMAC tokens", func(t *testing.T) {
+		der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, statusOf(router, signToken(t, jwt.SigningMethodHS256, "rsa-1", der)))
+	})
+}
+
+func TestJWKSRotation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := newJWKSServer(t)
+	server.publish("old", &oldKey.PublicKey)
+	keys, err := newSigningKeys(ctx, JWKSConfig{URL: server.URL, RefreshInterval: time.Hour, RefreshRateLimit: time.Hour}, nil)
+	require.NoError(t, err)
+	router := newJWTRouter(keys)
+	require.Equal(t, int32(1), server.fetches.Load())
+
+	// Keycloak rotates to a new key: the first token signed with it fetches the JWKS again
+	server.publish("new", &newKey.PublicKey)
+	assert.Equal(t, http.StatusOK, statusOf(router, signToken(t, jwt.SigningMethodRS256, "new", newKey)))
+	assert.Equal(t, http.StatusOK, statusOf(router, signToken(t, jwt.SigningMethodRS256, "old", oldKey)))
+	assert.Equal(t, int32(2), server.fetches.Load())
+
+	// Unknown key IDs do not fetch again within the rate limit
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusUnauthorized, statusOf(router, signToken(t, jwt.SigningMethodRS256, "forged", oldKey)))
+	}
+	assert.Equal(t, int32(2), server.fetches.Load())
+}
+
+func TestStaticKeyFallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	jwksKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	staticKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&staticKey.PublicKey)
+	require.NoError(t, err)
+	parsed, err := parseRawPublicKey(base64.StdEncoding.EncodeToString(der))
+	require.NoError(t, err)
+
+	server := newJWKSServer(t)
+	server.publish("jwks", &jwksKey.PublicKey)
+	keys, err := newSigningKeys(ctx, JWKSConfig{URL: server.URL, RefreshInterval: time.Hour, RefreshRateLimit: time.Hour}, parsed)
+	require.NoError(t, err)
+	router := newJWTRouter(keys)
+
+	assert.Equal(t, http.StatusOK, statusOf(router, signToken(t, jwt.SigningMethodRS256, "jwks", jwksKey)))
+	assert.Equal(t, http.StatusOK, statusOf(router, signToken(t, jwt.SigningMethodES256, "", staticKey)),
+		"tokens without a key ID use the static key")
+	assert.Equal(t, http.StatusOK, statusOf(router, signToken(t, jwt.SigningMethodES256, "unknown", staticKey)),
+		"key IDs the JWKS does not know fall back to the static key")
+	assert.Equal(t, http.StatusUnauthorized, statusOf(router, signToken(t, jwt.SigningMethodRS256, "", jwksKey)),
+		"the static key only verifies its own algorithm family")
+
+	t.Run("Starts with the static key while the JWKS is unreachable", func(t *testing.T) {
+		keys, err := newSigningKeys(ctx, JWKSConfig{URL: "http://127.0.0.1:1/jwks", RefreshInterval: time.Hour, RefreshRateLimit: time.Hour}, parsed)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, statusOf(newJWTRouter(keys), signToken(t, jwt.SigningMethodES256, "", staticKey)))
+
+		_, err = newSigningKeys(ctx, JWKSConfig{URL: "http://127.0.0.1:1/jwks", RefreshInterval: time.Hour, RefreshRateLimit: time.Hour}, nil)
+		assert.Error(t, err, "without a fallback the JWKS is required")
+	})
+}
+
+type staticDenylist map[string]bool
+
+func (d staticDenylist) IsRevoked(tokenID string, sessionID string) bool {
+	return d["jti:"+tokenID] || d["sid:"+sessionID]
+}
+
+func TestTokenValidationErrorCodes(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	router := newJWTRouterWithConfig(&JWTMiddlewareConfig{
+		keys:         &signingKeys{staticKey: &key.PublicKey},
+		issuers:      []string{"https://auth.example.com/realms/zorg", "https://auth.example.com/realms/test"},
+		audience:     "groupchat",
+		leeway:       30 * time.Second,
+		requiredType: "Bearer",
+		denylist:     staticDenylist{"jti:revoked-token": true, "sid:revoked-session": true},
+	})
+
+	valid := func() jwt.MapClaims {
+		claims := testClaims()
+		claims["iss"] = "https://auth.example.com/realms/zorg"
+		claims["aud"] = []string{"account", "groupchat"}
+		claims["typ"] = "Bearer"
+		claims["jti"] = "token-1"
+		claims["sid"] = "session-1"
+		return claims
+	}
+	with := func(name string, value any) string {
+		claims := valid()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return signClaims(t, jwt.SigningMethodRS256, "", key, claims)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		code  string
+	}{
+		{"no token", "", CodeTokenMissing},
+		{"malformed", "not-a-token", CodeTokenMalformed},
+		{"signed by another key", signClaims(t, jwt.SigningMethodRS256, "", otherKey, valid()), CodeTokenInvalidSignature},
+		{"signed with HMAC", signClaims(t, jwt.SigningMethodHS256, "", []byte("secret"), valid()), CodeTokenInvalidSignature},
+		{"signed with an unknown key", signClaims(t, jwt.SigningMethodES256, "", ecKey, valid()), CodeTokenUnknownKey},
+		{"expired", with("exp", time.Now().Add(-time.Minute).Unix()), CodeTokenExpired},
+		{"without expiry", with("exp", nil), CodeTokenClaimMissing},
+		{"not valid yet", with("nbf", time.Now().Add(time.Minute).Unix()), CodeTokenNotYetValid},
+		{"other issuer", with("iss", "https://evil.example.com/realms/zorg"), CodeTokenInvalidIssuer},
+		{"other audience", with("aud", "account"), CodeTokenInvalidAudience},
+		{"ID token", with("typ", "ID"), CodeTokenInvalidType},
+		{"revoked token", with("jti", "revoked-token"), CodeTokenRevoked},
+		{"revoked session", with("sid", "revoked-session"), CodeTokenRevoked},
+		{"without user ID", with("user_id", nil), CodeTokenClaimMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := requestWithToken(router, tt.token)
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+			var body map[string]string
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tt.code, body["code"])
+			assert.NotEmpty(t, body["error"])
+		})
+	}
+
+	t.Run("Accepts valid tokens from every issuer", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, statusOf(router, signClaims(t, jwt.SigningMethodRS256, "", key, valid())))
+		assert.Equal(t, http.StatusOK, statusOf(router, with("iss", "https://auth.example.com/realms/test")))
+	})
+
+	t.Run("Tolerates clock skew within the leeway", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, statusOf(router, with("exp", time.Now().Add(-10*time.Second).Unix())))
+		assert.Equal(t, http.StatusOK, statusOf(router, with("nbf", time.Now().Add(10*time.Second).Unix())))
+	})
+}
+
+func TestTokenSources(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	valid := signToken(t, jwt.SigningMethodRS256, "", key)
+	keys := &signingKeys{staticKey: &key.PublicKey}
+
+	send := func(router *gin.Engine, header string, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/groups/messages", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "access_token", Value: cookie})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Accepts a bearer token", func(t *testing.T) {
+		router := newJWTRouterWithConfig(&JWTMiddlewareConfig{keys: keys})
+		assert.Equal(t, http.StatusOK, send(router, "Bearer "+valid, "").Code)
+		assert.Equal(t, http.StatusOK, send(router, "bearer "+valid, "").Code)
+		assert.Equal(t, http.StatusOK, send(router, "", valid).Code)
+	})
+
+	t.Run("Uses the first source that has a token", func(t *testing.T) {
+		headerFirst := newJWTRouterWithConfig(&JWTMiddlewareConfig{keys: keys,
+			tokenSources: []string{tokenSourceHeader, tokenSourceCookie}})
+		assert.Equal(t, http.StatusOK, send(headerFirst, "Bearer "+valid, "stale").Code)
+		assert.Equal(t, http.StatusUnauthorized, send(headerFirst, "Bearer stale", valid).Code)
+
+		cookieFirst := newJWTRouterWithConfig(&JWTMiddlewareConfig{keys: keys,
+			tokenSources: []string{tokenSourceCookie, tokenSourceHeader}})
+		assert.Equal(t, http.StatusOK, send(cookieFirst, "Bearer stale", valid).Code)
+		assert.Equal(t, http.StatusUnauthorized, send(cookieFirst, "Bearer "+valid, "stale").Code)
+	})
+
+	t.Run("Ignores sources that are not configured", func(t *testing.T) {
+		cookieOnly := newJWTRouterWithConfig(&JWTMiddlewareConfig{keys: keys, tokenSources: []string{tokenSourceCookie}})
+		assert.Equal(t, http.StatusUnauthorized, send(cookieOnly, "Bearer "+valid, "").Code)
+	})
+
+	t.Run("Refuses other authorization schemes", func(t *testing.T) {
+		router := newJWTRouterWithConfig(&JWTMiddlewareConfig{keys: keys})
+		w := send(router, "Basic dXNlcjpwYXNz", valid)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), CodeTokenMalformed)
+	})
+}
+
+func TestCSRFOriginCheck(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	valid := signToken(t, jwt.SigningMethodRS256, "", key)
+	router := newJWTRouterWithConfig(&JWTMiddlewareConfig{keys: &signingKeys{staticKey: &key.PublicKey},
+		allowedOrigins: []string{"https://app.example.com"}})
+
+	post := func(headers map[string]string, useCookie bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/groups/messages", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		if useCookie {
+			req.AddCookie(&http.Cookie{Name: "access_token", Value: valid})
+		} else {
+			req.Header.Set("Authorization", "Bearer "+valid)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		useCookie bool
+		status    int
+		code      string
+	}{
+		{"cookie from an allowed origin", map[string]string{"Origin": "https://app.example.com"}, true, http.StatusCreated, ""},
+		{"cookie with an allowed referer", map[string]string{"Referer": "https://app.example.com/chat?group=1"}, true, http.StatusCreated, ""},
+		{"cookie from another site", map[string]string{"Origin": "https://evil.example.com"}, true, http.StatusForbidden, CodeCSRFOriginRejected},
+		{"cookie from a lookalike site", map[string]string{"Origin": "https://app.example.com.evil.com"}, true, http.StatusForbidden, CodeCSRFOriginRejected},
+		{"cookie without an origin", nil, true, http.StatusForbidden, CodeCSRFOriginMissing},
+		{"cookie from the service itself", map[string]string{"Origin": "https://example.com"}, true, http.StatusCreated, ""},
+		{"bearer token without an origin", nil, false, http.StatusCreated, ""},
+		{"bearer token from another site", map[string]string{"Origin": "https://evil.example.com"}, false, http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(tt.headers, tt.useCookie)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.code != "" {
+				assert.Contains(t, w.Body.String(), tt.code)
+			}
+		})
+	}
+
+	t.Run("Reading with the cookie needs no origin", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, statusOf(router, valid))
+	})
+}
+
+func TestTokensWithoutGroup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	jwtMiddleware, err := NewJWTMiddleware(&config.Config{PublicKey: base64.StdEncoding.EncodeToString(der),
+		TokenSources: "header"}, nil)
+	require.NoError(t, err)
+
+	assignedGroup := uuid.New()
+	router := gin.New()
+	router.Use(jwtMiddleware)
+	router.Use(func(c *gin.Context) {
+		// The membership stub expects the access token of its other tests
+		c.Set("accessToken", "user-token")
+	})
+	router.Use(NewGroupScopeMiddleware("groups", &stubMembership{groups: map[uuid.UUID]bool{assignedGroup: true}}))
+	authorizer := &stubAuthorizer{allowed: map[policy.Action]bool{policy.ActionRevocationRead: true, policy.ActionMessageRead: true}}
+	handler := func(c *gin.Context) { c.String(http.StatusOK, c.GetString("groupID")) }
+	router.GET("/admin/revocations", RequireAction(authorizer, policy.ActionRevocationRead), handler)
+	router.GET("/groups/messages", RequireAction(authorizer, policy.ActionMessageRead), handler)
+	router.GET("/groups/:groupId/messages", RequireAction(authorizer, policy.ActionMessageRead), handler)
+
+	serve := func(role models.Role, path string) *httptest.ResponseRecorder {
+		claims := testClaims()
+		delete(claims, "group_id")
+		claims["role"] = string(role)
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+signClaims(t, jwt.SigningMethodRS256, "", key, claims))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve(models.RoleAdmin, "/admin/revocations").Code, "admin routes need no group")
+	assert.Equal(t, http.StatusOK, serve(models.RoleAdmin, "/groups/"+assignedGroup.String()+"/messages").Code,
+		"group routes that name the group need no group in the token")
+
+	for _, role := range []models.Role{models.RoleAdmin, models.RolePatient} {
+		w := serve(role, "/groups/messages")
+		assert.Equal(t, http.StatusUnauthorized, w.Code, role)
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, CodeTokenClaimMissing, body["code"])
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"Groupchat-Service/internal/policy"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+)
+
+// Authorizer decides whether a request may perform an action
+type Authorizer interface {
+	Authorize(ctx context.Context, action policy.Action, request policy.Request) (bool, error)
+}
+
+// RequireAction creates middleware that lets a request through when the policy allows it any of the actions. It
+// runs after the group scope middleware, so conditions are checked against the group of the route.
+func RequireAction(authorizer Authorizer, actions ...policy.Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request, err := PolicyRequest(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		for _, action := range actions {
+			allowed, err := authorizer.Authorize(c.Request.Context(), action, request)
+			if err != nil {
+				log.Printf("Failed to check %s for user %s: %v", action, request.UserID, err)
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to check permissions"})
+				c.Abort()
+				return
+			}
+			if allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		c.Abort()
+	}
+}
+
+// PolicyRequest describes the request to the policy: the user and role of the token, the group the request is
+// scoped to, and the message of the route if it has one. Only group routes need a group; elsewhere tokens
+// without a group_id leave it uuid.Nil.
+func PolicyRequest(c *gin.Context) (policy.Request, error) {
+	role := roleFromContext(c)
+	if role == "" {
+		return policy.Request{}, errors.New("no valid role found in token")
+	}
+	userID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		return policy.Request{}, errors.New("invalid user ID")
+	}
+
+	request := policy.Request{UserID: userID, Role: role}
+	if groupID, err := uuid.Parse(c.GetString("groupID")); err == nil {
+		request.GroupID = groupID
+	} else if isGroupRoute(c) {
+		return policy.Request{}, errors.New("invalid group ID")
+	}
+	if messageID, err := uuid.Parse(c.Param("messageId")); err == nil {
+		request.MessageID = messageID
+	}
+	return request, nil
+}
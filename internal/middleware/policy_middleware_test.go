@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubAuthorizer struct {
+	allowed  map[policy.Action]bool
+	err      error
+	requests []policy.Request
+}
+
+func (a *stubAuthorizer) Authorize(_ context.Context, action policy.Action, request policy.Request) (bool, error) {
+	a.requests = append(a.requests, request)
+	return a.allowed[action], a.err
+}
+
+func TestRequireAction(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, groupID, messageID := uuid.New(), uuid.New(), uuid.New()
+
+	newRouter := func(claims jwt.MapClaims, authorizer Authorizer) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("claims", claims)
+			c.Set("userID", userID.String())
+			c.Set("groupID", groupID.String())
+		})
+		router.DELETE("/groups/messages/:messageId",
+			RequireAction(authorizer, policy.ActionMessageDeleteAny, policy.ActionMessageDeleteOwn),
+			func(c *gin.Context) { c.Status(http.StatusNoContent) })
+		return router
+	}
+	patient := jwt.MapClaims{"role": string(models.RolePatient)}
+
+	tests := []struct {
+		name       string
+		claims     jwt.MapClaims
+		authorizer *stubAuthorizer
+		wantStatus int
+	}{
+		{"Allowed by the first action", patient,
+			&stubAuthorizer{allowed: map[policy.Action]bool{policy.ActionMessageDeleteAny: true}}, http.StatusNoContent},
+		{"Allowed by another action", patient,
+			&stubAuthorizer{allowed: map[policy.Action]bool{policy.ActionMessageDeleteOwn: true}}, http.StatusNoContent},
+		{"Denied by every action", patient, &stubAuthorizer{}, http.StatusForbidden},
+		{"Fails closed when conditions cannot be checked", patient,
+			&stubAuthorizer{err: errors.New("storage unavailable")}, http.StatusServiceUnavailable},
+		{"Refuses tokens without a role", jwt.MapClaims{}, &stubAuthorizer{}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			newRouter(tt.claims, tt.authorizer).ServeHTTP(w,
+				httptest.NewRequest(http.MethodDelete, "/groups/messages/"+messageID.String(), nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			for _, request := range tt.authorizer.requests {
+				assert.Equal(t, policy.Request{UserID: userID, Role: models.RolePatient, GroupID: groupID, MessageID: messageID}, request)
+			}
+		})
+	}
+
+	t.Run("Only group routes need a group", func(t *testing.T) {
+		authorizer := &stubAuthorizer{allowed: map[policy.Action]bool{policy.ActionRevocationRead: true, policy.ActionMessageRead: true}}
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("claims", jwt.MapClaims{"role": string(models.RoleAdmin)})
+			c.Set("userID", userID.String())
+			c.Set("groupID", "")
+		})
+		handler := func(c *gin.Context) { c.Status(http.StatusOK) }
+		router.GET("/admin/revocations", RequireAction(authorizer, policy.ActionRevocationRead), handler)
+		router.GET("/groups/messages", RequireAction(authorizer, policy.ActionMessageRead), handler)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/revocations", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []policy.Request{{UserID: userID, Role: models.RoleAdmin}}, authorizer.requests)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/groups/messages", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
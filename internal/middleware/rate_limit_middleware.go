@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"Groupchat-Service/internal/ratelimit"
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	rateLimitRejectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limit_rejected_requests_total",
+			Help: "Requests rejected by the rate limiter by route, the key of the limit that rejected them, and role",
+		},
+		[]string{"route", "key", "role"},
+	)
+
+	rateLimitErrorsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rate_limit_errors_total",
+			Help: "Requests let through because the rate limiter failed",
+		},
+	)
+)
+
+// RateLimiter counts requests against the limits of their route
+type RateLimiter interface {
+	Take(ctx context.Context, route string, request ratelimit.Request) (ratelimit.Decision, error)
+}
+
+// NewRateLimitMiddleware rejects requests of users or groups that exceeded the limits of the route with
+// 429 Too Many Requests. It runs after the group scope middleware, so group limits count the group of the
+// route. Responses of limited routes carry the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers,
+// and rejections Retry-After. When the limiter fails, requests are let through.
+func NewRateLimitMiddleware(limiter RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.GetString("userID"))
+		if err != nil || c.FullPath() == "" {
+			c.Next()
+			return
+		}
+
+		route := rateLimitRoute(c)
+		request := ratelimit.Request{TenantID: c.GetString("tenantID"), UserID: userID, Role: roleFromContext(c)}
+		if isGroupRoute(c) {
+			request.GroupID, _ = uuid.Parse(c.GetString("groupID"))
+		}
+
+		decision, err := limiter.Take(c.Request.Context(), route, request)
+		if err != nil {
+			log.Printf("Failed to apply rate limits of %s for user %s: %v", route, userID, err)
+			rateLimitErrorsTotal.Inc()
+			c.Next()
+			return
+		}
+		if !decision.Limited {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		header.Set("RateLimit-Reset", ceilSeconds(decision.Reset))
+		if !decision.Allowed {
+			role := string(request.Role)
+			if role == "" {
+				role = "none"
+			}
+			rateLimitRejectedTotal.WithLabelValues(route, string(decision.RejectedBy), role).Inc()
+			header.Set("Retry-After", ceilSeconds(decision.RetryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitRoute names the route of a request by method and path. Routes of a group by ID share the name of
+// the route for the token's group, e.g. "POST /groups/messages", so they share its limits.
+func rateLimitRoute(c *gin.Context) string {
+	path := c.FullPath()
+	if rest, ok := strings.CutPrefix(path, "/groups/:groupId"); ok {
+		path = "/groups" + rest
+	}
+	return c.Request.Method + " " + path
+}
+
+// ceilSeconds formats a duration as whole seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubRateLimiter struct {
+	routes   []string
+	requests []ratelimit.Request
+	err      error
+}
+
+func (l *stubRateLimiter) Take(_ context.Context, route string, request ratelimit.Request) (ratelimit.Decision, error) {
+	l.routes = append(l.routes, route)
+	l.requests = append(l.requests, request)
+	return ratelimit.Decision{}, l.err
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, defaultGroup, otherGroup := uuid.New(), uuid.New(), uuid.New()
+
+	newRouter := func(limiter RateLimiter) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			if c.Request.URL.Path == "/health" {
+				return
+			}
+			c.Set("claims", jwt.MapClaims{"role": string(models.RoleFamilyMember)})
+			c.Set("userID", userID.String())
+			c.Set("groupID", defaultGroup.String())
+			c.Set("tenantID", "clinic-a")
+			c.Set("accessToken", "user-token")
+		})
+		router.Use(NewGroupScopeMiddleware("groups", &stubMembership{groups: map[uuid.UUID]bool{otherGroup: true}}))
+		router.Use(NewRateLimitMiddleware(limiter))
+		handler := func(c *gin.Context) {
+			c.Status(http.StatusCreated)
+		}
+		router.POST("/groups/messages", handler)
+		router.POST("/groups/:groupId/messages", handler)
+		router.GET("/admin/revocations", handler)
+		router.GET("/health", handler)
+		return router
+	}
+
+	serve := func(router *gin.Engine, method string, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	t.Run("Names routes and keys", func(t *testing.T) {
+		limiter := &stubRateLimiter{}
+		router := newRouter(limiter)
+		serve(router, http.MethodPost, "/groups/"+otherGroup.String()+"/messages")
+		serve(router, http.MethodGet, "/admin/revocations")
+		serve(router, http.MethodGet, "/health")
+
+		assert.Equal(t, []string{"POST /groups/messages", "GET /admin/revocations"}, limiter.routes)
+		assert.Equal(t, ratelimit.Request{TenantID: "clinic-a", UserID: userID, Role: models.RoleFamilyMember, GroupID: otherGroup},
+			limiter.requests[0])
+		assert.Equal(t, uuid.Nil, limiter.requests[1].GroupID, "routes outside groups have no group")
+	})
+
+	t.Run("Lets requests through when the limiter fails", func(t *testing.T) {
+		errorsBefore := testutil.ToFloat64(rateLimitErrorsTotal)
+		w := serve(newRouter(&stubRateLimiter{err: errors.New("redis down")}), http.MethodPost, "/groups/messages")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, errorsBefore+1, testutil.ToFloat64(rateLimitErrorsTotal))
+	})
+
+	t.Run("Rejects requests over the limit", func(t *testing.T) {
+		routes, err := ratelimit.Parse([]byte(`{"routes": {"POST /groups/messages": [{"key": "user", "requests": 2, "per": "1m"}]}}`))
+		require.NoError(t, err)
+		router := newRouter(ratelimit.New(routes, ratelimit.NewMemoryStore(100)))
+		rejected := rateLimitRejectedTotal.WithLabelValues("POST /groups/messages", "user", string(models.RoleFamilyMember))
+		rejectedBefore := testutil.ToFloat64(rejected)
+
+		w := serve(router, http.MethodPost, "/groups/messages")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+
+		w = serve(router, http.MethodPost, "/groups/"+otherGroup.String()+"/messages")
+		assert.Equal(t, http.StatusCreated, w.Code, "group routes by ID share the limits")
+		assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+		w = serve(router, http.MethodPost, "/groups/messages")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "30", w.Header().Get("Retry-After"))
+		assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+		assert.JSONEq(t, `{"error": "rate limit exceeded"}`, w.Body.String())
+		assert.Equal(t, rejectedBefore+1, testutil.ToFloat64(rejected))
+
+		w = serve(router, http.MethodGet, "/admin/revocations")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"), "routes without limits get no headers")
+	})
+}
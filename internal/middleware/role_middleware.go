@@ -65,6 +65,18 @@ func RequireRoles(roles ...models.Role) gin.HandlerFunc {
 	}
 }
 
+// roleFromContext returns the role claim of the token, or an empty role when it has none
+func roleFromContext(c *gin.Context) models.Role {
+	claims, _ := c.Get("claims")
+	mapClaims, _ := claims.(jwt.MapClaims)
+	roleStr, _ := mapClaims["role"].(string)
+	role, err := models.ParseRole(roleStr)
+	if err != nil {
+		return ""
+	}
+	return role
+}
+
 func convertRolesToStrings(roles []models.Role) []string {
 	result := make([]string, len(roles))
 	for i, role := range roles {
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"log"
+	"time"
+)
+
+// validSigningMethods are the asymmetric algorithms tokens may be signed with. HMAC and "none" are refused,
+// so a public key can never be used as a shared secret.
+var validSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// JWKSConfig configures the JWKS the token signing keys are discovered from
+type JWKSConfig struct {
+	URL string
+	// RefreshInterval is how often the JWKS is fetched in the background
+	RefreshInterval time.Duration
+	// RefreshRateLimit is the shortest time between two fetches, also for tokens with an unknown key ID
+	RefreshRateLimit time.Duration
+}
+
+// signingKeys selects the key that verifies a token: by its key ID (kid) from the JWKS, or the static key for
+// tokens without a key ID or with one the JWKS does not know, even after a refresh
+type signingKeys struct {
+	jwks      *keyfunc.JWKS
+	staticKey crypto.PublicKey
+}
+
+// newSigningKeys fetches the JWKS when a URL is given. With a static key as fallback the service starts even
+// when the JWKS cannot be fetched yet; the background refresh keeps trying.
+func newSigningKeys(ctx context.Context, jwksConfig JWKSConfig, staticKey crypto.PublicKey) (*signingKeys, error) {
+	keys := &signingKeys{staticKey: staticKey}
+	if jwksConfig.URL == "" {
+		if staticKey == nil {
+			return nil, fmt.Errorf("no token signing keys configured")
+		}
+		return keys, nil
+	}
+
+	jwks, err := keyfunc.Get(jwksConfig.URL, keyfunc.Options{
+		Ctx:              ctx,
+		RefreshInterval:  jwksConfig.RefreshInterval,
+		RefreshRateLimit: jwksConfig.RefreshRateLimit,
+		RefreshTimeout:   10 * time.Second,
+		// A token signed with a new key fetches the JWKS again, at most once per RefreshRateLimit
+		RefreshUnknownKID: true,
+		RefreshErrorHandler: func(err error) {
+			log.Printf("Failed to refresh JWKS from %s: %v", jwksConfig.URL, err)
+		},
+		TolerateInitialJWKHTTPError: staticKey != nil,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	keys.jwks = jwks
+	return keys, nil
+}
+
+// keyfunc implements jwt.Keyfunc
+func (k *signingKeys) keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, hasKeyID := token.Header["kid"]; hasKeyID && k.jwks != nil {
+		key, err := k.jwks.Keyfunc(token)
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, keyfunc.ErrKIDNotFound) || k.staticKey == nil {
+			return nil, err
+		}
+	}
+	if k.staticKey == nil {
+		return nil, fmt.Errorf("token has no known key ID")
+	}
+
+	// The static key only verifies the algorithm family it belongs to
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if key, ok := k.staticKey.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	case *jwt.SigningMethodECDSA:
+		if key, ok := k.staticKey.(*ecdsa.PublicKey); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+}
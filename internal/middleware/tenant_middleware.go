@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"Groupchat-Service/internal/tenant"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+)
+
+// NewTenantMiddleware scopes every authenticated request to the tenant named by the given claim. It runs
+// after the JWT middleware, so the claims are verified; tokens without the claim or for a tenant that is not
+// configured are refused.
+func NewTenantMiddleware(claim string, tenants tenant.Tenants) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isPublicPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		claims, _ := c.Get("claims")
+		mapClaims, _ := claims.(jwt.MapClaims)
+		tenantID, ok := mapClaims[claim].(string)
+		if !ok || tenantID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "tenant not found in token"})
+			c.Abort()
+			return
+		}
+
+		if _, ok := tenants[tenantID]; !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "unknown tenant"})
+			c.Abort()
+			return
+		}
+
+		c.Set("tenantID", tenantID)
+		c.Request = c.Request.WithContext(tenant.WithTenant(c.Request.Context(), tenantID))
+		c.Next()
+	}
+}
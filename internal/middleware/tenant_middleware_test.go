@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Groupchat-Service/internal/tenant"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tenants := tenant.Tenants{"acme": {TablePrefix: "Acme"}}
+
+	newRouter := func(claims jwt.MapClaims) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("claims", claims)
+		})
+		router.Use(NewTenantMiddleware("tenant_id", tenants))
+		handler := func(c *gin.Context) {
+			id, _ := tenant.FromContext(c.Request.Context())
+			c.String(http.StatusOK, id)
+		}
+		router.GET("/groups/messages", handler)
+		router.GET("/q/health", handler)
+		return router
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		claims     jwt.MapClaims
+		wantStatus int
+		wantTenant string
+	}{
+		{"Scopes the request to the tenant", "/groups/messages", jwt.MapClaims{"tenant_id": "acme"}, http.StatusOK, "acme"},
+		{"Refuses tokens without a tenant", "/groups/messages", jwt.MapClaims{}, http.StatusUnauthorized, ""},
+		{"Refuses a tenant that is not a string", "/groups/messages", jwt.MapClaims{"tenant_id": 42}, http.StatusUnauthorized, ""},
+		{"Refuses unknown tenants", "/groups/messages", jwt.MapClaims{"tenant_id": "beta"}, http.StatusForbidden, ""},
+		{"Public paths need no tenant", "/q/health", nil, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			newRouter(tt.claims).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantTenant, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Codes returned with every refused access token, so clients can tell an expired token, which they refresh,
+// from one that will never be accepted
+const (
+	CodeTokenMissing          = "token_missing"
+	CodeTokenMalformed        = "token_malformed"
+	CodeTokenUnknownKey       = "token_unknown_key"
+	CodeTokenInvalidSignature = "token_invalid_signature"
+	CodeTokenExpired          = "token_expired"
+	CodeTokenNotYetValid      = "token_not_yet_valid"
+	CodeTokenInvalidIssuer    = "token_invalid_issuer"
+	CodeTokenInvalidAudience  = "token_invalid_audience"
+	CodeTokenInvalidType      = "token_invalid_type"
+	CodeTokenRevoked          = "token_revoked"
+	CodeTokenClaimMissing     = "token_claim_missing"
+	CodeTokenInvalid          = "token_invalid"
+)
+
+// tokenError is why an access token was refused
+type tokenError struct {
+	code    string
+	message string
+}
+
+func (e *tokenError) Error() string {
+	return e.message
+}
+
+func newTokenError(code string, message string) *tokenError {
+	return &tokenError{code: code, message: message}
+}
+
+// parseErrorCodes maps the errors of the token parser to codes. The parser joins validation errors, so the
+// first match wins: a forged token reports its signature, not its expiry.
+var parseErrorCodes = []struct {
+	err     error
+	code    string
+	message string
+}{
+	{jwt.ErrTokenMalformed, CodeTokenMalformed, "token is malformed"},
+	{jwt.ErrTokenUnverifiable, CodeTokenUnknownKey, "token is not signed with a known key"},
+	{jwt.ErrTokenSignatureInvalid, CodeTokenInvalidSignature, "token signature is invalid"},
+	{jwt.ErrTokenRequiredClaimMissing, CodeTokenClaimMissing, "token has no expiry"},
+	{jwt.ErrTokenExpired, CodeTokenExpired, "token is expired"},
+	{jwt.ErrTokenNotValidYet, CodeTokenNotYetValid, "token is not valid yet"},
+	{jwt.ErrTokenInvalidAudience, CodeTokenInvalidAudience, "token has an invalid audience"},
+}
+
+func parseTokenError(err error) *tokenError {
+	for _, mapping := range parseErrorCodes {
+		if errors.Is(err, mapping.err) {
+			return newTokenError(mapping.code, mapping.message)
+		}
+	}
+	return newTokenError(CodeTokenInvalid, "invalid token")
+}
@@ -5,26 +5,58 @@ import (
 	"time"
 )
 
+// SenderBadge marks messages posted in a special capacity; clients show it next to the sender name
+type SenderBadge string
+
+const (
+	BadgeNone SenderBadge = ""
+	// BadgeProfessional marks messages of a healthcare professional overseeing the group
+	BadgeProfessional SenderBadge = "professional"
+)
+
 type Message struct {
-	ID         uuid.UUID `json:"id"`
-	GroupID    uuid.UUID `json:"groupId"`
-	SenderID   uuid.UUID `json:"senderId"`
-	SenderName string    `json:"senderName"`
-	Content    string    `json:"content"`
-	SentAt     time.Time `json:"sentAt"`
-	IsPinned   bool      `json:"isPinned"`
+	ID          uuid.UUID   `json:"id"`
+	GroupID     uuid.UUID   `json:"groupId"`
+	SenderID    uuid.UUID   `json:"senderId"`
+	SenderName  string      `json:"senderName"`
+	SenderBadge SenderBadge `json:"senderBadge,omitempty"`
+	Content     string      `json:"content"`
+	SentAt      time.Time   `json:"sentAt"`
+	IsPinned    bool        `json:"isPinned"`
+	// Envelopes carry the message key for every recipient device of an end-to-end encrypted message, whose
+	// Content is then ciphertext the server cannot read
+	Envelopes []KeyEnvelope `json:"envelopes,omitempty"`
+	// ETag identifies the stored version of the message; conditional updates only apply to that version
+	ETag string `json:"etag,omitempty"`
+}
+
+// IsEndToEndEncrypted reports whether the content is ciphertext from an end-to-end encrypted group
+func (m *Message) IsEndToEndEncrypted() bool {
+	return len(m.Envelopes) > 0
+}
+
+// KeyEnvelope is the message key encrypted for one device of a recipient. The server stores it opaquely.
+type KeyEnvelope struct {
+	RecipientID uuid.UUID `json:"recipientId"`
+	DeviceID    string    `json:"deviceId"`
+	Ciphertext  string    `json:"ciphertext"`
 }
 
 type MessageCreate struct {
 	Content string `json:"content" validate:"required,min=1,max=1000"`
+	// Envelopes are required in end-to-end encrypted groups, where Content is the ciphertext
+	Envelopes []KeyEnvelope `json:"envelopes,omitempty"`
 }
 
 type MessageResponse struct {
-	ID         uuid.UUID `json:"id"`
-	GroupID    uuid.UUID `json:"groupId"`
-	SenderID   uuid.UUID `json:"senderId"`
-	SenderName string    `json:"senderName"`
-	Content    string    `json:"content"`
-	SentAt     time.Time `json:"sentAt"`
-	IsPinned   bool      `json:"isPinned"`
+	ID          uuid.UUID     `json:"id"`
+	GroupID     uuid.UUID     `json:"groupId"`
+	SenderID    uuid.UUID     `json:"senderId"`
+	SenderName  string        `json:"senderName"`
+	SenderBadge SenderBadge   `json:"senderBadge,omitempty"`
+	Content     string        `json:"content"`
+	SentAt      time.Time     `json:"sentAt"`
+	IsPinned    bool          `json:"isPinned"`
+	Envelopes   []KeyEnvelope `json:"envelopes,omitempty"`
+	ETag        string        `json:"etag,omitempty"`
 }
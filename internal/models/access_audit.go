@@ -0,0 +1,20 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// AccessAudit records one request of a user overseeing a group, such as a healthcare professional reading or
+// moderating it. Denied requests are recorded too, with the status they were answered with.
+type AccessAudit struct {
+	ID         uuid.UUID  `json:"id"`
+	GroupID    uuid.UUID  `json:"groupId"`
+	UserID     uuid.UUID  `json:"userId"`
+	Role       Role       `json:"role"`
+	Method     string     `json:"method"`
+	Route      string     `json:"route"`
+	MessageID  *uuid.UUID `json:"messageId,omitempty"`
+	Status     int        `json:"status"`
+	AccessedAt time.Time  `json:"accessedAt"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// ArchiveReport summarises how many messages of a group an archive run moved to the cold archive
+type ArchiveReport struct {
+	GroupID      uuid.UUID `json:"groupId"`
+	Cutoff       time.Time `json:"cutoff"`
+	MessageCount int       `json:"messageCount"`
+}
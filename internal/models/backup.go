@@ -0,0 +1,9 @@
+package models
+
+// RestoreReport summarises how many records of one backup table a restore wrote, and how many it skipped
+// because they were outside the restore or already stored
+type RestoreReport struct {
+	Table    string `json:"table"`
+	Restored int    `json:"restored"`
+	Skipped  int    `json:"skipped"`
+}
@@ -9,5 +9,6 @@ type FCMToken struct {
 	RowKey       string                 `json:"RowKey"`       // UserID
 	Token        string                 `json:"Token"`
 	IsActive     bool                   `json:"IsActive"`
+	Locale       string                 `json:"Locale"` // Accept-Language captured at registration
 	Timestamp    *timestamppb.Timestamp `json:"Timestamp"`
 }
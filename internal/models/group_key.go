@@ -0,0 +1,16 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// GroupKey is one version of the data key that encrypts the message content of a group. The data key is
+// only stored wrapped with the master key MasterKeyID.
+type GroupKey struct {
+	GroupID     uuid.UUID `json:"groupId"`
+	Version     int       `json:"version"`
+	MasterKeyID string    `json:"masterKeyId"`
+	WrappedKey  []byte    `json:"wrappedKey"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "github.com/google/uuid"
+
+type GroupSettings struct {
+	GroupID              uuid.UUID `json:"groupId"`
+	PrivateNotifications bool      `json:"privateNotifications"`
+	DigestExcludeContent bool      `json:"digestExcludeContent"`
+	// RetentionDays is how long messages are kept; 0 keeps them forever
+	RetentionDays int `json:"retentionDays"`
+	// RetentionKeepPinned exempts pinned messages from the retention period
+	RetentionKeepPinned bool `json:"retentionKeepPinned"`
+	// EndToEndEncrypted groups only accept messages encrypted by the clients. It cannot be switched off.
+	EndToEndEncrypted bool `json:"endToEndEncrypted"`
+	// AllowMessageDeletion lets members delete their own messages, as far as the access policy allows it
+	AllowMessageDeletion bool `json:"allowMessageDeletion"`
+}
+
+type GroupSettingsUpdate struct {
+	PrivateNotifications *bool `json:"privateNotifications"`
+	DigestExcludeContent *bool `json:"digestExcludeContent"`
+	RetentionDays        *int  `json:"retentionDays"`
+	RetentionKeepPinned  *bool `json:"retentionKeepPinned"`
+	EndToEndEncrypted    *bool `json:"endToEndEncrypted"`
+	AllowMessageDeletion *bool `json:"allowMessageDeletion"`
+}
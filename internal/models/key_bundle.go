@@ -0,0 +1,50 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// PreKey is a public key a device publishes so others can start an encrypted session with it
+type PreKey struct {
+	KeyID     int    `json:"keyId"`
+	PublicKey string `json:"publicKey"`
+}
+
+// SignedPreKey is a pre-key signed with the identity key of the device
+type SignedPreKey struct {
+	KeyID     int    `json:"keyId"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+// KeyBundle is the public key material one device of a group member has published. The server only
+// distributes it; the private keys never leave the device.
+type KeyBundle struct {
+	GroupID      uuid.UUID    `json:"groupId"`
+	UserID       uuid.UUID    `json:"userId"`
+	DeviceID     string       `json:"deviceId"`
+	IdentityKey  string       `json:"identityKey"`
+	SignedPreKey SignedPreKey `json:"signedPreKey"`
+	// OneTimePreKeys are handed out at most once each
+	OneTimePreKeys []PreKey  `json:"oneTimePreKeys"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// KeyBundleUpload publishes the key bundle of the calling device, replacing the bundle it published before
+type KeyBundleUpload struct {
+	DeviceID       string       `json:"deviceId" binding:"required"`
+	IdentityKey    string       `json:"identityKey" binding:"required"`
+	SignedPreKey   SignedPreKey `json:"signedPreKey"`
+	OneTimePreKeys []PreKey     `json:"oneTimePreKeys"`
+}
+
+// PreKeyBundle is what a sender needs to encrypt for one device: its public keys and, while the device has
+// any left, one claimed one-time pre-key
+type PreKeyBundle struct {
+	UserID        uuid.UUID    `json:"userId"`
+	DeviceID      string       `json:"deviceId"`
+	IdentityKey   string       `json:"identityKey"`
+	SignedPreKey  SignedPreKey `json:"signedPreKey"`
+	OneTimePreKey *PreKey      `json:"oneTimePreKey,omitempty"`
+}
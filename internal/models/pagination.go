@@ -1,5 +1,10 @@
 package models
 
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
 type Direction string
 
 const (
@@ -11,7 +16,16 @@ type PaginationQuery struct {
 	Cursor    *string   `json:"cursor,omitempty"`
 	PageSize  int       `json:"pageSize"`
 	Direction Direction `json:"direction"`
-	Search    *string   `json:"search,omitempty"`
+	// Search is answered from the search index by the message service; repositories ignore it
+	Search *string `json:"search,omitempty"`
+	// Position is the decoded cursor: the page starts right after this message in Direction
+	Position *MessageCursor `json:"-"`
+}
+
+// MessageCursor identifies a position in a group's timeline, ordered by SentAt and then MessageID
+type MessageCursor struct {
+	SentAt    time.Time
+	MessageID uuid.UUID
 }
 
 type PaginatedResponse struct {
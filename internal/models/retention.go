@@ -0,0 +1,35 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// RetentionQuery selects a batch of messages that fall outside a group's retention period
+type RetentionQuery struct {
+	Before     time.Time
+	KeepPinned bool
+	Limit      int
+	// Position continues with the messages older than this one
+	Position *MessageCursor
+}
+
+// PurgeAudit records which messages of a group a purge run deleted. Content is not kept.
+type PurgeAudit struct {
+	ID         uuid.UUID   `json:"id"`
+	RunID      uuid.UUID   `json:"runId"`
+	GroupID    uuid.UUID   `json:"groupId"`
+	PurgedAt   time.Time   `json:"purgedAt"`
+	Cutoff     time.Time   `json:"cutoff"`
+	KeepPinned bool        `json:"keepPinned"`
+	MessageIDs []uuid.UUID `json:"messageIds"`
+}
+
+// RetentionReport summarises what a purge run deleted, or would delete in a dry run, for one group
+type RetentionReport struct {
+	GroupID      uuid.UUID `json:"groupId"`
+	Cutoff       time.Time `json:"cutoff"`
+	KeepPinned   bool      `json:"keepPinned"`
+	DryRun       bool      `json:"dryRun"`
+	MessageCount int       `json:"messageCount"`
+}
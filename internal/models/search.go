@@ -0,0 +1,15 @@
+package models
+
+type SearchQuery struct {
+	Text     string  `json:"q"`
+	PageSize int     `json:"pageSize"`
+	Cursor   *string `json:"cursor,omitempty"`
+	// Position is the decoded cursor: results continue with messages older than this one
+	Position *MessageCursor `json:"-"`
+}
+
+// SearchResult is a matching message with an HTML snippet in which the matching words are marked
+type SearchResult struct {
+	MessageResponse
+	Snippet string `json:"snippet"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// RevocationKind selects which claim of an access token a revocation matches
+type RevocationKind string
+
+const (
+	// RevokeToken matches the token ID claim (jti) of a single access token
+	RevokeToken RevocationKind = "jti"
+	// RevokeSession matches the session ID claim (sid) shared by every token of a login session
+	RevokeSession RevocationKind = "sid"
+)
+
+// TokenRevocation denies the access tokens with a token or session ID until ExpiresAt, by which time those
+// tokens have expired anyway
+type TokenRevocation struct {
+	Kind      RevocationKind `json:"kind"`
+	ID        string         `json:"id"`
+	Reason    string         `json:"reason,omitempty"`
+	RevokedBy string         `json:"revokedBy"`
+	RevokedAt time.Time      `json:"revokedAt"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+}
+
+// TokenRevocationCreate revokes a token (jti) or a session (sid). ExpiresAt defaults to the configured
+// revocation lifetime.
+type TokenRevocationCreate struct {
+	TokenID   string     `json:"jti"`
+	SessionID string     `json:"sid"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type UserPreferences struct {
+	UserID               uuid.UUID `json:"userId"`
+	Locale               string    `json:"locale,omitempty"`
+	PrivateNotifications bool      `json:"privateNotifications"`
+	EmailDigest          bool      `json:"emailDigest"`
+	Email                string    `json:"email,omitempty"`
+	// DigestGroups are the groups the email digest summarises, with the time of the last digest of each
+	DigestGroups map[uuid.UUID]time.Time `json:"-"`
+}
+
+type UserPreferencesUpdate struct {
+	Locale               *string `json:"locale"`
+	PrivateNotifications *bool   `json:"privateNotifications"`
+	EmailDigest          *bool   `json:"emailDigest"`
+}
@@ -0,0 +1,298 @@
+package policy
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Action names something a user can do. The policy decides which roles may do it, and under which conditions.
+type Action string
+
+const (
+	ActionMessageRead        Action = "message.read"
+	ActionMessageCreate      Action = "message.create"
+	ActionMessagePin         Action = "message.pin"
+	ActionMessageDeleteOwn   Action = "message.delete.own"
+	ActionMessageDeleteAny   Action = "message.delete.any"
+	ActionSettingsRead       Action = "settings.read"
+	ActionSettingsUpdate     Action = "settings.update"
+	ActionKeysPublish        Action = "keys.publish"
+	ActionKeysRead           Action = "keys.read"
+	ActionTokenRegister      Action = "token.register"
+	ActionTokenDelete        Action = "token.delete"
+	ActionPreferencesRead    Action = "preferences.read"
+	ActionPreferencesUpdate  Action = "preferences.update"
+	ActionAuditRead          Action = "audit.read"
+	ActionRevocationRead     Action = "revocation.read"
+	ActionRevocationCreate   Action = "revocation.create"
+	ActionDebugNotifications Action = "debug.notifications"
+)
+
+// Actions lists every action in the order they are explained
+var Actions = []Action{
+	ActionMessageRead,
+	ActionMessageCreate,
+	ActionMessagePin,
+	ActionMessageDeleteOwn,
+	ActionMessageDeleteAny,
+	ActionSettingsRead,
+	ActionSettingsUpdate,
+	ActionKeysPublish,
+	ActionKeysRead,
+	ActionTokenRegister,
+	ActionTokenDelete,
+	ActionPreferencesRead,
+	ActionPreferencesUpdate,
+	ActionAuditRead,
+	ActionRevocationRead,
+	ActionRevocationCreate,
+	ActionDebugNotifications,
+}
+
+// Condition restricts a rule further than its roles
+type Condition string
+
+// ConditionOwnMessage holds when the message of the request was sent by the user
+const ConditionOwnMessage Condition = "own_message"
+
+// groupSettingPrefix starts the conditions that hold when a group setting is on, e.g.
+// "group_setting:allowMessageDeletion"
+const groupSettingPrefix = "group_setting:"
+
+// groupSettings are the settings a group_setting condition can name, by their JSON name
+var groupSettings = map[string]func(settings *models.GroupSettings) bool{
+	"allowMessageDeletion": func(settings *models.GroupSettings) bool { return settings.AllowMessageDeletion },
+}
+
+// Rule allows an action to the listed roles when all of its conditions hold
+type Rule struct {
+	Roles      []models.Role `json:"roles"`
+	Conditions []Condition   `json:"conditions,omitempty"`
+}
+
+// Request is the user asking to do an action, and the group and message it concerns
+type Request struct {
+	UserID  uuid.UUID
+	Role    models.Role
+	GroupID uuid.UUID
+	// MessageID is uuid.Nil when the request concerns no single message
+	MessageID uuid.UUID
+}
+
+// Resources looks up what conditions are evaluated against
+type Resources interface {
+	// MessageSender returns the sender of a message, or uuid.Nil when the message does not exist
+	MessageSender(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (uuid.UUID, error)
+	GroupSettings(ctx context.Context, groupID uuid.UUID) (*models.GroupSettings, error)
+}
+
+// Policy decides per action which roles may perform it. Actions without rules are denied to everyone.
+type Policy struct {
+	rules     map[Action][]Rule
+	resources Resources
+}
+
+//go:embed default_policy.json
+var defaultPolicy []byte
+
+// policyFile is the layout of a policy file
+type policyFile struct {
+	Actions map[Action][]Rule `json:"actions"`
+}
+
+// Load returns the default policy with the rules of the actions in the JSON file at path replacing the default
+// rules of those actions. The file has the form
+// {"actions": {"<action>": [{"roles": ["<role>", ...], "conditions": ["<condition>", ...]}, ...]}}.
+// An empty path loads the default policy.
+func Load(path string, resources Resources) (*Policy, error) {
+	rules, err := Parse(defaultPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default policy: %w", err)
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy file: %w", err)
+		}
+		overrides, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+		}
+		for action, actionRules := range overrides {
+			rules[action] = actionRules
+		}
+	}
+
+	return New(rules, resources), nil
+}
+
+// New creates a policy from rules that were already validated
+func New(rules map[Action][]Rule, resources Resources) *Policy {
+	return &Policy{rules: rules, resources: resources}
+}
+
+// Parse reads and validates the rules of a policy file. Unknown actions, roles and conditions are refused, so a
+// typo cannot silently deny or allow an action.
+func Parse(data []byte) (map[Action][]Rule, error) {
+	var file policyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+
+	for action, rules := range file.Actions {
+		if !slices.Contains(Actions, action) {
+			return nil, fmt.Errorf("unknown action %q", action)
+		}
+		for i := range rules {
+			if len(rules[i].Roles) == 0 {
+				return nil, fmt.Errorf("rule %d of %s lists no roles", i+1, action)
+			}
+			for j, role := range rules[i].Roles {
+				parsed, err := models.ParseRole(string(role))
+				if err != nil {
+					return nil, fmt.Errorf("rule %d of %s: %w", i+1, action, err)
+				}
+				rules[i].Roles[j] = parsed
+			}
+			for _, condition := range rules[i].Conditions {
+				if !validCondition(condition) {
+					return nil, fmt.Errorf("rule %d of %s: unknown condition %q", i+1, action, condition)
+				}
+			}
+		}
+	}
+	return file.Actions, nil
+}
+
+func validCondition(condition Condition) bool {
+	if condition == ConditionOwnMessage {
+		return true
+	}
+	setting, ok := strings.CutPrefix(string(condition), groupSettingPrefix)
+	_, known := groupSettings[setting]
+	return ok && known
+}
+
+// Authorize reports whether the request may perform the action: whether a rule of the action lists the role
+// of the request and all conditions of that rule hold
+func (p *Policy) Authorize(ctx context.Context, action Action, request Request) (bool, error) {
+	eval := &evaluation{resources: p.resources, request: request}
+	for _, rule := range p.rules[action] {
+		if !slices.Contains(rule.Roles, request.Role) {
+			continue
+		}
+		allowed := true
+		for _, condition := range rule.Conditions {
+			holds, _, err := eval.check(ctx, condition)
+			if err != nil {
+				return false, err
+			}
+			if !holds {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Explanation shows how the policy decided on an action, rule by rule
+type Explanation struct {
+	Action  Action            `json:"action"`
+	Role    models.Role       `json:"role"`
+	Allowed bool              `json:"allowed"`
+	Rules   []RuleExplanation `json:"rules"`
+}
+
+type RuleExplanation struct {
+	Roles      []models.Role     `json:"roles"`
+	RoleMatch  bool              `json:"roleMatch"`
+	Conditions []ConditionResult `json:"conditions,omitempty"`
+	Allowed    bool              `json:"allowed"`
+}
+
+type ConditionResult struct {
+	Condition Condition `json:"condition"`
+	Holds     bool      `json:"holds"`
+	Reason    string    `json:"reason"`
+}
+
+// Explain decides like Authorize, but evaluates every rule and condition and reports why each holds or not
+func (p *Policy) Explain(ctx context.Context, action Action, request Request) (*Explanation, error) {
+	eval := &evaluation{resources: p.resources, request: request}
+	explanation := &Explanation{Action: action, Role: request.Role, Rules: []RuleExplanation{}}
+	for _, rule := range p.rules[action] {
+		result := RuleExplanation{Roles: rule.Roles, RoleMatch: slices.Contains(rule.Roles, request.Role)}
+		result.Allowed = result.RoleMatch
+		for _, condition := range rule.Conditions {
+			holds, reason, err := eval.check(ctx, condition)
+			if err != nil {
+				return nil, err
+			}
+			result.Conditions = append(result.Conditions, ConditionResult{Condition: condition, Holds: holds, Reason: reason})
+			result.Allowed = result.Allowed && holds
+		}
+		explanation.Rules = append(explanation.Rules, result)
+		explanation.Allowed = explanation.Allowed || result.Allowed
+	}
+	return explanation, nil
+}
+
+// evaluation checks the conditions of one request, looking up each resource at most once
+type evaluation struct {
+	resources Resources
+	request   Request
+	sender    *uuid.UUID
+	settings  *models.GroupSettings
+}
+
+func (e *evaluation) check(ctx context.Context, condition Condition) (bool, string, error) {
+	if condition == ConditionOwnMessage {
+		if e.request.MessageID == uuid.Nil {
+			return false, "the request concerns no message", nil
+		}
+		if e.sender == nil {
+			sender, err := e.resources.MessageSender(ctx, e.request.GroupID, e.request.MessageID)
+			if err != nil {
+				return false, "", fmt.Errorf("error looking up message %s: %w", e.request.MessageID, err)
+			}
+			e.sender = &sender
+		}
+		switch *e.sender {
+		case uuid.Nil:
+			return false, "the message does not exist", nil
+		case e.request.UserID:
+			return true, "the user sent the message", nil
+		default:
+			return false, "another user sent the message", nil
+		}
+	}
+
+	name := strings.TrimPrefix(string(condition), groupSettingPrefix)
+	setting, ok := groupSettings[name]
+	if !ok {
+		return false, "unknown condition", nil
+	}
+	if e.settings == nil {
+		settings, err := e.resources.GroupSettings(ctx, e.request.GroupID)
+		if err != nil {
+			return false, "", fmt.Errorf("error looking up settings of group %s: %w", e.request.GroupID, err)
+		}
+		e.settings = settings
+	}
+	if setting(e.settings) {
+		return true, name + " is on", nil
+	}
+	return false, name + " is off", nil
+}
@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Groupchat-Service/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubResources struct {
+	senders  map[uuid.UUID]uuid.UUID
+	settings models.GroupSettings
+	lookups  int
+}
+
+func (r *stubResources) MessageSender(_ context.Context, _ uuid.UUID, messageID uuid.UUID) (uuid.UUID, error) {
+	r.lookups++
+	return r.senders[messageID], nil
+}
+
+func (r *stubResources) GroupSettings(_ context.Context, groupID uuid.UUID) (*models.GroupSettings, error) {
+	r.lookups++
+	settings := r.settings
+	settings.GroupID = groupID
+	return &settings, nil
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	rules, err := Parse(defaultPolicy)
+	require.NoError(t, err)
+	for _, action := range Actions {
+		assert.NotEmpty(t, rules[action], "the default policy decides on %s", action)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{"Valid", `{"actions": {"message.pin": [{"roles": ["Patient"], "conditions": ["own_message"]}]}}`, ""},
+		{"Unknown action", `{"actions": {"message.edit": [{"roles": ["patient"]}]}}`, `unknown action "message.edit"`},
+		{"Unknown role", `{"actions": {"message.pin": [{"roles": ["nurse"]}]}}`, "invalid role: nurse"},
+		{"Rule without roles", `{"actions": {"message.pin": [{"conditions": ["own_message"]}]}}`, "lists no roles"},
+		{"Unknown condition", `{"actions": {"message.pin": [{"roles": ["patient"], "conditions": ["weekdays"]}]}}`, `unknown condition "weekdays"`},
+		{"Unknown group setting", `{"actions": {"message.pin": [{"roles": ["patient"], "conditions": ["group_setting:allowPins"]}]}}`, `unknown condition "group_setting:allowPins"`},
+		{"Malformed", `{"actions": [`, "failed to parse policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Parse([]byte(tt.policy))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, models.RolePatient, rules[ActionMessagePin][0].Roles[0], "roles are normalised")
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	ctx := context.Background()
+	userID, otherID := uuid.New(), uuid.New()
+	ownMessage, otherMessage := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name      string
+		action    Action
+		role      models.Role
+		messageID uuid.UUID
+		deletion  bool
+		want      bool
+	}{
+		{"Role listed", ActionMessageCreate, models.RoleFamilyMember, uuid.Nil, false, true},
+		{"Role not listed", ActionSettingsUpdate, models.RoleFamilyMember, uuid.Nil, false, false},
+		{"No rules", Action("message.edit"), models.RolePatient, uuid.Nil, false, false},
+		{"Own message with the setting on", ActionMessageDeleteOwn, models.RolePatient, ownMessage, true, true},
+		{"Own message with the setting off", ActionMessageDeleteOwn, models.RolePatient, ownMessage, false, false},
+		{"Message of another user", ActionMessageDeleteOwn, models.RolePatient, otherMessage, true, false},
+		{"Unknown message", ActionMessageDeleteOwn, models.RolePatient, uuid.New(), true, false},
+		{"Unconditional rule", ActionMessageDeleteAny, models.RoleHealthcareProfessional, otherMessage, false, true},
+		{"Admins read", ActionMessageRead, models.RoleAdmin, uuid.Nil, false, true},
+		{"Admins read the access audit", ActionAuditRead, models.RoleAdmin, uuid.Nil, false, true},
+		{"Admins do not post", ActionMessageCreate, models.RoleAdmin, uuid.Nil, false, false},
+		{"Admins do not moderate", ActionMessageDeleteAny, models.RoleAdmin, otherMessage, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := &stubResources{
+				senders:  map[uuid.UUID]uuid.UUID{ownMessage: userID, otherMessage: otherID},
+				settings: models.GroupSettings{AllowMessageDeletion: tt.deletion},
+			}
+			policy, err := Load("", resources)
+			require.NoError(t, err)
+
+			request := Request{UserID: userID, Role: tt.role, GroupID: uuid.New(), MessageID: tt.messageID}
+			allowed, err := policy.Authorize(ctx, tt.action, request)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, allowed)
+
+			explanation, err := policy.Explain(ctx, tt.action, request)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, explanation.Allowed, "explaining decides the same")
+		})
+	}
+
+	t.Run("Conditions are only checked for matching roles", func(t *testing.T) {
+		resources := &stubResources{}
+		policy, err := Load("", resources)
+		require.NoError(t, err)
+
+		allowed, err := policy.Authorize(ctx, ActionMessageDeleteOwn, Request{UserID: userID, Role: models.RoleAdmin, MessageID: ownMessage})
+		require.NoError(t, err)
+		assert.False(t, allowed)
+		assert.Zero(t, resources.lookups)
+	})
+}
+
+func TestExplain(t *testing.T) {
+	userID, messageID := uuid.New(), uuid.New()
+	resources := &stubResources{senders: map[uuid.UUID]uuid.UUID{messageID: userID}}
+	policy, err := Load("", resources)
+	require.NoError(t, err)
+
+	explanation, err := policy.Explain(context.Background(), ActionMessageDeleteOwn,
+		Request{UserID: userID, Role: models.RoleFamilyMember, MessageID: messageID})
+	require.NoError(t, err)
+
+	assert.False(t, explanation.Allowed)
+	require.Len(t, explanation.Rules, 1)
+	rule := explanation.Rules[0]
+	assert.True(t, rule.RoleMatch)
+	assert.Equal(t, []ConditionResult{
+		{Condition: ConditionOwnMessage, Holds: true, Reason: "the user sent the message"},
+		{Condition: "group_setting:allowMessageDeletion", Holds: false, Reason: "allowMessageDeletion is off"},
+	}, rule.Conditions)
+	assert.Equal(t, 2, resources.lookups)
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"actions": {"settings.update": [{"roles": ["primary_caregiver"]}]}}`), 0o600))
+
+	policy, err := Load(path, &stubResources{})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	allowed, err := policy.Authorize(ctx, ActionSettingsUpdate, Request{Role: models.RolePatient})
+	require.NoError(t, err)
+	assert.False(t, allowed, "the file replaces the default rules of the action")
+
+	allowed, err = policy.Authorize(ctx, ActionSettingsRead, Request{Role: models.RolePatient})
+	require.NoError(t, err)
+	assert.True(t, allowed, "other actions keep their default rules")
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"), &stubResources{})
+	assert.ErrorContains(t, err, "failed to read policy file")
+}
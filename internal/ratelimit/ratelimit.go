@@ -0,0 +1,338 @@
+package ratelimit
+
+import (
+	"Groupchat-Service/internal/models"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key names what a limit counts requests by
+type Key string
+
+const (
+	// KeyUser gives every user a bucket of their own
+	KeyUser Key = "user"
+	// KeyGroup gives every group a bucket shared by its members
+	KeyGroup Key = "group"
+)
+
+// keys lists the keys in the order their limits are taken
+var keys = []Key{KeyUser, KeyGroup}
+
+// Limit is a token bucket: it lets Requests requests through per Per, in bursts of up to Burst requests. A limit
+// with roles only applies to requests of those roles, and takes precedence over the limit of the same key
+// without roles.
+type Limit struct {
+	Key      Key
+	Roles    []models.Role
+	Requests int
+	Per      time.Duration
+	Burst    int
+	// bucket tells the buckets of the limits of a route apart
+	bucket string
+}
+
+// rate is the number of tokens the bucket regains per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Request is a request to a route, as far as its limits are concerned
+type Request struct {
+	// TenantID keeps the buckets of tenants apart; it is empty without multi-tenancy
+	TenantID string
+	UserID   uuid.UUID
+	Role     models.Role
+	// GroupID is uuid.Nil for requests outside a group; group limits do not apply to them
+	GroupID uuid.UUID
+}
+
+// Result is the state of a bucket after a request was taken from it
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is the time until the bucket lets a request through again; it is 0 when Allowed
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+}
+
+// Store keeps the token buckets
+type Store interface {
+	// Take takes a token from the buckets of all keys when every one of them has a token, and from none
+	// otherwise, starting with a full bucket for the limit of a key when there is none. The results are those of
+	// the buckets in the order of the keys; Allowed tells whether the bucket had a token.
+	Take(ctx context.Context, keys []string, limits []Limit) ([]Result, error)
+}
+
+// Decision is the outcome of the limits of a route for a request
+type Decision struct {
+	// Limited is false when no limit applies to the request; the other fields are zero then
+	Limited bool
+	Allowed bool
+	// Limit, Remaining and Reset describe the bucket closest to rejecting, or the one that rejected
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+	// RejectedBy is the key of the limit that rejected the request
+	RejectedBy Key
+}
+
+// Limiter applies the limits of the routes. Routes are named by method and path, e.g. "POST /groups/messages";
+// routes without limits are not limited.
+type Limiter struct {
+	routes map[string][]Limit
+	store  Store
+}
+
+//go:embed default_limits.json
+var defaultLimits []byte
+
+// limitsFile is the layout of a rate limit file
+type limitsFile struct {
+	Routes map[string][]limitEntry `json:"routes"`
+}
+
+type limitEntry struct {
+	Key      Key           `json:"key"`
+	Roles    []models.Role `json:"roles,omitempty"`
+	Requests int           `json:"requests"`
+	Per      string        `json:"per"`
+	Burst    int           `json:"burst,omitempty"`
+}
+
+// Load returns a limiter with the default limits, where the limits of the routes in the JSON file at path
+// replace the default limits of those routes. The file has the form
+// {"routes": {"<method> <path>": [{"key": "user|group", "roles": ["<role>", ...], "requests": 30, "per": "1m",
+// "burst": 10}, ...]}}. Burst defaults to requests. An empty path loads the default limits.
+func Load(path string, store Store) (*Limiter, error) {
+	routes, err := Parse(defaultLimits)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default rate limits: %w", err)
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rate limit file: %w", err)
+		}
+		overrides, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit file %s: %w", path, err)
+		}
+		for route, limits := range overrides {
+			routes[route] = limits
+		}
+	}
+
+	return New(routes, store), nil
+}
+
+// New creates a limiter from limits that were already validated
+func New(routes map[string][]Limit, store Store) *Limiter {
+	return &Limiter{routes: routes, store: store}
+}
+
+// Parse reads and validates the limits of a rate limit file
+func Parse(data []byte) (map[string][]Limit, error) {
+	var file limitsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rate limits: %w", err)
+	}
+
+	routes := make(map[string][]Limit, len(file.Routes))
+	for route, entries := range file.Routes {
+		method, path, ok := strings.Cut(route, " ")
+		if !ok || method == "" || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("route %q is not of the form \"<METHOD> /<path>\"", route)
+		}
+
+		limits := make([]Limit, 0, len(entries))
+		for i, entry := range entries {
+			limit, err := entry.limit()
+			if err != nil {
+				return nil, fmt.Errorf("limit %d of %s: %w", i+1, route, err)
+			}
+			limit.bucket = string(limit.Key) + strconv.Itoa(i)
+			for _, other := range limits {
+				if other.Key == limit.Key && overlaps(other.Roles, limit.Roles) {
+					return nil, fmt.Errorf("limit %d of %s: another %s limit applies to the same roles", i+1, route, limit.Key)
+				}
+			}
+			limits = append(limits, limit)
+		}
+		routes[route] = limits
+	}
+	return routes, nil
+}
+
+func (e limitEntry) limit() (Limit, error) {
+	if !slices.Contains(keys, e.Key) {
+		return Limit{}, fmt.Errorf("unknown key %q", e.Key)
+	}
+	if e.Requests <= 0 {
+		return Limit{}, fmt.Errorf("requests must be positive")
+	}
+	per, err := time.ParseDuration(e.Per)
+	if err != nil || per <= 0 {
+		return Limit{}, fmt.Errorf("per must be a positive duration such as \"1m\"")
+	}
+	if e.Burst < 0 {
+		return Limit{}, fmt.Errorf("burst must not be negative")
+	}
+
+	limit := Limit{Key: e.Key, Requests: e.Requests, Per: per, Burst: e.Burst}
+	if limit.Burst == 0 {
+		limit.Burst = e.Requests
+	}
+	for _, role := range e.Roles {
+		parsed, err := models.ParseRole(string(role))
+		if err != nil {
+			return Limit{}, err
+		}
+		limit.Roles = append(limit.Roles, parsed)
+	}
+	return limit, nil
+}
+
+// overlaps reports whether two limits of a key would both apply to some role. Limits without roles only
+// overlap each other.
+func overlaps(a, b []models.Role) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == 0 && len(b) == 0
+	}
+	for _, role := range a {
+		if slices.Contains(b, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Take counts a request against every limit of the route that applies to it. The request is allowed when
+// all of their buckets still have a token; a rejected request takes no token from any of them, so a user over
+// their own limit does not use up the bucket of their group.
+func (l *Limiter) Take(ctx context.Context, route string, request Request) (Decision, error) {
+	var keys []string
+	var limits []Limit
+	for _, limit := range l.applicable(route, request.Role) {
+		id := request.UserID
+		if limit.Key == KeyGroup {
+			id = request.GroupID
+		}
+		if id == uuid.Nil {
+			continue
+		}
+
+		key := route + ":" + limit.bucket + ":" + id.String()
+		if request.TenantID != "" {
+			key = request.TenantID + ":" + key
+		}
+		keys = append(keys, key)
+		limits = append(limits, limit)
+	}
+	if len(keys) == 0 {
+		return Decision{}, nil
+	}
+
+	results, err := l.store.Take(ctx, keys, limits)
+	if err != nil {
+		return Decision{}, err
+	}
+	var decision Decision
+	for i, result := range results {
+		decision.add(limits[i], result)
+	}
+	return decision, nil
+}
+
+// applicable returns per key the limit of the route for the role, or else the limit for every role
+func (l *Limiter) applicable(route string, role models.Role) []Limit {
+	limits := l.routes[route]
+	applicable := make([]Limit, 0, len(keys))
+	for _, key := range keys {
+		var general *Limit
+		var specific *Limit
+		for i := range limits {
+			switch {
+			case limits[i].Key != key:
+			case len(limits[i].Roles) == 0:
+				general = &limits[i]
+			case slices.Contains(limits[i].Roles, role):
+				specific = &limits[i]
+			}
+		}
+		if specific != nil {
+			applicable = append(applicable, *specific)
+		} else if general != nil {
+			applicable = append(applicable, *general)
+		}
+	}
+	return applicable
+}
+
+// add merges the result of a bucket into the decision. A rejection outweighs any allowance, and of two
+// rejections the one that lasts longer counts.
+func (d *Decision) add(limit Limit, result Result) {
+	var replace bool
+	switch {
+	case !d.Limited:
+		replace = true
+	case d.Allowed != result.Allowed:
+		replace = !result.Allowed
+	case result.Allowed:
+		replace = result.Remaining < d.Remaining
+	default:
+		replace = result.RetryAfter > d.RetryAfter
+	}
+	if !replace {
+		return
+	}
+
+	*d = Decision{
+		Limited:    true,
+		Allowed:    result.Allowed,
+		Limit:      limit.Burst,
+		Remaining:  result.Remaining,
+		Reset:      result.Reset,
+		RetryAfter: result.RetryAfter,
+	}
+	if !result.Allowed {
+		d.RejectedBy = limit.Key
+	}
+}
+
+// refill returns the tokens of a bucket that held tokens elapsed ago
+func refill(tokens float64, elapsed time.Duration, limit Limit) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.rate())
+}
+
+// newResult describes a bucket that holds tokens after the request was taken from it, or rejected
+func newResult(allowed bool, tokens float64, limit Limit) Result {
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.rate()),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / limit.rate())
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
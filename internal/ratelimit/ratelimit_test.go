@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const messagesRoute = "POST /groups/messages"
+
+// newTestLimiter returns a limiter with the given limits over a memory store whose clock the test advances
+func newTestLimiter(t *testing.T, limits string) (*Limiter, *time.Time) {
+	routes, err := Parse([]byte(limits))
+	require.NoError(t, err)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore(100).(*memoryStore)
+	store.now = func() time.Time { return now }
+	return New(routes, store), &now
+}
+
+func TestDefaultLimits(t *testing.T) {
+	limiter, err := Load("", NewMemoryStore(100))
+	require.NoError(t, err)
+	assert.NotEmpty(t, limiter.routes[messagesRoute])
+	assert.NotEmpty(t, limiter.routes["POST /groups/users/tokens"])
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  string
+		wantErr string
+	}{
+		{"Valid", `{"routes": {"POST /groups/messages": [{"key": "user", "requests": 5, "per": "1s"}, {"key": "user", "roles": ["Patient"], "requests": 10, "per": "1s"}]}}`, ""},
+		{"Malformed route", `{"routes": {"/groups/messages": [{"key": "user", "requests": 5, "per": "1s"}]}}`, "is not of the form"},
+		{"Unknown key", `{"routes": {"POST /groups/messages": [{"key": "ip", "requests": 5, "per": "1s"}]}}`, `unknown key "ip"`},
+		{"No requests", `{"routes": {"POST /groups/messages": [{"key": "user", "per": "1s"}]}}`, "requests must be positive"},
+		{"Invalid period", `{"routes": {"POST /groups/messages": [{"key": "user", "requests": 5, "per": "daily"}]}}`, "per must be a positive duration"},
+		{"Unknown role", `{"routes": {"POST /groups/messages": [{"key": "user", "roles": ["nurse"], "requests": 5, "per": "1s"}]}}`, "invalid role: nurse"},
+		{"Overlapping limits", `{"routes": {"POST /groups/messages": [{"key": "group", "requests": 5, "per": "1s"}, {"key": "group", "requests": 9, "per": "1s"}]}}`, "another group limit applies to the same roles"},
+		{"Overlapping roles", `{"routes": {"POST /groups/messages": [{"key": "user", "roles": ["patient"], "requests": 5, "per": "1s"}, {"key": "user", "roles": ["admin", "patient"], "requests": 9, "per": "1s"}]}}`, "another user limit"},
+		{"Malformed", `{"routes": [`, "failed to parse rate limits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes, err := Parse([]byte(tt.limits))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			limits := routes[messagesRoute]
+			require.Len(t, limits, 2)
+			assert.Equal(t, 5, limits[0].Burst, "burst defaults to requests")
+			assert.Equal(t, []models.Role{models.RolePatient}, limits[1].Roles)
+		})
+	}
+}
+
+func TestLoadReplacesRoutes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"routes": {"POST /groups/messages": [{"key": "user", "requests": 1, "per": "1h"}]}}`), 0o600))
+
+	limiter, err := Load(path, NewMemoryStore(100))
+	require.NoError(t, err)
+	assert.Len(t, limiter.routes[messagesRoute], 1)
+	assert.NotEmpty(t, limiter.routes["POST /groups/users/tokens"], "routes missing from the file keep their defaults")
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"), NewMemoryStore(100))
+	assert.ErrorContains(t, err, "failed to read rate limit file")
+}
+
+func TestTakeBucket(t *testing.T) {
+	limiter, now := newTestLimiter(t, `{"routes": {"POST /groups/messages": [{"key": "user", "requests": 60, "per": "1m", "burst": 2}]}}`)
+	request := Request{UserID: uuid.New(), Role: models.RolePatient, GroupID: uuid.New()}
+	ctx := context.Background()
+
+	decision, err := limiter.Take(ctx, messagesRoute, request)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Limited: true, Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}, decision)
+
+	decision, err = limiter.Take(ctx, messagesRoute, request)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 0, decision.Remaining)
+
+	decision, err = limiter.Take(ctx, messagesRoute, request)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed, "the burst is used up")
+	assert.Equal(t, time.Second, decision.RetryAfter)
+	assert.Equal(t, KeyUser, decision.RejectedBy)
+
+	*now = now.Add(500 * time.Millisecond)
+	decision, err = limiter.Take(ctx, messagesRoute, request)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 500*time.Millisecond, decision.RetryAfter)
+
+	*now = now.Add(500 * time.Millisecond)
+	decision, err = limiter.Take(ctx, messagesRoute, request)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed, "a token was regained")
+
+	decision, err = limiter.Take(ctx, "GET /groups/messages", request)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{}, decision, "routes without limits are not limited")
+}
+
+func TestTakeKeys(t *testing.T) {
+	limiter, _ := newTestLimiter(t, `{"routes": {"POST /groups/messages": [
+		{"key": "user", "requests": 2, "per": "1h"},
+		{"key": "user", "roles": ["healthcare_professional"], "requests": 5, "per": "1h"},
+		{"key": "group", "requests": 3, "per": "1h"}
+	]}}`)
+	ctx := context.Background()
+	groupID := uuid.New()
+	patient := Request{UserID: uuid.New(), Role: models.RolePatient, GroupID: groupID}
+	caregiver := Request{UserID: uuid.New(), Role: models.RolePrimaryCaregiver, GroupID: groupID}
+	professional := Request{UserID: uuid.New(), Role: models.RoleHealthcareProfessional, GroupID: uuid.New()}
+
+	take := func(request Request) Decision {
+		decision, err := limiter.Take(ctx, messagesRoute, request)
+		require.NoError(t, err)
+		return decision
+	}
+
+	assert.True(t, take(patient).Allowed)
+	assert.True(t, take(patient).Allowed)
+	assert.Equal(t, KeyUser, take(patient).RejectedBy, "each user has a bucket of their own")
+
+	assert.True(t, take(caregiver).Allowed, "the rejected request took no token from the group")
+	decision := take(caregiver)
+	assert.False(t, decision.Allowed, "the members share the bucket of the group")
+	assert.Equal(t, KeyGroup, decision.RejectedBy)
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, take(professional).Allowed, "the limit of the role replaces the general one")
+	}
+
+	assert.True(t, take(Request{UserID: patient.UserID, Role: models.RolePatient, GroupID: groupID, TenantID: "clinic-b"}).Allowed,
+		"tenants have buckets of their own")
+	assert.True(t, take(Request{UserID: uuid.New(), Role: models.RoleAdmin}).Allowed, "group limits skip requests outside a group")
+}
+
+func TestRejectedRequestsTakeNoTokens(t *testing.T) {
+	limiter, _ := newTestLimiter(t, `{"routes": {"POST /groups/messages": [
+		{"key": "user", "requests": 2, "per": "1h"},
+		{"key": "group", "requests": 5, "per": "1h"}
+	]}}`)
+	ctx := context.Background()
+	groupID := uuid.New()
+	flooder := Request{UserID: uuid.New(), Role: models.RolePatient, GroupID: groupID}
+
+	for i := 0; i < 50; i++ {
+		_, err := limiter.Take(ctx, messagesRoute, flooder)
+		require.NoError(t, err)
+	}
+
+	// The group bucket only lost the two requests of the flooder that were allowed
+	for i := 0; i < 3; i++ {
+		decision, err := limiter.Take(ctx, messagesRoute, Request{UserID: uuid.New(), Role: models.RoleFamilyMember, GroupID: groupID})
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed, "a user past their own limit does not use up the group's tokens")
+	}
+	decision, err := limiter.Take(ctx, messagesRoute, Request{UserID: uuid.New(), Role: models.RoleFamilyMember, GroupID: groupID})
+	require.NoError(t, err)
+	assert.Equal(t, KeyGroup, decision.RejectedBy)
+}
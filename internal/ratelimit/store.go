@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"Groupchat-Service/internal/cache"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets *cache.LRU[string, bucket]
+	now     func() time.Time
+}
+
+// NewMemoryStore keeps up to maxBuckets buckets in process memory. Every replica limits on its own, so a
+// client spreading its requests over n replicas gets up to n times the limits. Evicted buckets start full again.
+func NewMemoryStore(maxBuckets int) Store {
+	return &memoryStore{buckets: cache.NewLRU[string, bucket](maxBuckets, 0), now: time.Now}
+}
+
+func (s *memoryStore) Take(_ context.Context, keys []string, limits []Limit) ([]Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	states := make([]bucket, len(keys))
+	allowed := true
+	for i, key := range keys {
+		state, ok := s.buckets.Get(key)
+		if !ok {
+			state = bucket{tokens: float64(limits[i].Burst), updated: now}
+		}
+		state.tokens = refill(state.tokens, now.Sub(state.updated), limits[i])
+		state.updated = now
+		states[i] = state
+		allowed = allowed && state.tokens >= 1
+	}
+
+	results := make([]Result, len(keys))
+	for i, state := range states {
+		hadToken := state.tokens >= 1
+		if allowed {
+			state.tokens--
+		}
+		s.buckets.Set(keys[i], state)
+		results[i] = newResult(hadToken, state.tokens, limits[i])
+	}
+	return results, nil
+}
+
+// redisRateLimitKeyPrefix namespaces the bucket keys; bump the version when the bucket layout changes
+const redisRateLimitKeyPrefix = "groupchat:rate-limit:v1:"
+
+// redisTakeScript refills the buckets of KEYS and takes a token from each of them when all have one, atomically.
+// It reads the clock of Redis, so replicas with skewed clocks share buckets correctly. ARGV holds per key the
+// tokens regained per millisecond and the burst; it returns per key whether the bucket had a token and the
+// tokens left.
+const redisTakeScript = `
+if redis.replicate_commands then redis.replicate_commands() end
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local tokens = {}
+local allowed = true
+for i, key in ipairs(KEYS) do
+  local rate = tonumber(ARGV[2 * i - 1])
+  local burst = tonumber(ARGV[2 * i])
+  local state = redis.call("HMGET", key, "tokens", "updated")
+  local left = tonumber(state[1]) or burst
+  local updated = tonumber(state[2]) or now
+  tokens[i] = math.min(burst, left + math.max(0, now - updated) * rate)
+  if tokens[i] < 1 then
+    allowed = false
+  end
+end
+local reply = {}
+for i, key in ipairs(KEYS) do
+  local rate = tonumber(ARGV[2 * i - 1])
+  local burst = tonumber(ARGV[2 * i])
+  local hadToken = 0
+  if tokens[i] >= 1 then
+    hadToken = 1
+  end
+  if allowed then
+    tokens[i] = tokens[i] - 1
+  end
+  redis.call("HSET", key, "tokens", tostring(tokens[i]), "updated", tostring(now))
+  redis.call("PEXPIRE", key, math.ceil((burst - tokens[i]) / rate) + 1000)
+  table.insert(reply, hadToken)
+  table.insert(reply, tostring(tokens[i]))
+end
+return reply
+`
+
+type redisStore struct {
+	client *cache.RedisClient
+}
+
+// NewRedisStore shares the buckets between replicas through Redis. Buckets expire once they are full again.
+func NewRedisStore(client *cache.RedisClient) Store {
+	return &redisStore{client: client}
+}
+
+func (s *redisStore) Take(ctx context.Context, keys []string, limits []Limit) ([]Result, error) {
+	args := []string{"EVAL", redisTakeScript, strconv.Itoa(len(keys))}
+	for _, key := range keys {
+		args = append(args, redisRateLimitKeyPrefix+key)
+	}
+	for _, limit := range limits {
+		perMillisecond := limit.rate() / 1000
+		args = append(args, strconv.FormatFloat(perMillisecond, 'g', -1, 64), strconv.Itoa(limit.Burst))
+	}
+	reply, err := s.client.Do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2*len(keys) {
+		return nil, fmt.Errorf("redis: unexpected reply %v to rate limit script", reply)
+	}
+	results := make([]Result, len(keys))
+	for i, limit := range limits {
+		hadToken, ok := values[2*i].(int64)
+		if !ok {
+			return nil, fmt.Errorf("redis: unexpected reply %v to rate limit script", reply)
+		}
+		text, _ := values[2*i+1].(string)
+		tokens, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: unexpected reply %v to rate limit script", reply)
+		}
+		results[i] = newResult(hadToken == 1, tokens, limit)
+	}
+	return results, nil
+}
@@ -0,0 +1,313 @@
+// Package search turns message content into index terms and renders highlighted snippets. Messages are
+// written in Dutch and English without a language tag, so every word is indexed under both its Dutch and
+// its English stem and a query word matches when either stem is shared.
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxTermLength bounds the length of indexed words, longer words are not indexed
+const MaxTermLength = 64
+
+// Token is a word in plain text, with its byte offsets and the index terms it is stored under.
+// Stop words have no terms.
+type Token struct {
+	Start int
+	End   int
+	Terms []string
+}
+
+// Query holds the alternative terms of every query word. A message matches when it contains
+// at least one term of each word.
+type Query [][]string
+
+var stopWords = map[string]bool{
+	// English
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true, "by": true,
+	"for": true, "if": true, "in": true, "into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "such": true, "that": true, "the": true, "their": true, "then": true, "there": true,
+	"these": true, "they": true, "this": true, "to": true, "was": true, "will": true, "with": true,
+	// Dutch
+	"de": true, "het": true, "een": true, "en": true, "van": true, "ik": true, "te": true, "dat": true, "die": true,
+	"er": true, "zijn": true, "op": true, "aan": true, "met": true, "als": true, "voor": true, "had": true,
+	"maar": true, "om": true, "hem": true, "dan": true, "zou": true, "wat": true, "mijn": true, "men": true,
+	"dit": true, "zo": true, "door": true, "over": true, "ze": true, "zich": true, "bij": true, "ook": true,
+	"tot": true, "je": true, "mij": true, "uit": true, "der": true, "daar": true, "haar": true, "naar": true,
+	"heb": true, "hoe": true, "heeft": true, "hebben": true, "deze": true, "u": true, "nog": true, "zal": true,
+	"me": true, "zij": true, "nu": true, "ge": true, "geen": true, "omdat": true, "iets": true, "worden": true,
+	"toch": true, "al": true, "waren": true, "veel": true, "meer": true, "doen": true, "toen": true, "moet": true,
+	"ben": true, "zonder": true, "kan": true, "hun": true, "dus": true, "alles": true, "onder": true, "ja": true,
+	"eens": true, "hier": true, "wie": true, "werd": true, "altijd": true, "doch": true, "wordt": true,
+	"wezen": true, "kunnen": true, "ons": true, "zelf": true, "tegen": true, "na": true, "reeds": true,
+	"wil": true, "kon": true, "niets": true, "uw": true, "iemand": true, "geweest": true, "andere": true,
+	"wel": true, "niet": true,
+}
+
+// PlainText strips the markup the message sanitizer lets through and resolves HTML entities
+func PlainText(content string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range content {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+			b.WriteRune(' ')
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return html.UnescapeString(b.String())
+}
+
+// normalize lower cases a word and removes its diacritics, so "Café" and "cafe" are the same word
+func normalize(word string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	normalized, _, err := transform.String(t, word)
+	if err != nil {
+		normalized = word
+	}
+	return strings.ToLower(normalized)
+}
+
+// Tokenize splits plain text into words
+func Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+	for i, r := range text {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+		switch {
+		case isWordRune && start < 0:
+			start = i
+		case !isWordRune && start >= 0:
+			tokens = append(tokens, newToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(text, start, len(text)))
+	}
+	return tokens
+}
+
+func newToken(text string, start int, end int) Token {
+	return Token{Start: start, End: end, Terms: wordTerms(normalize(text[start:end]))}
+}
+
+// wordTerms returns the distinct stems a normalized word is indexed under
+func wordTerms(word string) []string {
+	if stopWords[word] || utf8.RuneCountInString(word) > MaxTermLength {
+		return nil
+	}
+	if strings.IndexFunc(word, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+		return []string{word}
+	}
+
+	english, dutch := stemEnglish(word), stemDutch(word)
+	if english == dutch {
+		return []string{english}
+	}
+	return []string{english, dutch}
+}
+
+// IndexTerms returns the distinct terms a message is indexed under
+func IndexTerms(content string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, token := range Tokenize(PlainText(content)) {
+		for _, term := range token.Terms {
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// ParseQuery analyses search text the same way as message content. Stop words and repeated
+// words are dropped, so a query of only stop words is empty.
+func ParseQuery(text string) Query {
+	var query Query
+	seen := make(map[string]bool)
+	for _, token := range Tokenize(PlainText(text)) {
+		if len(token.Terms) == 0 || seen[strings.Join(token.Terms, " ")] {
+			continue
+		}
+		seen[strings.Join(token.Terms, " ")] = true
+		query = append(query, token.Terms)
+	}
+	return query
+}
+
+// Matches reports whether a message indexed under terms contains every query word
+func (q Query) Matches(terms []string) bool {
+	if len(q) == 0 {
+		return false
+	}
+
+	indexed := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		indexed[term] = true
+	}
+	for _, word := range q {
+		if !containsAny(indexed, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// highlights reports whether a token matches any query word
+func (q Query) highlights(token Token) bool {
+	for _, word := range q {
+		for _, term := range word {
+			for _, tokenTerm := range token.Terms {
+				if term == tokenTerm {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func containsAny(set map[string]bool, terms []string) bool {
+	for _, term := range terms {
+		if set[term] {
+			return true
+		}
+	}
+	return false
+}
+
+// Snippet returns an HTML-escaped excerpt of about maxLength bytes of the message around the first match,
+// with every matching word wrapped in <mark> tags. Cut off text is marked with an ellipsis.
+func Snippet(content string, query Query, maxLength int) string {
+	const contextBefore = 40
+
+	text := PlainText(content)
+	tokens := Tokenize(text)
+
+	first := -1
+	for i, token := range tokens {
+		if query.highlights(token) {
+			first = i
+			break
+		}
+	}
+
+	// Start a few words before the first match, on a word boundary
+	start := 0
+	if first > 0 {
+		for i := first; i >= 0 && tokens[first].Start-tokens[i].Start <= contextBefore; i-- {
+			start = tokens[i].Start
+		}
+		if start == tokens[0].Start {
+			start = 0
+		}
+	}
+
+	// End at the last whole word that fits
+	end := len(text)
+	if end-start > maxLength {
+		end = start
+		for _, token := range tokens {
+			if token.Start < start {
+				continue
+			}
+			if token.End-start > maxLength {
+				break
+			}
+			end = token.End
+		}
+		if end == start {
+			end = start + maxLength
+			for end > start && !utf8.RuneStart(text[end]) {
+				end--
+			}
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	position := start
+	for _, token := range tokens {
+		if token.Start < start || token.End > end || !query.highlights(token) {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[position:token.Start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[token.Start:token.End]))
+		b.WriteString("</mark>")
+		position = token.End
+	}
+	b.WriteString(html.EscapeString(text[position:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func hasPrefix(w []rune, prefix string) bool {
+	return strings.HasPrefix(string(w), prefix)
+}
+
+func hasSuffix(w []rune, suffix string) bool {
+	return strings.HasSuffix(string(w), suffix)
+}
+
+// longestSuffix returns the first of suffixes that w ends with, so suffixes are listed longest first
+func longestSuffix(w []rune, suffixes ...string) string {
+	for _, suffix := range suffixes {
+		if hasSuffix(w, suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
+
+// applySuffixRules replaces the longest matching suffix when allowed accepts it
+func applySuffixRules(w []rune, rules []suffixRule, allowed func(w []rune, rule suffixRule, start int) bool) []rune {
+	for _, rule := range rules {
+		if !hasSuffix(w, rule.suffix) {
+			continue
+		}
+		start := len(w) - len(rule.suffix)
+		if allowed(w, rule, start) {
+			w = append(w[:start], []rune(rule.replacement)...)
+		}
+		return w
+	}
+	return w
+}
+
+// regionAfter returns the index after the first non-vowel that follows a vowel at or after start
+func regionAfter(w []rune, start int, isVowel func(rune) bool) int {
+	for i := start + 1; i < len(w); i++ {
+		if !isVowel(w[i]) && isVowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+func containsVowel(w []rune, isVowel func(rune) bool) bool {
+	for _, r := range w {
+		if isVowel(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStemEnglish(t *testing.T) {
+	tests := map[string]string{
+		"walking":    "walk",
+		"walked":     "walk",
+		"walks":      "walk",
+		"running":    "run",
+		"hoped":      "hope",
+		"connection": "connect",
+		"connected":  "connect",
+		"happiness":  "happi",
+		"happy":      "happi",
+		"generously": "generous",
+		"cries":      "cri",
+		"ties":       "tie",
+		"skies":      "sky",
+		"gas":        "gas",
+	}
+	for word, want := range tests {
+		assert.Equal(t, want, stemEnglish(word), word)
+	}
+}
+
+func TestStemDutch(t *testing.T) {
+	tests := map[string]string{
+		"katten":        "kat",
+		"kat":           "kat",
+		"bomen":         "bom",
+		"boom":          "bom",
+		"lopen":         "lop",
+		"loop":          "lop",
+		"maan":          "man",
+		"mogelijkheden": "mogelijk",
+	}
+	for word, want := range tests {
+		assert.Equal(t, want, stemDutch(word), word)
+	}
+}
+
+func TestIndexTerms(t *testing.T) {
+	t.Run("Normalises case, diacritics and markup", func(t *testing.T) {
+		assert.Equal(t, IndexTerms("café"), IndexTerms("<b>CAFE</b>"))
+		assert.Equal(t, IndexTerms("Tom &amp; Jerry"), IndexTerms("tom jerry"))
+	})
+
+	t.Run("Leaves out stop words", func(t *testing.T) {
+		assert.Empty(t, IndexTerms("de en het the and"))
+		assert.Empty(t, ParseQuery("de en het the and"))
+	})
+}
+
+func TestQueryMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		content string
+		want    bool
+	}{
+		{"Dutch plural matches singular", "boom", "De bomen in het park", true},
+		{"English inflection matches", "walking", "We walked to the doctor", true},
+		{"Every word has to match", "bomen fiets", "De bomen in het park", false},
+		{"Words in any order", "park bomen", "De bomen in het park", true},
+		{"Prefix is not a match", "park", "De parkeerplaats is vol", false},
+		{"Numbers match literally", "2024", "Afspraak in 2024", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseQuery(tt.query).Matches(IndexTerms(tt.content)))
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	t.Run("Marks matching words and escapes the rest", func(t *testing.T) {
+		snippet := Snippet("Mama & papa gaan <i>morgen</i> wandelen", ParseQuery("wandelingen papa"), 200)
+		assert.Equal(t, "Mama &amp; <mark>papa</mark> gaan  morgen  <mark>wandelen</mark>", snippet)
+	})
+
+	t.Run("Cuts long messages around the first match", func(t *testing.T) {
+		content := "Vandaag hebben we het over van alles gehad, het weer, de boodschappen en het verkeer. " +
+			"Daarna hebben we de medicatie van oma besproken en afgesproken wie haar morgen ophaalt bij het ziekenhuis."
+		snippet := Snippet(content, ParseQuery("medicatie"), 80)
+
+		assert.Contains(t, snippet, "<mark>medicatie</mark>")
+		assert.True(t, len(snippet) < len(content))
+		assert.Regexp(t, "^…", snippet)
+		assert.Regexp(t, "…$", snippet)
+	})
+}
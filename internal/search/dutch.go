@@ -0,0 +1,134 @@
+package search
+
+// Dutch stemming follows the Snowball Dutch algorithm on lower case words without diacritics.
+// See https://snowballstem.org/algorithms/dutch/stemmer.html
+
+func isDutchVowel(r rune) bool {
+	switch r {
+	case 'a', 'e', 'i', 'o', 'u', 'y', 'è':
+		return true
+	}
+	return false
+}
+
+func stemDutch(word string) string {
+	w := []rune(word)
+	if len(w) <= 2 {
+		return word
+	}
+
+	// A y at the start or after a vowel, and an i between vowels, act as consonants and are marked upper case
+	for i := range w {
+		switch {
+		case w[i] == 'y' && (i == 0 || isDutchVowel(w[i-1])):
+			w[i] = 'Y'
+		case w[i] == 'i' && i > 0 && i < len(w)-1 && isDutchVowel(w[i-1]) && isDutchVowel(w[i+1]):
+			w[i] = 'I'
+		}
+	}
+
+	// R1 leaves at least three letters in front of it
+	r1 := regionAfter(w, 0, isDutchVowel)
+	r2 := regionAfter(w, r1, isDutchVowel)
+	if r1 < 3 {
+		r1 = min(3, len(w))
+	}
+
+	// Step 1: plurals and inflections
+	switch suffix := longestSuffix(w, "heden", "ene", "en", "se", "s"); suffix {
+	case "heden":
+		if start := len(w) - len(suffix); start >= r1 {
+			w = append(w[:start], []rune("heid")...)
+		}
+	case "ene", "en":
+		w = removeDutchEnEnding(w, len(w)-len(suffix), r1)
+	case "se", "s":
+		if start := len(w) - len(suffix); start >= r1 && start > 0 && !isDutchVowel(w[start-1]) && w[start-1] != 'j' {
+			w = w[:start]
+		}
+	}
+
+	// Step 2: a final e
+	removedE := false
+	if n := len(w); n > 1 && w[n-1] == 'e' && n-1 >= r1 && !isDutchVowel(w[n-2]) {
+		w = undoubleDutch(w[:n-1])
+		removedE = true
+	}
+
+	// Step 3a: heid
+	if hasSuffix(w, "heid") {
+		if start := len(w) - 4; start >= r2 && (start == 0 || w[start-1] != 'c') {
+			w = w[:start]
+			if hasSuffix(w, "en") {
+				w = removeDutchEnEnding(w, len(w)-2, r1)
+			}
+		}
+	}
+
+	// Step 3b: derivational suffixes in R2
+	switch suffix := longestSuffix(w, "lijk", "baar", "end", "ing", "bar", "ig"); suffix {
+	case "end", "ing":
+		if start := len(w) - len(suffix); start >= r2 {
+			w = w[:start]
+			if igStart := len(w) - 2; hasSuffix(w, "ig") && igStart >= r2 && (igStart == 0 || w[igStart-1] != 'e') {
+				w = w[:igStart]
+			} else {
+				w = undoubleDutch(w)
+			}
+		}
+	case "ig":
+		if start := len(w) - 2; start >= r2 && (start == 0 || w[start-1] != 'e') {
+			w = w[:start]
+		}
+	case "lijk":
+		if start := len(w) - 4; start >= r2 {
+			w = w[:start]
+			if n := len(w); n > 1 && w[n-1] == 'e' && n-1 >= r1 && !isDutchVowel(w[n-2]) {
+				w = undoubleDutch(w[:n-1])
+			}
+		}
+	case "baar":
+		if start := len(w) - 4; start >= r2 {
+			w = w[:start]
+		}
+	case "bar":
+		if start := len(w) - 3; start >= r2 && removedE {
+			w = w[:start]
+		}
+	}
+
+	// Step 4: undouble a vowel between two consonants at the end, as in maan -> man
+	if n := len(w); n >= 4 {
+		c, v1, v2, d := w[n-4], w[n-3], w[n-2], w[n-1]
+		if !isDutchVowel(c) && v1 == v2 && (v1 == 'a' || v1 == 'e' || v1 == 'o' || v1 == 'u') &&
+			!isDutchVowel(d) && d != 'I' {
+			w = append(w[:n-2], d)
+		}
+	}
+
+	for i := range w {
+		switch w[i] {
+		case 'Y':
+			w[i] = 'y'
+		case 'I':
+			w[i] = 'i'
+		}
+	}
+	return string(w)
+}
+
+// removeDutchEnEnding removes an -en or -ene ending that starts at start when it lies in R1 and follows
+// a consonant, except in words ending in -gemen, and undoubles the remaining ending
+func removeDutchEnEnding(w []rune, start int, r1 int) []rune {
+	if start < r1 || start == 0 || isDutchVowel(w[start-1]) || hasSuffix(w[:start], "gem") {
+		return w
+	}
+	return undoubleDutch(w[:start])
+}
+
+func undoubleDutch(w []rune) []rune {
+	if hasSuffix(w, "kk") || hasSuffix(w, "dd") || hasSuffix(w, "tt") {
+		return w[:len(w)-1]
+	}
+	return w
+}
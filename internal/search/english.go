@@ -0,0 +1,205 @@
+package search
+
+// English stemming follows the Snowball English (Porter2) algorithm on lower case words.
+// See https://snowballstem.org/algorithms/english/stemmer.html
+
+var englishExceptions = map[string]string{
+	"skis": "ski", "skies": "sky", "dying": "die", "lying": "lie", "tying": "tie",
+	"idly": "idl", "gently": "gentl", "ugly": "ugli", "early": "earli", "only": "onli", "singly": "singl",
+	"sky": "sky", "news": "news", "howe": "howe", "atlas": "atlas", "cosmos": "cosmos", "bias": "bias", "andes": "andes",
+}
+
+// englishInvariantAfterStep1a are left alone once their plural has been removed
+var englishInvariantAfterStep1a = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true,
+	"earring": true, "proceed": true, "exceed": true, "succeed": true,
+}
+
+type suffixRule struct {
+	suffix      string
+	replacement string
+}
+
+var englishStep2 = []suffixRule{
+	{"ization", "ize"}, {"ational", "ate"}, {"fulness", "ful"}, {"ousness", "ous"}, {"iveness", "ive"},
+	{"tional", "tion"}, {"biliti", "ble"}, {"lessli", "less"},
+	{"entli", "ent"}, {"ation", "ate"}, {"alism", "al"}, {"aliti", "al"}, {"ousli", "ous"}, {"iviti", "ive"}, {"fulli", "ful"},
+	{"enci", "ence"}, {"anci", "ance"}, {"abli", "able"}, {"izer", "ize"}, {"ator", "ate"}, {"alli", "al"},
+	{"bli", "ble"}, {"ogi", "og"},
+	{"li", ""},
+}
+
+var englishStep3 = []suffixRule{
+	{"ational", "ate"}, {"tional", "tion"}, {"alize", "al"}, {"icate", "ic"}, {"iciti", "ic"}, {"ative", ""},
+	{"ical", "ic"}, {"ness", ""}, {"ful", ""},
+}
+
+var englishStep4 = []string{
+	"ement", "ance", "ence", "able", "ible", "ment", "ant", "ent", "ism", "ate", "iti", "ous", "ive", "ize", "ion", "al", "er", "ic",
+}
+
+func isEnglishVowel(r rune) bool {
+	switch r {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	}
+	return false
+}
+
+func stemEnglish(word string) string {
+	if stem, ok := englishExceptions[word]; ok {
+		return stem
+	}
+
+	w := []rune(word)
+	if len(w) <= 2 {
+		return word
+	}
+
+	// A y that acts as a consonant is marked Y
+	for i := range w {
+		if w[i] == 'y' && (i == 0 || isEnglishVowel(w[i-1])) {
+			w[i] = 'Y'
+		}
+	}
+
+	r1 := -1
+	for _, prefix := range []string{"gener", "commun", "arsen"} {
+		if hasPrefix(w, prefix) {
+			r1 = len(prefix)
+			break
+		}
+	}
+	if r1 < 0 {
+		r1 = regionAfter(w, 0, isEnglishVowel)
+	}
+	r2 := regionAfter(w, r1, isEnglishVowel)
+
+	// Step 1a: plurals
+	switch {
+	case hasSuffix(w, "sses"):
+		w = w[:len(w)-2]
+	case hasSuffix(w, "ied"), hasSuffix(w, "ies"):
+		if len(w) > 4 {
+			w = w[:len(w)-2]
+		} else {
+			w = w[:len(w)-1]
+		}
+	case hasSuffix(w, "us"), hasSuffix(w, "ss"):
+	case hasSuffix(w, "s"):
+		if containsVowel(w[:len(w)-2], isEnglishVowel) {
+			w = w[:len(w)-1]
+		}
+	}
+	if englishInvariantAfterStep1a[string(w)] {
+		return string(w)
+	}
+
+	// Step 1b: past tense and gerunds
+	if suffix := longestSuffix(w, "eedly", "ingly", "edly", "eed", "ing", "ed"); suffix != "" {
+		start := len(w) - len(suffix)
+		switch suffix {
+		case "eed", "eedly":
+			if start >= r1 {
+				w = append(w[:start], 'e', 'e')
+			}
+		default:
+			if containsVowel(w[:start], isEnglishVowel) {
+				w = w[:start]
+				switch {
+				case hasSuffix(w, "at"), hasSuffix(w, "bl"), hasSuffix(w, "iz"):
+					w = append(w, 'e')
+				case endsInEnglishDouble(w):
+					w = w[:len(w)-1]
+				case r1 >= len(w) && endsInShortSyllable(w):
+					w = append(w, 'e')
+				}
+			}
+		}
+	}
+
+	// Step 1c: a final y after a consonant becomes i
+	if n := len(w); n > 2 && (w[n-1] == 'y' || w[n-1] == 'Y') && !isEnglishVowel(w[n-2]) {
+		w[n-1] = 'i'
+	}
+
+	// Step 2 and 3: derivational suffixes in R1
+	w = applySuffixRules(w, englishStep2, func(w []rune, rule suffixRule, start int) bool {
+		if start < r1 {
+			return false
+		}
+		switch rule.suffix {
+		case "ogi":
+			return start > 0 && w[start-1] == 'l'
+		case "li":
+			return start > 0 && isValidLiEnding(w[start-1])
+		}
+		return true
+	})
+	w = applySuffixRules(w, englishStep3, func(_ []rune, rule suffixRule, start int) bool {
+		if rule.suffix == "ative" {
+			return start >= r2
+		}
+		return start >= r1
+	})
+
+	// Step 4: suffixes in R2
+	if suffix := longestSuffix(w, englishStep4...); suffix != "" {
+		start := len(w) - len(suffix)
+		if start >= r2 && (suffix != "ion" || (start > 0 && (w[start-1] == 's' || w[start-1] == 't'))) {
+			w = w[:start]
+		}
+	}
+
+	// Step 5: final e and ll
+	if n := len(w); n > 0 {
+		switch {
+		case w[n-1] == 'e' && (n-1 >= r2 || (n-1 >= r1 && !endsInShortSyllable(w[:n-1]))):
+			w = w[:n-1]
+		case w[n-1] == 'l' && n-1 >= r2 && n > 1 && w[n-2] == 'l':
+			w = w[:n-1]
+		}
+	}
+
+	for i := range w {
+		if w[i] == 'Y' {
+			w[i] = 'y'
+		}
+	}
+	return string(w)
+}
+
+func isValidLiEnding(r rune) bool {
+	switch r {
+	case 'c', 'd', 'e', 'g', 'h', 'k', 'm', 'n', 'r', 't':
+		return true
+	}
+	return false
+}
+
+func endsInEnglishDouble(w []rune) bool {
+	n := len(w)
+	if n < 2 || w[n-1] != w[n-2] {
+		return false
+	}
+	switch w[n-1] {
+	case 'b', 'd', 'f', 'g', 'm', 'n', 'p', 'r', 't':
+		return true
+	}
+	return false
+}
+
+// endsInShortSyllable reports whether w ends in a vowel followed by a consonant other than w, x or Y
+// that is preceded by a consonant, or is a vowel followed by a consonant at the start of the word
+func endsInShortSyllable(w []rune) bool {
+	n := len(w)
+	if n == 2 {
+		return isEnglishVowel(w[0]) && !isEnglishVowel(w[1])
+	}
+	if n < 3 {
+		return false
+	}
+	last := w[n-1]
+	return !isEnglishVowel(w[n-3]) && isEnglishVowel(w[n-2]) && !isEnglishVowel(last) &&
+		last != 'w' && last != 'x' && last != 'Y'
+}
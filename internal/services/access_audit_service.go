@@ -0,0 +1,47 @@
+package services
+
+import (
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// accessAuditService keeps the audit trail of users overseeing groups, so patients and caregivers can see
+// which professionals read or moderated their group
+type accessAuditService struct {
+	repo repositories.AccessAuditRepository
+}
+
+func NewAccessAuditService(repo repositories.AccessAuditRepository) AccessAuditService {
+	return &accessAuditService{repo: repo}
+}
+
+// RecordAccess stores an access, assigning its ID and time when they are not set
+func (s *accessAuditService) RecordAccess(ctx context.Context, audit *models.AccessAudit) error {
+	if audit.ID == uuid.Nil {
+		audit.ID = uuid.New()
+	}
+	if audit.AccessedAt.IsZero() {
+		audit.AccessedAt = time.Now().UTC()
+	}
+
+	if err := s.repo.RecordAccess(ctx, audit); err != nil {
+		return fmt.Errorf("error recording access to group %s: %w", audit.GroupID, err)
+	}
+	return nil
+}
+
+// ListAccesses returns the audited accesses of a group, newest first
+func (s *accessAuditService) ListAccesses(ctx context.Context, groupID uuid.UUID) ([]models.AccessAudit, error) {
+	audits, err := s.repo.ListAccesses(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing accesses of group %s: %w", groupID, err)
+	}
+	if audits == nil {
+		audits = []models.AccessAudit{}
+	}
+	return audits, nil
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+var (
+	archivedMessagesTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "archive_archived_messages_total",
+			Help: "Total number of messages moved to the cold archive",
+		},
+	)
+
+	archiveRunsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "archive_runs_total",
+			Help: "Total number of archive runs by result",
+		},
+		[]string{"result"},
+	)
+
+	archiveRunDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "archive_run_duration_seconds",
+			Help:    "Duration of archive runs in seconds",
+			Buckets: []float64{.1, .5, 1, 5, 15, 60, 300, 900, 3600},
+		},
+	)
+)
+
+type ArchiveConfig struct {
+	// After is the age from which messages are moved to the archive
+	After time.Duration
+	// BatchSize is the number of messages read and deleted together
+	BatchSize int
+}
+
+type archiveService struct {
+	messageRepo repositories.MessageRepository
+	archive     *repositories.MessageArchive
+	config      ArchiveConfig
+	logger      util.Logger
+	now         func() time.Time
+}
+
+func NewArchiveService(
+	messageRepo repositories.MessageRepository,
+	archive *repositories.MessageArchive,
+	config ArchiveConfig,
+	loggerFactory util.LoggerFactory,
+) ArchiveService {
+	return &archiveService{
+		messageRepo: messageRepo,
+		archive:     archive,
+		config:      config,
+		logger:      loggerFactory.NewLogger("ArchiveService"),
+		now:         time.Now,
+	}
+}
+
+// StartArchiveScheduler archives old messages every interval until the context is cancelled
+func StartArchiveScheduler(ctx context.Context, service ArchiveService, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := service.ArchiveOldMessages(ctx); err != nil {
+					fmt.Printf("Error archiving old messages: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// ArchiveOldMessages moves the messages of every group that are older than the configured age to the archive.
+// A failure for one group is logged and does not stop the others; the failures are returned together.
+func (s *archiveService) ArchiveOldMessages(ctx context.Context) ([]models.ArchiveReport, error) {
+	start := s.now()
+	reports, err := s.archiveAll(ctx, start.Add(-s.config.After).UTC())
+
+	archiveRunDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		archiveRunsTotal.WithLabelValues("failure").Inc()
+		return reports, err
+	}
+	archiveRunsTotal.WithLabelValues("success").Inc()
+	return reports, nil
+}
+
+func (s *archiveService) archiveAll(ctx context.Context, cutoff time.Time) ([]models.ArchiveReport, error) {
+	groupIDs, err := s.messageRepo.ListGroupIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing groups: %w", err)
+	}
+
+	var reports []models.ArchiveReport
+	var errs []error
+	archived := 0
+	for _, groupID := range groupIDs {
+		report, err := s.archiveGroup(ctx, groupID, cutoff)
+		if report.MessageCount > 0 {
+			reports = append(reports, *report)
+			archived += report.MessageCount
+		}
+		if err != nil {
+			s.logger.Error("Failed to archive old messages", "groupID", groupID, "error", err)
+			errs = append(errs, fmt.Errorf("group %s: %w", groupID, err))
+		}
+	}
+
+	s.logger.Info("Archive run complete", "groups", len(groupIDs), "messages", archived)
+	return reports, errors.Join(errs...)
+}
+
+// archiveGroup copies the old messages of a group into the archive a month at a time, then publishes them
+// by advancing the archive's watermark and only then deletes them from the hot store. Readers therefore see
+// every message exactly once at any point of the run, and an interrupted run is completed by the next one.
+func (s *archiveService) archiveGroup(ctx context.Context, groupID uuid.UUID, cutoff time.Time) (*models.ArchiveReport, error) {
+	report := &models.ArchiveReport{GroupID: groupID, Cutoff: cutoff}
+
+	// The old messages are listed newest first, so each month is complete once an older month starts
+	var month []models.Message
+	var newest *models.Message
+	flush := func() error {
+		if len(month) == 0 {
+			return nil
+		}
+		if err := s.archive.AddMessages(ctx, groupID, month); err != nil {
+			return fmt.Errorf("error archiving messages: %w", err)
+		}
+		month = nil
+		return nil
+	}
+
+	query := models.RetentionQuery{Before: cutoff, Limit: s.config.BatchSize}
+	for {
+		batch, err := s.messageRepo.ListExpiredMessages(ctx, groupID, query)
+		if err != nil {
+			return report, fmt.Errorf("error listing old messages: %w", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if newest == nil {
+			newest = &batch[0]
+		}
+
+		for _, message := range batch {
+			if len(month) > 0 && !sameMonth(month[0].SentAt, message.SentAt) {
+				if err := flush(); err != nil {
+					return report, err
+				}
+			}
+			month = append(month, message)
+		}
+
+		last := batch[len(batch)-1]
+		query.Position = &models.MessageCursor{SentAt: last.SentAt, MessageID: last.ID}
+	}
+	if err := flush(); err != nil {
+		return report, err
+	}
+	if newest == nil {
+		return report, nil
+	}
+
+	if err := s.archive.AdvanceWatermark(ctx, groupID, *newest); err != nil {
+		return report, fmt.Errorf("error publishing archived messages: %w", err)
+	}
+
+	query.Position = nil
+	for {
+		batch, err := s.messageRepo.ListExpiredMessages(ctx, groupID, query)
+		if err != nil {
+			return report, fmt.Errorf("error listing archived messages: %w", err)
+		}
+		if len(batch) == 0 {
+			return report, nil
+		}
+		if err := s.messageRepo.DeleteMessages(ctx, groupID, batch); err != nil {
+			return report, fmt.Errorf("error deleting archived messages: %w", err)
+		}
+
+		report.MessageCount += len(batch)
+		archivedMessagesTotal.Add(float64(len(batch)))
+
+		last := batch[len(batch)-1]
+		query.Position = &models.MessageCursor{SentAt: last.SentAt, MessageID: last.ID}
+	}
+}
+
+func sameMonth(a, b time.Time) bool {
+	a, b = a.UTC(), b.UTC()
+	return a.Year() == b.Year() && a.Month() == b.Month()
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveOldMessages(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	hot := repositories.NewMemoryMessageRepository()
+	archive := repositories.NewMessageArchive(repositories.NewFileArchiveStore(t.TempDir()))
+	messageRepo := repositories.NewArchivedMessageRepository(hot, archive)
+	service := NewArchiveService(messageRepo, archive, ArchiveConfig{After: 90 * 24 * time.Hour, BatchSize: 2},
+		util.NewLoggerFactory()).(*archiveService)
+	service.now = func() time.Time { return now }
+
+	groupID := uuid.New()
+	var ids []uuid.UUID
+	for _, age := range []int{400, 200, 120, 100, 95, 30, 1} {
+		message := models.Message{ID: uuid.New(), GroupID: groupID, SenderID: uuid.New(), SenderName: "Anna",
+			Content: "bericht", SentAt: now.AddDate(0, 0, -age)}
+		require.NoError(t, messageRepo.CreateMessage(ctx, groupID, &message))
+		ids = append([]uuid.UUID{message.ID}, ids...)
+	}
+	quietGroupID := uuid.New()
+	require.NoError(t, messageRepo.CreateMessage(ctx, quietGroupID, &models.Message{ID: uuid.New(), GroupID: quietGroupID,
+		SenderID: uuid.New(), SenderName: "Anna", Content: "bericht", SentAt: now.Add(-time.Hour)}))
+
+	reports, err := service.ArchiveOldMessages(ctx)
+	require.NoError(t, err)
+	require.Len(t, reports, 1, "groups without old messages are not reported")
+	assert.Equal(t, groupID, reports[0].GroupID)
+	assert.Equal(t, 5, reports[0].MessageCount)
+	assert.Equal(t, now.AddDate(0, 0, -90), reports[0].Cutoff)
+
+	remaining, _, err := hot.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 10, Direction: models.Next})
+	require.NoError(t, err)
+	assert.Len(t, remaining, 2, "only recent messages stay in the hot store")
+
+	// Clients page through one history
+	var paged []uuid.UUID
+	query := models.PaginationQuery{PageSize: 3, Direction: models.Next}
+	for {
+		page, pagination, err := messageRepo.GetMessages(ctx, groupID, query)
+		require.NoError(t, err)
+		for _, message := range page {
+			paged = append(paged, message.ID)
+		}
+		if !pagination.HasNext {
+			break
+		}
+		last := page[len(page)-1]
+		query.Position = &models.MessageCursor{SentAt: last.SentAt, MessageID: last.ID}
+	}
+	assert.Equal(t, ids, paged)
+
+	reports, err = service.ArchiveOldMessages(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, reports, "archived messages are archived once")
+}
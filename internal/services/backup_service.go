@@ -0,0 +1,592 @@
+package services
+
+import (
+	"Groupchat-Service/internal/backup"
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"slices"
+	"time"
+)
+
+type BackupConfig struct {
+	// BatchSize is the number of messages read together
+	BatchSize int
+}
+
+// RestoreOptions narrow down what a restore writes
+type RestoreOptions struct {
+	// GroupID restores only the data of this group when set. User preferences and token revocations belong
+	// to no group and are left out.
+	GroupID uuid.UUID
+	// Until restores only the messages sent before this time when set
+	Until time.Time
+	// Tables restores only these tables when set
+	Tables []string
+}
+
+type backupService struct {
+	repos       *repositories.Repositories
+	revocations repositories.TokenRevocationRepository
+	config      BackupConfig
+	logger      util.Logger
+}
+
+// NewBackupService backs up the storage of repos together with the token revocations, which are shared by
+// every tenant
+func NewBackupService(repos *repositories.Repositories, revocations repositories.TokenRevocationRepository, config BackupConfig, loggerFactory util.LoggerFactory) BackupService {
+	return &backupService{
+		repos:       repos,
+		revocations: revocations,
+		config:      config,
+		logger:      loggerFactory.NewLogger("BackupService"),
+	}
+}
+
+// Backup writes every table to the backup. Messages are read group by group up to the time the backup was
+// started, so messages sent while it runs are left out consistently.
+func (s *backupService) Backup(ctx context.Context, writer *backup.Writer) error {
+	if err := writer.BeginTable(backup.TableMessages); err != nil {
+		return err
+	}
+	if err := s.backupMessages(ctx, writer, writer.Manifest().CreatedAt); err != nil {
+		return err
+	}
+
+	tokens, err := s.repos.FCMTokens.ListTokens(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing tokens: %w", err)
+	}
+	records := make([]any, 0, len(tokens))
+	for _, token := range tokens {
+		record, err := tokenRecord(token)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	if err := writeTable(writer, backup.TableFCMTokens, records); err != nil {
+		return err
+	}
+
+	preferences, err := s.repos.UserPreferences.ListPreferences(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing user preferences: %w", err)
+	}
+	records = make([]any, 0, len(preferences))
+	for _, p := range preferences {
+		records = append(records, backup.UserPreferencesRecord{
+			UserID:               p.UserID,
+			Locale:               p.Locale,
+			PrivateNotifications: p.PrivateNotifications,
+			EmailDigest:          p.EmailDigest,
+			Email:                p.Email,
+			DigestGroups:         p.DigestGroups,
+		})
+	}
+	if err := writeTable(writer, backup.TableUserPreferences, records); err != nil {
+		return err
+	}
+
+	settings, err := s.repos.GroupSettings.ListSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing group settings: %w", err)
+	}
+	if err := writeTable(writer, backup.TableGroupSettings, toRecords(settings)); err != nil {
+		return err
+	}
+
+	audits, err := s.repos.PurgeAudits.ListAllPurges(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing purge audits: %w", err)
+	}
+	if err := writeTable(writer, backup.TablePurgeAudits, toRecords(audits)); err != nil {
+		return err
+	}
+
+	bundles, err := s.repos.KeyBundles.ListAllBundles(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing key bundles: %w", err)
+	}
+	if err := writeTable(writer, backup.TableKeyBundles, toRecords(bundles)); err != nil {
+		return err
+	}
+
+	accesses, err := s.repos.AccessAudits.ListAllAccesses(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing access audits: %w", err)
+	}
+	if err := writeTable(writer, backup.TableAccessAudits, toRecords(accesses)); err != nil {
+		return err
+	}
+
+	// Revocations that expired before the backup deny tokens that have expired as well
+	revocations, err := s.revocations.ListRevocations(ctx, writer.Manifest().CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error listing token revocations: %w", err)
+	}
+	if err := writeTable(writer, backup.TableTokenRevocations, toRecords(revocations)); err != nil {
+		return err
+	}
+
+	s.logger.Info("Backup complete", "tables", len(writer.Manifest().Tables))
+	return nil
+}
+
+// backupMessages exports the messages of every group, newest first. With an archive it continues every
+// group's timeline into the archive, and also exports the groups whose messages are all archived.
+func (s *backupService) backupMessages(ctx context.Context, writer *backup.Writer, takenAt time.Time) error {
+	groupIDs, err := s.repos.Messages.ListGroupIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing groups: %w", err)
+	}
+	if s.repos.Archive != nil {
+		archived, err := s.repos.Archive.GroupIDs(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing archived groups: %w", err)
+		}
+		for _, groupID := range archived {
+			if !slices.Contains(groupIDs, groupID) {
+				groupIDs = append(groupIDs, groupID)
+			}
+		}
+	}
+
+	for _, groupID := range groupIDs {
+		var manifest *repositories.ArchiveManifest
+		if s.repos.Archive != nil {
+			if manifest, err = s.repos.Archive.Manifest(ctx, groupID); err != nil {
+				return fmt.Errorf("error reading archive of group %s: %w", groupID, err)
+			}
+		}
+
+		query := models.RetentionQuery{Before: takenAt, Limit: s.config.BatchSize}
+		for {
+			batch, err := s.repos.Messages.ListExpiredMessages(ctx, groupID, query)
+			if err != nil {
+				return fmt.Errorf("error listing messages of group %s: %w", groupID, err)
+			}
+			if len(batch) == 0 {
+				break
+			}
+			for _, message := range batch {
+				// Hot copies of archived messages are left over from an interrupted archive run
+				if manifest != nil && manifest.Covers(models.MessageCursor{SentAt: message.SentAt, MessageID: message.ID}) {
+					continue
+				}
+				message.ETag = ""
+				if err := writer.Add(message); err != nil {
+					return err
+				}
+			}
+			last := batch[len(batch)-1]
+			query.Position = &models.MessageCursor{SentAt: last.SentAt, MessageID: last.ID}
+		}
+
+		if manifest == nil || manifest.NewestMessageID == uuid.Nil {
+			continue
+		}
+		var before *models.MessageCursor
+		for {
+			batch, err := s.repos.Archive.Older(ctx, groupID, manifest, before, s.config.BatchSize)
+			if err != nil {
+				return fmt.Errorf("error reading archived messages of group %s: %w", groupID, err)
+			}
+			if len(batch) == 0 {
+				break
+			}
+			for _, message := range batch {
+				if err := writer.Add(message); err != nil {
+					return err
+				}
+			}
+			last := batch[len(batch)-1]
+			before = &models.MessageCursor{SentAt: last.SentAt, MessageID: last.ID}
+		}
+	}
+	return nil
+}
+
+func tokenRecord(token models.FCMToken) (backup.FCMTokenRecord, error) {
+	groupID, err := uuid.Parse(token.PartitionKey)
+	if err != nil {
+		return backup.FCMTokenRecord{}, fmt.Errorf("invalid group ID %q of token: %w", token.PartitionKey, err)
+	}
+	userID, err := uuid.Parse(token.RowKey)
+	if err != nil {
+		return backup.FCMTokenRecord{}, fmt.Errorf("invalid user ID %q of token: %w", token.RowKey, err)
+	}
+	record := backup.FCMTokenRecord{GroupID: groupID, UserID: userID, Token: token.Token, Locale: token.Locale}
+	if token.Timestamp != nil {
+		record.UpdatedAt = token.Timestamp.AsTime()
+	}
+	return record, nil
+}
+
+func toRecords[T any](items []T) []any {
+	records := make([]any, 0, len(items))
+	for _, item := range items {
+		records = append(records, item)
+	}
+	return records
+}
+
+func writeTable(writer *backup.Writer, name string, records []any) error {
+	if err := writer.BeginTable(name); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := writer.Add(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore writes the records of the backup that are missing from storage. It never overwrites data that is
+// stored: messages and audits are matched on their ID, tokens and key bundles on their user or device,
+// and preferences and settings are only restored where none were saved. Restoring a backup twice is safe.
+// A failure in one table does not stop the others; the failures are returned together.
+func (s *backupService) Restore(ctx context.Context, reader *backup.Reader, options RestoreOptions) ([]models.RestoreReport, error) {
+	restorers := map[string]func(ctx context.Context, record json.RawMessage, options RestoreOptions, stored storedKeys) (bool, error){
+		backup.TableMessages:         s.restoreMessage,
+		backup.TableFCMTokens:        s.restoreToken,
+		backup.TableUserPreferences:  s.restorePreferences,
+		backup.TableGroupSettings:    s.restoreSettings,
+		backup.TablePurgeAudits:      s.restorePurgeAudit,
+		backup.TableKeyBundles:       s.restoreKeyBundle,
+		backup.TableAccessAudits:     s.restoreAccessAudit,
+		backup.TableTokenRevocations: s.restoreRevocation,
+	}
+
+	var reports []models.RestoreReport
+	var errs []error
+	for _, table := range backup.Tables {
+		if len(options.Tables) > 0 && !slices.Contains(options.Tables, table) {
+			continue
+		}
+		if options.GroupID != uuid.Nil && (table == backup.TableUserPreferences || table == backup.TableTokenRevocations) {
+			continue
+		}
+
+		report := models.RestoreReport{Table: table}
+		restore := restorers[table]
+		stored := storedKeys{}
+		err := reader.ReadTable(table, func(record json.RawMessage) error {
+			restored, err := restore(ctx, record, options, stored)
+			if err != nil {
+				return err
+			}
+			if restored {
+				report.Restored++
+			} else {
+				report.Skipped++
+			}
+			return nil
+		})
+		reports = append(reports, report)
+		if err != nil {
+			s.logger.Error("Failed to restore table", "table", table, "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	s.logger.Info("Restore complete", "groupID", options.GroupID, "tables", len(reports))
+	return reports, errors.Join(errs...)
+}
+
+// storedKeys caches the keys of the stored records of a table per group, so that a restore lists the
+// records of every group once instead of once per restored record
+type storedKeys map[uuid.UUID]map[string]bool
+
+// contains reports whether a record with the key is stored in the group. The first lookup of a group lists
+// its keys.
+func (k storedKeys) contains(groupID uuid.UUID, key string, list func() ([]string, error)) (bool, error) {
+	keys, ok := k[groupID]
+	if !ok {
+		listed, err := list()
+		if err != nil {
+			return false, err
+		}
+		keys = make(map[string]bool, len(listed))
+		for _, listedKey := range listed {
+			keys[listedKey] = true
+		}
+		k[groupID] = keys
+	}
+	return keys[key], nil
+}
+
+// add records that a record with the key was restored into the group
+func (k storedKeys) add(groupID uuid.UUID, key string) {
+	if keys, ok := k[groupID]; ok {
+		keys[key] = true
+	}
+}
+
+// inScope reports whether a record of the group is part of the restore
+func (o RestoreOptions) inScope(groupID uuid.UUID) bool {
+	return o.GroupID == uuid.Nil || o.GroupID == groupID
+}
+
+func (s *backupService) restoreMessage(ctx context.Context, record json.RawMessage, options RestoreOptions, _ storedKeys) (bool, error) {
+	var message models.Message
+	if err := json.Unmarshal(record, &message); err != nil {
+		return false, fmt.Errorf("invalid message: %w", err)
+	}
+	if !options.inScope(message.GroupID) || (!options.Until.IsZero() && !message.SentAt.Before(options.Until)) {
+		return false, nil
+	}
+
+	if s.repos.Archive != nil {
+		manifest, err := s.repos.Archive.Manifest(ctx, message.GroupID)
+		if err != nil {
+			return false, fmt.Errorf("error reading archive of group %s: %w", message.GroupID, err)
+		}
+		if manifest != nil && manifest.Covers(models.MessageCursor{SentAt: message.SentAt, MessageID: message.ID}) {
+			archived, err := s.repos.Archive.Contains(ctx, message.GroupID, manifest, message)
+			if err != nil {
+				return false, fmt.Errorf("error looking up archived message %s: %w", message.ID, err)
+			}
+			if archived {
+				return false, nil
+			}
+		}
+	}
+
+	_, err := s.repos.Messages.GetMessageByID(ctx, message.GroupID, message.ID)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, repositories.ErrNotFound) {
+		return false, fmt.Errorf("error looking up message %s: %w", message.ID, err)
+	}
+	if err := s.repos.Messages.CreateMessage(ctx, message.GroupID, &message); err != nil {
+		return false, fmt.Errorf("error restoring message %s: %w", message.ID, err)
+	}
+	return true, nil
+}
+
+func (s *backupService) restoreToken(ctx context.Context, record json.RawMessage, options RestoreOptions, stored storedKeys) (bool, error) {
+	var token backup.FCMTokenRecord
+	if err := json.Unmarshal(record, &token); err != nil {
+		return false, fmt.Errorf("invalid token: %w", err)
+	}
+	if !options.inScope(token.GroupID) {
+		return false, nil
+	}
+
+	exists, err := stored.contains(token.GroupID, token.UserID.String(), func() ([]string, error) {
+		tokens, err := s.repos.FCMTokens.GetGroupMemberTokens(ctx, token.GroupID)
+		if err != nil {
+			return nil, fmt.Errorf("error listing tokens of group %s: %w", token.GroupID, err)
+		}
+		keys := make([]string, 0, len(tokens))
+		for _, existing := range tokens {
+			keys = append(keys, existing.RowKey)
+		}
+		return keys, nil
+	})
+	if err != nil || exists {
+		return false, err
+	}
+	if err := s.repos.FCMTokens.SaveToken(ctx, token.GroupID, token.UserID, token.Token, token.Locale); err != nil {
+		return false, fmt.Errorf("error restoring token of user %s: %w", token.UserID, err)
+	}
+	stored.add(token.GroupID, token.UserID.String())
+	return true, nil
+}
+
+func (s *backupService) restorePreferences(ctx context.Context, record json.RawMessage, _ RestoreOptions, _ storedKeys) (bool, error) {
+	var preferences backup.UserPreferencesRecord
+	if err := json.Unmarshal(record, &preferences); err != nil {
+		return false, fmt.Errorf("invalid user preferences: %w", err)
+	}
+
+	stored, err := s.repos.UserPreferences.GetPreferences(ctx, preferences.UserID)
+	if err != nil {
+		return false, fmt.Errorf("error getting preferences of user %s: %w", preferences.UserID, err)
+	}
+	if stored.Locale != "" || stored.PrivateNotifications || stored.EmailDigest || stored.Email != "" ||
+		len(stored.DigestGroups) > 0 {
+		return false, nil
+	}
+
+	digestGroups := preferences.DigestGroups
+	if len(digestGroups) == 0 && preferences.DigestGroupID != nil {
+		digestGroups = map[uuid.UUID]time.Time{*preferences.DigestGroupID: {}}
+		if preferences.LastDigestAt != nil {
+			digestGroups[*preferences.DigestGroupID] = *preferences.LastDigestAt
+		}
+	}
+	err = s.repos.UserPreferences.SavePreferences(ctx, &models.UserPreferences{
+		UserID:               preferences.UserID,
+		Locale:               preferences.Locale,
+		PrivateNotifications: preferences.PrivateNotifications,
+		EmailDigest:          preferences.EmailDigest,
+		Email:                preferences.Email,
+		DigestGroups:         digestGroups,
+	})
+	if err != nil {
+		return false, fmt.Errorf("error restoring preferences of user %s: %w", preferences.UserID, err)
+	}
+	return true, nil
+}
+
+func (s *backupService) restoreSettings(ctx context.Context, record json.RawMessage, options RestoreOptions, _ storedKeys) (bool, error) {
+	var settings models.GroupSettings
+	if err := json.Unmarshal(record, &settings); err != nil {
+		return false, fmt.Errorf("invalid group settings: %w", err)
+	}
+	if !options.inScope(settings.GroupID) {
+		return false, nil
+	}
+
+	stored, err := s.repos.GroupSettings.GetSettings(ctx, settings.GroupID)
+	if err != nil {
+		return false, fmt.Errorf("error getting settings of group %s: %w", settings.GroupID, err)
+	}
+	if *stored != (models.GroupSettings{GroupID: settings.GroupID}) {
+		return false, nil
+	}
+	if err := s.repos.GroupSettings.SaveSettings(ctx, &settings); err != nil {
+		return false, fmt.Errorf("error restoring settings of group %s: %w", settings.GroupID, err)
+	}
+	return true, nil
+}
+
+func (s *backupService) restorePurgeAudit(ctx context.Context, record json.RawMessage, options RestoreOptions, stored storedKeys) (bool, error) {
+	var audit models.PurgeAudit
+	if err := json.Unmarshal(record, &audit); err != nil {
+		return false, fmt.Errorf("invalid purge audit: %w", err)
+	}
+	if !options.inScope(audit.GroupID) {
+		return false, nil
+	}
+
+	exists, err := stored.contains(audit.GroupID, audit.ID.String(), func() ([]string, error) {
+		audits, err := s.repos.PurgeAudits.ListPurges(ctx, audit.GroupID)
+		if err != nil {
+			return nil, fmt.Errorf("error listing purges of group %s: %w", audit.GroupID, err)
+		}
+		keys := make([]string, 0, len(audits))
+		for _, existing := range audits {
+			keys = append(keys, existing.ID.String())
+		}
+		return keys, nil
+	})
+	if err != nil || exists {
+		return false, err
+	}
+	if err := s.repos.PurgeAudits.RecordPurge(ctx, &audit); err != nil {
+		return false, fmt.Errorf("error restoring purge audit %s: %w", audit.ID, err)
+	}
+	stored.add(audit.GroupID, audit.ID.String())
+	return true, nil
+}
+
+func (s *backupService) restoreAccessAudit(ctx context.Context, record json.RawMessage, options RestoreOptions, stored storedKeys) (bool, error) {
+	var audit models.AccessAudit
+	if err := json.Unmarshal(record, &audit); err != nil {
+		return false, fmt.Errorf("invalid access audit: %w", err)
+	}
+	if !options.inScope(audit.GroupID) {
+		return false, nil
+	}
+
+	exists, err := stored.contains(audit.GroupID, audit.ID.String(), func() ([]string, error) {
+		audits, err := s.repos.AccessAudits.ListAccesses(ctx, audit.GroupID)
+		if err != nil {
+			return nil, fmt.Errorf("error listing accesses of group %s: %w", audit.GroupID, err)
+		}
+		keys := make([]string, 0, len(audits))
+		for _, existing := range audits {
+			keys = append(keys, existing.ID.String())
+		}
+		return keys, nil
+	})
+	if err != nil || exists {
+		return false, err
+	}
+	if err := s.repos.AccessAudits.RecordAccess(ctx, &audit); err != nil {
+		return false, fmt.Errorf("error restoring access audit %s: %w", audit.ID, err)
+	}
+	stored.add(audit.GroupID, audit.ID.String())
+	return true, nil
+}
+
+func (s *backupService) restoreKeyBundle(ctx context.Context, record json.RawMessage, options RestoreOptions, stored storedKeys) (bool, error) {
+	var bundle models.KeyBundle
+	if err := json.Unmarshal(record, &bundle); err != nil {
+		return false, fmt.Errorf("invalid key bundle: %w", err)
+	}
+	if !options.inScope(bundle.GroupID) {
+		return false, nil
+	}
+
+	exists, err := stored.contains(bundle.GroupID, bundleKey(bundle.UserID, bundle.DeviceID), func() ([]string, error) {
+		bundles, err := s.repos.KeyBundles.ListBundles(ctx, bundle.GroupID)
+		if err != nil {
+			return nil, fmt.Errorf("error listing key bundles of group %s: %w", bundle.GroupID, err)
+		}
+		keys := make([]string, 0, len(bundles))
+		for _, existing := range bundles {
+			keys = append(keys, bundleKey(existing.UserID, existing.DeviceID))
+		}
+		return keys, nil
+	})
+	if err != nil || exists {
+		return false, err
+	}
+	// One-time pre-keys are not backed up: a pre-key that was handed out before must not be handed out again
+	bundle.OneTimePreKeys = nil
+	if err := s.repos.KeyBundles.SaveBundle(ctx, &bundle); err != nil {
+		return false, fmt.Errorf("error restoring key bundle of user %s: %w", bundle.UserID, err)
+	}
+	stored.add(bundle.GroupID, bundleKey(bundle.UserID, bundle.DeviceID))
+	return true, nil
+}
+
+// restoreRevocation restores a revocation that is still in force and not stored yet. Revocations belong to no
+// group, so they are all kept under the nil group ID.
+func (s *backupService) restoreRevocation(ctx context.Context, record json.RawMessage, _ RestoreOptions, stored storedKeys) (bool, error) {
+	var revocation models.TokenRevocation
+	if err := json.Unmarshal(record, &revocation); err != nil {
+		return false, fmt.Errorf("invalid token revocation: %w", err)
+	}
+	now := time.Now()
+	if !revocation.ExpiresAt.After(now) {
+		return false, nil
+	}
+
+	key := string(revocation.Kind) + "/" + revocation.ID
+	exists, err := stored.contains(uuid.Nil, key, func() ([]string, error) {
+		revocations, err := s.revocations.ListRevocations(ctx, now)
+		if err != nil {
+			return nil, fmt.Errorf("error listing token revocations: %w", err)
+		}
+		keys := make([]string, 0, len(revocations))
+		for _, existing := range revocations {
+			keys = append(keys, string(existing.Kind)+"/"+existing.ID)
+		}
+		return keys, nil
+	})
+	if err != nil || exists {
+		return false, err
+	}
+	if err := s.revocations.Revoke(ctx, &revocation); err != nil {
+		return false, fmt.Errorf("error restoring revocation of %s %s: %w", revocation.Kind, revocation.ID, err)
+	}
+	stored.add(uuid.Nil, key)
+	return true, nil
+}
+
+// bundleKey identifies the key bundle of one device of a user
+func bundleKey(userID uuid.UUID, deviceID string) string {
+	return userID.String() + "/" + deviceID
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/backup"
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBackup(t *testing.T, service BackupService) *backup.Reader {
+	path := filepath.Join(t.TempDir(), "backup.tar.gz")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	writer := backup.NewWriter(file, "", time.Now())
+	require.NoError(t, service.Backup(context.Background(), writer))
+	require.NoError(t, writer.Close())
+	require.NoError(t, file.Close())
+
+	reader, err := backup.Open(path)
+	require.NoError(t, err)
+	return reader
+}
+
+func reportOf(reports []models.RestoreReport, table string) models.RestoreReport {
+	for _, report := range reports {
+		if report.Table == table {
+			return report
+		}
+	}
+	return models.RestoreReport{Table: table}
+}
+
+func TestBackupServiceWithStorageBackends(t *testing.T) {
+	forEachStorageBackend(t, func(t *testing.T, repos *repositories.Repositories) {
+		ctx := context.Background()
+		service := NewBackupService(repos, repositories.NewMemoryTokenRevocationRepository(), BackupConfig{BatchSize: 2}, util.NewLoggerFactory())
+		now := time.Now().UTC().Truncate(time.Second)
+
+		purgedGroup := uuid.New()
+		otherGroup := uuid.New()
+		userID := uuid.New()
+		var purged []models.Message
+		for i, content := range []string{"eerste", "tweede", "derde"} {
+			message := models.Message{ID: uuid.New(), GroupID: purgedGroup, SenderID: userID, SenderName: "Anna",
+				Content: content, SentAt: now.Add(time.Duration(i-10) * time.Hour)}
+			require.NoError(t, repos.Messages.CreateMessage(ctx, purgedGroup, &message))
+			purged = append(purged, message)
+		}
+		_, err := repos.Messages.ToggleMessagePin(ctx, purgedGroup, purged[0].ID, "")
+		require.NoError(t, err)
+		other := models.Message{ID: uuid.New(), GroupID: otherGroup, SenderID: userID, SenderName: "Anna",
+			Content: "andere groep", SentAt: now.Add(-time.Hour)}
+		require.NoError(t, repos.Messages.CreateMessage(ctx, otherGroup, &other))
+
+		require.NoError(t, repos.FCMTokens.SaveToken(ctx, purgedGroup, userID, "device-token", "nl"))
+		require.NoError(t, repos.GroupSettings.SaveSettings(ctx, &models.GroupSettings{GroupID: purgedGroup, RetentionDays: 7}))
+		require.NoError(t, repos.UserPreferences.SavePreferences(ctx, &models.UserPreferences{UserID: userID, Locale: "nl"}))
+		require.NoError(t, repos.KeyBundles.SaveBundle(ctx, &models.KeyBundle{GroupID: purgedGroup, UserID: userID,
+			DeviceID: "phone", IdentityKey: "identity", UpdatedAt: now}))
+
+		reader := writeBackup(t, service)
+		table, ok := reader.Manifest().Table(backup.TableMessages)
+		require.True(t, ok)
+		assert.GreaterOrEqual(t, table.Records, 4)
+
+		// An accidental purge of one group, and a deliberate deletion in another
+		require.NoError(t, repos.Messages.DeleteMessages(ctx, purgedGroup, purged))
+		require.NoError(t, repos.Messages.DeleteMessages(ctx, otherGroup, []models.Message{other}))
+
+		t.Run("Restores one group and leaves the others alone", func(t *testing.T) {
+			reports, err := service.Restore(ctx, reader, RestoreOptions{GroupID: purgedGroup})
+			require.NoError(t, err)
+			assert.Equal(t, 3, reportOf(reports, backup.TableMessages).Restored)
+			assert.Zero(t, reportOf(reports, backup.TableUserPreferences).Restored, "preferences belong to no group")
+
+			for _, message := range purged {
+				stored, err := repos.Messages.GetMessageByID(ctx, purgedGroup, message.ID)
+				require.NoError(t, err)
+				assert.Equal(t, message.Content, stored.Content)
+				assert.True(t, message.SentAt.Equal(stored.SentAt))
+				assert.Equal(t, message.ID == purged[0].ID, stored.IsPinned)
+			}
+			_, err = repos.Messages.GetMessageByID(ctx, otherGroup, other.ID)
+			assert.ErrorIs(t, err, repositories.ErrNotFound)
+		})
+
+		t.Run("Restoring again writes nothing", func(t *testing.T) {
+			reports, err := service.Restore(ctx, reader, RestoreOptions{GroupID: purgedGroup})
+			require.NoError(t, err)
+			for _, report := range reports {
+				assert.Zero(t, report.Restored, report.Table)
+			}
+		})
+
+		t.Run("Restores only messages sent before a time", func(t *testing.T) {
+			reports, err := service.Restore(ctx, reader, RestoreOptions{GroupID: otherGroup, Until: other.SentAt,
+				Tables: []string{backup.TableMessages}})
+			require.NoError(t, err)
+			require.Len(t, reports, 1)
+			assert.Zero(t, reports[0].Restored)
+
+			_, err = repos.Messages.GetMessageByID(ctx, otherGroup, other.ID)
+			assert.ErrorIs(t, err, repositories.ErrNotFound)
+		})
+	})
+}
+
+func TestBackupIncludesArchivedMessages(t *testing.T) {
+	ctx := context.Background()
+	repos := repositories.NewMemoryRepositories()
+	repos.Archive = repositories.NewMessageArchive(repositories.NewFileArchiveStore(t.TempDir()))
+	service := NewBackupService(repos, repositories.NewMemoryTokenRevocationRepository(), BackupConfig{BatchSize: 2}, util.NewLoggerFactory())
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// The first group has recent messages in the hot store and old ones in the archive, one of which is left
+	// over in the hot store by an interrupted archive run. The second group only has archived messages.
+	mixedGroup := uuid.New()
+	archivedGroup := uuid.New()
+	var old []models.Message
+	for i, groupID := range []uuid.UUID{mixedGroup, mixedGroup, mixedGroup, archivedGroup} {
+		message := models.Message{ID: uuid.New(), GroupID: groupID, SenderID: uuid.New(), SenderName: "Anna",
+			Content: "oud", SentAt: now.AddDate(-2, 0, i)}
+		require.NoError(t, repos.Archive.AddMessages(ctx, groupID, []models.Message{message}))
+		require.NoError(t, repos.Archive.AdvanceWatermark(ctx, groupID, message))
+		old = append(old, message)
+	}
+	leftover := old[2]
+	require.NoError(t, repos.Messages.CreateMessage(ctx, mixedGroup, &leftover))
+	recent := models.Message{ID: uuid.New(), GroupID: mixedGroup, SenderID: uuid.New(), SenderName: "Anna",
+		Content: "nieuw", SentAt: now.Add(-time.Hour)}
+	require.NoError(t, repos.Messages.CreateMessage(ctx, mixedGroup, &recent))
+
+	reader := writeBackup(t, service)
+	table, ok := reader.Manifest().Table(backup.TableMessages)
+	require.True(t, ok)
+	assert.Equal(t, 5, table.Records, "every message once, including the groups that are only archived")
+
+	// An accidental purge that reached the archive
+	for _, message := range old[:2] {
+		require.NoError(t, repos.Archive.RemoveMessages(ctx, mixedGroup, archiveMonthOf(message), []models.Message{message}))
+	}
+
+	reports, err := service.Restore(ctx, reader, RestoreOptions{GroupID: mixedGroup})
+	require.NoError(t, err)
+	report := reportOf(reports, backup.TableMessages)
+	assert.Equal(t, 2, report.Restored, "the purged archived messages are restored")
+	assert.Equal(t, 3, report.Skipped, "messages that are still stored or archived, and the other group, are skipped")
+	for _, message := range old[:2] {
+		_, err := repos.Messages.GetMessageByID(ctx, mixedGroup, message.ID)
+		assert.NoError(t, err, "restored archived messages wait in the hot store for the next archive run")
+	}
+}
+
+func TestRestoreIntoEmptyStorage(t *testing.T) {
+	ctx := context.Background()
+	source := repositories.NewMemoryRepositories()
+	groupID := uuid.New()
+	userID := uuid.New()
+	lastDigest := time.Now().UTC().Truncate(time.Second)
+
+	message := models.Message{ID: uuid.New(), GroupID: groupID, SenderID: userID, SenderName: "Anna",
+		Content: "ciphertext", SentAt: lastDigest.Add(-time.Hour),
+		Envelopes: []models.KeyEnvelope{{RecipientID: userID, DeviceID: "phone", Ciphertext: "a2V5"}}}
+	require.NoError(t, source.Messages.CreateMessage(ctx, groupID, &message))
+	require.NoError(t, source.FCMTokens.SaveToken(ctx, groupID, userID, "device-token", "nl"))
+	require.NoError(t, source.UserPreferences.SavePreferences(ctx, &models.UserPreferences{UserID: userID, Locale: "nl",
+		EmailDigest: true, Email: "anna@example.com", DigestGroups: map[uuid.UUID]time.Time{groupID: lastDigest}}))
+	require.NoError(t, source.GroupSettings.SaveSettings(ctx, &models.GroupSettings{GroupID: groupID, EndToEndEncrypted: true}))
+	require.NoError(t, source.PurgeAudits.RecordPurge(ctx, &models.PurgeAudit{ID: uuid.New(), RunID: uuid.New(),
+		GroupID: groupID, PurgedAt: lastDigest, Cutoff: lastDigest, MessageIDs: []uuid.UUID{uuid.New()}}))
+	require.NoError(t, source.KeyBundles.SaveBundle(ctx, &models.KeyBundle{GroupID: groupID, UserID: userID,
+		DeviceID: "phone", IdentityKey: "identity", OneTimePreKeys: []models.PreKey{{KeyID: 1, PublicKey: "b25l"}}}))
+
+	require.NoError(t, source.AccessAudits.RecordAccess(ctx, &models.AccessAudit{ID: uuid.New(), GroupID: groupID,
+		UserID: uuid.New(), Role: models.RoleHealthcareProfessional, Method: "GET", Route: "/groups/messages",
+		Status: 200, AccessedAt: lastDigest}))
+
+	sourceRevocations := repositories.NewMemoryTokenRevocationRepository()
+	revocation := models.TokenRevocation{Kind: models.RevokeSession, ID: "session-1", RevokedBy: uuid.NewString(),
+		RevokedAt: lastDigest, ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Second)}
+	require.NoError(t, sourceRevocations.Revoke(ctx, &revocation))
+	require.NoError(t, sourceRevocations.Revoke(ctx, &models.TokenRevocation{Kind: models.RevokeToken, ID: "expired",
+		RevokedBy: uuid.NewString(), RevokedAt: lastDigest, ExpiresAt: time.Now().Add(-time.Minute)}))
+
+	reader := writeBackup(t, NewBackupService(source, sourceRevocations, BackupConfig{BatchSize: 10}, util.NewLoggerFactory()))
+
+	target := repositories.NewMemoryRepositories()
+	targetRevocations := repositories.NewMemoryTokenRevocationRepository()
+	reports, err := NewBackupService(target, targetRevocations, BackupConfig{}, util.NewLoggerFactory()).Restore(ctx, reader, RestoreOptions{})
+	require.NoError(t, err)
+	for _, table := range backup.Tables {
+		assert.Equal(t, 1, reportOf(reports, table).Restored, table)
+	}
+
+	stored, err := target.Messages.GetMessageByID(ctx, groupID, message.ID)
+	require.NoError(t, err)
+	assert.Equal(t, message.Envelopes, stored.Envelopes)
+
+	tokens, err := target.FCMTokens.GetGroupMemberTokens(ctx, groupID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, "device-token", tokens[0].Token)
+
+	preferences, err := target.UserPreferences.GetPreferences(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, preferences.DigestGroups, 1)
+	assert.True(t, lastDigest.Equal(preferences.DigestGroups[groupID]))
+
+	settings, err := target.GroupSettings.GetSettings(ctx, groupID)
+	require.NoError(t, err)
+	assert.True(t, settings.EndToEndEncrypted)
+
+	audits, err := target.PurgeAudits.ListPurges(ctx, groupID)
+	require.NoError(t, err)
+	assert.Len(t, audits, 1)
+
+	accesses, err := target.AccessAudits.ListAccesses(ctx, groupID)
+	require.NoError(t, err)
+	assert.Len(t, accesses, 1)
+
+	preKey, err := target.KeyBundles.ClaimPreKey(ctx, groupID, userID, "phone")
+	require.NoError(t, err)
+	assert.Nil(t, preKey, "one-time pre-keys are not restored")
+
+	revocations, err := targetRevocations.ListRevocations(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []models.TokenRevocation{revocation}, revocations, "revocations in force are restored, expired ones are not backed up")
+}
+
+func TestRestorePreferencesOfEarlierBackups(t *testing.T) {
+	ctx := context.Background()
+	target := repositories.NewMemoryRepositories()
+	service := NewBackupService(target, repositories.NewMemoryTokenRevocationRepository(), BackupConfig{}, util.NewLoggerFactory()).(*backupService)
+	userID, groupID := uuid.New(), uuid.New()
+	lastDigest := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Backups made before digests covered several groups have a single digest group
+	record := fmt.Sprintf(`{"userId": %q, "emailDigest": true, "email": "anna@example.com", "digestGroupId": %q, "lastDigestAt": %q}`,
+		userID, groupID, lastDigest.Format(time.RFC3339))
+	restored, err := service.restorePreferences(ctx, json.RawMessage(record), RestoreOptions{}, storedKeys{})
+	require.NoError(t, err)
+	assert.True(t, restored)
+
+	preferences, err := target.UserPreferences.GetPreferences(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, map[uuid.UUID]time.Time{groupID: lastDigest}, preferences.DigestGroups)
+}
+
+// countingPurgeAudits counts how often the purges of a group are listed
+type countingPurgeAudits struct {
+	repositories.PurgeAuditRepository
+	lists int
+}
+
+func (r *countingPurgeAudits) ListPurges(ctx context.Context, groupID uuid.UUID) ([]models.PurgeAudit, error) {
+	r.lists++
+	return r.PurgeAuditRepository.ListPurges(ctx, groupID)
+}
+
+func TestRestoreListsEveryGroupOnce(t *testing.T) {
+	ctx := context.Background()
+	source := repositories.NewMemoryRepositories()
+	groupID := uuid.New()
+	existing := models.PurgeAudit{ID: uuid.New(), RunID: uuid.New(), GroupID: groupID, PurgedAt: time.Now().UTC()}
+	require.NoError(t, source.PurgeAudits.RecordPurge(ctx, &existing))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, source.PurgeAudits.RecordPurge(ctx, &models.PurgeAudit{ID: uuid.New(), RunID: uuid.New(),
+			GroupID: groupID, PurgedAt: time.Now().UTC()}))
+	}
+	reader := writeBackup(t, NewBackupService(source, repositories.NewMemoryTokenRevocationRepository(), BackupConfig{BatchSize: 10},
+		util.NewLoggerFactory()))
+
+	target := repositories.NewMemoryRepositories()
+	require.NoError(t, target.PurgeAudits.RecordPurge(ctx, &existing))
+	purges := &countingPurgeAudits{PurgeAuditRepository: target.PurgeAudits}
+	target.PurgeAudits = purges
+
+	reports, err := NewBackupService(target, repositories.NewMemoryTokenRevocationRepository(), BackupConfig{},
+		util.NewLoggerFactory()).Restore(ctx, reader,
+		RestoreOptions{Tables: []string{backup.TablePurgeAudits}})
+	require.NoError(t, err)
+	assert.Equal(t, models.RestoreReport{Table: backup.TablePurgeAudits, Restored: 5, Skipped: 1}, reportOf(reports, backup.TablePurgeAudits))
+	assert.Equal(t, 1, purges.lists, "the purges of the group are listed once, not once per record")
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"Groupchat-Service/internal/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Cursor errors returned to clients that send a cursor this service cannot use
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrCursorExpired = errors.New("cursor expired, reload the first page")
+)
+
+const (
+	cursorVersion = 1
+
+	// version, direction, sent at (unix nanoseconds), message ID, issued at (unix seconds)
+	cursorPayloadLength = 1 + 1 + 8 + 16 + 8
+	cursorMACLength     = 16
+)
+
+// CursorCodec encodes pagination positions as opaque tokens. Tokens are signed with HMAC-SHA256
+// over the group ID as well, so a cursor cannot be altered or replayed against another group.
+// Search cursors are also bound to the search text and cannot be used to list messages.
+type CursorCodec struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewCursorCodec creates a codec that accepts cursors for ttl after they were issued.
+// An empty secret generates a random one, which invalidates all cursors on restart and
+// does not work across multiple instances.
+func NewCursorCodec(secret string, ttl time.Duration) (*CursorCodec, error) {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("error generating cursor secret: %w", err)
+		}
+	}
+
+	return &CursorCodec{secret: key, ttl: ttl, now: time.Now}, nil
+}
+
+// Encode returns the cursor that continues from position in the given direction
+func (c *CursorCodec) Encode(groupID uuid.UUID, position models.MessageCursor, direction models.Direction) string {
+	return c.encode(listCursorScope, groupID, position, direction)
+}
+
+// Decode verifies a cursor issued for the group and returns its position and direction
+func (c *CursorCodec) Decode(groupID uuid.UUID, cursor string) (models.MessageCursor, models.Direction, error) {
+	return c.decode(listCursorScope, groupID, cursor)
+}
+
+// EncodeSearch returns the cursor that continues search results for text after position
+func (c *CursorCodec) EncodeSearch(groupID uuid.UUID, text string, position models.MessageCursor) string {
+	return c.encode(searchCursorScope(text), groupID, position, models.Next)
+}
+
+// DecodeSearch verifies a cursor issued for the same search in the group and returns its position
+func (c *CursorCodec) DecodeSearch(groupID uuid.UUID, text string, cursor string) (models.MessageCursor, error) {
+	position, _, err := c.decode(searchCursorScope(text), groupID, cursor)
+	return position, err
+}
+
+const listCursorScope = "cursor:"
+
+func searchCursorScope(text string) string {
+	return "search:" + text
+}
+
+func (c *CursorCodec) encode(scope string, groupID uuid.UUID, position models.MessageCursor, direction models.Direction) string {
+	payload := make([]byte, cursorPayloadLength)
+	payload[0] = cursorVersion
+	if direction == models.Previous {
+		payload[1] = 1
+	}
+	binary.BigEndian.PutUint64(payload[2:10], uint64(position.SentAt.UnixNano()))
+	copy(payload[10:26], position.MessageID[:])
+	binary.BigEndian.PutUint64(payload[26:34], uint64(c.now().Unix()))
+
+	return base64.RawURLEncoding.EncodeToString(append(payload, c.sign(scope, groupID, payload)...))
+}
+
+func (c *CursorCodec) decode(scope string, groupID uuid.UUID, cursor string) (models.MessageCursor, models.Direction, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) != cursorPayloadLength+cursorMACLength {
+		return models.MessageCursor{}, "", ErrInvalidCursor
+	}
+
+	payload, mac := raw[:cursorPayloadLength], raw[cursorPayloadLength:]
+	if !hmac.Equal(mac, c.sign(scope, groupID, payload)) || payload[0] != cursorVersion || payload[1] > 1 {
+		return models.MessageCursor{}, "", ErrInvalidCursor
+	}
+
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(payload[26:34])), 0)
+	if c.ttl > 0 && c.now().Sub(issuedAt) > c.ttl {
+		return models.MessageCursor{}, "", ErrCursorExpired
+	}
+
+	direction := models.Next
+	if payload[1] == 1 {
+		direction = models.Previous
+	}
+
+	messageID, err := uuid.FromBytes(payload[10:26])
+	if err != nil {
+		return models.MessageCursor{}, "", ErrInvalidCursor
+	}
+
+	return models.MessageCursor{
+		SentAt:    time.Unix(0, int64(binary.BigEndian.Uint64(payload[2:10]))).UTC(),
+		MessageID: messageID,
+	}, direction, nil
+}
+
+// sign authenticates the scope, group and payload. The group ID and payload have a fixed length,
+// so a scope cannot be extended to forge a cursor for another scope.
+func (c *CursorCodec) sign(scope string, groupID uuid.UUID, payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(scope))
+	mac.Write(groupID[:])
+	mac.Write(payload)
+	return mac.Sum(nil)[:cursorMACLength]
+}
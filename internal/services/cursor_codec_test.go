@@ -0,0 +1,90 @@
+package services
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCursorCodec(t *testing.T) *CursorCodec {
+	codec, err := NewCursorCodec("test-secret", time.Hour)
+	require.NoError(t, err)
+	return codec
+}
+
+func TestCursorCodec(t *testing.T) {
+	groupID := uuid.New()
+	position := models.MessageCursor{
+		SentAt:    time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC),
+		MessageID: uuid.New(),
+	}
+
+	t.Run("Round trip keeps sub-second precision and direction", func(t *testing.T) {
+		codec := newTestCursorCodec(t)
+
+		for _, direction := range []models.Direction{models.Next, models.Previous} {
+			decoded, decodedDirection, err := codec.Decode(groupID, codec.Encode(groupID, position, direction))
+			require.NoError(t, err)
+			assert.Equal(t, position, decoded)
+			assert.Equal(t, direction, decodedDirection)
+		}
+	})
+
+	t.Run("Rejects tampered cursors", func(t *testing.T) {
+		codec := newTestCursorCodec(t)
+		cursor := codec.Encode(groupID, position, models.Next)
+
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		require.NoError(t, err)
+		raw[1] = 1 // flip the direction
+		tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+		otherCodec, err := NewCursorCodec("other-secret", time.Hour)
+		require.NoError(t, err)
+
+		for name, invalid := range map[string]string{
+			"garbage":       "not-a-cursor",
+			"message ID":    position.MessageID.String(),
+			"truncated":     cursor[:len(cursor)-4],
+			"modified":      tampered,
+			"other secret":  otherCodec.Encode(groupID, position, models.Next),
+			"other group":   codec.Encode(uuid.New(), position, models.Next),
+			"empty payload": "",
+		} {
+			_, _, err := codec.Decode(groupID, invalid)
+			assert.ErrorIs(t, err, ErrInvalidCursor, name)
+		}
+	})
+
+	t.Run("Search cursors only continue the same search", func(t *testing.T) {
+		codec := newTestCursorCodec(t)
+		cursor := codec.EncodeSearch(groupID, "wandelen", position)
+
+		decoded, err := codec.DecodeSearch(groupID, "wandelen", cursor)
+		require.NoError(t, err)
+		assert.Equal(t, position, decoded)
+
+		_, err = codec.DecodeSearch(groupID, "fietsen", cursor)
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+		_, _, err = codec.Decode(groupID, cursor)
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+		_, err = codec.DecodeSearch(groupID, "wandelen", codec.Encode(groupID, position, models.Next))
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("Rejects expired cursors", func(t *testing.T) {
+		codec := newTestCursorCodec(t)
+		issued := time.Now()
+		codec.now = func() time.Time { return issued }
+		cursor := codec.Encode(groupID, position, models.Next)
+
+		codec.now = func() time.Time { return issued.Add(2 * time.Hour) }
+		_, _, err := codec.Decode(groupID, cursor)
+		assert.ErrorIs(t, err, ErrCursorExpired)
+	})
+}
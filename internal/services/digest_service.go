@@ -0,0 +1,285 @@
+package services
+
+import (
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/search"
+	"Groupchat-Service/internal/tenant"
+	"Groupchat-Service/internal/util"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	NotificationTypeEmailDigest = "email_digest"
+
+	// maxDigestMessages is the number of most recent unread messages listed in a digest
+	maxDigestMessages = 20
+)
+
+// ErrInvalidUnsubscribeToken is returned for unsubscribe links that were not issued by this service
+var ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// DigestEmail is the data available to the email_digest templates
+type DigestEmail struct {
+	UnreadCount    int
+	Messages       []DigestMessage
+	MoreCount      int
+	IncludeContent bool
+	UnsubscribeURL string
+}
+
+type DigestMessage struct {
+	SenderName string
+	Content    string
+	SentAt     string
+}
+
+type DigestConfig struct {
+	PublicBaseURL     string
+	UnsubscribeSecret string
+}
+
+type digestService struct {
+	messageRepo       repositories.MessageRepository
+	preferencesRepo   repositories.UserPreferencesRepository
+	groupSettingsRepo repositories.GroupSettingsRepository
+	mailer            Mailer
+	templates         *TemplateCatalogue
+	config            DigestConfig
+	logger            util.Logger
+}
+
+func NewDigestService(
+	messageRepo repositories.MessageRepository,
+	preferencesRepo repositories.UserPreferencesRepository,
+	groupSettingsRepo repositories.GroupSettingsRepository,
+	mailer Mailer,
+	templates *TemplateCatalogue,
+	config DigestConfig,
+	loggerFactory util.LoggerFactory,
+) DigestService {
+	return &digestService{
+		messageRepo:       messageRepo,
+		preferencesRepo:   preferencesRepo,
+		groupSettingsRepo: groupSettingsRepo,
+		mailer:            mailer,
+		templates:         templates,
+		config:            config,
+		logger:            loggerFactory.NewLogger("DigestService"),
+	}
+}
+
+// StartDigestScheduler sends digests every interval until the context is cancelled
+func StartDigestScheduler(ctx context.Context, service DigestService, interval time.Duration, loggerFactory util.LoggerFactory) {
+	logger := loggerFactory.NewLogger("DigestScheduler")
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := service.SendDigests(ctx); err != nil {
+					logger.Error("Failed to send email digests", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// SendDigests emails every subscriber a summary per subscribed group of the messages they have not read yet.
+// A failure for one subscriber or group is logged and does not stop the others.
+func (s *digestService) SendDigests(ctx context.Context) error {
+	subscribers, err := s.preferencesRepo.ListDigestSubscribers(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing digest subscribers: %w", err)
+	}
+
+	runStart := time.Now().UTC()
+	sent := 0
+	for i := range subscribers {
+		subscriber := &subscribers[i]
+		if subscriber.Email == "" {
+			continue
+		}
+
+		groupIDs := slices.SortedFunc(maps.Keys(subscriber.DigestGroups), func(a, b uuid.UUID) int {
+			return strings.Compare(a.String(), b.String())
+		})
+		sentToSubscriber := 0
+		for _, groupID := range groupIDs {
+			ok, err := s.sendDigest(ctx, subscriber, groupID, runStart)
+			if err != nil {
+				s.logger.Error("Failed to send email digest", "userID", subscriber.UserID, "groupID", groupID, "error", err)
+				continue
+			}
+			if ok {
+				subscriber.DigestGroups[groupID] = runStart
+				sentToSubscriber++
+			}
+		}
+		if sentToSubscriber == 0 {
+			continue
+		}
+
+		sent += sentToSubscriber
+		if err := s.preferencesRepo.SavePreferences(ctx, subscriber); err != nil {
+			s.logger.Error("Failed to save last digest times", "userID", subscriber.UserID, "error", err)
+		}
+	}
+
+	s.logger.Info("Email digest run complete", "subscribers", len(subscribers), "sent", sent)
+	return nil
+}
+
+// sendDigest emails the subscriber the unread messages of one group. It reports whether a digest was sent.
+func (s *digestService) sendDigest(ctx context.Context, subscriber *models.UserPreferences, groupID uuid.UUID, runStart time.Time) (bool, error) {
+	// Start from the previous digest, or from the moment the user read the chat if that is later.
+	// GetLastReadTime reports the current time for users that never opened the chat, which is
+	// after runStart and therefore ignored.
+	since := subscriber.DigestGroups[groupID]
+	lastRead, err := s.messageRepo.GetLastReadTime(ctx, groupID, subscriber.UserID)
+	if err != nil {
+		return false, fmt.Errorf("error getting last read time: %w", err)
+	}
+	if lastRead.After(since) && lastRead.Before(runStart) {
+		since = lastRead
+	}
+
+	unread, err := s.messageRepo.CountUnreadMessages(ctx, groupID, since)
+	if err != nil {
+		return false, fmt.Errorf("error counting unread messages: %w", err)
+	}
+	if unread == 0 {
+		return false, nil
+	}
+
+	settings, err := s.groupSettingsRepo.GetSettings(ctx, groupID)
+	if err != nil {
+		return false, fmt.Errorf("error getting group settings: %w", err)
+	}
+
+	// The content of end-to-end encrypted groups is ciphertext the server cannot render
+	data := DigestEmail{
+		UnreadCount:    unread,
+		IncludeContent: !settings.DigestExcludeContent && !settings.EndToEndEncrypted,
+		UnsubscribeURL: s.unsubscribeURL(ctx, subscriber.UserID),
+	}
+
+	if data.IncludeContent {
+		messages, err := s.messageRepo.GetMessagesSince(ctx, groupID, since, maxDigestMessages)
+		if err != nil {
+			return false, fmt.Errorf("error getting unread messages: %w", err)
+		}
+		// Stored content is sanitized HTML, the digest is plain text
+		for _, message := range messages {
+			data.Messages = append(data.Messages, DigestMessage{
+				SenderName: message.SenderName,
+				Content:    strings.Join(strings.Fields(search.PlainText(message.Content)), " "),
+				SentAt:     message.SentAt.UTC().Format("2006-01-02 15:04 MST"),
+			})
+		}
+		data.MoreCount = unread - len(data.Messages)
+	}
+
+	subject, body, err := s.templates.Render(subscriber.Locale, NotificationTypeEmailDigest, data)
+	if err != nil {
+		return false, fmt.Errorf("error rendering digest: %w", err)
+	}
+
+	err = s.mailer.Send(Email{
+		To:      subscriber.Email,
+		Subject: subject,
+		Body:    body,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Unsubscribe turns off the email digest for the user the signed token was issued to. Links are followed
+// without an access token, so the tenant the link was issued for is taken from the token.
+func (s *digestService) Unsubscribe(ctx context.Context, token string) error {
+	tenantID, userID, err := s.parseUnsubscribeToken(token)
+	if err != nil {
+		return err
+	}
+	if tenantID != "" {
+		ctx = tenant.WithTenant(ctx, tenantID)
+	}
+
+	preferences, err := s.preferencesRepo.GetPreferences(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("error getting preferences: %w", err)
+	}
+
+	preferences.EmailDigest = false
+	preferences.DigestGroups = nil
+	if err := s.preferencesRepo.SavePreferences(ctx, preferences); err != nil {
+		return fmt.Errorf("error saving preferences: %w", err)
+	}
+
+	return nil
+}
+
+func (s *digestService) unsubscribeURL(ctx context.Context, userID uuid.UUID) string {
+	return strings.TrimSuffix(s.config.PublicBaseURL, "/") + "/digest/unsubscribe?token=" + url.QueryEscape(s.unsubscribeToken(ctx, userID))
+}
+
+// unsubscribeToken signs the user ID, and the tenant of ctx when there is one, so unsubscribe links work
+// without logging in but cannot be forged or moved to another tenant
+func (s *digestService) unsubscribeToken(ctx context.Context, userID uuid.UUID) string {
+	payload := base64.RawURLEncoding.EncodeToString(userID[:])
+	if tenantID, ok := tenant.FromContext(ctx); ok {
+		payload += ":" + tenantID
+	}
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload))
+}
+
+func (s *digestService) parseUnsubscribeToken(token string) (string, uuid.UUID, error) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return "", uuid.Nil, ErrInvalidUnsubscribeToken
+	}
+
+	decodedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(decodedSignature, s.sign(payload)) {
+		return "", uuid.Nil, ErrInvalidUnsubscribeToken
+	}
+
+	encodedUserID, tenantID, _ := strings.Cut(payload, ":")
+	rawUserID, err := base64.RawURLEncoding.DecodeString(encodedUserID)
+	if err != nil {
+		return "", uuid.Nil, ErrInvalidUnsubscribeToken
+	}
+
+	userID, err := uuid.FromBytes(rawUserID)
+	if err != nil {
+		return "", uuid.Nil, ErrInvalidUnsubscribeToken
+	}
+	return tenantID, userID, nil
+}
+
+func (s *digestService) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(s.config.UnsubscribeSecret))
+	mac.Write([]byte("digest-unsubscribe:" + payload))
+	return mac.Sum(nil)
+}
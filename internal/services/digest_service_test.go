@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/tenant"
+	"Groupchat-Service/internal/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMailer struct {
+	sent []Email
+}
+
+func (f *fakeMailer) Send(email Email) error {
+	f.sent = append(f.sent, email)
+	return nil
+}
+
+func setupDigestService(t *testing.T) (*digestService, *MockMessageRepository, *MockUserPreferencesRepository, *MockGroupSettingsRepository, *fakeMailer) {
+	templates, err := NewTemplateCatalogue("", "nl")
+	require.NoError(t, err)
+
+	messageRepo := new(MockMessageRepository)
+	preferencesRepo := new(MockUserPreferencesRepository)
+	settingsRepo := new(MockGroupSettingsRepository)
+	mailer := &fakeMailer{}
+
+	service := NewDigestService(
+		messageRepo,
+		preferencesRepo,
+		settingsRepo,
+		mailer,
+		templates,
+		DigestConfig{PublicBaseURL: "https://chat.example.com/", UnsubscribeSecret: "secret"},
+		util.NewLoggerFactory(),
+	).(*digestService)
+
+	return service, messageRepo, preferencesRepo, settingsRepo, mailer
+}
+
+func TestSendDigests(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	groupID := uuid.New()
+	lastDigest := time.Now().Add(-24 * time.Hour).UTC()
+
+	// SendDigests updates the last digest times of the subscribers it lists
+	newSubscriber := func() models.UserPreferences {
+		return models.UserPreferences{
+			UserID:       userID,
+			Locale:       "en",
+			EmailDigest:  true,
+			Email:        "anna@example.com",
+			DigestGroups: map[uuid.UUID]time.Time{groupID: lastDigest},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		excludeContent bool
+		unread         int
+		wantSent       bool
+		wantInBody     []string
+		wantNotInBody  []string
+	}{
+		{
+			name:          "Includes message content",
+			unread:        2,
+			wantSent:      true,
+			wantInBody:    []string{"2 unread messages", "Bram:", "Hoe gaat het?", "Anna's afspraak is morgen"},
+			wantNotInBody: []string{"more.", "&#39;", "<b>"},
+		},
+		{
+			name:           "Leaves out content when the group excludes it",
+			excludeContent: true,
+			unread:         2,
+			wantSent:       true,
+			wantInBody:     []string{"2 unread messages", "Open the app"},
+			wantNotInBody:  []string{"Hoe gaat het?"},
+		},
+		{
+			name:     "Skips subscribers without unread messages",
+			unread:   0,
+			wantSent: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, messageRepo, preferencesRepo, settingsRepo, mailer := setupDigestService(t)
+
+			preferencesRepo.On("ListDigestSubscribers", ctx).Return([]models.UserPreferences{newSubscriber()}, nil)
+			// A last read time in the future means the user never opened the chat
+			messageRepo.On("GetLastReadTime", ctx, groupID, userID).Return(time.Now().Add(time.Hour), nil)
+			messageRepo.On("CountUnreadMessages", ctx, groupID, lastDigest).Return(tt.unread, nil)
+			settingsRepo.On("GetSettings", ctx, groupID).
+				Return(&models.GroupSettings{GroupID: groupID, DigestExcludeContent: tt.excludeContent}, nil)
+			messageRepo.On("GetMessagesSince", ctx, groupID, lastDigest, maxDigestMessages).Return([]models.Message{
+				{SenderName: "Anna", Content: "Anna&#39;s <b>afspraak</b> is morgen", SentAt: lastDigest.Add(time.Hour)},
+				{SenderName: "Bram", Content: "Hoe gaat het?", SentAt: lastDigest.Add(2 * time.Hour)},
+			}, nil)
+			preferencesRepo.On("SavePreferences", ctx, mock.AnythingOfType("*models.UserPreferences")).Return(nil)
+
+			err := service.SendDigests(ctx)
+			assert.NoError(t, err)
+
+			if !tt.wantSent {
+				assert.Empty(t, mailer.sent)
+				preferencesRepo.AssertNotCalled(t, "SavePreferences", mock.Anything, mock.Anything)
+				return
+			}
+
+			require.Len(t, mailer.sent, 1)
+			email := mailer.sent[0]
+			assert.Equal(t, "anna@example.com", email.To)
+			assert.Contains(t, email.Headers["List-Unsubscribe"], "https://chat.example.com/digest/unsubscribe?token=")
+			for _, want := range tt.wantInBody {
+				assert.Contains(t, email.Body, want)
+			}
+			for _, unwanted := range tt.wantNotInBody {
+				assert.NotContains(t, email.Body, unwanted)
+			}
+			if tt.excludeContent {
+				messageRepo.AssertNotCalled(t, "GetMessagesSince", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+			preferencesRepo.AssertCalled(t, "SavePreferences", ctx, mock.MatchedBy(func(p *models.UserPreferences) bool {
+				return p.DigestGroups[groupID].After(lastDigest)
+			}))
+		})
+	}
+
+	t.Run("Sends a digest per subscribed group", func(t *testing.T) {
+		service, messageRepo, preferencesRepo, settingsRepo, mailer := setupDigestService(t)
+		otherGroupID := uuid.New()
+		subscriber := newSubscriber()
+		subscriber.DigestGroups[otherGroupID] = lastDigest
+
+		preferencesRepo.On("ListDigestSubscribers", ctx).Return([]models.UserPreferences{subscriber}, nil)
+		for _, id := range []uuid.UUID{groupID, otherGroupID} {
+			messageRepo.On("GetLastReadTime", ctx, id, userID).Return(time.Now().Add(time.Hour), nil)
+			messageRepo.On("CountUnreadMessages", ctx, id, lastDigest).Return(1, nil)
+			settingsRepo.On("GetSettings", ctx, id).
+				Return(&models.GroupSettings{GroupID: id, DigestExcludeContent: true}, nil)
+		}
+		preferencesRepo.On("SavePreferences", ctx, mock.AnythingOfType("*models.UserPreferences")).Return(nil).Once()
+
+		require.NoError(t, service.SendDigests(ctx))
+
+		assert.Len(t, mailer.sent, 2)
+		preferencesRepo.AssertCalled(t, "SavePreferences", ctx, mock.MatchedBy(func(p *models.UserPreferences) bool {
+			return p.DigestGroups[groupID].After(lastDigest) && p.DigestGroups[otherGroupID].After(lastDigest)
+		}))
+	})
+}
+
+func TestUnsubscribe(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	t.Run("Valid token disables the digest", func(t *testing.T) {
+		service, _, preferencesRepo, _, _ := setupDigestService(t)
+
+		preferencesRepo.On("GetPreferences", ctx, userID).
+			Return(&models.UserPreferences{UserID: userID, EmailDigest: true, Email: "anna@example.com",
+				DigestGroups: map[uuid.UUID]time.Time{uuid.New(): time.Now()}}, nil)
+		preferencesRepo.On("SavePreferences", ctx, mock.MatchedBy(func(p *models.UserPreferences) bool {
+			return p.UserID == userID && !p.EmailDigest && len(p.DigestGroups) == 0
+		})).Return(nil)
+
+		link, err := url.Parse(service.unsubscribeURL(ctx, userID))
+		require.NoError(t, err)
+
+		assert.NoError(t, service.Unsubscribe(ctx, link.Query().Get("token")))
+		preferencesRepo.AssertExpectations(t)
+	})
+
+	t.Run("Rejects tampered tokens", func(t *testing.T) {
+		service, _, preferencesRepo, _, _ := setupDigestService(t)
+
+		token := service.unsubscribeToken(ctx, userID)
+		otherPayload, _, _ := strings.Cut(service.unsubscribeToken(ctx, uuid.New()), ".")
+		_, signature, _ := strings.Cut(token, ".")
+
+		for _, invalid := range []string{"", "garbage", otherPayload + "." + signature, token + "x"} {
+			assert.ErrorIs(t, service.Unsubscribe(ctx, invalid), ErrInvalidUnsubscribeToken)
+		}
+		preferencesRepo.AssertNotCalled(t, "GetPreferences", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Tokens stay with the tenant they were issued for", func(t *testing.T) {
+		service, _, preferencesRepo, _, _ := setupDigestService(t)
+		acme := tenant.WithTenant(ctx, "acme")
+
+		inTenant := mock.MatchedBy(func(ctx context.Context) bool {
+			id, _ := tenant.FromContext(ctx)
+			return id == "acme"
+		})
+		preferencesRepo.On("GetPreferences", inTenant, userID).
+			Return(&models.UserPreferences{UserID: userID, EmailDigest: true}, nil)
+		preferencesRepo.On("SavePreferences", inTenant, mock.Anything).Return(nil)
+
+		token := service.unsubscribeToken(acme, userID)
+		assert.NoError(t, service.Unsubscribe(ctx, token))
+		preferencesRepo.AssertExpectations(t)
+
+		payload, signature, _ := strings.Cut(token, ".")
+		moved := strings.TrimSuffix(payload, "acme") + "beta." + signature
+		assert.ErrorIs(t, service.Unsubscribe(ctx, moved), ErrInvalidUnsubscribeToken)
+	})
+}
@@ -14,8 +14,10 @@ func NewFCMTokenService(repo repositories.FCMTokenRepository) FCMTokenService {
 	return &fcmTokenService{repo: repo}
 }
 
-func (s *fcmTokenService) SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string) error {
-	return s.repo.SaveToken(ctx, groupID, userID, token)
+// SaveToken stores the device token together with the most preferred language of the device,
+// which is used to localise notifications when the user has no explicit locale preference
+func (s *fcmTokenService) SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string, acceptLanguage string) error {
+	return s.repo.SaveToken(ctx, groupID, userID, token, PreferredLocale(acceptLanguage))
 }
 
 func (s *fcmTokenService) DeleteToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID) error {
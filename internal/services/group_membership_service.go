@@ -0,0 +1,54 @@
+package services
+
+import (
+	"Groupchat-Service/internal/cache"
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/tenant"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"slices"
+	"time"
+)
+
+type GroupMembershipConfig struct {
+	// CacheSize is the number of users whose groups are kept
+	CacheSize int
+	// CacheTTL is how long the groups of a user are kept, and so how long a removed member keeps access
+	CacheTTL time.Duration
+}
+
+type membershipKey struct {
+	tenantID string
+	userID   uuid.UUID
+}
+
+// groupMembershipService looks up the groups of a user in the user service and caches them, so a group-scoped
+// request rarely waits for the user service
+type groupMembershipService struct {
+	repo   repositories.GroupMembershipRepository
+	groups *cache.LRU[membershipKey, []uuid.UUID]
+}
+
+func NewGroupMembershipService(repo repositories.GroupMembershipRepository, config GroupMembershipConfig) GroupMembershipService {
+	return &groupMembershipService{
+		repo:   repo,
+		groups: cache.NewLRU[membershipKey, []uuid.UUID](config.CacheSize, config.CacheTTL),
+	}
+}
+
+// IsMember reports whether the user belongs to the group. Failed lookups are not cached.
+func (s *groupMembershipService) IsMember(ctx context.Context, userID uuid.UUID, groupID uuid.UUID, accessToken string) (bool, error) {
+	tenantID, _ := tenant.FromContext(ctx)
+	key := membershipKey{tenantID: tenantID, userID: userID}
+
+	groups, ok := s.groups.Get(key)
+	if !ok {
+		var err error
+		if groups, err = s.repo.ListUserGroups(ctx, userID, accessToken); err != nil {
+			return false, fmt.Errorf("error looking up group membership: %w", err)
+		}
+		s.groups.Set(key, groups)
+	}
+	return slices.Contains(groups, groupID), nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubMembershipRepository returns fixed groups per user and counts the lookups
+type stubMembershipRepository struct {
+	groups  map[uuid.UUID][]uuid.UUID
+	err     error
+	lookups int
+}
+
+func (r *stubMembershipRepository) ListUserGroups(_ context.Context, userID uuid.UUID, _ string) ([]uuid.UUID, error) {
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.groups[userID], nil
+}
+
+func TestGroupMembershipService(t *testing.T) {
+	ctx := context.Background()
+	caregiver := uuid.New()
+	firstPatient, secondPatient, otherGroup := uuid.New(), uuid.New(), uuid.New()
+	repo := &stubMembershipRepository{groups: map[uuid.UUID][]uuid.UUID{caregiver: {firstPatient, secondPatient}}}
+	service := NewGroupMembershipService(repo, GroupMembershipConfig{CacheSize: 10, CacheTTL: time.Minute})
+
+	t.Run("Checks membership with one lookup per user", func(t *testing.T) {
+		for _, groupID := range []uuid.UUID{firstPatient, secondPatient} {
+			member, err := service.IsMember(ctx, caregiver, groupID, "token")
+			require.NoError(t, err)
+			assert.True(t, member)
+		}
+		member, err := service.IsMember(ctx, caregiver, otherGroup, "token")
+		require.NoError(t, err)
+		assert.False(t, member)
+		assert.Equal(t, 1, repo.lookups)
+	})
+
+	t.Run("Caches per tenant", func(t *testing.T) {
+		_, err := service.IsMember(tenant.WithTenant(ctx, "acme"), caregiver, firstPatient, "token")
+		require.NoError(t, err)
+		assert.Equal(t, 2, repo.lookups)
+	})
+
+	t.Run("Does not cache failed lookups", func(t *testing.T) {
+		user := uuid.New()
+		repo.err = errors.New("user service unavailable")
+		_, err := service.IsMember(ctx, user, firstPatient, "token")
+		assert.Error(t, err)
+
+		repo.err = nil
+		repo.groups[user] = []uuid.UUID{firstPatient}
+		member, err := service.IsMember(ctx, user, firstPatient, "token")
+		require.NoError(t, err)
+		assert.True(t, member)
+	})
+}
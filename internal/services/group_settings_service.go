@@ -0,0 +1,65 @@
+package services
+
+import (
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// ErrEndToEndEncryptionPermanent is returned when switching off end-to-end encryption of a group
+var ErrEndToEndEncryptionPermanent = errors.New("end-to-end encryption cannot be switched off")
+
+type groupSettingsService struct {
+	repo repositories.GroupSettingsRepository
+}
+
+func NewGroupSettingsService(repo repositories.GroupSettingsRepository) GroupSettingsService {
+	return &groupSettingsService{repo: repo}
+}
+
+func (s *groupSettingsService) GetSettings(ctx context.Context, groupID uuid.UUID) (*models.GroupSettings, error) {
+	return s.repo.GetSettings(ctx, groupID)
+}
+
+// UpdateSettings applies the fields set in the update on top of the stored group settings
+func (s *groupSettingsService) UpdateSettings(ctx context.Context, groupID uuid.UUID, update models.GroupSettingsUpdate) (*models.GroupSettings, error) {
+	settings, err := s.repo.GetSettings(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting group settings: %w", err)
+	}
+
+	if update.PrivateNotifications != nil {
+		settings.PrivateNotifications = *update.PrivateNotifications
+	}
+	if update.DigestExcludeContent != nil {
+		settings.DigestExcludeContent = *update.DigestExcludeContent
+	}
+	if update.RetentionDays != nil {
+		if *update.RetentionDays < 0 || *update.RetentionDays > MaxRetentionDays {
+			return nil, ErrInvalidRetentionDays
+		}
+		settings.RetentionDays = *update.RetentionDays
+	}
+	if update.RetentionKeepPinned != nil {
+		settings.RetentionKeepPinned = *update.RetentionKeepPinned
+	}
+	if update.EndToEndEncrypted != nil {
+		// The messages sent so far are ciphertext, so the group cannot go back to plaintext
+		if settings.EndToEndEncrypted && !*update.EndToEndEncrypted {
+			return nil, ErrEndToEndEncryptionPermanent
+		}
+		settings.EndToEndEncrypted = *update.EndToEndEncrypted
+	}
+	if update.AllowMessageDeletion != nil {
+		settings.AllowMessageDeletion = *update.AllowMessageDeletion
+	}
+
+	if err := s.repo.SaveSettings(ctx, settings); err != nil {
+		return nil, fmt.Errorf("error saving group settings: %w", err)
+	}
+
+	return settings, nil
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"Groupchat-Service/internal/backup"
 	"Groupchat-Service/internal/models"
 	"context"
 	"github.com/google/uuid"
@@ -8,27 +9,82 @@ import (
 
 type MessageService interface {
 	GetMessages(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.MessageResponse, *models.PaginationResponse, error)
-	CreateMessage(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, userName string, create models.MessageCreate) (*models.Message, error)
-	ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error)
+	GetMessage(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.MessageResponse, error)
+	CreateMessage(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, userName string, badge models.SenderBadge, create models.MessageCreate) (*models.Message, error)
+	ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID, ifMatch string) (*models.Message, error)
+	DeleteMessage(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) error
+	SearchMessages(ctx context.Context, groupID uuid.UUID, query models.SearchQuery) ([]models.SearchResult, *models.PaginationResponse, error)
 }
 
 type NotificationService interface {
-	SendGroupMessage(message Message, deviceTokens []string) (*BatchResponse, error)
+	SendGroupMessage(ctx context.Context, message Message, recipients []Recipient) (*BatchResponse, error)
 }
 
 type ValidationService interface {
 	ValidatePaginationQuery(queryParams map[string]string) (models.PaginationQuery, error)
+	ValidateSearchQuery(queryParams map[string]string) (models.SearchQuery, error)
 	ValidateUserContext(ctx context.Context) (uuid.UUID, string, error)
 	ValidateGroupID(groupID string) (uuid.UUID, error)
 	ValidateUserID(userID string) (uuid.UUID, error)
 	ValidateToken(token string) error
+	ValidateLocale(locale string) error
+	ValidateEmail(email string) error
 }
 
 type FCMTokenService interface {
-	SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string) error
+	SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string, acceptLanguage string) error
 	DeleteToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID) error
 }
 
+type UserPreferencesService interface {
+	GetPreferences(ctx context.Context, userID uuid.UUID) (*models.UserPreferences, error)
+	UpdatePreferences(ctx context.Context, userID uuid.UUID, groupID uuid.UUID, email string, update models.UserPreferencesUpdate) (*models.UserPreferences, error)
+}
+
+type DigestService interface {
+	SendDigests(ctx context.Context) error
+	Unsubscribe(ctx context.Context, token string) error
+}
+
+type GroupSettingsService interface {
+	GetSettings(ctx context.Context, groupID uuid.UUID) (*models.GroupSettings, error)
+	UpdateSettings(ctx context.Context, groupID uuid.UUID, update models.GroupSettingsUpdate) (*models.GroupSettings, error)
+}
+
+type KeyDistributionService interface {
+	PublishBundle(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, upload models.KeyBundleUpload) (*models.KeyBundle, error)
+	GetPreKeyBundles(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, deviceID string) ([]models.PreKeyBundle, error)
+}
+
+type RetentionService interface {
+	PurgeExpiredMessages(ctx context.Context, dryRun bool) ([]models.RetentionReport, error)
+}
+
+type ArchiveService interface {
+	ArchiveOldMessages(ctx context.Context) ([]models.ArchiveReport, error)
+}
+
+type BackupService interface {
+	Backup(ctx context.Context, writer *backup.Writer) error
+	Restore(ctx context.Context, reader *backup.Reader, options RestoreOptions) ([]models.RestoreReport, error)
+}
+
+type GroupMembershipService interface {
+	IsMember(ctx context.Context, userID uuid.UUID, groupID uuid.UUID, accessToken string) (bool, error)
+}
+
+type AccessAuditService interface {
+	RecordAccess(ctx context.Context, audit *models.AccessAudit) error
+	ListAccesses(ctx context.Context, groupID uuid.UUID) ([]models.AccessAudit, error)
+}
+
+type TokenRevocationService interface {
+	Revoke(ctx context.Context, revokedBy string, create models.TokenRevocationCreate) (*models.TokenRevocation, error)
+	ListRevocations(ctx context.Context) ([]models.TokenRevocation, error)
+	IsRevoked(tokenID string, sessionID string) bool
+	Refresh(ctx context.Context) error
+}
+
 type HealthService interface {
 	CheckHealth(ctx context.Context) (*models.HealthResponse, error)
 	CheckReadiness(ctx context.Context) (*models.HealthResponse, error)
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"regexp"
+	"time"
+)
+
+// ErrInvalidKeyBundle is returned for key bundles that are incomplete or exceed the size limits
+var ErrInvalidKeyBundle = errors.New("invalid key bundle")
+
+// Limits of published key bundles. Keys and signatures are base64 encoded by the clients.
+const (
+	maxOneTimePreKeys  = 100
+	maxPublicKeyLength = 256
+	maxSignatureLength = 512
+)
+
+// deviceIDPattern keeps device IDs usable as part of a storage key
+var deviceIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func validDeviceID(deviceID string) bool {
+	return deviceIDPattern.MatchString(deviceID)
+}
+
+type keyDistributionService struct {
+	repo repositories.KeyBundleRepository
+}
+
+func NewKeyDistributionService(repo repositories.KeyBundleRepository) KeyDistributionService {
+	return &keyDistributionService{repo: repo}
+}
+
+// PublishBundle stores the key bundle of a device of the user, replacing the one it published before
+func (s *keyDistributionService) PublishBundle(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, upload models.KeyBundleUpload) (*models.KeyBundle, error) {
+	if err := validateKeyBundle(upload); err != nil {
+		return nil, err
+	}
+
+	bundle := &models.KeyBundle{
+		GroupID:        groupID,
+		UserID:         userID,
+		DeviceID:       upload.DeviceID,
+		IdentityKey:    upload.IdentityKey,
+		SignedPreKey:   upload.SignedPreKey,
+		OneTimePreKeys: upload.OneTimePreKeys,
+		UpdatedAt:      time.Now().UTC(),
+	}
+	if err := s.repo.SaveBundle(ctx, bundle); err != nil {
+		return nil, fmt.Errorf("error saving key bundle: %w", err)
+	}
+	return bundle, nil
+}
+
+func validateKeyBundle(upload models.KeyBundleUpload) error {
+	switch {
+	case !validDeviceID(upload.DeviceID):
+		return fmt.Errorf("%w: deviceId must be 1 to 64 letters, digits, '-' or '_'", ErrInvalidKeyBundle)
+	case !validPublicKey(upload.IdentityKey):
+		return fmt.Errorf("%w: identityKey is required and at most %d characters", ErrInvalidKeyBundle, maxPublicKeyLength)
+	case !validPublicKey(upload.SignedPreKey.PublicKey):
+		return fmt.Errorf("%w: signedPreKey.publicKey is required and at most %d characters", ErrInvalidKeyBundle, maxPublicKeyLength)
+	case upload.SignedPreKey.Signature == "" || len(upload.SignedPreKey.Signature) > maxSignatureLength:
+		return fmt.Errorf("%w: signedPreKey.signature is required and at most %d characters", ErrInvalidKeyBundle, maxSignatureLength)
+	case len(upload.OneTimePreKeys) > maxOneTimePreKeys:
+		return fmt.Errorf("%w: at most %d one-time pre-keys can be published", ErrInvalidKeyBundle, maxOneTimePreKeys)
+	}
+
+	keyIDs := make(map[int]bool, len(upload.OneTimePreKeys))
+	for _, preKey := range upload.OneTimePreKeys {
+		if !validPublicKey(preKey.PublicKey) || keyIDs[preKey.KeyID] {
+			return fmt.Errorf("%w: one-time pre-keys need a unique keyId and a publicKey of at most %d characters", ErrInvalidKeyBundle, maxPublicKeyLength)
+		}
+		keyIDs[preKey.KeyID] = true
+	}
+	return nil
+}
+
+func validPublicKey(key string) bool {
+	return key != "" && len(key) <= maxPublicKeyLength
+}
+
+// GetPreKeyBundles returns a pre-key bundle for every device in the group except the calling device, so
+// the caller can encrypt a message key for each of them. Every bundle claims one one-time pre-key of its
+// device while the device has any left.
+func (s *keyDistributionService) GetPreKeyBundles(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, deviceID string) ([]models.PreKeyBundle, error) {
+	bundles, err := s.repo.ListBundles(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing key bundles: %w", err)
+	}
+
+	preKeyBundles := make([]models.PreKeyBundle, 0, len(bundles))
+	for _, bundle := range bundles {
+		if bundle.UserID == userID && bundle.DeviceID == deviceID {
+			continue
+		}
+
+		preKey, err := s.repo.ClaimPreKey(ctx, groupID, bundle.UserID, bundle.DeviceID)
+		if err != nil {
+			return nil, fmt.Errorf("error claiming pre-key: %w", err)
+		}
+
+		preKeyBundles = append(preKeyBundles, models.PreKeyBundle{
+			UserID:        bundle.UserID,
+			DeviceID:      bundle.DeviceID,
+			IdentityKey:   bundle.IdentityKey,
+			SignedPreKey:  bundle.SignedPreKey,
+			OneTimePreKey: preKey,
+		})
+	}
+	return preKeyBundles, nil
+}
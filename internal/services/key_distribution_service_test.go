@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyBundleUpload(deviceID string, preKeyIDs ...int) models.KeyBundleUpload {
+	upload := models.KeyBundleUpload{
+		DeviceID:     deviceID,
+		IdentityKey:  "identity-" + deviceID,
+		SignedPreKey: models.SignedPreKey{KeyID: 1, PublicKey: "signed-" + deviceID, Signature: "signature"},
+	}
+	for _, keyID := range preKeyIDs {
+		upload.OneTimePreKeys = append(upload.OneTimePreKeys, models.PreKey{KeyID: keyID, PublicKey: "one-time"})
+	}
+	return upload
+}
+
+func TestPublishBundle(t *testing.T) {
+	ctx := context.Background()
+	service := NewKeyDistributionService(repositories.NewMemoryKeyBundleRepository())
+
+	bundle, err := service.PublishBundle(ctx, uuid.New(), uuid.New(), testKeyBundleUpload("phone", 1, 2))
+	require.NoError(t, err)
+	assert.Equal(t, "phone", bundle.DeviceID)
+	assert.Len(t, bundle.OneTimePreKeys, 2)
+
+	invalid := map[string]models.KeyBundleUpload{
+		"device ID with a separator": testKeyBundleUpload("phone/1"),
+		"missing identity key": func() models.KeyBundleUpload {
+			upload := testKeyBundleUpload("phone")
+			upload.IdentityKey = ""
+			return upload
+		}(),
+		"unsigned pre-key": func() models.KeyBundleUpload {
+			upload := testKeyBundleUpload("phone")
+			upload.SignedPreKey.Signature = ""
+			return upload
+		}(),
+		"oversized public key": func() models.KeyBundleUpload {
+			upload := testKeyBundleUpload("phone")
+			upload.SignedPreKey.PublicKey = strings.Repeat("a", maxPublicKeyLength+1)
+			return upload
+		}(),
+		"duplicate pre-key IDs": testKeyBundleUpload("phone", 1, 1),
+	}
+	for name, upload := range invalid {
+		_, err := service.PublishBundle(ctx, uuid.New(), uuid.New(), upload)
+		assert.ErrorIs(t, err, ErrInvalidKeyBundle, name)
+	}
+}
+
+func TestGetPreKeyBundles(t *testing.T) {
+	ctx := context.Background()
+	service := NewKeyDistributionService(repositories.NewMemoryKeyBundleRepository())
+	groupID := uuid.New()
+	callerID := uuid.New()
+	memberID := uuid.New()
+
+	_, err := service.PublishBundle(ctx, groupID, callerID, testKeyBundleUpload("phone", 1))
+	require.NoError(t, err)
+	_, err = service.PublishBundle(ctx, groupID, callerID, testKeyBundleUpload("tablet", 1))
+	require.NoError(t, err)
+	_, err = service.PublishBundle(ctx, groupID, memberID, testKeyBundleUpload("laptop", 7))
+	require.NoError(t, err)
+
+	bundles, err := service.GetPreKeyBundles(ctx, groupID, callerID, "phone")
+	require.NoError(t, err)
+	require.Len(t, bundles, 2, "the calling device is left out")
+	for _, bundle := range bundles {
+		assert.NotEqual(t, "phone", bundle.DeviceID)
+		assert.Equal(t, "identity-"+bundle.DeviceID, bundle.IdentityKey)
+		require.NotNil(t, bundle.OneTimePreKey)
+	}
+
+	again, err := service.GetPreKeyBundles(ctx, groupID, callerID, "phone")
+	require.NoError(t, err)
+	require.Len(t, again, 2)
+	for _, bundle := range again {
+		assert.Nil(t, bundle.OneTimePreKey, "every one-time pre-key is handed out once")
+		assert.NotEmpty(t, bundle.SignedPreKey.PublicKey, "the signed pre-key remains available")
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Email is a plain text email message
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+	Headers map[string]string
+}
+
+// Mailer delivers emails
+type Mailer interface {
+	Send(email Email) error
+}
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer creates a mailer for the given SMTP server. Authentication is skipped when no
+// username is configured, which is what local catch-all servers such as MailHog expect.
+func NewSMTPMailer(host string, port int, username, password, from string) Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &smtpMailer{
+		addr: host + ":" + strconv.Itoa(port),
+		from: from,
+		auth: auth,
+	}
+}
+
+func (m *smtpMailer) Send(email Email) error {
+	message, err := m.buildMessage(email)
+	if err != nil {
+		return err
+	}
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{email.To}, message); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	return nil
+}
+
+func (m *smtpMailer) buildMessage(email Email) ([]byte, error) {
+	headers := map[string]string{
+		"From":                      m.from,
+		"To":                        email.To,
+		"Subject":                   mime.QEncoding.Encode("utf-8", email.Subject),
+		"Date":                      time.Now().Format(time.RFC1123Z),
+		"MIME-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "quoted-printable",
+	}
+	for key, value := range email.Headers {
+		headers[key] = value
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, headers[key])
+	}
+	buf.WriteString("\r\n")
+
+	writer := quotedprintable.NewWriter(&buf)
+	if _, err := writer.Write([]byte(email.Body)); err != nil {
+		return nil, fmt.Errorf("error encoding email body: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("error encoding email body: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
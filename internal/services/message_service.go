@@ -2,43 +2,100 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"Groupchat-Service/internal/database/repositories"
 	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/search"
 	"github.com/google/uuid"
 	"github.com/microcosm-cc/bluemonday"
 )
 
+// ErrMessageNotFound is returned when a message does not exist in the group
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrMessageConflict is returned when a conditional update targets a version of a message that is no longer current
+var ErrMessageConflict = errors.New("message was changed by someone else")
+
+// ErrSearchDisabled is returned when searching a group whose messages the server cannot read
+var ErrSearchDisabled = errors.New("search is not available in end-to-end encrypted groups")
+
+// ErrInvalidEncryptedMessage is returned when a message does not match the encryption mode of its group
+var ErrInvalidEncryptedMessage = errors.New("invalid end-to-end encrypted message")
+
+// Limits of end-to-end encrypted messages. The content is ciphertext, so it is bounded by its encoded size
+// instead of by characters.
+const (
+	maxEncryptedContentLength = 4096
+	maxEnvelopes              = 64
+	maxEnvelopeLength         = 512
+)
+
+// searchSnippetLength is the approximate length of the excerpt returned with each search result
+const searchSnippetLength = 160
+
 type messageService struct {
 	messageRepo         repositories.MessageRepository
 	fcmTokenRepo        repositories.FCMTokenRepository
+	preferencesRepo     repositories.UserPreferencesRepository
+	groupSettingsRepo   repositories.GroupSettingsRepository
 	notificationService NotificationService
 	validationService   ValidationService
+	cursors             *CursorCodec
 }
 
 func NewMessageService(
 	messageRepo repositories.MessageRepository,
 	fcmTokenRepo repositories.FCMTokenRepository,
+	preferencesRepo repositories.UserPreferencesRepository,
+	groupSettingsRepo repositories.GroupSettingsRepository,
 	notificationService NotificationService,
 	validationService ValidationService,
+	cursors *CursorCodec,
 ) MessageService {
 	return &messageService{
 		messageRepo:         messageRepo,
 		fcmTokenRepo:        fcmTokenRepo,
+		preferencesRepo:     preferencesRepo,
+		groupSettingsRepo:   groupSettingsRepo,
 		notificationService: notificationService,
 		validationService:   validationService,
+		cursors:             cursors,
 	}
 }
 
+// GetMessages returns a newest-first page of messages. A cursor continues in the direction it was
+// issued for: the next cursor leads to older messages and the previous cursor to newer ones.
 func (s *messageService) GetMessages(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.MessageResponse, *models.PaginationResponse, error) {
+	if query.Search != nil && strings.TrimSpace(*query.Search) != "" {
+		return s.searchTimeline(ctx, groupID, query)
+	}
+
+	if query.Cursor != nil && *query.Cursor != "" {
+		position, direction, err := s.cursors.Decode(groupID, *query.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+		query.Position = &position
+		query.Direction = direction
+	}
+
 	// Fetch messages from the repository
 	messages, pagination, err := s.messageRepo.GetMessages(ctx, groupID, query)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error getting messages from repository: %w", err)
 	}
 
+	if pagination.HasNext && len(messages) > 0 {
+		pagination.NextCursor = s.cursorFor(groupID, messages[len(messages)-1], models.Next)
+	}
+	if pagination.HasPrevious && len(messages) > 0 {
+		pagination.PreviousCursor = s.cursorFor(groupID, messages[0], models.Previous)
+	}
+
 	// If no messages are found, return an empty list and pagination response
 	if len(messages) == 0 {
 		return []models.MessageResponse{}, pagination, nil
@@ -46,34 +103,141 @@ func (s *messageService) GetMessages(ctx context.Context, groupID uuid.UUID, que
 
 	var messageResponses []models.MessageResponse
 	for _, message := range messages {
-		messageResponses = append(messageResponses, models.MessageResponse{
-			ID:         message.ID,
-			GroupID:    message.GroupID,
-			SenderID:   message.SenderID,
-			SenderName: message.SenderName,
-			Content:    message.Content,
-			SentAt:     message.SentAt,
-			IsPinned:   message.IsPinned,
-		})
+		messageResponses = append(messageResponses, toMessageResponse(message))
 	}
 
 	return messageResponses, pagination, nil
 }
 
-func (s *messageService) CreateMessage(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, userName string, create models.MessageCreate) (*models.Message, error) {
-	// Sanitize message content
-	p := bluemonday.UGCPolicy()
-	sanitizedContent := p.Sanitize(create.Content)
+// searchTimeline answers the search parameter of the timeline, which predates the search index, from the
+// index like SearchMessages. Its cursors are search cursors, so the results only page towards older messages.
+func (s *messageService) searchTimeline(ctx context.Context, groupID uuid.UUID, query models.PaginationQuery) ([]models.MessageResponse, *models.PaginationResponse, error) {
+	results, pagination, err := s.SearchMessages(ctx, groupID, models.SearchQuery{
+		Text:     strings.TrimSpace(*query.Search),
+		PageSize: query.PageSize,
+		Cursor:   query.Cursor,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messages := make([]models.MessageResponse, 0, len(results))
+	for _, result := range results {
+		messages = append(messages, result.MessageResponse)
+	}
+	return messages, pagination, nil
+}
+
+func (s *messageService) cursorFor(groupID uuid.UUID, message models.Message, direction models.Direction) *string {
+	cursor := s.cursors.Encode(groupID, models.MessageCursor{SentAt: message.SentAt, MessageID: message.ID}, direction)
+	return &cursor
+}
+
+// SearchMessages returns the newest messages that contain every word of the search text, with a highlighted
+// snippet per message. Search results only page towards older messages.
+func (s *messageService) SearchMessages(ctx context.Context, groupID uuid.UUID, query models.SearchQuery) ([]models.SearchResult, *models.PaginationResponse, error) {
+	if err := s.checkSearchable(ctx, groupID); err != nil {
+		return nil, nil, err
+	}
+
+	if query.Cursor != nil && *query.Cursor != "" {
+		position, err := s.cursors.DecodeSearch(groupID, query.Text, *query.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+		query.Position = &position
+	}
+
+	messages, pagination, err := s.messageRepo.SearchMessages(ctx, groupID, query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error searching messages: %w", err)
+	}
+
+	if pagination.HasNext && len(messages) > 0 {
+		last := messages[len(messages)-1]
+		cursor := s.cursors.EncodeSearch(groupID, query.Text, models.MessageCursor{SentAt: last.SentAt, MessageID: last.ID})
+		pagination.NextCursor = &cursor
+	}
+
+	terms := search.ParseQuery(query.Text)
+	results := make([]models.SearchResult, 0, len(messages))
+	for _, message := range messages {
+		results = append(results, models.SearchResult{
+			MessageResponse: toMessageResponse(message),
+			Snippet:         search.Snippet(message.Content, terms, searchSnippetLength),
+		})
+	}
+
+	return results, pagination, nil
+}
+
+// checkSearchable returns ErrSearchDisabled for end-to-end encrypted groups, whose content is ciphertext
+func (s *messageService) checkSearchable(ctx context.Context, groupID uuid.UUID) error {
+	settings, err := s.groupSettingsRepo.GetSettings(ctx, groupID)
+	if err != nil {
+		return fmt.Errorf("error getting group settings: %w", err)
+	}
+	if settings.EndToEndEncrypted {
+		return ErrSearchDisabled
+	}
+	return nil
+}
+
+// GetMessage returns a single message, used by clients that received a private notification
+func (s *messageService) GetMessage(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.MessageResponse, error) {
+	message, err := s.messageRepo.GetMessageByID(ctx, groupID, messageID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("error getting message: %w", err)
+	}
+
+	response := toMessageResponse(*message)
+	return &response, nil
+}
+
+func toMessageResponse(message models.Message) models.MessageResponse {
+	return models.MessageResponse{
+		ID:          message.ID,
+		GroupID:     message.GroupID,
+		SenderID:    message.SenderID,
+		SenderName:  message.SenderName,
+		SenderBadge: message.SenderBadge,
+		Content:     message.Content,
+		SentAt:      message.SentAt,
+		IsPinned:    message.IsPinned,
+		Envelopes:   message.Envelopes,
+		ETag:        message.ETag,
+	}
+}
 
-	// Create message entity
+// CreateMessage stores a message and notifies the group. In end-to-end encrypted groups the content is
+// ciphertext that is stored as sent, together with the key envelopes of the recipients. The badge is shown
+// with the sender name, such as for healthcare professionals.
+func (s *messageService) CreateMessage(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, userName string, badge models.SenderBadge, create models.MessageCreate) (*models.Message, error) {
+	settings, err := s.groupSettingsRepo.GetSettings(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting group settings: %w", err)
+	}
+
+	content, err := messageContent(settings, create)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create message entity. Microseconds are the finest precision every storage backend keeps,
+	// so the sent time returned here matches the one cursors are built from later.
 	message := &models.Message{
-		ID:         uuid.New(),
-		GroupID:    groupID,
-		SenderID:   userID,
-		SenderName: userName,
-		Content:    sanitizedContent,
-		SentAt:     time.Now().UTC(),
-		IsPinned:   false,
+		ID:          uuid.New(),
+		GroupID:     groupID,
+		SenderID:    userID,
+		SenderName:  userName,
+		SenderBadge: badge,
+		Content:     content,
+		SentAt:      time.Now().UTC().Truncate(time.Microsecond),
+		IsPinned:    false,
+		Envelopes:   create.Envelopes,
 	}
 
 	// Save to database
@@ -81,7 +245,9 @@ func (s *messageService) CreateMessage(ctx context.Context, groupID uuid.UUID, u
 		return nil, fmt.Errorf("error creating message: %w", err)
 	}
 
-	// Get FCM tokens for group members asynchronously
+	// Get FCM tokens for group members asynchronously. The request context is cancelled once the
+	// response is written, so the background work keeps its values but not its cancellation.
+	ctx = context.WithoutCancel(ctx)
 	go func() {
 		tokens, err := s.fcmTokenRepo.GetGroupMemberTokens(ctx, groupID)
 		if err != nil {
@@ -90,15 +256,22 @@ func (s *messageService) CreateMessage(ctx context.Context, groupID uuid.UUID, u
 			return
 		}
 
+		recipients := s.buildRecipients(ctx, settings, tokens)
+		notification := Message{
+			MessageID:  message.ID.String(),
+			SenderID:   message.SenderID.String(),
+			SenderName: userName,
+			Content:    message.Content,
+			GroupID:    message.GroupID.String(),
+			Timestamp:  message.SentAt.Unix(),
+		}
+		if settings.EndToEndEncrypted {
+			notification.Content = ""
+		}
+
 		// Send notification asynchronously
 		go func() {
-			_, err := s.notificationService.SendGroupMessage(Message{
-				SenderID:   message.SenderID.String(),
-				SenderName: userName,
-				Content:    message.Content,
-				GroupID:    message.GroupID.String(),
-				Timestamp:  message.SentAt.Unix(),
-			}, tokens)
+			_, err := s.notificationService.SendGroupMessage(ctx, notification, recipients)
 			if err != nil {
 				fmt.Printf("Error sending notification: %v\n", err)
 			}
@@ -108,16 +281,99 @@ func (s *messageService) CreateMessage(ctx context.Context, groupID uuid.UUID, u
 	return message, nil
 }
 
-func (s *messageService) ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error) {
+// messageContent returns the content to store for a new message. Plaintext content is sanitised; the
+// ciphertext of end-to-end encrypted groups cannot be, so it is only checked against the size limits and
+// must come with key envelopes.
+func messageContent(settings *models.GroupSettings, create models.MessageCreate) (string, error) {
+	if !settings.EndToEndEncrypted {
+		if len(create.Envelopes) > 0 {
+			return "", fmt.Errorf("%w: key envelopes are only accepted in end-to-end encrypted groups", ErrInvalidEncryptedMessage)
+		}
+		return bluemonday.UGCPolicy().Sanitize(create.Content), nil
+	}
+
+	switch {
+	case create.Content == "" || len(create.Content) > maxEncryptedContentLength:
+		return "", fmt.Errorf("%w: content must be between 1 and %d characters of ciphertext", ErrInvalidEncryptedMessage, maxEncryptedContentLength)
+	case len(create.Envelopes) == 0 || len(create.Envelopes) > maxEnvelopes:
+		return "", fmt.Errorf("%w: between 1 and %d key envelopes are required", ErrInvalidEncryptedMessage, maxEnvelopes)
+	}
+	for _, envelope := range create.Envelopes {
+		if envelope.RecipientID == uuid.Nil || !validDeviceID(envelope.DeviceID) ||
+			envelope.Ciphertext == "" || len(envelope.Ciphertext) > maxEnvelopeLength {
+			return "", fmt.Errorf("%w: every key envelope needs a recipient, a device and at most %d characters of ciphertext", ErrInvalidEncryptedMessage, maxEnvelopeLength)
+		}
+	}
+	return create.Content, nil
+}
+
+// buildRecipients pairs each device token with the locale and privacy mode of its notification.
+// A user's explicit locale preference wins over the Accept-Language captured at token registration.
+// Notifications are private when either the group or the user asked for it, and always in end-to-end
+// encrypted groups, whose content the server cannot render.
+func (s *messageService) buildRecipients(ctx context.Context, settings *models.GroupSettings, tokens []models.FCMToken) []Recipient {
+	groupPrivate := settings.PrivateNotifications || settings.EndToEndEncrypted
+
+	// Users with several devices have a token per device; their preferences are looked up once. A nil entry
+	// records a failed lookup.
+	preferencesByUser := make(map[uuid.UUID]*models.UserPreferences)
+
+	recipients := make([]Recipient, 0, len(tokens))
+	for _, token := range tokens {
+		recipient := Recipient{Token: token.Token, Locale: token.Locale, Private: groupPrivate}
+
+		if userID, err := uuid.Parse(token.RowKey); err == nil {
+			preferences, found := preferencesByUser[userID]
+			if !found {
+				if preferences, err = s.preferencesRepo.GetPreferences(ctx, userID); err != nil {
+					fmt.Printf("Error getting user preferences: %v\n", err)
+					preferences = nil
+				}
+				preferencesByUser[userID] = preferences
+			}
+			if preferences == nil {
+				recipient.Private = true
+			} else {
+				if preferences.Locale != "" {
+					recipient.Locale = preferences.Locale
+				}
+				recipient.Private = recipient.Private || preferences.PrivateNotifications
+			}
+		}
+
+		recipients = append(recipients, recipient)
+	}
+	return recipients
+}
+
+// DeleteMessage removes a message from its group, used by professionals moderating a group
+func (s *messageService) DeleteMessage(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) error {
 	message, err := s.messageRepo.GetMessageByID(ctx, groupID, messageID)
 	if err != nil {
-		return nil, fmt.Errorf("error getting message: %v", err)
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrMessageNotFound
+		}
+		return fmt.Errorf("error getting message: %w", err)
 	}
 
-	message.IsPinned = !message.IsPinned
-	updatedMessage, err := s.messageRepo.ToggleMessagePin(ctx, groupID, messageID)
+	if err := s.messageRepo.DeleteMessages(ctx, groupID, []models.Message{*message}); err != nil {
+		return fmt.Errorf("error deleting message: %w", err)
+	}
+	return nil
+}
+
+// ToggleMessagePin flips the pin of a message. With a non-empty ifMatch the update only applies to that
+// version of the message and fails with ErrMessageConflict when it changed in the meantime.
+func (s *messageService) ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID, ifMatch string) (*models.Message, error) {
+	updatedMessage, err := s.messageRepo.ToggleMessagePin(ctx, groupID, messageID, ifMatch)
 	if err != nil {
-		return nil, fmt.Errorf("error updating message pin status: %v", err)
+		switch {
+		case errors.Is(err, repositories.ErrNotFound):
+			return nil, ErrMessageNotFound
+		case errors.Is(err, repositories.ErrConflict):
+			return nil, ErrMessageConflict
+		}
+		return nil, fmt.Errorf("error updating message pin status: %w", err)
 	}
 
 	return updatedMessage, nil
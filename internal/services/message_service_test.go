@@ -6,10 +6,12 @@ import (
 	"testing"
 	"time"
 
+	"Groupchat-Service/internal/database/repositories"
 	"Groupchat-Service/internal/models"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // Mock repositories and services
@@ -21,6 +23,14 @@ type MockFCMTokenRepository struct {
 	mock.Mock
 }
 
+type MockUserPreferencesRepository struct {
+	mock.Mock
+}
+
+type MockGroupSettingsRepository struct {
+	mock.Mock
+}
+
 type MockNotificationService struct {
 	mock.Mock
 }
@@ -39,6 +49,15 @@ func (m *MockMessageRepository) GetMessages(ctx context.Context, groupID uuid.UU
 	return messages.([]models.Message), args.Get(1).(*models.PaginationResponse), args.Error(2)
 }
 
+func (m *MockMessageRepository) SearchMessages(ctx context.Context, groupID uuid.UUID, query models.SearchQuery) ([]models.Message, *models.PaginationResponse, error) {
+	args := m.Called(ctx, groupID, query)
+	messages := args.Get(0)
+	if messages == nil {
+		return nil, args.Get(1).(*models.PaginationResponse), args.Error(2)
+	}
+	return messages.([]models.Message), args.Get(1).(*models.PaginationResponse), args.Error(2)
+}
+
 func (m *MockMessageRepository) CreateMessage(ctx context.Context, groupID uuid.UUID, message *models.Message) error {
 	args := m.Called(ctx, groupID, message)
 	return args.Error(0)
@@ -49,8 +68,8 @@ func (m *MockMessageRepository) GetMessageByID(ctx context.Context, groupID uuid
 	return args.Get(0).(*models.Message), args.Error(1)
 }
 
-func (m *MockMessageRepository) ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (*models.Message, error) {
-	args := m.Called(ctx, groupID, messageID)
+func (m *MockMessageRepository) ToggleMessagePin(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID, ifMatch string) (*models.Message, error) {
+	args := m.Called(ctx, groupID, messageID, ifMatch)
 	return args.Get(0).(*models.Message), args.Error(1)
 }
 
@@ -64,13 +83,33 @@ func (m *MockMessageRepository) CountUnreadMessages(ctx context.Context, groupID
 	return args.Int(0), args.Error(1)
 }
 
-func (m *MockFCMTokenRepository) GetGroupMemberTokens(ctx context.Context, groupID uuid.UUID) ([]string, error) {
+func (m *MockMessageRepository) GetMessagesSince(ctx context.Context, groupID uuid.UUID, since time.Time, limit int) ([]models.Message, error) {
+	args := m.Called(ctx, groupID, since, limit)
+	return args.Get(0).([]models.Message), args.Error(1)
+}
+
+func (m *MockMessageRepository) ListExpiredMessages(ctx context.Context, groupID uuid.UUID, query models.RetentionQuery) ([]models.Message, error) {
+	args := m.Called(ctx, groupID, query)
+	return args.Get(0).([]models.Message), args.Error(1)
+}
+
+func (m *MockMessageRepository) DeleteMessages(ctx context.Context, groupID uuid.UUID, messages []models.Message) error {
+	args := m.Called(ctx, groupID, messages)
+	return args.Error(0)
+}
+
+func (m *MockMessageRepository) ListGroupIDs(ctx context.Context) ([]uuid.UUID, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
+func (m *MockFCMTokenRepository) GetGroupMemberTokens(ctx context.Context, groupID uuid.UUID) ([]models.FCMToken, error) {
 	args := m.Called(ctx, groupID)
-	return args.Get(0).([]string), args.Error(1)
+	return args.Get(0).([]models.FCMToken), args.Error(1)
 }
 
-func (m *MockFCMTokenRepository) SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string) error {
-	args := m.Called(ctx, groupID, userID, token)
+func (m *MockFCMTokenRepository) SaveToken(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, token string, locale string) error {
+	args := m.Called(ctx, groupID, userID, token, locale)
 	return args.Error(0)
 }
 
@@ -79,11 +118,61 @@ func (m *MockFCMTokenRepository) DeleteToken(ctx context.Context, groupID uuid.U
 	return args.Error(0)
 }
 
+func (m *MockFCMTokenRepository) ListTokens(ctx context.Context) ([]models.FCMToken, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]models.FCMToken), args.Error(1)
+}
+
+func (m *MockUserPreferencesRepository) GetPreferences(ctx context.Context, userID uuid.UUID) (*models.UserPreferences, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(*models.UserPreferences), args.Error(1)
+}
+
+func (m *MockUserPreferencesRepository) SavePreferences(ctx context.Context, preferences *models.UserPreferences) error {
+	args := m.Called(ctx, preferences)
+	return args.Error(0)
+}
+
+func (m *MockUserPreferencesRepository) ListDigestSubscribers(ctx context.Context) ([]models.UserPreferences, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]models.UserPreferences), args.Error(1)
+}
+
+func (m *MockUserPreferencesRepository) ListPreferences(ctx context.Context) ([]models.UserPreferences, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]models.UserPreferences), args.Error(1)
+}
+
+func (m *MockGroupSettingsRepository) GetSettings(ctx context.Context, groupID uuid.UUID) (*models.GroupSettings, error) {
+	args := m.Called(ctx, groupID)
+	return args.Get(0).(*models.GroupSettings), args.Error(1)
+}
+
+func (m *MockGroupSettingsRepository) SaveSettings(ctx context.Context, settings *models.GroupSettings) error {
+	args := m.Called(ctx, settings)
+	return args.Error(0)
+}
+
+func (m *MockGroupSettingsRepository) ListRetentionPolicies(ctx context.Context) ([]models.GroupSettings, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]models.GroupSettings), args.Error(1)
+}
+
+func (m *MockGroupSettingsRepository) ListSettings(ctx context.Context) ([]models.GroupSettings, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]models.GroupSettings), args.Error(1)
+}
+
 func (m *MockValidationService) ValidatePaginationQuery(queryParams map[string]string) (models.PaginationQuery, error) {
 	args := m.Called(queryParams)
 	return args.Get(0).(models.PaginationQuery), args.Error(1)
 }
 
+func (m *MockValidationService) ValidateSearchQuery(queryParams map[string]string) (models.SearchQuery, error) {
+	args := m.Called(queryParams)
+	return args.Get(0).(models.SearchQuery), args.Error(1)
+}
+
 func (m *MockValidationService) ValidateUserContext(ctx context.Context) (uuid.UUID, string, error) {
 	args := m.Called(ctx)
 	return args.Get(0).(uuid.UUID), args.Get(1).(string), args.Error(2)
@@ -104,167 +193,302 @@ func (m *MockValidationService) ValidateToken(token string) error {
 	return args.Error(0)
 }
 
-func (m *MockNotificationService) SendGroupMessage(message Message, deviceTokens []string) (*BatchResponse, error) {
-	args := m.Called(message, deviceTokens)
+func (m *MockValidationService) ValidateLocale(locale string) error {
+	args := m.Called(locale)
+	return args.Error(0)
+}
+
+func (m *MockValidationService) ValidateEmail(email string) error {
+	args := m.Called(email)
+	return args.Error(0)
+}
+
+func (m *MockNotificationService) SendGroupMessage(ctx context.Context, message Message, recipients []Recipient) (*BatchResponse, error) {
+	args := m.Called(ctx, message, recipients)
 	return args.Get(0).(*BatchResponse), args.Error(1)
 }
 
 func TestGetMessages(t *testing.T) {
 	ctx := context.Background()
-	groupID := uuid.New()
 	query := models.PaginationQuery{
 		PageSize:  10,
 		Direction: models.Next,
 	}
+	newMessage := func(groupID uuid.UUID) models.Message {
+		return models.Message{
+			ID:         uuid.New(),
+			GroupID:    groupID,
+			SenderID:   uuid.New(),
+			SenderName: "TestUser",
+			Content:    "Test message",
+			SentAt:     time.Now().UTC().Truncate(time.Microsecond),
+			IsPinned:   false,
+		}
+	}
 
 	tests := []struct {
-		name           string
-		setupMocks     func(*MockMessageRepository, *MockValidationService)
+		name       string
+		setupMocks func(*MockMessageRepository, *MockValidationService, uuid.UUID)
+		// seed stores the data of the case in a storage backend; cases without it only run against the mocks
+		seed           func(t *testing.T, repos *repositories.Repositories, groupID uuid.UUID)
 		expectedErr    error
 		expectedCount  int
 		expectedSender string
 	}{
 		{
 			name: "Success",
-			setupMocks: func(mr *MockMessageRepository, vs *MockValidationService) {
-				messages := []models.Message{
-					{
-						ID:         uuid.New(),
-						GroupID:    groupID,
-						SenderID:   uuid.New(),
-						SenderName: "TestUser",
-						Content:    "Test message",
-						SentAt:     time.Now(),
-						IsPinned:   false,
-					},
-				}
+			setupMocks: func(mr *MockMessageRepository, vs *MockValidationService, groupID uuid.UUID) {
+				messages := []models.Message{newMessage(groupID)}
 				pagination := &models.PaginationResponse{HasNext: false}
 				mr.On("GetMessages", ctx, groupID, query).Return(messages, pagination, nil)
 			},
+			seed: func(t *testing.T, repos *repositories.Repositories, groupID uuid.UUID) {
+				message := newMessage(groupID)
+				require.NoError(t, repos.Messages.CreateMessage(ctx, groupID, &message))
+			},
 			expectedCount:  1,
 			expectedSender: "TestUser",
 		},
 		{
 			name: "Repository Error",
-			setupMocks: func(mr *MockMessageRepository, vs *MockValidationService) {
+			setupMocks: func(mr *MockMessageRepository, vs *MockValidationService, groupID uuid.UUID) {
 				mr.On("GetMessages", ctx, groupID, query).Return(nil, &models.PaginationResponse{}, errors.New("db error"))
 			},
 			expectedErr: errors.New("error getting messages from repository: db error"),
 		},
 	}
 
+	check := func(t *testing.T, service MessageService, groupID uuid.UUID, expectedErr error, expectedCount int, expectedSender string) {
+		messages, _, err := service.GetMessages(ctx, groupID, query)
+
+		if expectedErr != nil {
+			assert.Error(t, err)
+			assert.Equal(t, expectedErr.Error(), err.Error())
+			return
+		}
+
+		assert.NoError(t, err)
+		assert.Len(t, messages, expectedCount)
+		if expectedCount > 0 {
+			assert.Equal(t, expectedSender, messages[0].SenderName)
+		}
+	}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockMsgRepo := new(MockMessageRepository)
-			mockFCMRepo := new(MockFCMTokenRepository)
-			mockNotifService := new(MockNotificationService)
-			mockValidService := new(MockValidationService)
+			t.Run("mock", func(t *testing.T) {
+				groupID := uuid.New()
+				mockMsgRepo := new(MockMessageRepository)
+				mockFCMRepo := new(MockFCMTokenRepository)
+				mockNotifService := new(MockNotificationService)
+				mockValidService := new(MockValidationService)
 
-			tt.setupMocks(mockMsgRepo, mockValidService)
+				tt.setupMocks(mockMsgRepo, mockValidService, groupID)
 
-			service := NewMessageService(mockMsgRepo, mockFCMRepo, mockNotifService, mockValidService)
-			messages, _, err := service.GetMessages(ctx, groupID, query)
+				service := NewMessageService(mockMsgRepo, mockFCMRepo, new(MockUserPreferencesRepository), new(MockGroupSettingsRepository), mockNotifService, mockValidService, newTestCursorCodec(t))
+				check(t, service, groupID, tt.expectedErr, tt.expectedCount, tt.expectedSender)
 
-			if tt.expectedErr != nil {
-				assert.Error(t, err)
-				assert.Equal(t, tt.expectedErr.Error(), err.Error())
-				return
-			}
+				mockMsgRepo.AssertExpectations(t)
+				mockValidService.AssertExpectations(t)
+			})
 
-			assert.NoError(t, err)
-			assert.Len(t, messages, tt.expectedCount)
-			if tt.expectedCount > 0 {
-				assert.Equal(t, tt.expectedSender, messages[0].SenderName)
+			if tt.seed == nil {
+				return
 			}
+			forEachStorageBackend(t, func(t *testing.T, repos *repositories.Repositories) {
+				groupID := uuid.New()
+				tt.seed(t, repos, groupID)
 
-			mockMsgRepo.AssertExpectations(t)
-			mockValidService.AssertExpectations(t)
+				service := NewMessageService(repos.Messages, repos.FCMTokens, repos.UserPreferences, repos.GroupSettings, new(MockNotificationService), NewValidationService(""), newTestCursorCodec(t))
+				check(t, service, groupID, tt.expectedErr, tt.expectedCount, tt.expectedSender)
+			})
 		})
 	}
 }
 
 func TestCreateMessage(t *testing.T) {
 	ctx := context.Background()
-	groupID := uuid.New()
 	userID := uuid.New()
 	userName := "TestUser"
 	create := models.MessageCreate{Content: "Test message"}
+	preferringUserID := uuid.New()
+	otherUserID := uuid.New()
 
 	tests := []struct {
 		name       string
-		setupMocks func(*MockMessageRepository, *MockFCMTokenRepository, *MockNotificationService)
+		setupMocks func(*MockMessageRepository, *MockFCMTokenRepository, *MockUserPreferencesRepository, *MockGroupSettingsRepository, *MockNotificationService, uuid.UUID)
+		// seed stores the tokens, preferences and settings of the case in a storage backend, which must then
+		// notify the recipients. Cases without it only run against the mocks.
+		seed       func(t *testing.T, repos *repositories.Repositories, groupID uuid.UUID)
+		recipients []Recipient
 		wantErr    bool
 	}{
 		{
 			name: "Success",
-			setupMocks: func(mr *MockMessageRepository, fr *MockFCMTokenRepository, ns *MockNotificationService) {
+			setupMocks: func(mr *MockMessageRepository, fr *MockFCMTokenRepository, pr *MockUserPreferencesRepository, gr *MockGroupSettingsRepository, ns *MockNotificationService, groupID uuid.UUID) {
 				// Main message creation should succeed
 				mr.On("CreateMessage", mock.Anything, groupID, mock.Anything).Return(nil)
 
 				// FCM token retrieval should succeed
 				fr.On("GetGroupMemberTokens", mock.Anything, groupID).
-					Return([]string{"token1", "token2"}, nil).
+					Return([]models.FCMToken{
+						{RowKey: preferringUserID.String(), Token: "token1", Locale: "en-US"},
+						{RowKey: otherUserID.String(), Token: "token2", Locale: "nl-NL"},
+						{RowKey: preferringUserID.String(), Token: "token3", Locale: "en-US"},
+					}, nil).
 					Run(func(args mock.Arguments) {
 						// Set up notification expectation after tokens are retrieved
-						ns.On("SendGroupMessage",
+						ns.On("SendGroupMessage", mock.Anything,
 							mock.MatchedBy(func(msg Message) bool {
 								return msg.GroupID == groupID.String() &&
 									msg.SenderID == userID.String() &&
 									msg.SenderName == userName
 							}),
-							[]string{"token1", "token2"},
+							[]Recipient{{Token: "token1", Locale: "nl"}, {Token: "token2", Locale: "nl-NL"}, {Token: "token3", Locale: "nl"}},
 						).Return(&BatchResponse{}, nil)
 					})
+
+				gr.On("GetSettings", mock.Anything, groupID).
+					Return(&models.GroupSettings{GroupID: groupID}, nil)
+
+				// An explicit locale preference overrides the registration locale. The preferences of a user
+				// with several devices are looked up once.
+				pr.On("GetPreferences", mock.Anything, preferringUserID).
+					Return(&models.UserPreferences{UserID: preferringUserID, Locale: "nl"}, nil).Once()
+				pr.On("GetPreferences", mock.Anything, mock.Anything).
+					Return(&models.UserPreferences{}, nil)
 			},
-			wantErr: false,
+			seed: func(t *testing.T, repos *repositories.Repositories, groupID uuid.UUID) {
+				require.NoError(t, repos.FCMTokens.SaveToken(ctx, groupID, preferringUserID, "token1", "en-US"))
+				require.NoError(t, repos.FCMTokens.SaveToken(ctx, groupID, otherUserID, "token2", "nl-NL"))
+				require.NoError(t, repos.UserPreferences.SavePreferences(ctx, &models.UserPreferences{UserID: preferringUserID, Locale: "nl"}))
+			},
+			recipients: []Recipient{{Token: "token1", Locale: "nl"}, {Token: "token2", Locale: "nl-NL"}},
+			wantErr:    false,
+		},
+		{
+			name: "Private Group - Sends Private Notifications",
+			setupMocks: func(mr *MockMessageRepository, fr *MockFCMTokenRepository, pr *MockUserPreferencesRepository, gr *MockGroupSettingsRepository, ns *MockNotificationService, groupID uuid.UUID) {
+				mr.On("CreateMessage", mock.Anything, groupID, mock.Anything).Return(nil)
+
+				fr.On("GetGroupMemberTokens", mock.Anything, groupID).
+					Return([]models.FCMToken{{RowKey: otherUserID.String(), Token: "token1", Locale: "nl"}}, nil).
+					Run(func(args mock.Arguments) {
+						ns.On("SendGroupMessage", mock.Anything,
+							mock.MatchedBy(func(msg Message) bool {
+								return msg.MessageID != ""
+							}),
+							[]Recipient{{Token: "token1", Locale: "nl", Private: true}},
+						).Return(&BatchResponse{}, nil)
+					})
+
+				gr.On("GetSettings", mock.Anything, groupID).
+					Return(&models.GroupSettings{GroupID: groupID, PrivateNotifications: true}, nil)
+				pr.On("GetPreferences", mock.Anything, mock.Anything).
+					Return(&models.UserPreferences{}, nil)
+			},
+			seed: func(t *testing.T, repos *repositories.Repositories, groupID uuid.UUID) {
+				require.NoError(t, repos.GroupSettings.SaveSettings(ctx, &models.GroupSettings{GroupID: groupID, PrivateNotifications: true}))
+				require.NoError(t, repos.FCMTokens.SaveToken(ctx, groupID, otherUserID, "token1", "nl"))
+			},
+			recipients: []Recipient{{Token: "token1", Locale: "nl", Private: true}},
+			wantErr:    false,
 		},
 		{
 			name: "FCM Token Error - Continues Successfully",
-			setupMocks: func(mr *MockMessageRepository, fr *MockFCMTokenRepository, ns *MockNotificationService) {
+			setupMocks: func(mr *MockMessageRepository, fr *MockFCMTokenRepository, pr *MockUserPreferencesRepository, gr *MockGroupSettingsRepository, ns *MockNotificationService, groupID uuid.UUID) {
+				gr.On("GetSettings", mock.Anything, groupID).
+					Return(&models.GroupSettings{GroupID: groupID}, nil)
+
 				// Main message creation should succeed
 				mr.On("CreateMessage", mock.Anything, groupID, mock.Anything).Return(nil)
 
 				// FCM token retrieval should fail
 				fr.On("GetGroupMemberTokens", mock.Anything, groupID).
-					Return([]string{}, errors.New("FCM token error"))
+					Return([]models.FCMToken{}, errors.New("FCM token error"))
 			},
 			wantErr: false,
 		},
 		{
 			name: "Repository Error",
-			setupMocks: func(mr *MockMessageRepository, fr *MockFCMTokenRepository, ns *MockNotificationService) {
+			setupMocks: func(mr *MockMessageRepository, fr *MockFCMTokenRepository, pr *MockUserPreferencesRepository, gr *MockGroupSettingsRepository, ns *MockNotificationService, groupID uuid.UUID) {
+				gr.On("GetSettings", mock.Anything, groupID).
+					Return(&models.GroupSettings{GroupID: groupID}, nil)
 				mr.On("CreateMessage", mock.Anything, groupID, mock.Anything).
 					Return(errors.New("repository error"))
 			},
 			wantErr: true,
 		},
+		{
+			name: "Group Settings Error",
+			setupMocks: func(mr *MockMessageRepository, fr *MockFCMTokenRepository, pr *MockUserPreferencesRepository, gr *MockGroupSettingsRepository, ns *MockNotificationService, groupID uuid.UUID) {
+				gr.On("GetSettings", mock.Anything, groupID).
+					Return((*models.GroupSettings)(nil), errors.New("settings error"))
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockMsgRepo := new(MockMessageRepository)
-			mockFCMRepo := new(MockFCMTokenRepository)
-			mockNotifService := new(MockNotificationService)
-
-			tt.setupMocks(mockMsgRepo, mockFCMRepo, mockNotifService)
-
-			service := NewMessageService(mockMsgRepo, mockFCMRepo, mockNotifService, nil)
-			message, err := service.CreateMessage(ctx, groupID, userID, userName, create)
+			t.Run("mock", func(t *testing.T) {
+				groupID := uuid.New()
+				mockMsgRepo := new(MockMessageRepository)
+				mockFCMRepo := new(MockFCMTokenRepository)
+				mockPrefsRepo := new(MockUserPreferencesRepository)
+				mockSettingsRepo := new(MockGroupSettingsRepository)
+				mockNotifService := new(MockNotificationService)
+
+				tt.setupMocks(mockMsgRepo, mockFCMRepo, mockPrefsRepo, mockSettingsRepo, mockNotifService, groupID)
+
+				service := NewMessageService(mockMsgRepo, mockFCMRepo, mockPrefsRepo, mockSettingsRepo, mockNotifService, nil, newTestCursorCodec(t))
+				message, err := service.CreateMessage(ctx, groupID, userID, userName, models.BadgeNone, create)
+
+				// Small delay to allow goroutines to complete
+				time.Sleep(50 * time.Millisecond)
+
+				if tt.wantErr {
+					assert.Error(t, err)
+					assert.Nil(t, message)
+				} else {
+					assert.NoError(t, err)
+					assert.NotNil(t, message)
+				}
 
-			// Small delay to allow goroutines to complete
-			time.Sleep(50 * time.Millisecond)
+				mockMsgRepo.AssertExpectations(t)
+				mockFCMRepo.AssertExpectations(t)
+				mockNotifService.AssertExpectations(t)
+			})
 
-			if tt.wantErr {
-				assert.Error(t, err)
-				assert.Nil(t, message)
-			} else {
-				assert.NoError(t, err)
-				assert.NotNil(t, message)
+			if tt.seed == nil {
+				return
 			}
-
-			mockMsgRepo.AssertExpectations(t)
-			mockFCMRepo.AssertExpectations(t)
-			mockNotifService.AssertExpectations(t)
+			forEachStorageBackend(t, func(t *testing.T, repos *repositories.Repositories) {
+				groupID := uuid.New()
+				tt.seed(t, repos, groupID)
+
+				// Backends return the tokens of a group in no particular order
+				sent := make(chan []Recipient, 1)
+				mockNotifService := new(MockNotificationService)
+				mockNotifService.On("SendGroupMessage", mock.Anything, mock.Anything, mock.Anything).
+					Run(func(args mock.Arguments) { sent <- args.Get(2).([]Recipient) }).
+					Return(&BatchResponse{}, nil)
+
+				service := NewMessageService(repos.Messages, repos.FCMTokens, repos.UserPreferences, repos.GroupSettings, mockNotifService, NewValidationService(""), newTestCursorCodec(t))
+				message, err := service.CreateMessage(ctx, groupID, userID, userName, models.BadgeNone, create)
+				require.NoError(t, err)
+
+				stored, err := service.GetMessage(ctx, groupID, message.ID)
+				require.NoError(t, err)
+				assert.Equal(t, userName, stored.SenderName)
+
+				select {
+				case recipients := <-sent:
+					assert.ElementsMatch(t, tt.recipients, recipients)
+				case <-time.After(5 * time.Second):
+					t.Fatal("no notification was sent")
+				}
+			})
 		})
 	}
 }
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+// Simulated FCM errors returned by the emulator for tokens matching a failure rule
+var (
+	ErrEmulatedUnregistered    = errors.New("registration-token-not-registered")
+	ErrEmulatedQuotaExceeded   = errors.New("quota-exceeded")
+	ErrEmulatedInvalidArgument = errors.New("invalid-argument")
+	ErrEmulatedUnavailable     = errors.New("unavailable")
+)
+
+var emulatedErrors = map[string]error{
+	"unregistered": ErrEmulatedUnregistered,
+	"quota":        ErrEmulatedQuotaExceeded,
+	"invalid":      ErrEmulatedInvalidArgument,
+	"unavailable":  ErrEmulatedUnavailable,
+}
+
+// maxRecordedNotifications bounds the in-memory recorder so a long-running dev server does not grow forever
+const maxRecordedNotifications = 1000
+
+// EmulatorFailureRule makes the emulator fail every token that starts with TokenPrefix
+type EmulatorFailureRule struct {
+	TokenPrefix string
+	Err         error
+}
+
+// ParseEmulatorFailureRules parses a comma-separated list of kind:tokenPrefix pairs,
+// e.g. "unregistered:stale-,quota:busy-". Known kinds are unregistered, quota, invalid and unavailable.
+func ParseEmulatorFailureRules(spec string) ([]EmulatorFailureRule, error) {
+	var rules []EmulatorFailureRule
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kind, prefix, found := strings.Cut(entry, ":")
+		if !found || prefix == "" {
+			return nil, fmt.Errorf("invalid failure rule %q: expected kind:tokenPrefix", entry)
+		}
+
+		err, ok := emulatedErrors[strings.ToLower(kind)]
+		if !ok {
+			return nil, fmt.Errorf("unknown failure kind %q", kind)
+		}
+
+		rules = append(rules, EmulatorFailureRule{TokenPrefix: prefix, Err: err})
+	}
+	return rules, nil
+}
+
+// RecordedNotification is a multicast message captured by the emulator
+type RecordedNotification struct {
+	SentAt  time.Time          `json:"sentAt"`
+	Tokens  []string           `json:"tokens"`
+	Title   string             `json:"title"`
+	Body    string             `json:"body"`
+	Data    map[string]string  `json:"data,omitempty"`
+	Badge   *int               `json:"badge,omitempty"`
+	Results []RecordedDelivery `json:"results"`
+}
+
+// RecordedDelivery is the simulated outcome for a single device token
+type RecordedDelivery struct {
+	Token   string `json:"token"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NotificationRecorder gives access to the notifications captured by the emulator
+type NotificationRecorder interface {
+	Recorded() ([]RecordedNotification, error)
+	Reset() error
+}
+
+type notificationStore interface {
+	append(notification RecordedNotification) error
+	NotificationRecorder
+}
+
+// EmulatorSender is a MulticastSender that records outgoing messages instead of delivering them
+type EmulatorSender struct {
+	store notificationStore
+	rules []EmulatorFailureRule
+}
+
+// NewMemoryEmulatorSender records notifications in memory
+func NewMemoryEmulatorSender(rules []EmulatorFailureRule) *EmulatorSender {
+	return &EmulatorSender{store: &memoryNotificationStore{}, rules: rules}
+}
+
+// NewFileEmulatorSender appends notifications as JSON lines to the given file
+func NewFileEmulatorSender(path string, rules []EmulatorFailureRule) (*EmulatorSender, error) {
+	if path == "" {
+		return nil, errors.New("emulator file path is required")
+	}
+	return &EmulatorSender{store: &fileNotificationStore{path: path}, rules: rules}, nil
+}
+
+func (s *EmulatorSender) SendEachForMulticast(_ context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+	record := RecordedNotification{
+		SentAt: time.Now().UTC(),
+		Tokens: message.Tokens,
+		Data:   message.Data,
+	}
+	if message.Notification != nil {
+		record.Title = message.Notification.Title
+		record.Body = message.Notification.Body
+	}
+	if message.APNS != nil && message.APNS.Payload != nil && message.APNS.Payload.Aps != nil {
+		record.Badge = message.APNS.Payload.Aps.Badge
+	}
+
+	response := &messaging.BatchResponse{}
+	for i, token := range message.Tokens {
+		delivery := RecordedDelivery{Token: token, Success: true}
+		sendResponse := &messaging.SendResponse{Success: true, MessageID: fmt.Sprintf("emulator/%d/%d", record.SentAt.UnixNano(), i)}
+
+		if err := s.failureFor(token); err != nil {
+			delivery = RecordedDelivery{Token: token, Error: err.Error()}
+			sendResponse = &messaging.SendResponse{Error: err}
+			response.FailureCount++
+		} else {
+			response.SuccessCount++
+		}
+
+		record.Results = append(record.Results, delivery)
+		response.Responses = append(response.Responses, sendResponse)
+	}
+
+	if err := s.store.append(record); err != nil {
+		return nil, fmt.Errorf("error recording notification: %w", err)
+	}
+
+	return response, nil
+}
+
+func (s *EmulatorSender) failureFor(token string) error {
+	for _, rule := range s.rules {
+		if strings.HasPrefix(token, rule.TokenPrefix) {
+			return rule.Err
+		}
+	}
+	return nil
+}
+
+func (s *EmulatorSender) Recorded() ([]RecordedNotification, error) {
+	return s.store.Recorded()
+}
+
+func (s *EmulatorSender) Reset() error {
+	return s.store.Reset()
+}
+
+type memoryNotificationStore struct {
+	mu            sync.Mutex
+	notifications []RecordedNotification
+}
+
+func (m *memoryNotificationStore) append(notification RecordedNotification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.notifications = append(m.notifications, notification)
+	if len(m.notifications) > maxRecordedNotifications {
+		m.notifications = m.notifications[len(m.notifications)-maxRecordedNotifications:]
+	}
+	return nil
+}
+
+func (m *memoryNotificationStore) Recorded() ([]RecordedNotification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]RecordedNotification{}, m.notifications...), nil
+}
+
+func (m *memoryNotificationStore) Reset() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.notifications = nil
+	return nil
+}
+
+type fileNotificationStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (f *fileNotificationStore) append(notification RecordedNotification) error {
+	line, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func (f *fileNotificationStore) Recorded() ([]RecordedNotification, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []RecordedNotification{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	notifications := []RecordedNotification{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var notification RecordedNotification
+		if err := json.Unmarshal(scanner.Bytes(), &notification); err != nil {
+			return nil, fmt.Errorf("error parsing recorded notification: %w", err)
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, scanner.Err()
+}
+
+func (f *fileNotificationStore) Reset() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"Groupchat-Service/internal/database/repositories"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"log"
@@ -13,13 +14,14 @@ import (
 	"google.golang.org/api/option"
 )
 
-type FCMNotificationService struct {
-	client      *messaging.Client
-	ctx         context.Context
-	messageRepo repositories.MessageRepository
+// MulticastSender delivers a multicast message. It is implemented by the Firebase messaging client
+// and by the EmulatorSender used for local development and tests.
+type MulticastSender interface {
+	SendEachForMulticast(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error)
 }
 
-func NewNotificationService(credentialFile string, messageRepo repositories.MessageRepository) (*FCMNotificationService, error) {
+// NewFCMSender creates a Firebase messaging client from the JSON service account credentials
+func NewFCMSender(credentialFile string) (MulticastSender, error) {
 	ctx := context.Background()
 
 	// Parse the JSON string into a map
@@ -40,14 +42,25 @@ func NewNotificationService(credentialFile string, messageRepo repositories.Mess
 		return nil, fmt.Errorf("error getting messaging client: %v", err)
 	}
 
+	return client, nil
+}
+
+type FCMNotificationService struct {
+	client      MulticastSender
+	messageRepo repositories.MessageRepository
+	templates   *TemplateCatalogue
+}
+
+func NewNotificationService(sender MulticastSender, messageRepo repositories.MessageRepository, templates *TemplateCatalogue) *FCMNotificationService {
 	return &FCMNotificationService{
-		client:      client,
-		ctx:         ctx,
+		client:      sender,
 		messageRepo: messageRepo,
-	}, nil
+		templates:   templates,
+	}
 }
 
 type Message struct {
+	MessageID  string `json:"messageId"`
 	SenderID   string `json:"senderId"`
 	SenderName string `json:"senderName"`
 	Content    string `json:"content"`
@@ -55,21 +68,64 @@ type Message struct {
 	Timestamp  int64  `json:"timestamp"`
 }
 
+// Recipient is a device that should receive a notification, with the locale it should be rendered in.
+// Private recipients only get a generic notification and the message ID, never the message content.
+type Recipient struct {
+	Token   string
+	Locale  string
+	Private bool
+}
+
+// recipientGroup identifies devices that can share one multicast message
+type recipientGroup struct {
+	locale  string
+	private bool
+}
+
 type BatchResponse struct {
 	SuccessCount  int
 	FailureCount  int
 	InvalidTokens []string
 }
 
-func (s *FCMNotificationService) SendGroupMessage(message Message, deviceTokens []string) (*BatchResponse, error) {
-	notification := s.createNotification(message)
-	data := s.createData(message)
-
-	batchSize := 500
+func (s *FCMNotificationService) SendGroupMessage(ctx context.Context, message Message, recipients []Recipient) (*BatchResponse, error) {
 	response := &BatchResponse{
 		InvalidTokens: make([]string, 0),
 	}
 
+	for group, deviceTokens := range s.groupRecipients(recipients) {
+		notification, err := s.createNotification(message, group)
+		if err != nil {
+			return response, err
+		}
+
+		data := s.createData(message, group.private)
+		if err := s.sendInBatches(ctx, message, notification, data, deviceTokens, response); err != nil {
+			return response, err
+		}
+	}
+
+	log.Printf("Message sending complete. Success: %d, Failure: %d, Invalid Tokens: %d",
+		response.SuccessCount, response.FailureCount, len(response.InvalidTokens))
+
+	return response, nil
+}
+
+// groupRecipients buckets device tokens by the catalogue locale and privacy mode of their notification
+func (s *FCMNotificationService) groupRecipients(recipients []Recipient) map[recipientGroup][]string {
+	groups := make(map[recipientGroup][]string)
+	for _, recipient := range recipients {
+		group := recipientGroup{
+			locale:  s.templates.ResolveLocale(recipient.Locale),
+			private: recipient.Private,
+		}
+		groups[group] = append(groups[group], recipient.Token)
+	}
+	return groups
+}
+
+func (s *FCMNotificationService) sendInBatches(ctx context.Context, message Message, notification *messaging.Notification, data map[string]string, deviceTokens []string, response *BatchResponse) error {
+	batchSize := 500
 	for i := 0; i < len(deviceTokens); i += batchSize {
 		end := i + batchSize
 		if end > len(deviceTokens) {
@@ -78,37 +134,55 @@ func (s *FCMNotificationService) SendGroupMessage(message Message, deviceTokens
 
 		batch := deviceTokens[i:end]
 
-		badgeNumber, err := s.getBadgeNumber(message.GroupID, message.SenderID)
+		badgeNumber, err := s.getBadgeNumber(ctx, message.GroupID, message.SenderID)
 		if err != nil {
-			return response, err
+			return err
 		}
 
 		batchMessage := s.createBatchMessage(batch, notification, data, badgeNumber)
 
-		batchResponse, err := s.client.SendEachForMulticast(s.ctx, batchMessage)
+		batchResponse, err := s.client.SendEachForMulticast(ctx, batchMessage)
 		if err != nil {
-			return response, fmt.Errorf("error sending batch: %v", err)
+			return fmt.Errorf("error sending batch: %v", err)
 		}
 
 		s.processBatchResponse(batchResponse, batch, response)
 	}
 
-	log.Printf("Message sending complete. Success: %d, Failure: %d, Invalid Tokens: %d",
-		response.SuccessCount, response.FailureCount, len(response.InvalidTokens))
-
-	return response, nil
+	return nil
 }
 
-func (s *FCMNotificationService) createNotification(message Message) *messaging.Notification {
-	return &messaging.Notification{
-		Title: fmt.Sprintf("New message from %s", message.SenderName),
-		Body:  message.Content,
+func (s *FCMNotificationService) createNotification(message Message, group recipientGroup) (*messaging.Notification, error) {
+	notificationType := NotificationTypeGroupMessage
+	if group.private {
+		notificationType = NotificationTypeGroupMessagePrivate
 	}
+
+	title, body, err := s.templates.Render(group.locale, notificationType, message)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering notification: %v", err)
+	}
+
+	return &messaging.Notification{
+		Title: title,
+		Body:  body,
+	}, nil
 }
 
-func (s *FCMNotificationService) createData(message Message) map[string]string {
+// createData builds the data payload. Private payloads only carry the identifiers the client
+// needs to fetch the message over the authenticated API.
+func (s *FCMNotificationService) createData(message Message, private bool) map[string]string {
+	if private {
+		return map[string]string{
+			"groupId":   message.GroupID,
+			"messageId": message.MessageID,
+			"type":      NotificationTypeGroupMessagePrivate,
+		}
+	}
+
 	return map[string]string{
 		"groupId":    message.GroupID,
+		"messageId":  message.MessageID,
 		"senderId":   message.SenderID,
 		"senderName": message.SenderName,
 		"timestamp":  fmt.Sprintf("%d", message.Timestamp),
@@ -116,13 +190,13 @@ func (s *FCMNotificationService) createData(message Message) map[string]string {
 	}
 }
 
-func (s *FCMNotificationService) getBadgeNumber(groupID, senderID string) (int, error) {
-	lastReadTime, err := s.messageRepo.GetLastReadTime(s.ctx, uuid.MustParse(groupID), uuid.MustParse(senderID))
+func (s *FCMNotificationService) getBadgeNumber(ctx context.Context, groupID, senderID string) (int, error) {
+	lastReadTime, err := s.messageRepo.GetLastReadTime(ctx, uuid.MustParse(groupID), uuid.MustParse(senderID))
 	if err != nil {
 		return 0, fmt.Errorf("error getting last read time: %v", err)
 	}
 
-	badgeNumber, err := s.messageRepo.CountUnreadMessages(s.ctx, uuid.MustParse(groupID), lastReadTime)
+	badgeNumber, err := s.messageRepo.CountUnreadMessages(ctx, uuid.MustParse(groupID), lastReadTime)
 	if err != nil {
 		return 0, fmt.Errorf("error counting unread messages: %v", err)
 	}
@@ -166,10 +240,15 @@ func (s *FCMNotificationService) processBatchResponse(batchResponse *messaging.B
 
 	for idx, resp := range batchResponse.Responses {
 		if !resp.Success {
-			if resp.Error != nil && resp.Error.Error() == "registration-token-not-registered" {
+			if isUnregisteredTokenError(resp.Error) {
 				response.InvalidTokens = append(response.InvalidTokens, batch[idx])
 				log.Printf("Invalid token found: %s", batch[idx])
 			}
 		}
 	}
 }
+
+// isUnregisteredTokenError reports whether FCM (or the emulator) rejected a token because the app was uninstalled
+func isUnregisteredTokenError(err error) bool {
+	return err != nil && (messaging.IsUnregistered(err) || errors.Is(err, ErrEmulatedUnregistered))
+}
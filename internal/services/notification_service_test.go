@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupEmulatedNotificationService(t *testing.T, rules []EmulatorFailureRule) (*FCMNotificationService, *EmulatorSender) {
+	mockMsgRepo := new(MockMessageRepository)
+	mockMsgRepo.On("GetLastReadTime", mock.Anything, mock.Anything, mock.Anything).Return(time.Now(), nil)
+	mockMsgRepo.On("CountUnreadMessages", mock.Anything, mock.Anything, mock.Anything).Return(3, nil)
+
+	templates, err := NewTemplateCatalogue("", "nl")
+	require.NoError(t, err)
+
+	emulator := NewMemoryEmulatorSender(rules)
+	return NewNotificationService(emulator, mockMsgRepo, templates), emulator
+}
+
+func TestSendGroupMessageWithEmulator(t *testing.T) {
+	message := Message{
+		MessageID:  uuid.New().String(),
+		SenderID:   uuid.New().String(),
+		SenderName: "Anna",
+		Content:    "Ik voel me vandaag beter",
+		GroupID:    uuid.New().String(),
+		Timestamp:  time.Now().Unix(),
+	}
+
+	t.Run("Records localised and private notifications", func(t *testing.T) {
+		service, emulator := setupEmulatedNotificationService(t, nil)
+
+		response, err := service.SendGroupMessage(context.Background(), message, []Recipient{
+			{Token: "token-en", Locale: "en"},
+			{Token: "token-private", Locale: "nl", Private: true},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, response.SuccessCount)
+
+		recorded, err := emulator.Recorded()
+		require.NoError(t, err)
+		require.Len(t, recorded, 2)
+
+		for _, notification := range recorded {
+			switch notification.Tokens[0] {
+			case "token-en":
+				assert.Equal(t, "New message from Anna", notification.Title)
+				assert.Equal(t, message.Content, notification.Body)
+				assert.Equal(t, 3, *notification.Badge)
+			case "token-private":
+				assert.Equal(t, "Nieuw bericht in je steungroep", notification.Title)
+				assert.Empty(t, notification.Body)
+				assert.Equal(t, map[string]string{
+					"groupId":   message.GroupID,
+					"messageId": message.MessageID,
+					"type":      NotificationTypeGroupMessagePrivate,
+				}, notification.Data)
+			default:
+				t.Fatalf("unexpected token %v", notification.Tokens)
+			}
+		}
+	})
+
+	t.Run("Reports simulated failures", func(t *testing.T) {
+		rules, err := ParseEmulatorFailureRules("unregistered:stale-,quota:busy-")
+		require.NoError(t, err)
+		service, emulator := setupEmulatedNotificationService(t, rules)
+
+		response, err := service.SendGroupMessage(context.Background(), message, []Recipient{
+			{Token: "valid"},
+			{Token: "stale-1"},
+			{Token: "busy-1"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, response.SuccessCount)
+		assert.Equal(t, 2, response.FailureCount)
+		assert.Equal(t, []string{"stale-1"}, response.InvalidTokens)
+
+		require.NoError(t, emulator.Reset())
+		recorded, err := emulator.Recorded()
+		require.NoError(t, err)
+		assert.Empty(t, recorded)
+	})
+}
+
+func TestFileEmulatorSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.jsonl")
+	emulator, err := NewFileEmulatorSender(path, nil)
+	require.NoError(t, err)
+
+	templates, err := NewTemplateCatalogue("", "nl")
+	require.NoError(t, err)
+	mockMsgRepo := new(MockMessageRepository)
+	mockMsgRepo.On("GetLastReadTime", mock.Anything, mock.Anything, mock.Anything).Return(time.Now(), nil)
+	mockMsgRepo.On("CountUnreadMessages", mock.Anything, mock.Anything, mock.Anything).Return(0, nil)
+	service := NewNotificationService(emulator, mockMsgRepo, templates)
+
+	message := Message{SenderID: uuid.New().String(), GroupID: uuid.New().String(), SenderName: "Anna"}
+	_, err = service.SendGroupMessage(context.Background(), message, []Recipient{{Token: "a"}, {Token: "b"}})
+	require.NoError(t, err)
+
+	recorded, err := emulator.Recorded()
+	require.NoError(t, err)
+	require.Len(t, recorded, 1)
+	assert.ElementsMatch(t, []string{"a", "b"}, recorded[0].Tokens)
+}
+
+func TestParseEmulatorFailureRules(t *testing.T) {
+	_, err := ParseEmulatorFailureRules("teapot:x-")
+	assert.Error(t, err)
+
+	_, err = ParseEmulatorFailureRules("quota")
+	assert.Error(t, err)
+
+	rules, err := ParseEmulatorFailureRules("")
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/text/language"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// Notification types used as keys in the template catalogue
+const (
+	NotificationTypeGroupMessage        = "group_message"
+	NotificationTypeGroupMessagePrivate = "group_message_private"
+)
+
+//go:embed templates/*.json
+var defaultTemplates embed.FS
+
+// NotificationTemplate holds the raw title and body templates for one notification type
+type NotificationTemplate struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type compiledTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+// TemplateCatalogue renders localised notification titles and bodies.
+// Templates are keyed by locale and notification type.
+type TemplateCatalogue struct {
+	defaultLocale string
+	templates     map[string]map[string]*compiledTemplate
+}
+
+// NewTemplateCatalogue loads the built-in templates and overlays any <locale>.json files found in dir.
+// An empty dir only uses the built-in templates.
+func NewTemplateCatalogue(dir string, defaultLocale string) (*TemplateCatalogue, error) {
+	catalogue := &TemplateCatalogue{
+		defaultLocale: normalizeLocale(defaultLocale),
+		templates:     make(map[string]map[string]*compiledTemplate),
+	}
+
+	if err := catalogue.loadFS(defaultTemplates, "templates"); err != nil {
+		return nil, fmt.Errorf("error loading built-in templates: %w", err)
+	}
+
+	if dir != "" {
+		if err := catalogue.loadFS(os.DirFS(dir), "."); err != nil {
+			return nil, fmt.Errorf("error loading templates from %s: %w", dir, err)
+		}
+	}
+
+	if _, ok := catalogue.templates[catalogue.defaultLocale]; !ok {
+		return nil, fmt.Errorf("no templates found for default locale %q", defaultLocale)
+	}
+
+	return catalogue, nil
+}
+
+func (c *TemplateCatalogue) loadFS(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+
+		var raw map[string]NotificationTemplate
+		if err := json.Unmarshal(content, &raw); err != nil {
+			return fmt.Errorf("error parsing %s: %w", file, err)
+		}
+
+		locale := normalizeLocale(strings.TrimSuffix(path.Base(file), ".json"))
+		if _, ok := c.templates[locale]; !ok {
+			c.templates[locale] = make(map[string]*compiledTemplate)
+		}
+
+		for notificationType, tmpl := range raw {
+			compiled, err := compileTemplate(locale+"."+notificationType, tmpl)
+			if err != nil {
+				return fmt.Errorf("error compiling %s: %w", file, err)
+			}
+			c.templates[locale][notificationType] = compiled
+		}
+	}
+
+	return nil
+}
+
+func compileTemplate(name string, tmpl NotificationTemplate) (*compiledTemplate, error) {
+	title, err := template.New(name + ".title").Option("missingkey=error").Parse(tmpl.Title)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := template.New(name + ".body").Option("missingkey=error").Parse(tmpl.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compiledTemplate{title: title, body: body}, nil
+}
+
+// ResolveLocale maps a requested locale to the closest locale available in the catalogue.
+// It tries an exact match first, then the base language, then the default locale.
+func (c *TemplateCatalogue) ResolveLocale(locale string) string {
+	normalized := normalizeLocale(locale)
+	if _, ok := c.templates[normalized]; ok {
+		return normalized
+	}
+
+	if tag, err := language.Parse(normalized); err == nil {
+		base, _ := tag.Base()
+		if _, ok := c.templates[base.String()]; ok {
+			return base.String()
+		}
+	}
+
+	return c.defaultLocale
+}
+
+// Render executes the title and body templates of a notification type for the given locale.
+// A notification type missing from the resolved locale falls back to the default locale.
+func (c *TemplateCatalogue) Render(locale string, notificationType string, data any) (string, string, error) {
+	tmpl, ok := c.templates[c.ResolveLocale(locale)][notificationType]
+	if !ok {
+		tmpl, ok = c.templates[c.defaultLocale][notificationType]
+		if !ok {
+			return "", "", fmt.Errorf("no template for notification type %q", notificationType)
+		}
+	}
+
+	var title, body bytes.Buffer
+	if err := tmpl.title.Execute(&title, data); err != nil {
+		return "", "", fmt.Errorf("error rendering title: %w", err)
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("error rendering body: %w", err)
+	}
+
+	return title.String(), body.String(), nil
+}
+
+// PreferredLocale returns the most preferred language tag from an Accept-Language header,
+// or an empty string when the header is missing or malformed
+func PreferredLocale(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return ""
+	}
+	return tags[0].String()
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(locale)), "_", "-")
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateCatalogue(t *testing.T) {
+	message := Message{SenderName: "Anna", Content: "Hallo allemaal"}
+
+	tests := []struct {
+		name          string
+		locale        string
+		expectedTitle string
+	}{
+		{name: "Exact locale", locale: "en", expectedTitle: "New message from Anna"},
+		{name: "Regional locale falls back to base language", locale: "nl-BE", expectedTitle: "Nieuw bericht van Anna"},
+		{name: "Unknown locale falls back to default", locale: "fr-FR", expectedTitle: "Nieuw bericht van Anna"},
+		{name: "Missing locale falls back to default", locale: "", expectedTitle: "Nieuw bericht van Anna"},
+	}
+
+	catalogue, err := NewTemplateCatalogue("", "nl")
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, body, err := catalogue.Render(tt.locale, NotificationTypeGroupMessage, message)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedTitle, title)
+			assert.Equal(t, "Hallo allemaal", body)
+		})
+	}
+}
+
+func TestTemplateCatalogueOverrides(t *testing.T) {
+	dir := t.TempDir()
+	override := `{"group_message": {"title": "Nieuw van {{.SenderName}}", "body": "{{.Content}}"}}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nl.json"), []byte(override), 0o600))
+	german := `{"group_message": {"title": "Neue Nachricht von {{.SenderName}}", "body": "{{.Content}}"}}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "de.json"), []byte(german), 0o600))
+
+	catalogue, err := NewTemplateCatalogue(dir, "nl")
+	require.NoError(t, err)
+
+	title, _, err := catalogue.Render("nl", NotificationTypeGroupMessage, Message{SenderName: "Anna"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Nieuw van Anna", title)
+
+	title, _, err = catalogue.Render("de-DE", NotificationTypeGroupMessage, Message{SenderName: "Anna"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Neue Nachricht von Anna", title)
+}
+
+func TestTemplateCatalogueUnknownDefaultLocale(t *testing.T) {
+	_, err := NewTemplateCatalogue("", "fr")
+	assert.Error(t, err)
+}
+
+func TestPreferredLocale(t *testing.T) {
+	assert.Equal(t, "nl-NL", PreferredLocale("en;q=0.5, nl-NL"))
+	assert.Equal(t, "", PreferredLocale(""))
+}
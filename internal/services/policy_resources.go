@@ -0,0 +1,35 @@
+package services
+
+import (
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/policy"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+)
+
+// policyResources looks up the messages and group settings that access policy conditions are checked against
+type policyResources struct {
+	messageRepo       repositories.MessageRepository
+	groupSettingsRepo repositories.GroupSettingsRepository
+}
+
+func NewPolicyResources(messageRepo repositories.MessageRepository, groupSettingsRepo repositories.GroupSettingsRepository) policy.Resources {
+	return &policyResources{messageRepo: messageRepo, groupSettingsRepo: groupSettingsRepo}
+}
+
+func (r *policyResources) MessageSender(ctx context.Context, groupID uuid.UUID, messageID uuid.UUID) (uuid.UUID, error) {
+	message, err := r.messageRepo.GetMessageByID(ctx, groupID, messageID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return uuid.Nil, nil
+		}
+		return uuid.Nil, err
+	}
+	return message.SenderID, nil
+}
+
+func (r *policyResources) GroupSettings(ctx context.Context, groupID uuid.UUID) (*models.GroupSettings, error) {
+	return r.groupSettingsRepo.GetSettings(ctx, groupID)
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"slices"
+	"time"
+)
+
+// MaxRetentionDays is the longest retention period a group can configure
+const MaxRetentionDays = 3650
+
+// ErrInvalidRetentionDays is returned for retention periods outside 0..MaxRetentionDays
+var ErrInvalidRetentionDays = fmt.Errorf("retentionDays must be between 0 (keep forever) and %d", MaxRetentionDays)
+
+var (
+	retentionPurgedMessagesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "retention_purged_messages_total",
+			Help: "Total number of messages purged by the retention job, by mode (delete or dry_run)",
+		},
+		[]string{"mode"},
+	)
+
+	retentionRunsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "retention_purge_runs_total",
+			Help: "Total number of retention purge runs by result",
+		},
+		[]string{"result"},
+	)
+
+	retentionRunDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "retention_purge_duration_seconds",
+			Help:    "Duration of retention purge runs in seconds",
+			Buckets: []float64{.1, .5, 1, 5, 15, 60, 300, 900},
+		},
+	)
+
+	retentionLastSuccess = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "retention_purge_last_success_timestamp_seconds",
+			Help: "Unix time of the last retention purge run that completed without errors",
+		},
+	)
+)
+
+type RetentionConfig struct {
+	// BatchSize is the number of messages deleted and audited together
+	BatchSize int
+}
+
+type retentionService struct {
+	messageRepo repositories.MessageRepository
+	// archive is nil when the archive is not enabled
+	archive           *repositories.MessageArchive
+	groupSettingsRepo repositories.GroupSettingsRepository
+	auditRepo         repositories.PurgeAuditRepository
+	config            RetentionConfig
+	logger            util.Logger
+	now               func() time.Time
+}
+
+// NewRetentionService purges the messages of the hot store and, when archive is not nil, the archived ones
+func NewRetentionService(
+	messageRepo repositories.MessageRepository,
+	archive *repositories.MessageArchive,
+	groupSettingsRepo repositories.GroupSettingsRepository,
+	auditRepo repositories.PurgeAuditRepository,
+	config RetentionConfig,
+	loggerFactory util.LoggerFactory,
+) RetentionService {
+	return &retentionService{
+		messageRepo:       messageRepo,
+		archive:           archive,
+		groupSettingsRepo: groupSettingsRepo,
+		auditRepo:         auditRepo,
+		config:            config,
+		logger:            loggerFactory.NewLogger("RetentionService"),
+		now:               time.Now,
+	}
+}
+
+// StartRetentionScheduler purges expired messages every interval until the context is cancelled
+func StartRetentionScheduler(ctx context.Context, service RetentionService, interval time.Duration, dryRun bool) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := service.PurgeExpiredMessages(ctx, dryRun); err != nil {
+					fmt.Printf("Error purging expired messages: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// PurgeExpiredMessages deletes the messages of every group with a retention period that are older than
+// that period, in batches, and records an audit entry per deleted batch. Archived messages are deleted
+// as well. A dry run only counts them.
+// A failure for one group is logged and does not stop the others; the failures are returned together.
+func (s *retentionService) PurgeExpiredMessages(ctx context.Context, dryRun bool) ([]models.RetentionReport, error) {
+	start := s.now()
+	reports, err := s.purge(ctx, dryRun, start)
+
+	retentionRunDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		retentionRunsTotal.WithLabelValues("failure").Inc()
+		return reports, err
+	}
+	retentionRunsTotal.WithLabelValues("success").Inc()
+	retentionLastSuccess.SetToCurrentTime()
+	return reports, nil
+}
+
+func (s *retentionService) purge(ctx context.Context, dryRun bool, runStart time.Time) ([]models.RetentionReport, error) {
+	policies, err := s.groupSettingsRepo.ListRetentionPolicies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing retention policies: %w", err)
+	}
+
+	runID := uuid.New()
+	reports := make([]models.RetentionReport, 0, len(policies))
+	var errs []error
+	for i := range policies {
+		report, err := s.purgeGroup(ctx, &policies[i], runID, runStart, dryRun)
+		reports = append(reports, *report)
+		if err != nil {
+			s.logger.Error("Failed to purge expired messages", "groupID", policies[i].GroupID, "error", err)
+			errs = append(errs, fmt.Errorf("group %s: %w", policies[i].GroupID, err))
+		}
+	}
+
+	purged := 0
+	for _, report := range reports {
+		purged += report.MessageCount
+	}
+	s.logger.Info("Retention purge run complete", "runID", runID, "dryRun", dryRun, "groups", len(policies), "messages", purged)
+	return reports, errors.Join(errs...)
+}
+
+func (s *retentionService) purgeGroup(ctx context.Context, policy *models.GroupSettings, runID uuid.UUID, runStart time.Time, dryRun bool) (*models.RetentionReport, error) {
+	report := &models.RetentionReport{
+		GroupID:    policy.GroupID,
+		Cutoff:     runStart.AddDate(0, 0, -policy.RetentionDays).UTC(),
+		KeepPinned: policy.RetentionKeepPinned,
+		DryRun:     dryRun,
+	}
+	mode := "delete"
+	if dryRun {
+		mode = "dry_run"
+	}
+
+	query := models.RetentionQuery{Before: report.Cutoff, KeepPinned: policy.RetentionKeepPinned, Limit: s.config.BatchSize}
+	for {
+		batch, err := s.messageRepo.ListExpiredMessages(ctx, policy.GroupID, query)
+		if err != nil {
+			return report, fmt.Errorf("error listing expired messages: %w", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		if !dryRun {
+			if err := s.messageRepo.DeleteMessages(ctx, policy.GroupID, batch); err != nil {
+				return report, fmt.Errorf("error deleting messages: %w", err)
+			}
+			if err := s.recordPurge(ctx, report, runID, batch); err != nil {
+				return report, err
+			}
+		}
+
+		report.MessageCount += len(batch)
+		retentionPurgedMessagesTotal.WithLabelValues(mode).Add(float64(len(batch)))
+
+		last := batch[len(batch)-1]
+		query.Position = &models.MessageCursor{SentAt: last.SentAt, MessageID: last.ID}
+	}
+
+	if s.archive == nil {
+		return report, nil
+	}
+	return report, s.purgeArchive(ctx, policy, report, runID, dryRun, mode)
+}
+
+// purgeArchive deletes the expired messages of the group's archive a month at a time. Every month is
+// rewritten once and its messages are audited in batches like those of the hot store.
+func (s *retentionService) purgeArchive(ctx context.Context, policy *models.GroupSettings, report *models.RetentionReport, runID uuid.UUID, dryRun bool, mode string) error {
+	months, err := s.archive.ExpiredMonths(ctx, policy.GroupID, report.Cutoff)
+	if err != nil {
+		return fmt.Errorf("error listing archived months: %w", err)
+	}
+
+	for _, month := range months {
+		expired, err := s.archive.ExpiredMessages(ctx, policy.GroupID, month, report.Cutoff, policy.RetentionKeepPinned)
+		if err != nil {
+			return fmt.Errorf("error listing expired archived messages: %w", err)
+		}
+		if len(expired) == 0 {
+			continue
+		}
+
+		if !dryRun {
+			if err := s.archive.RemoveMessages(ctx, policy.GroupID, month, expired); err != nil {
+				return fmt.Errorf("error deleting archived messages: %w", err)
+			}
+			for batch := range slices.Chunk(expired, s.config.BatchSize) {
+				if err := s.recordPurge(ctx, report, runID, batch); err != nil {
+					return err
+				}
+			}
+		}
+
+		report.MessageCount += len(expired)
+		retentionPurgedMessagesTotal.WithLabelValues(mode).Add(float64(len(expired)))
+	}
+	return nil
+}
+
+func (s *retentionService) recordPurge(ctx context.Context, report *models.RetentionReport, runID uuid.UUID, batch []models.Message) error {
+	audit := &models.PurgeAudit{
+		ID:         uuid.New(),
+		RunID:      runID,
+		GroupID:    report.GroupID,
+		PurgedAt:   s.now().UTC(),
+		Cutoff:     report.Cutoff,
+		KeepPinned: report.KeepPinned,
+		MessageIDs: make([]uuid.UUID, 0, len(batch)),
+	}
+	for _, message := range batch {
+		audit.MessageIDs = append(audit.MessageIDs, message.ID)
+	}
+
+	if err := s.auditRepo.RecordPurge(ctx, audit); err != nil {
+		return fmt.Errorf("error recording purge audit: %w", err)
+	}
+	return nil
+}
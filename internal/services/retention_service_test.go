@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeExpiredMessages(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	setup := func(t *testing.T) (*repositories.Repositories, *retentionService, uuid.UUID, map[string]models.Message) {
+		repos := repositories.NewMemoryRepositories()
+		service := NewRetentionService(repos.Messages, nil, repos.GroupSettings, repos.PurgeAudits,
+			RetentionConfig{BatchSize: 2}, util.NewLoggerFactory()).(*retentionService)
+		service.now = func() time.Time { return now }
+
+		groupID := uuid.New()
+		require.NoError(t, repos.GroupSettings.SaveSettings(ctx,
+			&models.GroupSettings{GroupID: groupID, RetentionDays: 30, RetentionKeepPinned: true}))
+		// Groups without a retention period keep everything
+		require.NoError(t, repos.GroupSettings.SaveSettings(ctx, &models.GroupSettings{GroupID: uuid.New()}))
+
+		messages := make(map[string]models.Message)
+		for name, age := range map[string]time.Duration{"old1": 40, "old2": 35, "old3": 31, "pinned": 60, "recent": 10} {
+			message := models.Message{ID: uuid.New(), GroupID: groupID, SenderID: uuid.New(), SenderName: "Anna",
+				Content: "bericht " + name, SentAt: now.Add(-age * 24 * time.Hour)}
+			require.NoError(t, repos.Messages.CreateMessage(ctx, groupID, &message))
+			messages[name] = message
+		}
+		_, err := repos.Messages.ToggleMessagePin(ctx, groupID, messages["pinned"].ID, "")
+		require.NoError(t, err)
+
+		return repos, service, groupID, messages
+	}
+
+	t.Run("Deletes expired messages in audited batches and keeps pins", func(t *testing.T) {
+		repos, service, groupID, messages := setup(t)
+
+		reports, err := service.PurgeExpiredMessages(ctx, false)
+		require.NoError(t, err)
+		require.Len(t, reports, 1)
+		assert.Equal(t, groupID, reports[0].GroupID)
+		assert.Equal(t, 3, reports[0].MessageCount)
+		assert.Equal(t, now.AddDate(0, 0, -30), reports[0].Cutoff)
+		assert.False(t, reports[0].DryRun)
+
+		for _, name := range []string{"old1", "old2", "old3"} {
+			_, err := repos.Messages.GetMessageByID(ctx, groupID, messages[name].ID)
+			assert.ErrorIs(t, err, repositories.ErrNotFound, name)
+		}
+		for _, name := range []string{"pinned", "recent"} {
+			_, err := repos.Messages.GetMessageByID(ctx, groupID, messages[name].ID)
+			assert.NoError(t, err, name)
+		}
+
+		audits, err := repos.PurgeAudits.ListPurges(ctx, groupID)
+		require.NoError(t, err)
+		require.Len(t, audits, 2, "one audit record per batch")
+		var purged []uuid.UUID
+		for _, audit := range audits {
+			assert.Equal(t, audits[0].RunID, audit.RunID)
+			assert.True(t, audit.KeepPinned)
+			purged = append(purged, audit.MessageIDs...)
+		}
+		assert.ElementsMatch(t, []uuid.UUID{messages["old1"].ID, messages["old2"].ID, messages["old3"].ID}, purged)
+	})
+
+	t.Run("Dry run reports without deleting", func(t *testing.T) {
+		repos, service, groupID, messages := setup(t)
+
+		reports, err := service.PurgeExpiredMessages(ctx, true)
+		require.NoError(t, err)
+		require.Len(t, reports, 1)
+		assert.Equal(t, 3, reports[0].MessageCount)
+		assert.True(t, reports[0].DryRun)
+
+		_, err = repos.Messages.GetMessageByID(ctx, groupID, messages["old1"].ID)
+		assert.NoError(t, err)
+		audits, err := repos.PurgeAudits.ListPurges(ctx, groupID)
+		require.NoError(t, err)
+		assert.Empty(t, audits)
+	})
+
+	t.Run("A failing group does not stop the others", func(t *testing.T) {
+		messageRepo := new(MockMessageRepository)
+		settingsRepo := new(MockGroupSettingsRepository)
+		audits := repositories.NewMemoryPurgeAuditRepository()
+		service := NewRetentionService(messageRepo, nil, settingsRepo, audits, RetentionConfig{BatchSize: 10}, util.NewLoggerFactory())
+
+		failing, healthy := uuid.New(), uuid.New()
+		expired := []models.Message{{ID: uuid.New(), GroupID: healthy, SentAt: now.AddDate(-1, 0, 0)}}
+		settingsRepo.On("ListRetentionPolicies", ctx).Return([]models.GroupSettings{
+			{GroupID: failing, RetentionDays: 7},
+			{GroupID: healthy, RetentionDays: 7},
+		}, nil)
+		messageRepo.On("ListExpiredMessages", ctx, failing, mock.Anything).Return([]models.Message{}, errors.New("storage unavailable"))
+		messageRepo.On("ListExpiredMessages", ctx, healthy, mock.MatchedBy(func(q models.RetentionQuery) bool { return q.Position == nil })).
+			Return(expired, nil)
+		messageRepo.On("ListExpiredMessages", ctx, healthy, mock.MatchedBy(func(q models.RetentionQuery) bool { return q.Position != nil })).
+			Return([]models.Message{}, nil)
+		messageRepo.On("DeleteMessages", ctx, healthy, expired).Return(nil)
+
+		reports, err := service.PurgeExpiredMessages(ctx, false)
+		assert.ErrorContains(t, err, "storage unavailable")
+		require.Len(t, reports, 2)
+		assert.Equal(t, 1, reports[1].MessageCount)
+		messageRepo.AssertExpectations(t)
+	})
+}
+
+func TestPurgeArchivedMessages(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	repos := repositories.NewMemoryRepositories()
+	repos.Archive = repositories.NewMessageArchive(repositories.NewFileArchiveStore(t.TempDir()))
+	repos.Messages = repositories.NewArchivedMessageRepository(repos.Messages, repos.Archive)
+
+	archiver := NewArchiveService(repos.Messages, repos.Archive, ArchiveConfig{After: 90 * 24 * time.Hour, BatchSize: 10},
+		util.NewLoggerFactory()).(*archiveService)
+	archiver.now = func() time.Time { return now }
+	purger := NewRetentionService(repos.Messages, repos.Archive, repos.GroupSettings, repos.PurgeAudits,
+		RetentionConfig{BatchSize: 2}, util.NewLoggerFactory()).(*retentionService)
+	purger.now = func() time.Time { return now }
+
+	groupID := uuid.New()
+	require.NoError(t, repos.GroupSettings.SaveSettings(ctx,
+		&models.GroupSettings{GroupID: groupID, RetentionDays: 180, RetentionKeepPinned: true}))
+
+	messages := make(map[string]models.Message)
+	for name, age := range map[string]int{"oldest": 400, "old1": 300, "old2": 299, "pinned": 250, "archived": 120, "recent": 10} {
+		message := models.Message{ID: uuid.New(), GroupID: groupID, SenderID: uuid.New(), SenderName: "Anna",
+			Content: "bericht " + name, SentAt: now.AddDate(0, 0, -age)}
+		require.NoError(t, repos.Messages.CreateMessage(ctx, groupID, &message))
+		messages[name] = message
+	}
+	_, err := repos.Messages.ToggleMessagePin(ctx, groupID, messages["pinned"].ID, "")
+	require.NoError(t, err)
+
+	archived, err := archiver.ArchiveOldMessages(ctx)
+	require.NoError(t, err)
+	require.Len(t, archived, 1)
+	require.Equal(t, 5, archived[0].MessageCount)
+
+	reports, err := purger.PurgeExpiredMessages(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, reports[0].MessageCount, "archived messages count in dry runs")
+	kept, err := repos.Archive.ExpiredMessages(ctx, groupID, archiveMonthOf(messages["oldest"]), now, false)
+	require.NoError(t, err)
+	assert.Len(t, kept, 1, "dry runs keep the archive")
+
+	reports, err = purger.PurgeExpiredMessages(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal(t, 3, reports[0].MessageCount)
+
+	var timeline []uuid.UUID
+	page, _, err := repos.Messages.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 10, Direction: models.Next})
+	require.NoError(t, err)
+	for _, message := range page {
+		timeline = append(timeline, message.ID)
+	}
+	assert.Equal(t, []uuid.UUID{messages["recent"].ID, messages["archived"].ID, messages["pinned"].ID}, timeline,
+		"expired archived messages are gone and pinned ones are kept")
+
+	months, err := repos.Archive.ExpiredMonths(ctx, groupID, now)
+	require.NoError(t, err)
+	assert.NotContains(t, months, archiveMonthOf(messages["oldest"]), "emptied months are deleted")
+
+	audits, err := repos.PurgeAudits.ListPurges(ctx, groupID)
+	require.NoError(t, err)
+	var purged []uuid.UUID
+	for _, audit := range audits {
+		purged = append(purged, audit.MessageIDs...)
+	}
+	assert.ElementsMatch(t, []uuid.UUID{messages["oldest"].ID, messages["old1"].ID, messages["old2"].ID}, purged)
+}
+
+func archiveMonthOf(message models.Message) string {
+	return message.SentAt.UTC().Format("2006-01")
+}
+
+func TestUpdateGroupSettingsRetention(t *testing.T) {
+	ctx := context.Background()
+	service := NewGroupSettingsService(repositories.NewMemoryGroupSettingsRepository())
+	groupID := uuid.New()
+
+	days, keepPinned := 365, true
+	settings, err := service.UpdateSettings(ctx, groupID, models.GroupSettingsUpdate{RetentionDays: &days, RetentionKeepPinned: &keepPinned})
+	require.NoError(t, err)
+	assert.Equal(t, 365, settings.RetentionDays)
+	assert.True(t, settings.RetentionKeepPinned)
+
+	for _, invalid := range []int{-1, MaxRetentionDays + 1} {
+		_, err := service.UpdateSettings(ctx, groupID, models.GroupSettingsUpdate{RetentionDays: &invalid})
+		assert.ErrorIs(t, err, ErrInvalidRetentionDays)
+	}
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// forEachStorageBackend runs the test once per backend of repositories.BackendsUnderTest
+func forEachStorageBackend(t *testing.T, test func(t *testing.T, repos *repositories.Repositories)) {
+	backends, err := repositories.BackendsUnderTest()
+	require.NoError(t, err)
+	for _, backend := range backends {
+		t.Run(backend.Name, func(t *testing.T) {
+			repos, close, err := backend.Open()
+			require.NoError(t, err)
+			t.Cleanup(close)
+			test(t, repos)
+		})
+	}
+}
+
+func TestMessageServiceWithStorageBackends(t *testing.T) {
+	forEachStorageBackend(t, func(t *testing.T, repos *repositories.Repositories) {
+		ctx := context.Background()
+
+		templates, err := NewTemplateCatalogue("", "nl")
+		require.NoError(t, err)
+		emulator := NewMemoryEmulatorSender(nil)
+		notificationService := NewNotificationService(emulator, repos.Messages, templates)
+		service := NewMessageService(repos.Messages, repos.FCMTokens, repos.UserPreferences, repos.GroupSettings,
+			notificationService, NewValidationService(""), newTestCursorCodec(t))
+
+		t.Run("Create, get and pin a message", func(t *testing.T) {
+			groupID := uuid.New()
+			senderID := uuid.New()
+			memberID := uuid.New()
+
+			require.NoError(t, NewFCMTokenService(repos.FCMTokens).SaveToken(ctx, groupID, memberID, "device-"+memberID.String(), "en"))
+
+			created, err := service.CreateMessage(ctx, groupID, senderID, "Anna", models.BadgeNone, models.MessageCreate{Content: "Hallo <b>allemaal</b>"})
+			require.NoError(t, err)
+
+			message, err := service.GetMessage(ctx, groupID, created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, created.Content, message.Content)
+			assert.Equal(t, "Anna", message.SenderName)
+			assert.False(t, message.IsPinned)
+
+			pinned, err := service.ToggleMessagePin(ctx, groupID, created.ID, message.ETag)
+			require.NoError(t, err)
+			assert.True(t, pinned.IsPinned)
+
+			_, err = service.ToggleMessagePin(ctx, groupID, created.ID, message.ETag)
+			assert.ErrorIs(t, err, ErrMessageConflict, "the ETag changed with the first toggle")
+
+			require.Eventually(t, func() bool {
+				recorded, _ := emulator.Recorded()
+				return len(recorded) == 1
+			}, 5*time.Second, 10*time.Millisecond)
+			recorded, _ := emulator.Recorded()
+			assert.Equal(t, "New message from Anna", recorded[0].Title)
+		})
+
+		t.Run("Professionals post with a badge and delete messages", func(t *testing.T) {
+			groupID := uuid.New()
+
+			created, err := service.CreateMessage(ctx, groupID, uuid.New(), "Dr. Berg", models.BadgeProfessional, models.MessageCreate{Content: "Hallo"})
+			require.NoError(t, err)
+
+			message, err := service.GetMessage(ctx, groupID, created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, models.BadgeProfessional, message.SenderBadge)
+
+			require.NoError(t, service.DeleteMessage(ctx, groupID, created.ID))
+			_, err = service.GetMessage(ctx, groupID, created.ID)
+			assert.ErrorIs(t, err, ErrMessageNotFound)
+			assert.ErrorIs(t, service.DeleteMessage(ctx, groupID, created.ID), ErrMessageNotFound)
+		})
+
+		t.Run("End-to-end encrypted groups store ciphertext and send no content", func(t *testing.T) {
+			groupID := uuid.New()
+			memberID := uuid.New()
+			token := "device-" + memberID.String()
+			require.NoError(t, repos.GroupSettings.SaveSettings(ctx, &models.GroupSettings{GroupID: groupID, EndToEndEncrypted: true}))
+			require.NoError(t, NewFCMTokenService(repos.FCMTokens).SaveToken(ctx, groupID, memberID, token, "en"))
+
+			ciphertext := "PGI+Y2lwaGVydGV4dDwvYj4="
+			envelopes := []models.KeyEnvelope{{RecipientID: memberID, DeviceID: "phone", Ciphertext: "a2V5"}}
+			_, err := service.CreateMessage(ctx, groupID, uuid.New(), "Anna", models.BadgeNone, models.MessageCreate{Content: ciphertext})
+			assert.ErrorIs(t, err, ErrInvalidEncryptedMessage, "envelopes are required")
+
+			created, err := service.CreateMessage(ctx, groupID, uuid.New(), "Anna", models.BadgeNone, models.MessageCreate{Content: ciphertext, Envelopes: envelopes})
+			require.NoError(t, err)
+			message, err := service.GetMessage(ctx, groupID, created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, ciphertext, message.Content, "ciphertext is not sanitised")
+			assert.Equal(t, envelopes, message.Envelopes)
+
+			_, _, err = service.SearchMessages(ctx, groupID, models.SearchQuery{Text: "cipher", PageSize: 1})
+			assert.ErrorIs(t, err, ErrSearchDisabled)
+
+			var sent RecordedNotification
+			require.Eventually(t, func() bool {
+				recorded, _ := emulator.Recorded()
+				for _, notification := range recorded {
+					if len(notification.Tokens) == 1 && notification.Tokens[0] == token {
+						sent = notification
+						return true
+					}
+				}
+				return false
+			}, 5*time.Second, 10*time.Millisecond)
+			assert.NotContains(t, sent.Body, ciphertext)
+			assert.NotContains(t, sent.Title, "Anna")
+
+			_, err = service.CreateMessage(ctx, uuid.New(), uuid.New(), "Anna", models.BadgeNone, models.MessageCreate{Content: "Hallo", Envelopes: envelopes})
+			assert.ErrorIs(t, err, ErrInvalidEncryptedMessage, "plaintext groups do not accept envelopes")
+		})
+
+		t.Run("Unknown message is not found", func(t *testing.T) {
+			_, err := service.GetMessage(ctx, uuid.New(), uuid.New())
+			assert.ErrorIs(t, err, ErrMessageNotFound)
+		})
+
+		t.Run("Pages newest first", func(t *testing.T) {
+			groupID := uuid.New()
+			start := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+			var ids []uuid.UUID
+			for i := 0; i < 5; i++ {
+				message := &models.Message{
+					ID:         uuid.New(),
+					GroupID:    groupID,
+					SenderID:   uuid.New(),
+					SenderName: "Anna",
+					Content:    "bericht",
+					SentAt:     start.Add(time.Duration(i) * time.Minute),
+				}
+				require.NoError(t, repos.Messages.CreateMessage(ctx, groupID, message))
+				ids = append([]uuid.UUID{message.ID}, ids...)
+			}
+
+			first, pagination, err := service.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 2, Direction: models.Next})
+			require.NoError(t, err)
+			assert.Equal(t, ids[:2], responseIDs(first))
+			assert.True(t, pagination.HasNext)
+			assert.False(t, pagination.HasPrevious)
+
+			second, pagination, err := service.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 2, Direction: models.Next, Cursor: pagination.NextCursor})
+			require.NoError(t, err)
+			assert.Equal(t, ids[2:4], responseIDs(second))
+			assert.True(t, pagination.HasPrevious)
+
+			// The previous cursor carries its own direction
+			back, _, err := service.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 2, Direction: models.Next, Cursor: pagination.PreviousCursor})
+			require.NoError(t, err)
+			assert.Equal(t, ids[:2], responseIDs(back))
+
+			_, _, err = service.GetMessages(ctx, uuid.New(), models.PaginationQuery{PageSize: 2, Direction: models.Next, Cursor: pagination.NextCursor})
+			assert.ErrorIs(t, err, ErrInvalidCursor, "cursors only work for the group they were issued for")
+
+			unread, err := repos.Messages.CountUnreadMessages(ctx, groupID, start.Add(90*time.Second))
+			require.NoError(t, err)
+			assert.Equal(t, 3, unread)
+		})
+
+		t.Run("Search returns highlighted snippets with search cursors", func(t *testing.T) {
+			groupID := uuid.New()
+			senderID := uuid.New()
+			for _, content := range []string{"Oma wil morgen wandelen", "Geen tijd vandaag", "Na de wandeling koffie & taart"} {
+				_, err := service.CreateMessage(ctx, groupID, senderID, "Anna", models.BadgeNone, models.MessageCreate{Content: content})
+				require.NoError(t, err)
+			}
+
+			first, pagination, err := service.SearchMessages(ctx, groupID, models.SearchQuery{Text: "wandelen", PageSize: 1})
+			require.NoError(t, err)
+			require.Len(t, first, 1)
+			assert.Equal(t, "Na de <mark>wandeling</mark> koffie &amp; taart", first[0].Snippet)
+			require.True(t, pagination.HasNext)
+			require.NotNil(t, pagination.NextCursor)
+			cursor := pagination.NextCursor
+
+			second, pagination, err := service.SearchMessages(ctx, groupID, models.SearchQuery{Text: "wandelen", PageSize: 1, Cursor: cursor})
+			require.NoError(t, err)
+			require.Len(t, second, 1)
+			assert.Equal(t, "Oma wil morgen <mark>wandelen</mark>", second[0].Snippet)
+			assert.False(t, pagination.HasNext)
+
+			_, _, err = service.SearchMessages(ctx, groupID, models.SearchQuery{Text: "koffie", PageSize: 1, Cursor: cursor})
+			assert.ErrorIs(t, err, ErrInvalidCursor, "search cursors only continue the search they were issued for")
+
+			// The search parameter of the timeline is answered from the index as well
+			search := "wandelen"
+			timeline, pagination, err := service.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 1, Direction: models.Next, Search: &search})
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{first[0].ID}, responseIDs(timeline), "stems match like they do in search")
+			require.True(t, pagination.HasNext)
+			timeline, _, err = service.GetMessages(ctx, groupID, models.PaginationQuery{PageSize: 1, Direction: models.Next, Search: &search, Cursor: pagination.NextCursor})
+			require.NoError(t, err)
+			assert.Equal(t, []uuid.UUID{second[0].ID}, responseIDs(timeline))
+		})
+	})
+}
+
+func responseIDs(messages []models.MessageResponse) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ErrInvalidRevocation is returned for revocations without exactly one valid token or session ID
+var ErrInvalidRevocation = errors.New("invalid revocation")
+
+// revocationIDPattern accepts the token and session IDs Keycloak issues and keeps them usable as a storage key
+var revocationIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type revocationKey struct {
+	kind models.RevocationKind
+	id   string
+}
+
+type TokenRevocationConfig struct {
+	// TTL is how long a revocation stays in force when no expiry is given. It should be at least the lifetime
+	// of the access tokens.
+	TTL time.Duration
+}
+
+// tokenRevocationService keeps the denylist in memory, so checking a token costs no storage round trip.
+// Revocations made on other instances are picked up by Refresh.
+type tokenRevocationService struct {
+	repo    repositories.TokenRevocationRepository
+	config  TokenRevocationConfig
+	logger  util.Logger
+	now     func() time.Time
+	mu      sync.RWMutex
+	revoked map[revocationKey]time.Time
+}
+
+func NewTokenRevocationService(
+	repo repositories.TokenRevocationRepository,
+	config TokenRevocationConfig,
+	loggerFactory util.LoggerFactory,
+) TokenRevocationService {
+	return &tokenRevocationService{
+		repo:    repo,
+		config:  config,
+		logger:  loggerFactory.NewLogger("TokenRevocationService"),
+		now:     time.Now,
+		revoked: make(map[revocationKey]time.Time),
+	}
+}
+
+// StartTokenRevocationRefresher reloads the denylist every interval until the context is cancelled
+func StartTokenRevocationRefresher(ctx context.Context, service TokenRevocationService, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := service.Refresh(ctx); err != nil {
+					fmt.Printf("Error refreshing token revocations: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// Revoke denies a token or a session from now on. On this instance it takes effect at once, on the others
+// after their next refresh.
+func (s *tokenRevocationService) Revoke(ctx context.Context, revokedBy string, create models.TokenRevocationCreate) (*models.TokenRevocation, error) {
+	now := s.now().UTC().Truncate(time.Second)
+	revocation := &models.TokenRevocation{
+		Reason:    create.Reason,
+		RevokedBy: revokedBy,
+		RevokedAt: now,
+		ExpiresAt: now.Add(s.config.TTL),
+	}
+	switch {
+	case (create.TokenID == "") == (create.SessionID == ""):
+		return nil, fmt.Errorf("%w: set either jti or sid", ErrInvalidRevocation)
+	case create.TokenID != "":
+		revocation.Kind, revocation.ID = models.RevokeToken, create.TokenID
+	default:
+		revocation.Kind, revocation.ID = models.RevokeSession, create.SessionID
+	}
+	if !revocationIDPattern.MatchString(revocation.ID) {
+		return nil, fmt.Errorf("%w: %s must be 1 to 128 letters, digits, '.', '_', ':' or '-'", ErrInvalidRevocation, revocation.Kind)
+	}
+	if len(create.Reason) > 500 {
+		return nil, fmt.Errorf("%w: reason must be at most 500 characters", ErrInvalidRevocation)
+	}
+	if create.ExpiresAt != nil {
+		if !create.ExpiresAt.After(now) {
+			return nil, fmt.Errorf("%w: expiresAt must be in the future", ErrInvalidRevocation)
+		}
+		revocation.ExpiresAt = create.ExpiresAt.UTC().Truncate(time.Second)
+	}
+
+	if err := s.repo.Revoke(ctx, revocation); err != nil {
+		return nil, fmt.Errorf("error saving token revocation: %w", err)
+	}
+	s.mu.Lock()
+	s.revoked[revocationKey{revocation.Kind, revocation.ID}] = revocation.ExpiresAt
+	s.mu.Unlock()
+
+	s.logger.Info("Token revoked", "kind", revocation.Kind, "id", revocation.ID, "revokedBy", revokedBy)
+	return revocation, nil
+}
+
+// ListRevocations returns the revocations that are in force
+func (s *tokenRevocationService) ListRevocations(ctx context.Context) ([]models.TokenRevocation, error) {
+	revocations, err := s.repo.ListRevocations(ctx, s.now())
+	if err != nil {
+		return nil, fmt.Errorf("error listing token revocations: %w", err)
+	}
+	return revocations, nil
+}
+
+// IsRevoked reports whether a token ID or a session ID is on the denylist. Empty IDs are never revoked.
+func (s *tokenRevocationService) IsRevoked(tokenID string, sessionID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	if expiresAt, ok := s.revoked[revocationKey{models.RevokeToken, tokenID}]; ok && tokenID != "" && expiresAt.After(now) {
+		return true
+	}
+	if expiresAt, ok := s.revoked[revocationKey{models.RevokeSession, sessionID}]; ok && sessionID != "" && expiresAt.After(now) {
+		return true
+	}
+	return false
+}
+
+// Refresh replaces the denylist with the revocations in storage, dropping the expired ones. On failure the
+// current denylist is kept.
+func (s *tokenRevocationService) Refresh(ctx context.Context) error {
+	revocations, err := s.repo.ListRevocations(ctx, s.now())
+	if err != nil {
+		return fmt.Errorf("error loading token revocations: %w", err)
+	}
+
+	revoked := make(map[revocationKey]time.Time, len(revocations))
+	for _, revocation := range revocations {
+		revoked[revocationKey{revocation.Kind, revocation.ID}] = revocation.ExpiresAt
+	}
+	s.mu.Lock()
+	s.revoked = revoked
+	s.mu.Unlock()
+	return nil
+}
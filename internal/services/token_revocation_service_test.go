@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"Groupchat-Service/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenRevocationService(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryTokenRevocationRepository()
+	config := TokenRevocationConfig{TTL: time.Hour}
+	service := NewTokenRevocationService(repo, config, util.NewLoggerFactory())
+
+	t.Run("Revokes tokens and sessions at once", func(t *testing.T) {
+		revocation, err := service.Revoke(ctx, "admin", models.TokenRevocationCreate{TokenID: "token-1", Reason: "stolen"})
+		require.NoError(t, err)
+		assert.Equal(t, models.RevokeToken, revocation.Kind)
+		assert.Equal(t, revocation.RevokedAt.Add(time.Hour), revocation.ExpiresAt)
+
+		_, err = service.Revoke(ctx, "admin", models.TokenRevocationCreate{SessionID: "session-1"})
+		require.NoError(t, err)
+
+		assert.True(t, service.IsRevoked("token-1", ""))
+		assert.True(t, service.IsRevoked("token-2", "session-1"))
+		assert.False(t, service.IsRevoked("token-2", "session-2"))
+		assert.False(t, service.IsRevoked("", ""))
+		assert.False(t, service.IsRevoked("session-1", "token-1"), "token and session IDs are not interchangeable")
+	})
+
+	t.Run("Refuses invalid revocations", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		for _, create := range []models.TokenRevocationCreate{
+			{},
+			{TokenID: "token-1", SessionID: "session-1"},
+			{TokenID: "token/1"},
+			{SessionID: "session-1", ExpiresAt: &past},
+		} {
+			_, err := service.Revoke(ctx, "admin", create)
+			assert.ErrorIs(t, err, ErrInvalidRevocation, "%+v", create)
+		}
+	})
+
+	t.Run("Refresh picks up revocations of other instances", func(t *testing.T) {
+		other := NewTokenRevocationService(repo, config, util.NewLoggerFactory())
+		assert.False(t, other.IsRevoked("token-1", ""))
+		require.NoError(t, other.Refresh(ctx))
+		assert.True(t, other.IsRevoked("token-1", ""))
+		assert.True(t, other.IsRevoked("", "session-1"))
+
+		revocations, err := other.ListRevocations(ctx)
+		require.NoError(t, err)
+		assert.Len(t, revocations, 2)
+	})
+
+	t.Run("Expired revocations no longer deny", func(t *testing.T) {
+		expiring := NewTokenRevocationService(repo, config, util.NewLoggerFactory()).(*tokenRevocationService)
+		require.NoError(t, expiring.Refresh(ctx))
+		expiring.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		assert.False(t, expiring.IsRevoked("token-1", ""))
+	})
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ErrEmailRequired is returned when a user opts in to the email digest without a known email address
+var ErrEmailRequired = errors.New("an email address is required for the email digest")
+
+type userPreferencesService struct {
+	repo repositories.UserPreferencesRepository
+}
+
+func NewUserPreferencesService(repo repositories.UserPreferencesRepository) UserPreferencesService {
+	return &userPreferencesService{repo: repo}
+}
+
+func (s *userPreferencesService) GetPreferences(ctx context.Context, userID uuid.UUID) (*models.UserPreferences, error) {
+	return s.repo.GetPreferences(ctx, userID)
+}
+
+// UpdatePreferences applies the fields set in the update on top of the stored preferences.
+// Opting in to the email digest subscribes the given email address to digests of the given group, starting
+// with the messages sent from now on; opting out unsubscribes from that group only. The digest stays on
+// while the user is subscribed to any group.
+func (s *userPreferencesService) UpdatePreferences(ctx context.Context, userID uuid.UUID, groupID uuid.UUID, email string, update models.UserPreferencesUpdate) (*models.UserPreferences, error) {
+	preferences, err := s.repo.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting preferences: %w", err)
+	}
+
+	if update.Locale != nil {
+		preferences.Locale = normalizeLocale(*update.Locale)
+	}
+	if update.PrivateNotifications != nil {
+		preferences.PrivateNotifications = *update.PrivateNotifications
+	}
+	if update.EmailDigest != nil {
+		if *update.EmailDigest {
+			if email == "" {
+				return nil, ErrEmailRequired
+			}
+			if preferences.DigestGroups == nil {
+				preferences.DigestGroups = make(map[uuid.UUID]time.Time)
+			}
+			if _, subscribed := preferences.DigestGroups[groupID]; !subscribed {
+				preferences.DigestGroups[groupID] = time.Now().UTC()
+			}
+			preferences.Email = email
+		} else {
+			delete(preferences.DigestGroups, groupID)
+			if len(preferences.DigestGroups) == 0 {
+				preferences.DigestGroups = nil
+			}
+		}
+		preferences.EmailDigest = len(preferences.DigestGroups) > 0
+	}
+
+	if err := s.repo.SavePreferences(ctx, preferences); err != nil {
+		return nil, fmt.Errorf("error saving preferences: %w", err)
+	}
+
+	return preferences, nil
+}
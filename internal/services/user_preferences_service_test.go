@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"Groupchat-Service/internal/database/repositories"
+	"Groupchat-Service/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdatePreferencesSubscribesPerGroup(t *testing.T) {
+	ctx := context.Background()
+	service := NewUserPreferencesService(repositories.NewMemoryUserPreferencesRepository())
+	userID, groupID, otherGroupID := uuid.New(), uuid.New(), uuid.New()
+	on, off := true, false
+
+	_, err := service.UpdatePreferences(ctx, userID, groupID, "", models.UserPreferencesUpdate{EmailDigest: &on})
+	assert.ErrorIs(t, err, ErrEmailRequired)
+
+	preferences, err := service.UpdatePreferences(ctx, userID, groupID, "anna@example.com", models.UserPreferencesUpdate{EmailDigest: &on})
+	require.NoError(t, err)
+	subscribedAt := preferences.DigestGroups[groupID]
+
+	preferences, err = service.UpdatePreferences(ctx, userID, otherGroupID, "anna@example.com", models.UserPreferencesUpdate{EmailDigest: &on})
+	require.NoError(t, err)
+	assert.Len(t, preferences.DigestGroups, 2)
+	assert.Equal(t, subscribedAt, preferences.DigestGroups[groupID], "subscribing again keeps the last digest time")
+
+	preferences, err = service.UpdatePreferences(ctx, userID, groupID, "anna@example.com", models.UserPreferencesUpdate{EmailDigest: &off})
+	require.NoError(t, err)
+	assert.True(t, preferences.EmailDigest, "the digest of the other group stays on")
+	assert.NotContains(t, preferences.DigestGroups, groupID)
+
+	preferences, err = service.UpdatePreferences(ctx, userID, otherGroupID, "anna@example.com", models.UserPreferencesUpdate{EmailDigest: &off})
+	require.NoError(t, err)
+	assert.False(t, preferences.EmailDigest)
+	assert.Empty(t, preferences.DigestGroups)
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"golang.org/x/text/language"
+	"net/mail"
 	"strconv"
 	"strings"
 	"unicode/utf8"
@@ -17,6 +19,7 @@ const (
 	MaxPageSize     = 50
 	MaxSearchLength = 100
 	MaxTokenLength  = 1024
+	MaxLocaleLength = 35
 )
 
 type validationService struct {
@@ -61,6 +64,36 @@ func (v *validationService) ValidatePaginationQuery(queryParams map[string]strin
 	return query, nil
 }
 
+func (v *validationService) ValidateSearchQuery(queryParams map[string]string) (models.SearchQuery, error) {
+	query := models.SearchQuery{PageSize: DefaultPageSize}
+
+	for key, value := range queryParams {
+		switch strings.ToLower(key) {
+		case "q":
+			query.Text = strings.TrimSpace(value)
+		case "pagesize":
+			pageSize, err := strconv.Atoi(value)
+			if err != nil || pageSize < MinPageSize || pageSize > MaxPageSize {
+				return query, fmt.Errorf("page size must be between %d and %d", MinPageSize, MaxPageSize)
+			}
+			query.PageSize = pageSize
+		case "cursor":
+			if value != "" {
+				query.Cursor = &value
+			}
+		}
+	}
+
+	if query.Text == "" {
+		return query, errors.New("search text is required")
+	}
+	if utf8.RuneCountInString(query.Text) > MaxSearchLength {
+		return query, fmt.Errorf("search term too long: maximum %d characters", MaxSearchLength)
+	}
+
+	return query, nil
+}
+
 func (v *validationService) ValidateUserContext(ctx context.Context) (uuid.UUID, string, error) {
 	userID, ok := ctx.Value("userID").(uuid.UUID)
 	if !ok {
@@ -99,6 +132,24 @@ func (v *validationService) ValidateToken(token string) error {
 	return nil
 }
 
+func (v *validationService) ValidateLocale(locale string) error {
+	if len(locale) == 0 || len(locale) > MaxLocaleLength {
+		return errors.New("invalid locale length")
+	}
+	if _, err := language.Parse(locale); err != nil {
+		return errors.New("invalid locale")
+	}
+	return nil
+}
+
+func (v *validationService) ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return errors.New("invalid email address")
+	}
+	return nil
+}
+
 type User struct {
 	ID        uuid.UUID `json:"id"`
 	Email     string    `json:"email"`
@@ -74,3 +74,52 @@ func TestValidatePaginationQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateSearchQuery(t *testing.T) {
+	vs := NewValidationService("")
+
+	tests := []struct {
+		name        string
+		queryParams map[string]string
+		expected    models.SearchQuery
+		expectErr   bool
+	}{
+		{
+			name:        "Valid query",
+			queryParams: map[string]string{"q": "  wandelen  ", "pageSize": "20", "cursor": "some-cursor"},
+			expected:    models.SearchQuery{Text: "wandelen", PageSize: 20, Cursor: ptr("some-cursor")},
+		},
+		{
+			name:        "Defaults the page size",
+			queryParams: map[string]string{"q": "wandelen", "cursor": ""},
+			expected:    models.SearchQuery{Text: "wandelen", PageSize: DefaultPageSize},
+		},
+		{
+			name:        "Missing search text",
+			queryParams: map[string]string{"q": " "},
+			expectErr:   true,
+		},
+		{
+			name:        "Search text too long",
+			queryParams: map[string]string{"q": strings.Repeat("a", MaxSearchLength+1)},
+			expectErr:   true,
+		},
+		{
+			name:        "Invalid page size",
+			queryParams: map[string]string{"q": "wandelen", "pageSize": "0"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := vs.ValidateSearchQuery(tt.queryParams)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, query)
+			}
+		})
+	}
+}
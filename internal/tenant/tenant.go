@@ -0,0 +1,112 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrMissingTenant is returned when data is accessed without a tenant scope
+var ErrMissingTenant = errors.New("missing tenant")
+
+// ErrUnknownTenant is returned when the tenant scope names a tenant that is not configured
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// idPattern allows tenant IDs such as "acme" or a UUID
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// prefixPattern keeps prefixed table names valid: Azure table names start with a letter and are alphanumeric
+var prefixPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]{0,31}$`)
+
+type contextKey struct{}
+
+// WithTenant returns a context scoped to the given tenant
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant the context is scoped to
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// ValidID reports whether id can name a tenant
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// Storage selects where the data of a tenant is kept. Tenants with a connection string get a storage account
+// (or database) of their own; the others share the default account and are kept apart by their table prefix.
+type Storage struct {
+	TablePrefix      string `json:"tablePrefix"`
+	ConnectionString string `json:"connectionString"`
+}
+
+// Tenants holds the storage of every configured tenant by tenant ID
+type Tenants map[string]Storage
+
+// IDs returns the configured tenant IDs in sorted order
+func (t Tenants) IDs() []string {
+	ids := make([]string, 0, len(t))
+	for id := range t {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// tenantsFile is the layout of a tenants file
+type tenantsFile struct {
+	Tenants Tenants `json:"tenants"`
+}
+
+// LoadTenantsFile reads the tenants from a JSON file of the form
+// {"tenants": {"<id>": {"tablePrefix": "<prefix>", "connectionString": "<connection string>"}}}.
+func LoadTenantsFile(path string) (Tenants, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file: %w", err)
+	}
+
+	var file tenantsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants file: %w", err)
+	}
+	if err := file.Tenants.Validate(); err != nil {
+		return nil, err
+	}
+	return file.Tenants, nil
+}
+
+// Validate checks that every tenant has a valid ID and that no two tenants can share tables: tenants on the
+// same storage account need distinct table prefixes. Azure table names are case-insensitive, so prefixes
+// that only differ in case are rejected as well.
+func (t Tenants) Validate() error {
+	if len(t) == 0 {
+		return fmt.Errorf("no tenants configured")
+	}
+
+	prefixes := make(map[string]string)
+	for _, id := range t.IDs() {
+		storage := t[id]
+		if !ValidID(id) {
+			return fmt.Errorf("tenant ID %q must be 1-64 letters, digits, '-' or '_'", id)
+		}
+		if storage.TablePrefix != "" && !prefixPattern.MatchString(storage.TablePrefix) {
+			return fmt.Errorf("table prefix %q of tenant %s must start with a letter and be at most 32 letters or digits", storage.TablePrefix, id)
+		}
+
+		account := storage.ConnectionString + "\x00" + strings.ToLower(storage.TablePrefix)
+		if other, ok := prefixes[account]; ok {
+			return fmt.Errorf("tenants %s and %s share a storage account and table prefix", other, id)
+		}
+		prefixes[account] = id
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package tenant
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	_, ok = FromContext(WithTenant(context.Background(), ""))
+	assert.False(t, ok, "an empty tenant is no scope")
+
+	id, ok := FromContext(WithTenant(context.Background(), "acme"))
+	assert.True(t, ok)
+	assert.Equal(t, "acme", id)
+}
+
+func TestLoadTenantsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"tenants": {
+		"acme": {"tablePrefix": "Acme"},
+		"beta": {"connectionString": "UseDevelopmentStorage=true;"}
+	}}`), 0o600))
+
+	tenants, err := LoadTenantsFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme", "beta"}, tenants.IDs())
+	assert.Equal(t, "Acme", tenants["acme"].TablePrefix)
+	assert.Equal(t, "UseDevelopmentStorage=true;", tenants["beta"].ConnectionString)
+
+	_, err = LoadTenantsFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants Tenants
+		valid   bool
+	}{
+		{"distinct prefixes", Tenants{"acme": {TablePrefix: "Acme"}, "beta": {TablePrefix: "Beta"}}, true},
+		{"one tenant on the unprefixed tables", Tenants{"acme": {}, "beta": {TablePrefix: "Beta"}}, true},
+		{"own accounts without prefix", Tenants{"acme": {ConnectionString: "a"}, "beta": {ConnectionString: "b"}}, true},
+		{"no tenants", Tenants{}, false},
+		{"shared tables", Tenants{"acme": {}, "beta": {}}, false},
+		{"same prefix", Tenants{"acme": {TablePrefix: "Shared"}, "beta": {TablePrefix: "Shared"}}, false},
+		{"prefixes only differ in case", Tenants{"acme": {TablePrefix: "Shared"}, "beta": {TablePrefix: "shared"}}, false},
+		{"same account and prefix", Tenants{"acme": {ConnectionString: "a"}, "beta": {ConnectionString: "a"}}, false},
+		{"prefix starts with a digit", Tenants{"acme": {TablePrefix: "1Acme"}}, false},
+		{"prefix with a dash", Tenants{"acme": {TablePrefix: "Ac-me"}}, false},
+		{"invalid tenant ID", Tenants{"ac me": {TablePrefix: "Acme"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tenants.Validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}